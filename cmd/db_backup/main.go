@@ -0,0 +1,227 @@
+// Command db_backup creates, lists, verifies, restores and prunes backups of the
+// go-fast-cdn database.
+//
+// Usage:
+//
+//	db_backup create [-dir path] [-files] [-target url]...
+//	db_backup list [-dir path] [-target url]...
+//	db_backup prune [-dir path]
+//	db_backup verify [-dir path] <backup name>
+//	db_backup restore [-dir path] <backup name>
+//	db_backup restore-media [-dir path] [-type image|doc] [-checksum hex] <backup name> [file name]
+//	db_backup sandbox [-dir path] [-port 8081] [-into path] <backup name>
+//
+// With -files the backup is a tar.gz archive that also contains the uploaded
+// files; restoring it replaces both the database and the uploads folder.
+// -target copies the backup off-host to s3://bucket/prefix or
+// sftp://user@host/path, with credentials read from the environment, and
+// makes list include the backups stored there. Without -target the targets
+// in BACKUP_TARGETS are used. The server must be stopped before restoring a
+// backup.
+//
+// restore-media brings back a single image or document, selected by file name
+// or -checksum, without rolling back the rest of the database. It can be run
+// while the server is running.
+//
+// sandbox restores a backup into a separate directory (a temporary one unless
+// -into is given) and serves it read-only on -port, so historical state can be
+// inspected and single files recovered without touching the live data. The
+// temporary directory is removed when the server is stopped.
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/audit"
+	"github.com/kevinanielsen/go-fast-cdn/src/backup"
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/router"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+)
+
+type targetFlags []string
+
+func (t *targetFlags) String() string {
+	return strings.Join(*t, ",")
+}
+
+func (t *targetFlags) Set(value string) error {
+	*t = append(*t, value)
+	return nil
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s create|list|prune|verify|restore|restore-media|sandbox [flags] [backup name]\n", os.Args[0])
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	command := os.Args[1]
+
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	dir := flags.String("dir", "", "directory containing the db_data folder (defaults to the executable directory)")
+	files := flags.Bool("files", false, "include the uploaded files in the backup")
+	var targetURLs targetFlags
+	flags.Var(&targetURLs, "target", "remote target URL (s3://bucket/prefix or sftp://user@host/path), may be repeated")
+	port := flags.String("port", "8081", "port the sandbox server listens on")
+	into := flags.String("into", "", "directory to restore the sandbox into (defaults to a temporary directory)")
+	mediaType := flags.String("type", "", "media type to restore (image or doc, defaults to both)")
+	checksum := flags.String("checksum", "", "hex checksum of the media to restore instead of a file name")
+	flags.Parse(os.Args[2:])
+
+	util.LoadExPath()
+	if *dir != "" {
+		util.ExPath = *dir
+	}
+	database.ConnectToDB()
+	manager := backup.NewDefaultManager()
+	ctx := context.Background()
+
+	switch command {
+	case "create":
+		b, err := manager.Create(backup.OriginManual, *files)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Created %s (%d bytes)\n", b.Name, b.Size)
+		targets := parseTargets(targetURLs)
+		if err := manager.Push(ctx, b, targets); err != nil {
+			log.Fatal(err)
+		}
+		for _, target := range targets {
+			fmt.Printf("Uploaded %s to %s\n", b.Name, target)
+		}
+	case "list":
+		backups, err := manager.ListAll(ctx, parseTargets(targetURLs))
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, b := range backups {
+			fmt.Printf("%s\t%d\t%s\t%s\t%s\t%s\n", b.Name, b.Size, b.CreatedAt.Format("2006-01-02 15:04:05"), b.Origin, b.Integrity, strings.Join(b.Locations, ","))
+		}
+	case "prune":
+		removed, err := manager.Prune(backup.RetentionPolicyFromEnv())
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, name := range removed {
+			fmt.Printf("Removed %s\n", name)
+		}
+	case "verify":
+		if flags.Arg(0) == "" {
+			usage()
+		}
+		b, err := manager.Verify(flags.Arg(0))
+		if err != nil {
+			log.Fatal(err)
+		}
+		if b.Integrity != backup.IntegrityOK {
+			log.Fatalf("%s is %s: %s", b.Name, b.Integrity, b.IntegrityError)
+		}
+		fmt.Printf("%s is %s\n", b.Name, b.Integrity)
+	case "restore":
+		if flags.Arg(0) == "" {
+			usage()
+		}
+		if err := manager.Restore(flags.Arg(0)); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Restored %s\n", flags.Arg(0))
+	case "restore-media":
+		query := backup.MediaQuery{Type: *mediaType, FileName: flags.Arg(1)}
+		if query.FileName == "" {
+			sum, err := hex.DecodeString(*checksum)
+			if err != nil || len(sum) == 0 {
+				usage()
+			}
+			query.Checksum = sum
+		}
+		if flags.Arg(0) == "" {
+			usage()
+		}
+		restored, err := manager.RestoreMedia(flags.Arg(0), query)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Restored %s %s (id %d) from %s\n", restored.Type, restored.FileName, restored.ID, flags.Arg(0))
+	case "sandbox":
+		if flags.Arg(0) == "" {
+			usage()
+		}
+		runSandbox(manager, flags.Arg(0), *into, *port)
+	default:
+		usage()
+	}
+}
+
+// runSandbox restores a backup into dir and serves it read-only until the
+// process is interrupted.
+func runSandbox(manager *backup.Manager, name, dir, port string) {
+	temporary := dir == ""
+	if temporary {
+		var err error
+		if dir, err = os.MkdirTemp("", "go-fast-cdn-sandbox-"); err != nil {
+			log.Fatal(err)
+		}
+	}
+	cleanup := func() {
+		if temporary {
+			os.RemoveAll(dir)
+		}
+	}
+
+	if err := manager.RestoreInto(name, dir); err != nil {
+		cleanup()
+		log.Fatal(err)
+	}
+
+	util.ExPath = dir
+	database.ConnectToDB()
+	database.Migrate()
+	audit.Init(database.NewAuditLogRepo(database.DB))
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		cleanup()
+		os.Exit(0)
+	}()
+
+	fmt.Printf("Serving %s read-only from %s on port %s\n", name, dir, port)
+	gin.SetMode(gin.ReleaseMode)
+	router.ReadOnlyRouter(port)
+}
+
+// parseTargets parses the -target flags, falling back to BACKUP_TARGETS.
+func parseTargets(urls []string) []backup.Target {
+	if len(urls) == 0 {
+		targets, err := backup.TargetsFromEnv()
+		if err != nil {
+			log.Fatal(err)
+		}
+		return targets
+	}
+
+	targets := []backup.Target{}
+	for _, raw := range urls {
+		target, err := backup.ParseTarget(raw)
+		if err != nil {
+			log.Fatal(err)
+		}
+		targets = append(targets, target)
+	}
+	return targets
+}
@@ -0,0 +1,71 @@
+// Command export writes every image and document, plus a manifest of their
+// file names, checksums, owners and timestamps, to a directory or tarball
+// that can be imported into another go-fast-cdn instance with the import
+// command.
+//
+// Usage:
+//
+//	export [-dir path] <destination>
+//
+// A destination ending in .tar, .tar.gz or .tgz is written as a tarball;
+// otherwise it is a directory, which must not exist or be empty. Extract
+// tarballs before importing them. Records whose file is missing from the
+// uploads folder are left out and listed in the manifest.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/portable"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+)
+
+func main() {
+	dir := flag.String("dir", "", "directory containing the db_data and uploads folders (defaults to the executable directory)")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] <destination>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	util.LoadExPath()
+	if *dir != "" {
+		util.ExPath = *dir
+	}
+	database.ConnectToDB()
+
+	e := &portable.Exporter{
+		Images:        database.NewImageRepo(database.DB),
+		Docs:          database.NewDocRepo(database.DB),
+		Organizations: database.NewOrganizationRepo(database.DB),
+		UploadsDir:    filepath.Join(util.ExPath, "uploads"),
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	manifest, err := e.Export(ctx, flag.Arg(0), func(done, total int) {
+		if done%100 == 0 || done == total {
+			fmt.Fprintf(os.Stderr, "%d/%d files\n", done, total)
+		}
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, missing := range manifest.Missing {
+		fmt.Printf("missing\t%s\n", missing)
+	}
+	fmt.Printf("Exported %d files to %s, %d missing\n", len(manifest.Files), flag.Arg(0), len(manifest.Missing))
+}
@@ -0,0 +1,111 @@
+// Command import ingests an existing directory tree, e.g. the files of a
+// previous CDN, through the same validation and duplicate detection as
+// uploads.
+//
+// Usage:
+//
+//	import [-dir path] [-dry-run] [-org id] [-journal path] <source directory>
+//
+// Images and documents are told apart by their content; other files are
+// skipped. The relative path of a file is kept in its name, with the folders
+// joined by "-". -dry-run reports what would be imported without changing
+// anything.
+//
+// Directories written by the export command, or extracted from its tarballs,
+// are imported with the file names, UUIDs, timestamps and expiry recorded in
+// their manifest. Files whose owner names an existing organization are given
+// to it; the others to -org.
+//
+// The outcome of every file is recorded in a journal, by default in the
+// db_data/imports folder. Running the command again on the same directory
+// skips the files already handled and retries the ones that failed, so an
+// interrupted import can be resumed.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/importer"
+	ini "github.com/kevinanielsen/go-fast-cdn/src/initializers"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+)
+
+func main() {
+	dir := flag.String("dir", "", "directory containing the db_data and uploads folders (defaults to the executable directory)")
+	dryRun := flag.Bool("dry-run", false, "report what would be imported without importing anything")
+	org := flag.Uint("org", 0, "ID of the organization owning the imported files")
+	journal := flag.String("journal", "", "journal file used to resume the import (defaults to one per source directory in db_data/imports)")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] <source directory>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	source, err := filepath.Abs(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	util.LoadExPath()
+	if *dir != "" {
+		util.ExPath = *dir
+	}
+	ini.CreateFolders()
+	database.ConnectToDB()
+
+	im := &importer.Importer{
+		Images:        database.NewImageRepo(database.DB),
+		Docs:          database.NewDocRepo(database.DB),
+		SearchRepo:    database.NewSearchRepo(database.DB),
+		Organizations: database.NewOrganizationRepo(database.DB),
+		DryRun:        *dryRun,
+		Journal:       *journal,
+	}
+	if *org != 0 {
+		orgID := uint(*org)
+		if _, err := database.NewOrganizationRepo(database.DB).GetOrganizationByID(context.Background(), orgID); err != nil {
+			log.Fatalf("No organization with ID %d", orgID)
+		}
+		im.OrganizationID = &orgID
+	}
+	if im.Journal == "" {
+		journalDir := filepath.Join(util.ExPath, database.DbFolder, "imports")
+		if err := os.MkdirAll(journalDir, 0o755); err != nil {
+			log.Fatal(err)
+		}
+		im.Journal = importer.JournalPath(journalDir, source)
+	}
+
+	// Stopping the import with Ctrl-C lets the current file finish
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	summary, err := im.Run(ctx, source, func(summary importer.Summary, result importer.Result) {
+		if result.Outcome != importer.OutcomeImported {
+			fmt.Printf("%s\t%s\t%s\n", result.Outcome, result.Path, result.Reason)
+		}
+		if summary.Done%100 == 0 {
+			fmt.Fprintf(os.Stderr, "%d/%d files\n", summary.Done, summary.Total)
+		}
+	})
+	verb := "Imported"
+	if *dryRun {
+		verb = "Would import"
+	}
+	fmt.Printf("%s %d of %d files: %d duplicates, %d skipped, %d failed, %d handled by a previous run\n",
+		verb, summary.Imported, summary.Total, summary.Duplicates, summary.Skipped, summary.Failed, summary.Resumed)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
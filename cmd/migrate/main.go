@@ -0,0 +1,97 @@
+// Command migrate applies, rolls back and lists the versioned migrations of
+// the go-fast-cdn database.
+//
+// Usage:
+//
+//	migrate [-dir path] up [migration]
+//	migrate [-dir path] down [steps]
+//	migrate [-dir path] status
+//
+// up applies the pending migrations, or those up to and including the given
+// one. down rolls back the last applied migration, or the last steps ones.
+// The server applies pending migrations on startup unless started with
+// -skip-migrations; stop it before rolling back.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [-dir path] up [migration] | down [steps] | status\n", os.Args[0])
+	os.Exit(2)
+}
+
+func main() {
+	dir := flag.String("dir", "", "directory containing the db_data folder (defaults to the executable directory)")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() < 1 || flag.NArg() > 2 {
+		usage()
+	}
+
+	util.LoadExPath()
+	if *dir != "" {
+		util.ExPath = *dir
+	}
+	// Connect without migrating, so rollbacks are not undone right away
+	database.SkipMigrations = true
+	database.ConnectToDB()
+	migrator := database.NewMigrator(database.DB, database.Migrations)
+
+	switch flag.Arg(0) {
+	case "up":
+		applied, err := migrator.Up(flag.Arg(1))
+		for _, id := range applied {
+			fmt.Printf("Applied %s\n", id)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("No pending migrations")
+		}
+	case "down":
+		steps := 1
+		if flag.Arg(1) != "" {
+			var err error
+			if steps, err = strconv.Atoi(flag.Arg(1)); err != nil || steps < 1 {
+				usage()
+			}
+		}
+		reverted, err := migrator.Down(steps)
+		for _, id := range reverted {
+			fmt.Printf("Rolled back %s\n", id)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(reverted) == 0 {
+			fmt.Println("No applied migrations")
+		}
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, status := range statuses {
+			state := "pending"
+			if status.AppliedAt != nil {
+				state = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			if status.Unknown {
+				state += " (unknown to this version)"
+			}
+			fmt.Printf("%s\t%s\n", status.ID, state)
+		}
+	default:
+		usage()
+	}
+}
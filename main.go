@@ -1,26 +1,163 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"log"
 	"os"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/alert"
+	"github.com/kevinanielsen/go-fast-cdn/src/audit"
+	"github.com/kevinanielsen/go-fast-cdn/src/backup"
+	"github.com/kevinanielsen/go-fast-cdn/src/breaker"
+	"github.com/kevinanielsen/go-fast-cdn/src/cache"
+	"github.com/kevinanielsen/go-fast-cdn/src/convert"
 	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/diskspace"
+	"github.com/kevinanielsen/go-fast-cdn/src/events"
+	"github.com/kevinanielsen/go-fast-cdn/src/expiry"
+	"github.com/kevinanielsen/go-fast-cdn/src/fallback"
+	"github.com/kevinanielsen/go-fast-cdn/src/hooks"
+	"github.com/kevinanielsen/go-fast-cdn/src/imaging"
 	ini "github.com/kevinanielsen/go-fast-cdn/src/initializers"
+	"github.com/kevinanielsen/go-fast-cdn/src/integrity"
+	"github.com/kevinanielsen/go-fast-cdn/src/janitor"
+	"github.com/kevinanielsen/go-fast-cdn/src/metrics"
+	"github.com/kevinanielsen/go-fast-cdn/src/moderation"
+	"github.com/kevinanielsen/go-fast-cdn/src/placeholder"
+	"github.com/kevinanielsen/go-fast-cdn/src/policy"
+	"github.com/kevinanielsen/go-fast-cdn/src/queue"
+	"github.com/kevinanielsen/go-fast-cdn/src/replication"
 	"github.com/kevinanielsen/go-fast-cdn/src/router"
+	"github.com/kevinanielsen/go-fast-cdn/src/search"
+	"github.com/kevinanielsen/go-fast-cdn/src/settings"
+	"github.com/kevinanielsen/go-fast-cdn/src/similarity"
+	"github.com/kevinanielsen/go-fast-cdn/src/state"
+	"github.com/kevinanielsen/go-fast-cdn/src/usage"
 	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/kevinanielsen/go-fast-cdn/src/validations"
 )
 
-func init() {
-	util.LoadExPath()
-	gin.SetMode("release")
-	ini.LoadEnvVariables(true)
-	ini.CreateFolders()
-	database.ConnectToDB()
-	database.Migrate() // Run database migrations
+// startupSteps lists everything that runs before the server starts listening.
+// Steps without a dependency on each other run in parallel. configPath and
+// profile select the config file, found next to the executable by default.
+func startupSteps(configPath, profile string) []ini.Step {
+	return []ini.Step{
+		{Name: "environment", Run: func() error {
+			util.LoadExPath()
+			gin.SetMode("release")
+			if configPath == "" {
+				configPath = ini.FindConfigFile(util.ExPath)
+			}
+			if configPath != "" {
+				if err := ini.LoadConfigFile(configPath, profile); err != nil {
+					return err
+				}
+			} else if profile != "" {
+				return errors.New("a config profile was selected without a config file")
+			}
+			ini.LoadEnvVariables(true)
+			return nil
+		}},
+		{Name: "folders", After: []string{"environment"}, Run: func() error {
+			ini.CreateFolders()
+			return nil
+		}},
+		{Name: "database", After: []string{"environment"}, Run: func() error {
+			database.QueryRecorder = metrics.DefaultQueries
+			database.ConnectToDB()
+			return nil
+		}},
+		{Name: "migrations", After: []string{"database"}, Run: func() error {
+			database.Migrate()
+			return nil
+		}},
+		{Name: "audit log", After: []string{"migrations"}, Run: func() error {
+			audit.Init(database.NewAuditLogRepo(database.DB))
+			return audit.StartSIEMForwarder()
+		}},
+		{Name: "event forwarding", After: []string{"environment"}, Run: events.StartForwarder},
+		{Name: "settings", After: []string{"migrations"}, Run: func() error {
+			return settings.Default.Load(database.NewConfigRepo(database.DB))
+		}},
+		{Name: "MIME types", After: []string{"migrations"}, Run: func() error {
+			return validations.LoadMimeTypeRules(context.Background(), database.NewMimeTypeRuleRepo(database.DB))
+		}},
+		{Name: "backup scheduler", After: []string{"database"}, Run: func() error {
+			return backup.StartScheduler(backup.NewDefaultManager())
+		}},
+		{Name: "shared state", After: []string{"environment"}, Run: state.Start},
+		{Name: "download cache", After: []string{"environment"}, Run: cache.Start},
+		{Name: "circuit breakers", After: []string{"environment"}, Run: breaker.Start},
+		{Name: "storage fallbacks", After: []string{"environment"}, Run: fallback.Start},
+		{Name: "image backend", After: []string{"environment"}, Run: imaging.Start},
+		{Name: "policy", After: []string{"environment"}, Run: policy.Start},
+		// Commands run after the policy, which is cheaper to check
+		{Name: "upload hooks", After: []string{"environment", "policy"}, Run: hooks.Start},
+		{Name: "storage usage", After: []string{"folders", "migrations"}, Run: func() error {
+			return usage.Start(database.DB)
+		}},
+		{Name: "disk space monitor", After: []string{"folders", "settings"}, Run: diskspace.Start},
+		{Name: "janitor", After: []string{"folders", "shared state", "migrations"}, Run: func() error {
+			return janitor.Start(database.NewRenditionRepo(database.DB))
+		}},
+		{Name: "expiry sweeper", After: []string{"migrations"}, Run: func() error {
+			expiry.Start(expiry.NewSweeper(database.NewImageRepo(database.DB), database.NewDocRepo(database.DB), database.NewLifecycleRuleRepo(database.DB)))
+			return nil
+		}},
+		{Name: "job queue", After: []string{"migrations"}, Run: func() error {
+			search.RegisterJobs(database.NewSearchRepo(database.DB))
+			alert.RegisterJobs()
+			moderation.AddHook(moderation.AlertHook)
+			placeholder.RegisterJobs(database.NewImageRepo(database.DB))
+			similarity.RegisterJobs(database.NewImageRepo(database.DB))
+			if err := convert.Start(database.NewDocRepo(database.DB), database.NewRenditionRepo(database.DB)); err != nil {
+				return err
+			}
+			return queue.Start(database.NewJobRepo(database.DB))
+		}},
+		{Name: "download statistics", After: []string{"migrations"}, Run: func() error {
+			return metrics.StartDownloads(database.NewDownloadStatRepo(database.DB))
+		}},
+		{Name: "integrity checker", After: []string{"folders", "migrations"}, Run: func() error {
+			return integrity.Start(database.DB)
+		}},
+		{Name: "replication", After: []string{"folders", "migrations"}, Run: func() error {
+			return replication.Start(
+				database.NewImageRepo(database.DB),
+				database.NewDocRepo(database.DB),
+				database.NewReplicationRepo(database.DB),
+				database.NewSearchRepo(database.DB),
+				database.NewConfigRepo(database.DB),
+			)
+		}},
+		{Name: "search backfill", After: []string{"migrations"}, Run: func() error {
+			go search.Backfill(context.Background(), database.NewSearchRepo(database.DB))
+			return nil
+		}},
+		{Name: "placeholder backfill", After: []string{"folders", "migrations"}, Run: func() error {
+			go placeholder.Backfill(context.Background(), database.NewImageRepo(database.DB))
+			return nil
+		}},
+		{Name: "perceptual hash backfill", After: []string{"folders", "migrations"}, Run: func() error {
+			go similarity.Backfill(context.Background(), database.NewImageRepo(database.DB))
+			return nil
+		}},
+	}
 }
 
 func main() {
+	flag.BoolVar(&database.SkipMigrations, "skip-migrations", false, "start without migrating the database, e.g. when another instance already did")
+	configPath := flag.String("config", "", "YAML or JSON config file setting environment variables (defaults to config.yaml, config.yml or config.json next to the executable)")
+	profile := flag.String("profile", os.Getenv("CONFIG_PROFILE"), "profile of the config file to apply, e.g. dev, staging or prod")
+	flag.Parse()
+
+	if err := ini.Bootstrap(startupSteps(*configPath, *profile)); err != nil {
+		log.Fatalf("Failed to start: %s", err.Error())
+	}
+
 	log.Printf("Starting server on port %v", os.Getenv("PORT"))
 	router.Router()
 }
@@ -0,0 +1,140 @@
+// Package acl restricts the media folders to groups of users. A folder
+// without permissions is open to every user, as governed by their role;
+// once a group was granted access to it, only admins and the members of its
+// groups can use it, at the level they were granted. Service accounts are
+// governed by their permissions and organization instead, and downloads
+// stay public.
+package acl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/auth"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+)
+
+// Checker checks the access of requests to folders.
+type Checker struct {
+	groups models.GroupRepository
+}
+
+func New(groups models.GroupRepository) *Checker {
+	return &Checker{groups: groups}
+}
+
+// Default is the checker used by Check and Require. Without one every
+// folder is open.
+var Default *Checker
+
+// Allowed returns nil if the request may access folder, images or docs, at
+// level, or a *problem.Error telling why not.
+func (a *Checker) Allowed(c *gin.Context, folder, level string) error {
+	if a == nil {
+		return nil
+	}
+	principal, ok := auth.PrincipalFrom(c)
+	if ok && (principal.Role == "admin" || principal.User == nil) {
+		return nil
+	}
+	permissions, err := a.groups.GetFolderPermissions(c.Request.Context(), folder)
+	if err != nil {
+		return err
+	}
+	if len(permissions) == 0 {
+		return nil
+	}
+	if !ok {
+		return problem.New(http.StatusUnauthorized, "", fmt.Sprintf("The folder %s is restricted, sign in to access it", folder))
+	}
+	return a.granted(c.Request.Context(), principal.User.ID, folder, level)
+}
+
+// Readable reports whether the request may read folder. Unlike Allowed it
+// only fails if the permissions could not be checked, so that lists can
+// leave out the media of the folders the request may not read.
+func (a *Checker) Readable(c *gin.Context, folder string) (bool, error) {
+	err := a.Allowed(c, folder, models.AccessRead)
+	var denied *problem.Error
+	if errors.As(err, &denied) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Manageable returns nil if the request may manage the permissions of
+// folder: admins can, as can users whose groups were granted admin access.
+// Unlike Allowed, it does not let users through to open folders, so they
+// cannot restrict them.
+func (a *Checker) Manageable(c *gin.Context, folder string) error {
+	principal, ok := auth.PrincipalFrom(c)
+	if ok && principal.Role == "admin" {
+		return nil
+	}
+	if a == nil || !ok || principal.User == nil {
+		return problem.New(http.StatusForbidden, "", "Insufficient permissions")
+	}
+	return a.granted(c.Request.Context(), principal.User.ID, folder, models.AccessAdmin)
+}
+
+func (a *Checker) granted(ctx context.Context, userID uint, folder, level string) error {
+	access, err := a.groups.GetUserFolderAccess(ctx, userID, folder)
+	if err != nil {
+		return err
+	}
+	for _, granted := range access {
+		if models.AccessIncludes(granted, level) {
+			return nil
+		}
+	}
+	return problem.New(http.StatusForbidden, "", fmt.Sprintf("No %s access to the folder %s", level, folder))
+}
+
+// Check aborts the request with a problem unless Default allows it to
+// access folder at level, and reports whether it may go on.
+func Check(c *gin.Context, folder, level string) bool {
+	return abort(c, Default.Allowed(c, folder, level))
+}
+
+// Readable reports whether Default lets the request read folder, see
+// (*Checker).Readable.
+func Readable(c *gin.Context, folder string) (bool, error) {
+	return Default.Readable(c, folder)
+}
+
+// Require returns a middleware letting requests through that Default
+// allows to access folder at level. Routes readable without signing in must
+// authenticate optionally before it.
+func Require(folder, level string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !Check(c, folder, level) {
+			return
+		}
+		c.Next()
+	}
+}
+
+func abort(c *gin.Context, err error) bool {
+	if err == nil {
+		return true
+	}
+	var denied *problem.Error
+	if errors.As(err, &denied) {
+		problem.Abort(c, denied)
+		return false
+	}
+	log.Printf("Failed to check the access to a folder: %s\n", err.Error())
+	problem.Write(c, http.StatusInternalServerError, "Failed to check folder permissions")
+	return false
+}
+
+// CheckManageable aborts the request with a problem unless Default lets it
+// manage the permissions of folder, and reports whether it may go on.
+func CheckManageable(c *gin.Context, folder string) bool {
+	return abort(c, Default.Manageable(c, folder))
+}
@@ -0,0 +1,118 @@
+package acl
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/auth"
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecker(t *testing.T) {
+	// Arrange
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	db := database.DB
+	groups := database.NewGroupRepo(db)
+	checker := New(groups)
+
+	member := models.User{Email: "member@example.com", PasswordHash: "x", Role: "user"}
+	outsider := models.User{Email: "outsider@example.com", PasswordHash: "x", Role: "user"}
+	require.NoError(t, db.Create(&member).Error)
+	require.NoError(t, db.Create(&outsider).Error)
+	design := models.Group{Name: "Design"}
+	require.NoError(t, groups.CreateGroup(context.Background(), &design))
+	require.NoError(t, groups.AddGroupMember(context.Background(), design.ID, member.ID))
+	require.NoError(t, groups.AddGroupMember(context.Background(), design.ID, member.ID))
+
+	as := func(p *auth.Principal) *gin.Context {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+		if p != nil {
+			auth.SetPrincipal(c, p)
+		}
+		return c
+	}
+	status := func(err error) int {
+		if err == nil {
+			return http.StatusOK
+		}
+		var denied *problem.Error
+		require.ErrorAs(t, err, &denied)
+		return denied.Status
+	}
+	asMember := &auth.Principal{Role: "user", User: &member}
+	asOutsider := &auth.Principal{Role: "user", User: &outsider}
+	asAdmin := &auth.Principal{Role: "admin", User: &models.User{Email: "admin@example.com"}}
+	asService := &auth.Principal{Role: auth.RoleService, ServiceAccount: &models.ServiceAccount{Name: "ci"}}
+
+	// Act & Assert
+	// Folders without permissions are open
+	require.NoError(t, checker.Allowed(as(nil), "images", models.AccessRead))
+	require.NoError(t, checker.Allowed(as(asOutsider), "images", models.AccessAdmin))
+	require.Equal(t, http.StatusForbidden, status(checker.Manageable(as(asOutsider), "images")))
+	var open *Checker
+	require.NoError(t, open.Allowed(as(asOutsider), "images", models.AccessAdmin))
+
+	require.NoError(t, groups.SetFolderPermission(context.Background(), &models.FolderPermission{Folder: "images", GroupID: design.ID, Access: models.AccessRead}))
+	require.Equal(t, http.StatusUnauthorized, status(checker.Allowed(as(nil), "images", models.AccessRead)))
+	require.Equal(t, http.StatusForbidden, status(checker.Allowed(as(asOutsider), "images", models.AccessRead)))
+	require.NoError(t, checker.Allowed(as(asMember), "images", models.AccessRead))
+	require.Equal(t, http.StatusForbidden, status(checker.Allowed(as(asMember), "images", models.AccessWrite)))
+	require.NoError(t, checker.Allowed(as(asAdmin), "images", models.AccessAdmin))
+	require.NoError(t, checker.Allowed(as(asService), "images", models.AccessAdmin))
+	require.NoError(t, checker.Allowed(as(asOutsider), "docs", models.AccessWrite))
+	readable, err := checker.Readable(as(asOutsider), "images")
+	require.NoError(t, err)
+	require.False(t, readable)
+	readable, err = checker.Readable(as(asMember), "images")
+	require.NoError(t, err)
+	require.True(t, readable)
+
+	// Grants replace the access of the group
+	require.NoError(t, groups.SetFolderPermission(context.Background(), &models.FolderPermission{Folder: "images", GroupID: design.ID, Access: models.AccessAdmin}))
+	permissions, err := groups.GetFolderPermissions(context.Background(), "images")
+	require.NoError(t, err)
+	require.Len(t, permissions, 1)
+	require.NoError(t, checker.Allowed(as(asMember), "images", models.AccessWrite))
+	require.NoError(t, checker.Manageable(as(asMember), "images"))
+	require.Equal(t, http.StatusForbidden, status(checker.Manageable(as(asMember), "docs")))
+
+	// Leaving the group revokes the access
+	require.NoError(t, groups.RemoveGroupMember(context.Background(), design.ID, member.ID))
+	require.Equal(t, http.StatusForbidden, status(checker.Allowed(as(asMember), "images", models.AccessRead)))
+
+	// Deleting the group opens the folder again
+	require.NoError(t, groups.DeleteGroup(context.Background(), design.ID))
+	require.NoError(t, checker.Allowed(as(asOutsider), "images", models.AccessWrite))
+}
+
+func TestRequire(t *testing.T) {
+	// Arrange
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	groups := database.NewGroupRepo(database.DB)
+	Default = New(groups)
+	t.Cleanup(func() { Default = nil })
+	team := models.Group{Name: "Legal"}
+	require.NoError(t, groups.CreateGroup(context.Background(), &team))
+	require.NoError(t, groups.SetFolderPermission(context.Background(), &models.FolderPermission{Folder: "docs", GroupID: team.ID, Access: models.AccessWrite}))
+
+	r := gin.New()
+	r.GET("/docs", Require("docs", models.AccessRead), func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.GET("/images", Require("images", models.AccessRead), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	// Act & Assert
+	for path, want := range map[string]int{"/docs": http.StatusUnauthorized, "/images": http.StatusOK} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		require.Equal(t, want, w.Code, path)
+	}
+}
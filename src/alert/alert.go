@@ -0,0 +1,101 @@
+// Package alert sends operational and security alerts to a webhook.
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/breaker"
+	"github.com/kevinanielsen/go-fast-cdn/src/queue"
+)
+
+// Alert is posted as JSON to ALERT_WEBHOOK_URL. Text duplicates the summary
+// so the payload can be sent straight to Slack-compatible webhooks.
+type Alert struct {
+	Type    string         `json:"type"`
+	Text    string         `json:"text"`
+	Time    time.Time      `json:"time"`
+	Details map[string]any `json:"details,omitempty"`
+}
+
+var client = &http.Client{Timeout: 10 * time.Second}
+
+// WebhookJob is the kind of the background jobs posting alerts.
+const WebhookJob = "alert.webhook"
+
+// RegisterJobs registers the handler of WebhookJob with the queue.
+func RegisterJobs() {
+	queue.Register(WebhookJob, func(ctx context.Context, payload []byte) error {
+		url := os.Getenv("ALERT_WEBHOOK_URL")
+		if url == "" {
+			return nil
+		}
+		var a Alert
+		if err := json.Unmarshal(payload, &a); err != nil {
+			return err
+		}
+		return post(ctx, url, a)
+	})
+}
+
+// Notify sends the alert in the background. Alerts are always logged; they
+// are posted to ALERT_WEBHOOK_URL when it is set, through the job queue when
+// it runs so failed deliveries are retried.
+func Notify(a Alert) {
+	if a.Time.IsZero() {
+		a.Time = time.Now()
+	}
+	log.Printf("[ALERT] %s: %s", a.Type, a.Text)
+
+	url := os.Getenv("ALERT_WEBHOOK_URL")
+	if url == "" {
+		return
+	}
+	if queue.Running() {
+		if err := queue.Enqueue(context.Background(), WebhookJob, a); err != nil {
+			log.Printf("[ERROR] Failed to queue %s alert: %v", a.Type, err)
+		}
+		return
+	}
+	go func() {
+		if err := post(context.Background(), url, a); err != nil {
+			log.Printf("[ERROR] Failed to send %s alert: %v", a.Type, err)
+		}
+	}()
+}
+
+func post(ctx context.Context, url string, a Alert) error {
+	body, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+
+	return breaker.Get("alert-webhook").Do(ctx, func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return breaker.Permanent(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode >= 300 {
+			err := fmt.Errorf("webhook returned %s", resp.Status)
+			if resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+				return breaker.Permanent(err)
+			}
+			return err
+		}
+		return nil
+	})
+}
@@ -0,0 +1,139 @@
+// Package audit records security and policy relevant actions to the audit
+// log and optionally streams them to an external SIEM.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/events"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+)
+
+// Actions recorded in the audit log.
+const (
+	ActionTakedown       = "media.takedown"
+	ActionTakedownLifted = "media.takedown_lifted"
+	ActionTripwire       = "media.tripwire"
+	ActionShareCreated   = "media.share_created"
+	ActionShareRevoked   = "media.share_revoked"
+	ActionGalleryUpdated = "media.gallery_updated"
+	ActionMediaApproved  = "media.approved"
+	ActionMediaRejected  = "media.rejected"
+	ActionMediaMoved     = "media.moved"
+	ActionMediaCopied    = "media.copied"
+
+	ActionRegister        = "auth.register"
+	ActionLogin           = "auth.login"
+	ActionLoginFailed     = "auth.login_failed"
+	ActionLogout          = "auth.logout"
+	ActionPasswordChanged = "auth.password_changed"
+	ActionEmailChanged    = "auth.email_changed"
+	Action2FAEnabled      = "auth.2fa_enabled"
+	Action2FADisabled     = "auth.2fa_disabled"
+
+	ActionSessionRevoked = "auth.session_revoked"
+
+	ActionBackupCodeUsed         = "auth.backup_code_used"
+	ActionBackupCodesRegenerated = "auth.backup_codes_regenerated"
+
+	ActionServiceAccountCreated = "service_account.created"
+	ActionServiceAccountUpdated = "service_account.updated"
+	ActionServiceAccountDeleted = "service_account.deleted"
+	ActionAPIKeyCreated         = "service_account.key_created"
+	ActionAPIKeyRevoked         = "service_account.key_revoked"
+
+	ActionGroupCreated            = "group.created"
+	ActionGroupDeleted            = "group.deleted"
+	ActionGroupMemberAdded        = "group.member_added"
+	ActionGroupMemberRemoved      = "group.member_removed"
+	ActionFolderPermissionGranted = "folder.permission_granted"
+	ActionFolderPermissionRevoked = "folder.permission_revoked"
+
+	ActionConfigUpdated    = "config.updated"
+	ActionCORSUpdated      = "config.cors_updated"
+	ActionHotlinkUpdated   = "config.hotlink_updated"
+	ActionWatermarkUpdated = "config.watermark_updated"
+	ActionBrandingUpdated  = "config.branding_updated"
+	ActionMimeTypesUpdated = "config.mime_types_updated"
+	ActionLifecycleUpdated = "config.lifecycle_updated"
+
+	ActionBackupCreated = "backup.created"
+	ActionBackupDeleted = "backup.deleted"
+	ActionMediaRestored = "backup.media_restored"
+
+	ActionExportCreated     = "export.created"
+	ActionExportLinkCreated = "export.link_created"
+	ActionExportDownloaded  = "export.downloaded"
+	ActionExportDeleted     = "export.deleted"
+
+	ActionImportStarted = "import.started"
+
+	ActionRepairsRun = "repair.run"
+
+	ActionReplicationSync = "replication.sync"
+
+	ActionJobRequeued = "job.requeued"
+
+	ActionIntegrityCheckRun = "integrity.run"
+)
+
+var repo models.AuditLogRepository
+
+// Init sets the repository audit entries are written to. Until it is
+// called, Record only logs to the standard logger.
+func Init(r models.AuditLogRepository) {
+	repo = r
+}
+
+// Record writes an audit entry for the request. The acting user and client
+// IP are taken from the context; details is stored as JSON.
+func Record(c *gin.Context, action, target string, details any) {
+	if account, ok := c.Get("service_account"); ok {
+		RecordUser(c, action, 0, "service-account:"+account.(*models.ServiceAccount).Name, target, details)
+		return
+	}
+	RecordUser(c, action, c.GetUint("user_id"), c.GetString("user_email"), target, details)
+}
+
+// RecordUser writes an audit entry for a request made by the given user. It
+// is used by the authentication endpoints, which run before the user is
+// stored in the context.
+func RecordUser(c *gin.Context, action string, userID uint, email, target string, details any) {
+	entry := models.AuditLog{
+		CreatedAt:  time.Now(),
+		Action:     action,
+		ActorID:    userID,
+		ActorEmail: email,
+		IP:         c.ClientIP(),
+		Target:     target,
+	}
+	if details != nil {
+		if encoded, err := json.Marshal(details); err == nil {
+			entry.Details = string(encoded)
+		}
+	}
+
+	// The entry is written even if the client went away
+	ctx := context.WithoutCancel(c.Request.Context())
+	if repo == nil {
+		log.Printf("[AUDIT] %s %s by %d", action, target, entry.ActorID)
+	} else if err := repo.AddAuditLog(ctx, &entry); err != nil {
+		log.Printf("[ERROR] Failed to write audit log entry %s: %v", action, err)
+	}
+
+	if forwarder != nil {
+		forwarder.enqueue(entry)
+	}
+	events.Publish(events.Event{
+		Type:    action,
+		Time:    entry.CreatedAt,
+		Actor:   email,
+		IP:      entry.IP,
+		Target:  target,
+		Details: details,
+	})
+}
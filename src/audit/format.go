@@ -0,0 +1,82 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+)
+
+// Formats audit entries can be exported in.
+const (
+	FormatJSON = "json"
+	FormatCEF  = "cef"
+)
+
+// Encode renders an audit entry as a single line in the given format.
+func Encode(entry models.AuditLog, format string) ([]byte, error) {
+	switch format {
+	case FormatJSON, "":
+		return json.Marshal(entry)
+	case FormatCEF:
+		return []byte(cef(entry)), nil
+	default:
+		return nil, fmt.Errorf("unsupported audit format %q", format)
+	}
+}
+
+// cef renders an entry in ArcSight Common Event Format.
+func cef(entry models.AuditLog) string {
+	extension := []string{
+		"rt=" + fmt.Sprint(entry.CreatedAt.UnixMilli()),
+		"act=" + cefValue(entry.Action),
+		"suid=" + fmt.Sprint(entry.ActorID),
+	}
+	if entry.ActorEmail != "" {
+		extension = append(extension, "suser="+cefValue(entry.ActorEmail))
+	}
+	if entry.IP != "" {
+		extension = append(extension, "src="+cefValue(entry.IP))
+	}
+	if entry.Target != "" {
+		extension = append(extension, "cs1Label=target", "cs1="+cefValue(entry.Target))
+	}
+	if entry.Details != "" {
+		extension = append(extension, "msg="+cefValue(entry.Details))
+	}
+
+	return fmt.Sprintf("CEF:0|go-fast-cdn|go-fast-cdn|1.0|%s|%s|%d|%s",
+		cefHeader(entry.Action),
+		cefHeader(entry.Action),
+		severity(entry.Action),
+		strings.Join(extension, " "),
+	)
+}
+
+// severity maps an action to a CEF severity between 0 and 10.
+func severity(action string) int {
+	switch {
+	case action == ActionTripwire:
+		return 8
+	case strings.HasSuffix(action, "_failed"):
+		return 5
+	case strings.HasPrefix(action, "media.takedown"):
+		return 6
+	default:
+		return 3
+	}
+}
+
+var (
+	cefHeaderEscaper = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\n", " ", "\r", " ")
+	cefValueEscaper  = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`)
+)
+
+func cefHeader(s string) string {
+	return cefHeaderEscaper.Replace(s)
+}
+
+func cefValue(s string) string {
+	return cefValueEscaper.Replace(s)
+}
@@ -0,0 +1,273 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+)
+
+const (
+	defaultBufferSize = 1000
+	maxBatchSize      = 100
+	flushInterval     = 2 * time.Second
+	maxSendAttempts   = 5
+)
+
+// transport delivers a batch of encoded audit entries to a SIEM.
+type transport interface {
+	send(ctx context.Context, lines [][]byte) error
+}
+
+// Forwarder streams audit entries to an external SIEM. Entries are buffered
+// in memory and sent in batches; failed batches are retried with exponential
+// backoff. When the buffer is full new entries are dropped rather than
+// blocking requests.
+type Forwarder struct {
+	transport transport
+	format    string
+	queue     chan models.AuditLog
+	done      chan struct{}
+	backoff   time.Duration
+}
+
+var forwarder *Forwarder
+
+// StartSIEMForwarder starts streaming audit entries to the endpoint in
+// AUDIT_SIEM_URL. It does nothing when the variable is unset.
+//
+// Supported endpoints are http(s):// URLs, which receive batches as POST
+// requests, and syslog+udp:// or syslog+tcp:// addresses. AUDIT_SIEM_FORMAT
+// selects json (default) or cef, AUDIT_SIEM_AUTH_HEADER sets the
+// Authorization header for HTTP endpoints and AUDIT_SIEM_BUFFER_SIZE the
+// number of entries held while the endpoint is unreachable.
+func StartSIEMForwarder() error {
+	endpoint := os.Getenv("AUDIT_SIEM_URL")
+	if endpoint == "" {
+		return nil
+	}
+
+	format := os.Getenv("AUDIT_SIEM_FORMAT")
+	if format == "" {
+		format = FormatJSON
+	}
+	if format != FormatJSON && format != FormatCEF {
+		return fmt.Errorf("invalid AUDIT_SIEM_FORMAT %q", format)
+	}
+
+	bufferSize := defaultBufferSize
+	if value := os.Getenv("AUDIT_SIEM_BUFFER_SIZE"); value != "" {
+		size, err := strconv.Atoi(value)
+		if err != nil || size < 1 {
+			return fmt.Errorf("invalid AUDIT_SIEM_BUFFER_SIZE %q", value)
+		}
+		bufferSize = size
+	}
+
+	t, err := parseTransport(endpoint, format, os.Getenv("AUDIT_SIEM_AUTH_HEADER"))
+	if err != nil {
+		return err
+	}
+
+	forwarder = newForwarder(t, format, bufferSize, time.Second)
+	log.Printf("Streaming audit log to %s as %s", redact(endpoint), format)
+	return nil
+}
+
+func newForwarder(t transport, format string, bufferSize int, backoff time.Duration) *Forwarder {
+	f := &Forwarder{
+		transport: t,
+		format:    format,
+		queue:     make(chan models.AuditLog, bufferSize),
+		done:      make(chan struct{}),
+		backoff:   backoff,
+	}
+	go f.run()
+	return f
+}
+
+// enqueue adds an entry to the send buffer without blocking.
+func (f *Forwarder) enqueue(entry models.AuditLog) {
+	select {
+	case f.queue <- entry:
+	default:
+		log.Printf("[ERROR] SIEM buffer full, dropping audit entry %s", entry.Action)
+	}
+}
+
+// Close flushes buffered entries and stops the forwarder.
+func (f *Forwarder) Close() {
+	close(f.queue)
+	<-f.done
+}
+
+func (f *Forwarder) run() {
+	defer close(f.done)
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	var batch [][]byte
+	for {
+		select {
+		case entry, ok := <-f.queue:
+			if !ok {
+				f.flush(batch)
+				return
+			}
+			line, err := Encode(entry, f.format)
+			if err != nil {
+				log.Printf("[ERROR] Failed to encode audit entry %s: %v", entry.Action, err)
+				continue
+			}
+			batch = append(batch, line)
+			if len(batch) >= maxBatchSize {
+				f.flush(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			f.flush(batch)
+			batch = nil
+		}
+	}
+}
+
+// flush sends a batch, retrying with exponential backoff before giving up.
+func (f *Forwarder) flush(batch [][]byte) {
+	if len(batch) == 0 {
+		return
+	}
+
+	delay := f.backoff
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err := f.transport.send(ctx, batch)
+		cancel()
+		if err == nil {
+			return
+		}
+		if attempt == maxSendAttempts {
+			log.Printf("[ERROR] Dropping %d audit entries after %d failed SIEM deliveries: %v", len(batch), attempt, err)
+			return
+		}
+		log.Printf("[ERROR] SIEM delivery failed, retrying in %s: %v", delay, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func parseTransport(endpoint, format, authHeader string) (transport, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid AUDIT_SIEM_URL: %w", err)
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		contentType := "application/x-ndjson"
+		if format == FormatCEF {
+			contentType = "text/plain"
+		}
+		return &httpTransport{
+			url:         endpoint,
+			contentType: contentType,
+			authHeader:  authHeader,
+			client:      &http.Client{Timeout: 10 * time.Second},
+		}, nil
+	case "syslog+udp", "syslog+tcp":
+		if u.Host == "" {
+			return nil, fmt.Errorf("invalid AUDIT_SIEM_URL: missing host")
+		}
+		hostname, err := os.Hostname()
+		if err != nil || hostname == "" {
+			hostname = "-"
+		}
+		return &syslogTransport{
+			network:  u.Scheme[len("syslog+"):],
+			address:  u.Host,
+			hostname: hostname,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported AUDIT_SIEM_URL scheme %q", u.Scheme)
+	}
+}
+
+// redact hides credentials embedded in an endpoint URL.
+func redact(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return endpoint
+	}
+	return u.Redacted()
+}
+
+// httpTransport posts batches as newline-delimited entries.
+type httpTransport struct {
+	url         string
+	contentType string
+	authHeader  string
+	client      *http.Client
+}
+
+func (t *httpTransport) send(ctx context.Context, lines [][]byte) error {
+	body := append(bytes.Join(lines, []byte("\n")), '\n')
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", t.contentType)
+	if t.authHeader != "" {
+		req.Header.Set("Authorization", t.authHeader)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("SIEM endpoint returned %s", resp.Status)
+	}
+	return nil
+}
+
+// syslogTransport writes RFC 5424 messages with newline framing.
+type syslogTransport struct {
+	network  string
+	address  string
+	hostname string
+}
+
+// facility local0, severity notice
+const syslogPriority = 16*8 + 5
+
+func (t *syslogTransport) send(ctx context.Context, lines [][]byte) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, t.network, t.address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	for _, line := range lines {
+		msg := fmt.Sprintf("<%d>1 %s %s go-fast-cdn - audit - %s\n",
+			syslogPriority, time.Now().UTC().Format(time.RFC3339), t.hostname, line)
+		if _, err := conn.Write([]byte(msg)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
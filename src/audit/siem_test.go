@@ -0,0 +1,117 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncode_CEF(t *testing.T) {
+	entry := models.AuditLog{
+		CreatedAt:  time.UnixMilli(1700000000000),
+		Action:     ActionLoginFailed,
+		ActorID:    3,
+		ActorEmail: "eve@example.com",
+		IP:         "10.0.0.1",
+		Target:     "eve@example.com",
+		Details:    `{"reason":"a=b"}`,
+	}
+
+	line, err := Encode(entry, FormatCEF)
+
+	require.NoError(t, err)
+	require.Equal(t,
+		`CEF:0|go-fast-cdn|go-fast-cdn|1.0|auth.login_failed|auth.login_failed|5|rt=1700000000000 act=auth.login_failed suid=3 suser=eve@example.com src=10.0.0.1 cs1Label=target cs1=eve@example.com msg={"reason":"a\=b"}`,
+		string(line))
+}
+
+func TestEncode_UnknownFormat(t *testing.T) {
+	_, err := Encode(models.AuditLog{}, "xml")
+
+	require.Error(t, err)
+}
+
+func TestForwarder_RetriesHTTP(t *testing.T) {
+	// Arrange
+	var mu sync.Mutex
+	var attempts int
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		require.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		body, _ := io.ReadAll(r.Body)
+		received = append(received, strings.Split(strings.TrimSpace(string(body)), "\n")...)
+	}))
+	defer server.Close()
+
+	transport, err := parseTransport(server.URL, FormatJSON, "Bearer token")
+	require.NoError(t, err)
+	f := newForwarder(transport, FormatJSON, 10, time.Millisecond)
+
+	// Act
+	f.enqueue(models.AuditLog{ID: 1, Action: ActionLogin})
+	f.enqueue(models.AuditLog{ID: 2, Action: ActionLogout})
+	f.Close()
+
+	// Assert
+	require.Equal(t, 2, attempts)
+	require.Len(t, received, 2)
+	var entry models.AuditLog
+	require.NoError(t, json.Unmarshal([]byte(received[1]), &entry))
+	require.Equal(t, ActionLogout, entry.Action)
+}
+
+func TestForwarder_Syslog(t *testing.T) {
+	// Arrange
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	lines := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		lines <- line
+	}()
+
+	transport, err := parseTransport("syslog+tcp://"+listener.Addr().String(), FormatCEF, "")
+	require.NoError(t, err)
+	f := newForwarder(transport, FormatCEF, 10, time.Millisecond)
+
+	// Act
+	f.enqueue(models.AuditLog{Action: ActionTakedown, Target: "image/leak.png"})
+	f.Close()
+
+	// Assert
+	line := <-lines
+	require.True(t, strings.HasPrefix(line, "<133>1 "))
+	require.Contains(t, line, " go-fast-cdn - audit - CEF:0|go-fast-cdn|")
+	require.Contains(t, line, "cs1=image/leak.png")
+}
+
+func TestParseTransport_Invalid(t *testing.T) {
+	_, err := parseTransport("ftp://example.com", FormatJSON, "")
+	require.Error(t, err)
+
+	_, err = parseTransport("syslog+udp://", FormatJSON, "")
+	require.Error(t, err)
+}
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// RefreshCookieName is the httpOnly cookie holding the refresh token in
+	// cookie mode.
+	RefreshCookieName = "gfc_refresh"
+	// CSRFCookieName is the cookie the UI reads the CSRF token from. It is
+	// readable by scripts on purpose.
+	CSRFCookieName = "gfc_csrf"
+	// CSRFHeaderName is the header state-changing requests must repeat the
+	// CSRF token in.
+	CSRFHeaderName = "X-CSRF-Token"
+
+	refreshCookiePath = "/api/auth"
+)
+
+// CookieModeEnabled reports whether AUTH_COOKIE_MODE is set, in which case
+// the refresh token is handed out as an httpOnly cookie instead of in the
+// response body.
+func CookieModeEnabled() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv("AUTH_COOKIE_MODE"))
+	return enabled
+}
+
+// CSRFToken derives the CSRF token bound to a refresh token, so a token can
+// only be used together with the session it was issued for.
+func (j *JWTService) CSRFToken(refreshToken string) string {
+	mac := hmac.New(sha256.New, j.secretKey)
+	mac.Write([]byte("csrf:" + refreshToken))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// ValidateCSRFToken reports whether token is the CSRF token for
+// refreshToken.
+func (j *JWTService) ValidateCSRFToken(refreshToken, token string) bool {
+	return token != "" && hmac.Equal([]byte(j.CSRFToken(refreshToken)), []byte(token))
+}
+
+// SetAuthCookies stores the refresh token in an httpOnly cookie scoped to the
+// auth endpoints and the matching CSRF token in a cookie the UI can read.
+func SetAuthCookies(c *gin.Context, refreshToken, csrfToken string, expiresAt time.Time) {
+	setCookie(c, RefreshCookieName, refreshToken, refreshCookiePath, expiresAt, true)
+	setCookie(c, CSRFCookieName, csrfToken, "/", expiresAt, false)
+}
+
+// ClearAuthCookies removes the cookies set by SetAuthCookies.
+func ClearAuthCookies(c *gin.Context) {
+	setCookie(c, RefreshCookieName, "", refreshCookiePath, time.Unix(0, 0), true)
+	setCookie(c, CSRFCookieName, "", "/", time.Unix(0, 0), false)
+}
+
+func setCookie(c *gin.Context, name, value, path string, expiresAt time.Time, httpOnly bool) {
+	maxAge := int(time.Until(expiresAt).Seconds())
+	if value == "" || maxAge <= 0 {
+		maxAge = -1
+	}
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Expires:  expiresAt,
+		MaxAge:   maxAge,
+		Secure:   IsHTTPS(c),
+		HttpOnly: httpOnly,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
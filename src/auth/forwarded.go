@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"net"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// trustedProxies are the networks of the reverse proxies whose
+// X-Forwarded-Proto is believed, set by SetTrustedProxies.
+var trustedProxies atomic.Pointer[[]*net.IPNet]
+
+// SetTrustedProxies believes the X-Forwarded-Proto header of requests from
+// proxies, IP addresses or CIDR ranges, as gin does their X-Forwarded-For.
+// No proxy is trusted by default.
+func SetTrustedProxies(proxies []string) error {
+	networks := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return &net.ParseError{Type: "IP address", Text: proxy}
+			}
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			network = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+		}
+		networks = append(networks, network)
+	}
+	trustedProxies.Store(&networks)
+	return nil
+}
+
+// IsHTTPS reports whether the request was sent over HTTPS, either directly
+// or to a trusted proxy that says so in X-Forwarded-Proto. Anyone else could
+// send the header over plain HTTP.
+func IsHTTPS(c *gin.Context) bool {
+	if c.Request.TLS != nil {
+		return true
+	}
+	if c.GetHeader("X-Forwarded-Proto") != "https" {
+		return false
+	}
+	networks := trustedProxies.Load()
+	ip := net.ParseIP(c.RemoteIP())
+	if networks == nil || ip == nil {
+		return false
+	}
+	for _, network := range *networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
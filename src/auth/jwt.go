@@ -9,7 +9,9 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/state"
 )
 
 type JWTService struct {
@@ -20,6 +22,9 @@ type Claims struct {
 	UserID uint   `json:"user_id"`
 	Email  string `json:"email"`
 	Role   string `json:"role"`
+	// SessionID is the session the token was issued for, so revoking the
+	// session rejects its tokens too.
+	SessionID uint `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -39,55 +44,34 @@ func NewJWTService() *JWTService {
 	}
 }
 
-// GenerateTokenPair creates both access and refresh tokens
-func (j *JWTService) GenerateTokenPair(user *models.User) (*TokenPair, error) {
-	// Generate access token (short-lived)
-	accessToken, err := j.GenerateAccessToken(user)
+// GenerateTokenPair creates an access token for session and pairs it with
+// the refresh token of the session
+func (j *JWTService) GenerateTokenPair(user *models.User, session *models.UserSession) (*TokenPair, error) {
+	accessToken, err := j.GenerateAccessToken(user, session.ID)
 	if err != nil {
 		return nil, err
 	}
 
-	// Generate refresh token (long-lived, random string)
-	refreshToken, err := j.GenerateRefreshToken()
-	if err != nil {
-		return nil, err
-	}
-
-	// Get expiration time from environment or default to 15 minutes
-	expiresInStr := os.Getenv("JWT_EXPIRES_IN")
-	expiresIn := int64(15 * 60) // 15 minutes default
-	if expiresInStr != "" {
-		if parsed, err := strconv.ParseInt(expiresInStr, 10, 64); err == nil {
-			expiresIn = parsed
-		}
-	}
-
 	return &TokenPair{
 		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
-		ExpiresIn:    expiresIn,
+		RefreshToken: session.RefreshToken,
+		ExpiresIn:    int64(accessTokenExpiration().Seconds()),
 	}, nil
 }
 
-// GenerateAccessToken creates a JWT access token
-func (j *JWTService) GenerateAccessToken(user *models.User) (string, error) {
-	// Get expiration time from environment or default to 15 minutes
-	expiresInStr := os.Getenv("JWT_EXPIRES_IN")
-	expiresIn := time.Minute * 15 // 15 minutes default
-	if expiresInStr != "" {
-		if parsed, err := strconv.ParseInt(expiresInStr, 10, 64); err == nil {
-			expiresIn = time.Duration(parsed) * time.Second
-		}
-	}
-
+// GenerateAccessToken creates a JWT access token for the session with
+// sessionID
+func (j *JWTService) GenerateAccessToken(user *models.User, sessionID uint) (string, error) {
 	claims := &Claims{
-		UserID: user.ID,
-		Email:  user.Email,
-		Role:   user.Role,
+		UserID:    user.ID,
+		Email:     user.Email,
+		Role:      user.Role,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(accessTokenExpiration())),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			Issuer:    "go-fast-cdn",
+			ID:        uuid.NewString(),
 		},
 	}
 
@@ -95,6 +79,16 @@ func (j *JWTService) GenerateAccessToken(user *models.User) (string, error) {
 	return token.SignedString(j.secretKey)
 }
 
+// accessTokenExpiration returns how long access tokens are valid, from
+// JWT_EXPIRES_IN or 15 minutes by default
+func accessTokenExpiration() time.Duration {
+	expiresIn := time.Minute * 15
+	if parsed, err := strconv.ParseInt(os.Getenv("JWT_EXPIRES_IN"), 10, 64); err == nil {
+		expiresIn = time.Duration(parsed) * time.Second
+	}
+	return expiresIn
+}
+
 // GenerateRefreshToken creates a random refresh token
 func (j *JWTService) GenerateRefreshToken() (string, error) {
 	bytes := make([]byte, 32)
@@ -118,12 +112,44 @@ func (j *JWTService) ValidateToken(tokenString string) (*Claims, error) {
 	}
 
 	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
+		if claims.ID != "" && state.Denied.Contains(claims.ID) {
+			return nil, errors.New("token has been revoked")
+		}
+		if claims.SessionID != 0 && state.Denied.Contains(sessionDenyKey(claims.SessionID)) {
+			return nil, errors.New("session has been revoked")
+		}
 		return claims, nil
 	}
 
 	return nil, errors.New("invalid token")
 }
 
+// RevokeToken rejects the access token from now on, although it has not
+// expired yet.
+func (j *JWTService) RevokeToken(tokenString string) error {
+	claims, err := j.ValidateToken(tokenString)
+	if err != nil {
+		return err
+	}
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		return errors.New("token cannot be revoked")
+	}
+	state.Denied.Add(claims.ID, time.Until(claims.ExpiresAt.Time))
+	return nil
+}
+
+// RevokeSession rejects the access tokens issued for the session with
+// sessionID from now on, although they have not expired yet.
+func (j *JWTService) RevokeSession(sessionID uint) {
+	state.Denied.Add(sessionDenyKey(sessionID), accessTokenExpiration())
+}
+
+// sessionDenyKey is the denylist entry of a revoked session, distinct from
+// the token IDs, which are UUIDs.
+func sessionDenyKey(sessionID uint) string {
+	return "session:" + strconv.FormatUint(uint64(sessionID), 10)
+}
+
 // RefreshTokenExpiration returns the expiration time for refresh tokens
 func (j *JWTService) RefreshTokenExpiration() time.Time {
 	// Refresh tokens expire in 7 days by default
@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+)
+
+// Credential sources a principal can be authenticated with.
+const (
+	MethodJWT        = "jwt"
+	MethodAPIKey     = "api_key"
+	MethodSignedURL  = "signed_url"
+	MethodClientCert = "client_cert"
+)
+
+// RoleService is the role of service accounts.
+const RoleService = "service"
+
+const principalKey = "principal"
+
+// Principal is who a request is authenticated as, a user or a service
+// account, whatever the credentials were.
+type Principal struct {
+	// Method is the credential source, see MethodJWT.
+	Method string
+	// Role is the role of the user, or RoleService.
+	Role           string
+	User           *models.User
+	ServiceAccount *models.ServiceAccount
+	// OrganizationID limits the principal to the media of an organization.
+	OrganizationID *uint
+}
+
+// UserPrincipal returns the principal of user.
+func UserPrincipal(method string, user *models.User) *Principal {
+	return &Principal{Method: method, Role: user.Role, User: user}
+}
+
+// ServiceAccountPrincipal returns the principal of account.
+func ServiceAccountPrincipal(method string, account *models.ServiceAccount) *Principal {
+	return &Principal{Method: method, Role: RoleService, ServiceAccount: account, OrganizationID: account.OrganizationID}
+}
+
+// HasPermission reports whether the principal holds permission. Users are
+// governed by their role and hold every permission.
+func (p *Principal) HasPermission(permission string) bool {
+	return p.ServiceAccount == nil || p.ServiceAccount.HasPermission(permission)
+}
+
+// SetPrincipal stores the principal in the context, together with the
+// user_id, user_email, user_role, user, service_account and organization_id
+// keys handlers read.
+func SetPrincipal(c *gin.Context, p *Principal) {
+	c.Set(principalKey, p)
+	c.Set("user_role", p.Role)
+	if p.User != nil {
+		c.Set("user_id", p.User.ID)
+		c.Set("user_email", p.User.Email)
+		c.Set("user", p.User)
+	}
+	if p.ServiceAccount != nil {
+		c.Set("service_account", p.ServiceAccount)
+	}
+	if p.OrganizationID != nil {
+		c.Set("organization_id", *p.OrganizationID)
+	}
+}
+
+// PrincipalFrom returns the principal stored in the context, if the request
+// was authenticated.
+func PrincipalFrom(c *gin.Context) (*Principal, bool) {
+	value, ok := c.Get(principalKey)
+	if !ok {
+		return nil, false
+	}
+	return value.(*Principal), true
+}
+
+// ID identifies the principal in signed URLs, e.g. "user:3" or
+// "service_account:7".
+func (p *Principal) ID() string {
+	if p.ServiceAccount != nil {
+		return "service_account:" + strconv.FormatUint(uint64(p.ServiceAccount.ID), 10)
+	}
+	return "user:" + strconv.FormatUint(uint64(p.User.ID), 10)
+}
+
+// ParsePrincipalID splits an ID returned by Principal.ID into the kind,
+// "user" or "service_account", and the ID of the record.
+func ParsePrincipalID(id string) (kind string, recordID uint, ok bool) {
+	kind, rest, found := strings.Cut(id, ":")
+	n, err := strconv.ParseUint(rest, 10, 64)
+	if !found || err != nil || (kind != "user" && kind != "service_account") {
+		return "", 0, false
+	}
+	return kind, uint(n), true
+}
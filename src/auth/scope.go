@@ -0,0 +1,24 @@
+package auth
+
+import "github.com/gin-gonic/gin"
+
+// InScope reports whether the principal in the context may modify media
+// owned by orgID. Principals without an organization are not restricted;
+// those with one may only touch media of the same organization.
+func InScope(c *gin.Context, orgID *uint) bool {
+	scope, scoped := c.Get("organization_id")
+	if !scoped {
+		return true
+	}
+	return orgID != nil && *orgID == scope.(uint)
+}
+
+// OrganizationID returns the organization of the principal in the context,
+// used to stamp ownership on uploaded media.
+func OrganizationID(c *gin.Context) *uint {
+	if scope, scoped := c.Get("organization_id"); scoped {
+		id := scope.(uint)
+		return &id
+	}
+	return nil
+}
@@ -1,9 +1,18 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"strings"
+
 	"github.com/pquerna/otp/totp"
 )
 
+// BackupCodeCount is the number of backup codes issued when 2FA is enabled.
+const BackupCodeCount = 10
+
 func GenerateTOTPSecret(email string) (string, string, error) {
 	key, err := totp.Generate(totp.GenerateOpts{
 		Issuer:      "Go-Fast CDN",
@@ -18,3 +27,29 @@ func GenerateTOTPSecret(email string) (string, string, error) {
 func ValidateTOTP(secret, code string) bool {
 	return totp.Validate(code, secret)
 }
+
+// GenerateBackupCodes returns n single-use recovery codes formatted as
+// xxxxx-xxxxx, along with the hashes to store.
+func GenerateBackupCodes(n int) ([]string, []string, error) {
+	codes := make([]string, n)
+	hashes := make([]string, n)
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	for i := range codes {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(encoding.EncodeToString(b))[:10]
+		codes[i] = code[:5] + "-" + code[5:]
+		hashes[i] = HashBackupCode(codes[i])
+	}
+	return codes, hashes, nil
+}
+
+// HashBackupCode returns the stored hash of a backup code. Case, spaces and
+// dashes are ignored so codes can be typed as printed.
+func HashBackupCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,295 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	archiveDBName       = "main.db"
+	archiveUploadsName  = "uploads"
+	archiveManifestName = "manifest.json"
+)
+
+// manifest is stored at the end of every archive and records the SHA-256 of
+// each file so single files can be verified when they are restored.
+type manifest struct {
+	Version int               `json:"version"`
+	Files   map[string]string `json:"files"`
+}
+
+// writeArchive packs the database snapshot and the uploads folder into a
+// gzipped tarball at path. The archive is written to a temporary file first
+// so a failed backup never leaves a truncated archive behind.
+func writeArchive(path, dbSnapshot, uploadsDir string) error {
+	tmpPath := path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	contents := manifest{Version: 1, Files: map[string]string{}}
+
+	err = addFile(tw, dbSnapshot, archiveDBName, contents)
+	if err == nil {
+		err = filepath.WalkDir(uploadsDir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(uploadsDir, p)
+			if err != nil {
+				return err
+			}
+			name := filepath.ToSlash(filepath.Join(archiveUploadsName, rel))
+			if d.IsDir() {
+				return tw.WriteHeader(&tar.Header{
+					Typeflag: tar.TypeDir,
+					Name:     name + "/",
+					Mode:     0o755,
+					ModTime:  time.Now(),
+				})
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			return addFile(tw, p, name, contents)
+		})
+	}
+	if err == nil {
+		err = addManifest(tw, contents)
+	}
+	if err == nil {
+		err = tw.Close()
+	}
+	if err == nil {
+		err = gz.Close()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+// addFile writes the file at path to the archive as name and records its
+// hash in contents.
+func addFile(tw *tar.Writer, path, name string, contents manifest) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tw, hash), f); err != nil {
+		return err
+	}
+	contents.Files[name] = hex.EncodeToString(hash.Sum(nil))
+	return nil
+}
+
+func addManifest(tw *tar.Writer, contents manifest) error {
+	data, err := json.Marshal(contents)
+	if err != nil {
+		return err
+	}
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     archiveManifestName,
+		Mode:     0o644,
+		Size:     int64(len(data)),
+		ModTime:  time.Now(),
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = tw.Write(data)
+	return err
+}
+
+// restoreArchive unpacks an archive created by writeArchive into a staging
+// folder and then swaps the database file and uploads folder in. If any step
+// of the swap fails the previous state is put back.
+func (m *Manager) restoreArchive(path string) error {
+	staging, err := os.MkdirTemp(filepath.Dir(m.UploadsDir), ".restore-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+
+	if err := extractArchive(path, staging); err != nil {
+		return fmt.Errorf("failed to extract backup: %w", err)
+	}
+
+	stagedDB := filepath.Join(staging, archiveDBName)
+	stagedUploads := filepath.Join(staging, archiveUploadsName)
+	if _, err := os.Stat(stagedDB); err != nil {
+		return errors.New("backup does not contain a database")
+	}
+	if err := os.MkdirAll(stagedUploads, 0o755); err != nil {
+		return err
+	}
+
+	// The database is copied next to its destination first so the final
+	// rename cannot fail because staging lives on another file system.
+	tmpDB := m.DBPath + ".restore"
+	src, err := os.Open(stagedDB)
+	if err != nil {
+		return err
+	}
+	err = copyToFile(tmpDB, src)
+	src.Close()
+	if err != nil {
+		return err
+	}
+
+	oldUploads := m.UploadsDir + ".old"
+	os.RemoveAll(oldUploads)
+	if err := os.Rename(m.UploadsDir, oldUploads); err != nil && !errors.Is(err, os.ErrNotExist) {
+		os.Remove(tmpDB)
+		return err
+	}
+	if err := os.Rename(stagedUploads, m.UploadsDir); err != nil {
+		os.Rename(oldUploads, m.UploadsDir)
+		os.Remove(tmpDB)
+		return err
+	}
+	if err := os.Rename(tmpDB, m.DBPath); err != nil {
+		os.RemoveAll(m.UploadsDir)
+		os.Rename(oldUploads, m.UploadsDir)
+		os.Remove(tmpDB)
+		return err
+	}
+
+	return os.RemoveAll(oldUploads)
+}
+
+func extractArchive(path, dest string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dest, filepath.FromSlash(header.Name))
+		if !strings.HasPrefix(target, filepath.Clean(dest)+string(os.PathSeparator)) {
+			return fmt.Errorf("invalid path in backup: %s", header.Name)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return err
+			}
+			if err := copyToFile(target, tr); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// extractFiles copies the archive entries named in files (archive name to
+// destination path) out of an archive and returns the archive's manifest,
+// which is empty for archives written before manifests were added.
+func extractFiles(path string, files map[string]string) (manifest, error) {
+	contents := manifest{Files: map[string]string{}}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return contents, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return contents, err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return contents, nil
+		} else if err != nil {
+			return contents, err
+		}
+
+		if header.Name == archiveManifestName {
+			if err := json.NewDecoder(tr).Decode(&contents); err != nil {
+				return contents, fmt.Errorf("invalid manifest: %w", err)
+			}
+			continue
+		}
+		if dest, ok := files[header.Name]; ok && header.Typeflag == tar.TypeReg {
+			if err := copyToFile(dest, tr); err != nil {
+				return contents, err
+			}
+		}
+	}
+}
+
+// hashFile returns the hex encoded SHA-256 of a file.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,279 @@
+// Package backup creates, lists, restores and prunes backups of the SQLite
+// database and, optionally, the uploaded files, either on demand
+// (cmd/db_backup) or on a schedule.
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"gorm.io/gorm"
+)
+
+const (
+	// Folder is the folder, relative to the data directory, backups are
+	// written to.
+	Folder = "backups"
+
+	OriginManual    = "manual"
+	OriginScheduled = "scheduled"
+
+	timeLayout = "20060102-150405"
+
+	dbExt      = ".db"
+	archiveExt = ".tar.gz"
+)
+
+// Backup describes a backup file on disk.
+type Backup struct {
+	Name          string    `json:"name"`
+	Size          int64     `json:"size"`
+	CreatedAt     time.Time `json:"created_at"`
+	Origin        string    `json:"origin"`
+	IncludesFiles bool      `json:"includes_files"`
+	Locations     []string  `json:"locations"`
+	// Integrity is the result of the last Verify: ok, corrupt or
+	// unchecked.
+	Integrity      string     `json:"integrity"`
+	IntegrityError string     `json:"integrity_error,omitempty"`
+	VerifiedAt     *time.Time `json:"verified_at"`
+}
+
+// Manager creates and maintains backups in Dir.
+type Manager struct {
+	DB         *gorm.DB
+	DBPath     string
+	UploadsDir string
+	Dir        string
+
+	mu sync.Mutex
+}
+
+// NewManager returns a Manager backing up the database at dbPath and the
+// files in uploadsDir into the backups folder of dataDir.
+func NewManager(db *gorm.DB, dataDir, dbPath, uploadsDir string) *Manager {
+	return &Manager{
+		DB:         db,
+		DBPath:     dbPath,
+		UploadsDir: uploadsDir,
+		Dir:        filepath.Join(dataDir, Folder),
+	}
+}
+
+// NewDefaultManager returns a Manager for the application database that
+// keeps its backups next to the database file.
+func NewDefaultManager() *Manager {
+	return NewManager(
+		database.DB,
+		filepath.Join(util.ExPath, database.DbFolder),
+		database.Path(),
+		filepath.Join(util.ExPath, "uploads"),
+	)
+}
+
+// Create writes a consistent snapshot of the database to a new backup file.
+// With includeFiles the snapshot is packed into a tar.gz archive together
+// with the uploads folder. origin records whether the backup was requested
+// manually or by the scheduler and is encoded in the file name.
+func (m *Manager) Create(origin string, includeFiles bool) (Backup, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return Backup{}, err
+	}
+
+	base := fmt.Sprintf("backup-%s-%s", time.Now().UTC().Format(timeLayout), origin)
+	snapshot := filepath.Join(m.Dir, base+dbExt)
+	if includeFiles {
+		snapshot = filepath.Join(m.Dir, "."+base+dbExt)
+		defer os.Remove(snapshot)
+	}
+
+	// VACUUM INTO produces a consistent copy even while the server is
+	// writing to the database.
+	if err := m.DB.Exec("VACUUM INTO ?", snapshot).Error; err != nil {
+		return Backup{}, fmt.Errorf("failed to create backup: %w", err)
+	}
+
+	name := base + dbExt
+	if includeFiles {
+		name = base + archiveExt
+		if err := writeArchive(m.path(name), snapshot, m.UploadsDir); err != nil {
+			return Backup{}, fmt.Errorf("failed to create backup: %w", err)
+		}
+	}
+
+	return m.Verify(name)
+}
+
+// List returns all backups, newest first.
+func (m *Manager) List() ([]Backup, error) {
+	entries, err := os.ReadDir(m.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []Backup{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	backups := []Backup{}
+	for _, entry := range entries {
+		if entry.IsDir() || !isBackupName(entry.Name()) {
+			continue
+		}
+		backup, err := m.stat(entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		backups = append(backups, backup)
+	}
+
+	sortNewestFirst(backups)
+	return backups, nil
+}
+
+// Restore replaces the database file, and for archives the uploads folder,
+// with the contents of the given backup. The server must not be running
+// while restoring.
+func (m *Manager) Restore(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !isBackupName(name) {
+		return fmt.Errorf("invalid backup name: %s", name)
+	}
+
+	if strings.HasSuffix(name, archiveExt) {
+		return m.restoreArchive(m.path(name))
+	}
+
+	src, err := os.Open(m.path(name))
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmpPath := m.DBPath + ".restore"
+	if err := copyToFile(tmpPath, src); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, m.DBPath)
+}
+
+// Delete removes a single backup.
+func (m *Manager) Delete(name string) error {
+	if !isBackupName(name) {
+		return fmt.Errorf("invalid backup name: %s", name)
+	}
+
+	if err := os.Remove(m.path(name)); err != nil {
+		return err
+	}
+	os.Remove(m.integrityPath(name))
+	return nil
+}
+
+// Prune deletes the backups that fall outside the retention policy and
+// returns their names.
+func (m *Manager) Prune(policy RetentionPolicy) ([]string, error) {
+	backups, err := m.List()
+	if err != nil {
+		return nil, err
+	}
+
+	removed := []string{}
+	for i, backup := range backups {
+		if !policy.expired(i, backup, time.Now()) {
+			continue
+		}
+		if err := m.Delete(backup.Name); err != nil {
+			return removed, err
+		}
+		removed = append(removed, backup.Name)
+	}
+
+	return removed, nil
+}
+
+func (m *Manager) path(name string) string {
+	return filepath.Join(m.Dir, name)
+}
+
+func (m *Manager) stat(name string) (Backup, error) {
+	info, err := os.Stat(m.path(name))
+	if err != nil {
+		return Backup{}, err
+	}
+
+	backup := parseName(name)
+	backup.Size = info.Size()
+	backup.Locations = []string{LocationLocal}
+	if backup.CreatedAt.IsZero() {
+		backup.CreatedAt = info.ModTime().UTC()
+	}
+	m.readIntegrity(&backup)
+
+	return backup, nil
+}
+
+// parseName extracts the metadata encoded in a backup file name of the form
+// backup-<date>-<time>-<origin>.<ext>.
+func parseName(name string) Backup {
+	backup := Backup{
+		Name:          name,
+		Origin:        OriginManual,
+		IncludesFiles: strings.HasSuffix(name, archiveExt),
+	}
+
+	trimmed := strings.TrimSuffix(strings.TrimSuffix(name, dbExt), archiveExt)
+	parts := strings.Split(strings.TrimPrefix(trimmed, "backup-"), "-")
+	if len(parts) == 3 {
+		if createdAt, err := time.Parse(timeLayout, parts[0]+"-"+parts[1]); err == nil {
+			backup.CreatedAt = createdAt
+		}
+		backup.Origin = parts[2]
+	}
+
+	return backup
+}
+
+func sortNewestFirst(backups []Backup) {
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].CreatedAt.After(backups[j].CreatedAt)
+	})
+}
+
+func isBackupName(name string) bool {
+	return strings.HasPrefix(name, "backup-") &&
+		(strings.HasSuffix(name, dbExt) || strings.HasSuffix(name, archiveExt)) &&
+		filepath.Base(name) == name
+}
+
+// copyToFile writes r to a new file at path, removing it again on failure.
+func copyToFile(path string, r io.Reader) error {
+	dst, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, r); err != nil {
+		dst.Close()
+		os.Remove(path)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(path)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,178 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func newTestManager(t *testing.T) *Manager {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "main.db")
+	db, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.Exec("CREATE TABLE items (name TEXT)").Error)
+
+	uploadsDir := filepath.Join(dir, "uploads")
+	require.NoError(t, os.MkdirAll(filepath.Join(uploadsDir, "images"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(uploadsDir, "images", "a.png"), []byte("original"), 0o644))
+
+	return NewManager(db, dir, dbPath, uploadsDir)
+}
+
+func TestManager_CreateAndList(t *testing.T) {
+	m := newTestManager(t)
+
+	created, err := m.Create(OriginScheduled, false)
+	require.NoError(t, err)
+	require.Equal(t, OriginScheduled, created.Origin)
+	require.Greater(t, created.Size, int64(0))
+
+	backups, err := m.List()
+	require.NoError(t, err)
+	require.Len(t, backups, 1)
+	require.Equal(t, created.Name, backups[0].Name)
+}
+
+func TestManager_Prune(t *testing.T) {
+	m := newTestManager(t)
+	require.NoError(t, os.MkdirAll(m.Dir, 0o755))
+	names := []string{
+		"backup-20240101-030000-scheduled.db",
+		"backup-20240102-030000-scheduled.db",
+		"backup-20240103-030000-manual.db",
+	}
+	for _, name := range names {
+		require.NoError(t, os.WriteFile(filepath.Join(m.Dir, name), []byte("db"), 0o644))
+	}
+
+	removed, err := m.Prune(RetentionPolicy{MaxCount: 2})
+	require.NoError(t, err)
+	require.Equal(t, []string{names[0]}, removed)
+
+	removed, err = m.Prune(RetentionPolicy{MaxAge: 24 * time.Hour})
+	require.NoError(t, err)
+	require.Len(t, removed, 2)
+}
+
+func TestNewScheduler_InvalidSchedule(t *testing.T) {
+	_, err := NewScheduler(newTestManager(t), "not a cron", RetentionPolicy{}, false)
+	require.Error(t, err)
+}
+
+func TestManager_CreateAndRestoreWithFiles(t *testing.T) {
+	m := newTestManager(t)
+	image := filepath.Join(m.UploadsDir, "images", "a.png")
+
+	created, err := m.Create(OriginManual, true)
+	require.NoError(t, err)
+	require.True(t, created.IncludesFiles)
+
+	require.NoError(t, os.WriteFile(image, []byte("changed"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(m.UploadsDir, "images", "b.png"), []byte("new"), 0o644))
+
+	require.NoError(t, m.Restore(created.Name))
+
+	content, err := os.ReadFile(image)
+	require.NoError(t, err)
+	require.Equal(t, "original", string(content))
+	require.NoFileExists(t, filepath.Join(m.UploadsDir, "images", "b.png"))
+	require.FileExists(t, m.DBPath)
+}
+
+func TestManager_Verify(t *testing.T) {
+	m := newTestManager(t)
+
+	created, err := m.Create(OriginManual, false)
+	require.NoError(t, err)
+	require.Equal(t, IntegrityOK, created.Integrity)
+	require.NotNil(t, created.VerifiedAt)
+
+	require.NoError(t, os.WriteFile(m.path(created.Name), []byte("not a database"), 0o644))
+	verified, err := m.Verify(created.Name)
+	require.NoError(t, err)
+	require.Equal(t, IntegrityCorrupt, verified.Integrity)
+	require.NotEmpty(t, verified.IntegrityError)
+
+	backups, err := m.List()
+	require.NoError(t, err)
+	require.Len(t, backups, 1)
+	require.Equal(t, IntegrityCorrupt, backups[0].Integrity)
+
+	require.NoError(t, m.Delete(created.Name))
+	require.NoFileExists(t, m.integrityPath(created.Name))
+}
+
+func TestManager_RestoreInto(t *testing.T) {
+	m := newTestManager(t)
+	created, err := m.Create(OriginManual, true)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(m.UploadsDir, "images", "a.png"), []byte("changed"), 0o644))
+
+	sandbox := t.TempDir()
+	require.NoError(t, m.RestoreInto(created.Name, sandbox))
+
+	require.FileExists(t, filepath.Join(sandbox, "db_data", "main.db"))
+	restored, err := os.ReadFile(filepath.Join(sandbox, "uploads", "images", "a.png"))
+	require.NoError(t, err)
+	require.Equal(t, "original", string(restored))
+	require.DirExists(t, filepath.Join(sandbox, "uploads", "docs"))
+
+	live, err := os.ReadFile(filepath.Join(m.UploadsDir, "images", "a.png"))
+	require.NoError(t, err)
+	require.Equal(t, "changed", string(live))
+}
+
+func TestManager_RestoreMedia(t *testing.T) {
+	m := newTestManager(t)
+	require.NoError(t, m.DB.AutoMigrate(&models.Image{}, &models.Doc{}))
+	image := models.Image{
+		FileName:          "a.png",
+		OriginalName:      "Holiday photo.png",
+		MimeType:          "image/png",
+		Checksum:          []byte{0xab, 0xcd},
+		ChecksumAlgorithm: models.ChecksumSHA256,
+		ModerationStatus:  models.ModerationStatusPending,
+		MediaMetadata:     models.MediaMetadata{Title: "Beach", AltText: "A beach", Attributes: []byte(`{"camera":"x100"}`)},
+	}
+	require.NoError(t, m.DB.Create(&image).Error)
+
+	created, err := m.Create(OriginManual, true)
+	require.NoError(t, err)
+
+	require.NoError(t, m.DB.Unscoped().Delete(&image).Error)
+	require.NoError(t, os.Remove(filepath.Join(m.UploadsDir, "images", "a.png")))
+
+	restored, err := m.RestoreMedia(created.Name, MediaQuery{Checksum: []byte{0xab, 0xcd}})
+	require.NoError(t, err)
+	require.Equal(t, RestoredMedia{Type: models.MediaTypeImage, ID: image.ID, FileName: "a.png"}, restored)
+
+	content, err := os.ReadFile(filepath.Join(m.UploadsDir, "images", "a.png"))
+	require.NoError(t, err)
+	require.Equal(t, "original", string(content))
+
+	var live models.Image
+	require.NoError(t, m.DB.First(&live, image.ID).Error)
+	require.Equal(t, "a.png", live.FileName)
+	require.Equal(t, image.UUID, live.UUID)
+	require.Equal(t, "Holiday photo.png", live.OriginalName)
+	require.Equal(t, "image/png", live.MimeType)
+	require.Equal(t, models.ChecksumSHA256, live.ChecksumAlgorithm)
+	require.Equal(t, models.ModerationStatusPending, live.ModerationStatus)
+	require.Equal(t, image.MediaMetadata.Title, live.Title)
+	require.Equal(t, image.MediaMetadata.AltText, live.AltText)
+	require.JSONEq(t, `{"camera":"x100"}`, string(live.Attributes))
+	require.True(t, image.CreatedAt.Equal(live.CreatedAt))
+
+	_, err = m.RestoreMedia(created.Name, MediaQuery{FileName: "a.png"})
+	require.ErrorIs(t, err, ErrMediaExists)
+
+	_, err = m.RestoreMedia(created.Name, MediaQuery{FileName: "missing.png"})
+	require.ErrorIs(t, err, ErrMediaNotInBackup)
+}
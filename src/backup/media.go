@@ -0,0 +1,248 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrMediaNotInBackup = errors.New("media not found in backup")
+	ErrMediaExists      = errors.New("media with this file name already exists")
+	ErrFileNotInBackup  = errors.New("backup does not contain the file")
+)
+
+// MediaQuery selects a media record in a backup by file name or, when
+// FileName is empty, by checksum. Type may be empty to search images first
+// and then documents.
+type MediaQuery struct {
+	Type     string
+	FileName string
+	Checksum []byte
+}
+
+// RestoredMedia describes a media record brought back from a backup.
+type RestoredMedia struct {
+	Type     string `json:"type"`
+	ID       uint   `json:"id"`
+	FileName string `json:"file_name"`
+}
+
+// mediaRow is a row of the images or docs table of a backup, with every
+// column it has.
+type mediaRow map[string]any
+
+func (r mediaRow) fileName() string {
+	fileName, _ := r["file_name"].(string)
+	return fileName
+}
+
+// RestoreMedia restores a single media record and its file from a backup
+// into the live database and uploads folder, leaving everything else as it
+// is. The file is verified against the archive manifest when there is one.
+// Database-only backups can only restore records whose file is still on
+// disk.
+func (m *Manager) RestoreMedia(name string, query MediaQuery) (RestoredMedia, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !isBackupName(name) {
+		return RestoredMedia{}, fmt.Errorf("invalid backup name: %s", name)
+	}
+	if _, err := os.Stat(m.path(name)); err != nil {
+		return RestoredMedia{}, err
+	}
+
+	staging, err := os.MkdirTemp(m.Dir, ".media-")
+	if err != nil {
+		return RestoredMedia{}, err
+	}
+	defer os.RemoveAll(staging)
+
+	isArchive := strings.HasSuffix(name, archiveExt)
+	snapshot := filepath.Join(staging, archiveDBName)
+	if isArchive {
+		_, err = extractFiles(m.path(name), map[string]string{archiveDBName: snapshot})
+	} else {
+		err = copyFile(m.path(name), snapshot)
+	}
+	if err != nil {
+		return RestoredMedia{}, err
+	}
+
+	mediaType, row, err := findMedia(snapshot, query)
+	if err != nil {
+		return RestoredMedia{}, err
+	}
+	table := models.MediaFolder(mediaType)
+	fileName := row.fileName()
+
+	var existing int64
+	if err := m.DB.Table(table).Where("file_name = ? AND deleted_at IS NULL", fileName).Count(&existing).Error; err != nil {
+		return RestoredMedia{}, err
+	}
+	if existing > 0 {
+		return RestoredMedia{}, ErrMediaExists
+	}
+
+	livePath := filepath.Join(m.UploadsDir, table, fileName)
+	if isArchive {
+		if err := m.restoreMediaFile(name, table+"/"+fileName, livePath, staging); err != nil {
+			return RestoredMedia{}, err
+		}
+	} else if _, err := os.Stat(livePath); err != nil {
+		return RestoredMedia{}, ErrFileNotInBackup
+	}
+
+	// The whole row is restored, except columns the live table no longer
+	// has; columns added since the backup get their defaults.
+	columns, err := m.DB.Migrator().ColumnTypes(table)
+	if err != nil {
+		return RestoredMedia{}, err
+	}
+	live := map[string]bool{}
+	for _, column := range columns {
+		live[column.Name()] = true
+	}
+	for column := range row {
+		if !live[column] {
+			delete(row, column)
+		}
+	}
+	row["deleted_at"] = nil
+	if id, _ := row["uuid"].(string); id == "" {
+		row["uuid"] = uuid.NewString()
+	}
+
+	// Keep the original ID when it is free so references stay valid.
+	if err := m.DB.Table(table).Create(map[string]any(row)).Error; err != nil {
+		delete(row, "id")
+		if err := m.DB.Table(table).Create(map[string]any(row)).Error; err != nil {
+			return RestoredMedia{}, err
+		}
+	}
+	var id uint
+	if err := m.DB.Table(table).Select("id").Where("file_name = ? AND deleted_at IS NULL", fileName).Row().Scan(&id); err != nil {
+		return RestoredMedia{}, err
+	}
+
+	return RestoredMedia{Type: mediaType, ID: id, FileName: fileName}, nil
+}
+
+// restoreMediaFile extracts a single upload from an archive and moves it into
+// place once it matches the manifest.
+func (m *Manager) restoreMediaFile(name, upload, livePath, staging string) error {
+	entry := archiveUploadsName + "/" + upload
+	extracted := filepath.Join(staging, "file")
+
+	contents, err := extractFiles(m.path(name), map[string]string{entry: extracted})
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(extracted); err != nil {
+		return ErrFileNotInBackup
+	}
+	if want, ok := contents.Files[entry]; ok {
+		got, err := hashFile(extracted)
+		if err != nil {
+			return err
+		}
+		if got != want {
+			return fmt.Errorf("checksum mismatch for %s", entry)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(livePath), 0o755); err != nil {
+		return err
+	}
+	tmpPath := livePath + ".restore"
+	if err := copyFile(extracted, tmpPath); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, livePath)
+}
+
+// findMedia looks up the queried media in a database snapshot.
+func findMedia(snapshot string, query MediaQuery) (string, mediaRow, error) {
+	db, err := gorm.Open(sqlite.Open(snapshot), &gorm.Config{})
+	if err != nil {
+		return "", nil, err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return "", nil, err
+	}
+	defer sqlDB.Close()
+
+	types := []string{models.MediaTypeImage, models.MediaTypeDoc}
+	if query.Type != "" {
+		types = []string{query.Type}
+	}
+
+	for _, mediaType := range types {
+		q := db.Table(models.MediaFolder(mediaType)).Where("deleted_at IS NULL")
+		if query.FileName != "" {
+			q = q.Where("file_name = ?", query.FileName)
+		} else {
+			q = q.Where("checksum = ?", query.Checksum)
+		}
+		row, err := scanRow(q.Order("id DESC").Limit(1))
+		if err != nil {
+			return "", nil, err
+		}
+		if row != nil {
+			return mediaType, row, nil
+		}
+	}
+
+	return "", nil, ErrMediaNotInBackup
+}
+
+// scanRow returns the first row selected by q with its columns, or nil if
+// there is none. Rows are scanned by database/sql, as GORM cannot scan blob
+// columns into maps.
+func scanRow(q *gorm.DB) (mediaRow, error) {
+	rows, err := q.Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	values := make([]any, len(columns))
+	pointers := make([]any, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	if err := rows.Scan(pointers...); err != nil {
+		return nil, err
+	}
+	row := mediaRow{}
+	for i, column := range columns {
+		row[column] = values[i]
+	}
+	return row, nil
+}
+
+func copyFile(src, dst string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return copyToFile(dst, f)
+}
@@ -0,0 +1,42 @@
+package backup
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// RetentionPolicy limits how many backups are kept and for how long. Zero
+// values disable the respective limit.
+type RetentionPolicy struct {
+	MaxCount int
+	MaxAge   time.Duration
+}
+
+// RetentionPolicyFromEnv reads BACKUP_RETENTION_COUNT and
+// BACKUP_RETENTION_DAYS.
+func RetentionPolicyFromEnv() RetentionPolicy {
+	policy := RetentionPolicy{}
+
+	if count, err := strconv.Atoi(os.Getenv("BACKUP_RETENTION_COUNT")); err == nil && count > 0 {
+		policy.MaxCount = count
+	}
+	if days, err := strconv.Atoi(os.Getenv("BACKUP_RETENTION_DAYS")); err == nil && days > 0 {
+		policy.MaxAge = time.Duration(days) * 24 * time.Hour
+	}
+
+	return policy
+}
+
+// expired reports whether the backup at position index of a newest-first
+// list falls outside the policy.
+func (p RetentionPolicy) expired(index int, backup Backup, now time.Time) bool {
+	if p.MaxCount > 0 && index >= p.MaxCount {
+		return true
+	}
+	if p.MaxAge > 0 && now.Sub(backup.CreatedAt) > p.MaxAge {
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,91 @@
+package backup
+
+import (
+	"context"
+	"os"
+	"path"
+	"strconv"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/breaker"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+type s3Target struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+// newS3Target connects to the bucket using BACKUP_S3_ENDPOINT (defaults to
+// AWS), BACKUP_S3_REGION, BACKUP_S3_ACCESS_KEY_ID,
+// BACKUP_S3_SECRET_ACCESS_KEY and BACKUP_S3_USE_SSL (defaults to true).
+func newS3Target(bucket, prefix string) (*s3Target, error) {
+	endpoint := os.Getenv("BACKUP_S3_ENDPOINT")
+	if endpoint == "" {
+		endpoint = "s3.amazonaws.com"
+	}
+	useSSL := true
+	if parsed, err := strconv.ParseBool(os.Getenv("BACKUP_S3_USE_SSL")); err == nil {
+		useSSL = parsed
+	}
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds: credentials.NewStaticV4(
+			os.Getenv("BACKUP_S3_ACCESS_KEY_ID"),
+			os.Getenv("BACKUP_S3_SECRET_ACCESS_KEY"),
+			"",
+		),
+		Region: os.Getenv("BACKUP_S3_REGION"),
+		Secure: useSSL,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &s3Target{client: client, bucket: bucket, prefix: prefix}, nil
+}
+
+func (t *s3Target) String() string {
+	return "s3://" + path.Join(t.bucket, t.prefix)
+}
+
+// guard returns the circuit breaker of the bucket, which S3 calls go
+// through so an unreachable bucket fails fast.
+func (t *s3Target) guard() *breaker.Breaker {
+	return breaker.Get("backup " + t.String())
+}
+
+func (t *s3Target) Upload(ctx context.Context, name, localPath string) error {
+	return t.guard().Try(ctx, func(ctx context.Context) error {
+		_, err := t.client.FPutObject(ctx, t.bucket, path.Join(t.prefix, name), localPath, minio.PutObjectOptions{
+			ContentType: "application/octet-stream",
+		})
+		return err
+	})
+}
+
+func (t *s3Target) List(ctx context.Context) ([]Backup, error) {
+	prefix := t.prefix
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	var backups []Backup
+	err := t.guard().Try(ctx, func(ctx context.Context) error {
+		backups = []Backup{}
+		for object := range t.client.ListObjects(ctx, t.bucket, minio.ListObjectsOptions{Prefix: prefix}) {
+			if object.Err != nil {
+				return object.Err
+			}
+			if backup, ok := remoteBackup(path.Base(object.Key), object.Size); ok {
+				backups = append(backups, backup)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return backups, nil
+}
@@ -0,0 +1,52 @@
+package backup
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+)
+
+// RestoreInto unpacks a backup into dir laid out like the application's data
+// directory (db_data/main.db and uploads/), leaving the live database and
+// uploads untouched. Backups without files get an empty uploads folder.
+func (m *Manager) RestoreInto(name, dir string) error {
+	if !isBackupName(name) {
+		return fmt.Errorf("invalid backup name: %s", name)
+	}
+
+	dbDir := filepath.Join(dir, database.DbFolder)
+	if err := os.MkdirAll(dbDir, 0o755); err != nil {
+		return err
+	}
+	dbPath := filepath.Join(dbDir, database.DbName)
+
+	if strings.HasSuffix(name, archiveExt) {
+		if err := extractArchive(m.path(name), dir); err != nil {
+			return fmt.Errorf("failed to extract backup: %w", err)
+		}
+		if err := os.Rename(filepath.Join(dir, archiveDBName), dbPath); err != nil {
+			return fmt.Errorf("backup does not contain a database: %w", err)
+		}
+		os.Remove(filepath.Join(dir, archiveManifestName))
+	} else {
+		src, err := os.Open(m.path(name))
+		if err != nil {
+			return err
+		}
+		err = copyToFile(dbPath, src)
+		src.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, folder := range []string{"images", "docs"} {
+		if err := os.MkdirAll(filepath.Join(dir, archiveUploadsName, folder), 0o755); err != nil {
+			return err
+		}
+	}
+	return nil
+}
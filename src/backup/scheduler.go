@@ -0,0 +1,175 @@
+package backup
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// ActiveScheduler is the scheduler started by StartScheduler, or nil when
+// scheduled backups are disabled.
+var ActiveScheduler *Scheduler
+
+// Status is a snapshot of the scheduler state exposed to admins.
+type Status struct {
+	Enabled      bool            `json:"enabled"`
+	Schedule     string          `json:"schedule"`
+	IncludeFiles bool            `json:"include_files"`
+	Targets      []string        `json:"targets"`
+	Retention    RetentionStatus `json:"retention"`
+	Running      bool            `json:"running"`
+	LastRun      *time.Time      `json:"last_run"`
+	LastBackup   *Backup         `json:"last_backup"`
+	LastError    string          `json:"last_error,omitempty"`
+	Pruned       []string        `json:"last_pruned"`
+	NextRun      *time.Time      `json:"next_run"`
+}
+
+type RetentionStatus struct {
+	MaxCount   int `json:"max_count"`
+	MaxAgeDays int `json:"max_age_days"`
+}
+
+// Scheduler periodically creates backups according to a cron expression and
+// prunes old ones according to the retention policy.
+type Scheduler struct {
+	// Targets receive a copy of every scheduled backup.
+	Targets []Target
+
+	manager      *Manager
+	schedule     string
+	policy       RetentionPolicy
+	includeFiles bool
+	cron         *cron.Cron
+	entry        cron.EntryID
+
+	mu     sync.Mutex
+	status Status
+}
+
+// NewScheduler validates the cron expression and returns a stopped scheduler.
+// With includeFiles the scheduled backups also contain the uploaded files.
+func NewScheduler(manager *Manager, schedule string, policy RetentionPolicy, includeFiles bool) (*Scheduler, error) {
+	s := &Scheduler{
+		manager:      manager,
+		schedule:     schedule,
+		policy:       policy,
+		includeFiles: includeFiles,
+		cron:         cron.New(),
+	}
+
+	entry, err := s.cron.AddFunc(schedule, s.Run)
+	if err != nil {
+		return nil, err
+	}
+	s.entry = entry
+	s.status = Status{
+		Enabled:      true,
+		Schedule:     schedule,
+		IncludeFiles: includeFiles,
+		Retention: RetentionStatus{
+			MaxCount:   policy.MaxCount,
+			MaxAgeDays: int(policy.MaxAge / (24 * time.Hour)),
+		},
+		Pruned: []string{},
+	}
+
+	return s, nil
+}
+
+// StartScheduler starts scheduled backups if BACKUP_SCHEDULE contains a cron
+// expression, e.g. "0 3 * * *" for every night at 03:00. Setting
+// BACKUP_INCLUDE_FILES to true adds the uploaded files to the backups, and
+// BACKUP_TARGETS lists remote targets each backup is copied to.
+func StartScheduler(manager *Manager) error {
+	schedule := os.Getenv("BACKUP_SCHEDULE")
+	if schedule == "" {
+		return nil
+	}
+	includeFiles, _ := strconv.ParseBool(os.Getenv("BACKUP_INCLUDE_FILES"))
+	targets, err := TargetsFromEnv()
+	if err != nil {
+		return err
+	}
+
+	s, err := NewScheduler(manager, schedule, RetentionPolicyFromEnv(), includeFiles)
+	if err != nil {
+		return err
+	}
+	s.Targets = targets
+	s.Start()
+	ActiveScheduler = s
+	log.Printf("Scheduled database backups enabled (%s)", schedule)
+
+	return nil
+}
+
+func (s *Scheduler) Start() {
+	s.cron.Start()
+}
+
+// Stop stops the scheduler and waits for a running backup to finish.
+func (s *Scheduler) Stop() {
+	<-s.cron.Stop().Done()
+}
+
+// Run creates a backup and applies the retention policy. It is invoked by the
+// cron schedule but may also be called directly.
+func (s *Scheduler) Run() {
+	s.mu.Lock()
+	if s.status.Running {
+		s.mu.Unlock()
+		return
+	}
+	s.status.Running = true
+	s.mu.Unlock()
+
+	backup, err := s.manager.Create(OriginScheduled, s.includeFiles)
+	if err == nil {
+		err = s.manager.Push(context.Background(), backup, s.Targets)
+	}
+	var pruned []string
+	if err == nil {
+		pruned, err = s.manager.Prune(s.policy)
+	}
+
+	now := time.Now().UTC()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.Running = false
+	s.status.LastRun = &now
+	s.status.LastError = ""
+	if err != nil {
+		log.Printf("Scheduled backup failed: %s", err.Error())
+		s.status.LastError = err.Error()
+	}
+	if backup.Name != "" {
+		s.status.LastBackup = &backup
+	}
+	if pruned != nil {
+		s.status.Pruned = pruned
+	}
+}
+
+// Status returns the current scheduler state.
+func (s *Scheduler) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := s.status
+	status.Targets = []string{}
+	for _, target := range s.Targets {
+		status.Targets = append(status.Targets, target.String())
+	}
+	if next := s.cron.Entry(s.entry).Next; !next.IsZero() {
+		next = next.UTC()
+		status.NextRun = &next
+	}
+
+	return status
+}
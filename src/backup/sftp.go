@@ -0,0 +1,172 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+type sftpTarget struct {
+	url    *url.URL
+	config *ssh.ClientConfig
+	dir    string
+}
+
+// newSFTPTarget authenticates with the password in the URL or
+// BACKUP_SFTP_PASSWORD, and/or the private key at BACKUP_SFTP_KEY_FILE. The
+// host key is verified against BACKUP_SFTP_KNOWN_HOSTS unless
+// BACKUP_SFTP_INSECURE_IGNORE_HOST_KEY is true.
+func newSFTPTarget(u *url.URL, dir string) (*sftpTarget, error) {
+	auth := []ssh.AuthMethod{}
+	password, _ := u.User.Password()
+	if password == "" {
+		password = os.Getenv("BACKUP_SFTP_PASSWORD")
+	}
+	if password != "" {
+		auth = append(auth, ssh.Password(password))
+	}
+	if keyFile := os.Getenv("BACKUP_SFTP_KEY_FILE"); keyFile != "" {
+		key, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if len(auth) == 0 {
+		return nil, errors.New("sftp target requires BACKUP_SFTP_PASSWORD or BACKUP_SFTP_KEY_FILE")
+	}
+
+	hostKeyCallback := ssh.InsecureIgnoreHostKey()
+	if insecure, _ := strconv.ParseBool(os.Getenv("BACKUP_SFTP_INSECURE_IGNORE_HOST_KEY")); !insecure {
+		knownHostsFile := os.Getenv("BACKUP_SFTP_KNOWN_HOSTS")
+		if knownHostsFile == "" {
+			return nil, errors.New("sftp target requires BACKUP_SFTP_KNOWN_HOSTS")
+		}
+		callback, err := knownhosts.New(knownHostsFile)
+		if err != nil {
+			return nil, err
+		}
+		hostKeyCallback = callback
+	}
+
+	return &sftpTarget{
+		url: u,
+		config: &ssh.ClientConfig{
+			User:            u.User.Username(),
+			Auth:            auth,
+			HostKeyCallback: hostKeyCallback,
+		},
+		dir: "/" + dir,
+	}, nil
+}
+
+func (t *sftpTarget) String() string {
+	u := *t.url
+	u.User = url.User(t.url.User.Username())
+	return u.String()
+}
+
+func (t *sftpTarget) connect(ctx context.Context) (*sftp.Client, func(), error) {
+	addr := t.url.Host
+	if t.url.Port() == "" {
+		addr = net.JoinHostPort(t.url.Hostname(), "22")
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, t.config)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	sshClient := ssh.NewClient(sshConn, chans, reqs)
+	client, err := sftp.NewClient(sshClient)
+	if err != nil {
+		sshClient.Close()
+		return nil, nil, err
+	}
+
+	return client, func() {
+		client.Close()
+		sshClient.Close()
+	}, nil
+}
+
+func (t *sftpTarget) Upload(ctx context.Context, name, localPath string) error {
+	client, closeFn, err := t.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	if err := client.MkdirAll(t.dir); err != nil {
+		return err
+	}
+
+	src, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	// Upload under a temporary name so an interrupted transfer is never
+	// listed as a backup.
+	remotePath := path.Join(t.dir, name)
+	dst, err := client.Create(remotePath + ".part")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+
+	client.Remove(remotePath)
+	return client.Rename(remotePath+".part", remotePath)
+}
+
+func (t *sftpTarget) List(ctx context.Context) ([]Backup, error) {
+	client, closeFn, err := t.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFn()
+
+	entries, err := client.ReadDir(t.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []Backup{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	backups := []Backup{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if backup, ok := remoteBackup(entry.Name(), entry.Size()); ok {
+			backups = append(backups, backup)
+		}
+	}
+
+	return backups, nil
+}
@@ -0,0 +1,123 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+)
+
+// LocationLocal marks backups stored in the local backups folder.
+const LocationLocal = "local"
+
+// Target is an off-host location backups are copied to.
+type Target interface {
+	// String returns the target URL without credentials.
+	String() string
+	// Upload copies the local backup file at localPath to the target.
+	Upload(ctx context.Context, name, localPath string) error
+	// List returns the backups stored at the target.
+	List(ctx context.Context) ([]Backup, error)
+}
+
+// ParseTarget parses a target URL such as s3://bucket/prefix or
+// sftp://user@host:22/path. Credentials are read from the environment, see
+// newS3Target and newSFTPTarget.
+func ParseTarget(raw string) (Target, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid backup target %q: %w", raw, err)
+	}
+
+	prefix := strings.Trim(path.Clean("/"+u.Path), "/")
+	switch u.Scheme {
+	case "s3":
+		if u.Host == "" {
+			return nil, fmt.Errorf("invalid backup target %q: missing bucket", raw)
+		}
+		return newS3Target(u.Host, prefix)
+	case "sftp":
+		if u.Host == "" {
+			return nil, fmt.Errorf("invalid backup target %q: missing host", raw)
+		}
+		return newSFTPTarget(u, prefix)
+	default:
+		return nil, fmt.Errorf("unsupported backup target scheme %q", u.Scheme)
+	}
+}
+
+// TargetsFromEnv parses the comma separated target URLs in BACKUP_TARGETS.
+func TargetsFromEnv() ([]Target, error) {
+	targets := []Target{}
+	for _, raw := range strings.Split(os.Getenv("BACKUP_TARGETS"), ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		target, err := ParseTarget(raw)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+
+	return targets, nil
+}
+
+// Push uploads a local backup to every target.
+func (m *Manager) Push(ctx context.Context, backup Backup, targets []Target) error {
+	for _, target := range targets {
+		if err := target.Upload(ctx, backup.Name, m.path(backup.Name)); err != nil {
+			return fmt.Errorf("failed to upload %s to %s: %w", backup.Name, target, err)
+		}
+	}
+
+	return nil
+}
+
+// ListAll merges the local backups with those stored at the targets. A
+// backup present in several places is listed once with all its locations.
+func (m *Manager) ListAll(ctx context.Context, targets []Target) ([]Backup, error) {
+	backups, err := m.List()
+	if err != nil {
+		return nil, err
+	}
+
+	index := map[string]int{}
+	for i := range backups {
+		index[backups[i].Name] = i
+	}
+
+	for _, target := range targets {
+		remote, err := target.List(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list backups at %s: %w", target, err)
+		}
+		for _, backup := range remote {
+			if i, ok := index[backup.Name]; ok {
+				backups[i].Locations = append(backups[i].Locations, target.String())
+				continue
+			}
+			backup.Locations = []string{target.String()}
+			index[backup.Name] = len(backups)
+			backups = append(backups, backup)
+		}
+	}
+
+	sortNewestFirst(backups)
+	return backups, nil
+}
+
+// remoteBackup builds a Backup from an object stored at a target.
+func remoteBackup(name string, size int64) (Backup, bool) {
+	if !isBackupName(name) {
+		return Backup{}, false
+	}
+
+	backup := parseName(name)
+	backup.Size = size
+	backup.Integrity = IntegrityUnchecked
+	return backup, true
+}
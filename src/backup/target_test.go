@@ -0,0 +1,54 @@
+package backup
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeTarget struct {
+	uploaded []string
+	stored   []Backup
+}
+
+func (f *fakeTarget) String() string { return "fake://backups" }
+
+func (f *fakeTarget) Upload(ctx context.Context, name, localPath string) error {
+	f.uploaded = append(f.uploaded, name)
+	return nil
+}
+
+func (f *fakeTarget) List(ctx context.Context) ([]Backup, error) { return f.stored, nil }
+
+func TestManager_PushAndListAll(t *testing.T) {
+	m := newTestManager(t)
+	created, err := m.Create(OriginManual, false)
+	require.NoError(t, err)
+
+	remoteOnly, _ := remoteBackup("backup-20240101-030000-scheduled.db", 42)
+	target := &fakeTarget{stored: []Backup{remoteOnly, {Name: created.Name}}}
+
+	require.NoError(t, m.Push(context.Background(), created, []Target{target}))
+	require.Equal(t, []string{created.Name}, target.uploaded)
+
+	backups, err := m.ListAll(context.Background(), []Target{target})
+	require.NoError(t, err)
+	require.Len(t, backups, 2)
+	require.Equal(t, created.Name, backups[0].Name)
+	require.Equal(t, []string{LocationLocal, "fake://backups"}, backups[0].Locations)
+	require.Equal(t, []string{"fake://backups"}, backups[1].Locations)
+	require.Equal(t, int64(42), backups[1].Size)
+}
+
+func TestParseTarget(t *testing.T) {
+	target, err := ParseTarget("s3://bucket/some/prefix/")
+	require.NoError(t, err)
+	require.Equal(t, "s3://bucket/some/prefix", target.String())
+
+	_, err = ParseTarget("ftp://host/path")
+	require.Error(t, err)
+
+	_, err = ParseTarget("s3:///prefix")
+	require.Error(t, err)
+}
@@ -0,0 +1,152 @@
+package backup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// Integrity check results.
+const (
+	IntegrityOK        = "ok"
+	IntegrityCorrupt   = "corrupt"
+	IntegrityUnchecked = "unchecked"
+)
+
+// integrityResult is stored next to a backup in a hidden sidecar file so
+// listings do not have to re-check every backup.
+type integrityResult struct {
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Verify checks that a backup can be restored: archives must decompress
+// cleanly and contain a database, and the database must pass SQLite's
+// integrity check. The result is recorded and returned as part of the
+// backup.
+func (m *Manager) Verify(name string) (Backup, error) {
+	if !isBackupName(name) {
+		return Backup{}, fmt.Errorf("invalid backup name: %s", name)
+	}
+	if _, err := os.Stat(m.path(name)); err != nil {
+		return Backup{}, err
+	}
+
+	result := integrityResult{Status: IntegrityOK, CheckedAt: time.Now().UTC()}
+	if err := m.check(name); err != nil {
+		result.Status = IntegrityCorrupt
+		result.Error = err.Error()
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return Backup{}, err
+	}
+	if err := os.WriteFile(m.integrityPath(name), data, 0o644); err != nil {
+		return Backup{}, err
+	}
+
+	return m.stat(name)
+}
+
+func (m *Manager) check(name string) error {
+	if !strings.HasSuffix(name, archiveExt) {
+		return checkDatabase(m.path(name))
+	}
+
+	staging, err := os.MkdirTemp(m.Dir, ".verify-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+
+	// Extracting reads the whole archive, which validates the gzip checksum.
+	if err := extractArchive(m.path(name), staging); err != nil {
+		return err
+	}
+	db := filepath.Join(staging, archiveDBName)
+	if _, err := os.Stat(db); err != nil {
+		return errors.New("backup does not contain a database")
+	}
+	if err := checkManifest(staging); err != nil {
+		return err
+	}
+	return checkDatabase(db)
+}
+
+// checkManifest compares the files extracted to dir with the hashes in the
+// archive's manifest. Archives without a manifest pass.
+func checkManifest(dir string) error {
+	data, err := os.ReadFile(filepath.Join(dir, archiveManifestName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var contents manifest
+	if err := json.Unmarshal(data, &contents); err != nil {
+		return fmt.Errorf("invalid manifest: %w", err)
+	}
+	for name, want := range contents.Files {
+		got, err := hashFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			return fmt.Errorf("missing %s: %w", name, err)
+		}
+		if got != want {
+			return fmt.Errorf("checksum mismatch for %s", name)
+		}
+	}
+	return nil
+}
+
+// checkDatabase runs PRAGMA integrity_check against a SQLite file.
+func checkDatabase(path string) error {
+	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{})
+	if err != nil {
+		return err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	defer sqlDB.Close()
+
+	var result string
+	if err := db.Raw("PRAGMA integrity_check").Scan(&result).Error; err != nil {
+		return err
+	}
+	if result != "ok" {
+		return fmt.Errorf("integrity check failed: %s", result)
+	}
+	return nil
+}
+
+func (m *Manager) integrityPath(name string) string {
+	return filepath.Join(m.Dir, "."+name+".integrity")
+}
+
+// readIntegrity fills in the recorded integrity check result of a backup.
+func (m *Manager) readIntegrity(backup *Backup) {
+	backup.Integrity = IntegrityUnchecked
+
+	data, err := os.ReadFile(m.integrityPath(backup.Name))
+	if err != nil {
+		return
+	}
+	var result integrityResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return
+	}
+	backup.Integrity = result.Status
+	backup.IntegrityError = result.Error
+	backup.VerifiedAt = &result.CheckedAt
+}
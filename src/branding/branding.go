@@ -0,0 +1,185 @@
+// Package branding stores the per-organization look of the server-rendered
+// public pages (share-link landing pages, galleries and password prompts)
+// and renders those pages inside a branded layout.
+package branding
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultKey = "branding"
+	orgKey     = "branding:org:%d"
+
+	maxFooterLength = 500
+)
+
+var colorPattern = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// Branding is the look of the public pages. Empty fields fall back to the
+// instance-wide defaults.
+type Branding struct {
+	LogoURL         string `json:"logo_url"`
+	PrimaryColor    string `json:"primary_color"`
+	BackgroundColor string `json:"background_color"`
+	TextColor       string `json:"text_color"`
+	FooterText      string `json:"footer_text"`
+}
+
+// Default returns the branding used when nothing is configured.
+func Default() Branding {
+	return Branding{
+		PrimaryColor:    "#2563eb",
+		BackgroundColor: "#f8fafc",
+		TextColor:       "#0f172a",
+		FooterText:      "Powered by go-fast-cdn",
+	}
+}
+
+// Validate checks that colors are hex colors and the logo is an http(s) or
+// root-relative URL, so they are safe to embed in the page styles.
+func (b Branding) Validate() error {
+	for name, color := range map[string]string{
+		"primary_color":    b.PrimaryColor,
+		"background_color": b.BackgroundColor,
+		"text_color":       b.TextColor,
+	} {
+		if color != "" && !colorPattern.MatchString(color) {
+			return fmt.Errorf("%s must be a hex color such as #2563eb", name)
+		}
+	}
+	if b.LogoURL != "" {
+		u, err := url.Parse(b.LogoURL)
+		relative := u != nil && u.Scheme == "" && u.Host == "" && strings.HasPrefix(b.LogoURL, "/") && !strings.HasPrefix(b.LogoURL, "//")
+		if err != nil || !(relative || ((u.Scheme == "https" || u.Scheme == "http") && u.Host != "")) {
+			return errors.New("logo_url must be an http(s) URL or a path starting with /")
+		}
+	}
+	if len(b.FooterText) > maxFooterLength {
+		return fmt.Errorf("footer_text must be at most %d characters", maxFooterLength)
+	}
+	return nil
+}
+
+// merge returns b with its empty fields taken from fallback.
+func (b Branding) merge(fallback Branding) Branding {
+	if b.LogoURL == "" {
+		b.LogoURL = fallback.LogoURL
+	}
+	if b.PrimaryColor == "" {
+		b.PrimaryColor = fallback.PrimaryColor
+	}
+	if b.BackgroundColor == "" {
+		b.BackgroundColor = fallback.BackgroundColor
+	}
+	if b.TextColor == "" {
+		b.TextColor = fallback.TextColor
+	}
+	if b.FooterText == "" {
+		b.FooterText = fallback.FooterText
+	}
+	return b
+}
+
+// Store reads branding from the config table and caches it, so rendering a
+// public page does not hit the database.
+type Store struct {
+	repo *database.ConfigRepo
+
+	mu    sync.RWMutex
+	cache map[string]Branding
+}
+
+// NewStore returns a Store backed by repo.
+func NewStore(repo *database.ConfigRepo) *Store {
+	return &Store{repo: repo, cache: map[string]Branding{}}
+}
+
+// Get returns the branding configured for the organization, or the
+// instance-wide branding when orgID is nil, without applying defaults.
+func (s *Store) Get(orgID *uint) (Branding, error) {
+	key := configKey(orgID)
+
+	s.mu.RLock()
+	b, ok := s.cache[key]
+	s.mu.RUnlock()
+	if ok {
+		return b, nil
+	}
+
+	value, err := s.repo.Get(key)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return Branding{}, err
+	}
+	b = Branding{}
+	if value != "" {
+		if err := json.Unmarshal([]byte(value), &b); err != nil {
+			return Branding{}, err
+		}
+	}
+
+	s.mu.Lock()
+	s.cache[key] = b
+	s.mu.Unlock()
+	return b, nil
+}
+
+// Set stores the branding of the organization, or the instance-wide branding
+// when orgID is nil.
+func (s *Store) Set(orgID *uint, b Branding) error {
+	if err := b.Validate(); err != nil {
+		return err
+	}
+	value, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+
+	key := configKey(orgID)
+	if err := s.repo.Set(key, string(value)); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.cache[key] = b
+	s.mu.Unlock()
+	return nil
+}
+
+// Delete removes the branding of the organization, which then uses the
+// instance-wide branding again.
+func (s *Store) Delete(orgID uint) error {
+	return s.Set(&orgID, Branding{})
+}
+
+// Effective returns the branding the pages of the organization are rendered
+// with: its own settings, then the instance-wide ones, then the defaults.
+// Lookup errors fall back to the defaults so public pages keep working.
+func (s *Store) Effective(orgID *uint) Branding {
+	b := Default()
+	if instance, err := s.Get(nil); err == nil {
+		b = instance.merge(b)
+	}
+	if orgID != nil {
+		if org, err := s.Get(orgID); err == nil {
+			b = org.merge(b)
+		}
+	}
+	return b
+}
+
+func configKey(orgID *uint) string {
+	if orgID == nil {
+		return defaultKey
+	}
+	return fmt.Sprintf(orgKey, *orgID)
+}
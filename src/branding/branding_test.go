@@ -0,0 +1,67 @@
+package branding
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_Effective(t *testing.T) {
+	// Arrange
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	store := NewStore(database.NewConfigRepo(database.DB))
+	orgID := uint(3)
+
+	// Act
+	require.NoError(t, store.Set(nil, Branding{FooterText: "Example Inc."}))
+	require.NoError(t, store.Set(&orgID, Branding{PrimaryColor: "#ff0000", LogoURL: "https://example.com/logo.png"}))
+
+	// Assert
+	org := store.Effective(&orgID)
+	require.Equal(t, "#ff0000", org.PrimaryColor)
+	require.Equal(t, "Example Inc.", org.FooterText)
+	require.Equal(t, Default().BackgroundColor, org.BackgroundColor)
+
+	instance := store.Effective(nil)
+	require.Equal(t, Default().PrimaryColor, instance.PrimaryColor)
+	require.Empty(t, instance.LogoURL)
+
+	reloaded := NewStore(database.NewConfigRepo(database.DB)).Effective(&orgID)
+	require.Equal(t, org, reloaded)
+
+	require.NoError(t, store.Delete(orgID))
+	require.Equal(t, instance, store.Effective(&orgID))
+}
+
+func TestBranding_Validate(t *testing.T) {
+	require.NoError(t, Branding{PrimaryColor: "#abc", LogoURL: "/logo.png"}.Validate())
+	require.Error(t, Branding{PrimaryColor: "red;background:url(x)"}.Validate())
+	require.Error(t, Branding{LogoURL: "javascript:alert(1)"}.Validate())
+	require.Error(t, Branding{LogoURL: "//evil.example.com/logo.png"}.Validate())
+}
+
+func TestRender(t *testing.T) {
+	// Arrange
+	tmpl := NewTemplate(`{{define "content"}}<p>{{.Data}}</p>{{end}}`)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	// Act
+	Render(c, http.StatusOK, tmpl, Page{
+		Title:    "Shared file",
+		Branding: Branding{PrimaryColor: "#ff0000", FooterText: "<b>Example</b>"},
+		Data:     "<script>",
+	})
+
+	// Assert
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), "#ff0000")
+	require.Contains(t, w.Body.String(), "&lt;b&gt;Example&lt;/b&gt;")
+	require.Contains(t, w.Body.String(), "<p>&lt;script&gt;</p>")
+}
@@ -0,0 +1,41 @@
+package branding
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+//go:embed templates/layout.html
+var templates embed.FS
+
+var layout = template.Must(template.ParseFS(templates, "templates/layout.html"))
+
+// Page is the data passed to a page template. Data holds the page specific
+// values.
+type Page struct {
+	Title    string
+	Branding Branding
+	Data     any
+}
+
+// NewTemplate parses a page that is rendered inside the branded layout. The
+// page must define a "content" template.
+func NewTemplate(content string) *template.Template {
+	return template.Must(template.Must(layout.Clone()).Parse(content))
+}
+
+// Render writes the page to the response with the given status.
+func Render(c *gin.Context, status int, tmpl *template.Template, page Page) {
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, "layout.html", page); err != nil {
+		log.Printf("Failed to render %s: %s", page.Title, err.Error())
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.Data(status, "text/html; charset=utf-8", buf.Bytes())
+}
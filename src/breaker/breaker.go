@@ -0,0 +1,298 @@
+// Package breaker guards calls to external services, e.g. the document
+// converter, alert webhooks and S3, with circuit breakers. Failed calls are
+// retried with exponential backoff; once a service failed too many times in
+// a row its breaker opens and calls fail at once with ErrOpen, instead of
+// waiting for timeouts, until a probe call after a cooldown succeeds.
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// States of a breaker.
+const (
+	StateClosed   = "closed"
+	StateOpen     = "open"
+	StateHalfOpen = "half-open"
+)
+
+const (
+	defaultThreshold = 5
+	defaultCooldown  = 30 * time.Second
+	defaultRetries   = 2
+	defaultBackoff   = 200 * time.Millisecond
+)
+
+// ErrOpen is returned by calls rejected by an open breaker.
+var ErrOpen = errors.New("circuit breaker is open")
+
+// Policy tells when breakers open and how calls are retried.
+type Policy struct {
+	// Threshold is the number of failed calls in a row opening a breaker.
+	Threshold int
+	// Cooldown is how long an open breaker rejects calls before it lets one
+	// through to probe the service.
+	Cooldown time.Duration
+	// Retries is how often failed calls are retried, waiting Backoff before
+	// the first retry and twice as long before every further one.
+	Retries int
+	Backoff time.Duration
+}
+
+var (
+	mu       sync.Mutex
+	policy   = Policy{Threshold: defaultThreshold, Cooldown: defaultCooldown, Retries: defaultRetries, Backoff: defaultBackoff}
+	breakers = map[string]*Breaker{}
+)
+
+// Start reads the policy of all breakers from BREAKER_FAILURE_THRESHOLD (5
+// by default), BREAKER_COOLDOWN seconds (30), BREAKER_RETRIES (2) and
+// BREAKER_BACKOFF milliseconds (200). A threshold of 0 keeps breakers
+// closed.
+func Start() error {
+	p := Policy{Threshold: defaultThreshold, Cooldown: defaultCooldown, Retries: defaultRetries, Backoff: defaultBackoff}
+	for _, v := range []struct {
+		name string
+		set  func(n int)
+	}{
+		{"BREAKER_FAILURE_THRESHOLD", func(n int) { p.Threshold = n }},
+		{"BREAKER_COOLDOWN", func(n int) { p.Cooldown = time.Duration(n) * time.Second }},
+		{"BREAKER_RETRIES", func(n int) { p.Retries = n }},
+		{"BREAKER_BACKOFF", func(n int) { p.Backoff = time.Duration(n) * time.Millisecond }},
+	} {
+		value := os.Getenv(v.name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid %s %q", v.name, value)
+		}
+		v.set(n)
+	}
+	SetPolicy(p)
+	return nil
+}
+
+// SetPolicy changes the policy of all breakers.
+func SetPolicy(p Policy) {
+	mu.Lock()
+	defer mu.Unlock()
+	policy = p
+}
+
+func currentPolicy() Policy {
+	mu.Lock()
+	defer mu.Unlock()
+	return policy
+}
+
+// Breaker guards the calls to one service.
+type Breaker struct {
+	name string
+
+	mu          sync.Mutex
+	state       string
+	failures    int
+	openedAt    time.Time
+	probing     bool
+	lastError   string
+	calls       int64
+	rejected    int64
+	failed      int64
+	lastChanged time.Time
+}
+
+// Get returns the breaker of the service name, creating it on first use.
+func Get(name string) *Breaker {
+	mu.Lock()
+	defer mu.Unlock()
+	b, ok := breakers[name]
+	if !ok {
+		b = &Breaker{name: name, state: StateClosed}
+		breakers[name] = b
+	}
+	return b
+}
+
+// permanent marks errors that are not retried and do not count as failures
+// of the service, e.g. a missing file or a rejected request.
+type permanent struct {
+	err error
+}
+
+func (p permanent) Error() string { return p.err.Error() }
+func (p permanent) Unwrap() error { return p.err }
+
+// Permanent wraps err so Do returns it without retrying, as the service
+// answered but the call cannot succeed. Do unwraps it again.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanent{err: err}
+}
+
+// Do calls fn, retrying it with backoff while it fails, unless the breaker
+// is open. It returns ErrOpen, wrapped with the name of the service and the
+// last failure, without calling fn while the breaker is open.
+func (b *Breaker) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	p := currentPolicy()
+	return b.do(ctx, p, p.Retries, fn)
+}
+
+// Try is Do without retries, for clients retrying on their own such as the
+// S3 client.
+func (b *Breaker) Try(ctx context.Context, fn func(ctx context.Context) error) error {
+	return b.do(ctx, currentPolicy(), 0, fn)
+}
+
+func (b *Breaker) do(ctx context.Context, p Policy, retries int, fn func(ctx context.Context) error) error {
+	delay := p.Backoff
+	for attempt := 0; ; attempt++ {
+		if err := b.allow(p); err != nil {
+			return err
+		}
+		err := fn(ctx)
+		var perm permanent
+		if errors.As(err, &perm) {
+			b.record(p, nil)
+			return perm.err
+		}
+		if err != nil && ctx.Err() != nil {
+			// The caller gave up, which says nothing about the service
+			b.abandon()
+			return err
+		}
+		b.record(p, err)
+		if err == nil || attempt >= retries {
+			return err
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		delay *= 2
+	}
+}
+
+// allow reports whether a call may go through, letting a single probe call
+// through once the cooldown of an open breaker passed.
+func (b *Breaker) allow(p Policy) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.calls++
+	switch b.state {
+	case StateOpen:
+		if time.Since(b.openedAt) < p.Cooldown {
+			break
+		}
+		b.setState(StateHalfOpen)
+		fallthrough
+	case StateHalfOpen:
+		if b.probing {
+			break
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+	b.rejected++
+	return fmt.Errorf("%s: %w after %s", b.name, ErrOpen, b.lastError)
+}
+
+func (b *Breaker) record(p Policy, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if err == nil {
+		b.failures = 0
+		if b.state != StateClosed {
+			log.Printf("Circuit breaker of %s closed", b.name)
+			b.setState(StateClosed)
+		}
+		return
+	}
+
+	b.failed++
+	b.failures++
+	b.lastError = err.Error()
+	if b.state == StateHalfOpen || (b.state == StateClosed && p.Threshold > 0 && b.failures >= p.Threshold) {
+		if b.state == StateClosed {
+			log.Printf("[ERROR] Circuit breaker of %s opened after %d failures: %v", b.name, b.failures, err)
+		}
+		b.openedAt = time.Now()
+		b.setState(StateOpen)
+	}
+}
+
+func (b *Breaker) abandon() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+func (b *Breaker) setState(state string) {
+	b.state = state
+	b.lastChanged = time.Now()
+}
+
+// Stats describes a breaker.
+type Stats struct {
+	Name  string `json:"name"`
+	State string `json:"state"`
+	// Failures is the number of failed calls in a row.
+	Failures  int    `json:"failures"`
+	LastError string `json:"last_error,omitempty"`
+	// Calls counts the calls, retries included, of which Failed failed
+	// and Rejected were refused by the open breaker.
+	Calls       int64      `json:"calls"`
+	Failed      int64      `json:"failed"`
+	Rejected    int64      `json:"rejected"`
+	LastChanged *time.Time `json:"last_changed,omitempty"`
+}
+
+// Stats returns the state of the breaker.
+func (b *Breaker) Stats() Stats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := Stats{
+		Name: b.name, State: b.state, Failures: b.failures, LastError: b.lastError,
+		Calls: b.calls, Failed: b.failed, Rejected: b.rejected,
+	}
+	if !b.lastChanged.IsZero() {
+		changed := b.lastChanged
+		s.LastChanged = &changed
+	}
+	return s
+}
+
+// All returns the state of every breaker, by name.
+func All() []Stats {
+	mu.Lock()
+	all := make([]*Breaker, 0, len(breakers))
+	for _, b := range breakers {
+		all = append(all, b)
+	}
+	mu.Unlock()
+
+	stats := make([]Stats, 0, len(all))
+	for _, b := range all {
+		stats = append(stats, b.Stats())
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats
+}
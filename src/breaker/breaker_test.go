@@ -0,0 +1,66 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBreaker(t *testing.T) {
+	// Arrange
+	SetPolicy(Policy{Threshold: 3, Cooldown: 50 * time.Millisecond, Retries: 1, Backoff: time.Millisecond})
+	t.Cleanup(func() {
+		SetPolicy(Policy{Threshold: defaultThreshold, Cooldown: defaultCooldown, Retries: defaultRetries, Backoff: defaultBackoff})
+	})
+	b := Get("test")
+	ctx := context.Background()
+	down := errors.New("connection refused")
+	calls := 0
+	failing := func(ctx context.Context) error {
+		calls++
+		return down
+	}
+
+	// Act & Assert
+	require.ErrorIs(t, b.Do(ctx, failing), down)
+	require.Equal(t, 2, calls, "failed calls are retried")
+	require.Equal(t, StateClosed, b.Stats().State)
+
+	require.ErrorIs(t, b.Do(ctx, failing), ErrOpen, "the third failure opens the breaker")
+	require.Equal(t, 3, calls)
+	require.ErrorIs(t, b.Do(ctx, failing), ErrOpen)
+	require.Equal(t, 3, calls, "open breakers do not call the service")
+	stats := b.Stats()
+	require.Equal(t, StateOpen, stats.State)
+	require.Equal(t, "connection refused", stats.LastError)
+	require.Equal(t, int64(2), stats.Rejected)
+
+	time.Sleep(60 * time.Millisecond)
+	require.ErrorIs(t, b.Do(ctx, failing), ErrOpen, "a failed probe opens the breaker again")
+	require.Equal(t, 4, calls)
+
+	time.Sleep(60 * time.Millisecond)
+	require.NoError(t, b.Do(ctx, func(ctx context.Context) error { return nil }))
+	require.Equal(t, StateClosed, b.Stats().State, "a successful probe closes the breaker")
+	require.Zero(t, b.Stats().Failures)
+
+	calls = 0
+	err := b.Do(ctx, func(ctx context.Context) error {
+		calls++
+		return Permanent(fs.ErrNotExist)
+	})
+	require.ErrorIs(t, err, fs.ErrNotExist)
+	require.Equal(t, 1, calls, "permanent errors are not retried")
+	require.Zero(t, b.Stats().Failures, "nor counted as failures")
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	require.ErrorIs(t, b.Try(canceled, func(ctx context.Context) error { return ctx.Err() }), context.Canceled)
+	require.Zero(t, b.Stats().Failures, "calls the caller gave up on do not count")
+
+	require.Equal(t, []Stats{b.Stats()}, All())
+}
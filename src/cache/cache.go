@@ -0,0 +1,177 @@
+// Package cache keeps small, frequently downloaded files in memory, and
+// optionally in Redis, so downloads do not hit the disk.
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+)
+
+const (
+	defaultMemorySize  = 64 << 20
+	defaultMaxFileSize = 1 << 20
+	defaultRedisTTL    = time.Hour
+)
+
+// Entry is a cached file.
+type Entry struct {
+	ModTime time.Time
+	Body    []byte
+}
+
+// Store holds cached files by key.
+type Store interface {
+	Get(key string) (Entry, bool)
+	Set(key string, entry Entry)
+	Delete(key string)
+	Purge()
+}
+
+var (
+	store       Store
+	maxFileSize int64
+)
+
+// Init enables the cache. Files larger than maxSize bytes are never cached.
+// Passing a nil store disables it.
+func Init(s Store, maxSize int64) {
+	store = s
+	maxFileSize = maxSize
+}
+
+// Start enables the cache as configured in the environment.
+// CACHE_MEMORY_SIZE is the memory budget in megabytes (default 64) and
+// CACHE_MAX_FILE_SIZE the size in kilobytes up to which files are cached
+// (default 1024). CACHE_REDIS_URL adds a Redis server shared between
+// instances, where files are kept for CACHE_REDIS_TTL seconds (default
+// 3600). The cache is disabled when neither memory nor Redis is configured.
+func Start() error {
+	memorySize, err := envInt("CACHE_MEMORY_SIZE", defaultMemorySize>>20)
+	if err != nil {
+		return err
+	}
+	maxSize, err := envInt("CACHE_MAX_FILE_SIZE", defaultMaxFileSize>>10)
+	if err != nil {
+		return err
+	}
+	ttl, err := envInt("CACHE_REDIS_TTL", int(defaultRedisTTL/time.Second))
+	if err != nil {
+		return err
+	}
+
+	var memory *Memory
+	if memorySize > 0 {
+		memory = NewMemory(int64(memorySize) << 20)
+	}
+
+	if redisURL := os.Getenv("CACHE_REDIS_URL"); redisURL != "" {
+		redisStore, err := NewRedis(redisURL, memory, time.Duration(ttl)*time.Second)
+		if err != nil {
+			return err
+		}
+		Init(redisStore, int64(maxSize)<<10)
+		log.Printf("Caching downloads up to %d KB in Redis", maxSize)
+		return nil
+	}
+
+	if memory == nil {
+		return nil
+	}
+	Init(memory, int64(maxSize)<<10)
+	log.Printf("Caching downloads up to %d KB in %d MB of memory", maxSize, memorySize)
+	return nil
+}
+
+func envInt(name string, fallback int) (int, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback, nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < 0 {
+		return 0, fmt.Errorf("invalid %s %q", name, value)
+	}
+	return parsed, nil
+}
+
+// Key returns the cache key of a media file.
+func Key(mediaType, fileName string) string {
+	return mediaType + "/" + fileName
+}
+
+// Invalidate drops a media file from the cache. It must be called whenever
+// a file is deleted, renamed or modified.
+func Invalidate(mediaType, fileName string) {
+	if store != nil {
+		store.Delete(Key(mediaType, fileName))
+	}
+}
+
+// Purge drops every cached file.
+func Purge() {
+	if store != nil {
+		store.Purge()
+	}
+}
+
+// Middleware serves downloads of mediaType from the cache. Cached entries
+// are checked against the modification time and size of the file on disk,
+// so files changed behind the cache's back are never served stale. Large
+// files and requests the cache cannot answer fall through to the next
+// handler.
+func Middleware(mediaType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s := store
+		if s == nil || (c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead) {
+			c.Next()
+			return
+		}
+
+		fileName, err := util.FilterFilename(path.Base(c.Request.URL.Path))
+		if err != nil {
+			c.Next()
+			return
+		}
+		key := Key(mediaType, fileName)
+		filePath := filepath.Join(util.ExPath, "uploads", models.MediaFolder(mediaType), fileName)
+
+		info, err := os.Stat(filePath)
+		if errors.Is(err, fs.ErrNotExist) {
+			s.Delete(key)
+		}
+		if err != nil || info.IsDir() || info.Size() > maxFileSize {
+			c.Next()
+			return
+		}
+
+		status := "HIT"
+		entry, ok := s.Get(key)
+		if !ok || !entry.ModTime.Equal(info.ModTime()) || int64(len(entry.Body)) != info.Size() {
+			body, err := os.ReadFile(filePath)
+			if err != nil {
+				c.Next()
+				return
+			}
+			entry = Entry{ModTime: info.ModTime(), Body: body}
+			s.Set(key, entry)
+			status = "MISS"
+		}
+
+		c.Header("X-Cache", status)
+		http.ServeContent(c.Writer, c.Request, fileName, entry.ModTime, bytes.NewReader(entry.Body))
+		c.Abort()
+	}
+}
@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemory_EvictsLeastRecentlyUsed(t *testing.T) {
+	m := NewMemory(10)
+	m.Set("a", Entry{Body: []byte("1234")})
+	m.Set("b", Entry{Body: []byte("1234")})
+	_, ok := m.Get("a")
+	require.True(t, ok)
+
+	m.Set("c", Entry{Body: []byte("1234")})
+	_, ok = m.Get("b")
+	require.False(t, ok)
+	_, ok = m.Get("a")
+	require.True(t, ok)
+	require.Equal(t, int64(8), m.Size())
+
+	// Files larger than the cache are not stored
+	m.Set("d", Entry{Body: make([]byte, 11)})
+	_, ok = m.Get("d")
+	require.False(t, ok)
+
+	m.Delete("a")
+	require.Equal(t, int64(4), m.Size())
+	m.Purge()
+	require.Zero(t, m.Size())
+}
+
+func TestMiddleware(t *testing.T) {
+	util.ExPath = t.TempDir()
+	docDir := filepath.Join(util.ExPath, "uploads", "docs")
+	require.NoError(t, os.MkdirAll(docDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(docDir, "small.txt"), []byte("hello"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(docDir, "large.txt"), make([]byte, 100), 0o644))
+
+	memory := NewMemory(1 << 20)
+	Init(memory, 10)
+	defer Init(nil, 0)
+
+	router := gin.New()
+	router.Group("/download/docs", Middleware(models.MediaTypeDoc)).Static("/", docDir)
+	get := func(name string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/download/docs/"+name, nil))
+		return w
+	}
+
+	w := get("small.txt")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "MISS", w.Header().Get("X-Cache"))
+	require.Equal(t, "hello", w.Body.String())
+
+	w = get("small.txt")
+	require.Equal(t, "HIT", w.Header().Get("X-Cache"))
+	require.Equal(t, "hello", w.Body.String())
+
+	w = get("large.txt")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Empty(t, w.Header().Get("X-Cache"))
+	require.Len(t, w.Body.Bytes(), 100)
+
+	// Files changed on disk are read again
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.WriteFile(filepath.Join(docDir, "small.txt"), []byte("world"), 0o644))
+	require.NoError(t, os.Chtimes(filepath.Join(docDir, "small.txt"), later, later))
+	w = get("small.txt")
+	require.Equal(t, "MISS", w.Header().Get("X-Cache"))
+	require.Equal(t, "world", w.Body.String())
+
+	Invalidate(models.MediaTypeDoc, "small.txt")
+	_, ok := memory.Get(Key(models.MediaTypeDoc, "small.txt"))
+	require.False(t, ok)
+
+	require.NoError(t, os.Remove(filepath.Join(docDir, "small.txt")))
+	require.Equal(t, http.StatusNotFound, get("small.txt").Code)
+}
+
+func TestEncodeEntry(t *testing.T) {
+	entry := Entry{ModTime: time.Unix(1700000000, 123), Body: []byte("data")}
+	decoded, ok := decodeEntry(encodeEntry(entry))
+	require.True(t, ok)
+	require.True(t, entry.ModTime.Equal(decoded.ModTime))
+	require.Equal(t, entry.Body, decoded.Body)
+
+	_, ok = decodeEntry([]byte("short"))
+	require.False(t, ok)
+}
@@ -0,0 +1,92 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Memory is an in-memory Store that evicts the least recently used files
+// once the cached files exceed its size.
+type Memory struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	order    *list.List
+	items    map[string]*list.Element
+}
+
+type memoryItem struct {
+	key   string
+	entry Entry
+}
+
+// NewMemory returns a cache holding up to maxBytes of files.
+func NewMemory(maxBytes int64) *Memory {
+	return &Memory{
+		maxBytes: maxBytes,
+		order:    list.New(),
+		items:    map[string]*list.Element{},
+	}
+}
+
+func (m *Memory) Get(key string) (Entry, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	elem, ok := m.items[key]
+	if !ok {
+		return Entry{}, false
+	}
+	m.order.MoveToFront(elem)
+	return elem.Value.(*memoryItem).entry, true
+}
+
+func (m *Memory) Set(key string, entry Entry) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.remove(key)
+	if int64(len(entry.Body)) > m.maxBytes {
+		return
+	}
+	m.items[key] = m.order.PushFront(&memoryItem{key: key, entry: entry})
+	m.size += int64(len(entry.Body))
+
+	for m.size > m.maxBytes {
+		m.remove(m.order.Back().Value.(*memoryItem).key)
+	}
+}
+
+func (m *Memory) Delete(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.remove(key)
+}
+
+func (m *Memory) Purge() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.order.Init()
+	m.items = map[string]*list.Element{}
+	m.size = 0
+}
+
+// Size returns the number of bytes of cached files.
+func (m *Memory) Size() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.size
+}
+
+func (m *Memory) remove(key string) {
+	elem, ok := m.items[key]
+	if !ok {
+		return
+	}
+	m.order.Remove(elem)
+	delete(m.items, key)
+	m.size -= int64(len(elem.Value.(*memoryItem).entry.Body))
+}
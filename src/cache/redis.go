@@ -0,0 +1,143 @@
+package cache
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	redisKeyPrefix = "gfc:cache:"
+	// redisChannel carries invalidated keys to every instance so they drop
+	// their in-memory copies. "*" purges everything.
+	redisChannel = "gfc:cache:invalidate"
+	redisTimeout = time.Second
+)
+
+// Redis is a Store shared between instances. An optional Memory store in
+// front of it keeps the hottest files local; invalidations are broadcast
+// so every instance drops its local copy.
+type Redis struct {
+	client *redis.Client
+	local  *Memory
+	ttl    time.Duration
+}
+
+// NewRedis connects to the Redis server at url, e.g.
+// redis://:password@localhost:6379/0. local may be nil.
+func NewRedis(url string, local *Memory, ttl time.Duration) (*Redis, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	client := redis.NewClient(opts)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	r := &Redis{client: client, local: local, ttl: ttl}
+	if local != nil {
+		go r.listen()
+	}
+	return r, nil
+}
+
+// listen applies invalidations published by any instance to the local store.
+func (r *Redis) listen() {
+	for msg := range r.client.Subscribe(context.Background(), redisChannel).Channel() {
+		if msg.Payload == "*" {
+			r.local.Purge()
+		} else {
+			r.local.Delete(msg.Payload)
+		}
+	}
+}
+
+func (r *Redis) Get(key string) (Entry, bool) {
+	if r.local != nil {
+		if entry, ok := r.local.Get(key); ok {
+			return entry, true
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	data, err := r.client.Get(ctx, redisKeyPrefix+key).Bytes()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			log.Printf("Failed to read %s from the Redis cache: %s", key, err.Error())
+		}
+		return Entry{}, false
+	}
+	entry, ok := decodeEntry(data)
+	if ok && r.local != nil {
+		r.local.Set(key, entry)
+	}
+	return entry, ok
+}
+
+func (r *Redis) Set(key string, entry Entry) {
+	if r.local != nil {
+		r.local.Set(key, entry)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := r.client.Set(ctx, redisKeyPrefix+key, encodeEntry(entry), r.ttl).Err(); err != nil {
+		log.Printf("Failed to write %s to the Redis cache: %s", key, err.Error())
+	}
+}
+
+func (r *Redis) Delete(key string) {
+	if r.local != nil {
+		r.local.Delete(key)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := r.client.Del(ctx, redisKeyPrefix+key).Err(); err != nil {
+		log.Printf("Failed to delete %s from the Redis cache: %s", key, err.Error())
+	}
+	r.client.Publish(ctx, redisChannel, key)
+}
+
+func (r *Redis) Purge() {
+	if r.local != nil {
+		r.local.Purge()
+	}
+
+	ctx := context.Background()
+	iter := r.client.Scan(ctx, 0, redisKeyPrefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		r.client.Del(ctx, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		log.Printf("Failed to purge the Redis cache: %s", err.Error())
+	}
+	r.client.Publish(ctx, redisChannel, "*")
+}
+
+// encodeEntry stores the modification time in front of the file contents.
+func encodeEntry(entry Entry) []byte {
+	data := make([]byte, 8, 8+len(entry.Body))
+	binary.BigEndian.PutUint64(data, uint64(entry.ModTime.UnixNano()))
+	return append(data, entry.Body...)
+}
+
+func decodeEntry(data []byte) (Entry, bool) {
+	if len(data) < 8 {
+		return Entry{}, false
+	}
+	return Entry{
+		ModTime: time.Unix(0, int64(binary.BigEndian.Uint64(data))),
+		Body:    data[8:],
+	}, true
+}
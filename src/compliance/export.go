@@ -0,0 +1,489 @@
+// Package compliance produces export bundles of everything stored about an
+// organization or a user, for legal discovery requests. A bundle is a zip
+// archive holding the files, their metadata, the audit trail and the access
+// records of the subject, plus a manifest with the SHA-256 of every entry.
+package compliance
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"gorm.io/gorm"
+)
+
+// Folder is the folder, relative to the data directory, bundles are written
+// to.
+const Folder = "exports"
+
+// Subjects an export can be produced for.
+const (
+	SubjectOrganization = "organization"
+	SubjectUser         = "user"
+)
+
+// Job states.
+const (
+	StatusRunning = "running"
+	StatusDone    = "done"
+	StatusFailed  = "failed"
+)
+
+var (
+	ErrSubjectNotFound = errors.New("export subject not found")
+	ErrJobNotFound     = errors.New("export not found")
+	ErrJobNotDone      = errors.New("export is not finished")
+)
+
+// Job describes an export and its progress. Done and Total count the entries
+// of the bundle.
+type Job struct {
+	ID          string     `json:"id"`
+	Subject     string     `json:"subject"`
+	SubjectID   uint       `json:"subject_id"`
+	RequestedBy string     `json:"requested_by"`
+	Status      string     `json:"status"`
+	Done        int        `json:"done"`
+	Total       int        `json:"total"`
+	Error       string     `json:"error,omitempty"`
+	Size        int64      `json:"size,omitempty"`
+	SHA256      string     `json:"sha256,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	FinishedAt  *time.Time `json:"finished_at"`
+}
+
+// Exporter runs exports in the background and keeps the bundles in Dir.
+// Finished jobs are stored next to their bundle so they survive restarts.
+type Exporter struct {
+	DB         *gorm.DB
+	UploadsDir string
+	Dir        string
+
+	mu   sync.Mutex
+	jobs map[string]*Job
+}
+
+// NewExporter returns an Exporter reading the files in uploadsDir and
+// writing bundles to the exports folder of dataDir.
+func NewExporter(db *gorm.DB, dataDir, uploadsDir string) *Exporter {
+	e := &Exporter{
+		DB:         db,
+		UploadsDir: uploadsDir,
+		Dir:        filepath.Join(dataDir, Folder),
+		jobs:       map[string]*Job{},
+	}
+	e.load()
+	return e
+}
+
+// NewDefaultExporter returns an Exporter for the application database that
+// keeps its bundles next to the database file.
+func NewDefaultExporter() *Exporter {
+	return NewExporter(
+		database.DB,
+		filepath.Join(util.ExPath, database.DbFolder),
+		filepath.Join(util.ExPath, "uploads"),
+	)
+}
+
+// load restores the finished jobs from disk.
+func (e *Exporter) load() {
+	paths, _ := filepath.Glob(filepath.Join(e.Dir, "*.json"))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var job Job
+		if err := json.Unmarshal(data, &job); err != nil || job.ID == "" {
+			log.Printf("Ignoring invalid export job %s", path)
+			continue
+		}
+		e.jobs[job.ID] = &job
+	}
+}
+
+// Start validates the subject and begins exporting it in the background.
+func (e *Exporter) Start(subject string, subjectID uint, requestedBy string) (Job, error) {
+	var err error
+	switch subject {
+	case SubjectOrganization:
+		err = e.DB.First(&models.Organization{}, subjectID).Error
+	case SubjectUser:
+		err = e.DB.First(&models.User{}, subjectID).Error
+	default:
+		return Job{}, fmt.Errorf("unknown export subject %q", subject)
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return Job{}, ErrSubjectNotFound
+	} else if err != nil {
+		return Job{}, err
+	}
+
+	if err := os.MkdirAll(e.Dir, 0o755); err != nil {
+		return Job{}, err
+	}
+
+	job := &Job{
+		ID:          uuid.NewString(),
+		Subject:     subject,
+		SubjectID:   subjectID,
+		RequestedBy: requestedBy,
+		Status:      StatusRunning,
+		CreatedAt:   time.Now(),
+	}
+	e.mu.Lock()
+	e.jobs[job.ID] = job
+	e.mu.Unlock()
+
+	go e.run(job)
+	return *job, nil
+}
+
+// Get returns the job with the given ID.
+func (e *Exporter) Get(id string) (Job, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	job, ok := e.jobs[id]
+	if !ok {
+		return Job{}, ErrJobNotFound
+	}
+	return *job, nil
+}
+
+// List returns every job, newest first.
+func (e *Exporter) List() []Job {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	jobs := make([]Job, 0, len(e.jobs))
+	for _, job := range e.jobs {
+		jobs = append(jobs, *job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.After(jobs[j].CreatedAt)
+	})
+	return jobs
+}
+
+// BundlePath returns the location of the bundle of a finished job.
+func (e *Exporter) BundlePath(id string) (string, error) {
+	job, err := e.Get(id)
+	if err != nil {
+		return "", err
+	}
+	if job.Status != StatusDone {
+		return "", ErrJobNotDone
+	}
+	return e.bundlePath(id), nil
+}
+
+// Delete removes a finished or failed job and its bundle.
+func (e *Exporter) Delete(id string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	job, ok := e.jobs[id]
+	if !ok {
+		return ErrJobNotFound
+	}
+	if job.Status == StatusRunning {
+		return ErrJobNotDone
+	}
+	for _, path := range []string{e.bundlePath(id), e.jobPath(id)} {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	delete(e.jobs, id)
+	return nil
+}
+
+func (e *Exporter) bundlePath(id string) string {
+	return filepath.Join(e.Dir, id+".zip")
+}
+
+func (e *Exporter) jobPath(id string) string {
+	return filepath.Join(e.Dir, id+".json")
+}
+
+// update changes the job while holding the lock.
+func (e *Exporter) update(job *Job, change func(job *Job)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	change(job)
+}
+
+func (e *Exporter) run(job *Job) {
+	size, sum, err := e.write(job)
+
+	e.update(job, func(job *Job) {
+		now := time.Now()
+		job.FinishedAt = &now
+		if err != nil {
+			job.Status = StatusFailed
+			job.Error = err.Error()
+			return
+		}
+		job.Status = StatusDone
+		job.Size = size
+		job.SHA256 = sum
+	})
+	if err != nil {
+		log.Printf("Export %s of %s %d failed: %s", job.ID, job.Subject, job.SubjectID, err.Error())
+		os.Remove(e.bundlePath(job.ID))
+	}
+
+	done, _ := e.Get(job.ID)
+	data, _ := json.MarshalIndent(done, "", "  ")
+	if err := os.WriteFile(e.jobPath(job.ID), data, 0o644); err != nil {
+		log.Printf("Failed to store export job %s: %s", job.ID, err.Error())
+	}
+}
+
+// write collects the contents of the bundle and writes it, returning its size
+// and SHA-256.
+func (e *Exporter) write(job *Job) (int64, string, error) {
+	var contents *bundle
+	var err error
+	if job.Subject == SubjectOrganization {
+		contents, err = e.collectOrganization(job.SubjectID)
+	} else {
+		contents, err = e.collectUser(job.SubjectID)
+	}
+	if err != nil {
+		return 0, "", err
+	}
+	e.update(job, func(job *Job) {
+		job.Total = len(contents.records) + len(contents.files) + 1
+	})
+
+	tmp := e.bundlePath(job.ID) + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return 0, "", err
+	}
+	defer os.Remove(tmp)
+
+	hash := sha256.New()
+	zw := zip.NewWriter(io.MultiWriter(f, hash))
+	manifest := manifest{
+		Subject:     job.Subject,
+		SubjectID:   job.SubjectID,
+		RequestedBy: job.RequestedBy,
+		GeneratedAt: time.Now().UTC(),
+		Notes:       contents.notes,
+		Entries:     []manifestEntry{},
+	}
+	progress := func() {
+		e.update(job, func(job *Job) { job.Done++ })
+	}
+
+	for _, record := range contents.records {
+		data, err := json.MarshalIndent(record.value, "", "  ")
+		if err != nil {
+			f.Close()
+			return 0, "", err
+		}
+		entry, err := writeEntry(zw, record.name, bytes.NewReader(data))
+		if err != nil {
+			f.Close()
+			return 0, "", err
+		}
+		manifest.Entries = append(manifest.Entries, entry)
+		progress()
+	}
+	for _, file := range contents.files {
+		entry, err := writeFile(zw, file.name, file.path)
+		if errors.Is(err, os.ErrNotExist) {
+			manifest.Missing = append(manifest.Missing, file.name)
+			progress()
+			continue
+		}
+		if err != nil {
+			f.Close()
+			return 0, "", err
+		}
+		manifest.Entries = append(manifest.Entries, entry)
+		progress()
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err == nil {
+		_, err = writeEntry(zw, "manifest.json", bytes.NewReader(data))
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, "", err
+	}
+	progress()
+
+	info, err := os.Stat(tmp)
+	if err != nil {
+		return 0, "", err
+	}
+	if err := os.Rename(tmp, e.bundlePath(job.ID)); err != nil {
+		return 0, "", err
+	}
+	return info.Size(), hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// bundle lists the contents of an export.
+type bundle struct {
+	records []record
+	files   []bundleFile
+	notes   []string
+}
+
+// record is a JSON document of the bundle.
+type record struct {
+	name  string
+	value any
+}
+
+// bundleFile is an uploaded file copied into the bundle.
+type bundleFile struct {
+	name string
+	path string
+}
+
+func (b *bundle) addRecord(name string, value any) {
+	b.records = append(b.records, record{name: name, value: value})
+}
+
+func (b *bundle) addMedia(uploadsDir, mediaType, fileName string) {
+	folder := models.MediaFolder(mediaType)
+	b.files = append(b.files, bundleFile{
+		name: "files/" + folder + "/" + fileName,
+		path: filepath.Join(uploadsDir, folder, fileName),
+	})
+}
+
+// collectOrganization gathers the media owned by the organization, the share
+// links and service accounts of the organization, the audit entries about
+// them and the API keys used to access it.
+func (e *Exporter) collectOrganization(id uint) (*bundle, error) {
+	b := &bundle{}
+
+	var org models.Organization
+	if err := e.DB.First(&org, id).Error; err != nil {
+		return nil, err
+	}
+	b.addRecord("subject.json", org)
+
+	var images []models.Image
+	var docs []models.Doc
+	var links []models.ShareLink
+	var accounts []models.ServiceAccount
+	err := errors.Join(
+		e.DB.Where("organization_id = ?", id).Find(&images).Error,
+		e.DB.Where("organization_id = ?", id).Find(&docs).Error,
+		e.DB.Preload("Files").Where("organization_id = ?", id).Find(&links).Error,
+		e.DB.Where("organization_id = ?", id).Find(&accounts).Error,
+	)
+	if err != nil {
+		return nil, err
+	}
+	b.addRecord("metadata/images.json", images)
+	b.addRecord("metadata/docs.json", docs)
+	b.addRecord("metadata/share_links.json", links)
+	b.addRecord("metadata/service_accounts.json", accounts)
+
+	targets := []string{"org:" + strconv.FormatUint(uint64(id), 10)}
+	for _, image := range images {
+		targets = append(targets, models.MediaTypeImage+"/"+image.FileName)
+		b.addMedia(e.UploadsDir, models.MediaTypeImage, image.FileName)
+	}
+	for _, doc := range docs {
+		targets = append(targets, models.MediaTypeDoc+"/"+doc.FileName)
+		b.addMedia(e.UploadsDir, models.MediaTypeDoc, doc.FileName)
+	}
+	actors := []string{}
+	accountIDs := []uint{}
+	for _, account := range accounts {
+		targets = append(targets, account.Name)
+		actors = append(actors, "service-account:"+account.Name)
+		accountIDs = append(accountIDs, account.ID)
+	}
+
+	var entries []models.AuditLog
+	err = e.DB.Where("target IN ? OR actor_email IN ?", targets, actors).Order("created_at").Find(&entries).Error
+	if err != nil {
+		return nil, err
+	}
+	b.addRecord("audit/audit_log.json", entries)
+
+	var keys []models.APIKey
+	if err := e.DB.Where("service_account_id IN ?", accountIDs).Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	b.addRecord("access/api_keys.json", keys)
+
+	return b, nil
+}
+
+// collectUser gathers the account of the user, the audit entries they caused
+// or that concern them, their sessions and the files they shared. Uploads are
+// not attributed to users, so only shared files can be included.
+func (e *Exporter) collectUser(id uint) (*bundle, error) {
+	b := &bundle{notes: []string{"Uploads are not attributed to users; files contains the files shared by the user."}}
+
+	var user models.User
+	if err := e.DB.First(&user, id).Error; err != nil {
+		return nil, err
+	}
+	b.addRecord("subject.json", user)
+
+	var links []models.ShareLink
+	var entries []models.AuditLog
+	var sessions []models.UserSession
+	err := errors.Join(
+		e.DB.Preload("Files").Where("created_by = ?", id).Find(&links).Error,
+		e.DB.Where("actor_id = ? OR target = ?", id, user.Email).Order("created_at").Find(&entries).Error,
+		e.DB.Where("user_id = ?", id).Order("created_at").Find(&sessions).Error,
+	)
+	if err != nil {
+		return nil, err
+	}
+	b.addRecord("metadata/share_links.json", links)
+	b.addRecord("audit/audit_log.json", entries)
+	b.addRecord("access/sessions.json", sessions)
+
+	seen := map[string]bool{}
+	add := func(mediaType, fileName string) {
+		if key := mediaType + "/" + fileName; fileName != "" && !seen[key] {
+			seen[key] = true
+			b.addMedia(e.UploadsDir, mediaType, fileName)
+		}
+	}
+	for _, link := range links {
+		add(link.MediaType, link.FileName)
+		for _, file := range link.Files {
+			add(file.MediaType, file.FileName)
+		}
+	}
+
+	return b, nil
+}
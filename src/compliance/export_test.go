@@ -0,0 +1,118 @@
+package compliance
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/stretchr/testify/require"
+)
+
+func waitForJob(t *testing.T, e *Exporter, id string) Job {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		job, err := e.Get(id)
+		return err == nil && job.Status != StatusRunning
+	}, 5*time.Second, 10*time.Millisecond)
+	job, _ := e.Get(id)
+	return job
+}
+
+func readBundle(t *testing.T, path string) map[string][]byte {
+	t.Helper()
+	zr, err := zip.OpenReader(path)
+	require.NoError(t, err)
+	defer zr.Close()
+
+	files := map[string][]byte{}
+	for _, f := range zr.File {
+		r, err := f.Open()
+		require.NoError(t, err)
+		data, err := io.ReadAll(r)
+		r.Close()
+		require.NoError(t, err)
+		files[f.Name] = data
+	}
+	return files
+}
+
+func TestExporter_Organization(t *testing.T) {
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	db := database.DB
+
+	org := models.Organization{Name: "Acme"}
+	require.NoError(t, db.Create(&org).Error)
+	other := models.Organization{Name: "Other"}
+	require.NoError(t, db.Create(&other).Error)
+	require.NoError(t, db.Create(&models.Image{FileName: "logo.png", Checksum: []byte("a"), OrganizationID: &org.ID}).Error)
+	require.NoError(t, db.Create(&models.Image{FileName: "gone.png", Checksum: []byte("b"), OrganizationID: &org.ID}).Error)
+	require.NoError(t, db.Create(&models.Image{FileName: "foreign.png", Checksum: []byte("c"), OrganizationID: &other.ID}).Error)
+	require.NoError(t, db.Create(&models.AuditLog{Action: "media.takedown", Target: "image/logo.png"}).Error)
+	require.NoError(t, db.Create(&models.AuditLog{Action: "media.takedown", Target: "image/foreign.png"}).Error)
+
+	uploadsDir := filepath.Join(util.ExPath, "uploads")
+	require.NoError(t, os.MkdirAll(filepath.Join(uploadsDir, "images"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(uploadsDir, "images", "logo.png"), []byte("logo"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(uploadsDir, "images", "foreign.png"), []byte("foreign"), 0o644))
+
+	e := NewExporter(db, util.ExPath, uploadsDir)
+	_, err := e.Start(SubjectOrganization, 999, "admin@example.com")
+	require.ErrorIs(t, err, ErrSubjectNotFound)
+
+	started, err := e.Start(SubjectOrganization, org.ID, "admin@example.com")
+	require.NoError(t, err)
+	job := waitForJob(t, e, started.ID)
+	require.Equal(t, StatusDone, job.Status, job.Error)
+	require.Equal(t, job.Total, job.Done)
+	require.Len(t, job.SHA256, 64)
+
+	path, err := e.BundlePath(job.ID)
+	require.NoError(t, err)
+	files := readBundle(t, path)
+	require.Equal(t, "logo", string(files["files/images/logo.png"]))
+	require.NotContains(t, files, "files/images/foreign.png")
+
+	var entries []models.AuditLog
+	require.NoError(t, json.Unmarshal(files["audit/audit_log.json"], &entries))
+	require.Len(t, entries, 1)
+	require.Equal(t, "image/logo.png", entries[0].Target)
+
+	var m manifest
+	require.NoError(t, json.Unmarshal(files["manifest.json"], &m))
+	require.Equal(t, "admin@example.com", m.RequestedBy)
+	require.Equal(t, []string{"files/images/gone.png"}, m.Missing)
+	require.Len(t, m.Entries, len(files)-1)
+
+	// Finished jobs are reloaded after a restart
+	reloaded := NewExporter(db, util.ExPath, uploadsDir)
+	got, err := reloaded.Get(job.ID)
+	require.NoError(t, err)
+	require.Equal(t, job.SHA256, got.SHA256)
+
+	require.NoError(t, e.Delete(job.ID))
+	require.NoFileExists(t, path)
+	_, err = e.Get(job.ID)
+	require.ErrorIs(t, err, ErrJobNotFound)
+}
+
+func TestVerifySignature(t *testing.T) {
+	expires := time.Now().Add(time.Minute)
+	unix := strconv.FormatInt(expires.Unix(), 10)
+	signature := Sign("job", expires)
+
+	require.True(t, VerifySignature("job", unix, signature))
+	require.False(t, VerifySignature("other", unix, signature))
+	require.False(t, VerifySignature("job", unix, signature+"x"))
+
+	past := time.Now().Add(-time.Minute)
+	require.False(t, VerifySignature("job", strconv.FormatInt(past.Unix(), 10), Sign("job", past)))
+}
@@ -0,0 +1,53 @@
+package compliance
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"time"
+)
+
+// manifest describes a bundle. It is written last so it can list the
+// checksums of every other entry.
+type manifest struct {
+	Subject     string          `json:"subject"`
+	SubjectID   uint            `json:"subject_id"`
+	RequestedBy string          `json:"requested_by"`
+	GeneratedAt time.Time       `json:"generated_at"`
+	Notes       []string        `json:"notes,omitempty"`
+	Entries     []manifestEntry `json:"entries"`
+	// Missing lists files with a database record but nothing on disk.
+	Missing []string `json:"missing,omitempty"`
+}
+
+type manifestEntry struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// writeEntry adds an entry read from r to the archive.
+func writeEntry(zw *zip.Writer, name string, r io.Reader) (manifestEntry, error) {
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return manifestEntry{}, err
+	}
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(w, hash), r)
+	if err != nil {
+		return manifestEntry{}, err
+	}
+	return manifestEntry{Name: name, Size: size, SHA256: hex.EncodeToString(hash.Sum(nil))}, nil
+}
+
+// writeFile adds the file at path to the archive.
+func writeFile(zw *zip.Writer, name, path string) (manifestEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return manifestEntry{}, err
+	}
+	defer f.Close()
+	return writeEntry(zw, name, f)
+}
@@ -0,0 +1,50 @@
+package compliance
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"os"
+	"strconv"
+	"time"
+)
+
+const defaultLinkTTL = time.Hour
+
+func signingKey() []byte {
+	key := os.Getenv("EXPORT_SIGNING_KEY")
+	if key == "" {
+		key = os.Getenv("JWT_SECRET")
+	}
+	if key == "" {
+		key = "your-super-secret-jwt-key"
+	}
+	return []byte(key)
+}
+
+// LinkTTL returns how long download links stay valid, EXPORT_LINK_TTL
+// seconds or an hour by default.
+func LinkTTL() time.Duration {
+	if seconds, err := strconv.Atoi(os.Getenv("EXPORT_LINK_TTL")); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return defaultLinkTTL
+}
+
+// Sign returns the signature authorizing the download of the bundle of job
+// id until expires.
+func Sign(id string, expires time.Time) string {
+	mac := hmac.New(sha256.New, signingKey())
+	mac.Write([]byte(id + "/" + strconv.FormatInt(expires.Unix(), 10)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature reports whether signature authorizes the download of the
+// bundle of job id and has not expired. expires is a Unix timestamp.
+func VerifySignature(id, expires, signature string) bool {
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > unix {
+		return false
+	}
+	return hmac.Equal([]byte(Sign(id, time.Unix(unix, 0))), []byte(signature))
+}
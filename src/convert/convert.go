@@ -0,0 +1,209 @@
+// Package convert renders office documents as PDF with a Gotenberg service,
+// so documents can be previewed in any browser. The PDF is stored as a
+// rendition of the document.
+package convert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/breaker"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/queue"
+	"github.com/kevinanielsen/go-fast-cdn/src/renditions"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"gorm.io/gorm"
+)
+
+const (
+	// PDFJob is the kind of the background jobs rendering a PDF.
+	PDFJob = "convert.pdf"
+
+	defaultTimeout = 2 * time.Minute
+)
+
+// convertible lists the extensions of the documents rendered as PDF.
+var convertible = map[string]bool{
+	".doc": true, ".docx": true, ".odt": true, ".rtf": true,
+	".xls": true, ".xlsx": true, ".ods": true,
+	".ppt": true, ".pptx": true, ".odp": true,
+}
+
+// Convertible reports whether the document fileName is rendered as PDF.
+func Convertible(fileName string) bool {
+	return convertible[strings.ToLower(filepath.Ext(fileName))]
+}
+
+// Active is the converter started by Start, nil when no converter is
+// configured.
+var Active *Converter
+
+// Converter renders documents with the Gotenberg service at URL.
+type Converter struct {
+	URL        string
+	client     *http.Client
+	docs       models.DocRepository
+	renditions models.RenditionRepository
+}
+
+func New(url string, timeout time.Duration, docs models.DocRepository, renditions models.RenditionRepository) *Converter {
+	return &Converter{
+		URL:        strings.TrimSuffix(url, "/"),
+		client:     &http.Client{Timeout: timeout},
+		docs:       docs,
+		renditions: renditions,
+	}
+}
+
+type pdfPayload struct {
+	FileName string `json:"file_name"`
+}
+
+// Start sets Active to a converter for the Gotenberg service at
+// CONVERTER_URL, waiting up to CONVERTER_TIMEOUT seconds (120 by default)
+// per document, and registers the handler of PDFJob with the queue.
+// Documents are not converted without CONVERTER_URL.
+func Start(docs models.DocRepository, renditions models.RenditionRepository) error {
+	url := os.Getenv("CONVERTER_URL")
+	if url == "" {
+		return nil
+	}
+	timeout := defaultTimeout
+	if val := os.Getenv("CONVERTER_TIMEOUT"); val != "" {
+		seconds, err := strconv.Atoi(val)
+		if err != nil || seconds <= 0 {
+			return fmt.Errorf("invalid CONVERTER_TIMEOUT %q", val)
+		}
+		timeout = time.Duration(seconds) * time.Second
+	}
+
+	converter := New(url, timeout, docs, renditions)
+	queue.Register(PDFJob, func(ctx context.Context, payload []byte) error {
+		var p pdfPayload
+		if err := json.Unmarshal(payload, &p); err != nil {
+			return err
+		}
+		return converter.RenderPDF(ctx, p.FileName)
+	})
+	Active = converter
+	log.Printf("Rendering office documents as PDF with %s", converter.URL)
+	return nil
+}
+
+// EnqueuePDF renders a PDF of the document in the background if it is an
+// office document and a converter is configured. Without the queue the
+// conversion runs in a goroutine and is not retried.
+func EnqueuePDF(ctx context.Context, fileName string) {
+	converter := Active
+	if converter == nil || !Convertible(fileName) {
+		return
+	}
+	if queue.Running() {
+		if err := queue.Enqueue(ctx, PDFJob, pdfPayload{FileName: fileName}); err != nil {
+			log.Printf("Failed to queue the PDF rendition of %s: %s", fileName, err.Error())
+		}
+		return
+	}
+	go func() {
+		if err := converter.RenderPDF(context.Background(), fileName); err != nil {
+			log.Printf("Failed to render %s as PDF: %s", fileName, err.Error())
+		}
+	}()
+}
+
+// RenderPDF converts the document fileName and stores the PDF as its
+// rendition, replacing the content of an earlier rendition.
+func (cv *Converter) RenderPDF(ctx context.Context, fileName string) error {
+	doc, err := cv.docs.GetDocByFileName(ctx, fileName)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// Deleted before it was converted
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	src, err := os.Open(filepath.Join(util.ExPath, "uploads", "docs", fileName))
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	pdf, err := cv.ToPDF(ctx, fileName, src)
+	if err != nil {
+		return err
+	}
+	defer pdf.Close()
+
+	tmp, err := renditions.CreateTemp(".pdf")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, pdf)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return renditions.Save(ctx, cv.renditions, &models.Rendition{
+		SourceType:  models.MediaTypeDoc,
+		SourceID:    doc.ID,
+		Kind:        models.RenditionPDF,
+		ContentType: "application/pdf",
+	}, tmp.Name(), ".pdf")
+}
+
+// ToPDF sends the document read from r to Gotenberg and returns the PDF.
+func (cv *Converter) ToPDF(ctx context.Context, fileName string, r io.Reader) (io.ReadCloser, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("files", fileName)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(part, r); err != nil {
+		return nil, err
+	}
+	if err := form.Close(); err != nil {
+		return nil, err
+	}
+
+	var pdf io.ReadCloser
+	err = breaker.Get("converter").Do(ctx, func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, cv.URL+"/forms/libreoffice/convert", bytes.NewReader(body.Bytes()))
+		if err != nil {
+			return breaker.Permanent(err)
+		}
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		resp, err := cv.client.Do(req)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			defer resp.Body.Close()
+			msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+			err := fmt.Errorf("converter responded with %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+			// Documents the converter cannot read fail the same way again
+			if resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+				return breaker.Permanent(err)
+			}
+			return err
+		}
+		pdf = resp.Body
+		return nil
+	})
+	return pdf, err
+}
@@ -0,0 +1,82 @@
+package convert
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/renditions"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConverter_RenderPDF(t *testing.T) {
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	ctx := context.Background()
+	docsDir := filepath.Join(util.ExPath, "uploads", "docs")
+	require.NoError(t, os.MkdirAll(docsDir, 0o755))
+
+	var received string
+	gotenberg := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/forms/libreoffice/convert", r.URL.Path)
+		file, header, err := r.FormFile("files")
+		require.NoError(t, err)
+		data, _ := io.ReadAll(file)
+		received = header.Filename + ":" + string(data)
+		w.Write([]byte("%PDF-1.7 " + string(data)))
+	}))
+	defer gotenberg.Close()
+
+	docs := database.NewDocRepo(database.DB)
+	renditionRepo := database.NewRenditionRepo(database.DB)
+	cv := New(gotenberg.URL, time.Minute, docs, renditionRepo)
+
+	require.NoError(t, os.WriteFile(filepath.Join(docsDir, "report.docx"), []byte("v1"), 0o644))
+	_, err := docs.AddDoc(ctx, models.Doc{FileName: "report.docx", Checksum: []byte("a")})
+	require.NoError(t, err)
+
+	require.NoError(t, cv.RenderPDF(ctx, "report.docx"))
+	require.Equal(t, "report.docx:v1", received)
+
+	doc, err := docs.GetDocByFileName(ctx, "report.docx")
+	require.NoError(t, err)
+	list, err := renditionRepo.GetRenditions(ctx, models.MediaTypeDoc, doc.ID)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	require.Equal(t, models.RenditionPDF, list[0].Kind)
+	require.Equal(t, "application/pdf", list[0].ContentType)
+	pdfPath := filepath.Join(renditions.Dir(), list[0].FileName)
+	data, err := os.ReadFile(pdfPath)
+	require.NoError(t, err)
+	require.Equal(t, "%PDF-1.7 v1", string(data))
+	require.Equal(t, int64(len(data)), list[0].Size)
+
+	// Rendering again replaces the content of the rendition
+	require.NoError(t, os.WriteFile(filepath.Join(docsDir, "report.docx"), []byte("v2"), 0o644))
+	require.NoError(t, cv.RenderPDF(ctx, "report.docx"))
+	list, err = renditionRepo.GetRenditions(ctx, models.MediaTypeDoc, doc.ID)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	data, err = os.ReadFile(pdfPath)
+	require.NoError(t, err)
+	require.Equal(t, "%PDF-1.7 v2", string(data))
+
+	// Deleting the document deletes its renditions
+	_, err = docs.DeleteDoc(ctx, "report.docx")
+	require.NoError(t, err)
+	list, err = renditionRepo.GetRenditions(ctx, models.MediaTypeDoc, doc.ID)
+	require.NoError(t, err)
+	require.Empty(t, list)
+	require.NoFileExists(t, pdfPath)
+
+	require.True(t, Convertible("Slides.PPTX"))
+	require.False(t, Convertible("notes.txt"))
+}
@@ -0,0 +1,43 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"gorm.io/gorm"
+)
+
+type AuditLogRepo struct {
+	DB *gorm.DB
+}
+
+func NewAuditLogRepo(db *gorm.DB) models.AuditLogRepository {
+	return &AuditLogRepo{DB: db}
+}
+
+func (repo *AuditLogRepo) AddAuditLog(ctx context.Context, entry *models.AuditLog) error {
+	return repo.DB.WithContext(ctx).Create(entry).Error
+}
+
+// GetAuditLogs returns the newest audit log entries, optionally filtered by
+// action.
+func (repo *AuditLogRepo) GetAuditLogs(ctx context.Context, action string, limit int) ([]models.AuditLog, error) {
+	var entries []models.AuditLog
+
+	query := repo.DB.WithContext(ctx).Order("id DESC").Limit(limit)
+	if action != "" {
+		query = query.Where("action = ?", action)
+	}
+	err := query.Find(&entries).Error
+
+	return entries, err
+}
+
+// GetAuditLogsSince returns all entries created at or after since, oldest
+// first.
+func (repo *AuditLogRepo) GetAuditLogsSince(ctx context.Context, since time.Time) ([]models.AuditLog, error) {
+	var entries []models.AuditLog
+	err := repo.DB.WithContext(ctx).Where("created_at >= ?", since).Order("id ASC").Find(&entries).Error
+	return entries, err
+}
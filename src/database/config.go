@@ -1,7 +1,10 @@
 package database
 
 import (
+	"encoding/json"
 	"errors"
+	"strconv"
+	"strings"
 
 	"github.com/kevinanielsen/go-fast-cdn/src/models"
 	"gorm.io/gorm"
@@ -37,3 +40,132 @@ func (r *ConfigRepo) Set(key, value string) error {
 	config.Value = value
 	return r.db.Save(&config).Error
 }
+
+// Config keys of the CORS policy. List values are stored comma separated.
+const (
+	corsAllowedOriginsKey   = "cors_allowed_origins"
+	corsAllowedMethodsKey   = "cors_allowed_methods"
+	corsAllowedHeadersKey   = "cors_allowed_headers"
+	corsAllowCredentialsKey = "cors_allow_credentials"
+)
+
+// GetCORSPolicy returns the stored CORS policy, using the defaults for
+// settings that were never set.
+func (r *ConfigRepo) GetCORSPolicy() models.CORSPolicy {
+	policy := models.DefaultCORSPolicy()
+	if val, err := r.Get(corsAllowedOriginsKey); err == nil {
+		policy.AllowedOrigins = splitList(val)
+	}
+	if val, err := r.Get(corsAllowedMethodsKey); err == nil {
+		policy.AllowedMethods = splitList(val)
+	}
+	if val, err := r.Get(corsAllowedHeadersKey); err == nil {
+		policy.AllowedHeaders = splitList(val)
+	}
+	if val, err := r.Get(corsAllowCredentialsKey); err == nil {
+		policy.AllowCredentials = val == "true"
+	}
+	return policy
+}
+
+// SetCORSPolicy stores every setting of the CORS policy.
+func (r *ConfigRepo) SetCORSPolicy(policy models.CORSPolicy) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		repo := NewConfigRepo(tx)
+		settings := map[string]string{
+			corsAllowedOriginsKey:   strings.Join(policy.AllowedOrigins, ","),
+			corsAllowedMethodsKey:   strings.Join(policy.AllowedMethods, ","),
+			corsAllowedHeadersKey:   strings.Join(policy.AllowedHeaders, ","),
+			corsAllowCredentialsKey: strconv.FormatBool(policy.AllowCredentials),
+		}
+		for key, value := range settings {
+			if err := repo.Set(key, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// hotlinkPolicyKey is the config key of the JSON encoded hotlink policy.
+const hotlinkPolicyKey = "hotlink_policy"
+
+// GetHotlinkPolicy returns the stored hotlink policy, or the default policy
+// if none was set.
+func (r *ConfigRepo) GetHotlinkPolicy() models.HotlinkPolicy {
+	policy := models.DefaultHotlinkPolicy()
+	val, err := r.Get(hotlinkPolicyKey)
+	if err != nil {
+		return policy
+	}
+	if err := json.Unmarshal([]byte(val), &policy); err != nil {
+		return models.DefaultHotlinkPolicy()
+	}
+	return policy
+}
+
+// SetHotlinkPolicy stores the hotlink policy.
+func (r *ConfigRepo) SetHotlinkPolicy(policy models.HotlinkPolicy) error {
+	val, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+	return r.Set(hotlinkPolicyKey, string(val))
+}
+
+// watermarkSettingsKey is the config key of the JSON encoded watermark
+// settings.
+const watermarkSettingsKey = "watermark_settings"
+
+// GetWatermarkSettings returns the stored watermark settings, or the default
+// settings if none were set.
+func (r *ConfigRepo) GetWatermarkSettings() models.WatermarkSettings {
+	settings := models.DefaultWatermarkSettings()
+	val, err := r.Get(watermarkSettingsKey)
+	if err != nil {
+		return settings
+	}
+	if err := json.Unmarshal([]byte(val), &settings); err != nil {
+		return models.DefaultWatermarkSettings()
+	}
+	return settings
+}
+
+// SetWatermarkSettings stores the watermark settings.
+func (r *ConfigRepo) SetWatermarkSettings(settings models.WatermarkSettings) error {
+	val, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	return r.Set(watermarkSettingsKey, string(val))
+}
+
+func splitList(val string) []string {
+	list := []string{}
+	for _, item := range strings.Split(val, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// SetAll stores the values in one transaction, deleting the keys mapped to
+// nil.
+func (r *ConfigRepo) SetAll(values map[string]*string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		repo := NewConfigRepo(tx)
+		for key, value := range values {
+			if value == nil {
+				if err := tx.Where("key = ?", key).Delete(&models.Config{}).Error; err != nil {
+					return err
+				}
+				continue
+			}
+			if err := repo.Set(key, *value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
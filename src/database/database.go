@@ -6,7 +6,6 @@ import (
 	"os"
 
 	"github.com/glebarez/sqlite"
-	"github.com/kevinanielsen/go-fast-cdn/src/models"
 	"github.com/kevinanielsen/go-fast-cdn/src/util"
 	"gorm.io/gorm"
 )
@@ -18,6 +17,15 @@ const (
 
 var DB *gorm.DB
 
+// SkipMigrations makes ConnectToDB and Migrate leave the schema as it is, for
+// fast restarts of instances sharing a database that is already migrated.
+var SkipMigrations bool
+
+// Path returns the location of the SQLite database file.
+func Path() string {
+	return fmt.Sprintf("%v/%s/%s", util.ExPath, DbFolder, DbName)
+}
+
 func ConnectToDB() {
 	dbPath := fmt.Sprintf("%v/%s", util.ExPath, DbFolder)
 
@@ -35,8 +43,18 @@ func ConnectToDB() {
 		panic("Failed to connect to database!")
 	}
 	log.Println("Connected to database!")
+	if err := configurePool(database); err != nil {
+		log.Fatalf("Failed to configure the database pool: %s", err.Error())
+	}
+	if err := database.Use(&instrumentation{recorder: QueryRecorder, slowThreshold: slowQueryThresholdFromEnv()}); err != nil {
+		log.Fatalf("Failed to instrument the database: %s", err.Error())
+	}
 
-	database.AutoMigrate(&models.Image{}, &models.Doc{}, &models.Config{})
+	if !SkipMigrations {
+		if err := migrateSchema(database); err != nil {
+			panic("Failed to migrate the database: " + err.Error())
+		}
+	}
 	DB = database
 	log.Println("Database initialized!")
 }
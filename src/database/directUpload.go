@@ -0,0 +1,46 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"gorm.io/gorm"
+)
+
+type directUploadRepo struct {
+	DB *gorm.DB
+}
+
+func NewDirectUploadRepo(db *gorm.DB) models.DirectUploadRepository {
+	return &directUploadRepo{DB: db}
+}
+
+func (repo *directUploadRepo) AddDirectUpload(ctx context.Context, upload *models.DirectUpload) error {
+	return repo.DB.WithContext(ctx).Create(upload).Error
+}
+
+func (repo *directUploadRepo) GetDirectUpload(ctx context.Context, token string) (models.DirectUpload, error) {
+	var upload models.DirectUpload
+	err := repo.DB.WithContext(ctx).Where("token = ?", token).Take(&upload).Error
+	return upload, err
+}
+
+func (repo *directUploadRepo) PendingDirectUpload(ctx context.Context, mediaType, fileName string) (bool, error) {
+	var count int64
+	err := repo.DB.WithContext(ctx).Model(&models.DirectUpload{}).
+		Where("media_type = ? AND file_name = ? AND expires_at > ?", mediaType, fileName, time.Now()).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (repo *directUploadRepo) DeleteDirectUpload(ctx context.Context, token string) error {
+	result := repo.DB.WithContext(ctx).Unscoped().Where("token = ?", token).Delete(&models.DirectUpload{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -1,8 +1,12 @@
 package database
 
 import (
+	"context"
+	"time"
+
 	"github.com/kevinanielsen/go-fast-cdn/src/models"
 	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
 )
 
 type DocRepo struct {
@@ -13,45 +17,183 @@ func NewDocRepo(db *gorm.DB) models.DocRepository {
 	return &DocRepo{DB: db}
 }
 
-func (repo *DocRepo) GetAllDocs() []models.Doc {
+func (repo *DocRepo) GetAllDocs(ctx context.Context) ([]models.Doc, error) {
+	var entries []models.Doc
+
+	err := repo.DB.WithContext(ctx).Find(&entries, &models.Doc{}).Error
+
+	return entries, err
+}
+
+func (repo *DocRepo) GetDocsAfter(ctx context.Context, afterID uint, limit int) ([]models.Doc, error) {
 	var entries []models.Doc
 
-	repo.DB.Find(&entries, &models.Doc{})
+	err := repo.DB.WithContext(ctx).Where("id > ?", afterID).Order("id").Limit(limit).Find(&entries).Error
+
+	return entries, err
+}
+
+func (repo *DocRepo) GetDocsPage(ctx context.Context, limit, offset int) ([]models.Doc, error) {
+	var entries []models.Doc
+
+	err := repo.DB.WithContext(ctx).Order("created_at DESC, id DESC").Limit(limit).Offset(offset).Find(&entries).Error
+
+	return entries, err
+}
+
+func (repo *DocRepo) CountDocs(ctx context.Context) (int64, error) {
+	var count int64
+	err := repo.DB.WithContext(ctx).Model(&models.Doc{}).Count(&count).Error
+	return count, err
+}
+
+func (repo *DocRepo) GetDocByCheckSum(ctx context.Context, checksum []byte) (models.Doc, error) {
+	var entries models.Doc
+
+	err := repo.DB.WithContext(ctx).Clauses(dbresolver.Write).Where("checksum = ?", checksum).First(&entries).Error
 
-	return entries
+	return entries, err
 }
 
-func (repo *DocRepo) GetDocByCheckSum(checksum []byte) models.Doc {
+func (repo *DocRepo) GetDocByFileName(ctx context.Context, fileName string) (models.Doc, error) {
 	var entries models.Doc
 
-	repo.DB.Where("checksum = ?", checksum).First(&entries)
+	err := repo.DB.WithContext(ctx).Clauses(dbresolver.Write).Where("file_name = ?", fileName).Take(&entries).Error
 
-	return entries
+	return entries, err
 }
 
-func (repo *DocRepo) AddDoc(doc models.Doc) (string, error) {
-	result := repo.DB.Create(&doc)
+func (repo *DocRepo) GetDocByUUID(ctx context.Context, uuid string) (models.Doc, error) {
+	var entries models.Doc
+
+	err := repo.DB.WithContext(ctx).Where("uuid = ?", uuid).First(&entries).Error
+
+	return entries, err
+}
+
+func (repo *DocRepo) AddDoc(ctx context.Context, doc models.Doc) (string, error) {
+	result := repo.DB.WithContext(ctx).Create(&doc)
 	if result.Error != nil {
 		return "", result.Error
 	}
 
-	return doc.FileName, result.Error
+	return doc.FileName, nil
+}
+
+// DeleteDoc removes the doc, its relations, aliases, renditions and indexed
+// text. It returns gorm.ErrRecordNotFound if there is no doc named fileName.
+func (repo *DocRepo) DeleteDoc(ctx context.Context, fileName string) (string, error) {
+	var renditions []models.Rendition
+	err := repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var doc models.Doc
+		if err := tx.Where("file_name = ?", fileName).Take(&doc).Error; err != nil {
+			return err
+		}
+		if err := checkUnchanged(ctx, ifUnchanged(ctx, tx).Delete(&doc)); err != nil {
+			return err
+		}
+		if err := NewMediaRelationRepo(tx).DeleteRelationsFor(ctx, models.MediaTypeDoc, doc.ID); err != nil {
+			return err
+		}
+		if err := NewMediaAliasRepo(tx).DeleteAliasesFor(ctx, models.MediaTypeDoc, doc.UUID); err != nil {
+			return err
+		}
+		if err := NewMediaCommentRepo(tx).DeleteCommentsFor(ctx, models.MediaTypeDoc, doc.UUID); err != nil {
+			return err
+		}
+		var err error
+		if renditions, err = NewRenditionRepo(tx).DeleteRenditionsFor(ctx, models.MediaTypeDoc, doc.ID); err != nil {
+			return err
+		}
+		return NewSearchRepo(tx).Remove(ctx, models.MediaTypeDoc, fileName)
+	})
+	if err != nil {
+		return "", err
+	}
+	removeRenditionFiles(renditions)
+
+	return fileName, nil
 }
 
-func (repo *DocRepo) DeleteDoc(fileName string) (string, bool) {
-	var doc models.Doc
+// RenameDoc renames the doc and its indexed text, and keeps the old name as
+// an alias of it.
+func (repo *DocRepo) RenameDoc(ctx context.Context, oldFileName, newFileName string) error {
+	return repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var doc models.Doc
+		err := tx.Where("file_name = ?", oldFileName).Limit(1).Find(&doc).Error
+		if err != nil {
+			return err
+		}
+		err = checkUnchanged(ctx, ifUnchanged(ctx, tx.Model(&models.Doc{}).Where("file_name = ?", oldFileName)).Update("file_name", newFileName))
+		if err != nil {
+			return err
+		}
+		if err := renameAliases(ctx, tx, models.MediaTypeDoc, oldFileName, newFileName, doc.UUID); err != nil {
+			return err
+		}
+		if err := NewDownloadStatRepo(tx).RenameDownloadStats(ctx, models.MediaTypeDoc, oldFileName, newFileName); err != nil {
+			return err
+		}
+		return NewSearchRepo(tx).Rename(ctx, models.MediaTypeDoc, oldFileName, newFileName)
+	})
+}
 
-	result := repo.DB.Where("file_name = ?", fileName).First(&doc)
+// UpdateDocChecksum records the checksum of new content written over the
+// doc, and clears its MIME type to be detected again
+func (repo *DocRepo) UpdateDocChecksum(ctx context.Context, fileName, algorithm string, checksum []byte) error {
+	return repo.DB.WithContext(ctx).Model(&models.Doc{}).Where("file_name = ?", fileName).
+		Updates(map[string]any{"checksum": checksum, "checksum_algorithm": algorithm, "mime_type": ""}).Error
+}
 
-	if result.Error == nil {
-		repo.DB.Delete(&doc)
-		return fileName, true
-	} else {
-		return "", false
-	}
+func (repo *DocRepo) UpdateDocDisposition(ctx context.Context, fileName, disposition, downloadName string) error {
+	q := repo.DB.WithContext(ctx).Model(&models.Doc{}).Where("file_name = ?", fileName)
+	return checkUnchanged(ctx, ifUnchanged(ctx, q).Updates(map[string]any{"disposition": disposition, "download_name": downloadName}))
+}
+
+func (repo *DocRepo) UpdateDocMimeType(ctx context.Context, fileName, mimeType string) error {
+	return repo.DB.WithContext(ctx).Model(&models.Doc{}).Where("file_name = ?", fileName).Update("mime_type", mimeType).Error
+}
+
+func (repo *DocRepo) UpdateDocMetadata(ctx context.Context, fileName string, metadata models.MediaMetadata) error {
+	q := repo.DB.WithContext(ctx).Model(&models.Doc{}).Where("file_name = ?", fileName)
+	return checkUnchanged(ctx, ifUnchanged(ctx, q).Updates(map[string]any{
+		"title":       metadata.Title,
+		"alt_text":    metadata.AltText,
+		"description": metadata.Description,
+		"attributes":  []byte(metadata.Attributes),
+	}))
+}
+
+func (repo *DocRepo) UpdateDocModerationStatus(ctx context.Context, fileName, status string) error {
+	return repo.DB.WithContext(ctx).Model(&models.Doc{}).Where("file_name = ?", fileName).Update("moderation_status", status).Error
 }
 
-func (repo *DocRepo) RenameDoc(oldFileName, newFileName string) error {
-	doc := models.Doc{}
-	return repo.DB.Model(&doc).Where("file_name = ?", oldFileName).Update("file_name", newFileName).Error
+func (repo *DocRepo) GetDocsByModerationStatus(ctx context.Context, status string) ([]models.Doc, error) {
+	var entries []models.Doc
+	err := repo.DB.WithContext(ctx).Where("moderation_status = ?", status).Order("created_at, id").Find(&entries).Error
+	return entries, err
+}
+
+// GetExpiredDocs returns the docs whose expiry time is before now
+func (repo *DocRepo) GetExpiredDocs(ctx context.Context, now time.Time) ([]models.Doc, error) {
+	var entries []models.Doc
+
+	err := repo.DB.WithContext(ctx).Where("expires_at IS NOT NULL AND expires_at <= ?", now).Find(&entries).Error
+
+	return entries, err
+}
+
+// GetDocsPastLifecycle returns the docs without an expiry time of their
+// own that were uploaded before createdBefore, only those of the organization
+// if orgID is set
+func (repo *DocRepo) GetDocsPastLifecycle(ctx context.Context, createdBefore time.Time, orgID *uint) ([]models.Doc, error) {
+	var entries []models.Doc
+
+	query := repo.DB.WithContext(ctx).Where("expires_at IS NULL AND created_at <= ?", createdBefore)
+	if orgID != nil {
+		query = query.Where("organization_id = ?", *orgID)
+	}
+	err := query.Find(&entries).Error
+
+	return entries, err
 }
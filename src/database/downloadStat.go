@@ -0,0 +1,71 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type DownloadStatRepo struct {
+	DB *gorm.DB
+}
+
+func NewDownloadStatRepo(db *gorm.DB) models.DownloadStatRepository {
+	return &DownloadStatRepo{DB: db}
+}
+
+func (repo *DownloadStatRepo) AddDownloads(ctx context.Context, stats []models.DownloadStat) error {
+	if len(stats) == 0 {
+		return nil
+	}
+	return repo.DB.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "media_type"}, {Name: "file_name"}, {Name: "day"}},
+		DoUpdates: clause.Assignments(map[string]any{
+			"count": gorm.Expr("download_stats.count + excluded.count"),
+		}),
+	}).Create(&stats).Error
+}
+
+func (repo *DownloadStatRepo) GetDownloadCount(ctx context.Context, mediaType, fileName string) (int64, error) {
+	var count int64
+	err := repo.DB.WithContext(ctx).Model(&models.DownloadStat{}).
+		Where("media_type = ? AND file_name = ?", mediaType, fileName).
+		Select("COALESCE(SUM(count), 0)").Scan(&count).Error
+	return count, err
+}
+
+func (repo *DownloadStatRepo) GetTopDownloads(ctx context.Context, mediaType string, since, until time.Time, limit int) ([]models.DownloadTotal, error) {
+	totals := []models.DownloadTotal{}
+	query := repo.DB.WithContext(ctx).Model(&models.DownloadStat{}).
+		Select("media_type, file_name, SUM(count) AS count").
+		Group("media_type, file_name").
+		Order("count DESC, file_name").
+		Limit(limit)
+	if mediaType != "" {
+		query = query.Where("media_type = ?", mediaType)
+	}
+	if !since.IsZero() {
+		query = query.Where("day >= ?", since)
+	}
+	if !until.IsZero() {
+		query = query.Where("day < ?", until)
+	}
+	err := query.Scan(&totals).Error
+	return totals, err
+}
+
+func (repo *DownloadStatRepo) RenameDownloadStats(ctx context.Context, mediaType, oldFileName, newFileName string) error {
+	return repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Counters left by a deleted file of the new name would clash
+		err := tx.Where("media_type = ? AND file_name = ?", mediaType, newFileName).Delete(&models.DownloadStat{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&models.DownloadStat{}).
+			Where("media_type = ? AND file_name = ?", mediaType, oldFileName).
+			Update("file_name", newFileName).Error
+	})
+}
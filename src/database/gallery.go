@@ -0,0 +1,48 @@
+package database
+
+import (
+	"context"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"gorm.io/gorm"
+)
+
+type GalleryRepo struct {
+	DB *gorm.DB
+}
+
+func NewGalleryRepo(db *gorm.DB) models.GalleryRepository {
+	return &GalleryRepo{DB: db}
+}
+
+func (repo *GalleryRepo) GetAllGalleries(ctx context.Context) ([]models.Gallery, error) {
+	var galleries []models.Gallery
+	err := repo.DB.WithContext(ctx).Order("slug").Find(&galleries).Error
+	return galleries, err
+}
+
+func (repo *GalleryRepo) GetGalleryBySlug(ctx context.Context, slug string) (*models.Gallery, error) {
+	var gallery models.Gallery
+	if err := repo.DB.WithContext(ctx).Where("slug = ?", slug).First(&gallery).Error; err != nil {
+		return nil, err
+	}
+	return &gallery, nil
+}
+
+func (repo *GalleryRepo) CreateGallery(ctx context.Context, gallery *models.Gallery) error {
+	return repo.DB.WithContext(ctx).Create(gallery).Error
+}
+
+func (repo *GalleryRepo) UpdateGallery(ctx context.Context, gallery *models.Gallery) error {
+	return repo.DB.WithContext(ctx).Save(gallery).Error
+}
+
+func (repo *GalleryRepo) DeleteGallery(ctx context.Context, slug string) error {
+	result := repo.DB.WithContext(ctx).Unscoped().Where("slug = ?", slug).Delete(&models.Gallery{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package database
+
+import (
+	"context"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type GroupRepo struct {
+	DB *gorm.DB
+}
+
+func NewGroupRepo(db *gorm.DB) models.GroupRepository {
+	return &GroupRepo{DB: db}
+}
+
+func (repo *GroupRepo) GetAllGroups(ctx context.Context) ([]models.Group, error) {
+	var groups []models.Group
+	err := repo.DB.WithContext(ctx).Order("name ASC").Find(&groups).Error
+	return groups, err
+}
+
+func (repo *GroupRepo) GetGroupByID(ctx context.Context, id uint) (*models.Group, error) {
+	var group models.Group
+	if err := repo.DB.WithContext(ctx).First(&group, id).Error; err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+func (repo *GroupRepo) CreateGroup(ctx context.Context, group *models.Group) error {
+	return repo.DB.WithContext(ctx).Create(group).Error
+}
+
+func (repo *GroupRepo) DeleteGroup(ctx context.Context, id uint) error {
+	return repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&models.Group{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if err := tx.Where("group_id = ?", id).Delete(&models.GroupMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("group_id = ?", id).Delete(&models.FolderPermission{}).Error
+	})
+}
+
+func (repo *GroupRepo) GetGroupMembers(ctx context.Context, groupID uint) ([]models.User, error) {
+	var users []models.User
+	err := repo.DB.WithContext(ctx).
+		Joins("JOIN group_members ON group_members.user_id = users.id").
+		Where("group_members.group_id = ?", groupID).
+		Order("users.email ASC").
+		Find(&users).Error
+	return users, err
+}
+
+func (repo *GroupRepo) AddGroupMember(ctx context.Context, groupID, userID uint) error {
+	member := models.GroupMember{GroupID: groupID, UserID: userID}
+	return repo.DB.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&member).Error
+}
+
+func (repo *GroupRepo) RemoveGroupMember(ctx context.Context, groupID, userID uint) error {
+	result := repo.DB.WithContext(ctx).Where("group_id = ? AND user_id = ?", groupID, userID).Delete(&models.GroupMember{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (repo *GroupRepo) GetFolderPermissions(ctx context.Context, folder string) ([]models.FolderPermission, error) {
+	var permissions []models.FolderPermission
+	query := repo.DB.WithContext(ctx).Order("folder ASC, group_id ASC")
+	if folder != "" {
+		query = query.Where("folder = ?", folder)
+	}
+	err := query.Find(&permissions).Error
+	return permissions, err
+}
+
+func (repo *GroupRepo) SetFolderPermission(ctx context.Context, permission *models.FolderPermission) error {
+	return repo.DB.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "folder"}, {Name: "group_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"access", "updated_at"}),
+	}).Create(permission).Error
+}
+
+func (repo *GroupRepo) DeleteFolderPermission(ctx context.Context, folder string, groupID uint) error {
+	result := repo.DB.WithContext(ctx).Where("folder = ? AND group_id = ?", folder, groupID).Delete(&models.FolderPermission{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (repo *GroupRepo) GetUserFolderAccess(ctx context.Context, userID uint, folder string) ([]string, error) {
+	var access []string
+	err := repo.DB.WithContext(ctx).Model(&models.FolderPermission{}).
+		Joins("JOIN group_members ON group_members.group_id = folder_permissions.group_id").
+		Where("group_members.user_id = ? AND folder_permissions.folder = ?", userID, folder).
+		Pluck("folder_permissions.access", &access).Error
+	return access, err
+}
@@ -1,8 +1,12 @@
 package database
 
 import (
+	"context"
+	"time"
+
 	"github.com/kevinanielsen/go-fast-cdn/src/models"
 	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
 )
 
 type imageRepo struct {
@@ -13,24 +17,72 @@ func NewImageRepo(db *gorm.DB) models.ImageRepository {
 	return &imageRepo{DB: db}
 }
 
-func (repo *imageRepo) GetAllImages() []models.Image {
+func (repo *imageRepo) GetAllImages(ctx context.Context) ([]models.Image, error) {
 	var entries []models.Image
 
-	repo.DB.Find(&entries, &models.Image{})
+	err := repo.DB.WithContext(ctx).Find(&entries, &models.Image{}).Error
 
-	return entries
+	return entries, err
 }
 
-func (repo *imageRepo) GetImageByCheckSum(checksum []byte) models.Image {
+func (repo *imageRepo) GetImagesAfter(ctx context.Context, afterID uint, limit int) ([]models.Image, error) {
+	var entries []models.Image
+
+	err := repo.DB.WithContext(ctx).Where("id > ?", afterID).Order("id").Limit(limit).Find(&entries).Error
+
+	return entries, err
+}
+
+// GetImageByCheckSum and GetImageByFileName read from the primary database
+// since uploads, renames and deletes decide based on them.
+func (repo *imageRepo) GetImagesPage(ctx context.Context, limit, offset int) ([]models.Image, error) {
+	var entries []models.Image
+
+	err := repo.DB.WithContext(ctx).Order("created_at DESC, id DESC").Limit(limit).Offset(offset).Find(&entries).Error
+
+	return entries, err
+}
+
+func (repo *imageRepo) CountImages(ctx context.Context) (int64, error) {
+	var count int64
+	err := repo.DB.WithContext(ctx).Model(&models.Image{}).Count(&count).Error
+	return count, err
+}
+
+func (repo *imageRepo) GetImageByCheckSum(ctx context.Context, checksum []byte) (models.Image, error) {
 	var entries models.Image
 
-	repo.DB.Where("checksum = ?", checksum).First(&entries)
+	err := repo.DB.WithContext(ctx).Clauses(dbresolver.Write).Where("checksum = ?", checksum).First(&entries).Error
 
-	return entries
+	return entries, err
 }
 
-func (repo *imageRepo) AddImage(image models.Image) (string, error) {
-	result := repo.DB.Create(&image)
+func (repo *imageRepo) GetImageByID(ctx context.Context, id uint) (models.Image, error) {
+	var entries models.Image
+
+	err := repo.DB.WithContext(ctx).Take(&entries, id).Error
+
+	return entries, err
+}
+
+func (repo *imageRepo) GetImageByFileName(ctx context.Context, fileName string) (models.Image, error) {
+	var entries models.Image
+
+	err := repo.DB.WithContext(ctx).Clauses(dbresolver.Write).Where("file_name = ?", fileName).Take(&entries).Error
+
+	return entries, err
+}
+
+func (repo *imageRepo) GetImageByUUID(ctx context.Context, uuid string) (models.Image, error) {
+	var entries models.Image
+
+	err := repo.DB.WithContext(ctx).Where("uuid = ?", uuid).First(&entries).Error
+
+	return entries, err
+}
+
+func (repo *imageRepo) AddImage(ctx context.Context, image models.Image) (string, error) {
+	result := repo.DB.WithContext(ctx).Create(&image)
 	if result.Error != nil {
 		return "", result.Error
 	}
@@ -38,20 +90,151 @@ func (repo *imageRepo) AddImage(image models.Image) (string, error) {
 	return image.FileName, nil
 }
 
-func (repo *imageRepo) DeleteImage(fileName string) (string, bool) {
-	var image models.Image
+// DeleteImage removes the image, its relations and renditions. It returns
+// gorm.ErrRecordNotFound if there is no image named fileName.
+func (repo *imageRepo) DeleteImage(ctx context.Context, fileName string) (string, error) {
+	var renditions []models.Rendition
+	err := repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var image models.Image
+		if err := tx.Where("file_name = ?", fileName).Take(&image).Error; err != nil {
+			return err
+		}
+		if err := checkUnchanged(ctx, ifUnchanged(ctx, tx).Delete(&image)); err != nil {
+			return err
+		}
+		if err := NewMediaRelationRepo(tx).DeleteRelationsFor(ctx, models.MediaTypeImage, image.ID); err != nil {
+			return err
+		}
+		if err := NewMediaAliasRepo(tx).DeleteAliasesFor(ctx, models.MediaTypeImage, image.UUID); err != nil {
+			return err
+		}
+		if err := NewMediaCommentRepo(tx).DeleteCommentsFor(ctx, models.MediaTypeImage, image.UUID); err != nil {
+			return err
+		}
+		var err error
+		renditions, err = NewRenditionRepo(tx).DeleteRenditionsFor(ctx, models.MediaTypeImage, image.ID)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	removeRenditionFiles(renditions)
+
+	return fileName, nil
+}
 
-	result := repo.DB.Where("file_name = ?", fileName).First(&image)
+// RenameImage renames the image and keeps the old name as an alias of it.
+func (repo *imageRepo) RenameImage(ctx context.Context, oldFileName, newFileName string) error {
+	return repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var image models.Image
+		err := tx.Where("file_name = ?", oldFileName).Limit(1).Find(&image).Error
+		if err != nil {
+			return err
+		}
+		err = checkUnchanged(ctx, ifUnchanged(ctx, tx.Model(&models.Image{}).Where("file_name = ?", oldFileName)).Update("file_name", newFileName))
+		if err != nil {
+			return err
+		}
+		if err := renameAliases(ctx, tx, models.MediaTypeImage, oldFileName, newFileName, image.UUID); err != nil {
+			return err
+		}
+		return NewDownloadStatRepo(tx).RenameDownloadStats(ctx, models.MediaTypeImage, oldFileName, newFileName)
+	})
+}
 
-	if result.Error == nil {
-		repo.DB.Delete(&image)
-		return fileName, true
-	} else {
-		return "", false
-	}
+// UpdateImageChecksum records the checksum of new content written over the
+// image, and clears its MIME type, placeholder and perceptual hash to be
+// computed again
+func (repo *imageRepo) UpdateImageChecksum(ctx context.Context, fileName, algorithm string, checksum []byte) error {
+	return repo.DB.WithContext(ctx).Model(&models.Image{}).Where("file_name = ?", fileName).
+		Updates(map[string]any{"checksum": checksum, "checksum_algorithm": algorithm, "mime_type": "", "blurhash": "", "dominant_color": "", "perceptual_hash": ""}).Error
 }
 
-func (repo *imageRepo) RenameImage(oldFileName, newFileName string) error {
-	image := models.Image{}
-	return repo.DB.Model(&image).Where("file_name = ?", oldFileName).Update("file_name", newFileName).Error
+func (repo *imageRepo) UpdateImageFocalPoint(ctx context.Context, fileName string, x, y *float64) error {
+	q := repo.DB.WithContext(ctx).Model(&models.Image{}).Where("file_name = ?", fileName)
+	return checkUnchanged(ctx, ifUnchanged(ctx, q).Updates(map[string]any{"focal_x": x, "focal_y": y}))
+}
+
+func (repo *imageRepo) UpdateImageDisposition(ctx context.Context, fileName, disposition, downloadName string) error {
+	q := repo.DB.WithContext(ctx).Model(&models.Image{}).Where("file_name = ?", fileName)
+	return checkUnchanged(ctx, ifUnchanged(ctx, q).Updates(map[string]any{"disposition": disposition, "download_name": downloadName}))
+}
+
+func (repo *imageRepo) UpdateImageMimeType(ctx context.Context, fileName, mimeType string) error {
+	return repo.DB.WithContext(ctx).Model(&models.Image{}).Where("file_name = ?", fileName).Update("mime_type", mimeType).Error
+}
+
+func (repo *imageRepo) UpdateImageMetadata(ctx context.Context, fileName string, metadata models.MediaMetadata) error {
+	q := repo.DB.WithContext(ctx).Model(&models.Image{}).Where("file_name = ?", fileName)
+	return checkUnchanged(ctx, ifUnchanged(ctx, q).Updates(map[string]any{
+		"title":       metadata.Title,
+		"alt_text":    metadata.AltText,
+		"description": metadata.Description,
+		"attributes":  []byte(metadata.Attributes),
+	}))
+}
+
+func (repo *imageRepo) UpdateImagePlaceholder(ctx context.Context, fileName, blurhash, dominantColor string) error {
+	return repo.DB.WithContext(ctx).Model(&models.Image{}).Where("file_name = ?", fileName).
+		Updates(map[string]any{"blurhash": blurhash, "dominant_color": dominantColor}).Error
+}
+
+func (repo *imageRepo) GetImagesWithoutPlaceholder(ctx context.Context) ([]string, error) {
+	var names []string
+	err := repo.DB.WithContext(ctx).Model(&models.Image{}).Where("blurhash IS NULL OR blurhash = ''").Pluck("file_name", &names).Error
+	return names, err
+}
+
+func (repo *imageRepo) UpdateImagePerceptualHash(ctx context.Context, fileName, hash string) error {
+	return repo.DB.WithContext(ctx).Model(&models.Image{}).Where("file_name = ?", fileName).Update("perceptual_hash", hash).Error
+}
+
+func (repo *imageRepo) GetImagesWithoutPerceptualHash(ctx context.Context) ([]string, error) {
+	var names []string
+	err := repo.DB.WithContext(ctx).Model(&models.Image{}).Where("perceptual_hash IS NULL OR perceptual_hash = ''").Pluck("file_name", &names).Error
+	return names, err
+}
+
+func (repo *imageRepo) UpdateImageModerationStatus(ctx context.Context, fileName, status string) error {
+	return repo.DB.WithContext(ctx).Model(&models.Image{}).Where("file_name = ?", fileName).Update("moderation_status", status).Error
+}
+
+func (repo *imageRepo) GetImagesByModerationStatus(ctx context.Context, status string) ([]models.Image, error) {
+	var entries []models.Image
+	err := repo.DB.WithContext(ctx).Where("moderation_status = ?", status).Order("created_at, id").Find(&entries).Error
+	return entries, err
+}
+
+func (repo *imageRepo) UpdateImageOptimization(ctx context.Context, fileName string, originalSize, optimizedSize int64, algorithm string, checksum []byte) error {
+	return repo.DB.WithContext(ctx).Model(&models.Image{}).Where("file_name = ?", fileName).
+		Updates(map[string]any{
+			"original_size":      originalSize,
+			"optimized_size":     optimizedSize,
+			"checksum":           checksum,
+			"checksum_algorithm": algorithm,
+		}).Error
+}
+
+// GetExpiredImages returns the images whose expiry time is before now
+func (repo *imageRepo) GetExpiredImages(ctx context.Context, now time.Time) ([]models.Image, error) {
+	var entries []models.Image
+
+	err := repo.DB.WithContext(ctx).Where("expires_at IS NOT NULL AND expires_at <= ?", now).Find(&entries).Error
+
+	return entries, err
+}
+
+// GetImagesPastLifecycle returns the images without an expiry time of their
+// own that were uploaded before createdBefore, only those of the organization
+// if orgID is set
+func (repo *imageRepo) GetImagesPastLifecycle(ctx context.Context, createdBefore time.Time, orgID *uint) ([]models.Image, error) {
+	var entries []models.Image
+
+	query := repo.DB.WithContext(ctx).Where("expires_at IS NULL AND created_at <= ?", createdBefore)
+	if orgID != nil {
+		query = query.Where("organization_id = ?", *orgID)
+	}
+	err := query.Find(&entries).Error
+
+	return entries, err
 }
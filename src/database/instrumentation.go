@@ -0,0 +1,94 @@
+package database
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/utils"
+)
+
+const (
+	defaultSlowQueryThreshold = 200 * time.Millisecond
+	queryStartKey             = "instrumentation:start"
+)
+
+// slowQueryThresholdFromEnv returns the duration set in
+// DB_SLOW_QUERY_THRESHOLD (in milliseconds) above which queries are logged,
+// 200ms by default. 0 disables the log.
+func slowQueryThresholdFromEnv() time.Duration {
+	ms := envInt("DB_SLOW_QUERY_THRESHOLD")
+	if ms < 0 {
+		return defaultSlowQueryThreshold
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// QueryMetrics records the duration of queries per operation, e.g. "query"
+// or "update", and table.
+type QueryMetrics interface {
+	Record(operation, table string, duration time.Duration, failed bool)
+}
+
+// QueryRecorder receives the duration of every query when set, e.g. to
+// metrics.DefaultQueries.
+var QueryRecorder QueryMetrics
+
+// instrumentation is a GORM plugin recording the duration of every query
+// and logging slow queries with their SQL and the code running them. The
+// logged SQL keeps its placeholders, so values such as password hashes
+// don't end up in the log.
+type instrumentation struct {
+	recorder      QueryMetrics
+	slowThreshold time.Duration
+}
+
+func (p *instrumentation) Name() string {
+	return "instrumentation"
+}
+
+func (p *instrumentation) Initialize(db *gorm.DB) error {
+	callbacks := db.Callback()
+	for _, err := range []error{
+		callbacks.Create().Before("*").Register("instrumentation:before_create", p.before),
+		callbacks.Create().After("*").Register("instrumentation:after_create", p.after("create")),
+		callbacks.Query().Before("*").Register("instrumentation:before_query", p.before),
+		callbacks.Query().After("*").Register("instrumentation:after_query", p.after("query")),
+		callbacks.Update().Before("*").Register("instrumentation:before_update", p.before),
+		callbacks.Update().After("*").Register("instrumentation:after_update", p.after("update")),
+		callbacks.Delete().Before("*").Register("instrumentation:before_delete", p.before),
+		callbacks.Delete().After("*").Register("instrumentation:after_delete", p.after("delete")),
+		callbacks.Row().Before("*").Register("instrumentation:before_row", p.before),
+		callbacks.Row().After("*").Register("instrumentation:after_row", p.after("row")),
+		callbacks.Raw().Before("*").Register("instrumentation:before_raw", p.before),
+		callbacks.Raw().After("*").Register("instrumentation:after_raw", p.after("raw")),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *instrumentation) before(db *gorm.DB) {
+	db.InstanceSet(queryStartKey, time.Now())
+}
+
+func (p *instrumentation) after(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		value, ok := db.InstanceGet(queryStartKey)
+		if !ok {
+			return
+		}
+		duration := time.Since(value.(time.Time))
+		if p.recorder != nil {
+			failed := db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound)
+			p.recorder.Record(operation, db.Statement.Table, duration, failed)
+		}
+
+		if p.slowThreshold > 0 && duration >= p.slowThreshold {
+			log.Printf("Slow query (%s) at %s: %s", duration.Round(time.Millisecond), utils.FileWithLineNum(), db.Statement.SQL.String())
+		}
+	}
+}
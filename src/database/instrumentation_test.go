@@ -0,0 +1,44 @@
+package database
+
+import (
+	"bytes"
+	"log"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/kevinanielsen/go-fast-cdn/src/metrics"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestInstrumentation(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	require.NoError(t, err)
+	queries := metrics.NewQueries()
+	require.NoError(t, db.Use(&instrumentation{recorder: queries, slowThreshold: time.Nanosecond}))
+	require.NoError(t, db.AutoMigrate(&widget{}))
+
+	var output bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&output)
+	require.NoError(t, db.Create(&widget{Name: "secret"}).Error)
+	var found widget
+	require.ErrorIs(t, db.Where("name = ?", "missing").First(&found).Error, gorm.ErrRecordNotFound)
+
+	// Slow queries are logged with their caller but without their values
+	require.Contains(t, output.String(), "Slow query")
+	require.Contains(t, output.String(), "instrumentation_test.go")
+	require.Contains(t, output.String(), "INSERT INTO `widgets`")
+	require.NotContains(t, output.String(), "secret")
+
+	counts := map[string]int64{}
+	for _, s := range queries.Stats() {
+		if s.Table == "widgets" {
+			counts[s.Operation] = s.Count
+			require.Zero(t, s.Errors, "missing records aren't errors")
+		}
+	}
+	require.Equal(t, map[string]int64{"create": 1, "query": 1}, counts)
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"gorm.io/gorm"
+)
+
+type JobRepo struct {
+	DB *gorm.DB
+}
+
+func NewJobRepo(db *gorm.DB) models.JobRepository {
+	return &JobRepo{DB: db}
+}
+
+func (repo *JobRepo) AddJob(ctx context.Context, job *models.Job) error {
+	return repo.DB.WithContext(ctx).Create(job).Error
+}
+
+func (repo *JobRepo) ClaimJob(ctx context.Context, now time.Time) (*models.Job, error) {
+	var job models.Job
+	err := repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("status = ? AND run_at <= ?", models.JobStatusQueued, now).Order("run_at, id").First(&job).Error
+		if err != nil {
+			return err
+		}
+		// Only one worker, possibly of another instance, wins the job
+		result := tx.Model(&job).Where("status = ?", models.JobStatusQueued).Update("status", models.JobStatusRunning)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (repo *JobRepo) UpdateJob(ctx context.Context, job *models.Job) error {
+	return repo.DB.WithContext(ctx).Save(job).Error
+}
+
+func (repo *JobRepo) GetJob(ctx context.Context, id uint) (*models.Job, error) {
+	var job models.Job
+	if err := repo.DB.WithContext(ctx).First(&job, id).Error; err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (repo *JobRepo) GetJobs(ctx context.Context, status string, limit int) ([]models.Job, error) {
+	jobs := []models.Job{}
+	query := repo.DB.WithContext(ctx).Order("id DESC").Limit(limit)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err := query.Find(&jobs).Error
+	return jobs, err
+}
+
+func (repo *JobRepo) RequeueRunningJobs(ctx context.Context) (int64, error) {
+	result := repo.DB.WithContext(ctx).Model(&models.Job{}).Where("status = ?", models.JobStatusRunning).Update("status", models.JobStatusQueued)
+	return result.RowsAffected, result.Error
+}
+
+func (repo *JobRepo) DeleteFinishedJobs(ctx context.Context, before time.Time) error {
+	return repo.DB.WithContext(ctx).Unscoped().Where("status = ? AND finished_at < ?", models.JobStatusDone, before).Delete(&models.Job{}).Error
+}
@@ -0,0 +1,48 @@
+package database
+
+import (
+	"context"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"gorm.io/gorm"
+)
+
+type LifecycleRuleRepo struct {
+	DB *gorm.DB
+}
+
+func NewLifecycleRuleRepo(db *gorm.DB) models.LifecycleRuleRepository {
+	return &LifecycleRuleRepo{DB: db}
+}
+
+func (repo *LifecycleRuleRepo) GetAllLifecycleRules(ctx context.Context) ([]models.LifecycleRule, error) {
+	var rules []models.LifecycleRule
+	err := repo.DB.WithContext(ctx).Order("name").Find(&rules).Error
+	return rules, err
+}
+
+func (repo *LifecycleRuleRepo) GetLifecycleRuleByName(ctx context.Context, name string) (*models.LifecycleRule, error) {
+	var rule models.LifecycleRule
+	if err := repo.DB.WithContext(ctx).Where("name = ?", name).First(&rule).Error; err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+func (repo *LifecycleRuleRepo) CreateLifecycleRule(ctx context.Context, rule *models.LifecycleRule) error {
+	return repo.DB.WithContext(ctx).Create(rule).Error
+}
+
+func (repo *LifecycleRuleRepo) UpdateLifecycleRule(ctx context.Context, rule *models.LifecycleRule) error {
+	return repo.DB.WithContext(ctx).Save(rule).Error
+}
+
+func (repo *LifecycleRuleRepo) DeleteLifecycleRule(ctx context.Context, name string) error {
+	result := repo.DB.WithContext(ctx).Unscoped().Where("name = ?", name).Delete(&models.LifecycleRule{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package database
+
+import (
+	"context"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type MediaAliasRepo struct {
+	DB *gorm.DB
+}
+
+func NewMediaAliasRepo(db *gorm.DB) models.MediaAliasRepository {
+	return &MediaAliasRepo{DB: db}
+}
+
+func (repo *MediaAliasRepo) GetAlias(ctx context.Context, mediaType, fileName string) (models.MediaAlias, error) {
+	var alias models.MediaAlias
+	err := repo.DB.WithContext(ctx).Where("media_type = ? AND file_name = ?", mediaType, fileName).First(&alias).Error
+	return alias, err
+}
+
+func (repo *MediaAliasRepo) AddAlias(ctx context.Context, mediaType, fileName, mediaUUID string) error {
+	alias := models.MediaAlias{MediaType: mediaType, FileName: fileName, MediaUUID: mediaUUID}
+	return repo.DB.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "media_type"}, {Name: "file_name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"media_uuid", "created_at"}),
+	}).Create(&alias).Error
+}
+
+func (repo *MediaAliasRepo) DeleteAlias(ctx context.Context, mediaType, fileName string) error {
+	return repo.DB.WithContext(ctx).Where("media_type = ? AND file_name = ?", mediaType, fileName).Delete(&models.MediaAlias{}).Error
+}
+
+func (repo *MediaAliasRepo) DeleteAliasesFor(ctx context.Context, mediaType, mediaUUID string) error {
+	return repo.DB.WithContext(ctx).Where("media_type = ? AND media_uuid = ?", mediaType, mediaUUID).Delete(&models.MediaAlias{}).Error
+}
+
+// renameAliases makes oldFileName an alias of the media now named
+// newFileName, which stops being an alias itself.
+func renameAliases(ctx context.Context, tx *gorm.DB, mediaType, oldFileName, newFileName, mediaUUID string) error {
+	aliases := NewMediaAliasRepo(tx)
+	if err := aliases.DeleteAlias(ctx, mediaType, newFileName); err != nil {
+		return err
+	}
+	if mediaUUID == "" {
+		return nil
+	}
+	return aliases.AddAlias(ctx, mediaType, oldFileName, mediaUUID)
+}
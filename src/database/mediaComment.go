@@ -0,0 +1,48 @@
+package database
+
+import (
+	"context"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"gorm.io/gorm"
+)
+
+type MediaCommentRepo struct {
+	DB *gorm.DB
+}
+
+func NewMediaCommentRepo(db *gorm.DB) models.MediaCommentRepository {
+	return &MediaCommentRepo{DB: db}
+}
+
+func (repo *MediaCommentRepo) GetComments(ctx context.Context, mediaType, mediaUUID string) ([]models.MediaComment, error) {
+	comments := []models.MediaComment{}
+	err := repo.DB.WithContext(ctx).Where("media_type = ? AND media_uuid = ?", mediaType, mediaUUID).Order("created_at, id").Find(&comments).Error
+	return comments, err
+}
+
+func (repo *MediaCommentRepo) GetComment(ctx context.Context, id uint) (models.MediaComment, error) {
+	var comment models.MediaComment
+	err := repo.DB.WithContext(ctx).Take(&comment, id).Error
+	return comment, err
+}
+
+func (repo *MediaCommentRepo) AddComment(ctx context.Context, comment *models.MediaComment) error {
+	return repo.DB.WithContext(ctx).Create(comment).Error
+}
+
+func (repo *MediaCommentRepo) UpdateComment(ctx context.Context, comment *models.MediaComment) error {
+	return repo.DB.WithContext(ctx).Save(comment).Error
+}
+
+func (repo *MediaCommentRepo) DeleteComment(ctx context.Context, id uint) error {
+	result := repo.DB.WithContext(ctx).Delete(&models.MediaComment{}, id)
+	if result.Error == nil && result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return result.Error
+}
+
+func (repo *MediaCommentRepo) DeleteCommentsFor(ctx context.Context, mediaType, mediaUUID string) error {
+	return repo.DB.WithContext(ctx).Where("media_type = ? AND media_uuid = ?", mediaType, mediaUUID).Delete(&models.MediaComment{}).Error
+}
@@ -0,0 +1,100 @@
+package database
+
+import (
+	"context"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"gorm.io/gorm"
+)
+
+type MediaRelationRepo struct {
+	DB *gorm.DB
+}
+
+func NewMediaRelationRepo(db *gorm.DB) models.MediaRelationRepository {
+	return &MediaRelationRepo{DB: db}
+}
+
+// GetRelated returns every relation in which the given media takes part,
+// resolved to the file name of the media on the other end. Relations whose
+// other end no longer exists are skipped.
+func (repo *MediaRelationRepo) GetRelated(ctx context.Context, mediaType string, mediaID uint) ([]models.RelatedMedia, error) {
+	var relations []models.MediaRelation
+
+	err := repo.DB.WithContext(ctx).Where("(source_type = ? AND source_id = ?) OR (target_type = ? AND target_id = ?)",
+		mediaType, mediaID, mediaType, mediaID).Order("id").Find(&relations).Error
+	if err != nil {
+		return nil, err
+	}
+
+	related := []models.RelatedMedia{}
+	for _, relation := range relations {
+		entry := models.RelatedMedia{
+			ID:        relation.ID,
+			Relation:  relation.Relation,
+			Direction: "outgoing",
+			Type:      relation.TargetType,
+		}
+		otherID := relation.TargetID
+		if relation.SourceType != mediaType || relation.SourceID != mediaID {
+			entry.Direction = "incoming"
+			entry.Type = relation.SourceType
+			otherID = relation.SourceID
+		}
+
+		fileName, err := repo.fileNameOf(ctx, entry.Type, otherID)
+		if err != nil {
+			continue
+		}
+		entry.FileName = fileName
+		related = append(related, entry)
+	}
+
+	return related, nil
+}
+
+func (repo *MediaRelationRepo) AddRelation(ctx context.Context, relation *models.MediaRelation) error {
+	return repo.DB.WithContext(ctx).Create(relation).Error
+}
+
+func (repo *MediaRelationRepo) DeleteRelation(ctx context.Context, mediaType string, mediaID uint, relationID uint) error {
+	result := repo.DB.WithContext(ctx).Where("id = ? AND ((source_type = ? AND source_id = ?) OR (target_type = ? AND target_id = ?))",
+		relationID, mediaType, mediaID, mediaType, mediaID).Delete(&models.MediaRelation{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// DeleteRelationsFor removes all relations pointing to or from the given
+// media. It is called when the media itself is deleted.
+func (repo *MediaRelationRepo) DeleteRelationsFor(ctx context.Context, mediaType string, mediaID uint) error {
+	return repo.DB.WithContext(ctx).Where("(source_type = ? AND source_id = ?) OR (target_type = ? AND target_id = ?)",
+		mediaType, mediaID, mediaType, mediaID).Delete(&models.MediaRelation{}).Error
+}
+
+func (repo *MediaRelationRepo) fileNameOf(ctx context.Context, mediaType string, id uint) (string, error) {
+	var fileName string
+
+	switch mediaType {
+	case models.MediaTypeImage:
+		var image models.Image
+		if err := repo.DB.WithContext(ctx).Select("file_name").First(&image, id).Error; err != nil {
+			return "", err
+		}
+		fileName = image.FileName
+	case models.MediaTypeDoc:
+		var doc models.Doc
+		if err := repo.DB.WithContext(ctx).Select("file_name").First(&doc, id).Error; err != nil {
+			return "", err
+		}
+		fileName = doc.FileName
+	default:
+		return "", gorm.ErrRecordNotFound
+	}
+
+	return fileName, nil
+}
@@ -0,0 +1,157 @@
+package database
+
+import (
+	"context"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"gorm.io/gorm"
+)
+
+type MediaTransferRepo struct {
+	DB *gorm.DB
+}
+
+func NewMediaTransferRepo(db *gorm.DB) models.MediaTransferRepository {
+	return &MediaTransferRepo{DB: db}
+}
+
+// TransferMedia keeps the UUID, aliases and comments of media moved within
+// its folder. Media moved to the other folder keep their UUID and comments,
+// but lose their relations, aliases and renditions, which are specific to
+// the media type. Copies start without any of them.
+func (repo *MediaTransferRepo) TransferMedia(ctx context.Context, transfer models.MediaTransfer, transferFile func() error) (string, error) {
+	var targetUUID string
+	var renditions []models.Rendition
+	err := repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		source, err := takeTransferSource(tx, transfer.SourceType, transfer.SourceFileName)
+		if err != nil {
+			return err
+		}
+		sourceID, sourceUUID := source.ID, source.UUID
+
+		switch {
+		case !transfer.Copy && transfer.SourceType == transfer.TargetType:
+			err = moveWithinFolder(ctx, tx, transfer, sourceID, sourceUUID)
+			targetUUID = sourceUUID
+		default:
+			target := transferTarget(source, transfer)
+			if transfer.Copy {
+				target.UUID = ""
+			}
+			if targetUUID, err = createTransferTarget(tx, transfer.TargetType, target); err != nil {
+				return err
+			}
+			if !transfer.Copy {
+				renditions, err = deleteMovedSource(ctx, tx, transfer, sourceID, sourceUUID)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		return transferFile()
+	})
+	if err != nil {
+		return "", err
+	}
+	removeRenditionFiles(renditions)
+
+	return targetUUID, nil
+}
+
+// takeTransferSource returns the image or document named fileName. Documents
+// are returned as images with the fields documents lack left empty.
+func takeTransferSource(tx *gorm.DB, mediaType, fileName string) (models.Image, error) {
+	var image models.Image
+	if mediaType == models.MediaTypeImage {
+		err := tx.Where("file_name = ?", fileName).Take(&image).Error
+		return image, err
+	}
+
+	var doc models.Doc
+	if err := tx.Where("file_name = ?", fileName).Take(&doc).Error; err != nil {
+		return image, err
+	}
+	return models.Image{
+		Model: doc.Model, UUID: doc.UUID, FileName: doc.FileName, OriginalName: doc.OriginalName,
+		Disposition: doc.Disposition, DownloadName: doc.DownloadName, MimeType: doc.MimeType,
+		Checksum: doc.Checksum, ChecksumAlgorithm: doc.ChecksumAlgorithm, OrganizationID: doc.OrganizationID,
+		ModerationStatus: doc.ModerationStatus, IntegrityStatus: doc.IntegrityStatus,
+		VerifiedAt: doc.VerifiedAt, ExpiresAt: doc.ExpiresAt, MediaMetadata: doc.MediaMetadata,
+	}, nil
+}
+
+// transferTarget returns the record of the target of the transfer. Moved
+// media keep their upload date, while copies are checked for integrity
+// anew.
+func transferTarget(source models.Image, transfer models.MediaTransfer) models.Image {
+	target := source
+	target.Model = gorm.Model{}
+	if !transfer.Copy {
+		target.CreatedAt = source.CreatedAt
+	} else {
+		target.IntegrityStatus, target.VerifiedAt = "", nil
+	}
+	target.FileName = transfer.TargetFileName
+	target.OrganizationID = transfer.OrganizationID
+	return target
+}
+
+func createTransferTarget(tx *gorm.DB, mediaType string, target models.Image) (string, error) {
+	if mediaType == models.MediaTypeImage {
+		err := tx.Create(&target).Error
+		return target.UUID, err
+	}
+
+	doc := models.Doc{
+		Model: target.Model, UUID: target.UUID, FileName: target.FileName, OriginalName: target.OriginalName,
+		Disposition: target.Disposition, DownloadName: target.DownloadName, MimeType: target.MimeType,
+		Checksum: target.Checksum, ChecksumAlgorithm: target.ChecksumAlgorithm, OrganizationID: target.OrganizationID,
+		ModerationStatus: target.ModerationStatus, IntegrityStatus: target.IntegrityStatus,
+		VerifiedAt: target.VerifiedAt, ExpiresAt: target.ExpiresAt, MediaMetadata: target.MediaMetadata,
+	}
+	err := tx.Create(&doc).Error
+	return doc.UUID, err
+}
+
+// moveWithinFolder renames the media and hands it to the organization of the
+// transfer, keeping the old name as an alias like RenameImage.
+func moveWithinFolder(ctx context.Context, tx *gorm.DB, transfer models.MediaTransfer, sourceID uint, sourceUUID string) error {
+	model := any(&models.Image{})
+	if transfer.SourceType == models.MediaTypeDoc {
+		model = &models.Doc{}
+	}
+	err := checkUnchanged(ctx, ifUnchanged(ctx, tx.Model(model).Where("id = ?", sourceID)).
+		Updates(map[string]any{"file_name": transfer.TargetFileName, "organization_id": transfer.OrganizationID}))
+	if err != nil || transfer.TargetFileName == transfer.SourceFileName {
+		return err
+	}
+	if err := renameAliases(ctx, tx, transfer.SourceType, transfer.SourceFileName, transfer.TargetFileName, sourceUUID); err != nil {
+		return err
+	}
+	return NewDownloadStatRepo(tx).RenameDownloadStats(ctx, transfer.SourceType, transfer.SourceFileName, transfer.TargetFileName)
+}
+
+// deleteMovedSource removes the source of media moved to the other folder,
+// handing its comments to the target. It returns the deleted renditions,
+// whose files are removed once the transaction is committed.
+func deleteMovedSource(ctx context.Context, tx *gorm.DB, transfer models.MediaTransfer, sourceID uint, sourceUUID string) ([]models.Rendition, error) {
+	model := any(&models.Image{})
+	if transfer.SourceType == models.MediaTypeDoc {
+		model = &models.Doc{}
+	}
+	if err := checkUnchanged(ctx, ifUnchanged(ctx, tx).Delete(model, sourceID)); err != nil {
+		return nil, err
+	}
+	err := tx.Model(&models.MediaComment{}).Where("media_type = ? AND media_uuid = ?", transfer.SourceType, sourceUUID).
+		Update("media_type", transfer.TargetType).Error
+	if err != nil {
+		return nil, err
+	}
+	if err := NewMediaRelationRepo(tx).DeleteRelationsFor(ctx, transfer.SourceType, sourceID); err != nil {
+		return nil, err
+	}
+	if err := NewMediaAliasRepo(tx).DeleteAliasesFor(ctx, transfer.SourceType, sourceUUID); err != nil {
+		return nil, err
+	}
+	return NewRenditionRepo(tx).DeleteRenditionsFor(ctx, transfer.SourceType, sourceID)
+}
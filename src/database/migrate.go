@@ -1,9 +1,15 @@
 package database
 
-import "github.com/kevinanielsen/go-fast-cdn/src/models"
+import "log"
 
-// Migrate runs database migrations for all model structs using
-// the global DB instance. This would typically be called on app startup.
+// Migrate applies the pending migrations to the global DB instance. This
+// would typically be called on app startup.
 func Migrate() {
-	DB.AutoMigrate(&models.Image{}, &models.Doc{}, &models.User{}, &models.UserSession{}, &models.PasswordReset{})
+	if SkipMigrations {
+		log.Println("Skipping database migrations")
+		return
+	}
+	if err := migrateSchema(DB); err != nil {
+		log.Fatalf("Failed to migrate the database: %s", err.Error())
+	}
 }
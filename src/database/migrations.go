@@ -0,0 +1,304 @@
+package database
+
+import (
+	"github.com/go-gormigrate/gormigrate/v2"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"gorm.io/gorm"
+)
+
+// Migrations lists the schema changes of the database. Append a migration
+// for every change of the models rather than editing applied ones.
+var Migrations = []*gormigrate.Migration{
+	{
+		// The schema AutoMigrate created before migrations were versioned.
+		// It is safe to apply to databases created back then.
+		ID: "0001_initial_schema",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(initialModels...)
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(initialModels...)
+		},
+	},
+	{
+		ID: "0002_media_uuids",
+		Migrate: func(tx *gorm.DB) error {
+			backfillMediaUUIDs(tx)
+			return nil
+		},
+		// The UUIDs are kept, as links may already use them
+		Rollback: func(tx *gorm.DB) error {
+			return nil
+		},
+	},
+	{
+		ID:      "0003_search_index",
+		Migrate: ensureSearchIndex,
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Exec("DROP TABLE IF EXISTS " + searchTable).Error
+		},
+	},
+	{
+		ID: "0004_media_aliases",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.MediaAlias{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&models.MediaAlias{})
+		},
+	},
+	{
+		ID: "0005_image_optimization",
+		Migrate: func(tx *gorm.DB) error {
+			for _, column := range []string{"OriginalSize", "OptimizedSize"} {
+				if !tx.Migrator().HasColumn(&models.Image{}, column) {
+					if err := tx.Migrator().AddColumn(&models.Image{}, column); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+		Rollback: func(tx *gorm.DB) error {
+			for _, column := range []string{"OriginalSize", "OptimizedSize"} {
+				if err := tx.Migrator().DropColumn(&models.Image{}, column); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		ID: "0006_mime_type_rules",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.MimeTypeRule{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&models.MimeTypeRule{})
+		},
+	},
+	{
+		ID: "0007_lifecycle_rules",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.LifecycleRule{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&models.LifecycleRule{})
+		},
+	},
+	{
+		ID: "0008_media_metadata",
+		Migrate: func(tx *gorm.DB) error {
+			for _, model := range []any{&models.Image{}, &models.Doc{}} {
+				for _, column := range mediaMetadataColumns {
+					if !tx.Migrator().HasColumn(model, column) {
+						if err := tx.Migrator().AddColumn(model, column); err != nil {
+							return err
+						}
+					}
+				}
+			}
+			return nil
+		},
+		Rollback: func(tx *gorm.DB) error {
+			for _, model := range []any{&models.Image{}, &models.Doc{}} {
+				for _, column := range mediaMetadataColumns {
+					if err := tx.Migrator().DropColumn(model, column); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+	},
+	{
+		ID: "0009_galleries",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.Gallery{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&models.Gallery{})
+		},
+	},
+	{
+		ID: "0010_image_placeholders",
+		Migrate: func(tx *gorm.DB) error {
+			for _, column := range []string{"Blurhash", "DominantColor"} {
+				if !tx.Migrator().HasColumn(&models.Image{}, column) {
+					if err := tx.Migrator().AddColumn(&models.Image{}, column); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+		Rollback: func(tx *gorm.DB) error {
+			for _, column := range []string{"Blurhash", "DominantColor"} {
+				if err := tx.Migrator().DropColumn(&models.Image{}, column); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		ID: "0011_image_perceptual_hashes",
+		Migrate: func(tx *gorm.DB) error {
+			if tx.Migrator().HasColumn(&models.Image{}, "PerceptualHash") {
+				return nil
+			}
+			return tx.Migrator().AddColumn(&models.Image{}, "PerceptualHash")
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&models.Image{}, "PerceptualHash")
+		},
+	},
+	{
+		ID: "0012_media_indexes",
+		Migrate: func(tx *gorm.DB) error {
+			for _, table := range []string{"images", "docs"} {
+				for _, index := range mediaIndexes {
+					if err := tx.Exec("CREATE INDEX IF NOT EXISTS idx_" + table + "_" + index.Name + " ON " + table + " (" + index.Columns + ")").Error; err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+		Rollback: func(tx *gorm.DB) error {
+			for _, table := range []string{"images", "docs"} {
+				for _, index := range mediaIndexes {
+					if err := tx.Exec("DROP INDEX IF EXISTS idx_" + table + "_" + index.Name).Error; err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+	},
+	{
+		ID: "0013_media_moderation",
+		Migrate: func(tx *gorm.DB) error {
+			for _, model := range []any{&models.Image{}, &models.Doc{}} {
+				if !tx.Migrator().HasColumn(model, "ModerationStatus") {
+					if err := tx.Migrator().AddColumn(model, "ModerationStatus"); err != nil {
+						return err
+					}
+				}
+				if !tx.Migrator().HasIndex(model, "ModerationStatus") {
+					if err := tx.Migrator().CreateIndex(model, "ModerationStatus"); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+		Rollback: func(tx *gorm.DB) error {
+			for _, model := range []any{&models.Image{}, &models.Doc{}} {
+				if err := tx.Migrator().DropIndex(model, "ModerationStatus"); err != nil {
+					return err
+				}
+				if err := tx.Migrator().DropColumn(model, "ModerationStatus"); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		ID: "0014_media_comments",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.MediaComment{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&models.MediaComment{})
+		},
+	},
+	{
+		ID: "0015_share_link_limits",
+		Migrate: func(tx *gorm.DB) error {
+			for _, column := range shareLinkLimitColumns {
+				if !tx.Migrator().HasColumn(&models.ShareLink{}, column) {
+					if err := tx.Migrator().AddColumn(&models.ShareLink{}, column); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+		Rollback: func(tx *gorm.DB) error {
+			for _, column := range shareLinkLimitColumns {
+				if err := tx.Migrator().DropColumn(&models.ShareLink{}, column); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		ID: "0016_rendition_last_access",
+		Migrate: func(tx *gorm.DB) error {
+			if tx.Migrator().HasColumn(&models.Rendition{}, "LastAccessedAt") {
+				return nil
+			}
+			return tx.Migrator().AddColumn(&models.Rendition{}, "LastAccessedAt")
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&models.Rendition{}, "LastAccessedAt")
+		},
+	},
+	{
+		ID: "0017_direct_uploads",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.DirectUpload{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&models.DirectUpload{})
+		},
+	},
+	{
+		ID: "0018_groups",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.Group{}, &models.GroupMember{}, &models.FolderPermission{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&models.FolderPermission{}, &models.GroupMember{}, &models.Group{})
+		},
+	},
+	{
+		ID: "0020_upload_preset_transforms",
+		Migrate: func(tx *gorm.DB) error {
+			if tx.Migrator().HasColumn(&models.UploadPreset{}, "TransformPreset") {
+				return nil
+			}
+			return tx.Migrator().AddColumn(&models.UploadPreset{}, "TransformPreset")
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&models.UploadPreset{}, "TransformPreset")
+		},
+	},
+}
+
+// mediaIndexes are the indexes of the media lookups by checksum and name,
+// and of their listings by upload time, optionally of an organization.
+var mediaIndexes = []struct{ Name, Columns string }{
+	{"checksum", "checksum"},
+	{"file_name", "file_name"},
+	{"created_at", "created_at"},
+	{"organization_id_created_at", "organization_id, created_at"},
+}
+
+// mediaMetadataColumns are the fields of models.MediaMetadata.
+var mediaMetadataColumns = []string{"Title", "AltText", "Description", "Attributes"}
+
+// shareLinkLimitColumns are the fields protecting share links with a
+// password and a download limit.
+var shareLinkLimitColumns = []string{"PasswordHash", "MaxDownloads", "DownloadCount"}
+
+var initialModels = []any{
+	&models.Image{}, &models.Doc{}, &models.Config{}, &models.MediaRelation{}, &models.ShareLink{}, &models.ShareLinkFile{},
+	&models.UploadPreset{}, &models.TransformPreset{}, &models.Takedown{}, &models.Tripwire{}, &models.Organization{},
+	&models.ServiceAccount{}, &models.APIKey{}, &models.AuditLog{}, &models.User{}, &models.UserSession{},
+	&models.PasswordReset{}, &models.BackupCode{}, &models.RepairTask{}, &models.Job{}, &models.DownloadStat{},
+	&models.Rendition{},
+}
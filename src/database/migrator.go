@@ -0,0 +1,195 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"gorm.io/gorm"
+)
+
+// ErrIrreversible is returned when rolling back a migration without
+// Rollback.
+var ErrIrreversible = gormigrate.ErrRollbackImpossible
+
+// MigrationStatus tells whether a migration was applied.
+type MigrationStatus struct {
+	ID        string     `json:"id"`
+	AppliedAt *time.Time `json:"applied_at"`
+	// Unknown is set for applied migrations missing from this version, e.g.
+	// after a downgrade.
+	Unknown bool `json:"unknown,omitempty"`
+}
+
+// Migrator applies and rolls back migrations with gormigrate. Migrations
+// run in the order of their IDs, e.g. "0001_initial_schema", in a
+// transaction per call, and are recorded in the schema_migrations table so
+// each runs once. Migrations without Rollback cannot be rolled back.
+type Migrator struct {
+	db         *gorm.DB
+	migrations []*gormigrate.Migration
+}
+
+// NewMigrator returns a migrator of db, sorting the migrations by ID.
+func NewMigrator(db *gorm.DB, migrations []*gormigrate.Migration) *Migrator {
+	sorted := append([]*gormigrate.Migration(nil), migrations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+	return &Migrator{db: db, migrations: sorted}
+}
+
+// gormigrate returns the gormigrate of migrations, which name the migration
+// failing in their errors.
+func (m *Migrator) gormigrate(migrations []*gormigrate.Migration) *gormigrate.Gormigrate {
+	named := make([]*gormigrate.Migration, len(migrations))
+	for i, migration := range migrations {
+		migration := *migration
+		if up := migration.Migrate; up != nil {
+			migration.Migrate = func(tx *gorm.DB) error {
+				if err := up(tx); err != nil {
+					return fmt.Errorf("migration %s: %w", migration.ID, err)
+				}
+				return nil
+			}
+		}
+		named[i] = &migration
+	}
+	return gormigrate.New(m.db, &gormigrate.Options{
+		TableName:                 "schema_migrations",
+		UseTransaction:            true,
+		ValidateUnknownMigrations: true,
+	}, named)
+}
+
+// applied returns when each applied migration was applied, by ID. The
+// table is created with the time gormigrate leaves out defaulting to the
+// insertion time.
+func (m *Migrator) applied() (map[string]time.Time, error) {
+	if err := m.db.AutoMigrate(&models.SchemaMigration{}); err != nil {
+		return nil, err
+	}
+	var rows []models.SchemaMigration
+	if err := m.db.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[string]time.Time, len(rows))
+	for _, row := range rows {
+		applied[row.ID] = row.AppliedAt
+	}
+	return applied, nil
+}
+
+// Status returns every migration, oldest first, followed by the applied
+// migrations this version does not know.
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := MigrationStatus{ID: migration.ID}
+		if at, ok := applied[migration.ID]; ok {
+			status.AppliedAt = &at
+			delete(applied, migration.ID)
+		}
+		statuses = append(statuses, status)
+	}
+	unknown := make([]string, 0, len(applied))
+	for id := range applied {
+		unknown = append(unknown, id)
+	}
+	sort.Strings(unknown)
+	for _, id := range unknown {
+		at := applied[id]
+		statuses = append(statuses, MigrationStatus{ID: id, AppliedAt: &at, Unknown: true})
+	}
+	return statuses, nil
+}
+
+// Up applies the pending migrations up to and including target, or all of
+// them if target is empty, and returns the IDs of those it applied. They
+// are applied together: if one fails, none is. It refuses to run on a
+// database with migrations this version does not know.
+func (m *Migrator) Up(target string) ([]string, error) {
+	statuses, err := m.Status()
+	if err != nil {
+		return nil, err
+	}
+	if target != "" && !m.has(target) {
+		return nil, fmt.Errorf("unknown migration %q", target)
+	}
+	for _, status := range statuses {
+		if status.Unknown {
+			return nil, fmt.Errorf("the database has migration %s, which this version does not know", status.ID)
+		}
+	}
+
+	var pending []string
+	for i, migration := range m.migrations {
+		if statuses[i].AppliedAt == nil {
+			pending = append(pending, migration.ID)
+		}
+		if migration.ID == target {
+			break
+		}
+	}
+	if len(pending) == 0 {
+		return nil, nil
+	}
+
+	g := m.gormigrate(m.migrations)
+	if target == "" {
+		err = g.Migrate()
+	} else {
+		err = g.MigrateTo(target)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return pending, nil
+}
+
+// Down rolls back the last steps applied migrations, newest first, and
+// returns the IDs of those it rolled back.
+func (m *Migrator) Down(steps int) ([]string, error) {
+	statuses, err := m.Status()
+	if err != nil {
+		return nil, err
+	}
+
+	g := m.gormigrate(m.migrations)
+	var done []string
+	for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		if statuses[i].AppliedAt == nil {
+			continue
+		}
+		migration := m.migrations[i]
+		if err := g.RollbackMigration(migration); err != nil {
+			return done, fmt.Errorf("migration %s: %w", migration.ID, err)
+		}
+		done = append(done, migration.ID)
+	}
+	return done, nil
+}
+
+func (m *Migrator) has(id string) bool {
+	for _, migration := range m.migrations {
+		if migration.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// migrateSchema applies the pending migrations to db, logging each one.
+func migrateSchema(db *gorm.DB) error {
+	applied, err := NewMigrator(db, Migrations).Up("")
+	for _, id := range applied {
+		log.Printf("Applied migration %s", id)
+	}
+	return err
+}
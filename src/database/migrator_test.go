@@ -0,0 +1,112 @@
+package database
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/go-gormigrate/gormigrate/v2"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type widget struct {
+	ID   uint
+	Name string
+}
+
+func TestMigrator(t *testing.T) {
+	util.ExPath = t.TempDir()
+	ConnectToDB()
+
+	statuses, err := NewMigrator(DB, Migrations).Status()
+	require.NoError(t, err)
+	for _, status := range statuses {
+		require.NotNil(t, status.AppliedAt, status.ID)
+		require.False(t, status.AppliedAt.IsZero(), status.ID)
+	}
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	require.NoError(t, err)
+	migrations := []*gormigrate.Migration{
+		{
+			ID: "0002_widget_index",
+			Migrate: func(tx *gorm.DB) error {
+				return tx.Exec("CREATE INDEX idx_widget_name ON widgets (name)").Error
+			},
+		},
+		{
+			ID: "0001_widgets",
+			Migrate: func(tx *gorm.DB) error {
+				return tx.Migrator().CreateTable(&widget{})
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable(&widget{})
+			},
+		},
+		{
+			ID: "0003_broken",
+			Migrate: func(tx *gorm.DB) error {
+				if err := tx.Exec("ALTER TABLE widgets ADD COLUMN size integer").Error; err != nil {
+					return err
+				}
+				return errors.New("boom")
+			},
+		},
+	}
+	m := NewMigrator(db, migrations[:2])
+
+	_, err = m.Up("0009_missing")
+	require.Error(t, err)
+	applied, err := m.Up("0001_widgets")
+	require.NoError(t, err)
+	require.Equal(t, []string{"0001_widgets"}, applied)
+	applied, err = m.Up("")
+	require.NoError(t, err)
+	require.Equal(t, []string{"0002_widget_index"}, applied)
+	applied, err = m.Up("")
+	require.NoError(t, err)
+	require.Empty(t, applied)
+
+	// A failing migration is rolled back and not recorded
+	_, err = NewMigrator(db, migrations).Up("")
+	require.ErrorContains(t, err, "boom")
+	require.False(t, db.Migrator().HasColumn(&widget{}, "size"))
+
+	// Rolling back stops at migrations without Down
+	_, err = m.Down(2)
+	require.ErrorIs(t, err, ErrIrreversible)
+	require.True(t, db.Migrator().HasTable(&widget{}))
+
+	// Migrations of a newer version block Up
+	_, err = NewMigrator(db, migrations[1:2]).Up("")
+	require.ErrorContains(t, err, "0002_widget_index")
+	statuses, err = NewMigrator(db, migrations[1:2]).Status()
+	require.NoError(t, err)
+	require.True(t, statuses[len(statuses)-1].Unknown)
+
+	require.NoError(t, db.Exec("DROP INDEX idx_widget_name").Error)
+	require.NoError(t, db.Exec("DELETE FROM schema_migrations WHERE id = ?", "0002_widget_index").Error)
+	reverted, err := m.Down(1)
+	require.NoError(t, err)
+	require.Equal(t, []string{"0001_widgets"}, reverted)
+	require.False(t, db.Migrator().HasTable(&widget{}))
+}
+
+func TestMediaIndexes(t *testing.T) {
+	util.ExPath = t.TempDir()
+	ConnectToDB()
+
+	for _, query := range []string{
+		"SELECT * FROM images WHERE checksum = ? AND deleted_at IS NULL ORDER BY id LIMIT 1",
+		"SELECT * FROM docs WHERE file_name = ? AND deleted_at IS NULL LIMIT 1",
+		"SELECT * FROM images WHERE expires_at IS NULL AND created_at <= ? AND organization_id = ?",
+	} {
+		var plans []struct{ Detail string }
+		require.NoError(t, DB.Raw("EXPLAIN QUERY PLAN "+query, "x", 1).Scan(&plans).Error)
+		require.NotEmpty(t, plans)
+		require.Contains(t, plans[0].Detail, "USING INDEX", query)
+	}
+}
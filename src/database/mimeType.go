@@ -0,0 +1,44 @@
+package database
+
+import (
+	"context"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"gorm.io/gorm"
+)
+
+type MimeTypeRuleRepo struct {
+	DB *gorm.DB
+}
+
+func NewMimeTypeRuleRepo(db *gorm.DB) models.MimeTypeRuleRepository {
+	return &MimeTypeRuleRepo{DB: db}
+}
+
+func (repo *MimeTypeRuleRepo) GetAllMimeTypeRules(ctx context.Context) ([]models.MimeTypeRule, error) {
+	var rules []models.MimeTypeRule
+	err := repo.DB.WithContext(ctx).Order("extension").Find(&rules).Error
+	return rules, err
+}
+
+func (repo *MimeTypeRuleRepo) GetMimeTypeRule(ctx context.Context, extension string) (*models.MimeTypeRule, error) {
+	var rule models.MimeTypeRule
+	if err := repo.DB.WithContext(ctx).Where("extension = ?", extension).First(&rule).Error; err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+func (repo *MimeTypeRuleRepo) SaveMimeTypeRule(ctx context.Context, rule *models.MimeTypeRule) error {
+	return repo.DB.WithContext(ctx).Save(rule).Error
+}
+
+func (repo *MimeTypeRuleRepo) DeleteMimeTypeRule(ctx context.Context, extension string) error {
+	result := repo.DB.WithContext(ctx).Unscoped().Where("extension = ?", extension).Delete(&models.MimeTypeRule{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
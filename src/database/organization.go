@@ -0,0 +1,44 @@
+package database
+
+import (
+	"context"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"gorm.io/gorm"
+)
+
+type OrganizationRepo struct {
+	DB *gorm.DB
+}
+
+func NewOrganizationRepo(db *gorm.DB) models.OrganizationRepository {
+	return &OrganizationRepo{DB: db}
+}
+
+func (repo *OrganizationRepo) GetAllOrganizations(ctx context.Context) ([]models.Organization, error) {
+	var orgs []models.Organization
+	err := repo.DB.WithContext(ctx).Order("name ASC").Find(&orgs).Error
+	return orgs, err
+}
+
+func (repo *OrganizationRepo) GetOrganizationByID(ctx context.Context, id uint) (*models.Organization, error) {
+	var org models.Organization
+	if err := repo.DB.WithContext(ctx).First(&org, id).Error; err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+func (repo *OrganizationRepo) CreateOrganization(ctx context.Context, org *models.Organization) error {
+	return repo.DB.WithContext(ctx).Create(org).Error
+}
+
+func (repo *OrganizationRepo) DeleteOrganization(ctx context.Context, id uint) error {
+	result := repo.DB.WithContext(ctx).Unscoped().Delete(&models.Organization{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
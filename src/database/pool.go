@@ -0,0 +1,104 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+// pool holds the connection pool settings. Negative values keep the
+// database/sql defaults.
+type pool struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+// poolFromEnv reads DB_MAX_OPEN_CONNS, DB_MAX_IDLE_CONNS and
+// DB_CONN_MAX_LIFETIME (in seconds).
+func poolFromEnv() pool {
+	return pool{
+		MaxOpenConns:    envInt("DB_MAX_OPEN_CONNS"),
+		MaxIdleConns:    envInt("DB_MAX_IDLE_CONNS"),
+		ConnMaxLifetime: time.Duration(envInt("DB_CONN_MAX_LIFETIME")) * time.Second,
+	}
+}
+
+func envInt(name string) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return -1
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		log.Printf("Invalid %s %q, using the default", name, value)
+		return -1
+	}
+	return n
+}
+
+func (p pool) apply(db *sql.DB) {
+	if p.MaxOpenConns >= 0 {
+		db.SetMaxOpenConns(p.MaxOpenConns)
+	}
+	if p.MaxIdleConns >= 0 {
+		db.SetMaxIdleConns(p.MaxIdleConns)
+	}
+	if p.ConnMaxLifetime >= 0 {
+		db.SetConnMaxLifetime(p.ConnMaxLifetime)
+	}
+}
+
+// configurePool applies the pool settings to the primary database and
+// registers the read replicas in DB_READ_REPLICAS, a comma separated list of
+// database files kept in sync with the primary, e.g. by Litestream.
+//
+// Only the media and audit log tables are read from replicas, since their
+// list and metadata queries are the heavy ones. Queries that must see the
+// latest writes opt out with dbresolver.Write.
+func configurePool(db *gorm.DB) error {
+	p := poolFromEnv()
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	p.apply(sqlDB)
+
+	var replicas []gorm.Dialector
+	for _, dsn := range strings.Split(os.Getenv("DB_READ_REPLICAS"), ",") {
+		if dsn = strings.TrimSpace(dsn); dsn != "" {
+			replicas = append(replicas, sqlite.Open(dsn))
+		}
+	}
+	if len(replicas) == 0 {
+		return nil
+	}
+
+	resolver := dbresolver.Register(dbresolver.Config{
+		Replicas: replicas,
+		Policy:   dbresolver.RandomPolicy{},
+	}, &models.Image{}, &models.Doc{}, &models.MediaRelation{}, &models.AuditLog{})
+	if p.MaxOpenConns >= 0 {
+		resolver.SetMaxOpenConns(p.MaxOpenConns)
+	}
+	if p.MaxIdleConns >= 0 {
+		resolver.SetMaxIdleConns(p.MaxIdleConns)
+	}
+	if p.ConnMaxLifetime >= 0 {
+		resolver.SetConnMaxLifetime(p.ConnMaxLifetime)
+	}
+	if err := db.Use(resolver); err != nil {
+		return err
+	}
+	log.Printf("Reading media from %d replica(s)", len(replicas))
+	return nil
+}
@@ -0,0 +1,48 @@
+package database
+
+import (
+	"context"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"gorm.io/gorm"
+)
+
+type PresetRepo struct {
+	DB *gorm.DB
+}
+
+func NewPresetRepo(db *gorm.DB) models.UploadPresetRepository {
+	return &PresetRepo{DB: db}
+}
+
+func (repo *PresetRepo) GetAllPresets(ctx context.Context) ([]models.UploadPreset, error) {
+	var presets []models.UploadPreset
+	err := repo.DB.WithContext(ctx).Order("name").Find(&presets).Error
+	return presets, err
+}
+
+func (repo *PresetRepo) GetPresetByName(ctx context.Context, name string) (*models.UploadPreset, error) {
+	var preset models.UploadPreset
+	if err := repo.DB.WithContext(ctx).Where("name = ?", name).First(&preset).Error; err != nil {
+		return nil, err
+	}
+	return &preset, nil
+}
+
+func (repo *PresetRepo) CreatePreset(ctx context.Context, preset *models.UploadPreset) error {
+	return repo.DB.WithContext(ctx).Create(preset).Error
+}
+
+func (repo *PresetRepo) UpdatePreset(ctx context.Context, preset *models.UploadPreset) error {
+	return repo.DB.WithContext(ctx).Save(preset).Error
+}
+
+func (repo *PresetRepo) DeletePreset(ctx context.Context, name string) error {
+	result := repo.DB.WithContext(ctx).Unscoped().Where("name = ?", name).Delete(&models.UploadPreset{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
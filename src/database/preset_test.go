@@ -0,0 +1,50 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestPresetRepo(t *testing.T) {
+	// Arrange
+	util.ExPath = t.TempDir()
+	ConnectToDB()
+	repo := NewPresetRepo(DB)
+	ctx := context.Background()
+
+	// Act & Assert
+	require.NoError(t, repo.CreatePreset(ctx, &models.UploadPreset{Name: "blog", MediaType: models.MediaTypeImage, TransformPreset: "hero", ExpiresIn: 60}))
+	require.NoError(t, repo.CreatePreset(ctx, &models.UploadPreset{Name: "avatar", Width: 128}))
+	require.Error(t, repo.CreatePreset(ctx, &models.UploadPreset{Name: "blog"}))
+
+	presets, err := repo.GetAllPresets(ctx)
+	require.NoError(t, err)
+	require.Len(t, presets, 2)
+	require.Equal(t, "avatar", presets[0].Name)
+
+	preset, err := repo.GetPresetByName(ctx, "blog")
+	require.NoError(t, err)
+	require.Equal(t, models.MediaTypeImage, preset.MediaType)
+	require.Equal(t, "hero", preset.TransformPreset)
+	require.Equal(t, 60, preset.ExpiresIn)
+	_, err = repo.GetPresetByName(ctx, "missing")
+	require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	preset.TransformPreset = ""
+	preset.Height = 400
+	require.NoError(t, repo.UpdatePreset(ctx, preset))
+	preset, err = repo.GetPresetByName(ctx, "blog")
+	require.NoError(t, err)
+	require.Empty(t, preset.TransformPreset)
+	require.Equal(t, 400, preset.Height)
+
+	require.NoError(t, repo.DeletePreset(ctx, "blog"))
+	require.ErrorIs(t, repo.DeletePreset(ctx, "blog"), gorm.ErrRecordNotFound)
+	// Deleted presets free their name
+	require.NoError(t, repo.CreatePreset(ctx, &models.UploadPreset{Name: "blog"}))
+}
@@ -0,0 +1,90 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type RenditionRepo struct {
+	DB *gorm.DB
+}
+
+func NewRenditionRepo(db *gorm.DB) models.RenditionRepository {
+	return &RenditionRepo{DB: db}
+}
+
+func (repo *RenditionRepo) GetRenditions(ctx context.Context, sourceType string, sourceID uint) ([]models.Rendition, error) {
+	renditions := []models.Rendition{}
+	err := repo.DB.WithContext(ctx).Where("source_type = ? AND source_id = ?", sourceType, sourceID).
+		Order("id").Find(&renditions).Error
+	return renditions, err
+}
+
+func (repo *RenditionRepo) GetRendition(ctx context.Context, sourceType string, sourceID uint, kind, variant string) (models.Rendition, error) {
+	var rendition models.Rendition
+	err := repo.DB.WithContext(ctx).
+		Where("source_type = ? AND source_id = ? AND kind = ? AND variant = ?", sourceType, sourceID, kind, variant).
+		First(&rendition).Error
+	return rendition, err
+}
+
+func (repo *RenditionRepo) GetRenditionByFileName(ctx context.Context, fileName string) (models.Rendition, error) {
+	var rendition models.Rendition
+	err := repo.DB.WithContext(ctx).Where("file_name = ?", fileName).Take(&rendition).Error
+	return rendition, err
+}
+
+func (repo *RenditionRepo) GetRenditionsOfKinds(ctx context.Context, kinds []string) ([]models.Rendition, error) {
+	renditions := []models.Rendition{}
+	if len(kinds) == 0 {
+		return renditions, nil
+	}
+	err := repo.DB.WithContext(ctx).Where("kind IN ?", kinds).
+		Order("COALESCE(last_accessed_at, updated_at), id").Find(&renditions).Error
+	return renditions, err
+}
+
+func (repo *RenditionRepo) TouchRendition(ctx context.Context, id uint, at time.Time) error {
+	return repo.DB.WithContext(ctx).Model(&models.Rendition{}).Where("id = ?", id).UpdateColumn("last_accessed_at", at).Error
+}
+
+func (repo *RenditionRepo) DeleteRendition(ctx context.Context, id uint) error {
+	return repo.DB.WithContext(ctx).Delete(&models.Rendition{}, id).Error
+}
+
+func (repo *RenditionRepo) SaveRendition(ctx context.Context, rendition *models.Rendition) error {
+	return repo.DB.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "source_type"}, {Name: "source_id"}, {Name: "kind"}, {Name: "variant"}},
+		DoUpdates: clause.AssignmentColumns([]string{"updated_at", "file_name", "content_type", "size", "width", "height"}),
+	}).Create(rendition).Error
+}
+
+func (repo *RenditionRepo) DeleteRenditionsFor(ctx context.Context, sourceType string, sourceID uint) ([]models.Rendition, error) {
+	var renditions []models.Rendition
+	err := repo.DB.WithContext(ctx).Clauses(clause.Returning{}).
+		Where("source_type = ? AND source_id = ?", sourceType, sourceID).
+		Delete(&renditions).Error
+	return renditions, err
+}
+
+// removeRenditionFiles deletes the files of renditions whose records were
+// deleted with their source. Failures are only logged since the source is
+// already gone.
+func removeRenditionFiles(renditions []models.Rendition) {
+	for _, rendition := range renditions {
+		err := os.Remove(filepath.Join(util.ExPath, "uploads", "renditions", rendition.FileName))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Failed to delete rendition %s: %s", rendition.FileName, err.Error())
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package database
+
+import (
+	"context"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"gorm.io/gorm"
+)
+
+type RepairTaskRepo struct {
+	DB *gorm.DB
+}
+
+func NewRepairTaskRepo(db *gorm.DB) models.RepairTaskRepository {
+	return &RepairTaskRepo{DB: db}
+}
+
+func (repo *RepairTaskRepo) AddRepairTask(ctx context.Context, task *models.RepairTask) error {
+	task.Status = models.RepairStatusPending
+	return repo.DB.WithContext(ctx).
+		Where(models.RepairTask{MediaType: task.MediaType, FileName: task.FileName, Status: models.RepairStatusPending}).
+		FirstOrCreate(task).Error
+}
+
+func (repo *RepairTaskRepo) GetRepairTasks(ctx context.Context, status string) ([]models.RepairTask, error) {
+	tasks := []models.RepairTask{}
+	query := repo.DB.WithContext(ctx).Order("id DESC")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err := query.Find(&tasks).Error
+	return tasks, err
+}
+
+func (repo *RepairTaskRepo) UpdateRepairTask(ctx context.Context, task *models.RepairTask) error {
+	return repo.DB.WithContext(ctx).Save(task).Error
+}
@@ -0,0 +1,80 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"gorm.io/gorm"
+)
+
+type ReplicationRepo struct {
+	DB *gorm.DB
+}
+
+func NewReplicationRepo(db *gorm.DB) models.ReplicationRepository {
+	return &ReplicationRepo{DB: db}
+}
+
+// mediaRow holds the columns shared by the images and docs tables
+type mediaRow struct {
+	ID                uint
+	UUID              string
+	FileName          string
+	Checksum          []byte
+	ChecksumAlgorithm string
+	ExpiresAt         *time.Time
+	UpdatedAt         time.Time
+	DeletedAt         *time.Time
+}
+
+func (row mediaRow) change(mediaType string) models.MediaChange {
+	change := models.MediaChange{
+		Type:              mediaType,
+		ID:                row.ID,
+		UUID:              row.UUID,
+		FileName:          row.FileName,
+		Checksum:          row.Checksum,
+		ChecksumAlgorithm: row.ChecksumAlgorithm,
+		ExpiresAt:         row.ExpiresAt,
+		ChangedAt:         row.UpdatedAt,
+	}
+	if row.DeletedAt != nil {
+		change.ChangedAt = *row.DeletedAt
+		change.Deleted = true
+	}
+	return change
+}
+
+const mediaColumns = "id, uuid, file_name, checksum, checksum_algorithm, expires_at, updated_at, deleted_at"
+
+func (repo *ReplicationRepo) GetChanges(ctx context.Context, mediaType string, changedAt time.Time, afterID uint, limit int) ([]models.MediaChange, error) {
+	// Soft deletes only set deleted_at, so it is the time deleted records
+	// changed
+	var rows []mediaRow
+	err := repo.DB.WithContext(ctx).Table(models.MediaFolder(mediaType)).Select(mediaColumns).
+		Where("COALESCE(deleted_at, updated_at) > ? OR (COALESCE(deleted_at, updated_at) = ? AND id > ?)", changedAt, changedAt, afterID).
+		Order("COALESCE(deleted_at, updated_at), id").Limit(limit).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]models.MediaChange, 0, len(rows))
+	for _, row := range rows {
+		changes = append(changes, row.change(mediaType))
+	}
+	return changes, nil
+}
+
+func (repo *ReplicationRepo) GetMediaByUUID(ctx context.Context, mediaType, uuid string) (models.MediaChange, error) {
+	var row mediaRow
+	result := repo.DB.WithContext(ctx).Table(models.MediaFolder(mediaType)).Select(mediaColumns).
+		Where("uuid = ? AND deleted_at IS NULL", uuid).Limit(1).Scan(&row)
+	if result.Error != nil {
+		return models.MediaChange{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.MediaChange{}, gorm.ErrRecordNotFound
+	}
+	return row.change(mediaType), nil
+}
@@ -0,0 +1,87 @@
+package database
+
+import (
+	"context"
+	"strings"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"gorm.io/gorm"
+)
+
+// searchTable is the SQLite FTS5 table holding the text of files. The Porter
+// stemmer lets "running" match "run".
+const searchTable = "media_text"
+
+func ensureSearchIndex(db *gorm.DB) error {
+	return db.Exec("CREATE VIRTUAL TABLE IF NOT EXISTS " + searchTable +
+		" USING fts5(media_type UNINDEXED, file_name, body, tokenize = 'porter unicode61')").Error
+}
+
+type SearchRepo struct {
+	DB *gorm.DB
+}
+
+func NewSearchRepo(db *gorm.DB) models.SearchRepository {
+	return &SearchRepo{DB: db}
+}
+
+func (repo *SearchRepo) Index(ctx context.Context, mediaType, fileName, text string) error {
+	return repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := NewSearchRepo(tx).Remove(ctx, mediaType, fileName); err != nil {
+			return err
+		}
+		return tx.Exec("INSERT INTO "+searchTable+" (media_type, file_name, body) VALUES (?, ?, ?)", mediaType, fileName, text).Error
+	})
+}
+
+func (repo *SearchRepo) Remove(ctx context.Context, mediaType, fileName string) error {
+	return repo.DB.WithContext(ctx).Exec("DELETE FROM "+searchTable+" WHERE media_type = ? AND file_name = ?", mediaType, fileName).Error
+}
+
+func (repo *SearchRepo) Rename(ctx context.Context, mediaType, oldFileName, newFileName string) error {
+	return repo.DB.WithContext(ctx).Exec("UPDATE "+searchTable+" SET file_name = ? WHERE media_type = ? AND file_name = ?", newFileName, mediaType, oldFileName).Error
+}
+
+func (repo *SearchRepo) Search(ctx context.Context, query string, limit int) ([]models.SearchResult, error) {
+	results := []models.SearchResult{}
+	match := matchExpression(query)
+	if match == "" {
+		return results, nil
+	}
+
+	err := repo.DB.WithContext(ctx).Raw("SELECT media_type AS type, file_name, snippet("+searchTable+", 2, '<mark>', '</mark>', '…', 16) AS snippet"+
+		" FROM "+searchTable+" WHERE "+searchTable+" MATCH ? ORDER BY rank LIMIT ?", match, limit).Scan(&results).Error
+	return results, err
+}
+
+func (repo *SearchRepo) Unindexed(ctx context.Context, mediaType string) ([]string, error) {
+	var table string
+	switch mediaType {
+	case models.MediaTypeImage:
+		table = "images"
+	case models.MediaTypeDoc:
+		table = "docs"
+	default:
+		return nil, nil
+	}
+
+	var names []string
+	err := repo.DB.WithContext(ctx).Raw("SELECT file_name FROM "+table+" WHERE deleted_at IS NULL AND file_name NOT IN"+
+		" (SELECT file_name FROM "+searchTable+" WHERE media_type = ?)", mediaType).Scan(&names).Error
+	return names, err
+}
+
+// matchExpression turns free text into an FTS5 query matching documents that
+// contain every word, quoting the words so that FTS5 operators and syntax in
+// the input are matched literally. The last word also matches as a prefix
+// so results show up while typing.
+func matchExpression(query string) string {
+	words := strings.Fields(query)
+	for i, word := range words {
+		words[i] = `"` + strings.ReplaceAll(word, `"`, `""`) + `"`
+	}
+	if len(words) > 0 {
+		words[len(words)-1] += "*"
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,104 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"gorm.io/gorm"
+)
+
+type ServiceAccountRepo struct {
+	DB *gorm.DB
+}
+
+func NewServiceAccountRepo(db *gorm.DB) models.ServiceAccountRepository {
+	return &ServiceAccountRepo{DB: db}
+}
+
+func (repo *ServiceAccountRepo) GetAllServiceAccounts(ctx context.Context) ([]models.ServiceAccount, error) {
+	var accounts []models.ServiceAccount
+	err := repo.DB.WithContext(ctx).Order("name ASC").Find(&accounts).Error
+	return accounts, err
+}
+
+func (repo *ServiceAccountRepo) GetServiceAccountByID(ctx context.Context, id uint) (*models.ServiceAccount, error) {
+	var account models.ServiceAccount
+	if err := repo.DB.WithContext(ctx).First(&account, id).Error; err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+func (repo *ServiceAccountRepo) GetServiceAccountByName(ctx context.Context, name string) (*models.ServiceAccount, error) {
+	var account models.ServiceAccount
+	if err := repo.DB.WithContext(ctx).Where("name = ?", name).First(&account).Error; err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+func (repo *ServiceAccountRepo) CreateServiceAccount(ctx context.Context, account *models.ServiceAccount) error {
+	return repo.DB.WithContext(ctx).Create(account).Error
+}
+
+func (repo *ServiceAccountRepo) UpdateServiceAccount(ctx context.Context, account *models.ServiceAccount) error {
+	return repo.DB.WithContext(ctx).Save(account).Error
+}
+
+// DeleteServiceAccount removes the account together with its API keys.
+func (repo *ServiceAccountRepo) DeleteServiceAccount(ctx context.Context, id uint) error {
+	return repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().Delete(&models.ServiceAccount{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Unscoped().Where("service_account_id = ?", id).Delete(&models.APIKey{}).Error
+	})
+}
+
+func (repo *ServiceAccountRepo) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	return repo.DB.WithContext(ctx).Create(key).Error
+}
+
+func (repo *ServiceAccountRepo) GetAPIKeys(ctx context.Context, serviceAccountID uint) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	err := repo.DB.WithContext(ctx).Where("service_account_id = ?", serviceAccountID).Order("id ASC").Find(&keys).Error
+	return keys, err
+}
+
+// GetAPIKeyByHash returns the unexpired key with the given hash along with
+// its service account.
+func (repo *ServiceAccountRepo) GetAPIKeyByHash(ctx context.Context, hash string) (*models.APIKey, error) {
+	var key models.APIKey
+	err := repo.DB.WithContext(ctx).Preload("ServiceAccount").
+		Where("key_hash = ? AND (expires_at IS NULL OR expires_at > ?)", hash, time.Now()).
+		First(&key).Error
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (repo *ServiceAccountRepo) DeleteAPIKey(ctx context.Context, serviceAccountID, keyID uint) error {
+	result := repo.DB.WithContext(ctx).Unscoped().Where("service_account_id = ?", serviceAccountID).Delete(&models.APIKey{}, keyID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// TouchAPIKey records that the key and its service account were just used.
+func (repo *ServiceAccountRepo) TouchAPIKey(ctx context.Context, key *models.APIKey) error {
+	now := time.Now()
+	if err := repo.DB.WithContext(ctx).Model(&models.APIKey{}).Where("id = ?", key.ID).Update("last_used_at", now).Error; err != nil {
+		return err
+	}
+	return repo.DB.WithContext(ctx).Model(&models.ServiceAccount{}).Where("id = ?", key.ServiceAccountID).Update("last_used_at", now).Error
+}
@@ -0,0 +1,63 @@
+package database
+
+import (
+	"context"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"gorm.io/gorm"
+)
+
+type ShareLinkRepo struct {
+	DB *gorm.DB
+}
+
+func NewShareLinkRepo(db *gorm.DB) models.ShareLinkRepository {
+	return &ShareLinkRepo{DB: db}
+}
+
+func (repo *ShareLinkRepo) GetAllShareLinks(ctx context.Context) ([]models.ShareLink, error) {
+	var links []models.ShareLink
+	err := repo.DB.WithContext(ctx).Preload("Files").Order("id DESC").Find(&links).Error
+	return links, err
+}
+
+func (repo *ShareLinkRepo) GetShareLinkByToken(ctx context.Context, token string) (*models.ShareLink, error) {
+	var link models.ShareLink
+	if err := repo.DB.WithContext(ctx).Preload("Files").Where("token = ?", token).First(&link).Error; err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+func (repo *ShareLinkRepo) GetShareLinkByID(ctx context.Context, id uint) (*models.ShareLink, error) {
+	var link models.ShareLink
+	if err := repo.DB.WithContext(ctx).Preload("Files").First(&link, id).Error; err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+func (repo *ShareLinkRepo) CreateShareLink(ctx context.Context, link *models.ShareLink) error {
+	return repo.DB.WithContext(ctx).Create(link).Error
+}
+
+func (repo *ShareLinkRepo) RecordShareDownload(ctx context.Context, id uint) (bool, error) {
+	// The limit is checked by the update itself, so concurrent downloads
+	// cannot exceed it
+	result := repo.DB.WithContext(ctx).Model(&models.ShareLink{}).
+		Where("id = ? AND (max_downloads = 0 OR download_count < max_downloads)", id).
+		UpdateColumn("download_count", gorm.Expr("download_count + 1"))
+	return result.RowsAffected > 0, result.Error
+}
+
+func (repo *ShareLinkRepo) DeleteShareLink(ctx context.Context, id uint) error {
+	return repo.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().Delete(&models.ShareLink{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Where("share_link_id = ?", id).Delete(&models.ShareLinkFile{}).Error
+	})
+}
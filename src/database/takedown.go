@@ -0,0 +1,45 @@
+package database
+
+import (
+	"context"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"gorm.io/gorm"
+)
+
+type TakedownRepo struct {
+	DB *gorm.DB
+}
+
+func NewTakedownRepo(db *gorm.DB) models.TakedownRepository {
+	return &TakedownRepo{DB: db}
+}
+
+func (repo *TakedownRepo) GetAllTakedowns(ctx context.Context) ([]models.Takedown, error) {
+	var takedowns []models.Takedown
+	err := repo.DB.WithContext(ctx).Order("id DESC").Find(&takedowns).Error
+	return takedowns, err
+}
+
+func (repo *TakedownRepo) GetTakedown(ctx context.Context, mediaType, fileName string) (*models.Takedown, error) {
+	var takedown models.Takedown
+	err := repo.DB.WithContext(ctx).Where("media_type = ? AND file_name = ?", mediaType, fileName).Order("id DESC").First(&takedown).Error
+	if err != nil {
+		return nil, err
+	}
+	return &takedown, nil
+}
+
+func (repo *TakedownRepo) AddTakedown(ctx context.Context, takedown *models.Takedown) error {
+	return repo.DB.WithContext(ctx).Create(takedown).Error
+}
+
+func (repo *TakedownRepo) DeleteTakedown(ctx context.Context, id uint) (*models.Takedown, error) {
+	var takedown models.Takedown
+	if err := repo.DB.WithContext(ctx).First(&takedown, id).Error; err != nil {
+		return nil, err
+	}
+	if err := repo.DB.WithContext(ctx).Delete(&takedown).Error; err != nil {
+		return nil, err
+	}
+	return &takedown, nil
+}
@@ -0,0 +1,48 @@
+package database
+
+import (
+	"context"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"gorm.io/gorm"
+)
+
+type TransformPresetRepo struct {
+	DB *gorm.DB
+}
+
+func NewTransformPresetRepo(db *gorm.DB) models.TransformPresetRepository {
+	return &TransformPresetRepo{DB: db}
+}
+
+func (repo *TransformPresetRepo) GetAllTransformPresets(ctx context.Context) ([]models.TransformPreset, error) {
+	var presets []models.TransformPreset
+	err := repo.DB.WithContext(ctx).Order("name").Find(&presets).Error
+	return presets, err
+}
+
+func (repo *TransformPresetRepo) GetTransformPresetByName(ctx context.Context, name string) (*models.TransformPreset, error) {
+	var preset models.TransformPreset
+	if err := repo.DB.WithContext(ctx).Where("name = ?", name).First(&preset).Error; err != nil {
+		return nil, err
+	}
+	return &preset, nil
+}
+
+func (repo *TransformPresetRepo) CreateTransformPreset(ctx context.Context, preset *models.TransformPreset) error {
+	return repo.DB.WithContext(ctx).Create(preset).Error
+}
+
+func (repo *TransformPresetRepo) UpdateTransformPreset(ctx context.Context, preset *models.TransformPreset) error {
+	return repo.DB.WithContext(ctx).Save(preset).Error
+}
+
+func (repo *TransformPresetRepo) DeleteTransformPreset(ctx context.Context, name string) error {
+	result := repo.DB.WithContext(ctx).Unscoped().Where("name = ?", name).Delete(&models.TransformPreset{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
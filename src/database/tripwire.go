@@ -0,0 +1,36 @@
+package database
+
+import (
+	"context"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"gorm.io/gorm"
+)
+
+type TripwireRepo struct {
+	DB *gorm.DB
+}
+
+func NewTripwireRepo(db *gorm.DB) models.TripwireRepository {
+	return &TripwireRepo{DB: db}
+}
+
+func (repo *TripwireRepo) GetAllTripwires(ctx context.Context) ([]models.Tripwire, error) {
+	var tripwires []models.Tripwire
+	err := repo.DB.WithContext(ctx).Order("id ASC").Find(&tripwires).Error
+	return tripwires, err
+}
+
+func (repo *TripwireRepo) AddTripwire(ctx context.Context, tripwire *models.Tripwire) error {
+	return repo.DB.WithContext(ctx).Create(tripwire).Error
+}
+
+func (repo *TripwireRepo) DeleteTripwire(ctx context.Context, id uint) error {
+	result := repo.DB.WithContext(ctx).Delete(&models.Tripwire{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
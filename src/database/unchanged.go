@@ -0,0 +1,30 @@
+package database
+
+import (
+	"context"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"gorm.io/gorm"
+)
+
+// ifUnchanged restricts the statement q to media records still last updated
+// at the time of models.IfUnchanged, if ctx has one.
+func ifUnchanged(ctx context.Context, q *gorm.DB) *gorm.DB {
+	if updatedAt, ok := models.UnchangedSince(ctx); ok {
+		return q.Where("updated_at = ?", updatedAt)
+	}
+	return q
+}
+
+// checkUnchanged returns the error of the statement result, restricted with
+// ifUnchanged, or models.ErrStale if it changed no record because the media
+// was updated since.
+func checkUnchanged(ctx context.Context, result *gorm.DB) error {
+	if result.Error != nil {
+		return result.Error
+	}
+	if _, ok := models.UnchangedSince(ctx); ok && result.RowsAffected == 0 {
+		return models.ErrStale
+	}
+	return nil
+}
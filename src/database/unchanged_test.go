@@ -0,0 +1,57 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIfUnchanged(t *testing.T) {
+	// Arrange
+	util.ExPath = t.TempDir()
+	ConnectToDB()
+	images, docs := NewImageRepo(DB), NewDocRepo(DB)
+	ctx := context.Background()
+	_, err := images.AddImage(ctx, models.Image{FileName: "cat.png", Checksum: []byte("cat")})
+	require.NoError(t, err)
+	_, err = docs.AddDoc(ctx, models.Doc{FileName: "notes.txt", Checksum: []byte("notes")})
+	require.NoError(t, err)
+	image, err := images.GetImageByFileName(ctx, "cat.png")
+	require.NoError(t, err)
+	doc, err := docs.GetDocByFileName(ctx, "notes.txt")
+	require.NoError(t, err)
+	stale := models.IfUnchanged(ctx, image.UpdatedAt.Add(-time.Second))
+
+	// Act & Assert
+	require.ErrorIs(t, images.UpdateImageMetadata(stale, "cat.png", models.MediaMetadata{Title: "Cat"}), models.ErrStale)
+	require.ErrorIs(t, images.UpdateImageDisposition(stale, "cat.png", "attachment", ""), models.ErrStale)
+	require.ErrorIs(t, images.UpdateImageFocalPoint(stale, "cat.png", nil, nil), models.ErrStale)
+	require.ErrorIs(t, images.RenameImage(stale, "cat.png", "dog.png"), models.ErrStale)
+	_, err = images.DeleteImage(stale, "cat.png")
+	require.ErrorIs(t, err, models.ErrStale)
+	_, err = NewMediaTransferRepo(DB).TransferMedia(stale, models.MediaTransfer{
+		SourceType: models.MediaTypeImage, SourceFileName: "cat.png",
+		TargetType: models.MediaTypeDoc, TargetFileName: "cat.png",
+	}, func() error { return nil })
+	require.ErrorIs(t, err, models.ErrStale)
+	require.ErrorIs(t, docs.RenameDoc(models.IfUnchanged(ctx, doc.UpdatedAt.Add(-time.Second)), "notes.txt", "todo.txt"), models.ErrStale)
+
+	unchanged, err := images.GetImageByFileName(ctx, "cat.png")
+	require.NoError(t, err)
+	require.Empty(t, unchanged.Title)
+
+	// Changes to the version read go through, and change the version
+	current := models.IfUnchanged(ctx, image.UpdatedAt)
+	require.NoError(t, images.UpdateImageMetadata(current, "cat.png", models.MediaMetadata{Title: "Cat"}))
+	require.ErrorIs(t, images.RenameImage(current, "cat.png", "dog.png"), models.ErrStale)
+	updated, err := images.GetImageByFileName(ctx, "cat.png")
+	require.NoError(t, err)
+	require.Equal(t, "Cat", updated.Title)
+	require.NoError(t, images.RenameImage(models.IfUnchanged(ctx, updated.UpdatedAt), "cat.png", "dog.png"))
+	_, err = docs.DeleteDoc(models.IfUnchanged(ctx, doc.UpdatedAt), "notes.txt")
+	require.NoError(t, err)
+}
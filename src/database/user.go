@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"time"
@@ -18,13 +19,13 @@ func NewUserRepo(db *gorm.DB) models.UserRepository {
 }
 
 // User CRUD operations
-func (r *UserRepo) CreateUser(user *models.User) error {
-	return r.db.Create(user).Error
+func (r *UserRepo) CreateUser(ctx context.Context, user *models.User) error {
+	return r.db.WithContext(ctx).Create(user).Error
 }
 
-func (r *UserRepo) GetUserByEmail(email string) (*models.User, error) {
+func (r *UserRepo) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
 	var user models.User
-	err := r.db.Where("email = ?", email).First(&user).Error
+	err := r.db.WithContext(ctx).Where("email = ?", email).First(&user).Error
 	if err != nil {
 		log.Printf("[DEBUG] GetUserByEmail - Failed to get user %s: %v", email, err)
 		return nil, err
@@ -44,9 +45,9 @@ func (r *UserRepo) GetUserByEmail(email string) (*models.User, error) {
 	return &user, nil
 }
 
-func (r *UserRepo) GetUserByID(id uint) (*models.User, error) {
+func (r *UserRepo) GetUserByID(ctx context.Context, id uint) (*models.User, error) {
 	var user models.User
-	err := r.db.First(&user, id).Error
+	err := r.db.WithContext(ctx).First(&user, id).Error
 	if err != nil {
 		log.Printf("[DEBUG] GetUserByID - Failed to get user %d: %v", id, err)
 		return nil, err
@@ -66,34 +67,34 @@ func (r *UserRepo) GetUserByID(id uint) (*models.User, error) {
 	return &user, nil
 }
 
-func (r *UserRepo) UpdateUser(user *models.User) error {
-	return r.db.Save(user).Error
+func (r *UserRepo) UpdateUser(ctx context.Context, user *models.User) error {
+	return r.db.WithContext(ctx).Save(user).Error
 }
 
-func (r *UserRepo) DeleteUser(id uint) error {
-	return r.db.Delete(&models.User{}, id).Error
+func (r *UserRepo) DeleteUser(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Delete(&models.User{}, id).Error
 }
 
-func (r *UserRepo) GetAllUsers() ([]models.User, error) {
+func (r *UserRepo) GetAllUsers(ctx context.Context) ([]models.User, error) {
 	var users []models.User
-	err := r.db.Find(&users).Error
+	err := r.db.WithContext(ctx).Find(&users).Error
 	return users, err
 }
 
-func (r *UserRepo) CountUsers() (int64, error) {
+func (r *UserRepo) CountUsers(ctx context.Context) (int64, error) {
 	var count int64
-	err := r.db.Model(&models.User{}).Count(&count).Error
+	err := r.db.WithContext(ctx).Model(&models.User{}).Count(&count).Error
 	return count, err
 }
 
 // Session management
-func (r *UserRepo) CreateSession(session *models.UserSession) error {
-	return r.db.Create(session).Error
+func (r *UserRepo) CreateSession(ctx context.Context, session *models.UserSession) error {
+	return r.db.WithContext(ctx).Create(session).Error
 }
 
-func (r *UserRepo) GetSessionByRefreshToken(token string) (*models.UserSession, error) {
+func (r *UserRepo) GetSessionByRefreshToken(ctx context.Context, token string) (*models.UserSession, error) {
 	var session models.UserSession
-	err := r.db.Preload("User").Where("refresh_token = ? AND is_revoked = ? AND expires_at > ?",
+	err := r.db.WithContext(ctx).Preload("User").Where("refresh_token = ? AND is_revoked = ? AND expires_at > ?",
 		token, false, time.Now()).First(&session).Error
 	if err != nil {
 		return nil, err
@@ -101,22 +102,51 @@ func (r *UserRepo) GetSessionByRefreshToken(token string) (*models.UserSession,
 	return &session, nil
 }
 
-func (r *UserRepo) RevokeSession(sessionID uint) error {
-	return r.db.Model(&models.UserSession{}).Where("id = ?", sessionID).Update("is_revoked", true).Error
+func (r *UserRepo) RevokeSession(ctx context.Context, sessionID uint) error {
+	return r.db.WithContext(ctx).Model(&models.UserSession{}).Where("id = ?", sessionID).Update("is_revoked", true).Error
 }
 
-func (r *UserRepo) RevokeAllUserSessions(userID uint) error {
-	return r.db.Model(&models.UserSession{}).Where("user_id = ?", userID).Update("is_revoked", true).Error
+func (r *UserRepo) RevokeAllUserSessions(ctx context.Context, userID uint) error {
+	return r.db.WithContext(ctx).Model(&models.UserSession{}).Where("user_id = ?", userID).Update("is_revoked", true).Error
+}
+
+// RotateSession saves a session whose refresh token was replaced
+func (r *UserRepo) RotateSession(ctx context.Context, session *models.UserSession) error {
+	return r.db.WithContext(ctx).Omit("User").Save(session).Error
+}
+
+// GetActiveSessions returns the user's unrevoked, unexpired sessions, most
+// recently used first
+func (r *UserRepo) GetActiveSessions(ctx context.Context, userID uint) ([]models.UserSession, error) {
+	var sessions []models.UserSession
+	err := r.db.WithContext(ctx).Where("user_id = ? AND is_revoked = ? AND expires_at > ?", userID, false, time.Now()).
+		Order("COALESCE(last_used_at, created_at) DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// RevokeUserSession revokes one of the user's sessions
+func (r *UserRepo) RevokeUserSession(ctx context.Context, userID, sessionID uint) error {
+	result := r.db.WithContext(ctx).Model(&models.UserSession{}).
+		Where("id = ? AND user_id = ? AND is_revoked = ?", sessionID, userID, false).
+		Update("is_revoked", true)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
 }
 
 // Password reset
-func (r *UserRepo) CreatePasswordReset(reset *models.PasswordReset) error {
-	return r.db.Create(reset).Error
+func (r *UserRepo) CreatePasswordReset(ctx context.Context, reset *models.PasswordReset) error {
+	return r.db.WithContext(ctx).Create(reset).Error
 }
 
-func (r *UserRepo) GetPasswordResetByToken(token string) (*models.PasswordReset, error) {
+func (r *UserRepo) GetPasswordResetByToken(ctx context.Context, token string) (*models.PasswordReset, error) {
 	var reset models.PasswordReset
-	err := r.db.Preload("User").Where("token = ? AND is_used = ? AND expires_at > ?",
+	err := r.db.WithContext(ctx).Preload("User").Where("token = ? AND is_used = ? AND expires_at > ?",
 		token, false, time.Now()).First(&reset).Error
 	if err != nil {
 		return nil, err
@@ -124,15 +154,15 @@ func (r *UserRepo) GetPasswordResetByToken(token string) (*models.PasswordReset,
 	return &reset, nil
 }
 
-func (r *UserRepo) MarkPasswordResetAsUsed(resetID uint) error {
-	return r.db.Model(&models.PasswordReset{}).Where("id = ?", resetID).Update("is_used", true).Error
+func (r *UserRepo) MarkPasswordResetAsUsed(ctx context.Context, resetID uint) error {
+	return r.db.WithContext(ctx).Model(&models.PasswordReset{}).Where("id = ?", resetID).Update("is_used", true).Error
 }
 
-func (r *UserRepo) UpdateUserEmail(userID uint, newEmail string) error {
-	return r.db.Model(&models.User{}).Where("id = ?", userID).Update("email", newEmail).Error
+func (r *UserRepo) UpdateUserEmail(ctx context.Context, userID uint, newEmail string) error {
+	return r.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", userID).Update("email", newEmail).Error
 }
 
-func (r *UserRepo) Set2FA(userID uint, secret string, enabled bool) error {
+func (r *UserRepo) Set2FA(ctx context.Context, userID uint, secret string, enabled bool) error {
 	log.Printf("[DEBUG] Set2FA called - UserID: %d, Secret: %s, Enabled: %t",
 		userID,
 		func() string {
@@ -145,7 +175,7 @@ func (r *UserRepo) Set2FA(userID uint, secret string, enabled bool) error {
 
 	// First, let's check the current state before update
 	var currentUser models.User
-	if err := r.db.Where("id = ?", userID).First(&currentUser).Error; err != nil {
+	if err := r.db.WithContext(ctx).Where("id = ?", userID).First(&currentUser).Error; err != nil {
 		log.Printf("[ERROR] Set2FA - Failed to get current user state: %v", err)
 		return err
 	}
@@ -174,7 +204,7 @@ func (r *UserRepo) Set2FA(userID uint, secret string, enabled bool) error {
 		secretPtr = nil
 	}
 
-	result := r.db.Model(&models.User{}).Where("id = ?", userID).Updates(models.User{
+	result := r.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", userID).Updates(models.User{
 		TwoFASecret:  secretPtr,
 		Is2FAEnabled: enabledPtr,
 	})
@@ -188,7 +218,7 @@ func (r *UserRepo) Set2FA(userID uint, secret string, enabled bool) error {
 
 	// Verify the update by checking the current state
 	var updatedUser models.User
-	if err := r.db.Where("id = ?", userID).First(&updatedUser).Error; err != nil {
+	if err := r.db.WithContext(ctx).Where("id = ?", userID).First(&updatedUser).Error; err != nil {
 		log.Printf("[ERROR] Set2FA - Failed to verify updated state: %v", err)
 		return err
 	}
@@ -213,3 +243,36 @@ func (r *UserRepo) Set2FA(userID uint, secret string, enabled bool) error {
 
 	return nil
 }
+
+// 2FA backup codes
+
+// ReplaceBackupCodes discards the user's existing backup codes and stores the
+// given hashes as the new set.
+func (r *UserRepo) ReplaceBackupCodes(ctx context.Context, userID uint, hashes []string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.BackupCode{}).Error; err != nil {
+			return err
+		}
+		for _, hash := range hashes {
+			if err := tx.Create(&models.BackupCode{UserID: userID, CodeHash: hash}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// UseBackupCode marks an unused backup code as used and reports whether one
+// matched.
+func (r *UserRepo) UseBackupCode(ctx context.Context, userID uint, hash string) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.BackupCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hash).
+		Update("used_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *UserRepo) CountBackupCodes(ctx context.Context, userID uint) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.BackupCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&count).Error
+	return count, err
+}
@@ -0,0 +1,23 @@
+package database
+
+import (
+	"log"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// backfillMediaUUIDs assigns a UUID to media records created before the
+// column existed.
+func backfillMediaUUIDs(db *gorm.DB) {
+	for _, table := range []string{"images", "docs"} {
+		var ids []uint
+		if err := db.Table(table).Where("uuid IS NULL OR uuid = ''").Pluck("id", &ids).Error; err != nil {
+			log.Printf("Failed to backfill UUIDs for %s: %s", table, err.Error())
+			continue
+		}
+		for _, id := range ids {
+			db.Table(table).Where("id = ?", id).Update("uuid", uuid.NewString())
+		}
+	}
+}
@@ -0,0 +1,555 @@
+// Package dav exposes the uploaded media over WebDAV, so the CDN can be
+// mounted as a network drive. The root holds an images and a docs folder;
+// files written to them are validated and recorded like uploads through the
+// API.
+package dav
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/cache"
+	"github.com/kevinanielsen/go-fast-cdn/src/convert"
+	"github.com/kevinanielsen/go-fast-cdn/src/hooks"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/moderation"
+	"github.com/kevinanielsen/go-fast-cdn/src/search"
+	"github.com/kevinanielsen/go-fast-cdn/src/usage"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/kevinanielsen/go-fast-cdn/src/validations"
+	"golang.org/x/net/webdav"
+	"gorm.io/gorm"
+)
+
+// tempPrefix starts the names of files being written. They are hidden from
+// listings until they are complete.
+const tempPrefix = ".dav-"
+
+// folders maps the folders at the root to their media type
+var folders = map[string]string{
+	"images": models.MediaTypeImage,
+	"docs":   models.MediaTypeDoc,
+}
+
+type scopeKey struct{}
+
+// WithOrganization restricts changes through the file system to the media of
+// orgID, like auth.InScope. A nil orgID leaves it unrestricted.
+func WithOrganization(ctx context.Context, orgID *uint) context.Context {
+	return context.WithValue(ctx, scopeKey{}, orgID)
+}
+
+func organization(ctx context.Context) *uint {
+	orgID, _ := ctx.Value(scopeKey{}).(*uint)
+	return orgID
+}
+
+func inScope(ctx context.Context, owner *uint) bool {
+	scope := organization(ctx)
+	return scope == nil || (owner != nil && *owner == *scope)
+}
+
+type moderationKey struct{}
+
+type moderated struct {
+	status string
+	notify func(moderation.Notification)
+}
+
+// WithModeration records the files written through the file system with the
+// moderation status, see moderation.UploadStatus, like uploads through the
+// API, and calls notify for the ones held back for review. Without it files
+// are approved.
+func WithModeration(ctx context.Context, status string, notify func(moderation.Notification)) context.Context {
+	return context.WithValue(ctx, moderationKey{}, moderated{status: status, notify: notify})
+}
+
+func moderationOf(ctx context.Context) moderated {
+	m, ok := ctx.Value(moderationKey{}).(moderated)
+	if !ok || m.status == "" {
+		return moderated{status: models.ModerationStatusApproved}
+	}
+	return m
+}
+
+type accessKey struct{}
+
+// WithAccess checks the access to the folders through the file system with
+// allowed, which is passed the folder, images or docs, and the access level
+// needed, see models.AccessRead, and returns an error to deny it. Errors
+// wrapping os.ErrPermission are answered with 403 Forbidden. Without it
+// every folder is accessible.
+func WithAccess(ctx context.Context, allowed func(folder, level string) error) context.Context {
+	return context.WithValue(ctx, accessKey{}, allowed)
+}
+
+// access returns an error unless the folder of mediaType may be accessed at
+// level
+func access(ctx context.Context, mediaType, level string) error {
+	allowed, ok := ctx.Value(accessKey{}).(func(folder, level string) error)
+	if !ok {
+		return nil
+	}
+	return allowed(models.MediaFolder(mediaType), level)
+}
+
+type watermarkKey struct{}
+
+// WithWatermark serves the images read through the file system from the
+// file watermarked returns for the image and its path, see watermark.Path.
+// Errors deny reading the image. Without it images are served as they are.
+func WithWatermark(ctx context.Context, watermarked func(fileName, path string) (string, error)) context.Context {
+	return context.WithValue(ctx, watermarkKey{}, watermarked)
+}
+
+// servedPath returns the file to serve when the file fileName of mediaType
+// is read
+func servedPath(ctx context.Context, mediaType, fileName string) (string, error) {
+	path := localPath(mediaType, fileName)
+	watermarked, ok := ctx.Value(watermarkKey{}).(func(fileName, path string) (string, error))
+	if !ok || mediaType != models.MediaTypeImage {
+		return path, nil
+	}
+	return watermarked(fileName, path)
+}
+
+type hooksKey struct{}
+
+// Hooks calls the upload hooks for the request, see hooks.PreValidate,
+// hooks.PostStore and hooks.PreDelete.
+type Hooks struct {
+	PreValidate func(hooks.Media) error
+	PostStore   func(hooks.Media)
+	PreDelete   func(hooks.Media) error
+}
+
+// WithHooks calls the upload hooks for the files written, moved and deleted
+// through the file system like for uploads and deletions through the API.
+// Rejections deny the request. Without it no hooks are called.
+func WithHooks(ctx context.Context, h Hooks) context.Context {
+	return context.WithValue(ctx, hooksKey{}, h)
+}
+
+func hooksOf(ctx context.Context) Hooks {
+	h, _ := ctx.Value(hooksKey{}).(Hooks)
+	return h
+}
+
+// preValidate calls the PreValidate hooks with m
+func preValidate(ctx context.Context, m hooks.Media) error {
+	h := hooksOf(ctx)
+	if h.PreValidate == nil {
+		return nil
+	}
+	return hookError(h.PreValidate(m))
+}
+
+// postStore calls the PostStore hooks with the stored media m
+func postStore(ctx context.Context, m hooks.Media) {
+	if h := hooksOf(ctx); h.PostStore != nil {
+		h.PostStore(hooks.Stored(m))
+	}
+}
+
+// preDelete calls the PreDelete hooks with the stored media m
+func preDelete(ctx context.Context, m hooks.Media) error {
+	h := hooksOf(ctx)
+	if h.PreDelete == nil {
+		return nil
+	}
+	return hookError(h.PreDelete(hooks.Stored(m)))
+}
+
+// hookError makes the rejection of a hook deny the request
+func hookError(err error) error {
+	var rejection *hooks.Rejection
+	if errors.As(err, &rejection) {
+		return fmt.Errorf("%w: %s", os.ErrPermission, rejection.Error())
+	}
+	return err
+}
+
+// FileSystem is a webdav.FileSystem over the uploads folder
+type FileSystem struct {
+	stores     map[string]store
+	searchRepo models.SearchRepository
+}
+
+var _ webdav.FileSystem = (*FileSystem)(nil)
+
+func NewFileSystem(images models.ImageRepository, docs models.DocRepository, searchRepo models.SearchRepository) *FileSystem {
+	return &FileSystem{
+		stores: map[string]store{
+			models.MediaTypeImage: imageStore{images},
+			models.MediaTypeDoc:   docStore{docs},
+		},
+		searchRepo: searchRepo,
+	}
+}
+
+// resolve splits name into the media type of its folder and the file name.
+// Both are empty for the root, and the file name is empty for a folder.
+func resolve(name string) (mediaType, fileName string, err error) {
+	name = strings.Trim(name, "/")
+	if name == "" {
+		return "", "", nil
+	}
+	folder, fileName, _ := strings.Cut(name, "/")
+	mediaType, ok := folders[folder]
+	if !ok || strings.Contains(fileName, "/") || strings.HasPrefix(fileName, tempPrefix) {
+		return "", "", os.ErrNotExist
+	}
+	return mediaType, fileName, nil
+}
+
+func localPath(mediaType, fileName string) string {
+	return filepath.Join(util.ExPath, "uploads", models.MediaFolder(mediaType), fileName)
+}
+
+// validName returns an error unless fileName is accepted as is by the naming
+// policy of uploads.
+func validName(fileName string) error {
+	filtered, err := util.FilterFilename(fileName)
+	if err != nil {
+		return fmt.Errorf("%w: %s", os.ErrPermission, err.Error())
+	}
+	if filtered != fileName {
+		return fmt.Errorf("%w: invalid file name %q", os.ErrPermission, fileName)
+	}
+	return nil
+}
+
+// Mkdir fails, as the folders are fixed
+func (fs *FileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	return os.ErrPermission
+}
+
+func (fs *FileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	mediaType, fileName, err := resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	if mediaType == "" {
+		return os.Stat(filepath.Join(util.ExPath, "uploads"))
+	}
+	if err := access(ctx, mediaType, models.AccessRead); err != nil {
+		return nil, err
+	}
+	return os.Stat(localPath(mediaType, fileName))
+}
+
+// OpenFile opens a file or folder for reading, or, when creating or
+// truncating a file, a temporary file that replaces it once closed.
+func (fs *FileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	mediaType, fileName, err := resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	writing := flag&(os.O_CREATE|os.O_TRUNC) != 0
+	if writing && fileName == "" {
+		return nil, os.ErrPermission
+	}
+
+	if mediaType == "" {
+		f, err := os.Open(filepath.Join(util.ExPath, "uploads"))
+		if err != nil {
+			return nil, err
+		}
+		// Folders the request may not read are left out
+		return &dir{File: f, show: func(info os.FileInfo) bool {
+			mediaType, ok := folders[info.Name()]
+			return ok && info.IsDir() && access(ctx, mediaType, models.AccessRead) == nil
+		}}, nil
+	}
+	level := models.AccessRead
+	if writing {
+		level = models.AccessWrite
+	}
+	if err := access(ctx, mediaType, level); err != nil {
+		return nil, err
+	}
+
+	if fileName == "" {
+		f, err := os.Open(localPath(mediaType, ""))
+		if err != nil {
+			return nil, err
+		}
+		return &dir{File: f, show: func(info os.FileInfo) bool {
+			return info.Mode().IsRegular() && !strings.HasPrefix(info.Name(), ".")
+		}}, nil
+	}
+
+	if !writing {
+		path, err := servedPath(ctx, mediaType, fileName)
+		if err != nil {
+			return nil, err
+		}
+		return os.Open(path)
+	}
+
+	if err := validName(fileName); err != nil {
+		return nil, err
+	}
+	owner, err := fs.stores[mediaType].owner(ctx, fileName)
+	exists := err == nil
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if exists && !inScope(ctx, owner) {
+		return nil, os.ErrPermission
+	}
+	if !exists {
+		owner = organization(ctx)
+	}
+
+	tmp, err := os.CreateTemp(localPath(mediaType, ""), tempPrefix+"*")
+	if err != nil {
+		return nil, err
+	}
+	return &upload{File: tmp, fs: fs, ctx: ctx, mediaType: mediaType, fileName: fileName, exists: exists, owner: owner}, nil
+}
+
+func (fs *FileSystem) RemoveAll(ctx context.Context, name string) error {
+	mediaType, fileName, err := resolve(name)
+	if err != nil {
+		return err
+	}
+	if fileName == "" {
+		return os.ErrPermission
+	}
+	if err := access(ctx, mediaType, models.AccessAdmin); err != nil {
+		return err
+	}
+
+	st := fs.stores[mediaType]
+	owner, err := st.owner(ctx, fileName)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return os.ErrNotExist
+	} else if err != nil {
+		return err
+	}
+	if !inScope(ctx, owner) {
+		return os.ErrPermission
+	}
+	if err := preDelete(ctx, hooks.Media{Type: mediaType, FileName: fileName, OrganizationID: owner}); err != nil {
+		return err
+	}
+
+	if err := st.remove(ctx, fileName); err != nil {
+		return err
+	}
+	cache.Invalidate(mediaType, fileName)
+	return usage.Track(mediaType, owner, fileName, func() error {
+		err := os.Remove(localPath(mediaType, fileName))
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	})
+}
+
+// Rename renames a file within its folder
+func (fs *FileSystem) Rename(ctx context.Context, oldName, newName string) error {
+	mediaType, oldFileName, err := resolve(oldName)
+	if err != nil {
+		return err
+	}
+	newMediaType, newFileName, err := resolve(newName)
+	if err != nil {
+		return err
+	}
+	if oldFileName == "" || newFileName == "" || mediaType != newMediaType {
+		return os.ErrPermission
+	}
+	if err := validName(newFileName); err != nil {
+		return err
+	}
+	if err := access(ctx, mediaType, models.AccessWrite); err != nil {
+		return err
+	}
+
+	st := fs.stores[mediaType]
+	owner, err := st.owner(ctx, oldFileName)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return os.ErrNotExist
+	} else if err != nil {
+		return err
+	}
+	if !inScope(ctx, owner) {
+		return os.ErrPermission
+	}
+	// The file is checked by the hooks under its new name like a new
+	// upload, so that they see every name media is served under
+	oldPath := localPath(mediaType, oldFileName)
+	err = preValidate(ctx, hooks.Media{
+		Type: mediaType, FileName: newFileName, OrganizationID: owner,
+		Open: func() (io.ReadCloser, error) { return os.Open(oldPath) },
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := util.RenameFile(oldFileName, newFileName, models.MediaFolder(mediaType)); err != nil {
+		return err
+	}
+	cache.Invalidate(mediaType, oldFileName)
+	cache.Invalidate(mediaType, newFileName)
+	if err := st.rename(ctx, oldFileName, newFileName); err != nil {
+		return err
+	}
+	postStore(ctx, hooks.Media{Type: mediaType, FileName: newFileName, OrganizationID: owner})
+	return nil
+}
+
+// commit validates the file written to tmpPath and moves it into place,
+// recording it like an upload through the API, upload hooks included. Empty files are accepted
+// without validation, as clients such as Finder create them before writing
+// the content.
+func (fs *FileSystem) commit(ctx context.Context, u *upload, tmpPath string) error {
+	f, err := os.Open(tmpPath)
+	if err != nil {
+		return err
+	}
+	header := make([]byte, 512)
+	n, err := io.ReadFull(f, header)
+	f.Close()
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return err
+	}
+
+	info, err := os.Stat(tmpPath)
+	if err != nil {
+		return err
+	}
+	err = preValidate(ctx, hooks.Media{
+		Type: u.mediaType, FileName: u.fileName, Size: info.Size(), OrganizationID: u.owner,
+		Header: header[:n], Open: func() (io.ReadCloser, error) { return os.Open(tmpPath) },
+	})
+	if err != nil {
+		return err
+	}
+
+	if n > 0 {
+		if err := validations.ValidateContentType(u.mediaType, u.fileName, header[:n]); err != nil {
+			return fmt.Errorf("%w: %s", os.ErrPermission, err.Error())
+		}
+		if err := validations.SanitizeFile(u.fileName, tmpPath); err != nil {
+			return fmt.Errorf("%w: %s", os.ErrPermission, err.Error())
+		}
+	}
+
+	// The checksum is computed like for uploads through the API, so that
+	// duplicates are detected across both
+	st := fs.stores[u.mediaType]
+	algorithm := util.ChecksumAlgorithm()
+	checksum, err := util.FileChecksum(algorithm, tmpPath)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		duplicate, err := st.nameByChecksum(ctx, checksum)
+		if err == nil && duplicate != u.fileName {
+			return fmt.Errorf("%w: same content as %s", os.ErrExist, duplicate)
+		} else if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+	}
+
+	// New content of an existing file is held back like a new file
+	m := moderationOf(ctx)
+	if u.exists {
+		err = st.updateChecksum(ctx, u.fileName, algorithm, checksum)
+		if err == nil && m.status != models.ModerationStatusApproved {
+			err = st.moderate(ctx, u.fileName, m.status)
+		}
+	} else {
+		err = st.add(ctx, u.fileName, algorithm, checksum, u.owner, m.status)
+	}
+	if err != nil {
+		return err
+	}
+	err = usage.Track(u.mediaType, u.owner, u.fileName, func() error {
+		return os.Rename(tmpPath, localPath(u.mediaType, u.fileName))
+	})
+	if err != nil {
+		if !u.exists {
+			st.remove(ctx, u.fileName)
+		}
+		return err
+	}
+	cache.Invalidate(u.mediaType, u.fileName)
+	postStore(ctx, hooks.Media{Type: u.mediaType, FileName: u.fileName, OrganizationID: u.owner})
+	if m.status == models.ModerationStatusPending && m.notify != nil {
+		m.notify(moderation.Notification{
+			Type: moderation.TypePending, MediaType: u.mediaType, FileName: u.fileName, OrganizationID: u.owner,
+		})
+	}
+
+	if u.mediaType == models.MediaTypeDoc {
+		search.EnqueueIndexDoc(ctx, fs.searchRepo, u.fileName)
+		convert.EnqueuePDF(ctx, u.fileName)
+	}
+	return nil
+}
+
+// upload is a file being written. Closing it commits the content.
+type upload struct {
+	*os.File
+	fs        *FileSystem
+	ctx       context.Context
+	mediaType string
+	fileName  string
+	exists    bool
+	owner     *uint
+}
+
+func (u *upload) Close() error {
+	tmpPath := u.File.Name()
+	defer os.Remove(tmpPath)
+
+	if err := u.File.Close(); err != nil {
+		return err
+	}
+	return u.fs.commit(u.ctx, u, tmpPath)
+}
+
+// dir is a folder listing only the entries show accepts
+type dir struct {
+	*os.File
+	show    func(os.FileInfo) bool
+	entries []os.FileInfo
+	read    bool
+}
+
+func (d *dir) Readdir(count int) ([]os.FileInfo, error) {
+	if !d.read {
+		all, err := d.File.Readdir(-1)
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range all {
+			if d.show(info) {
+				d.entries = append(d.entries, info)
+			}
+		}
+		d.read = true
+	}
+
+	if count <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	n := min(count, len(d.entries))
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
@@ -0,0 +1,256 @@
+package dav
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/hooks"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/policy"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/webdav"
+)
+
+var png = append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{1}, 600)...)
+
+func newTestHandler(t *testing.T, orgID *uint) http.Handler {
+	t.Helper()
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	for _, folder := range []string{"images", "docs"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(util.ExPath, "uploads", folder), 0o755))
+	}
+
+	h := &webdav.Handler{
+		FileSystem: NewFileSystem(database.NewImageRepo(database.DB), database.NewDocRepo(database.DB), database.NewSearchRepo(database.DB)),
+		LockSystem: webdav.NewMemLS(),
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r.WithContext(WithOrganization(r.Context(), orgID)))
+	})
+}
+
+func do(h http.Handler, method, path string, body []byte, headers ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, bytes.NewReader(body))
+	for i := 0; i+1 < len(headers); i += 2 {
+		r.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestFileSystem_Upload(t *testing.T) {
+	h := newTestHandler(t, nil)
+	ctx := context.Background()
+
+	require.Equal(t, http.StatusCreated, do(h, "PUT", "/images/logo.png", png).Code)
+	image, err := database.NewImageRepo(database.DB).GetImageByFileName(ctx, "logo.png")
+	require.NoError(t, err)
+	require.NotEmpty(t, image.Checksum)
+	require.FileExists(t, filepath.Join(util.ExPath, "uploads", "images", "logo.png"))
+
+	// Content that isn't an image, the same content under another name and
+	// reserved names are rejected
+	require.Equal(t, http.StatusMethodNotAllowed, do(h, "PUT", "/images/notes.png", []byte("plain text")).Code)
+	require.Equal(t, http.StatusMethodNotAllowed, do(h, "PUT", "/images/copy.png", png).Code)
+	require.NotEqual(t, http.StatusCreated, do(h, "PUT", "/images/all", png).Code)
+	require.NotEqual(t, http.StatusCreated, do(h, "PUT", "/other/logo.png", png).Code)
+
+	// Listings hide temporary files
+	require.NoError(t, os.WriteFile(filepath.Join(util.ExPath, "uploads", "images", tempPrefix+"1"), nil, 0o644))
+	w := do(h, "PROPFIND", "/images/", nil, "Depth", "1")
+	require.Equal(t, http.StatusMultiStatus, w.Code)
+	require.Contains(t, w.Body.String(), "logo.png")
+	require.NotContains(t, w.Body.String(), tempPrefix)
+
+	require.Equal(t, http.StatusCreated, do(h, "MOVE", "/images/logo.png", nil, "Destination", "/images/brand.png").Code)
+	_, err = database.NewImageRepo(database.DB).GetImageByFileName(ctx, "brand.png")
+	require.NoError(t, err)
+	require.NotEqual(t, http.StatusCreated, do(h, "MOVE", "/images/brand.png", nil, "Destination", "/docs/brand.png").Code)
+
+	require.Equal(t, http.StatusNoContent, do(h, "DELETE", "/images/brand.png", nil).Code)
+	_, err = database.NewImageRepo(database.DB).GetImageByFileName(ctx, "brand.png")
+	require.Error(t, err)
+	require.NoFileExists(t, filepath.Join(util.ExPath, "uploads", "images", "brand.png"))
+}
+
+func TestFileSystem_Overwrite(t *testing.T) {
+	h := newTestHandler(t, nil)
+
+	// Clients such as Finder create an empty file before writing it
+	require.Equal(t, http.StatusCreated, do(h, "PUT", "/docs/notes.txt", nil).Code)
+	require.Equal(t, http.StatusCreated, do(h, "PUT", "/docs/notes.txt", []byte("flour and sugar")).Code)
+
+	data, err := os.ReadFile(filepath.Join(util.ExPath, "uploads", "docs", "notes.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "flour and sugar", string(data))
+
+	results, err := database.NewSearchRepo(database.DB).Search(context.Background(), "flour", 10)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+}
+
+func TestFileSystem_Scope(t *testing.T) {
+	orgID := uint(1)
+	h := newTestHandler(t, &orgID)
+
+	other := uint(2)
+	_, err := database.NewImageRepo(database.DB).AddImage(context.Background(), models.Image{FileName: "foreign.png", Checksum: []byte("foreign"), OrganizationID: &other})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(util.ExPath, "uploads", "images", "foreign.png"), png, 0o644))
+
+	require.Equal(t, http.StatusOK, do(h, "GET", "/images/foreign.png", nil).Code)
+	require.NotEqual(t, http.StatusNoContent, do(h, "DELETE", "/images/foreign.png", nil).Code)
+	require.NotEqual(t, http.StatusCreated, do(h, "PUT", "/images/foreign.png", bytes.ReplaceAll(png, []byte{1}, []byte{2})).Code)
+	require.FileExists(t, filepath.Join(util.ExPath, "uploads", "images", "foreign.png"))
+
+	require.Equal(t, http.StatusCreated, do(h, "PUT", "/images/own.png", bytes.ReplaceAll(png, []byte{1}, []byte{3})).Code)
+	image, err := database.NewImageRepo(database.DB).GetImageByFileName(context.Background(), "own.png")
+	require.NoError(t, err)
+	require.Equal(t, &orgID, image.OrganizationID)
+	require.False(t, strings.HasPrefix(image.FileName, tempPrefix))
+}
+
+func TestFileSystem_Access(t *testing.T) {
+	fs := newTestHandler(t, nil)
+	require.Equal(t, http.StatusCreated, do(fs, "PUT", "/images/logo.png", png).Code)
+	require.Equal(t, http.StatusCreated, do(fs, "PUT", "/docs/notes.txt", []byte("private")).Code)
+
+	// Images are read-only and docs are hidden
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fs.ServeHTTP(w, r.WithContext(WithAccess(r.Context(), func(folder, level string) error {
+			if folder == "docs" || level != models.AccessRead {
+				return os.ErrPermission
+			}
+			return nil
+		})))
+	})
+
+	require.Equal(t, http.StatusOK, do(h, "GET", "/images/logo.png", nil).Code)
+	require.NotEqual(t, http.StatusCreated, do(h, "PUT", "/images/other.png", bytes.ReplaceAll(png, []byte{1}, []byte{2})).Code)
+	require.NotEqual(t, http.StatusCreated, do(h, "MOVE", "/images/logo.png", nil, "Destination", "/images/brand.png").Code)
+	require.NotEqual(t, http.StatusNoContent, do(h, "DELETE", "/images/logo.png", nil).Code)
+	require.FileExists(t, filepath.Join(util.ExPath, "uploads", "images", "logo.png"))
+
+	require.NotEqual(t, http.StatusOK, do(h, "GET", "/docs/notes.txt", nil).Code)
+	require.NotEqual(t, http.StatusMultiStatus, do(h, "PROPFIND", "/docs/", nil, "Depth", "1").Code)
+	w := do(h, "PROPFIND", "/", nil, "Depth", "1")
+	require.Equal(t, http.StatusMultiStatus, w.Code)
+	require.Contains(t, w.Body.String(), "images")
+	require.NotContains(t, w.Body.String(), "docs")
+}
+
+func TestFileSystem_Watermark(t *testing.T) {
+	fs := newTestHandler(t, nil)
+	require.Equal(t, http.StatusCreated, do(fs, "PUT", "/images/logo.png", png).Code)
+	require.Equal(t, http.StatusCreated, do(fs, "PUT", "/docs/notes.txt", []byte("notes")).Code)
+	marked := filepath.Join(t.TempDir(), "marked.png")
+	require.NoError(t, os.WriteFile(marked, []byte("watermarked"), 0o644))
+	serve := func(watermarked func(fileName, path string) (string, error)) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fs.ServeHTTP(w, r.WithContext(WithWatermark(r.Context(), watermarked)))
+		})
+	}
+
+	// Images are read from the watermarked file, other files as they are
+	h := serve(func(fileName, path string) (string, error) {
+		require.Equal(t, "logo.png", fileName)
+		require.Equal(t, filepath.Join(util.ExPath, "uploads", "images", "logo.png"), path)
+		return marked, nil
+	})
+	w := do(h, "GET", "/images/logo.png", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "watermarked", w.Body.String())
+	require.Equal(t, "notes", do(h, "GET", "/docs/notes.txt", nil).Body.String())
+
+	// Images that cannot be watermarked are not served
+	h = serve(func(fileName, path string) (string, error) { return "", os.ErrPermission })
+	require.NotEqual(t, http.StatusOK, do(h, "GET", "/images/logo.png", nil).Code)
+}
+
+func TestFileSystem_Hooks(t *testing.T) {
+	fs := newTestHandler(t, nil)
+	var calls []string
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fs.ServeHTTP(w, r.WithContext(WithHooks(r.Context(), Hooks{
+			PreValidate: func(m hooks.Media) error {
+				calls = append(calls, "pre_validate "+m.FileName)
+				if strings.HasPrefix(m.FileName, "blocked") {
+					return hooks.Reject("blocked")
+				}
+				return nil
+			},
+			PostStore: func(m hooks.Media) {
+				calls = append(calls, "post_store "+m.FileName)
+				require.Equal(t, filepath.Join(util.ExPath, "uploads", "images", m.FileName), m.Path)
+			},
+			PreDelete: func(m hooks.Media) error {
+				calls = append(calls, "pre_delete "+m.FileName)
+				if m.FileName == "kept.png" {
+					return hooks.Reject("kept")
+				}
+				return nil
+			},
+		})))
+	})
+
+	// Writes, moves and deletes call the hooks like the API
+	require.Equal(t, http.StatusCreated, do(h, "PUT", "/images/logo.png", png).Code)
+	require.Equal(t, http.StatusCreated, do(h, "MOVE", "/images/logo.png", nil, "Destination", "/images/brand.png").Code)
+	require.Equal(t, http.StatusNoContent, do(h, "DELETE", "/images/brand.png", nil).Code)
+	require.Equal(t, []string{
+		"pre_validate logo.png", "post_store logo.png",
+		"pre_validate brand.png", "post_store brand.png",
+		"pre_delete brand.png",
+	}, calls)
+
+	// Rejections deny the request
+	other := bytes.ReplaceAll(png, []byte{1}, []byte{2})
+	require.NotEqual(t, http.StatusCreated, do(h, "PUT", "/images/blocked.png", png).Code)
+	require.NoFileExists(t, filepath.Join(util.ExPath, "uploads", "images", "blocked.png"))
+	require.Equal(t, http.StatusCreated, do(h, "PUT", "/images/kept.png", other).Code)
+	require.Equal(t, http.StatusForbidden, do(h, "MOVE", "/images/kept.png", nil, "Destination", "/images/blocked.png").Code)
+	require.NotEqual(t, http.StatusNoContent, do(h, "DELETE", "/images/kept.png", nil).Code)
+	require.FileExists(t, filepath.Join(util.ExPath, "uploads", "images", "kept.png"))
+}
+
+func TestFileSystem_Policy(t *testing.T) {
+	fs := newTestHandler(t, nil)
+	p, err := policy.Parse([]byte(`
+rules:
+  - name: lower-case-names
+    on: [upload]
+    when: 'not (media.file_name matches "^[a-z0-9._-]+$")'
+    reject: "{{ media.file_name }} must be lower case"
+  - name: keep-logos
+    on: [delete]
+    when: has_prefix(media.file_name, "logo")
+    reject: Logos are kept
+`))
+	require.NoError(t, err)
+	hook := policy.Hook{Policy: p}
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fs.ServeHTTP(w, r.WithContext(WithHooks(r.Context(), Hooks{
+			PreValidate: func(m hooks.Media) error { return hook.PreValidate(r.Context(), m) },
+			PreDelete:   func(m hooks.Media) error { return hook.PreDelete(r.Context(), m) },
+		})))
+	})
+
+	// The upload and delete rules apply to writes, moves and deletes
+	require.NotEqual(t, http.StatusCreated, do(h, "PUT", "/images/Logo.png", png).Code)
+	require.Equal(t, http.StatusCreated, do(h, "PUT", "/images/logo.png", png).Code)
+	require.Equal(t, http.StatusForbidden, do(h, "MOVE", "/images/logo.png", nil, "Destination", "/images/Brand.png").Code)
+	require.NotEqual(t, http.StatusNoContent, do(h, "DELETE", "/images/logo.png", nil).Code)
+	require.FileExists(t, filepath.Join(util.ExPath, "uploads", "images", "logo.png"))
+	require.Equal(t, http.StatusCreated, do(h, "MOVE", "/images/logo.png", nil, "Destination", "/images/brand.png").Code)
+	require.Equal(t, http.StatusNoContent, do(h, "DELETE", "/images/brand.png", nil).Code)
+}
@@ -0,0 +1,108 @@
+package dav
+
+import (
+	"context"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/placeholder"
+	"github.com/kevinanielsen/go-fast-cdn/src/similarity"
+)
+
+// store gives the file system the same view of image and doc records.
+// Lookups return gorm.ErrRecordNotFound when there is no match.
+type store interface {
+	owner(ctx context.Context, fileName string) (*uint, error)
+	nameByChecksum(ctx context.Context, checksum []byte) (string, error)
+	add(ctx context.Context, fileName, algorithm string, checksum []byte, orgID *uint, moderationStatus string) error
+	updateChecksum(ctx context.Context, fileName, algorithm string, checksum []byte) error
+	moderate(ctx context.Context, fileName, status string) error
+	rename(ctx context.Context, oldFileName, newFileName string) error
+	remove(ctx context.Context, fileName string) error
+}
+
+type imageStore struct {
+	repo models.ImageRepository
+}
+
+func (s imageStore) owner(ctx context.Context, fileName string) (*uint, error) {
+	image, err := s.repo.GetImageByFileName(ctx, fileName)
+	return image.OrganizationID, err
+}
+
+func (s imageStore) nameByChecksum(ctx context.Context, checksum []byte) (string, error) {
+	image, err := s.repo.GetImageByCheckSum(ctx, checksum)
+	return image.FileName, err
+}
+
+func (s imageStore) add(ctx context.Context, fileName, algorithm string, checksum []byte, orgID *uint, moderationStatus string) error {
+	_, err := s.repo.AddImage(ctx, models.Image{
+		FileName: fileName, Checksum: checksum, ChecksumAlgorithm: algorithm, OrganizationID: orgID,
+		ModerationStatus: moderationStatus,
+	})
+	if err == nil {
+		placeholder.Enqueue(ctx, s.repo, fileName)
+		similarity.Enqueue(ctx, s.repo, fileName)
+	}
+	return err
+}
+
+func (s imageStore) updateChecksum(ctx context.Context, fileName, algorithm string, checksum []byte) error {
+	if err := s.repo.UpdateImageChecksum(ctx, fileName, algorithm, checksum); err != nil {
+		return err
+	}
+	placeholder.Enqueue(ctx, s.repo, fileName)
+	similarity.Enqueue(ctx, s.repo, fileName)
+	return nil
+}
+
+func (s imageStore) moderate(ctx context.Context, fileName, status string) error {
+	return s.repo.UpdateImageModerationStatus(ctx, fileName, status)
+}
+
+func (s imageStore) rename(ctx context.Context, oldFileName, newFileName string) error {
+	return s.repo.RenameImage(ctx, oldFileName, newFileName)
+}
+
+func (s imageStore) remove(ctx context.Context, fileName string) error {
+	_, err := s.repo.DeleteImage(ctx, fileName)
+	return err
+}
+
+type docStore struct {
+	repo models.DocRepository
+}
+
+func (s docStore) owner(ctx context.Context, fileName string) (*uint, error) {
+	doc, err := s.repo.GetDocByFileName(ctx, fileName)
+	return doc.OrganizationID, err
+}
+
+func (s docStore) nameByChecksum(ctx context.Context, checksum []byte) (string, error) {
+	doc, err := s.repo.GetDocByCheckSum(ctx, checksum)
+	return doc.FileName, err
+}
+
+func (s docStore) add(ctx context.Context, fileName, algorithm string, checksum []byte, orgID *uint, moderationStatus string) error {
+	_, err := s.repo.AddDoc(ctx, models.Doc{
+		FileName: fileName, Checksum: checksum, ChecksumAlgorithm: algorithm, OrganizationID: orgID,
+		ModerationStatus: moderationStatus,
+	})
+	return err
+}
+
+func (s docStore) updateChecksum(ctx context.Context, fileName, algorithm string, checksum []byte) error {
+	return s.repo.UpdateDocChecksum(ctx, fileName, algorithm, checksum)
+}
+
+func (s docStore) moderate(ctx context.Context, fileName, status string) error {
+	return s.repo.UpdateDocModerationStatus(ctx, fileName, status)
+}
+
+func (s docStore) rename(ctx context.Context, oldFileName, newFileName string) error {
+	return s.repo.RenameDoc(ctx, oldFileName, newFileName)
+}
+
+func (s docStore) remove(ctx context.Context, fileName string) error {
+	_, err := s.repo.DeleteDoc(ctx, fileName)
+	return err
+}
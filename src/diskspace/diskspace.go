@@ -0,0 +1,144 @@
+// Package diskspace watches the free space of the volume holding the uploads
+// folder and write-protects it before it fills up, as a full disk would also
+// break the database next to it.
+package diskspace
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/alert"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"github.com/kevinanielsen/go-fast-cdn/src/settings"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+)
+
+const defaultCheckInterval = time.Minute
+
+// Usage describes the space of the uploads volume at CheckedAt.
+type Usage struct {
+	TotalBytes uint64 `json:"total_bytes"`
+	// FreeBytes is the space available to the application.
+	FreeBytes uint64 `json:"free_bytes"`
+	// MinFreeBytes is the min_free_disk_space setting; uploads are
+	// rejected while FreeBytes is below it.
+	MinFreeBytes   uint64    `json:"min_free_bytes"`
+	WriteProtected bool      `json:"write_protected"`
+	CheckedAt      time.Time `json:"checked_at"`
+}
+
+// Monitor reads the free space of the volume holding a folder, the uploads
+// folder if its path is empty.
+type Monitor struct {
+	path   string
+	statfs func(path string) (total, free uint64, err error)
+
+	mu   sync.Mutex
+	last *Usage
+}
+
+func NewMonitor(path string) *Monitor {
+	return &Monitor{path: path, statfs: statfs}
+}
+
+// Default monitors the uploads folder.
+var Default = NewMonitor("")
+
+// Check reads the free space now. It alerts when the volume becomes write
+// protected and when it has enough space again.
+func (m *Monitor) Check() (Usage, error) {
+	path := m.path
+	if path == "" {
+		path = filepath.Join(util.ExPath, "uploads")
+	}
+	total, free, err := m.statfs(path)
+	if err != nil {
+		return Usage{}, err
+	}
+	minFree, _ := strconv.ParseUint(settings.Default.Get(settings.MinFreeDiskSpace), 10, 64)
+	usage := Usage{
+		TotalBytes:     total,
+		FreeBytes:      free,
+		MinFreeBytes:   minFree,
+		WriteProtected: free < minFree,
+		CheckedAt:      time.Now(),
+	}
+
+	m.mu.Lock()
+	changed := m.last != nil && m.last.WriteProtected != usage.WriteProtected
+	m.last = &usage
+	m.mu.Unlock()
+
+	if changed {
+		text := fmt.Sprintf("Uploads are rejected, only %d bytes are free on the uploads volume", free)
+		if !usage.WriteProtected {
+			text = fmt.Sprintf("Uploads are accepted again, %d bytes are free on the uploads volume", free)
+		}
+		alert.Notify(alert.Alert{
+			Type:    "disk_space",
+			Text:    text,
+			Details: map[string]any{"free_bytes": free, "min_free_bytes": minFree, "write_protected": usage.WriteProtected},
+		})
+	}
+	return usage, nil
+}
+
+// Usage returns the result of the last check, or nil before the first one.
+func (m *Monitor) Usage() *Usage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.last == nil {
+		return nil
+	}
+	usage := *m.last
+	return &usage
+}
+
+// Middleware rejects requests with a 507 while the free space is below the
+// min_free_disk_space setting. The space is read on every request, so
+// uploads stop as soon as the threshold is crossed. Requests are let through
+// when the space cannot be read.
+func (m *Monitor) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		usage, err := m.Check()
+		if err == nil && usage.WriteProtected {
+			problem.Write(c, http.StatusInsufficientStorage, "Not enough free disk space to store uploads")
+			return
+		}
+		c.Next()
+	}
+}
+
+// Start checks the free space of Default every DISK_CHECK_INTERVAL
+// seconds, a minute by default.
+func Start() error {
+	if _, err := Default.Check(); err != nil {
+		log.Printf("Disk space monitoring is disabled: %s", err.Error())
+		return nil
+	}
+
+	interval := defaultCheckInterval
+	if val := os.Getenv("DISK_CHECK_INTERVAL"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil && parsed > 0 {
+			interval = time.Duration(parsed) * time.Second
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if _, err := Default.Check(); err != nil {
+				log.Printf("Failed to read free disk space: %s", err.Error())
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,52 @@
+package diskspace
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMonitor(t *testing.T) {
+	t.Setenv("MIN_FREE_DISK_SPACE", "1000")
+	var free uint64 = 5000
+	m := NewMonitor(t.TempDir())
+	m.statfs = func(string) (uint64, uint64, error) { return 10000, free, nil }
+
+	r := gin.New()
+	r.POST("/upload", m.Middleware(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	upload := func() int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/upload", nil))
+		return w.Code
+	}
+
+	require.Nil(t, m.Usage())
+	require.Equal(t, http.StatusOK, upload())
+	require.Equal(t, &Usage{TotalBytes: 10000, FreeBytes: 5000, MinFreeBytes: 1000, CheckedAt: m.Usage().CheckedAt}, m.Usage())
+
+	free = 999
+	require.Equal(t, http.StatusInsufficientStorage, upload())
+	require.True(t, m.Usage().WriteProtected)
+
+	free = 1000
+	require.Equal(t, http.StatusOK, upload())
+
+	// A threshold of 0 never rejects uploads
+	t.Setenv("MIN_FREE_DISK_SPACE", "0")
+	free = 0
+	require.Equal(t, http.StatusOK, upload())
+}
+
+func TestStatfs(t *testing.T) {
+	total, free, err := statfs(t.TempDir())
+	if err != nil {
+		t.Skip(err)
+	}
+	require.Positive(t, total)
+	require.LessOrEqual(t, free, total)
+}
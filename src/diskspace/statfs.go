@@ -0,0 +1,15 @@
+//go:build linux || darwin
+
+package diskspace
+
+import "syscall"
+
+// statfs returns the size of the volume holding path and the bytes
+// available on it to unprivileged users.
+func statfs(path string) (total, free uint64, err error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, 0, err
+	}
+	return st.Blocks * uint64(st.Bsize), st.Bavail * uint64(st.Bsize), nil
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !darwin
+
+package diskspace
+
+import "errors"
+
+func statfs(path string) (total, free uint64, err error) {
+	return 0, 0, errors.New("free disk space cannot be read on this platform")
+}
@@ -0,0 +1,129 @@
+// Package events broadcasts what happens on the server, e.g. uploads,
+// deletions, logins and errors, to live subscribers such as the activity
+// feed of the admin dashboard. Events are not persisted; see the audit
+// package for the permanent record.
+package events
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+)
+
+// Types of the events published outside of the audit log, which publishes
+// its entries with their action as type.
+const (
+	TypeUploaded    = "media.uploaded"
+	TypeDeleted     = "media.deleted"
+	TypeCommented   = "media.commented"
+	TypeServerError = "server.error"
+)
+
+// recentSize is the number of events kept for new subscribers.
+const recentSize = 50
+
+// Event is something that happened on the server.
+type Event struct {
+	Type   string    `json:"type"`
+	Time   time.Time `json:"time"`
+	Actor  string    `json:"actor,omitempty"`
+	IP     string    `json:"ip,omitempty"`
+	Target string    `json:"target,omitempty"`
+	// Details holds event specific fields.
+	Details any `json:"details,omitempty"`
+}
+
+// Bus delivers published events to every subscriber.
+type Bus struct {
+	mu          sync.Mutex
+	subscribers map[chan Event]struct{}
+	recent      []Event
+}
+
+func NewBus() *Bus {
+	return &Bus{subscribers: map[chan Event]struct{}{}}
+}
+
+// Publish sends e to the subscribers. Subscribers that fall behind miss
+// events rather than slowing down the publisher.
+func (b *Bus) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.recent = append(b.recent, e)
+	if len(b.recent) > recentSize {
+		b.recent = b.recent[len(b.recent)-recentSize:]
+	}
+	for ch := range b.subscribers {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// Subscribe returns the most recent events, oldest first, and a channel
+// receiving the events published from now on. cancel must be called when
+// the subscriber is done.
+func (b *Bus) Subscribe(buffer int) (recent []Event, events <-chan Event, cancel func()) {
+	ch := make(chan Event, buffer)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers[ch] = struct{}{}
+	recent = append([]Event(nil), b.recent...)
+
+	var once sync.Once
+	return recent, ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			delete(b.subscribers, ch)
+		})
+	}
+}
+
+// Default is the bus the package-level functions use.
+var Default = NewBus()
+
+// Publish sends e to the subscribers of Default.
+func Publish(e Event) {
+	Default.Publish(e)
+}
+
+// Record publishes an event for the request, taking the acting user or
+// service account and the client IP from the context.
+func Record(c *gin.Context, eventType, target string, details any) {
+	actor := c.GetString("user_email")
+	if account, ok := c.Get("service_account"); ok {
+		actor = "service-account:" + account.(*models.ServiceAccount).Name
+	}
+	Publish(Event{
+		Type:    eventType,
+		Actor:   actor,
+		IP:      c.ClientIP(),
+		Target:  target,
+		Details: details,
+	})
+}
+
+// Errors publishes an event for every request answered with a server error.
+func Errors() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if status := c.Writer.Status(); status >= http.StatusInternalServerError {
+			details := gin.H{"method": c.Request.Method, "status": status}
+			if err := c.Errors.Last(); err != nil {
+				details["error"] = err.Error()
+			}
+			Record(c, TypeServerError, c.Request.URL.Path, details)
+		}
+	}
+}
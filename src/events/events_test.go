@@ -0,0 +1,57 @@
+package events
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBus(t *testing.T) {
+	bus := NewBus()
+	bus.Publish(Event{Type: "before"})
+
+	recent, ch, cancel := bus.Subscribe(1)
+	require.Len(t, recent, 1)
+	require.Equal(t, "before", recent[0].Type)
+	require.False(t, recent[0].Time.IsZero())
+
+	bus.Publish(Event{Type: "first"})
+	// The buffer is full, so the subscriber misses this one
+	bus.Publish(Event{Type: "second"})
+	require.Equal(t, "first", (<-ch).Type)
+	require.Empty(t, ch)
+
+	cancel()
+	cancel()
+	bus.Publish(Event{Type: "after"})
+	require.Empty(t, ch)
+
+	for i := 0; i < recentSize+10; i++ {
+		bus.Publish(Event{Type: "filler"})
+	}
+	recent, _, cancel = bus.Subscribe(1)
+	defer cancel()
+	require.Len(t, recent, recentSize)
+}
+
+func TestErrors(t *testing.T) {
+	_, ch, cancel := Default.Subscribe(10)
+	defer cancel()
+
+	r := gin.New()
+	r.Use(Errors())
+	r.GET("/ok", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.GET("/fail", func(c *gin.Context) { c.Status(http.StatusBadGateway) })
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ok", nil))
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/fail", nil))
+
+	e := <-ch
+	require.Equal(t, TypeServerError, e.Type)
+	require.Equal(t, "/fail", e.Target)
+	require.Equal(t, http.StatusBadGateway, e.Details.(gin.H)["status"])
+	require.Empty(t, ch)
+}
@@ -0,0 +1,264 @@
+package events
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultForwardBuffer = 1000
+	maxForwardBatch      = 100
+	forwardInterval      = time.Second
+	maxForwardAttempts   = 5
+	// defaultSubject is the NATS subject prefix or Kafka topic events are
+	// published to without EVENTS_BUS_SUBJECT.
+	defaultSubject = "go-fast-cdn"
+)
+
+// message is an event encoded for a message bus. Key is the event type,
+// appended to the subject on NATS and used as the record key on Kafka.
+type message struct {
+	Key   string
+	Value []byte
+}
+
+// publisher delivers a batch of events to a message bus.
+type publisher interface {
+	publish(ctx context.Context, subject string, messages []message) error
+	close()
+}
+
+// Forwarder publishes the events of a Bus, media lifecycle events and audit
+// entries alike, to a message bus for downstream processing. Like other
+// subscribers it misses events while its buffer is full, and batches that
+// keep failing are dropped after a few retries.
+type Forwarder struct {
+	publisher publisher
+	subject   string
+	types     []string
+	events    <-chan Event
+	cancel    func()
+	stop      chan struct{}
+	done      chan struct{}
+	backoff   time.Duration
+}
+
+// StartForwarder publishes the events of Default to the message bus at
+// EVENTS_BUS_URL. It does nothing when the variable is unset.
+//
+// nats://[user:password@]host:4222, or tls:// for TLS, publishes each event
+// to the subject EVENTS_BUS_SUBJECT.<type>, e.g. go-fast-cdn.media.uploaded.
+// kafka://[user:password@]broker:9092[,broker:9092], or kafka+tls:// for
+// TLS, produces events to the topic EVENTS_BUS_SUBJECT, keyed by their type.
+// kafka+http(s)://host:8082 posts them to a Kafka REST Proxy instead, with
+// EVENTS_BUS_AUTH_HEADER as Authorization header. EVENTS_BUS_CA_FILE names
+// the PEM certificates TLS connections are verified with instead of the
+// system's. EVENTS_BUS_TYPES limits the events to the listed
+// types or prefixes ending in a dot, e.g. media., and
+// EVENTS_BUS_BUFFER_SIZE sets how many events are held while the bus is
+// unreachable.
+func StartForwarder() error {
+	endpoint := os.Getenv("EVENTS_BUS_URL")
+	if endpoint == "" {
+		return nil
+	}
+
+	bufferSize := defaultForwardBuffer
+	if value := os.Getenv("EVENTS_BUS_BUFFER_SIZE"); value != "" {
+		size, err := strconv.Atoi(value)
+		if err != nil || size < 1 {
+			return fmt.Errorf("invalid EVENTS_BUS_BUFFER_SIZE %q", value)
+		}
+		bufferSize = size
+	}
+	subject := os.Getenv("EVENTS_BUS_SUBJECT")
+	if subject == "" {
+		subject = defaultSubject
+	}
+	var types []string
+	for _, t := range strings.Split(os.Getenv("EVENTS_BUS_TYPES"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types = append(types, t)
+		}
+	}
+
+	p, err := parsePublisher(endpoint, os.Getenv("EVENTS_BUS_AUTH_HEADER"), os.Getenv("EVENTS_BUS_CA_FILE"))
+	if err != nil {
+		return err
+	}
+	newForwarder(Default, p, subject, types, bufferSize, time.Second)
+	log.Printf("Publishing events to %s", redact(endpoint))
+	return nil
+}
+
+func parsePublisher(endpoint, authHeader, caFile string) (publisher, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid EVENTS_BUS_URL: %w", err)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid EVENTS_BUS_URL: missing host")
+	}
+
+	var roots *x509.CertPool
+	if caFile != "" {
+		if roots, err = loadRootCAs(caFile); err != nil {
+			return nil, fmt.Errorf("invalid EVENTS_BUS_CA_FILE: %w", err)
+		}
+	}
+
+	switch u.Scheme {
+	case "nats", "tls":
+		return newNATSPublisher(u, roots), nil
+	case "kafka", "kafka+tls":
+		return newKafkaPublisher(u, roots)
+	case "kafka+http", "kafka+https":
+		base := *u
+		base.Scheme = strings.TrimPrefix(u.Scheme, "kafka+")
+		return newKafkaProxyPublisher(base.String(), authHeader, roots), nil
+	default:
+		return nil, fmt.Errorf("unsupported EVENTS_BUS_URL scheme %q", u.Scheme)
+	}
+}
+
+// loadRootCAs reads the PEM certificates in file.
+func loadRootCAs(file string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(pem) {
+		return nil, errors.New("no certificates found in " + file)
+	}
+	return roots, nil
+}
+
+// redact hides credentials embedded in an endpoint URL.
+func redact(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return endpoint
+	}
+	return u.Redacted()
+}
+
+// newForwarder subscribes to bus and publishes its events of the given
+// types, or all without types, to subject.
+func newForwarder(bus *Bus, p publisher, subject string, types []string, bufferSize int, backoff time.Duration) *Forwarder {
+	_, events, cancel := bus.Subscribe(bufferSize)
+	f := &Forwarder{
+		publisher: p,
+		subject:   subject,
+		types:     types,
+		events:    events,
+		cancel:    cancel,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+		backoff:   backoff,
+	}
+	go f.run()
+	return f
+}
+
+// Close stops the forwarder after publishing the events it received.
+func (f *Forwarder) Close() {
+	f.cancel()
+	close(f.stop)
+	<-f.done
+}
+
+func (f *Forwarder) run() {
+	defer close(f.done)
+	defer f.publisher.close()
+
+	ticker := time.NewTicker(forwardInterval)
+	defer ticker.Stop()
+
+	var batch []message
+	for {
+		select {
+		case e := <-f.events:
+			batch = f.add(batch, e)
+		case <-ticker.C:
+			f.flush(batch)
+			batch = nil
+		case <-f.stop:
+		drain:
+			for {
+				select {
+				case e := <-f.events:
+					batch = f.add(batch, e)
+				default:
+					break drain
+				}
+			}
+			f.flush(batch)
+			return
+		}
+	}
+}
+
+// add appends e to batch if it is wanted, publishing full batches.
+func (f *Forwarder) add(batch []message, e Event) []message {
+	if !f.wanted(e.Type) {
+		return batch
+	}
+	value, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("[ERROR] Failed to encode event %s: %v", e.Type, err)
+		return batch
+	}
+	batch = append(batch, message{Key: e.Type, Value: value})
+	if len(batch) >= maxForwardBatch {
+		f.flush(batch)
+		return nil
+	}
+	return batch
+}
+
+func (f *Forwarder) wanted(eventType string) bool {
+	if len(f.types) == 0 {
+		return true
+	}
+	for _, t := range f.types {
+		if eventType == t || strings.HasSuffix(t, ".") && strings.HasPrefix(eventType, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// flush publishes a batch, retrying with exponential backoff before giving
+// up.
+func (f *Forwarder) flush(batch []message) {
+	if len(batch) == 0 {
+		return
+	}
+
+	delay := f.backoff
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err := f.publisher.publish(ctx, f.subject, batch)
+		cancel()
+		if err == nil {
+			return
+		}
+		if attempt == maxForwardAttempts {
+			log.Printf("[ERROR] Dropping %d events after %d failed deliveries to the message bus: %v", len(batch), attempt, err)
+			return
+		}
+		log.Printf("[ERROR] Publishing events failed, retrying in %s: %v", delay, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
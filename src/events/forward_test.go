@@ -0,0 +1,232 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+)
+
+// fakeNATS accepts one connection at a time and records the published
+// subjects and payloads.
+func fakeNATS(t *testing.T) (addr string, published chan [2]string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	published = make(chan [2]string, 10)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				conn.Write([]byte(`INFO {"server_id":"test","max_payload":1048576}` + "\r\n"))
+				r := bufio.NewReader(conn)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					fields := strings.Fields(line)
+					switch fields[0] {
+					case "CONNECT":
+						if !strings.Contains(line, `"auth_token":"secret"`) {
+							conn.Write([]byte("-ERR 'Authorization Violation'\r\n"))
+							return
+						}
+					case "PING":
+						conn.Write([]byte("PONG\r\n"))
+					case "PUB":
+						size, _ := strconv.Atoi(fields[2])
+						payload := make([]byte, size+2)
+						io.ReadFull(r, payload)
+						published <- [2]string{fields[1], string(payload[:size])}
+					}
+				}
+			}(conn)
+		}
+	}()
+	return listener.Addr().String(), published
+}
+
+func TestForwarder_NATS(t *testing.T) {
+	// Arrange
+	addr, published := fakeNATS(t)
+	bus := NewBus()
+	u, _ := url.Parse("nats://secret@" + addr)
+	f := newForwarder(bus, newNATSPublisher(u, nil), "cdn", []string{"media."}, 10, time.Millisecond)
+
+	// Act
+	bus.Publish(Event{Type: TypeUploaded, Target: "image/cat.png"})
+	bus.Publish(Event{Type: "auth.login"})
+	bus.Publish(Event{Type: TypeDeleted, Target: "image/cat.png"})
+	f.Close()
+
+	// Assert
+	require.Len(t, published, 2)
+	first := <-published
+	require.Equal(t, "cdn.media.uploaded", first[0])
+	var e Event
+	require.NoError(t, json.Unmarshal([]byte(first[1]), &e))
+	require.Equal(t, "image/cat.png", e.Target)
+	require.Equal(t, "cdn.media.deleted", (<-published)[0])
+}
+
+func TestNATSPublisher_AuthFailure(t *testing.T) {
+	addr, _ := fakeNATS(t)
+	u, _ := url.Parse("nats://" + addr)
+	p := newNATSPublisher(u, nil)
+
+	err := p.publish(context.Background(), "cdn", []message{{Key: "media.uploaded", Value: []byte("{}")}})
+
+	require.ErrorIs(t, err, nats.ErrAuthorization)
+}
+
+func TestForwarder_Kafka(t *testing.T) {
+	// Arrange
+	var mu sync.Mutex
+	var attempts int
+	var records []kafkaRecord
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		require.Equal(t, "/topics/cdn-events", r.URL.Path)
+		require.Equal(t, "application/vnd.kafka.json.v2+json", r.Header.Get("Content-Type"))
+		require.Equal(t, "Basic dXNlcjpwYXNz", r.Header.Get("Authorization"))
+		if attempts == 1 {
+			w.Write([]byte(`{"offsets":[{"partition":null,"offset":null,"error_code":50002,"error":"topic not ready"}]}`))
+			return
+		}
+		var body struct {
+			Records []kafkaRecord `json:"records"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		records = append(records, body.Records...)
+		w.Write([]byte(`{"offsets":[{"partition":0,"offset":1}]}`))
+	}))
+	defer server.Close()
+	p, err := parsePublisher(strings.Replace(server.URL, "http://", "kafka+http://", 1), "Basic dXNlcjpwYXNz", "")
+	require.NoError(t, err)
+	bus := NewBus()
+	f := newForwarder(bus, p, "cdn-events", nil, 10, time.Millisecond)
+
+	// Act
+	bus.Publish(Event{Type: "media.moved", Target: "image/a.png"})
+	f.Close()
+
+	// Assert
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, 2, attempts, "failed records are retried")
+	require.Len(t, records, 1)
+	require.Equal(t, "media.moved", records[0].Key)
+	require.Contains(t, string(records[0].Value), `"target":"image/a.png"`)
+}
+
+func TestKafkaProxyPublisher_CAFile(t *testing.T) {
+	// Arrange
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"offsets":[{"partition":0,"offset":1}]}`))
+	}))
+	defer server.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	require.NoError(t, os.WriteFile(caFile, cert, 0o600))
+	endpoint := strings.Replace(server.URL, "https://", "kafka+https://", 1)
+	messages := []message{{Key: "media.uploaded", Value: []byte("{}")}}
+
+	// Act & Assert
+	untrusted, err := parsePublisher(endpoint, "", "")
+	require.NoError(t, err)
+	require.ErrorContains(t, untrusted.publish(context.Background(), "cdn", messages), "certificate")
+
+	trusted, err := parsePublisher(endpoint, "", caFile)
+	require.NoError(t, err)
+	require.NoError(t, trusted.publish(context.Background(), "cdn", messages))
+}
+
+func TestForwarder_KafkaNative(t *testing.T) {
+	// Arrange
+	cluster, err := kfake.NewCluster(
+		kfake.NumBrokers(1),
+		kfake.SeedTopics(1, "cdn-events"),
+		kfake.EnableSASL(),
+		kfake.Superuser("PLAIN", "cdn", "secret"),
+	)
+	require.NoError(t, err)
+	defer cluster.Close()
+	p, err := parsePublisher("kafka://cdn:secret@"+strings.Join(cluster.ListenAddrs(), ","), "", "")
+	require.NoError(t, err)
+	bus := NewBus()
+	f := newForwarder(bus, p, "cdn-events", nil, 10, time.Millisecond)
+
+	// Act
+	bus.Publish(Event{Type: "media.moved", Target: "image/a.png"})
+	f.Close()
+
+	// Assert
+	consumer, err := kgo.NewClient(
+		kgo.SeedBrokers(cluster.ListenAddrs()...),
+		kgo.SASL(plain.Auth{User: "cdn", Pass: "secret"}.AsMechanism()),
+		kgo.ConsumeTopics("cdn-events"),
+		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
+	)
+	require.NoError(t, err)
+	defer consumer.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	fetches := consumer.PollFetches(ctx)
+	require.NoError(t, fetches.Err())
+	records := fetches.Records()
+	require.Len(t, records, 1)
+	require.Equal(t, "media.moved", string(records[0].Key))
+	require.Contains(t, string(records[0].Value), `"target":"image/a.png"`)
+}
+
+func TestKafkaPublisher_AuthFailure(t *testing.T) {
+	cluster, err := kfake.NewCluster(kfake.SeedTopics(1, "cdn-events"), kfake.EnableSASL(), kfake.Superuser("PLAIN", "cdn", "secret"))
+	require.NoError(t, err)
+	defer cluster.Close()
+	p, err := parsePublisher("kafka://cdn:wrong@"+cluster.ListenAddrs()[0], "", "")
+	require.NoError(t, err)
+	defer p.close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = p.publish(ctx, "cdn-events", []message{{Key: "media.uploaded", Value: []byte("{}")}})
+
+	require.Error(t, err)
+	require.NotErrorIs(t, err, context.DeadlineExceeded, "authentication failures are reported")
+}
+
+func TestParsePublisher_Invalid(t *testing.T) {
+	for _, endpoint := range []string{"amqp://localhost", "nats://", "kafka://", "kafka+ftp://host"} {
+		_, err := parsePublisher(endpoint, "", "")
+		require.Error(t, err, endpoint)
+	}
+
+	_, err := parsePublisher("tls://localhost:4222", "", filepath.Join(t.TempDir(), "missing.pem"))
+	require.ErrorContains(t, err, "EVENTS_BUS_CA_FILE")
+}
@@ -0,0 +1,140 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+)
+
+// kafkaPublisher produces records with the Kafka client, keyed by the event
+// type and acknowledged by all in-sync replicas. Until a broker answered it
+// pings one before producing, since the client keeps retrying records when
+// it cannot connect or authenticate and would only report the deadline.
+type kafkaPublisher struct {
+	client    *kgo.Client
+	connected bool
+}
+
+// newKafkaPublisher produces to the comma separated brokers of u, over TLS
+// for kafka+tls:// URLs and authenticated with SASL/PLAIN if u has a user.
+// Certificates are verified with roots, or the system's if nil.
+func newKafkaPublisher(u *url.URL, roots *x509.CertPool) (*kafkaPublisher, error) {
+	opts := []kgo.Opt{kgo.SeedBrokers(strings.Split(u.Host, ",")...), kgo.ClientID("go-fast-cdn")}
+	if u.Scheme == "kafka+tls" {
+		opts = append(opts, kgo.DialTLSConfig(&tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}))
+	}
+	if u.User != nil {
+		password, _ := u.User.Password()
+		opts = append(opts, kgo.SASL(plain.Auth{User: u.User.Username(), Pass: password}.AsMechanism()))
+	}
+	client, err := kgo.NewClient(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &kafkaPublisher{client: client}, nil
+}
+
+func (p *kafkaPublisher) publish(ctx context.Context, topic string, messages []message) error {
+	if !p.connected {
+		if err := p.client.Ping(ctx); err != nil {
+			return err
+		}
+		p.connected = true
+	}
+
+	records := make([]*kgo.Record, len(messages))
+	for i, m := range messages {
+		records[i] = &kgo.Record{Topic: topic, Key: []byte(m.Key), Value: m.Value}
+	}
+	return p.client.ProduceSync(ctx, records...).FirstErr()
+}
+
+func (p *kafkaPublisher) close() {
+	p.client.Close()
+}
+
+// kafkaProxyPublisher produces records through the v2 API of a Kafka REST
+// Proxy, for clusters only reachable over HTTP.
+type kafkaProxyPublisher struct {
+	baseURL    string
+	authHeader string
+	client     *http.Client
+}
+
+func newKafkaProxyPublisher(baseURL, authHeader string, roots *x509.CertPool) *kafkaProxyPublisher {
+	client := &http.Client{Timeout: 10 * time.Second}
+	if roots != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}
+		client.Transport = transport
+	}
+	return &kafkaProxyPublisher{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		authHeader: authHeader,
+		client:     client,
+	}
+}
+
+type kafkaRecord struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+func (p *kafkaProxyPublisher) publish(ctx context.Context, topic string, messages []message) error {
+	records := make([]kafkaRecord, len(messages))
+	for i, m := range messages {
+		records[i] = kafkaRecord{Key: m.Key, Value: m.Value}
+	}
+	body, err := json.Marshal(map[string]any{"records": records})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/topics/"+url.PathEscape(topic), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+	if p.authHeader != "" {
+		req.Header.Set("Authorization", p.authHeader)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("Kafka REST Proxy returned %s", resp.Status)
+	}
+
+	// Records can fail one by one while the request succeeds
+	var produced struct {
+		Offsets []struct {
+			ErrorCode *int   `json:"error_code"`
+			Error     string `json:"error"`
+		} `json:"offsets"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&produced); err != nil {
+		return nil
+	}
+	for _, offset := range produced.Offsets {
+		if offset.ErrorCode != nil {
+			return fmt.Errorf("Kafka rejected a record: %s", offset.Error)
+		}
+	}
+	return nil
+}
+
+func (p *kafkaProxyPublisher) close() {}
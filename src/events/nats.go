@@ -0,0 +1,60 @@
+package events
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// natsPublisher publishes with the NATS client. It connects on the first
+// batch, reconnects on its own, and flushes after every batch, so the
+// server's answer confirms it processed the messages.
+type natsPublisher struct {
+	url     string
+	options []nats.Option
+	conn    *nats.Conn
+}
+
+// newNATSPublisher publishes to the server at u. Credentials and tls://
+// URLs are handled by the client, which also upgrades to TLS when the
+// server requires it. Certificates are verified with roots, or the
+// system's if nil.
+func newNATSPublisher(u *url.URL, roots *x509.CertPool) *natsPublisher {
+	options := []nats.Option{nats.Name("go-fast-cdn"), nats.Timeout(10 * time.Second)}
+	if roots != nil {
+		options = append(options, nats.Secure(&tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}))
+	}
+	return &natsPublisher{url: u.String(), options: options}
+}
+
+// subjectToken replaces the characters NATS does not allow in subjects.
+var subjectToken = strings.NewReplacer(" ", "_", "\t", "_", "*", "_", ">", "_")
+
+func (p *natsPublisher) publish(ctx context.Context, subject string, messages []message) error {
+	if p.conn == nil {
+		conn, err := nats.Connect(p.url, p.options...)
+		if err != nil {
+			return err
+		}
+		p.conn = conn
+	}
+
+	for _, m := range messages {
+		if err := p.conn.Publish(subject+"."+subjectToken.Replace(m.Key), m.Value); err != nil {
+			return err
+		}
+	}
+	return p.conn.FlushWithContext(ctx)
+}
+
+func (p *natsPublisher) close() {
+	if p.conn != nil {
+		p.conn.Close()
+		p.conn = nil
+	}
+}
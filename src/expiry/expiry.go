@@ -0,0 +1,151 @@
+// Package expiry deletes uploaded files once their expiry time has passed or
+// they reached the age set by a lifecycle rule.
+package expiry
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/cache"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/usage"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+)
+
+const defaultInterval = time.Minute
+
+// Sweeper periodically deletes expired images and documents, and those that
+// reached the age of a lifecycle rule.
+type Sweeper struct {
+	images models.ImageRepository
+	docs   models.DocRepository
+	rules  models.LifecycleRuleRepository
+}
+
+func NewSweeper(images models.ImageRepository, docs models.DocRepository, rules models.LifecycleRuleRepository) *Sweeper {
+	return &Sweeper{images: images, docs: docs, rules: rules}
+}
+
+// Start runs the sweeper in the background. MEDIA_EXPIRY_INTERVAL sets the
+// number of seconds between runs and defaults to 60.
+func Start(s *Sweeper) {
+	interval := defaultInterval
+	if val := os.Getenv("MEDIA_EXPIRY_INTERVAL"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil && parsed > 0 {
+			interval = time.Duration(parsed) * time.Second
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.Run(context.Background(), time.Now())
+		}
+	}()
+}
+
+// Run deletes every file that expired before now or is older than a
+// lifecycle rule allows, and returns the number of deleted files. Files that
+// fail to delete are retried on the next run.
+func (s *Sweeper) Run(ctx context.Context, now time.Time) int {
+	deleted := 0
+	images, err := s.images.GetExpiredImages(ctx, now)
+	if err != nil {
+		log.Printf("Failed to look up expired images: %s", err.Error())
+	}
+	for _, image := range images {
+		if s.deleteImage(ctx, image) {
+			deleted++
+		}
+	}
+
+	docs, err := s.docs.GetExpiredDocs(ctx, now)
+	if err != nil {
+		log.Printf("Failed to look up expired documents: %s", err.Error())
+	}
+	for _, doc := range docs {
+		if s.deleteDoc(ctx, doc) {
+			deleted++
+		}
+	}
+	return deleted + s.applyRules(ctx, now)
+}
+
+// applyRules deletes the files covered by the lifecycle rules and returns the
+// number of deleted files.
+func (s *Sweeper) applyRules(ctx context.Context, now time.Time) int {
+	rules, err := s.rules.GetAllLifecycleRules(ctx)
+	if err != nil {
+		log.Printf("Failed to look up lifecycle rules: %s", err.Error())
+		return 0
+	}
+
+	deleted := 0
+	for _, rule := range rules {
+		if rule.Action != models.LifecycleActionDelete || rule.AfterDays <= 0 {
+			continue
+		}
+		cutoff := now.AddDate(0, 0, -rule.AfterDays)
+		if rule.Applies(models.MediaTypeImage) {
+			images, err := s.images.GetImagesPastLifecycle(ctx, cutoff, rule.OrganizationID)
+			if err != nil {
+				log.Printf("Failed to look up images for lifecycle rule %s: %s", rule.Name, err.Error())
+			}
+			for _, image := range images {
+				if s.deleteImage(ctx, image) {
+					deleted++
+				}
+			}
+		}
+		if rule.Applies(models.MediaTypeDoc) {
+			docs, err := s.docs.GetDocsPastLifecycle(ctx, cutoff, rule.OrganizationID)
+			if err != nil {
+				log.Printf("Failed to look up documents for lifecycle rule %s: %s", rule.Name, err.Error())
+			}
+			for _, doc := range docs {
+				if s.deleteDoc(ctx, doc) {
+					deleted++
+				}
+			}
+		}
+	}
+	return deleted
+}
+
+func (s *Sweeper) deleteImage(ctx context.Context, image models.Image) bool {
+	name, err := s.images.DeleteImage(ctx, image.FileName)
+	if err != nil {
+		log.Printf("Failed to delete expired image %s: %s", image.FileName, err.Error())
+		return false
+	}
+	return deleteFile(name, models.MediaTypeImage, image.OrganizationID)
+}
+
+func (s *Sweeper) deleteDoc(ctx context.Context, doc models.Doc) bool {
+	name, err := s.docs.DeleteDoc(ctx, doc.FileName)
+	if err != nil {
+		log.Printf("Failed to delete expired document %s: %s", doc.FileName, err.Error())
+		return false
+	}
+	return deleteFile(name, models.MediaTypeDoc, doc.OrganizationID)
+}
+
+// deleteFile removes an expired file from disk. A file that is already gone
+// counts as deleted.
+func deleteFile(fileName, mediaType string, orgID *uint) bool {
+	cache.Invalidate(mediaType, fileName)
+	err := usage.Track(mediaType, orgID, fileName, func() error {
+		return util.DeleteFile(fileName, models.MediaFolder(mediaType))
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("Failed to delete expired file %s: %s", fileName, err.Error())
+		return false
+	}
+	return true
+}
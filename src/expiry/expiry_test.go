@@ -0,0 +1,98 @@
+package expiry
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestSweeper_Run(t *testing.T) {
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	imageDir := filepath.Join(util.ExPath, "uploads", "images")
+	require.NoError(t, os.MkdirAll(imageDir, 0o755))
+
+	images := database.NewImageRepo(database.DB)
+	docs := database.NewDocRepo(database.DB)
+
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Hour)
+	for _, image := range []models.Image{
+		{FileName: "expired.png", Checksum: []byte("a"), ExpiresAt: &past},
+		{FileName: "later.png", Checksum: []byte("b"), ExpiresAt: &future},
+		{FileName: "kept.png", Checksum: []byte("c")},
+	} {
+		_, err := images.AddImage(context.Background(), image)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(imageDir, image.FileName), []byte("x"), 0o644))
+	}
+	// Missing files do not prevent the record from being deleted
+	_, err := docs.AddDoc(context.Background(), models.Doc{FileName: "gone.pdf", Checksum: []byte("d"), ExpiresAt: &past})
+	require.NoError(t, err)
+
+	require.Equal(t, 2, NewSweeper(images, docs, database.NewLifecycleRuleRepo(database.DB)).Run(context.Background(), now))
+
+	ctx := context.Background()
+	_, err = images.GetImageByFileName(ctx, "expired.png")
+	require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	require.NoFileExists(t, filepath.Join(imageDir, "expired.png"))
+	_, err = images.GetImageByFileName(ctx, "later.png")
+	require.NoError(t, err)
+	_, err = images.GetImageByFileName(ctx, "kept.png")
+	require.NoError(t, err)
+	_, err = docs.GetDocByFileName(ctx, "gone.pdf")
+	require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
+
+func TestSweeper_Run_LifecycleRules(t *testing.T) {
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	ctx := context.Background()
+
+	images := database.NewImageRepo(database.DB)
+	docs := database.NewDocRepo(database.DB)
+	rules := database.NewLifecycleRuleRepo(database.DB)
+	orgID := uint(1)
+	require.NoError(t, rules.CreateLifecycleRule(ctx, &models.LifecycleRule{Name: "old images", MediaType: models.MediaTypeImage, Action: models.LifecycleActionDelete, AfterDays: 30}))
+	require.NoError(t, rules.CreateLifecycleRule(ctx, &models.LifecycleRule{Name: "org docs", OrganizationID: &orgID, Action: models.LifecycleActionDelete, AfterDays: 7}))
+
+	now := time.Now()
+	old, recent, future := now.AddDate(0, 0, -31), now.AddDate(0, 0, -10), now.Add(time.Hour)
+	for _, image := range []models.Image{
+		{Model: gorm.Model{CreatedAt: old}, FileName: "old.png", Checksum: []byte("a")},
+		{Model: gorm.Model{CreatedAt: recent}, FileName: "recent.png", Checksum: []byte("b")},
+		// An expiry time of its own takes precedence over the rules
+		{Model: gorm.Model{CreatedAt: old}, FileName: "pinned.png", Checksum: []byte("c"), ExpiresAt: &future},
+	} {
+		_, err := images.AddImage(ctx, image)
+		require.NoError(t, err)
+	}
+	for _, doc := range []models.Doc{
+		{Model: gorm.Model{CreatedAt: recent}, FileName: "org.pdf", Checksum: []byte("d"), OrganizationID: &orgID},
+		{Model: gorm.Model{CreatedAt: old}, FileName: "other.pdf", Checksum: []byte("e")},
+	} {
+		_, err := docs.AddDoc(ctx, doc)
+		require.NoError(t, err)
+	}
+
+	require.Equal(t, 2, NewSweeper(images, docs, rules).Run(ctx, now))
+
+	_, err := images.GetImageByFileName(ctx, "old.png")
+	require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	_, err = docs.GetDocByFileName(ctx, "org.pdf")
+	require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	for _, name := range []string{"recent.png", "pinned.png"} {
+		_, err = images.GetImageByFileName(ctx, name)
+		require.NoError(t, err, name)
+	}
+	_, err = docs.GetDocByFileName(ctx, "other.pdf")
+	require.NoError(t, err)
+}
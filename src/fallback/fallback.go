@@ -0,0 +1,191 @@
+// Package fallback serves files missing from the uploads folder, e.g. during
+// a partial migration or while a replica catches up, from other sources
+// before answering 404. Every file served that way is recorded as a repair
+// task, and Repair copies the files back into the uploads folder.
+package fallback
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/usage"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"gorm.io/gorm"
+)
+
+var sources []Source
+
+// Start enables the sources configured in MEDIA_FALLBACKS.
+func Start() error {
+	parsed, err := SourcesFromEnv()
+	if err != nil {
+		return err
+	}
+	sources = parsed
+	for _, source := range sources {
+		log.Printf("Serving missing files from %s", source)
+	}
+	return nil
+}
+
+// Fallback looks up missing files in the sources and records repair tasks.
+type Fallback struct {
+	Sources []Source
+	images  models.ImageRepository
+	docs    models.DocRepository
+	repairs models.RepairTaskRepository
+}
+
+// New returns a Fallback using the sources enabled by Start
+func New(images models.ImageRepository, docs models.DocRepository, repairs models.RepairTaskRepository) *Fallback {
+	return &Fallback{Sources: sources, images: images, docs: docs, repairs: repairs}
+}
+
+// owner returns the organization owning the file, or gorm.ErrRecordNotFound
+// if there is no record of it.
+func (f *Fallback) owner(ctx context.Context, mediaType, fileName string) (*uint, error) {
+	if mediaType == models.MediaTypeImage {
+		image, err := f.images.GetImageByFileName(ctx, fileName)
+		return image.OrganizationID, err
+	}
+	doc, err := f.docs.GetDocByFileName(ctx, fileName)
+	return doc.OrganizationID, err
+}
+
+// open returns the file from the first source that has it
+func (f *Fallback) open(ctx context.Context, mediaType, fileName string) (io.ReadCloser, int64, Source, error) {
+	for _, source := range f.Sources {
+		r, size, err := source.Open(ctx, models.MediaFolder(mediaType), fileName)
+		if err == nil {
+			return r, size, source, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Failed to look up %s/%s in %s: %s", models.MediaFolder(mediaType), fileName, source, err.Error())
+		}
+	}
+	return nil, 0, nil, fs.ErrNotExist
+}
+
+// Middleware serves downloads of files that have a record but are missing
+// from the uploads folder from the first source that has them. Only files
+// with a record are looked up, so requests for arbitrary names can't make
+// the server query every source.
+func (f *Fallback) Middleware(mediaType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if len(f.Sources) == 0 || (c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead) {
+			c.Next()
+			return
+		}
+
+		fileName, err := util.FilterFilename(path.Base(c.Request.URL.Path))
+		if err != nil {
+			c.Next()
+			return
+		}
+		if _, err := os.Stat(filepath.Join(util.ExPath, "uploads", models.MediaFolder(mediaType), fileName)); !errors.Is(err, fs.ErrNotExist) {
+			c.Next()
+			return
+		}
+		ctx := c.Request.Context()
+		if _, err := f.owner(ctx, mediaType, fileName); err != nil {
+			c.Next()
+			return
+		}
+
+		r, size, source, err := f.open(ctx, mediaType, fileName)
+		if err != nil {
+			c.Next()
+			return
+		}
+		defer r.Close()
+
+		task := &models.RepairTask{MediaType: mediaType, FileName: fileName, Source: source.String()}
+		if err := f.repairs.AddRepairTask(ctx, task); err != nil {
+			log.Printf("Failed to record the repair of %s/%s: %s", models.MediaFolder(mediaType), fileName, err.Error())
+		}
+
+		contentType := mime.TypeByExtension(filepath.Ext(fileName))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		c.DataFromReader(http.StatusOK, size, contentType, r, nil)
+		c.Abort()
+	}
+}
+
+// Repair copies the files of the pending repair tasks from their sources into
+// the uploads folder and returns the number of repaired and failed tasks.
+func (f *Fallback) Repair(ctx context.Context) (repaired, failed int, err error) {
+	tasks, err := f.repairs.GetRepairTasks(ctx, models.RepairStatusPending)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, task := range tasks {
+		task := task
+		if err := f.repair(ctx, &task); err != nil {
+			task.Status = models.RepairStatusFailed
+			task.Error = err.Error()
+			failed++
+		} else {
+			now := time.Now()
+			task.Status = models.RepairStatusRepaired
+			task.Error = ""
+			task.RepairedAt = &now
+			repaired++
+		}
+		if err := f.repairs.UpdateRepairTask(ctx, &task); err != nil {
+			return repaired, failed, err
+		}
+	}
+	return repaired, failed, nil
+}
+
+func (f *Fallback) repair(ctx context.Context, task *models.RepairTask) error {
+	owner, err := f.owner(ctx, task.MediaType, task.FileName)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errors.New("the file was deleted")
+	} else if err != nil {
+		return err
+	}
+
+	dest := filepath.Join(util.ExPath, "uploads", models.MediaFolder(task.MediaType), task.FileName)
+	if _, err := os.Stat(dest); err == nil {
+		// Restored some other way in the meantime
+		return nil
+	}
+
+	r, _, source, err := f.open(ctx, task.MediaType, task.FileName)
+	if err != nil {
+		return errors.New("no source has the file any more")
+	}
+	defer r.Close()
+	task.Source = source.String()
+
+	return usage.Track(task.MediaType, owner, task.FileName, func() error {
+		tmp, err := os.CreateTemp(filepath.Dir(dest), ".repair-*")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name())
+		if _, err := io.Copy(tmp, r); err != nil {
+			tmp.Close()
+			return err
+		}
+		if err := tmp.Close(); err != nil {
+			return err
+		}
+		return os.Rename(tmp.Name(), dest)
+	})
+}
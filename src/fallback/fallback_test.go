@@ -0,0 +1,90 @@
+package fallback
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSource(t *testing.T) {
+	source, err := ParseSource("dir:///srv/old-cdn")
+	require.NoError(t, err)
+	require.Equal(t, "dir:///srv/old-cdn", source.String())
+
+	for _, raw := range []string{"dir://", "s3:///prefix", "ftp://host/path"} {
+		_, err := ParseSource(raw)
+		require.Error(t, err, raw)
+	}
+}
+
+func TestFallback(t *testing.T) {
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	require.NoError(t, os.MkdirAll(filepath.Join(util.ExPath, "uploads", "images"), 0o755))
+
+	legacy := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(legacy, "images"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(legacy, "images", "logo.png"), []byte("logo"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(legacy, "images", "unknown.png"), []byte("unknown"), 0o644))
+	require.NoError(t, database.DB.Create(&models.Image{FileName: "logo.png", Checksum: []byte("a")}).Error)
+
+	repairs := database.NewRepairTaskRepo(database.DB)
+	f := New(database.NewImageRepo(database.DB), database.NewDocRepo(database.DB), repairs)
+	f.Sources = []Source{dirSource(legacy)}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Group("/download/images", f.Middleware(models.MediaTypeImage)).Static("/", filepath.Join(util.ExPath, "uploads", "images"))
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	w := get("/download/images/logo.png")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "logo", w.Body.String())
+	require.Equal(t, "image/png", w.Header().Get("Content-Type"))
+	// Serving it again doesn't add a second task
+	require.Equal(t, http.StatusOK, get("/download/images/logo.png").Code)
+
+	// Files without a record are not looked up
+	require.Equal(t, http.StatusNotFound, get("/download/images/unknown.png").Code)
+
+	ctx := context.Background()
+	tasks, err := repairs.GetRepairTasks(ctx, models.RepairStatusPending)
+	require.NoError(t, err)
+	require.Len(t, tasks, 1)
+	require.Equal(t, "logo.png", tasks[0].FileName)
+	require.Equal(t, f.Sources[0].String(), tasks[0].Source)
+
+	repaired, failed, err := f.Repair(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, repaired)
+	require.Equal(t, 0, failed)
+	data, err := os.ReadFile(filepath.Join(util.ExPath, "uploads", "images", "logo.png"))
+	require.NoError(t, err)
+	require.Equal(t, "logo", string(data))
+
+	tasks, err = repairs.GetRepairTasks(ctx, models.RepairStatusRepaired)
+	require.NoError(t, err)
+	require.Len(t, tasks, 1)
+	require.NotNil(t, tasks[0].RepairedAt)
+
+	// Tasks for files no source has any more fail
+	require.NoError(t, database.DB.Create(&models.Image{FileName: "lost.png", Checksum: []byte("b")}).Error)
+	require.NoError(t, repairs.AddRepairTask(ctx, &models.RepairTask{MediaType: models.MediaTypeImage, FileName: "lost.png", Source: f.Sources[0].String()}))
+	repaired, failed, err = f.Repair(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 0, repaired)
+	require.Equal(t, 1, failed)
+}
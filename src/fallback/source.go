@@ -0,0 +1,224 @@
+package fallback
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/breaker"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// Source is a location files missing from the uploads folder are looked up
+// in, laid out like it: <folder>/<file name>, where folder is images or docs.
+type Source interface {
+	// String returns the source URL without credentials.
+	String() string
+	// Open returns the file and its size, or an error matching
+	// fs.ErrNotExist if the source does not have it.
+	Open(ctx context.Context, folder, fileName string) (io.ReadCloser, int64, error)
+}
+
+// Uploader is a source clients can put files into directly, with presigned
+// URLs, so large uploads bypass the server.
+type Uploader interface {
+	Source
+	// PresignPut returns a URL a PUT request of the file can be sent to
+	// until expiry passes.
+	PresignPut(ctx context.Context, folder, fileName string, expiry time.Duration) (string, error)
+	// Stat returns the size of the file, or an error matching
+	// fs.ErrNotExist if the source does not have it.
+	Stat(ctx context.Context, folder, fileName string) (int64, error)
+	Remove(ctx context.Context, folder, fileName string) error
+}
+
+// DirectUploader returns the first source enabled by Start that accepts
+// direct uploads, or nil if none does.
+func DirectUploader() Uploader {
+	for _, source := range sources {
+		if uploader, ok := source.(Uploader); ok {
+			return uploader
+		}
+	}
+	return nil
+}
+
+// ParseSource parses a source URL: dir:///path for a local directory, e.g.
+// the uploads folder of a previous installation, or s3://bucket/prefix.
+// Credentials are read from the environment, see newS3Source.
+func ParseSource(raw string) (Source, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fallback source %q: %w", raw, err)
+	}
+
+	switch u.Scheme {
+	case "dir":
+		if u.Path == "" {
+			return nil, fmt.Errorf("invalid fallback source %q: missing path", raw)
+		}
+		return dirSource(filepath.FromSlash(u.Path)), nil
+	case "s3":
+		if u.Host == "" {
+			return nil, fmt.Errorf("invalid fallback source %q: missing bucket", raw)
+		}
+		return newS3Source(u.Host, strings.Trim(path.Clean("/"+u.Path), "/"))
+	default:
+		return nil, fmt.Errorf("unsupported fallback source scheme %q", u.Scheme)
+	}
+}
+
+// SourcesFromEnv parses the comma separated source URLs in MEDIA_FALLBACKS,
+// in the order they are tried.
+func SourcesFromEnv() ([]Source, error) {
+	sources := []Source{}
+	for _, raw := range strings.Split(os.Getenv("MEDIA_FALLBACKS"), ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		source, err := ParseSource(raw)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, source)
+	}
+	return sources, nil
+}
+
+type dirSource string
+
+func (d dirSource) String() string {
+	return "dir://" + filepath.ToSlash(string(d))
+}
+
+func (d dirSource) Open(ctx context.Context, folder, fileName string) (io.ReadCloser, int64, error) {
+	f, err := os.Open(filepath.Join(string(d), folder, fileName))
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		f.Close()
+		return nil, 0, fs.ErrNotExist
+	}
+	return f, info.Size(), nil
+}
+
+type s3Source struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+// newS3Source connects to the bucket using FALLBACK_S3_ENDPOINT (defaults to
+// AWS), FALLBACK_S3_REGION, FALLBACK_S3_ACCESS_KEY_ID,
+// FALLBACK_S3_SECRET_ACCESS_KEY and FALLBACK_S3_USE_SSL (defaults to true).
+func newS3Source(bucket, prefix string) (*s3Source, error) {
+	endpoint := os.Getenv("FALLBACK_S3_ENDPOINT")
+	if endpoint == "" {
+		endpoint = "s3.amazonaws.com"
+	}
+	useSSL := true
+	if parsed, err := strconv.ParseBool(os.Getenv("FALLBACK_S3_USE_SSL")); err == nil {
+		useSSL = parsed
+	}
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds: credentials.NewStaticV4(
+			os.Getenv("FALLBACK_S3_ACCESS_KEY_ID"),
+			os.Getenv("FALLBACK_S3_SECRET_ACCESS_KEY"),
+			"",
+		),
+		Region: os.Getenv("FALLBACK_S3_REGION"),
+		Secure: useSSL,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &s3Source{client: client, bucket: bucket, prefix: prefix}, nil
+}
+
+func (s *s3Source) String() string {
+	return "s3://" + path.Join(s.bucket, s.prefix)
+}
+
+// guard returns the circuit breaker of the bucket, which S3 calls go
+// through so an unreachable bucket fails fast.
+func (s *s3Source) guard() *breaker.Breaker {
+	return breaker.Get("fallback " + s.String())
+}
+
+func (s *s3Source) Open(ctx context.Context, folder, fileName string) (io.ReadCloser, int64, error) {
+	var object *minio.Object
+	var size int64
+	err := s.guard().Try(ctx, func(ctx context.Context) error {
+		var err error
+		object, err = s.client.GetObject(ctx, s.bucket, path.Join(s.prefix, folder, fileName), minio.GetObjectOptions{})
+		if err != nil {
+			return err
+		}
+		info, err := object.Stat()
+		if err != nil {
+			object.Close()
+			return s3Error(err)
+		}
+		size = info.Size
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return object, size, nil
+}
+
+func (s *s3Source) PresignPut(ctx context.Context, folder, fileName string, expiry time.Duration) (string, error) {
+	var presigned string
+	err := s.guard().Try(ctx, func(ctx context.Context) error {
+		u, err := s.client.PresignedPutObject(ctx, s.bucket, path.Join(s.prefix, folder, fileName), expiry)
+		if err != nil {
+			return err
+		}
+		presigned = u.String()
+		return nil
+	})
+	return presigned, err
+}
+
+func (s *s3Source) Stat(ctx context.Context, folder, fileName string) (int64, error) {
+	var size int64
+	err := s.guard().Try(ctx, func(ctx context.Context) error {
+		info, err := s.client.StatObject(ctx, s.bucket, path.Join(s.prefix, folder, fileName), minio.StatObjectOptions{})
+		if err != nil {
+			return s3Error(err)
+		}
+		size = info.Size
+		return nil
+	})
+	return size, err
+}
+
+func (s *s3Source) Remove(ctx context.Context, folder, fileName string) error {
+	return s.guard().Try(ctx, func(ctx context.Context) error {
+		return s.client.RemoveObject(ctx, s.bucket, path.Join(s.prefix, folder, fileName), minio.RemoveObjectOptions{})
+	})
+}
+
+// s3Error maps missing objects to fs.ErrNotExist, which the bucket answered
+// and so do not count against its circuit breaker.
+func s3Error(err error) error {
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return breaker.Permanent(fs.ErrNotExist)
+	}
+	return err
+}
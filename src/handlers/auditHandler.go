@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/audit"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+)
+
+const maxAuditLogLimit = 1000
+
+type AuditHandler struct {
+	auditRepo models.AuditLogRepository
+}
+
+func NewAuditHandler(auditRepo models.AuditLogRepository) *AuditHandler {
+	return &AuditHandler{auditRepo: auditRepo}
+}
+
+// GetAuditLogs returns the newest audit log entries, optionally filtered with
+// ?action= and limited with ?limit= (default 100)
+func (h *AuditHandler) GetAuditLogs(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit < 1 {
+		problem.Write(c, http.StatusBadRequest, "Invalid limit")
+		return
+	}
+	limit = min(limit, maxAuditLogLimit)
+
+	entries, err := h.auditRepo.GetAuditLogs(c.Request.Context(), c.Query("action"), limit)
+	if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to fetch audit log")
+		return
+	}
+	c.JSON(http.StatusOK, entries)
+}
+
+// ExportAuditLogs streams audit log entries as newline-delimited JSON or CEF
+// (?format=json|cef) for import into a SIEM. ?since= takes an RFC 3339
+// timestamp and defaults to the beginning of the log.
+func (h *AuditHandler) ExportAuditLogs(c *gin.Context) {
+	format := c.DefaultQuery("format", audit.FormatJSON)
+	if format != audit.FormatJSON && format != audit.FormatCEF {
+		problem.Write(c, http.StatusBadRequest, "Format must be json or cef")
+		return
+	}
+
+	var since time.Time
+	if value := c.Query("since"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			problem.Write(c, http.StatusBadRequest, "Invalid since timestamp")
+			return
+		}
+		since = parsed
+	}
+
+	entries, err := h.auditRepo.GetAuditLogsSince(c.Request.Context(), since)
+	if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to fetch audit log")
+		return
+	}
+
+	contentType := "application/x-ndjson"
+	if format == audit.FormatCEF {
+		contentType = "text/plain; charset=utf-8"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", "attachment; filename=audit."+format)
+	c.Status(http.StatusOK)
+	for _, entry := range entries {
+		line, err := audit.Encode(entry, format)
+		if err != nil {
+			continue
+		}
+		c.Writer.Write(append(line, '\n'))
+	}
+}
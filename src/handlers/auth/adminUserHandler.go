@@ -6,6 +6,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
 )
 
 type AdminUserHandler struct {
@@ -18,9 +19,9 @@ func NewAdminUserHandler(userRepo models.UserRepository) *AdminUserHandler {
 
 // List all users
 func (h *AdminUserHandler) ListUsers(c *gin.Context) {
-	users, err := h.userRepo.GetAllUsers()
+	users, err := h.userRepo.GetAllUsers(c.Request.Context())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+		problem.Write(c, http.StatusInternalServerError, "Failed to fetch users")
 		return
 	}
 	c.JSON(http.StatusOK, users)
@@ -34,7 +35,7 @@ func (h *AdminUserHandler) CreateUser(c *gin.Context) {
 		Role     string `json:"role"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		problem.Invalid(c, err)
 		return
 	}
 	user := &models.User{
@@ -42,11 +43,11 @@ func (h *AdminUserHandler) CreateUser(c *gin.Context) {
 		Role:  req.Role,
 	}
 	if err := user.HashPassword(req.Password); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid password"})
+		problem.Write(c, http.StatusBadRequest, "Invalid password")
 		return
 	}
-	if err := h.userRepo.CreateUser(user); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+	if err := h.userRepo.CreateUser(c.Request.Context(), user); err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to create user")
 		return
 	}
 	c.JSON(http.StatusCreated, user)
@@ -57,12 +58,12 @@ func (h *AdminUserHandler) UpdateUser(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		problem.Write(c, http.StatusBadRequest, "Invalid user ID")
 		return
 	}
-	user, err := h.userRepo.GetUserByID(uint(id))
+	user, err := h.userRepo.GetUserByID(c.Request.Context(), uint(id))
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		problem.NotFound(c, "User not found")
 		return
 	}
 	var req struct {
@@ -71,7 +72,7 @@ func (h *AdminUserHandler) UpdateUser(c *gin.Context) {
 		IsVerified *bool   `json:"is_verified"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		problem.Invalid(c, err)
 		return
 	}
 	if req.Email != nil {
@@ -83,8 +84,8 @@ func (h *AdminUserHandler) UpdateUser(c *gin.Context) {
 	if req.IsVerified != nil {
 		user.IsVerified = *req.IsVerified
 	}
-	if err := h.userRepo.UpdateUser(user); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+	if err := h.userRepo.UpdateUser(c.Request.Context(), user); err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to update user")
 		return
 	}
 	c.JSON(http.StatusOK, user)
@@ -95,11 +96,11 @@ func (h *AdminUserHandler) DeleteUser(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		problem.Write(c, http.StatusBadRequest, "Invalid user ID")
 		return
 	}
-	if err := h.userRepo.DeleteUser(uint(id)); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
+	if err := h.userRepo.DeleteUser(c.Request.Context(), uint(id)); err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to delete user")
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "User deleted"})
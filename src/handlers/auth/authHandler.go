@@ -1,46 +1,52 @@
 package auth
 
 import (
+	"errors"
+	"io"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/go-playground/validator/v10"
+	"github.com/kevinanielsen/go-fast-cdn/src/audit"
 	"github.com/kevinanielsen/go-fast-cdn/src/auth"
 	"github.com/kevinanielsen/go-fast-cdn/src/database"
 	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"gorm.io/gorm"
 )
 
 type AuthHandler struct {
 	userRepo   models.UserRepository
 	jwtService *auth.JWTService
-	validator  *validator.Validate
 }
 
 type RegisterRequest struct {
-	Email    string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required,min=8"`
-	Role     string `json:"role,omitempty" validate:"omitempty,oneof=admin user"`
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required,min=8"`
+	Role     string `json:"role,omitempty" binding:"omitempty,oneof=admin user"`
 }
 
 type LoginRequest struct {
-	Email      string `json:"email" validate:"required,email"`
-	Password   string `json:"password" validate:"required"`
+	Email      string `json:"email" binding:"required,email"`
+	Password   string `json:"password" binding:"required"`
 	TwoFAToken string `json:"two_fa_token,omitempty"`
+	BackupCode string `json:"backup_code,omitempty"`
 }
 
 type RefreshRequest struct {
-	RefreshToken string `json:"refresh_token" validate:"required"`
+	RefreshToken string `json:"refresh_token"`
 }
 
 type ChangePasswordRequest struct {
-	CurrentPassword string `json:"current_password" validate:"required"`
-	NewPassword     string `json:"new_password" validate:"required,min=8"`
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=8"`
 }
 
 type ChangeEmailRequest struct {
-	NewEmail string `json:"new_email" validate:"required,email"`
+	NewEmail string `json:"new_email" binding:"required,email"`
 }
 
 type TwoFASetupRequest struct {
@@ -51,8 +57,20 @@ type TwoFASetupRequest struct {
 type AuthResponse struct {
 	User         *UserResponse `json:"user"`
 	AccessToken  string        `json:"access_token"`
-	RefreshToken string        `json:"refresh_token"`
+	RefreshToken string        `json:"refresh_token,omitempty"`
 	ExpiresIn    int64         `json:"expires_in"`
+	// CSRFToken is set in cookie mode, where the refresh token is only
+	// sent as an httpOnly cookie.
+	CSRFToken string `json:"csrf_token,omitempty"`
+}
+
+type SessionResponse struct {
+	ID         uint       `json:"id"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
 }
 
 type UserResponse struct {
@@ -69,7 +87,6 @@ func NewAuthHandler(userRepo models.UserRepository) *AuthHandler {
 	return &AuthHandler{
 		userRepo:   userRepo,
 		jwtService: auth.NewJWTService(),
-		validator:  validator.New(),
 	}
 }
 
@@ -77,33 +94,28 @@ func NewAuthHandler(userRepo models.UserRepository) *AuthHandler {
 func (h *AuthHandler) Register(c *gin.Context) {
 	var req RegisterRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
-		return
-	}
-
-	if err := h.validator.Struct(req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "details": err.Error()})
+		problem.Invalid(c, err)
 		return
 	}
 
 	// Check if user already exists
-	existingUser, _ := h.userRepo.GetUserByEmail(req.Email)
+	existingUser, _ := h.userRepo.GetUserByEmail(c.Request.Context(), req.Email)
 	if existingUser != nil {
-		c.JSON(http.StatusConflict, gin.H{"error": "User with this email already exists"})
+		problem.Write(c, http.StatusConflict, "User with this email already exists")
 		return
 	}
 
 	// Check registration enabled in config
 	configRepo := database.NewConfigRepo(database.DB)
-	userCount, err := h.userRepo.CountUsers()
+	userCount, err := h.userRepo.CountUsers(c.Request.Context())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check user count"})
+		problem.Write(c, http.StatusInternalServerError, "Failed to check user count")
 		return
 	}
 	if userCount > 0 {
 		val, err := configRepo.Get("registration_enabled")
 		if err == nil && val == "false" {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Registration is currently disabled"})
+			problem.Write(c, http.StatusForbidden, "Registration is currently disabled")
 			return
 		}
 	}
@@ -125,41 +137,33 @@ func (h *AuthHandler) Register(c *gin.Context) {
 
 	// Hash password
 	if err := user.HashPassword(req.Password); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process password"})
+		problem.Write(c, http.StatusInternalServerError, "Failed to process password")
 		return
 	}
 
 	// Save user to database
-	if err := h.userRepo.CreateUser(user); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+	if err := h.userRepo.CreateUser(c.Request.Context(), user); err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to create user")
 		return
 	}
 
-	// Generate tokens
-	tokenPair, err := h.jwtService.GenerateTokenPair(user)
+	// Create session
+	session, err := h.createSession(c, user.ID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate tokens"})
+		problem.Write(c, http.StatusInternalServerError, "Failed to create session")
 		return
 	}
 
-	// Create session
-	session := &models.UserSession{
-		UserID:       user.ID,
-		RefreshToken: tokenPair.RefreshToken,
-		ExpiresAt:    h.jwtService.RefreshTokenExpiration(),
-	}
-
-	if err := h.userRepo.CreateSession(session); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+	// Generate tokens
+	tokenPair, err := h.jwtService.GenerateTokenPair(user, session)
+	if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to generate tokens")
 		return
 	}
 
-	response := &AuthResponse{
-		User:         h.userToResponse(user),
-		AccessToken:  tokenPair.AccessToken,
-		RefreshToken: tokenPair.RefreshToken,
-		ExpiresIn:    tokenPair.ExpiresIn,
-	}
+	response := h.tokenResponse(c, user, tokenPair)
+
+	audit.RecordUser(c, audit.ActionRegister, user.ID, user.Email, user.Email, gin.H{"role": user.Role})
 
 	c.JSON(http.StatusCreated, response)
 }
@@ -168,20 +172,16 @@ func (h *AuthHandler) Register(c *gin.Context) {
 func (h *AuthHandler) Login(c *gin.Context) {
 	var req LoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
-		return
-	}
-
-	if err := h.validator.Struct(req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "details": err.Error()})
+		problem.Invalid(c, err)
 		return
 	}
 
 	// Get user by email
-	user, err := h.userRepo.GetUserByEmail(req.Email)
+	user, err := h.userRepo.GetUserByEmail(c.Request.Context(), req.Email)
 	if err != nil {
 		log.Printf("[DEBUG] Login - User not found for email: %s", req.Email)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		audit.RecordUser(c, audit.ActionLoginFailed, 0, req.Email, req.Email, gin.H{"reason": "unknown_user"})
+		problem.Abort(c, problem.New(http.StatusUnauthorized, problem.CodeInvalidCredentials, "Invalid credentials"))
 		return
 	}
 	log.Printf("[DEBUG] Login - User found - UserID: %d, Email: %s, Is2FAEnabled: %t, HasSecret: %t",
@@ -200,7 +200,8 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	// Check password
 	if !user.CheckPassword(req.Password) {
 		log.Printf("[DEBUG] Login - Invalid password for user: %d", user.ID)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		audit.RecordUser(c, audit.ActionLoginFailed, user.ID, user.Email, user.Email, gin.H{"reason": "invalid_password"})
+		problem.Abort(c, problem.New(http.StatusUnauthorized, problem.CodeInvalidCredentials, "Invalid credentials"))
 		return
 	}
 
@@ -211,23 +212,40 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		log.Printf("[DEBUG] Login - 2FA is enabled for user: %d, Token provided: %t",
 			user.ID, req.TwoFAToken != "")
 
-		if req.TwoFAToken == "" {
+		if req.TwoFAToken == "" && req.BackupCode == "" {
 			log.Printf("[DEBUG] Login - 2FA token required but not provided for user: %d", user.ID)
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "2FA token required", "requires_2fa": true})
+			problem.Abort(c, problem.New(http.StatusUnauthorized, problem.Code2FARequired, "2FA token required").With("requires_2fa", true))
 			return
 		}
 
-		log.Printf("[DEBUG] Login - Validating TOTP token for user: %d", user.ID)
-		twoFASecret := ""
-		if user.TwoFASecret != nil {
-			twoFASecret = *user.TwoFASecret
-		}
-		if !auth.ValidateTOTP(twoFASecret, req.TwoFAToken) {
-			log.Printf("[DEBUG] Login - Invalid 2FA token for user: %d", user.ID)
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid 2FA token"})
-			return
+		if req.BackupCode != "" {
+			log.Printf("[DEBUG] Login - Validating backup code for user: %d", user.ID)
+			used, err := h.userRepo.UseBackupCode(c.Request.Context(), user.ID, auth.HashBackupCode(req.BackupCode))
+			if err != nil {
+				problem.Write(c, http.StatusInternalServerError, "Failed to verify backup code")
+				return
+			}
+			if !used {
+				log.Printf("[DEBUG] Login - Invalid backup code for user: %d", user.ID)
+				audit.RecordUser(c, audit.ActionLoginFailed, user.ID, user.Email, user.Email, gin.H{"reason": "invalid_backup_code"})
+				problem.Write(c, http.StatusUnauthorized, "Invalid backup code")
+				return
+			}
+			audit.RecordUser(c, audit.ActionBackupCodeUsed, user.ID, user.Email, user.Email, nil)
+		} else {
+			log.Printf("[DEBUG] Login - Validating TOTP token for user: %d", user.ID)
+			twoFASecret := ""
+			if user.TwoFASecret != nil {
+				twoFASecret = *user.TwoFASecret
+			}
+			if !auth.ValidateTOTP(twoFASecret, req.TwoFAToken) {
+				log.Printf("[DEBUG] Login - Invalid 2FA token for user: %d", user.ID)
+				audit.RecordUser(c, audit.ActionLoginFailed, user.ID, user.Email, user.Email, gin.H{"reason": "invalid_2fa_token"})
+				problem.Write(c, http.StatusUnauthorized, "Invalid 2FA token")
+				return
+			}
 		}
-		log.Printf("[DEBUG] Login - 2FA token validated successfully for user: %d", user.ID)
+		log.Printf("[DEBUG] Login - 2FA validated successfully for user: %d", user.ID)
 	} else {
 		log.Printf("[DEBUG] Login - 2FA is disabled for user: %d", user.ID)
 	}
@@ -235,102 +253,97 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	// Update last login
 	now := time.Now()
 	user.LastLogin = &now
-	h.userRepo.UpdateUser(user)
+	h.userRepo.UpdateUser(c.Request.Context(), user)
 
-	// Generate tokens
-	tokenPair, err := h.jwtService.GenerateTokenPair(user)
+	// Create session
+	session, err := h.createSession(c, user.ID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate tokens"})
+		problem.Write(c, http.StatusInternalServerError, "Failed to create session")
 		return
 	}
 
-	// Create session
-	session := &models.UserSession{
-		UserID:       user.ID,
-		RefreshToken: tokenPair.RefreshToken,
-		ExpiresAt:    h.jwtService.RefreshTokenExpiration(),
-	}
-
-	if err := h.userRepo.CreateSession(session); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+	// Generate tokens
+	tokenPair, err := h.jwtService.GenerateTokenPair(user, session)
+	if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to generate tokens")
 		return
 	}
 
-	response := &AuthResponse{
-		User:         h.userToResponse(user),
-		AccessToken:  tokenPair.AccessToken,
-		RefreshToken: tokenPair.RefreshToken,
-		ExpiresIn:    tokenPair.ExpiresIn,
-	}
+	response := h.tokenResponse(c, user, tokenPair)
+
+	audit.RecordUser(c, audit.ActionLogin, user.ID, user.Email, user.Email, nil)
 
 	c.JSON(http.StatusOK, response)
 }
 
 // RefreshToken generates new tokens using refresh token
 func (h *AuthHandler) RefreshToken(c *gin.Context) {
-	var req RefreshRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+	refreshToken, ok := refreshTokenFromRequest(c)
+	if !ok {
+		problem.InvalidFields(c, problem.FieldError{Field: "refresh_token", Rule: "required", Message: "is required"})
 		return
 	}
 
-	if err := h.validator.Struct(req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "details": err.Error()})
+	// Get session by refresh token
+	session, err := h.userRepo.GetSessionByRefreshToken(c.Request.Context(), refreshToken)
+	if err != nil {
+		problem.Abort(c, problem.New(http.StatusUnauthorized, problem.CodeTokenInvalid, "Invalid refresh token"))
 		return
 	}
 
-	// Get session by refresh token
-	session, err := h.userRepo.GetSessionByRefreshToken(req.RefreshToken)
+	// Rotate the refresh token, keeping the session so it stays identifiable
+	// in the session list
+	refreshToken, err = h.jwtService.GenerateRefreshToken()
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		problem.Write(c, http.StatusInternalServerError, "Failed to generate tokens")
 		return
 	}
+	now := time.Now()
+	session.RefreshToken = refreshToken
+	session.ExpiresAt = h.jwtService.RefreshTokenExpiration()
+	session.UserAgent = c.Request.UserAgent()
+	session.IP = c.ClientIP()
+	session.LastUsedAt = &now
 
 	// Generate new tokens
-	tokenPair, err := h.jwtService.GenerateTokenPair(&session.User)
+	tokenPair, err := h.jwtService.GenerateTokenPair(&session.User, session)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate tokens"})
+		problem.Write(c, http.StatusInternalServerError, "Failed to generate tokens")
 		return
 	}
 
-	// Revoke old session
-	h.userRepo.RevokeSession(session.ID)
-
-	// Create new session
-	newSession := &models.UserSession{
-		UserID:       session.UserID,
-		RefreshToken: tokenPair.RefreshToken,
-		ExpiresAt:    h.jwtService.RefreshTokenExpiration(),
-	}
-
-	if err := h.userRepo.CreateSession(newSession); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+	if err := h.userRepo.RotateSession(c.Request.Context(), session); err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to create session")
 		return
 	}
 
-	response := &AuthResponse{
-		User:         h.userToResponse(&session.User),
-		AccessToken:  tokenPair.AccessToken,
-		RefreshToken: tokenPair.RefreshToken,
-		ExpiresIn:    tokenPair.ExpiresIn,
-	}
+	response := h.tokenResponse(c, &session.User, tokenPair)
 
 	c.JSON(http.StatusOK, response)
 }
 
 // Logout revokes the current session
 func (h *AuthHandler) Logout(c *gin.Context) {
-	var req RefreshRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+	refreshToken, ok := refreshTokenFromRequest(c)
+	if !ok {
+		problem.Write(c, http.StatusBadRequest, "Invalid request format")
 		return
 	}
 
-	// Get session and revoke it
-	session, err := h.userRepo.GetSessionByRefreshToken(req.RefreshToken)
+	// The access token stays valid until it expires unless it is revoked
+	// as well
+	if token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok && !auth.IsAPIKey(token) {
+		h.jwtService.RevokeToken(token)
+	}
+
+	// Get session and revoke it, along with the access tokens issued for it
+	session, err := h.userRepo.GetSessionByRefreshToken(c.Request.Context(), refreshToken)
 	if err == nil {
-		h.userRepo.RevokeSession(session.ID)
+		h.userRepo.RevokeSession(c.Request.Context(), session.ID)
+		h.jwtService.RevokeSession(session.ID)
+		audit.RecordUser(c, audit.ActionLogout, session.UserID, session.User.Email, session.User.Email, nil)
 	}
+	auth.ClearAuthCookies(c)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
 }
@@ -341,10 +354,10 @@ func (h *AuthHandler) GetProfile(c *gin.Context) {
 	log.Printf("[DEBUG] GetProfile called - UserID: %d", userID)
 
 	// Always fetch fresh user data from database to ensure we have the latest state
-	user, err := h.userRepo.GetUserByID(userID)
+	user, err := h.userRepo.GetUserByID(c.Request.Context(), userID)
 	if err != nil {
 		log.Printf("[ERROR] GetProfile - Failed to get user %d: %v", userID, err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "User not found"})
+		problem.Write(c, http.StatusInternalServerError, "User not found")
 		return
 	}
 	log.Printf("[DEBUG] GetProfile - Returning user profile - UserID: %d, Is2FAEnabled: %t",
@@ -363,18 +376,13 @@ func (h *AuthHandler) GetProfile(c *gin.Context) {
 func (h *AuthHandler) ChangePassword(c *gin.Context) {
 	var req ChangePasswordRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
-		return
-	}
-
-	if err := h.validator.Struct(req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "details": err.Error()})
+		problem.Invalid(c, err)
 		return
 	}
 
 	user, exists := c.Get("user")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found in context"})
+		problem.Write(c, http.StatusUnauthorized, "User not found in context")
 		return
 	}
 
@@ -382,24 +390,26 @@ func (h *AuthHandler) ChangePassword(c *gin.Context) {
 
 	// Verify current password
 	if !userModel.CheckPassword(req.CurrentPassword) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Current password is incorrect"})
+		problem.Write(c, http.StatusBadRequest, "Current password is incorrect")
 		return
 	}
 
 	// Hash new password
 	if err := userModel.HashPassword(req.NewPassword); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process new password"})
+		problem.Write(c, http.StatusInternalServerError, "Failed to process new password")
 		return
 	}
 
 	// Update user
-	if err := h.userRepo.UpdateUser(userModel); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
+	if err := h.userRepo.UpdateUser(c.Request.Context(), userModel); err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to update password")
 		return
 	}
 
 	// Revoke all sessions to force re-login
-	h.userRepo.RevokeAllUserSessions(userModel.ID)
+	h.userRepo.RevokeAllUserSessions(c.Request.Context(), userModel.ID)
+
+	audit.Record(c, audit.ActionPasswordChanged, userModel.Email, nil)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Password changed successfully"})
 }
@@ -408,18 +418,15 @@ func (h *AuthHandler) ChangePassword(c *gin.Context) {
 func (h *AuthHandler) ChangeEmail(c *gin.Context) {
 	var req ChangeEmailRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
-		return
-	}
-	if err := h.validator.Struct(req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "details": err.Error()})
+		problem.Invalid(c, err)
 		return
 	}
 	userID := c.GetUint("user_id")
-	if err := h.userRepo.UpdateUserEmail(userID, req.NewEmail); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update email"})
+	if err := h.userRepo.UpdateUserEmail(c.Request.Context(), userID, req.NewEmail); err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to update email")
 		return
 	}
+	audit.Record(c, audit.ActionEmailChanged, req.NewEmail, gin.H{"previous_email": c.GetString("user_email")})
 	c.JSON(http.StatusOK, gin.H{"message": "Email updated successfully"})
 }
 
@@ -428,10 +435,10 @@ func (h *AuthHandler) Setup2FA(c *gin.Context) {
 	userID := c.GetUint("user_id")
 	log.Printf("[DEBUG] Setup2FA called - UserID: %d", userID)
 
-	user, err := h.userRepo.GetUserByID(userID)
+	user, err := h.userRepo.GetUserByID(c.Request.Context(), userID)
 	if err != nil {
 		log.Printf("[ERROR] Setup2FA - User not found: %d, error: %v", userID, err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "User not found"})
+		problem.Write(c, http.StatusInternalServerError, "User not found")
 		return
 	}
 	log.Printf("[DEBUG] Setup2FA - Current user state - UserID: %d, Is2FAEnabled: %t, HasSecret: %t",
@@ -452,7 +459,7 @@ func (h *AuthHandler) Setup2FA(c *gin.Context) {
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		log.Printf("[ERROR] Setup2FA - Invalid request format: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		problem.Invalid(c, err)
 		return
 	}
 
@@ -464,15 +471,15 @@ func (h *AuthHandler) Setup2FA(c *gin.Context) {
 		secret, otpauthURL, err := auth.GenerateTOTPSecret(user.Email)
 		if err != nil {
 			log.Printf("[ERROR] Setup2FA - Failed to generate secret: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+			problem.Write(c, http.StatusInternalServerError, "Failed to generate secret")
 			return
 		}
 		log.Printf("[DEBUG] Setup2FA - Generated secret for user: %d", userID)
 
 		// Save secret to user (but not enabled yet)
-		if err := h.userRepo.Set2FA(userID, secret, false); err != nil {
+		if err := h.userRepo.Set2FA(c.Request.Context(), userID, secret, false); err != nil {
 			log.Printf("[ERROR] Setup2FA - Failed to save secret: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save secret"})
+			problem.Write(c, http.StatusInternalServerError, "Failed to save secret")
 			return
 		}
 		log.Printf("[DEBUG] Setup2FA - Secret saved for user: %d", userID)
@@ -488,14 +495,14 @@ func (h *AuthHandler) Setup2FA(c *gin.Context) {
 		is2FAEnabled := user.Is2FAEnabled != nil && *user.Is2FAEnabled
 		if !is2FAEnabled {
 			log.Printf("[DEBUG] Setup2FA - 2FA not enabled for user: %d", userID)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "2FA is not enabled"})
+			problem.Write(c, http.StatusBadRequest, "2FA is not enabled")
 			return
 		}
 
 		// Require 2FA token to disable
 		if req.Token == "" {
 			log.Printf("[DEBUG] Setup2FA - No token provided for disabling 2FA for user: %d", userID)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "2FA token required to disable 2FA"})
+			problem.Write(c, http.StatusBadRequest, "2FA token required to disable 2FA")
 			return
 		}
 
@@ -508,20 +515,25 @@ func (h *AuthHandler) Setup2FA(c *gin.Context) {
 		}
 		if !auth.ValidateTOTP(twoFASecret, req.Token) {
 			log.Printf("[DEBUG] Setup2FA - Invalid token provided for disabling 2FA for user: %d", userID)
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid 2FA code"})
+			problem.Write(c, http.StatusUnauthorized, "Invalid 2FA code")
 			return
 		}
 
 		log.Printf("[DEBUG] Setup2FA - Token validated, proceeding to disable 2FA for user: %d", userID)
 
 		// Disable 2FA
-		if err := h.userRepo.Set2FA(userID, "", false); err != nil {
+		if err := h.userRepo.Set2FA(c.Request.Context(), userID, "", false); err != nil {
 			log.Printf("[ERROR] Setup2FA - Failed to disable 2FA: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable 2FA"})
+			problem.Write(c, http.StatusInternalServerError, "Failed to disable 2FA")
 			return
 		}
 
+		if err := h.userRepo.ReplaceBackupCodes(c.Request.Context(), userID, nil); err != nil {
+			log.Printf("[ERROR] Setup2FA - Failed to remove backup codes: %v", err)
+		}
+
 		log.Printf("[DEBUG] Setup2FA - 2FA successfully disabled for user: %d", userID)
+		audit.Record(c, audit.Action2FADisabled, user.Email, nil)
 		c.JSON(http.StatusOK, gin.H{"message": "2FA disabled"})
 		return
 	}
@@ -532,10 +544,10 @@ func (h *AuthHandler) Verify2FA(c *gin.Context) {
 	userID := c.GetUint("user_id")
 	log.Printf("[DEBUG] Verify2FA called - UserID: %d", userID)
 
-	user, err := h.userRepo.GetUserByID(userID)
+	user, err := h.userRepo.GetUserByID(c.Request.Context(), userID)
 	if err != nil {
 		log.Printf("[ERROR] Verify2FA - User not found: %d, error: %v", userID, err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "User not found"})
+		problem.Write(c, http.StatusInternalServerError, "User not found")
 		return
 	}
 	log.Printf("[DEBUG] Verify2FA - Current user state - UserID: %d, Is2FAEnabled: %t, HasSecret: %t",
@@ -555,7 +567,7 @@ func (h *AuthHandler) Verify2FA(c *gin.Context) {
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		log.Printf("[ERROR] Verify2FA - Invalid request format: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		problem.Invalid(c, err)
 		return
 	}
 
@@ -563,28 +575,188 @@ func (h *AuthHandler) Verify2FA(c *gin.Context) {
 
 	if user.TwoFASecret == nil || *user.TwoFASecret == "" {
 		log.Printf("[DEBUG] Verify2FA - No 2FA secret found for user: %d", userID)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "2FA not initialized"})
+		problem.Write(c, http.StatusBadRequest, "2FA not initialized")
 		return
 	}
 
 	log.Printf("[DEBUG] Verify2FA - Validating TOTP token for user: %d", userID)
 	if !auth.ValidateTOTP(*user.TwoFASecret, req.Token) {
 		log.Printf("[DEBUG] Verify2FA - Invalid 2FA token for user: %d", userID)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid 2FA code"})
+		problem.Write(c, http.StatusUnauthorized, "Invalid 2FA code")
 		return
 	}
 
 	log.Printf("[DEBUG] Verify2FA - Token validated, enabling 2FA for user: %d", userID)
 
 	// Enable 2FA
-	if err := h.userRepo.Set2FA(userID, *user.TwoFASecret, true); err != nil {
+	if err := h.userRepo.Set2FA(c.Request.Context(), userID, *user.TwoFASecret, true); err != nil {
 		log.Printf("[ERROR] Verify2FA - Failed to enable 2FA: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable 2FA"})
+		problem.Write(c, http.StatusInternalServerError, "Failed to enable 2FA")
+		return
+	}
+
+	codes, hashes, err := auth.GenerateBackupCodes(auth.BackupCodeCount)
+	if err == nil {
+		err = h.userRepo.ReplaceBackupCodes(c.Request.Context(), userID, hashes)
+	}
+	if err != nil {
+		log.Printf("[ERROR] Verify2FA - Failed to create backup codes: %v", err)
+		problem.Write(c, http.StatusInternalServerError, "Failed to create backup codes")
 		return
 	}
 
 	log.Printf("[DEBUG] Verify2FA - 2FA successfully enabled for user: %d", userID)
-	c.JSON(http.StatusOK, gin.H{"message": "2FA enabled"})
+	audit.Record(c, audit.Action2FAEnabled, user.Email, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "2FA enabled", "backup_codes": codes})
+}
+
+// GetBackupCodes returns how many unused backup codes the user has left
+func (h *AuthHandler) GetBackupCodes(c *gin.Context) {
+	remaining, err := h.userRepo.CountBackupCodes(c.Request.Context(), c.GetUint("user_id"))
+	if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to count backup codes")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"remaining": remaining})
+}
+
+// RegenerateBackupCodes replaces the user's backup codes after checking a
+// current TOTP code
+func (h *AuthHandler) RegenerateBackupCodes(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	user, err := h.userRepo.GetUserByID(c.Request.Context(), userID)
+	if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "User not found")
+		return
+	}
+
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Invalid(c, err)
+		return
+	}
+
+	if user.Is2FAEnabled == nil || !*user.Is2FAEnabled || user.TwoFASecret == nil {
+		problem.Write(c, http.StatusBadRequest, "2FA is not enabled")
+		return
+	}
+	if !auth.ValidateTOTP(*user.TwoFASecret, req.Token) {
+		problem.Write(c, http.StatusUnauthorized, "Invalid 2FA code")
+		return
+	}
+
+	codes, hashes, err := auth.GenerateBackupCodes(auth.BackupCodeCount)
+	if err == nil {
+		err = h.userRepo.ReplaceBackupCodes(c.Request.Context(), userID, hashes)
+	}
+	if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to create backup codes")
+		return
+	}
+
+	audit.Record(c, audit.ActionBackupCodesRegenerated, user.Email, nil)
+	c.JSON(http.StatusOK, gin.H{"backup_codes": codes})
+}
+
+// ListSessions returns the current user's active sessions
+func (h *AuthHandler) ListSessions(c *gin.Context) {
+	sessions, err := h.userRepo.GetActiveSessions(c.Request.Context(), c.GetUint("user_id"))
+	if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to fetch sessions")
+		return
+	}
+
+	response := make([]SessionResponse, len(sessions))
+	for i, session := range sessions {
+		response[i] = SessionResponse{
+			ID:         session.ID,
+			UserAgent:  session.UserAgent,
+			IP:         session.IP,
+			CreatedAt:  session.CreatedAt,
+			LastUsedAt: session.LastUsedAt,
+			ExpiresAt:  session.ExpiresAt,
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// RevokeSession revokes one of the current user's sessions, rejecting the
+// access tokens already issued for it too.
+func (h *AuthHandler) RevokeSession(c *gin.Context) {
+	sessionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		problem.Write(c, http.StatusBadRequest, "Invalid session ID")
+		return
+	}
+
+	err = h.userRepo.RevokeUserSession(c.Request.Context(), c.GetUint("user_id"), uint(sessionID))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		problem.NotFound(c, "Session not found")
+		return
+	} else if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to revoke session")
+		return
+	}
+	h.jwtService.RevokeSession(uint(sessionID))
+
+	audit.Record(c, audit.ActionSessionRevoked, c.GetString("user_email"), gin.H{"session_id": sessionID})
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked successfully"})
+}
+
+// createSession creates a session with a new refresh token, recording the
+// client's device details. Access tokens are issued for it afterwards, so
+// they carry its ID.
+func (h *AuthHandler) createSession(c *gin.Context, userID uint) (*models.UserSession, error) {
+	refreshToken, err := h.jwtService.GenerateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	session := &models.UserSession{
+		UserID:       userID,
+		RefreshToken: refreshToken,
+		ExpiresAt:    h.jwtService.RefreshTokenExpiration(),
+		UserAgent:    c.Request.UserAgent(),
+		IP:           c.ClientIP(),
+		LastUsedAt:   &now,
+	}
+	if err := h.userRepo.CreateSession(c.Request.Context(), session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// tokenResponse builds the response for a newly issued token pair. In cookie
+// mode the refresh token is set as an httpOnly cookie and replaced in the body
+// by the CSRF token bound to it.
+func (h *AuthHandler) tokenResponse(c *gin.Context, user *models.User, tokenPair *auth.TokenPair) *AuthResponse {
+	response := &AuthResponse{
+		User:         h.userToResponse(user),
+		AccessToken:  tokenPair.AccessToken,
+		RefreshToken: tokenPair.RefreshToken,
+		ExpiresIn:    tokenPair.ExpiresIn,
+	}
+	if auth.CookieModeEnabled() {
+		response.CSRFToken = h.jwtService.CSRFToken(tokenPair.RefreshToken)
+		response.RefreshToken = ""
+		auth.SetAuthCookies(c, tokenPair.RefreshToken, response.CSRFToken, h.jwtService.RefreshTokenExpiration())
+	}
+	return response
+}
+
+// refreshTokenFromRequest reads the refresh token from the JSON body, falling
+// back to the refresh cookie
+func refreshTokenFromRequest(c *gin.Context) (string, bool) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		return "", false
+	}
+	if req.RefreshToken == "" {
+		req.RefreshToken, _ = c.Cookie(auth.RefreshCookieName)
+	}
+	return req.RefreshToken, req.RefreshToken != ""
 }
 
 // Helper function to convert user model to response
@@ -0,0 +1,260 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/auth"
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/state"
+	testutils "github.com/kevinanielsen/go-fast-cdn/src/testUtils"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogin_BackupCode(t *testing.T) {
+	// Arrange
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	database.Migrate()
+	userRepo := database.NewUserRepo(database.DB)
+	h := NewAuthHandler(userRepo)
+
+	user := &models.User{Email: "alice@example.com", Role: "user"}
+	require.NoError(t, user.HashPassword("correct horse"))
+	require.NoError(t, userRepo.CreateUser(context.Background(), user))
+	secret, _, err := auth.GenerateTOTPSecret(user.Email)
+	require.NoError(t, err)
+	require.NoError(t, userRepo.Set2FA(context.Background(), user.ID, secret, true))
+	codes, hashes, err := auth.GenerateBackupCodes(auth.BackupCodeCount)
+	require.NoError(t, err)
+	require.NoError(t, userRepo.ReplaceBackupCodes(context.Background(), user.ID, hashes))
+
+	login := func(backupCode string) int {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/test", nil)
+		testutils.MockJsonPost(c, LoginRequest{Email: user.Email, Password: "correct horse", BackupCode: backupCode})
+		h.Login(c)
+		return w.Code
+	}
+
+	// Act & Assert
+	require.Len(t, codes, auth.BackupCodeCount)
+	require.Equal(t, http.StatusUnauthorized, login(""))
+	require.Equal(t, http.StatusOK, login(codes[0]))
+	require.Equal(t, http.StatusUnauthorized, login(codes[0]), "backup codes are single-use")
+	require.Equal(t, http.StatusUnauthorized, login("aaaaa-aaaaa"))
+
+	remaining, err := userRepo.CountBackupCodes(context.Background(), user.ID)
+	require.NoError(t, err)
+	require.EqualValues(t, auth.BackupCodeCount-1, remaining)
+}
+
+func TestSessions_ListAndRevoke(t *testing.T) {
+	// Arrange
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	database.Migrate()
+	userRepo := database.NewUserRepo(database.DB)
+	h := NewAuthHandler(userRepo)
+
+	user := &models.User{Email: "bob@example.com", Role: "user"}
+	require.NoError(t, user.HashPassword("correct horse"))
+	require.NoError(t, userRepo.CreateUser(context.Background(), user))
+
+	state.Denied = state.NewMemoryDenylist()
+	t.Cleanup(func() { state.Denied = state.NewMemoryDenylist() })
+
+	accessTokens := map[string]string{}
+	for _, agent := range []string{"laptop", "phone"} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/test", nil)
+		c.Request.Header.Set("User-Agent", agent)
+		testutils.MockJsonPost(c, LoginRequest{Email: user.Email, Password: "correct horse"})
+		h.Login(c)
+		require.Equal(t, http.StatusOK, w.Code)
+		var res AuthResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&res))
+		accessTokens[agent] = res.AccessToken
+	}
+
+	list := func() []SessionResponse {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/test", nil)
+		c.Set("user_id", user.ID)
+		h.ListSessions(c)
+		require.Equal(t, http.StatusOK, w.Code)
+		var sessions []SessionResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&sessions))
+		return sessions
+	}
+
+	// Act
+	sessions := list()
+	require.Len(t, sessions, 2)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodDelete, "/test", nil)
+	c.Set("user_id", user.ID)
+	c.Params = []gin.Param{{Key: "id", Value: strconv.Itoa(int(sessions[0].ID))}}
+	h.RevokeSession(c)
+
+	// Assert
+	require.Equal(t, http.StatusOK, w.Code)
+	remaining := list()
+	require.Len(t, remaining, 1)
+	require.NotEqual(t, sessions[0].ID, remaining[0].ID)
+	require.Contains(t, []string{"laptop", "phone"}, remaining[0].UserAgent)
+
+	// The access tokens of the revoked session are rejected right away
+	jwtService := auth.NewJWTService()
+	_, err := jwtService.ValidateToken(accessTokens[sessions[0].UserAgent])
+	require.Error(t, err)
+	_, err = jwtService.ValidateToken(accessTokens[remaining[0].UserAgent])
+	require.NoError(t, err)
+
+	// A user cannot revoke someone else's session
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodDelete, "/test", nil)
+	c.Set("user_id", user.ID+1)
+	c.Params = []gin.Param{{Key: "id", Value: strconv.Itoa(int(remaining[0].ID))}}
+	h.RevokeSession(c)
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestLogin_CookieMode(t *testing.T) {
+	// Arrange
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	database.Migrate()
+	t.Setenv("AUTH_COOKIE_MODE", "true")
+	userRepo := database.NewUserRepo(database.DB)
+	h := NewAuthHandler(userRepo)
+
+	user := &models.User{Email: "carol@example.com", Role: "user"}
+	require.NoError(t, user.HashPassword("correct horse"))
+	require.NoError(t, userRepo.CreateUser(context.Background(), user))
+
+	// Act
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/test", nil)
+	testutils.MockJsonPost(c, LoginRequest{Email: user.Email, Password: "correct horse"})
+	h.Login(c)
+
+	// Assert
+	require.Equal(t, http.StatusOK, w.Code)
+	var response AuthResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Empty(t, response.RefreshToken, "the refresh token must not be readable by scripts")
+	require.NotEmpty(t, response.CSRFToken)
+
+	cookies := map[string]*http.Cookie{}
+	for _, cookie := range w.Result().Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+	require.Contains(t, cookies, auth.RefreshCookieName)
+	require.True(t, cookies[auth.RefreshCookieName].HttpOnly)
+	require.Equal(t, response.CSRFToken, cookies[auth.CSRFCookieName].Value)
+
+	// Refreshing with only the cookie rotates both cookies
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/test", nil)
+	c.Request.AddCookie(cookies[auth.RefreshCookieName])
+	h.RefreshToken(c)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var refreshed AuthResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &refreshed))
+	require.NotEmpty(t, refreshed.CSRFToken)
+	require.NotEqual(t, response.CSRFToken, refreshed.CSRFToken)
+}
+
+func TestLogout_RevokesAccessToken(t *testing.T) {
+	// Arrange
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	database.Migrate()
+	userRepo := database.NewUserRepo(database.DB)
+	h := NewAuthHandler(userRepo)
+
+	user := &models.User{Email: "carol@example.com", Role: "user"}
+	require.NoError(t, user.HashPassword("correct horse"))
+	require.NoError(t, userRepo.CreateUser(context.Background(), user))
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/test", nil)
+	testutils.MockJsonPost(c, LoginRequest{Email: user.Email, Password: "correct horse"})
+	h.Login(c)
+	require.Equal(t, http.StatusOK, w.Code)
+	var res AuthResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&res))
+
+	jwtService := auth.NewJWTService()
+	_, err := jwtService.ValidateToken(res.AccessToken)
+	require.NoError(t, err)
+
+	// Act
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/test", nil)
+	testutils.MockJsonPost(c, RefreshRequest{RefreshToken: res.RefreshToken})
+	c.Request.Header.Set("Authorization", "Bearer "+res.AccessToken)
+	h.Logout(c)
+
+	// Assert
+	require.Equal(t, http.StatusOK, w.Code)
+	_, err = jwtService.ValidateToken(res.AccessToken)
+	require.Error(t, err)
+}
+
+func TestCreateSignedURL(t *testing.T) {
+	// Arrange
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	h := NewAuthHandler(database.NewUserRepo(database.DB))
+	user := &models.User{Email: "alice@example.com", Role: "user"}
+	require.NoError(t, database.DB.Create(user).Error)
+
+	sign := func(req SignedURLRequest) (int, map[string]any) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/test", nil)
+		auth.SetPrincipal(c, auth.UserPrincipal(auth.MethodJWT, user))
+		testutils.MockJsonPost(c, req)
+		h.CreateSignedURL(c)
+		var resp map[string]any
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return w.Code, resp
+	}
+
+	// Act & Assert
+	code, resp := sign(SignedURLRequest{Path: "/api/cdn/media/export?format=csv", ExpiresIn: 60})
+	require.Equal(t, http.StatusCreated, code)
+	signed, err := url.Parse("http://" + resp["url"].(string))
+	require.NoError(t, err)
+	principal, err := auth.NewJWTService().VerifySignedURL(signed, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, "user:"+strconv.FormatUint(uint64(user.ID), 10), principal)
+	require.Equal(t, "csv", signed.Query().Get("format"))
+
+	code, _ = sign(SignedURLRequest{Path: "https://example.com/api/cdn/size"})
+	require.Equal(t, http.StatusBadRequest, code)
+	code, _ = sign(SignedURLRequest{Path: "/api/cdn/size", ExpiresIn: 30 * 24 * 3600})
+	require.Equal(t, http.StatusBadRequest, code)
+}
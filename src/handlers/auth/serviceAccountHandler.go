@@ -0,0 +1,237 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/audit"
+	"github.com/kevinanielsen/go-fast-cdn/src/auth"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"gorm.io/gorm"
+)
+
+type ServiceAccountHandler struct {
+	serviceAccountRepo models.ServiceAccountRepository
+	orgRepo            models.OrganizationRepository
+}
+
+func NewServiceAccountHandler(serviceAccountRepo models.ServiceAccountRepository, orgRepo models.OrganizationRepository) *ServiceAccountHandler {
+	return &ServiceAccountHandler{
+		serviceAccountRepo: serviceAccountRepo,
+		orgRepo:            orgRepo,
+	}
+}
+
+type serviceAccountRequest struct {
+	Name           string   `json:"name" binding:"required"`
+	Description    string   `json:"description"`
+	OrganizationID *uint    `json:"organization_id"`
+	Permissions    []string `json:"permissions"`
+	Disabled       bool     `json:"disabled"`
+}
+
+type apiKeyRequest struct {
+	Name          string `json:"name"`
+	ExpiresInDays int    `json:"expires_in_days" binding:"min=0"`
+}
+
+// List all service accounts
+func (h *ServiceAccountHandler) ListServiceAccounts(c *gin.Context) {
+	accounts, err := h.serviceAccountRepo.GetAllServiceAccounts(c.Request.Context())
+	if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to fetch service accounts")
+		return
+	}
+	c.JSON(http.StatusOK, accounts)
+}
+
+// Create a new service account
+func (h *ServiceAccountHandler) CreateServiceAccount(c *gin.Context) {
+	var req serviceAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Invalid(c, err)
+		return
+	}
+	if msg := h.validate(c.Request.Context(), req); msg != "" {
+		problem.Write(c, http.StatusBadRequest, msg)
+		return
+	}
+
+	account := &models.ServiceAccount{
+		Name:           req.Name,
+		Description:    req.Description,
+		OrganizationID: req.OrganizationID,
+		Permissions:    strings.Join(req.Permissions, ","),
+		Disabled:       req.Disabled,
+		CreatedBy:      c.GetUint("user_id"),
+	}
+	if err := h.serviceAccountRepo.CreateServiceAccount(c.Request.Context(), account); err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to create service account")
+		return
+	}
+
+	audit.Record(c, audit.ActionServiceAccountCreated, account.Name, gin.H{"permissions": req.Permissions})
+	c.JSON(http.StatusCreated, account)
+}
+
+// Update a service account
+func (h *ServiceAccountHandler) UpdateServiceAccount(c *gin.Context) {
+	account, ok := h.serviceAccount(c)
+	if !ok {
+		return
+	}
+
+	var req serviceAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Invalid(c, err)
+		return
+	}
+	if msg := h.validate(c.Request.Context(), req); msg != "" {
+		problem.Write(c, http.StatusBadRequest, msg)
+		return
+	}
+
+	account.Name = req.Name
+	account.Description = req.Description
+	account.OrganizationID = req.OrganizationID
+	account.Permissions = strings.Join(req.Permissions, ",")
+	account.Disabled = req.Disabled
+	if err := h.serviceAccountRepo.UpdateServiceAccount(c.Request.Context(), account); err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to update service account")
+		return
+	}
+
+	audit.Record(c, audit.ActionServiceAccountUpdated, account.Name, gin.H{"permissions": req.Permissions, "disabled": req.Disabled})
+	c.JSON(http.StatusOK, account)
+}
+
+// Delete a service account and revoke its API keys
+func (h *ServiceAccountHandler) DeleteServiceAccount(c *gin.Context) {
+	account, ok := h.serviceAccount(c)
+	if !ok {
+		return
+	}
+	if err := h.serviceAccountRepo.DeleteServiceAccount(c.Request.Context(), account.ID); err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to delete service account")
+		return
+	}
+
+	audit.Record(c, audit.ActionServiceAccountDeleted, account.Name, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Service account deleted successfully"})
+}
+
+// List the API keys of a service account
+func (h *ServiceAccountHandler) ListAPIKeys(c *gin.Context) {
+	account, ok := h.serviceAccount(c)
+	if !ok {
+		return
+	}
+	keys, err := h.serviceAccountRepo.GetAPIKeys(c.Request.Context(), account.ID)
+	if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to fetch API keys")
+		return
+	}
+	c.JSON(http.StatusOK, keys)
+}
+
+// Create an API key for a service account. The key is only returned once.
+func (h *ServiceAccountHandler) CreateAPIKey(c *gin.Context) {
+	account, ok := h.serviceAccount(c)
+	if !ok {
+		return
+	}
+
+	var req apiKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Invalid(c, err)
+		return
+	}
+
+	secret, prefix, hash, err := auth.GenerateAPIKey()
+	if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to generate API key")
+		return
+	}
+
+	key := &models.APIKey{
+		ServiceAccountID: account.ID,
+		Name:             req.Name,
+		Prefix:           prefix,
+		KeyHash:          hash,
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		key.ExpiresAt = &expiresAt
+	}
+	if err := h.serviceAccountRepo.CreateAPIKey(c.Request.Context(), key); err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to create API key")
+		return
+	}
+
+	audit.Record(c, audit.ActionAPIKeyCreated, account.Name, gin.H{"key_id": key.ID, "prefix": key.Prefix})
+	c.JSON(http.StatusCreated, gin.H{"api_key": key, "key": secret})
+}
+
+// Revoke an API key
+func (h *ServiceAccountHandler) DeleteAPIKey(c *gin.Context) {
+	account, ok := h.serviceAccount(c)
+	if !ok {
+		return
+	}
+	keyID, err := strconv.Atoi(c.Param("keyId"))
+	if err != nil {
+		problem.Write(c, http.StatusBadRequest, "Invalid API key ID")
+		return
+	}
+
+	err = h.serviceAccountRepo.DeleteAPIKey(c.Request.Context(), account.ID, uint(keyID))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		problem.NotFound(c, "API key not found")
+		return
+	} else if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to revoke API key")
+		return
+	}
+
+	audit.Record(c, audit.ActionAPIKeyRevoked, account.Name, gin.H{"key_id": keyID})
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked successfully"})
+}
+
+// serviceAccount loads the account named by the :id parameter, writing an
+// error response if it cannot.
+func (h *ServiceAccountHandler) serviceAccount(c *gin.Context) (*models.ServiceAccount, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		problem.Write(c, http.StatusBadRequest, "Invalid service account ID")
+		return nil, false
+	}
+	account, err := h.serviceAccountRepo.GetServiceAccountByID(c.Request.Context(), uint(id))
+	if err != nil {
+		problem.NotFound(c, "Service account not found")
+		return nil, false
+	}
+	return account, true
+}
+
+// validate checks the permissions and organization of a request and returns
+// an error message if they are invalid.
+func (h *ServiceAccountHandler) validate(ctx context.Context, req serviceAccountRequest) string {
+	for _, permission := range req.Permissions {
+		if !slices.Contains(models.Permissions, permission) {
+			return "Unknown permission: " + permission
+		}
+	}
+	if req.OrganizationID != nil {
+		if _, err := h.orgRepo.GetOrganizationByID(ctx, *req.OrganizationID); err != nil {
+			return "Organization not found"
+		}
+	}
+	return ""
+}
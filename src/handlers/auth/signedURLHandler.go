@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/auth"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+)
+
+const (
+	defaultSignedURLTTL = time.Hour
+	maxSignedURLTTL     = 7 * 24 * time.Hour
+)
+
+type SignedURLRequest struct {
+	// Path is the API path to sign, with its query, e.g.
+	// /api/cdn/media/export?format=csv.
+	Path string `json:"path" binding:"required"`
+	// ExpiresIn is the lifetime of the URL in seconds, an hour by default.
+	ExpiresIn int64 `json:"expires_in" binding:"omitempty,min=1"`
+}
+
+// CreateSignedURL signs a GET request to an API path as the principal
+// making the request, e.g. to hand an export to a tool that cannot send
+// credentials. The URL grants what the principal may do while it exists.
+func (h *AuthHandler) CreateSignedURL(c *gin.Context) {
+	var req SignedURLRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Invalid(c, err)
+		return
+	}
+	target, err := url.Parse(req.Path)
+	if err != nil || target.IsAbs() || target.Host != "" || !strings.HasPrefix(target.Path, "/api/") {
+		problem.InvalidFields(c, problem.FieldError{Field: "path", Rule: "path", Message: "must be an API path starting with /api/"})
+		return
+	}
+	ttl := defaultSignedURLTTL
+	if req.ExpiresIn > 0 {
+		ttl = time.Duration(req.ExpiresIn) * time.Second
+	}
+	if ttl > maxSignedURLTTL {
+		problem.InvalidFields(c, problem.FieldError{Field: "expires_in", Rule: "max", Message: "must be at most a week"})
+		return
+	}
+
+	principal, ok := auth.PrincipalFrom(c)
+	if !ok {
+		problem.Write(c, http.StatusUnauthorized, "Authorization header required")
+		return
+	}
+	expiresAt := time.Now().Add(ttl)
+	signed := h.jwtService.SignURL(target, principal.ID(), expiresAt)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"url":        c.Request.Host + signed.String(),
+		"expires_at": expiresAt.UTC().Truncate(time.Second),
+	})
+}
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/audit"
+	"github.com/kevinanielsen/go-fast-cdn/src/backup"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+)
+
+type BackupHandler struct {
+	manager   *backup.Manager
+	scheduler *backup.Scheduler
+	targets   []backup.Target
+}
+
+// NewBackupHandler returns a handler for manager. Manual backups are copied
+// to the targets in BACKUP_TARGETS, like scheduled ones.
+func NewBackupHandler(manager *backup.Manager, scheduler *backup.Scheduler) *BackupHandler {
+	targets, err := backup.TargetsFromEnv()
+	if err != nil {
+		log.Printf("[ERROR] Ignoring backup targets: %v", err)
+	}
+	return &BackupHandler{manager: manager, scheduler: scheduler, targets: targets}
+}
+
+// GetBackupStatus returns the state of the backup scheduler
+func (h *BackupHandler) GetBackupStatus(c *gin.Context) {
+	if h.scheduler == nil {
+		c.JSON(http.StatusOK, backup.Status{Enabled: false, Pruned: []string{}, Targets: []string{}})
+		return
+	}
+	c.JSON(http.StatusOK, h.scheduler.Status())
+}
+
+// ListBackups returns the local backups, newest first. With ?remote=true the
+// backups stored at the remote targets are included.
+func (h *BackupHandler) ListBackups(c *gin.Context) {
+	var backups []backup.Backup
+	var err error
+	if c.Query("remote") == "true" {
+		backups, err = h.manager.ListAll(c.Request.Context(), h.targets)
+	} else {
+		backups, err = h.manager.List()
+	}
+	if err != nil {
+		problem.WriteDetails(c, http.StatusInternalServerError, "Failed to list backups", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, backups)
+}
+
+// CreateBackup takes a manual backup, verifies it and copies it to the
+// remote targets
+func (h *BackupHandler) CreateBackup(c *gin.Context) {
+	var req struct {
+		IncludeFiles bool `json:"include_files"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			problem.Invalid(c, err)
+			return
+		}
+	}
+
+	b, err := h.manager.Create(backup.OriginManual, req.IncludeFiles)
+	if err != nil {
+		problem.WriteDetails(c, http.StatusInternalServerError, "Failed to create backup", err.Error())
+		return
+	}
+	audit.Record(c, audit.ActionBackupCreated, b.Name, gin.H{"include_files": req.IncludeFiles})
+
+	if err := h.manager.Push(c.Request.Context(), b, h.targets); err != nil {
+		problem.Abort(c, problem.New(http.StatusBadGateway, "", "Backup created but upload failed").WithDetails(err.Error()).With("backup", b))
+		return
+	}
+	for _, target := range h.targets {
+		b.Locations = append(b.Locations, target.String())
+	}
+
+	c.JSON(http.StatusCreated, b)
+}
+
+// VerifyBackup re-runs the integrity check of a backup
+func (h *BackupHandler) VerifyBackup(c *gin.Context) {
+	b, err := h.manager.Verify(c.Param("name"))
+	if errors.Is(err, os.ErrNotExist) {
+		problem.NotFound(c, "Backup not found")
+		return
+	} else if err != nil {
+		problem.WriteDetails(c, http.StatusBadRequest, "Failed to verify backup", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, b)
+}
+
+// RestoreMedia restores a single image or document, selected by file name or
+// hex-encoded checksum, from a backup without rolling back the database
+func (h *BackupHandler) RestoreMedia(c *gin.Context) {
+	var req struct {
+		Type     string `json:"type" binding:"omitempty,oneof=image doc"`
+		FileName string `json:"filename"`
+		Checksum string `json:"checksum" binding:"required_without=FileName"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Invalid(c, err)
+		return
+	}
+
+	query := backup.MediaQuery{Type: req.Type, FileName: req.FileName}
+	if req.FileName == "" {
+		checksum, err := hex.DecodeString(req.Checksum)
+		if err != nil {
+			problem.InvalidFields(c, problem.FieldError{Field: "checksum", Rule: "hexadecimal", Message: "must be hexadecimal"})
+			return
+		}
+		query.Checksum = checksum
+	}
+
+	restored, err := h.manager.RestoreMedia(c.Param("name"), query)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		problem.NotFound(c, "Backup not found")
+		return
+	case errors.Is(err, backup.ErrMediaNotInBackup), errors.Is(err, backup.ErrFileNotInBackup):
+		problem.NotFound(c, err.Error())
+		return
+	case errors.Is(err, backup.ErrMediaExists):
+		problem.Write(c, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		problem.WriteDetails(c, http.StatusBadRequest, "Failed to restore media", err.Error())
+		return
+	}
+
+	audit.Record(c, audit.ActionMediaRestored, restored.FileName, gin.H{"backup": c.Param("name"), "type": restored.Type})
+	c.JSON(http.StatusOK, restored)
+}
+
+// DeleteBackup removes a local backup. The backup name must be repeated in
+// ?confirm= to guard against accidental deletion.
+func (h *BackupHandler) DeleteBackup(c *gin.Context) {
+	name := c.Param("name")
+	if c.Query("confirm") != name {
+		problem.Write(c, http.StatusBadRequest, "Confirm the deletion by repeating the backup name in ?confirm=")
+		return
+	}
+
+	err := h.manager.Delete(name)
+	if errors.Is(err, os.ErrNotExist) {
+		problem.NotFound(c, "Backup not found")
+		return
+	} else if err != nil {
+		problem.WriteDetails(c, http.StatusBadRequest, "Failed to delete backup", err.Error())
+		return
+	}
+
+	audit.Record(c, audit.ActionBackupDeleted, name, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Backup deleted successfully"})
+}
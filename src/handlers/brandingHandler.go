@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/audit"
+	"github.com/kevinanielsen/go-fast-cdn/src/branding"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+)
+
+var previewTemplate = branding.NewTemplate(`{{define "content"}}<h1>{{.Data}}</h1><p>This is how shared links and other public pages look.</p><p><a class="button" href="#">Download</a></p>{{end}}`)
+
+type BrandingHandler struct {
+	store   *branding.Store
+	orgRepo models.OrganizationRepository
+}
+
+func NewBrandingHandler(store *branding.Store, orgRepo models.OrganizationRepository) *BrandingHandler {
+	return &BrandingHandler{store: store, orgRepo: orgRepo}
+}
+
+// GetEffectiveBranding returns the branding public pages of an organization
+// (?org=) or of the instance are rendered with
+func (h *BrandingHandler) GetEffectiveBranding(c *gin.Context) {
+	var orgID *uint
+	if org := c.Query("org"); org != "" {
+		id, err := strconv.ParseUint(org, 10, 64)
+		if err != nil {
+			problem.Write(c, http.StatusBadRequest, "Invalid organization ID")
+			return
+		}
+		value := uint(id)
+		orgID = &value
+	}
+	c.JSON(http.StatusOK, h.store.Effective(orgID))
+}
+
+// GetBranding returns the branding configured for an organization, or the
+// instance-wide branding on routes without :id
+func (h *BrandingHandler) GetBranding(c *gin.Context) {
+	orgID, ok := h.orgID(c)
+	if !ok {
+		return
+	}
+	b, err := h.store.Get(orgID)
+	if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to fetch branding")
+		return
+	}
+	c.JSON(http.StatusOK, b)
+}
+
+// UpdateBranding replaces the branding of an organization, or the
+// instance-wide branding on routes without :id
+func (h *BrandingHandler) UpdateBranding(c *gin.Context) {
+	orgID, ok := h.orgID(c)
+	if !ok {
+		return
+	}
+	var b branding.Branding
+	if err := c.ShouldBindJSON(&b); err != nil {
+		problem.Invalid(c, err)
+		return
+	}
+	if err := b.Validate(); err != nil {
+		problem.Write(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := h.store.Set(orgID, b); err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to update branding")
+		return
+	}
+	audit.Record(c, audit.ActionBrandingUpdated, brandingTarget(orgID), b)
+	c.JSON(http.StatusOK, b)
+}
+
+// DeleteBranding resets an organization to the instance-wide branding
+func (h *BrandingHandler) DeleteBranding(c *gin.Context) {
+	orgID, ok := h.orgID(c)
+	if !ok {
+		return
+	}
+	if err := h.store.Delete(*orgID); err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to delete branding")
+		return
+	}
+	audit.Record(c, audit.ActionBrandingUpdated, brandingTarget(orgID), nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Branding reset successfully"})
+}
+
+// PreviewBranding renders a sample public page with the effective branding
+// of an organization
+func (h *BrandingHandler) PreviewBranding(c *gin.Context) {
+	orgID, ok := h.orgID(c)
+	if !ok {
+		return
+	}
+	branding.Render(c, http.StatusOK, previewTemplate, branding.Page{
+		Title:    "Branding preview",
+		Branding: h.store.Effective(orgID),
+		Data:     "example.png",
+	})
+}
+
+// orgID parses the :id parameter and checks that the organization exists.
+// It returns nil for routes without :id, which manage the instance-wide
+// branding.
+func (h *BrandingHandler) orgID(c *gin.Context) (*uint, bool) {
+	if c.Param("id") == "" {
+		return nil, true
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		problem.Write(c, http.StatusBadRequest, "Invalid organization ID")
+		return nil, false
+	}
+	if _, err := h.orgRepo.GetOrganizationByID(c.Request.Context(), uint(id)); err != nil {
+		problem.NotFound(c, "Organization not found")
+		return nil, false
+	}
+	orgID := uint(id)
+	return &orgID, true
+}
+
+func brandingTarget(orgID *uint) string {
+	if orgID == nil {
+		return "instance"
+	}
+	return "org:" + strconv.FormatUint(uint64(*orgID), 10)
+}
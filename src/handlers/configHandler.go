@@ -1,28 +1,96 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
-	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/audit"
+	"github.com/kevinanielsen/go-fast-cdn/src/middleware"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"github.com/kevinanielsen/go-fast-cdn/src/settings"
 )
 
 type ConfigHandler struct {
-	configRepo *database.ConfigRepo
+	settings *settings.Store
 }
 
-func NewConfigHandler(configRepo *database.ConfigRepo) *ConfigHandler {
-	return &ConfigHandler{configRepo: configRepo}
+func NewConfigHandler(store *settings.Store) *ConfigHandler {
+	return &ConfigHandler{settings: store}
 }
 
-// GetRegistrationEnabled returns whether registration is enabled
-func (h *ConfigHandler) GetRegistrationEnabled(c *gin.Context) {
-	val, err := h.configRepo.Get("registration_enabled")
-	if err != nil || val == "" {
-		c.JSON(http.StatusOK, gin.H{"enabled": true}) // default: enabled
+// GetConfig returns every runtime setting with its value, where the value
+// comes from, its default and its environment variable
+func (h *ConfigHandler) GetConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, h.settings.List())
+}
+
+// UpdateConfig changes the settings in the body, e.g.
+// {"auth_rate_limit": 10, "registration_enabled": false}. A null value
+// resets a setting to its environment variable or default. The changes
+// apply without a restart, and none are applied if one is invalid.
+func (h *ConfigHandler) UpdateConfig(c *gin.Context) {
+	var body map[string]json.RawMessage
+	if err := c.ShouldBindJSON(&body); err != nil {
+		problem.Invalid(c, err)
+		return
+	}
+	if len(body) == 0 {
+		problem.Write(c, http.StatusBadRequest, "No settings to update")
+		return
+	}
+
+	changes := map[string]*string{}
+	for key, raw := range body {
+		value, err := settingValue(raw)
+		if err != nil {
+			problem.InvalidFields(c, problem.FieldError{Field: key, Rule: "type", Message: err.Error()})
+			return
+		}
+		changes[key] = value
+	}
+
+	var invalid *settings.InvalidError
+	if err := h.settings.Update(changes); errors.As(err, &invalid) {
+		problem.InvalidFields(c, problem.FieldError{Field: invalid.Key, Rule: "setting", Message: invalid.Err.Error()})
 		return
+	} else if err != nil {
+		problem.WriteDetails(c, http.StatusInternalServerError, "Failed to update config", err.Error())
+		return
+	}
+
+	audit.Record(c, audit.ActionConfigUpdated, "config", body)
+	c.JSON(http.StatusOK, h.settings.List())
+}
+
+// settingValue returns the string form of a JSON string, number or boolean,
+// or nil for null
+func settingValue(raw json.RawMessage) (*string, error) {
+	var value any
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return nil, err
+	}
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return &v, nil
+	case bool, float64:
+		s := string(raw)
+		return &s, nil
+	default:
+		return nil, errors.New("must be a string, number or boolean")
 	}
-	c.JSON(http.StatusOK, gin.H{"enabled": val == "true"})
+}
+
+// GetRegistrationEnabled returns whether registration is enabled
+func (h *ConfigHandler) GetRegistrationEnabled(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"enabled": h.settings.Bool(settings.RegistrationEnabled)})
 }
 
 // SetRegistrationEnabled sets registration enabled/disabled
@@ -32,16 +100,143 @@ func (h *ConfigHandler) SetRegistrationEnabled(c *gin.Context) {
 	}
 	var body req
 	if err := c.ShouldBindJSON(&body); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		problem.Invalid(c, err)
 		return
 	}
-	val := "false"
-	if body.Enabled {
-		val = "true"
-	}
-	if err := h.configRepo.Set("registration_enabled", val); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update config"})
+	val := strconv.FormatBool(body.Enabled)
+	if err := h.settings.Update(map[string]*string{settings.RegistrationEnabled: &val}); err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to update config")
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"enabled": body.Enabled})
 }
+
+type CORSHandler struct {
+	cors *middleware.CORS
+}
+
+func NewCORSHandler(cors *middleware.CORS) *CORSHandler {
+	return &CORSHandler{cors: cors}
+}
+
+// GetCORSPolicy returns the CORS policy in effect
+func (h *CORSHandler) GetCORSPolicy(c *gin.Context) {
+	c.JSON(http.StatusOK, h.cors.Policy())
+}
+
+// UpdateCORSPolicy replaces the CORS policy. It applies to the next request
+// without a restart.
+func (h *CORSHandler) UpdateCORSPolicy(c *gin.Context) {
+	var policy models.CORSPolicy
+	if err := c.ShouldBindJSON(&policy); err != nil {
+		problem.Invalid(c, err)
+		return
+	}
+
+	for i, method := range policy.AllowedMethods {
+		policy.AllowedMethods[i] = strings.ToUpper(strings.TrimSpace(method))
+	}
+	if policy.AllowedHeaders == nil {
+		policy.AllowedHeaders = []string{}
+	}
+	for i, header := range policy.AllowedHeaders {
+		policy.AllowedHeaders[i] = strings.TrimSpace(header)
+	}
+
+	if err := h.cors.Update(policy); err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to update config")
+		return
+	}
+
+	audit.Record(c, audit.ActionCORSUpdated, "cors", policy)
+	c.JSON(http.StatusOK, policy)
+}
+
+type HotlinkHandler struct {
+	hotlink *middleware.Hotlink
+}
+
+func NewHotlinkHandler(hotlink *middleware.Hotlink) *HotlinkHandler {
+	return &HotlinkHandler{hotlink: hotlink}
+}
+
+// GetHotlinkPolicy returns the hotlink policy in effect
+func (h *HotlinkHandler) GetHotlinkPolicy(c *gin.Context) {
+	c.JSON(http.StatusOK, h.hotlink.Policy())
+}
+
+// UpdateHotlinkPolicy replaces the hotlink policy. It applies to the next
+// download without a restart.
+func (h *HotlinkHandler) UpdateHotlinkPolicy(c *gin.Context) {
+	var policy models.HotlinkPolicy
+	if err := c.ShouldBindJSON(&policy); err != nil {
+		problem.Invalid(c, err)
+		return
+	}
+
+	if invalid := normalizeHotlinkRule(&policy.HotlinkRule, ""); invalid != nil {
+		problem.InvalidFields(c, *invalid)
+		return
+	}
+	if policy.Overrides == nil {
+		policy.Overrides = map[string]models.HotlinkRule{}
+	}
+	for mediaType, rule := range policy.Overrides {
+		prefix := "overrides[" + mediaType + "]."
+		if mediaType != models.MediaTypeImage && mediaType != models.MediaTypeDoc {
+			problem.InvalidFields(c, problem.FieldError{Field: prefix[:len(prefix)-1], Rule: "oneof", Message: "must be one of image, doc"})
+			return
+		}
+		if invalid := normalizeHotlinkRule(&rule, prefix); invalid != nil {
+			problem.InvalidFields(c, *invalid)
+			return
+		}
+		policy.Overrides[mediaType] = rule
+	}
+
+	if err := h.hotlink.Update(policy); err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to update config")
+		return
+	}
+
+	audit.Record(c, audit.ActionHotlinkUpdated, "hotlink", policy)
+	c.JSON(http.StatusOK, policy)
+}
+
+// normalizeHotlinkRule checks the action and hosts of rule and lower-cases
+// the hosts, returning the first invalid field, named after prefix. An empty
+// action forbids hotlinks.
+func normalizeHotlinkRule(rule *models.HotlinkRule, prefix string) *problem.FieldError {
+	switch rule.Action {
+	case "":
+		rule.Action = models.HotlinkActionForbid
+	case models.HotlinkActionForbid, models.HotlinkActionPlaceholder:
+	default:
+		return &problem.FieldError{Field: prefix + "action", Rule: "oneof", Message: "must be one of " + models.HotlinkActionForbid + ", " + models.HotlinkActionPlaceholder}
+	}
+	if rule.AllowedHosts == nil {
+		rule.AllowedHosts = []string{}
+	}
+	for i, host := range rule.AllowedHosts {
+		rule.AllowedHosts[i] = strings.ToLower(strings.TrimSpace(host))
+		if !validHostPattern(rule.AllowedHosts[i]) {
+			return &problem.FieldError{Field: fmt.Sprintf("%sallowed_hosts[%d]", prefix, i), Rule: "host", Message: "must be a host name, optionally prefixed with *."}
+		}
+	}
+	return nil
+}
+
+// validHostPattern reports whether pattern is a host name, optionally
+// prefixed with "*." to match its subdomains
+func validHostPattern(pattern string) bool {
+	host := strings.TrimPrefix(pattern, "*.")
+	if host == "" || strings.HasPrefix(host, ".") || strings.HasSuffix(host, ".") {
+		return false
+	}
+	for _, r := range host {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/settings"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigHandler_UpdateConfig(t *testing.T) {
+	// Arrange
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	store := settings.NewStore()
+	require.NoError(t, store.Load(database.NewConfigRepo(database.DB)))
+	h := NewConfigHandler(store)
+
+	r := gin.New()
+	r.GET("/config", h.GetConfig)
+	r.PATCH("/config", h.UpdateConfig)
+	patch := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPatch, "/config", strings.NewReader(body)))
+		return w
+	}
+
+	// Act & Assert
+	require.Equal(t, http.StatusBadRequest, patch(`{}`).Code)
+	require.Equal(t, http.StatusBadRequest, patch(`{"unknown": true}`).Code)
+	require.Equal(t, http.StatusBadRequest, patch(`{"auth_rate_limit": -1}`).Code)
+	require.Equal(t, http.StatusBadRequest, patch(`{"auth_rate_limit": [1]}`).Code)
+	require.Equal(t, http.StatusBadRequest, patch(`{"registration_enabled": "maybe"}`).Code)
+
+	w := patch(`{"auth_rate_limit": 3, "registration_enabled": false, "file_naming_strategy": "slug"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.Equal(t, 3, store.Int(settings.AuthRateLimit))
+	require.False(t, store.Bool(settings.RegistrationEnabled))
+	require.Equal(t, "slug", store.Get(settings.FileNamingStrategy))
+
+	require.Equal(t, http.StatusOK, patch(`{"auth_rate_limit": null}`).Code)
+	require.Equal(t, 20, store.Int(settings.AuthRateLimit))
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/config", nil))
+	var list []settings.Value
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	sources := map[string]string{}
+	for _, value := range list {
+		sources[value.Key] = value.Source
+	}
+	require.Equal(t, settings.SourceDefault, sources[settings.AuthRateLimit])
+	require.Equal(t, settings.SourceStored, sources[settings.RegistrationEnabled])
+}
@@ -2,14 +2,13 @@ package handlers
 
 import (
 	"net/http"
-	"os"
-	"path/filepath"
 	"sort"
 
 	"github.com/gin-gonic/gin"
 	"github.com/kevinanielsen/go-fast-cdn/src/database"
 	"github.com/kevinanielsen/go-fast-cdn/src/models"
-	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"github.com/kevinanielsen/go-fast-cdn/src/usage"
 )
 
 type DashboardHandler struct {
@@ -29,18 +28,18 @@ func NewDashboardHandler(docRepo models.DocRepository, imageRepo models.ImageRep
 }
 
 func (h *DashboardHandler) GetDashboard(c *gin.Context) {
-	var cdnSize int64
-	_ = filepath.Walk(util.ExPath+"/uploads",
-		func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return err
-			}
-			cdnSize += info.Size()
-			return nil
-		})
+	cdnSize := usage.Snapshot().TotalBytes
 
-	docs := h.DocRepo.GetAllDocs()
-	images := h.ImageRepo.GetAllImages()
+	docs, err := h.DocRepo.GetAllDocs(c.Request.Context())
+	if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to load documents")
+		return
+	}
+	images, err := h.ImageRepo.GetAllImages(c.Request.Context())
+	if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to load images")
+		return
+	}
 
 	sort.Slice(docs, func(i, j int) bool {
 		return docs[i].CreatedAt.After(docs[j].CreatedAt)
@@ -56,7 +55,7 @@ func (h *DashboardHandler) GetDashboard(c *gin.Context) {
 		recentUploads = append(recentUploads, gin.H{"filename": img.FileName, "type": "image", "uploaded_at": img.CreatedAt})
 	}
 
-	users, _ := h.UserRepo.GetAllUsers()
+	users, _ := h.UserRepo.GetAllUsers(c.Request.Context())
 	totalUsers := len(users)
 	admins := 0
 	verified := 0
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/acl"
+	"github.com/kevinanielsen/go-fast-cdn/src/auth"
+	"github.com/kevinanielsen/go-fast-cdn/src/dav"
+	"github.com/kevinanielsen/go-fast-cdn/src/hooks"
+	"github.com/kevinanielsen/go-fast-cdn/src/moderation"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"github.com/kevinanielsen/go-fast-cdn/src/watermark"
+	"golang.org/x/net/webdav"
+)
+
+// DAVPrefix is the path the WebDAV endpoint is served under
+const DAVPrefix = "/dav"
+
+type DAVHandler struct {
+	dav *webdav.Handler
+}
+
+func NewDAVHandler(fs *dav.FileSystem) *DAVHandler {
+	return &DAVHandler{dav: &webdav.Handler{
+		Prefix:     DAVPrefix,
+		FileSystem: fs,
+		LockSystem: webdav.NewMemLS(),
+		Logger: func(r *http.Request, err error) {
+			if err != nil {
+				log.Printf("WebDAV %s %s: %s", r.Method, r.URL.Path, err.Error())
+			}
+		},
+	}}
+}
+
+// Challenge asks clients without credentials to log in with basic auth.
+// WebDAV clients authenticate with an API key as the password.
+func (h *DAVHandler) Challenge(c *gin.Context) {
+	c.Header("WWW-Authenticate", `Basic realm="go-fast-cdn"`)
+	c.Next()
+}
+
+// ServeDAV serves the WebDAV request, restricted to the organization of the
+// principal and the folders its groups may access. Files written by users
+// other than admins are held back for review and pass the upload hooks like
+// uploads through the API, and images are read watermarked like downloads.
+func (h *DAVHandler) ServeDAV(c *gin.Context) {
+	c.Writer.Header().Del("WWW-Authenticate")
+	ctx := dav.WithOrganization(c.Request.Context(), auth.OrganizationID(c))
+	ctx = dav.WithModeration(ctx, moderation.UploadStatus(c), func(n moderation.Notification) {
+		moderation.Notify(c, n)
+	})
+	ctx = dav.WithAccess(ctx, func(folder, level string) error {
+		err := acl.Default.Allowed(c, folder, level)
+		var denied *problem.Error
+		if errors.As(err, &denied) {
+			return fmt.Errorf("%w: %s", os.ErrPermission, denied.Detail)
+		}
+		return err
+	})
+	ctx = dav.WithWatermark(ctx, func(fileName, path string) (string, error) {
+		marked, err := watermark.Default.Path(c.Request.Context(), fileName, path, false)
+		if errors.Is(err, watermark.ErrCannotWatermark) {
+			return "", fmt.Errorf("%w: %s", os.ErrPermission, err.Error())
+		}
+		return marked, err
+	})
+	ctx = dav.WithHooks(ctx, dav.Hooks{
+		PreValidate: func(m hooks.Media) error { return hooks.PreValidate(c, m) },
+		PostStore:   func(m hooks.Media) { hooks.PostStore(c, m) },
+		PreDelete:   func(m hooks.Media) error { return hooks.PreDelete(c, m) },
+	})
+	h.dav.ServeHTTP(c.Writer, c.Request.WithContext(ctx))
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/acl"
+	"github.com/kevinanielsen/go-fast-cdn/src/auth"
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/dav"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/moderation"
+	"github.com/kevinanielsen/go-fast-cdn/src/settings"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeDAV_Moderation(t *testing.T) {
+	// Arrange
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	for _, folder := range []string{"images", "docs"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(util.ExPath, "uploads", folder), 0o755))
+	}
+	require.NoError(t, settings.Default.Load(database.NewConfigRepo(database.DB)))
+	enabled := "true"
+	require.NoError(t, settings.Default.Update(map[string]*string{settings.ModerationEnabled: &enabled}))
+	t.Cleanup(func() { settings.Default.Update(map[string]*string{settings.ModerationEnabled: nil}) })
+	var notified []string
+	moderation.AddHook(func(n moderation.Notification) { notified = append(notified, n.Type+" "+n.FileName) })
+
+	h := NewDAVHandler(dav.NewFileSystem(database.NewImageRepo(database.DB), database.NewDocRepo(database.DB), database.NewSearchRepo(database.DB)))
+	put := func(role, fileName, content string) int {
+		r := gin.New()
+		r.PUT(DAVPrefix+"/*path", func(c *gin.Context) {
+			auth.SetPrincipal(c, auth.UserPrincipal(auth.MethodAPIKey, &models.User{Email: role + "@example.com", Role: role}))
+		}, h.ServeDAV)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPut, DAVPrefix+"/docs/"+fileName, bytes.NewBufferString(content)))
+		return w.Code
+	}
+	status := func(fileName string) string {
+		doc, err := database.NewDocRepo(database.DB).GetDocByFileName(context.Background(), fileName)
+		require.NoError(t, err)
+		return doc.ModerationStatus
+	}
+
+	// Act & Assert
+	require.Equal(t, http.StatusCreated, put("user", "draft.txt", "written by a user"))
+	require.Equal(t, models.ModerationStatusPending, status("draft.txt"))
+	require.Equal(t, http.StatusCreated, put("admin", "final.txt", "written by an admin"))
+	require.Equal(t, models.ModerationStatusApproved, status("final.txt"))
+
+	// New content of an approved file is reviewed again
+	require.Equal(t, http.StatusCreated, put("user", "final.txt", "changed by a user"))
+	require.Equal(t, models.ModerationStatusPending, status("final.txt"))
+	require.Equal(t, []string{moderation.TypePending + " draft.txt", moderation.TypePending + " final.txt"}, notified)
+}
+
+func TestServeDAV_FolderAccess(t *testing.T) {
+	// Arrange
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	for _, folder := range []string{"images", "docs"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(util.ExPath, "uploads", folder), 0o755))
+	}
+	groups := database.NewGroupRepo(database.DB)
+	acl.Default = acl.New(groups)
+	t.Cleanup(func() { acl.Default = nil })
+
+	member := models.User{Email: "member@example.com", PasswordHash: "x", Role: "user"}
+	outsider := models.User{Email: "outsider@example.com", PasswordHash: "x", Role: "user"}
+	require.NoError(t, database.DB.Create(&member).Error)
+	require.NoError(t, database.DB.Create(&outsider).Error)
+	legal := models.Group{Name: "Legal"}
+	require.NoError(t, groups.CreateGroup(context.Background(), &legal))
+	require.NoError(t, groups.AddGroupMember(context.Background(), legal.ID, member.ID))
+	require.NoError(t, groups.SetFolderPermission(context.Background(), &models.FolderPermission{Folder: "docs", GroupID: legal.ID, Access: models.AccessWrite}))
+
+	h := NewDAVHandler(dav.NewFileSystem(database.NewImageRepo(database.DB), database.NewDocRepo(database.DB), database.NewSearchRepo(database.DB)))
+	do := func(user *models.User, method, path, content string) int {
+		r := gin.New()
+		r.Any(DAVPrefix+"/*path", func(c *gin.Context) {
+			auth.SetPrincipal(c, auth.UserPrincipal(auth.MethodAPIKey, user))
+		}, h.ServeDAV)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, DAVPrefix+path, bytes.NewBufferString(content)))
+		return w.Code
+	}
+
+	// Act & Assert
+	require.Equal(t, http.StatusCreated, do(&member, http.MethodPut, "/docs/contract.txt", "signed"))
+	require.Equal(t, http.StatusOK, do(&member, http.MethodGet, "/docs/contract.txt", ""))
+	require.NotEqual(t, http.StatusNoContent, do(&member, http.MethodDelete, "/docs/contract.txt", ""))
+
+	require.NotEqual(t, http.StatusOK, do(&outsider, http.MethodGet, "/docs/contract.txt", ""))
+	require.NotEqual(t, http.StatusCreated, do(&outsider, http.MethodPut, "/docs/leak.txt", "copied"))
+	require.NotEqual(t, http.StatusNoContent, do(&outsider, http.MethodDelete, "/docs/contract.txt", ""))
+	require.FileExists(t, filepath.Join(util.ExPath, "uploads", "docs", "contract.txt"))
+	require.NoFileExists(t, filepath.Join(util.ExPath, "uploads", "docs", "leak.txt"))
+
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/kevinanielsen/go-fast-cdn/src/database"
 	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
 )
 
 func HandleDropDB(c *gin.Context) {
@@ -14,17 +15,30 @@ func HandleDropDB(c *gin.Context) {
 
 	token := c.Query("token")
 	if len(token) == 0 {
-		c.String(http.StatusBadRequest, "No token provided")
+		problem.Write(c, http.StatusBadRequest, "No token provided")
 		return
 	}
 	if token != validToken {
-		c.String(http.StatusUnauthorized, "Invalid token: %s", token)
+		problem.WriteDetails(c, http.StatusUnauthorized, "Invalid token", token)
 		return
 	}
 	database.DB.Migrator().DropTable(models.Doc{})
 	database.DB.Migrator().DropTable(models.Image{})
+	database.DB.Migrator().DropTable(models.MediaRelation{})
+	database.DB.Migrator().DropTable(models.MediaAlias{})
+	database.DB.Migrator().DropTable(models.ShareLink{})
+	database.DB.Migrator().DropTable(models.ShareLinkFile{})
+	database.DB.Migrator().DropTable(models.UploadPreset{})
+	database.DB.Migrator().DropTable(models.TransformPreset{})
+	database.DB.Migrator().DropTable(models.Tripwire{})
 	database.DB.Migrator().DropTable(models.User{})
 	database.DB.Migrator().DropTable(models.UserSession{})
 	database.DB.Migrator().DropTable(models.PasswordReset{})
+	database.DB.Migrator().DropTable(models.BackupCode{})
+	database.DB.Migrator().DropTable(models.Organization{})
+	database.DB.Migrator().DropTable(models.ServiceAccount{})
+	database.DB.Migrator().DropTable(models.APIKey{})
+	// Forget the applied migrations so they recreate the dropped tables
+	database.DB.Migrator().DropTable(models.SchemaMigration{})
 	database.Migrate()
 }
@@ -5,9 +5,12 @@ import (
 )
 
 type DocHandler struct {
-	repo models.DocRepository
+	repo         models.DocRepository
+	relationRepo models.MediaRelationRepository
+	searchRepo   models.SearchRepository
+	aliasRepo    models.MediaAliasRepository
 }
 
-func NewDocHandler(repo models.DocRepository) *DocHandler {
-	return &DocHandler{repo}
+func NewDocHandler(repo models.DocRepository, relationRepo models.MediaRelationRepository, searchRepo models.SearchRepository, aliasRepo models.MediaAliasRepository) *DocHandler {
+	return &DocHandler{repo, relationRepo, searchRepo, aliasRepo}
 }
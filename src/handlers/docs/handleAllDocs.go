@@ -4,10 +4,15 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
 )
 
 func (h *DocHandler) HandleAllDocs(c *gin.Context) {
-	entries := h.repo.GetAllDocs()
+	entries, err := h.repo.GetAllDocs(c.Request.Context())
+	if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to list documents")
+		return
+	}
 
 	c.JSON(http.StatusOK, entries)
 }
@@ -1,36 +1,79 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/auth"
+	"github.com/kevinanielsen/go-fast-cdn/src/cache"
+	"github.com/kevinanielsen/go-fast-cdn/src/events"
+	"github.com/kevinanielsen/go-fast-cdn/src/hooks"
+	"github.com/kevinanielsen/go-fast-cdn/src/middleware"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"github.com/kevinanielsen/go-fast-cdn/src/usage"
 	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"gorm.io/gorm"
 )
 
 func (h *DocHandler) HandleDocDelete(c *gin.Context) {
 	fileName := c.Param("filename")
 	if fileName == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Doc name is required",
-		})
+		problem.Write(c, http.StatusBadRequest, "Doc name is required")
 		return
 	}
 
-	deletedFileName, success := h.repo.DeleteDoc(fileName)
-	if !success {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "Document not found",
-		})
+	ctx := c.Request.Context()
+	doc, err := h.repo.GetDocByFileName(ctx, fileName)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		problem.Write(c, http.StatusInternalServerError, "Failed to look up document")
+		return
+	}
+	if err == nil && !auth.InScope(c, doc.OrganizationID) {
+		problem.Write(c, http.StatusForbidden, "Document belongs to another organization")
 		return
 	}
 
-	err := util.DeleteFile(deletedFileName, "docs")
+	if middleware.AbortIfStale(c, models.MediaVersion(doc.UpdatedAt)) {
+		return
+	}
+	if doc.ID != 0 {
+		err := hooks.PreDelete(c, hooks.Stored(hooks.Media{
+			Type: models.MediaTypeDoc, FileName: doc.FileName, MimeType: doc.MimeType,
+			UUID: doc.UUID, OrganizationID: doc.OrganizationID,
+		}))
+		if err != nil {
+			hooks.Abort(c, err)
+			return
+		}
+	}
+
+	deletedFileName, err := h.repo.DeleteDoc(middleware.Unchanged(c, doc.UpdatedAt), fileName)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		problem.NotFound(c, "Document not found")
+		return
+	}
+	if errors.Is(err, models.ErrStale) {
+		middleware.AbortStale(c)
+		return
+	}
+	if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to delete document")
+		return
+	}
+
+	cache.Invalidate(models.MediaTypeDoc, deletedFileName)
+	err = usage.Track(models.MediaTypeDoc, doc.OrganizationID, deletedFileName, func() error {
+		return util.DeleteFile(deletedFileName, "docs")
+	})
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "Failed to delete document",
-		})
+		problem.Write(c, http.StatusInternalServerError, "Failed to delete document")
+		return
 	}
 
+	events.Record(c, events.TypeDeleted, models.MediaTypeDoc+"/"+deletedFileName, nil)
+
 	c.JSON(http.StatusOK, gin.H{
 		"message":  "Document deleted successfully",
 		"fileName": deletedFileName,
@@ -1,23 +1,26 @@
 package handlers
 
 import (
+	"context"
 	"errors"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
 
-	"github.com/kevinanielsen/go-fast-cdn/src/util"
-
 	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/metrics"
+	"github.com/kevinanielsen/go-fast-cdn/src/middleware"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"gorm.io/gorm"
 )
 
-func HandleDocMetadata(c *gin.Context) {
+func (h *DocHandler) HandleDocMetadata(c *gin.Context) {
 	fileName := c.Param("filename")
 	if fileName == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Doc name is required",
-		})
+		problem.Write(c, http.StatusBadRequest, "Doc name is required")
 		return
 	}
 
@@ -25,21 +28,70 @@ func HandleDocMetadata(c *gin.Context) {
 	stat, err := os.Stat(filePath)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
-			c.JSON(http.StatusNotFound, gin.H{
-				"error": "Doc does not exist",
-			})
+			problem.NotFound(c, "Doc does not exist")
 		} else {
 			log.Printf("Failed to get document %s: %s\n", fileName, err.Error())
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": "Internal error",
-			})
+			problem.Write(c, http.StatusInternalServerError, "Internal error")
 		}
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	body := gin.H{
 		"filename":     fileName,
 		"download_url": c.Request.Host + "/api/cdn/download/docs/" + fileName,
 		"file_size":    stat.Size(),
-	})
+	}
+	h.addRecordFields(c.Request.Context(), fileName, body)
+	if downloads, err := metrics.DownloadCount(c.Request.Context(), models.MediaTypeDoc, fileName); err == nil {
+		body["downloads"] = downloads
+	} else {
+		log.Printf("Failed to count downloads of document %s: %s\n", fileName, err.Error())
+	}
+	if integrity, err := util.Integrity(filePath); err == nil {
+		body["integrity"] = integrity
+	} else {
+		log.Printf("Failed to hash document %s: %s\n", fileName, err.Error())
+	}
+
+	if version, ok := body["version"].(string); ok {
+		c.Header("ETag", middleware.ETag(version))
+	}
+	c.JSON(http.StatusOK, body)
+}
+
+// addRecordFields adds the version, descriptive fields, download settings
+// and related media of the document to body, using defaults if the document
+// has no database record or the lookup fails.
+func (h *DocHandler) addRecordFields(ctx context.Context, fileName string, body gin.H) {
+	body["related"] = []models.RelatedMedia{}
+	body["disposition"] = models.DispositionInline
+	body["download_name"] = fileName
+
+	doc, err := h.repo.GetDocByFileName(ctx, fileName)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Failed to get document %s: %s\n", fileName, err.Error())
+		}
+		return
+	}
+
+	body["version"] = models.MediaVersion(doc.UpdatedAt)
+	body["original_name"] = doc.OriginalName
+	body["title"] = doc.Title
+	body["alt_text"] = doc.AltText
+	body["description"] = doc.Description
+	if len(doc.Attributes) > 0 {
+		body["attributes"] = doc.Attributes
+	}
+	if doc.Disposition != "" {
+		body["disposition"] = doc.Disposition
+	}
+	body["download_name"] = util.DefaultDownloadName(fileName, doc.DownloadName, doc.OriginalName)
+
+	related, err := h.relationRepo.GetRelated(ctx, models.MediaTypeDoc, doc.ID)
+	if err != nil {
+		log.Printf("Failed to get related media for document %s: %s\n", fileName, err.Error())
+		return
+	}
+	body["related"] = related
 }
@@ -8,15 +8,17 @@ import (
 	"path/filepath"
 	"testing"
 
-	"github.com/kevinanielsen/go-fast-cdn/src/util"
-
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
 	"github.com/stretchr/testify/require"
 )
 
 func TestHandleDocMetadata_NoError(t *testing.T) {
 	// Arrange
+	h := newTestDocHandler(t)
 	testFileName := uuid.NewString()
 	testFileDir := filepath.Join(util.ExPath, "uploads", "docs")
 	defer os.RemoveAll(filepath.Join(util.ExPath, "uploads"))
@@ -35,7 +37,7 @@ func TestHandleDocMetadata_NoError(t *testing.T) {
 	}}
 
 	// Act
-	HandleDocMetadata(c)
+	h.HandleDocMetadata(c)
 
 	// Assert
 	require.Equal(t, http.StatusOK, w.Result().StatusCode)
@@ -47,11 +49,13 @@ func TestHandleDocMetadata_NoError(t *testing.T) {
 	require.Contains(t, result, "download_url")
 	require.NotEmpty(t, result["download_url"])
 	require.Contains(t, result, "file_size")
+	require.Contains(t, result, "related")
 	require.Equal(t, float64(len(testFileContents)), result["file_size"])
 }
 
 func TestHandleDocMetadata_NotFound(t *testing.T) {
 	// Arrange
+	h := newTestDocHandler(t)
 	testFileName := uuid.NewString()
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
@@ -62,7 +66,7 @@ func TestHandleDocMetadata_NotFound(t *testing.T) {
 	}}
 
 	// Act
-	HandleDocMetadata(c)
+	h.HandleDocMetadata(c)
 
 	// Assert
 	require.Equal(t, http.StatusNotFound, w.Result().StatusCode)
@@ -71,16 +75,19 @@ func TestHandleDocMetadata_NotFound(t *testing.T) {
 	require.NoError(t, err)
 	require.Contains(t, result, "error")
 	require.Equal(t, result["error"], "Doc does not exist")
+	require.Equal(t, result["detail"], "Doc does not exist")
+	require.Equal(t, problem.ContentType, w.Header().Get("Content-Type"))
 }
 
 func TestHandleDocMetadata_NameNotProvided(t *testing.T) {
 	// Arrange
+	h := newTestDocHandler(t)
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
 	c.Request = httptest.NewRequest(http.MethodGet, "/test", nil)
 
 	// Act
-	HandleDocMetadata(c)
+	h.HandleDocMetadata(c)
 
 	// Assert
 	require.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
@@ -90,3 +97,10 @@ func TestHandleDocMetadata_NameNotProvided(t *testing.T) {
 	require.Contains(t, result, "error")
 	require.Equal(t, result["error"], "Doc name is required")
 }
+
+func newTestDocHandler(t *testing.T) *DocHandler {
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+
+	return NewDocHandler(database.NewDocRepo(database.DB), database.NewMediaRelationRepo(database.DB), database.NewSearchRepo(database.DB), database.NewMediaAliasRepo(database.DB))
+}
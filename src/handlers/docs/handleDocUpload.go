@@ -1,13 +1,31 @@
 package handlers
 
 import (
-	"crypto/md5"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
 	"net/http"
+	"os"
 	"path/filepath"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/auth"
+	"github.com/kevinanielsen/go-fast-cdn/src/convert"
+	"github.com/kevinanielsen/go-fast-cdn/src/events"
+	"github.com/kevinanielsen/go-fast-cdn/src/hooks"
 	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/moderation"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"github.com/kevinanielsen/go-fast-cdn/src/search"
+	"github.com/kevinanielsen/go-fast-cdn/src/settings"
+	"github.com/kevinanielsen/go-fast-cdn/src/usage"
 	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/kevinanielsen/go-fast-cdn/src/validations"
+	"gorm.io/gorm"
 )
 
 func (h *DocHandler) HandleDocUpload(c *gin.Context) {
@@ -15,44 +33,68 @@ func (h *DocHandler) HandleDocUpload(c *gin.Context) {
 	newName := c.PostForm("filename")
 
 	if err != nil {
-		c.String(http.StatusBadRequest, "Failed to read file: %s", err.Error())
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			problem.Write(c, http.StatusRequestEntityTooLarge, "File is too large")
+			return
+		}
+		problem.WriteDetails(c, http.StatusBadRequest, "Failed to read file", err.Error())
 		return
 	}
 
 	file, err := fileHeader.Open()
 	if err != nil {
-		c.String(http.StatusBadRequest, "Failed to open file: %s", err.Error())
+		problem.WriteDetails(c, http.StatusBadRequest, "Failed to open file", err.Error())
 		return
 	}
 	defer file.Close()
 
 	fileBuffer := make([]byte, 512)
-	_, err = file.Read(fileBuffer)
+	n, err := file.Read(fileBuffer)
 	if err != nil {
-		c.String(http.StatusInternalServerError, "Failed to read file: %s", err.Error())
+		problem.WriteDetails(c, http.StatusInternalServerError, "Failed to read file", err.Error())
 		return
 	}
-	fileType := http.DetectContentType(fileBuffer)
-
-	allowedMimeTypes := map[string]bool{
-		"text/plain":                true,
-		"text/plain; charset=utf-8": true,
-		"application/msword":        true,
-		"application/vnd.openxmlformats-officedocument.wordprocessingml.document":   true,
-		"application/vnd.openxmlformats-officedocument.presentationml.presentation": true,
-		"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         true,
-		"application/pdf":       true,
-		"application/rtf":       true,
-		"application/x-freearc": true,
-		"application/zip":       true,
+	err = hooks.PreValidate(c, hooks.Media{
+		Type: models.MediaTypeDoc, FileName: fileHeader.Filename, Size: fileHeader.Size,
+		OrganizationID: auth.OrganizationID(c), Header: fileBuffer[:n],
+		Open: func() (io.ReadCloser, error) { return fileHeader.Open() },
+	})
+	if err != nil {
+		hooks.Abort(c, err)
+		return
 	}
-
-	if !allowedMimeTypes[fileType] {
-		c.String(http.StatusBadRequest, "Invalid file type: %s", fileType)
+	if err := validations.ValidateContentType(models.MediaTypeDoc, fileHeader.Filename, fileBuffer); err != nil {
+		problem.Abort(c, problem.New(http.StatusBadRequest, problem.CodeMediaInvalidType, err.Error()))
 		return
 	}
 
-	fileHashBuffer := md5.Sum(fileBuffer)
+	checksumAlgorithm := util.ChecksumAlgorithm()
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		problem.WriteDetails(c, http.StatusInternalServerError, "Failed to read file", err.Error())
+		return
+	}
+	// Files whose extension is registered for sanitizing are checksummed
+	// and stored without their active content
+	var content io.Reader = file
+	var sanitized []byte
+	if validations.RequiresSanitizing(fileHeader.Filename) {
+		data, err := io.ReadAll(file)
+		if err != nil {
+			problem.WriteDetails(c, http.StatusInternalServerError, "Failed to read file", err.Error())
+			return
+		}
+		if sanitized, err = validations.Sanitize(fileHeader.Filename, data); err != nil {
+			problem.Abort(c, problem.New(http.StatusBadRequest, problem.CodeMediaInvalidType, err.Error()))
+			return
+		}
+		content = bytes.NewReader(sanitized)
+	}
+	fileHashBuffer, err := util.Checksum(checksumAlgorithm, content)
+	if err != nil {
+		problem.WriteDetails(c, http.StatusInternalServerError, "Failed to read file", err.Error())
+		return
+	}
 	var filename string
 	if newName == "" {
 		filename = fileHeader.Filename
@@ -60,38 +102,150 @@ func (h *DocHandler) HandleDocUpload(c *gin.Context) {
 		filename = newName + filepath.Ext(fileHeader.Filename)
 	}
 
-	filteredFilename, err := util.FilterFilename(filename)
+	filteredFilename, err := util.FilterFilename(util.StoredName(settings.Default.Get(settings.FileNamingStrategy), filename, fileHashBuffer))
 	if err != nil {
-		c.String(http.StatusBadRequest, err.Error())
+		problem.Write(c, http.StatusBadRequest, err.Error())
 		return
 	}
 
 	doc := models.Doc{
-		FileName: filteredFilename,
-		Checksum: fileHashBuffer[:],
+		FileName:          filteredFilename,
+		OriginalName:      filename,
+		MimeType:          validations.DetectMimeType(filteredFilename, fileBuffer[:n]),
+		Checksum:          fileHashBuffer,
+		ChecksumAlgorithm: checksumAlgorithm,
+		OrganizationID:    auth.OrganizationID(c),
+		ModerationStatus:  moderation.UploadStatus(c),
+	}
+	if preset, ok := c.Get("upload_preset"); ok {
+		doc.ExpiresAt = preset.(*models.UploadPreset).Expiry(time.Now())
+	}
+	if expiresAt, ok := c.Get("upload_expires_at"); ok {
+		expiresAt := expiresAt.(time.Time)
+		doc.ExpiresAt = &expiresAt
 	}
 
-	docInDatabase := h.repo.GetDocByCheckSum(fileHashBuffer[:])
-	if len(docInDatabase.Checksum) > 0 {
-		c.JSON(http.StatusConflict, gin.H{"error": "File already exists"})
+	ctx := c.Request.Context()
+	docInDatabase, err := h.repo.GetDocByCheckSum(ctx, fileHashBuffer)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		problem.Write(c, http.StatusInternalServerError, "Failed to look up existing documents")
+		return
+	}
+	if err == nil {
+		existing := existingDoc(c, docInDatabase)
+		// With on_duplicate=link the upload resolves to the stored file
+		// instead of failing
+		if c.PostForm("on_duplicate") == "link" {
+			c.JSON(http.StatusOK, gin.H{"file_url": existing.FileURL, "duplicate": true, "existing": existing})
+			return
+		}
+		// With ?allow_duplicate=true the new name becomes an alias of the
+		// stored file
+		if allow, _ := strconv.ParseBool(c.Query("allow_duplicate")); allow {
+			h.linkDuplicate(c, docInDatabase, filteredFilename, existing)
+			return
+		}
+		problem.Abort(c, problem.New(http.StatusConflict, problem.CodeMediaDuplicate, "File already exists").With("existing", existing))
 		return
 	}
 
-	savedFileName, err := h.repo.AddDoc(doc)
+	savedFileName, err := h.repo.AddDoc(ctx, doc)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, err.Error())
+		problem.WriteDetails(c, http.StatusInternalServerError, "Failed to save file", err.Error())
 		return
 	}
 
-	err = c.SaveUploadedFile(fileHeader, util.ExPath+"/uploads/docs/"+savedFileName)
+	err = usage.Track(models.MediaTypeDoc, doc.OrganizationID, savedFileName, func() error {
+		savedPath := util.ExPath + "/uploads/docs/" + savedFileName
+		if sanitized != nil {
+			return os.WriteFile(savedPath, sanitized, 0o644)
+		}
+		return c.SaveUploadedFile(fileHeader, savedPath)
+	})
 	if err != nil {
-		c.String(http.StatusInternalServerError, "Failed to save file: %s", err.Error())
+		problem.WriteDetails(c, http.StatusInternalServerError, "Failed to save file", err.Error())
 		return
 	}
 
-	body := gin.H{
-		"file_url": c.Request.Host + "/download/docs/" + savedFileName,
+	search.EnqueueIndexDoc(ctx, h.searchRepo, savedFileName)
+	convert.EnqueuePDF(ctx, savedFileName)
+
+	events.Record(c, events.TypeUploaded, models.MediaTypeDoc+"/"+savedFileName, gin.H{"size": fileHeader.Size})
+
+	uploaded := h.uploadedDoc(c, doc, savedFileName)
+	if uploaded.ModerationStatus == models.ModerationStatusPending {
+		moderation.Notify(c, moderation.Notification{
+			Type: moderation.TypePending, MediaType: models.MediaTypeDoc, FileName: uploaded.FileName,
+			UUID: uploaded.UUID, OrganizationID: doc.OrganizationID,
+		})
+	}
+	hooks.PostStore(c, hooks.Stored(hooks.Media{
+		Type: models.MediaTypeDoc, FileName: uploaded.FileName, MimeType: uploaded.MimeType,
+		UUID: uploaded.UUID, OrganizationID: doc.OrganizationID,
+	}))
+	c.JSON(http.StatusOK, uploaded)
+}
+
+// uploadedDoc describes the document an upload stored as fileName, so
+// clients do not need to look up its metadata afterwards. doc is used if its
+// record cannot be read back.
+func (h *DocHandler) uploadedDoc(c *gin.Context, doc models.Doc, fileName string) models.UploadedMedia {
+	stored, err := h.repo.GetDocByFileName(c.Request.Context(), fileName)
+	if err != nil {
+		log.Printf("Failed to look up uploaded document %s: %s\n", fileName, err.Error())
+		stored = doc
+		stored.FileName = fileName
+	}
+	return models.UploadedMedia{ExistingMedia: existingDoc(c, stored)}
+}
+
+// linkDuplicate answers an upload of the content of stored under fileName by
+// making fileName an alias of stored, so downloads of it are redirected
+func (h *DocHandler) linkDuplicate(c *gin.Context, stored models.Doc, fileName string, existing models.ExistingMedia) {
+	ctx := c.Request.Context()
+	if fileName != stored.FileName {
+		_, err := h.repo.GetDocByFileName(ctx, fileName)
+		if err == nil {
+			problem.Abort(c, problem.New(http.StatusConflict, problem.CodeMediaNameTaken, "File name already taken").With("existing", existing))
+			return
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			problem.Write(c, http.StatusInternalServerError, "Failed to look up existing documents")
+			return
+		}
+		if err := h.aliasRepo.AddAlias(ctx, models.MediaTypeDoc, fileName, stored.UUID); err != nil {
+			problem.WriteDetails(c, http.StatusInternalServerError, "Failed to link the file", err.Error())
+			return
+		}
+		events.Record(c, events.TypeUploaded, models.MediaTypeDoc+"/"+fileName, gin.H{"alias_of": stored.FileName})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"file_url":  c.Request.Host + "/download/docs/" + fileName,
+		"duplicate": true,
+		"alias":     fileName != stored.FileName,
+		"existing":  existing,
+	})
+}
+
+// existingDoc describes a stored document for duplicate upload responses
+func existingDoc(c *gin.Context, doc models.Doc) models.ExistingMedia {
+	existing := models.ExistingMedia{
+		UUID:             doc.UUID,
+		ID:               doc.ID,
+		Type:             models.MediaTypeDoc,
+		FileName:         doc.FileName,
+		FileURL:          c.Request.Host + "/download/docs/" + doc.FileName,
+		DownloadURL:      c.Request.Host + "/api/cdn/download/docs/" + doc.FileName,
+		Checksum:         hex.EncodeToString(doc.Checksum),
+		CreatedAt:        doc.CreatedAt,
+		MimeType:         doc.MimeType,
+		ExpiresAt:        doc.ExpiresAt,
+		ModerationStatus: doc.ModerationStatus,
+		RenditionsURL:    c.Request.Host + "/api/cdn/media/" + doc.UUID + "/renditions",
+	}
+	if info, err := os.Stat(filepath.Join(util.ExPath, "uploads", "docs", doc.FileName)); err == nil {
+		existing.FileSize = info.Size()
 	}
 
-	c.JSON(http.StatusOK, body)
+	return existing
 }
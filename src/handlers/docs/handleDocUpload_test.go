@@ -1,6 +1,9 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"mime/multipart"
@@ -10,7 +13,13 @@ import (
 	"testing"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/auth"
 	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/middleware"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/moderation"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"github.com/kevinanielsen/go-fast-cdn/src/settings"
 	"github.com/kevinanielsen/go-fast-cdn/src/util"
 	"github.com/stretchr/testify/require"
 )
@@ -46,11 +55,19 @@ func TestHandleDocUpload_NoError(t *testing.T) {
 	}()
 
 	// handling
-	docHandler := NewDocHandler(database.NewDocRepo(database.DB))
+	docHandler := NewDocHandler(database.NewDocRepo(database.DB), database.NewMediaRelationRepo(database.DB), database.NewSearchRepo(database.DB), database.NewMediaAliasRepo(database.DB))
 	docHandler.HandleDocUpload(c)
 
 	// assert
 	require.Equal(t, http.StatusOK, w.Result().StatusCode)
+	var body models.UploadedMedia
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	require.NotZero(t, body.ID)
+	require.Equal(t, models.MediaTypeDoc, body.Type)
+	require.Equal(t, int64(len(testDataFile)), body.FileSize)
+	require.Equal(t, "text/plain; charset=utf-8", body.MimeType)
+	require.NotEmpty(t, body.Checksum)
+	require.Contains(t, body.RenditionsURL, "/api/cdn/media/"+body.UUID+"/renditions")
 }
 
 func TestHandleDocUpload_ReadFailed_NoFile(t *testing.T) {
@@ -82,12 +99,15 @@ func TestHandleDocUpload_ReadFailed_NoFile(t *testing.T) {
 	}()
 
 	// handling
-	docHandler := NewDocHandler(database.NewDocRepo(database.DB))
+	docHandler := NewDocHandler(database.NewDocRepo(database.DB), database.NewMediaRelationRepo(database.DB), database.NewSearchRepo(database.DB), database.NewMediaAliasRepo(database.DB))
 	docHandler.HandleDocUpload(c)
 
 	// assert
 	require.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
-	require.Equal(t, w.Body.String(), "Failed to read file: http: no such file")
+	var body problem.Details
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	require.Equal(t, "Failed to read file", body.Detail)
+	require.Equal(t, "http: no such file", body.Details)
 }
 
 func TestHandleDocUpload_ReadFailed_EOF(t *testing.T) {
@@ -119,12 +139,15 @@ func TestHandleDocUpload_ReadFailed_EOF(t *testing.T) {
 	}()
 
 	// handling
-	docHandler := NewDocHandler(database.NewDocRepo(database.DB))
+	docHandler := NewDocHandler(database.NewDocRepo(database.DB), database.NewMediaRelationRepo(database.DB), database.NewSearchRepo(database.DB), database.NewMediaAliasRepo(database.DB))
 	docHandler.HandleDocUpload(c)
 
 	// assert
 	require.Equal(t, http.StatusInternalServerError, w.Result().StatusCode)
-	require.Equal(t, w.Body.String(), "Failed to read file: EOF")
+	var body problem.Details
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	require.Equal(t, "Failed to read file", body.Detail)
+	require.Equal(t, "EOF", body.Details)
 }
 
 func TestHandleDocUpload_InvalidType(t *testing.T) {
@@ -156,12 +179,14 @@ func TestHandleDocUpload_InvalidType(t *testing.T) {
 	}()
 
 	// handling
-	docHandler := NewDocHandler(database.NewDocRepo(database.DB))
+	docHandler := NewDocHandler(database.NewDocRepo(database.DB), database.NewMediaRelationRepo(database.DB), database.NewSearchRepo(database.DB), database.NewMediaAliasRepo(database.DB))
 	docHandler.HandleDocUpload(c)
 
 	// assert
 	require.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
-	require.Equal(t, w.Body.String(), "Invalid file type: application/octet-stream")
+	var body problem.Details
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	require.Equal(t, "Invalid file type: application/octet-stream", body.Detail)
 }
 
 func TestHandleDocUpload_InvalidFilename(t *testing.T) {
@@ -193,12 +218,14 @@ func TestHandleDocUpload_InvalidFilename(t *testing.T) {
 	}()
 
 	// handling
-	docHandler := NewDocHandler(database.NewDocRepo(database.DB))
+	docHandler := NewDocHandler(database.NewDocRepo(database.DB), database.NewMediaRelationRepo(database.DB), database.NewSearchRepo(database.DB), database.NewMediaAliasRepo(database.DB))
 	docHandler.HandleDocUpload(c)
 
 	// assert
 	require.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
-	require.Equal(t, w.Body.String(), "filename cannot contain more than one period character")
+	var body problem.Details
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	require.Equal(t, "filename cannot contain more than one period character", body.Detail)
 }
 
 func TestHandleDocUpload_FileExist(t *testing.T) {
@@ -230,7 +257,7 @@ func TestHandleDocUpload_FileExist(t *testing.T) {
 	c.Request.Header.Add("Content-Type", writer.FormDataContentType())
 
 	// first handling
-	docHandler := NewDocHandler(database.NewDocRepo(database.DB))
+	docHandler := NewDocHandler(database.NewDocRepo(database.DB), database.NewMediaRelationRepo(database.DB), database.NewSearchRepo(database.DB), database.NewMediaAliasRepo(database.DB))
 	docHandler.HandleDocUpload(c)
 
 	// first statement
@@ -252,7 +279,190 @@ func TestHandleDocUpload_FileExist(t *testing.T) {
 
 	// second statement
 	require.Equal(t, http.StatusConflict, ww.Result().StatusCode)
-	require.Equal(t, ww.Body.String(),
-		`{"error":"File already exists"}`,
-	)
+	var body struct {
+		Error    string               `json:"error"`
+		Existing models.ExistingMedia `json:"existing"`
+	}
+	require.NoError(t, json.Unmarshal(ww.Body.Bytes(), &body))
+	require.Equal(t, "File already exists", body.Error)
+	require.NotEmpty(t, body.Existing.UUID)
+	require.Equal(t, "filename.txt", body.Existing.FileName)
+	require.Equal(t, int64(len(testDataFile)), body.Existing.FileSize)
+}
+
+func TestHandleDocUpload_DatabaseError(t *testing.T) {
+	pipeRead, pipeWriter := io.Pipe()
+	writer := multipart.NewWriter(pipeWriter)
+	go func() {
+		defer writer.Close()
+		part, _ := writer.CreateFormFile("doc", "filename.txt")
+		part.Write(testDataFile)
+	}()
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	// A cancelled request makes every query fail
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/cdn/upload/doc", pipeRead).WithContext(ctx)
+	c.Request.Header.Add("Content-Type", writer.FormDataContentType())
+
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+
+	docHandler := NewDocHandler(database.NewDocRepo(database.DB), database.NewMediaRelationRepo(database.DB), database.NewSearchRepo(database.DB), database.NewMediaAliasRepo(database.DB))
+	docHandler.HandleDocUpload(c)
+
+	require.Equal(t, http.StatusInternalServerError, w.Result().StatusCode)
+}
+
+func TestHandleDocUpload_NamingStrategy(t *testing.T) {
+	t.Setenv("FILE_NAMING_STRATEGY", util.NamingSlug)
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	require.NoError(t, os.MkdirAll(util.ExPath+"/uploads/docs", 0o755))
+
+	pipeRead, pipeWriter := io.Pipe()
+	writer := multipart.NewWriter(pipeWriter)
+	go func() {
+		defer writer.Close()
+		part, _ := writer.CreateFormFile("doc", "Résumé Final.txt")
+		part.Write(testDataFile)
+	}()
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/cdn/upload/doc", pipeRead)
+	c.Request.Header.Add("Content-Type", writer.FormDataContentType())
+
+	docHandler := NewDocHandler(database.NewDocRepo(database.DB), database.NewMediaRelationRepo(database.DB), database.NewSearchRepo(database.DB), database.NewMediaAliasRepo(database.DB))
+	docHandler.HandleDocUpload(c)
+
+	require.Equal(t, http.StatusOK, w.Result().StatusCode, w.Body.String())
+	doc, err := database.NewDocRepo(database.DB).GetDocByFileName(context.Background(), "resume-final.txt")
+	require.NoError(t, err)
+	require.Equal(t, "Résumé Final.txt", doc.OriginalName)
+	require.Equal(t, "text/plain; charset=utf-8", doc.MimeType)
+	require.FileExists(t, util.ExPath+"/uploads/docs/resume-final.txt")
+}
+
+func TestHandleDocUpload_AllowDuplicate(t *testing.T) {
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	require.NoError(t, os.MkdirAll(util.ExPath+"/uploads/docs", 0o755))
+	docHandler := NewDocHandler(database.NewDocRepo(database.DB), database.NewMediaRelationRepo(database.DB), database.NewSearchRepo(database.DB), database.NewMediaAliasRepo(database.DB))
+
+	upload := func(name, target string) *httptest.ResponseRecorder {
+		pipeRead, pipeWriter := io.Pipe()
+		writer := multipart.NewWriter(pipeWriter)
+		go func() {
+			defer writer.Close()
+			part, _ := writer.CreateFormFile("doc", name)
+			part.Write(testDataFile)
+		}()
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, target, pipeRead)
+		c.Request.Header.Add("Content-Type", writer.FormDataContentType())
+		docHandler.HandleDocUpload(c)
+		return w
+	}
+
+	require.Equal(t, http.StatusOK, upload("original.txt", "/api/cdn/upload/doc").Code)
+	w := upload("copy.txt", "/api/cdn/upload/doc")
+	require.Equal(t, http.StatusConflict, w.Code)
+	require.Contains(t, w.Body.String(), `"code":"media.duplicate"`)
+
+	w = upload("copy.txt", "/api/cdn/upload/doc?allow_duplicate=true")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var body struct {
+		FileURL  string               `json:"file_url"`
+		Alias    bool                 `json:"alias"`
+		Existing models.ExistingMedia `json:"existing"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	require.True(t, body.Alias)
+	require.Contains(t, body.FileURL, "/download/docs/copy.txt")
+	require.Equal(t, "original.txt", body.Existing.FileName)
+
+	alias, err := database.NewMediaAliasRepo(database.DB).GetAlias(context.Background(), models.MediaTypeDoc, "copy.txt")
+	require.NoError(t, err)
+	require.Equal(t, body.Existing.UUID, alias.MediaUUID)
+	require.NoFileExists(t, util.ExPath+"/uploads/docs/copy.txt")
+
+	// The name of another stored doc is not taken over
+	require.NoError(t, database.DB.Create(&models.Doc{FileName: "taken.txt", Checksum: []byte("other")}).Error)
+	w = upload("taken.txt", "/api/cdn/upload/doc?allow_duplicate=true")
+	require.Equal(t, http.StatusConflict, w.Code)
+	require.Contains(t, w.Body.String(), `"code":"media.name_taken"`)
+}
+
+func TestHandleDocUpload_TooLarge(t *testing.T) {
+	// Arrange
+	t.Setenv("MAX_UPLOAD_BODY_SIZE", "256")
+	h := newTestDocHandler(t)
+	r := gin.New()
+	r.POST("/api/cdn/upload/doc", middleware.BodyLimit(settings.MaxUploadBodySize), h.HandleDocUpload)
+
+	// The body is streamed, so the size is only known once it is read
+	pipeRead, pipeWriter := io.Pipe()
+	defer pipeRead.Close()
+	writer := multipart.NewWriter(pipeWriter)
+	go func() {
+		defer pipeWriter.Close()
+		part, _ := writer.CreateFormFile("doc", "filename.txt")
+		part.Write(testDataFile)
+		writer.Close()
+	}()
+	req := httptest.NewRequest(http.MethodPost, "/api/cdn/upload/doc", pipeRead)
+	req.Header.Add("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+
+	// Act
+	r.ServeHTTP(w, req)
+
+	// Assert
+	require.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	require.Equal(t, problem.CodeTooLarge, body["code"])
+}
+
+func TestHandleDocUpload_Moderation(t *testing.T) {
+	// Arrange
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	require.NoError(t, os.MkdirAll(util.ExPath+"/uploads/docs", 0o755))
+	require.NoError(t, settings.Default.Load(database.NewConfigRepo(database.DB)))
+	enabled := "true"
+	require.NoError(t, settings.Default.Update(map[string]*string{settings.ModerationEnabled: &enabled}))
+	t.Cleanup(func() { settings.Default.Update(map[string]*string{settings.ModerationEnabled: nil}) })
+	var notified []string
+	moderation.AddHook(func(n moderation.Notification) { notified = append(notified, n.Type+" "+n.FileName) })
+
+	docHandler := NewDocHandler(database.NewDocRepo(database.DB), database.NewMediaRelationRepo(database.DB), database.NewSearchRepo(database.DB), database.NewMediaAliasRepo(database.DB))
+	upload := func(role, fileName string) models.UploadedMedia {
+		var buf bytes.Buffer
+		writer := multipart.NewWriter(&buf)
+		part, _ := writer.CreateFormFile("doc", fileName)
+		part.Write(append([]byte(role+": "), testDataFile...))
+		writer.Close()
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/cdn/upload/doc", &buf)
+		c.Request.Header.Add("Content-Type", writer.FormDataContentType())
+		auth.SetPrincipal(c, auth.UserPrincipal(auth.MethodJWT, &models.User{Email: role + "@example.com", Role: role}))
+		docHandler.HandleDocUpload(c)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var body models.UploadedMedia
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return body
+	}
+
+	// Act & Assert
+	require.Equal(t, models.ModerationStatusPending, upload("user", "draft.txt").ModerationStatus)
+	require.Equal(t, models.ModerationStatusApproved, upload("admin", "final.txt").ModerationStatus)
+	require.Equal(t, []string{moderation.TypePending + " draft.txt"}, notified)
 }
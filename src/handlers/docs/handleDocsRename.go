@@ -1,38 +1,73 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"os"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/auth"
+	"github.com/kevinanielsen/go-fast-cdn/src/cache"
+	"github.com/kevinanielsen/go-fast-cdn/src/middleware"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
 	"github.com/kevinanielsen/go-fast-cdn/src/util"
-	"github.com/kevinanielsen/go-fast-cdn/src/validations"
+	"gorm.io/gorm"
 )
 
 func (h *DocHandler) HandleDocsRename(c *gin.Context) {
-	oldName := c.PostForm("filename")
-	newName := c.PostForm("newname")
+	var body struct {
+		Filename string `json:"filename" form:"filename" binding:"required"`
+		NewName  string `json:"newname" form:"newname" binding:"required,nefield=Filename,filename"`
+	}
+	if err := c.ShouldBind(&body); err != nil {
+		problem.Invalid(c, err)
+		return
+	}
+	oldName, newName := body.Filename, body.NewName
 
-	err := validations.ValidateRenameInput(oldName, newName)
-	if err != nil {
-		c.String(http.StatusBadRequest, err.Error())
+	ctx := c.Request.Context()
+	doc, err := h.repo.GetDocByFileName(ctx, oldName)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		problem.WriteDetails(c, http.StatusInternalServerError, "Failed to look up document", err.Error())
+		return
+	}
+	if err == nil && !auth.InScope(c, doc.OrganizationID) {
+		problem.Write(c, http.StatusForbidden, "Document belongs to another organization")
+		return
+	}
+
+	if middleware.AbortIfStale(c, models.MediaVersion(doc.UpdatedAt)) {
 		return
 	}
 
 	filteredNewName, err := util.FilterFilename(newName)
 	if err != nil {
-		c.String(http.StatusBadRequest, err.Error())
+		problem.Write(c, http.StatusBadRequest, err.Error())
 		return
 	}
 
 	err = util.RenameFile(oldName, filteredNewName, "docs")
+	if errors.Is(err, os.ErrNotExist) {
+		problem.NotFound(c, "Document does not exist")
+		return
+	}
 	if err != nil {
-		c.String(http.StatusInternalServerError, "Failed to rename file: %s", err.Error())
+		problem.WriteDetails(c, http.StatusInternalServerError, "Failed to rename file", err.Error())
 		return
 	}
+	cache.Invalidate(models.MediaTypeDoc, oldName)
+	cache.Invalidate(models.MediaTypeDoc, filteredNewName)
 
-	err = h.repo.RenameDoc(oldName, newName)
+	err = h.repo.RenameDoc(middleware.Unchanged(c, doc.UpdatedAt), oldName, newName)
+	if errors.Is(err, models.ErrStale) {
+		// The file was renamed for the version that was checked
+		util.RenameFile(filteredNewName, oldName, "docs")
+		middleware.AbortStale(c)
+		return
+	}
 	if err != nil {
-		c.String(http.StatusInternalServerError, "Failed to rename file: %s", err.Error())
+		problem.WriteDetails(c, http.StatusInternalServerError, "Failed to rename file", err.Error())
 		return
 	}
 
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/metrics"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+)
+
+const (
+	defaultTopDownloads    = 10
+	maxTopDownloads        = 100
+	defaultTopDownloadDays = 7
+	dayFormat              = "2006-01-02"
+)
+
+type DownloadStatsHandler struct {
+	downloads *metrics.Downloads
+}
+
+func NewDownloadStatsHandler(downloads *metrics.Downloads) *DownloadStatsHandler {
+	return &DownloadStatsHandler{downloads: downloads}
+}
+
+// GetTopDownloads returns the most downloaded files. The range is either the
+// last ?days=7 days including today, all time for days=0, or the days from
+// ?from=2006-01-02 to ?to=2006-01-02 inclusive. ?type=image|doc restricts
+// the report to one media type and ?limit=10 sets the number of files.
+func (h *DownloadStatsHandler) GetTopDownloads(c *gin.Context) {
+	if h.downloads == nil {
+		problem.Write(c, http.StatusConflict, "Downloads are not being counted")
+		return
+	}
+
+	mediaType := c.Query("type")
+	if mediaType != "" && mediaType != models.MediaTypeImage && mediaType != models.MediaTypeDoc {
+		problem.Write(c, http.StatusBadRequest, "Invalid type")
+		return
+	}
+
+	limit := defaultTopDownloads
+	if val := c.Query("limit"); val != "" {
+		parsed, err := strconv.Atoi(val)
+		if err != nil || parsed < 1 || parsed > maxTopDownloads {
+			problem.Write(c, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxTopDownloads))
+			return
+		}
+		limit = parsed
+	}
+
+	var since, until time.Time
+	if c.Query("from") != "" || c.Query("to") != "" {
+		var err error
+		if val := c.Query("from"); val != "" {
+			if since, err = time.Parse(dayFormat, val); err != nil {
+				problem.WriteDetails(c, http.StatusBadRequest, "Invalid from date", err.Error())
+				return
+			}
+		}
+		if val := c.Query("to"); val != "" {
+			if until, err = time.Parse(dayFormat, val); err != nil {
+				problem.WriteDetails(c, http.StatusBadRequest, "Invalid to date", err.Error())
+				return
+			}
+			until = until.AddDate(0, 0, 1)
+		}
+	} else {
+		days := defaultTopDownloadDays
+		if val := c.Query("days"); val != "" {
+			parsed, err := strconv.Atoi(val)
+			if err != nil || parsed < 0 {
+				problem.Write(c, http.StatusBadRequest, "Invalid days")
+				return
+			}
+			days = parsed
+		}
+		if days > 0 {
+			since = time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 1-days)
+		}
+	}
+
+	top, err := h.downloads.Top(c.Request.Context(), mediaType, since, until, limit)
+	if err != nil {
+		problem.WriteDetails(c, http.StatusInternalServerError, "Failed to get download statistics", err.Error())
+		return
+	}
+
+	body := gin.H{"downloads": top}
+	if !since.IsZero() {
+		body["from"] = since.Format(dayFormat)
+	}
+	if !until.IsZero() {
+		body["to"] = until.AddDate(0, 0, -1).Format(dayFormat)
+	}
+	c.JSON(http.StatusOK, body)
+}
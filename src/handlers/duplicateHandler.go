@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"github.com/kevinanielsen/go-fast-cdn/src/similarity"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+)
+
+const (
+	defaultDuplicateThreshold = 0.9
+	minDuplicateThreshold     = 0.5
+)
+
+// DuplicateHandler reports images that look alike.
+type DuplicateHandler struct {
+	imageRepo models.ImageRepository
+}
+
+func NewDuplicateHandler(imageRepo models.ImageRepository) *DuplicateHandler {
+	return &DuplicateHandler{imageRepo: imageRepo}
+}
+
+// duplicateImage is an image listed in a cluster of similar images.
+type duplicateImage struct {
+	UUID           string    `json:"uuid"`
+	FileName       string    `json:"file_name"`
+	URL            string    `json:"url"`
+	Size           int64     `json:"size"`
+	PerceptualHash string    `json:"perceptual_hash"`
+	OrganizationID *uint     `json:"organization_id"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type duplicateCluster struct {
+	Similarity float64          `json:"similarity"`
+	Images     []duplicateImage `json:"images"`
+}
+
+// ListDuplicates returns the clusters of images whose perceptual hashes are
+// at least as similar as the threshold query parameter, 0.9 by default.
+// Images whose hash is still being computed are counted as pending.
+func (h *DuplicateHandler) ListDuplicates(c *gin.Context) {
+	threshold := defaultDuplicateThreshold
+	if val := c.Query("threshold"); val != "" {
+		parsed, err := strconv.ParseFloat(val, 64)
+		if err != nil || parsed < minDuplicateThreshold || parsed > 1 {
+			problem.Write(c, http.StatusBadRequest, "threshold must be between "+strconv.FormatFloat(minDuplicateThreshold, 'f', -1, 64)+" and 1")
+			return
+		}
+		threshold = parsed
+	}
+
+	images, err := h.imageRepo.GetAllImages(c.Request.Context())
+	if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to fetch images")
+		return
+	}
+	pending := 0
+	for _, image := range images {
+		if image.PerceptualHash == "" {
+			pending++
+		}
+	}
+
+	baseURL := requestBaseURL(c) + "/api/cdn/download/images/"
+	clusters := []duplicateCluster{}
+	for _, cluster := range similarity.Clusters(images, threshold) {
+		result := duplicateCluster{Similarity: cluster.Similarity}
+		for _, image := range cluster.Images {
+			item := duplicateImage{
+				UUID:           image.UUID,
+				FileName:       image.FileName,
+				URL:            baseURL + image.FileName,
+				PerceptualHash: image.PerceptualHash,
+				OrganizationID: image.OrganizationID,
+				CreatedAt:      image.CreatedAt,
+			}
+			if info, err := os.Stat(filepath.Join(util.ExPath, "uploads", "images", image.FileName)); err == nil {
+				item.Size = info.Size()
+			}
+			result.Images = append(result.Images, item)
+		}
+		clusters = append(clusters, result)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"threshold": threshold,
+		"pending":   pending,
+		"clusters":  clusters,
+	})
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/events"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"golang.org/x/net/websocket"
+)
+
+// eventBuffer is the number of events queued for a slow client before it
+// misses some.
+const eventBuffer = 64
+
+type EventsHandler struct {
+	bus *events.Bus
+}
+
+func NewEventsHandler(bus *events.Bus) *EventsHandler {
+	return &EventsHandler{bus: bus}
+}
+
+// StreamEvents streams server events to the client over a WebSocket, one
+// JSON message per event, starting with the most recent ones. ?types= takes
+// a comma-separated list of type prefixes to only receive some events, e.g.
+// types=media.,auth.login.
+func (h *EventsHandler) StreamEvents(c *gin.Context) {
+	if !c.IsWebsocket() {
+		problem.Write(c, http.StatusBadRequest, "WebSocket upgrade required")
+		return
+	}
+
+	var prefixes []string
+	if types := c.Query("types"); types != "" {
+		prefixes = strings.Split(types, ",")
+	}
+	wanted := func(e events.Event) bool {
+		if len(prefixes) == 0 {
+			return true
+		}
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(e.Type, strings.TrimSpace(prefix)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	ctx := c.Request.Context()
+	// Clients authenticate with a token rather than cookies, so the origin
+	// is not checked
+	server := websocket.Server{Handler: func(ws *websocket.Conn) {
+		recent, ch, cancel := h.bus.Subscribe(eventBuffer)
+		defer cancel()
+
+		// Reading is only needed to notice the client going away
+		closed := make(chan struct{})
+		go func() {
+			io.Copy(io.Discard, ws)
+			close(closed)
+		}()
+
+		for _, e := range recent {
+			if wanted(e) {
+				if err := websocket.JSON.Send(ws, e); err != nil {
+					return
+				}
+			}
+		}
+		for {
+			select {
+			case e := <-ch:
+				if !wanted(e) {
+					continue
+				}
+				if err := websocket.JSON.Send(ws, e); err != nil {
+					return
+				}
+			case <-closed:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}}
+	server.ServeHTTP(c.Writer, c.Request)
+}
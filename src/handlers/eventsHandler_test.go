@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/events"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+)
+
+func TestEventsHandler_StreamEvents(t *testing.T) {
+	// Arrange
+	bus := events.NewBus()
+	bus.Publish(events.Event{Type: events.TypeUploaded, Target: "image/old.png"})
+	bus.Publish(events.Event{Type: "auth.login", Actor: "admin@example.com"})
+
+	r := gin.New()
+	r.GET("/events", NewEventsHandler(bus).StreamEvents)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/events", nil))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Act
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/events?types=media."
+	ws, err := websocket.Dial(url, "", server.URL)
+	require.NoError(t, err)
+	defer ws.Close()
+
+	// Assert
+	var e events.Event
+	require.NoError(t, websocket.JSON.Receive(ws, &e))
+	require.Equal(t, "image/old.png", e.Target)
+
+	// The recent events are sent after subscribing, so these are streamed
+	bus.Publish(events.Event{Type: "auth.login"})
+	bus.Publish(events.Event{Type: events.TypeDeleted, Target: "doc/new.pdf"})
+	require.NoError(t, websocket.JSON.Receive(ws, &e))
+	require.Equal(t, events.TypeDeleted, e.Type)
+	require.Equal(t, "doc/new.pdf", e.Target)
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/audit"
+	"github.com/kevinanielsen/go-fast-cdn/src/compliance"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+)
+
+type ExportHandler struct {
+	exporter *compliance.Exporter
+}
+
+func NewExportHandler(exporter *compliance.Exporter) *ExportHandler {
+	return &ExportHandler{exporter: exporter}
+}
+
+// CreateExport starts exporting an organization or a user, selected with
+// {"organization_id": 1} or {"user_id": 1}. The export runs in the
+// background; poll GetExport for its progress.
+func (h *ExportHandler) CreateExport(c *gin.Context) {
+	var req struct {
+		OrganizationID uint `json:"organization_id" binding:"required_without=UserID,excluded_with=UserID"`
+		UserID         uint `json:"user_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Invalid(c, err)
+		return
+	}
+
+	subject, subjectID := compliance.SubjectOrganization, req.OrganizationID
+	if req.UserID != 0 {
+		subject, subjectID = compliance.SubjectUser, req.UserID
+	}
+
+	job, err := h.exporter.Start(subject, subjectID, c.GetString("user_email"))
+	if errors.Is(err, compliance.ErrSubjectNotFound) {
+		problem.NotFound(c, "No "+subject+" with this ID")
+		return
+	} else if err != nil {
+		problem.WriteDetails(c, http.StatusInternalServerError, "Failed to start export", err.Error())
+		return
+	}
+	audit.Record(c, audit.ActionExportCreated, job.ID, gin.H{"subject": subject, "subject_id": subjectID})
+
+	c.JSON(http.StatusAccepted, job)
+}
+
+// ListExports returns every export, newest first
+func (h *ExportHandler) ListExports(c *gin.Context) {
+	c.JSON(http.StatusOK, h.exporter.List())
+}
+
+// GetExport returns the status and progress of an export
+func (h *ExportHandler) GetExport(c *gin.Context) {
+	job, err := h.exporter.Get(c.Param("id"))
+	if err != nil {
+		problem.NotFound(c, "Export not found")
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// CreateExportLink returns a signed link to download the bundle of a
+// finished export without logging in. It expires after EXPORT_LINK_TTL
+// seconds.
+func (h *ExportHandler) CreateExportLink(c *gin.Context) {
+	id := c.Param("id")
+	_, err := h.exporter.BundlePath(id)
+	if errors.Is(err, compliance.ErrJobNotFound) {
+		problem.NotFound(c, "Export not found")
+		return
+	} else if err != nil {
+		problem.Write(c, http.StatusConflict, "Export is not finished")
+		return
+	}
+
+	expires := time.Now().Add(compliance.LinkTTL())
+	signature := compliance.Sign(id, expires)
+	audit.Record(c, audit.ActionExportLinkCreated, id, gin.H{"expires_at": expires})
+
+	c.JSON(http.StatusOK, gin.H{
+		"url": c.Request.Host + "/api/exports/" + url.PathEscape(id) + "/download?expires=" +
+			strconv.FormatInt(expires.Unix(), 10) + "&signature=" + url.QueryEscape(signature),
+		"expires_at": expires,
+	})
+}
+
+// DownloadExport serves the bundle of an export to holders of a link from
+// CreateExportLink
+func (h *ExportHandler) DownloadExport(c *gin.Context) {
+	id := c.Param("id")
+	if !compliance.VerifySignature(id, c.Query("expires"), c.Query("signature")) {
+		problem.Write(c, http.StatusForbidden, "Invalid or expired link")
+		return
+	}
+	path, err := h.exporter.BundlePath(id)
+	if err != nil {
+		problem.NotFound(c, "Export not found")
+		return
+	}
+
+	audit.RecordUser(c, audit.ActionExportDownloaded, 0, "", id, nil)
+	c.FileAttachment(path, "export-"+id+".zip")
+}
+
+// DeleteExport removes a finished export and its bundle
+func (h *ExportHandler) DeleteExport(c *gin.Context) {
+	id := c.Param("id")
+	err := h.exporter.Delete(id)
+	if errors.Is(err, compliance.ErrJobNotFound) {
+		problem.NotFound(c, "Export not found")
+		return
+	} else if errors.Is(err, compliance.ErrJobNotDone) {
+		problem.Write(c, http.StatusConflict, "Export is still running")
+		return
+	} else if err != nil {
+		problem.WriteDetails(c, http.StatusInternalServerError, "Failed to delete export", err.Error())
+		return
+	}
+
+	audit.Record(c, audit.ActionExportDeleted, id, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Export deleted successfully"})
+}
@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"errors"
+	"image"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/audit"
+	"github.com/kevinanielsen/go-fast-cdn/src/auth"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultGalleryLimit = 100
+	maxGalleryLimit     = 500
+)
+
+// GalleryHandler manages galleries and serves them to the public.
+type GalleryHandler struct {
+	galleryRepo models.GalleryRepository
+	imageRepo   models.ImageRepository
+	docRepo     models.DocRepository
+}
+
+func NewGalleryHandler(galleryRepo models.GalleryRepository, imageRepo models.ImageRepository, docRepo models.DocRepository) *GalleryHandler {
+	return &GalleryHandler{galleryRepo: galleryRepo, imageRepo: imageRepo, docRepo: docRepo}
+}
+
+type galleryRequest struct {
+	Slug           string `json:"slug" binding:"required,max=100"`
+	Title          string `json:"title"`
+	Description    string `json:"description"`
+	MediaType      string `json:"media_type" binding:"omitempty,oneof=image doc"`
+	OrganizationID *uint  `json:"organization_id"`
+}
+
+func (req *galleryRequest) apply(gallery *models.Gallery) {
+	gallery.Slug = req.Slug
+	gallery.Title = req.Title
+	gallery.Description = req.Description
+	gallery.MediaType = req.MediaType
+	if gallery.MediaType == "" {
+		gallery.MediaType = models.MediaTypeImage
+	}
+	gallery.OrganizationID = req.OrganizationID
+}
+
+// galleryItem is a file listed by a public gallery.
+type galleryItem struct {
+	UUID        string    `json:"uuid"`
+	FileName    string    `json:"file_name"`
+	URL         string    `json:"url"`
+	MimeType    string    `json:"mime_type,omitempty"`
+	Width       int       `json:"width,omitempty"`
+	Height      int       `json:"height,omitempty"`
+	Title       string    `json:"title,omitempty"`
+	AltText     string    `json:"alt_text,omitempty"`
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ListGalleries returns all galleries
+func (h *GalleryHandler) ListGalleries(c *gin.Context) {
+	galleries, err := h.galleryRepo.GetAllGalleries(c.Request.Context())
+	if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to fetch galleries")
+		return
+	}
+	c.JSON(http.StatusOK, galleries)
+}
+
+// CreateGallery publishes a folder as a new gallery
+func (h *GalleryHandler) CreateGallery(c *gin.Context) {
+	var req galleryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Invalid(c, err)
+		return
+	}
+	if !validSlug(req.Slug) {
+		problem.InvalidFields(c, problem.FieldError{Field: "slug", Rule: "slug", Message: "must consist of lowercase letters, digits and single hyphens"})
+		return
+	}
+	if existing, _ := h.galleryRepo.GetGalleryBySlug(c.Request.Context(), req.Slug); existing != nil {
+		problem.Write(c, http.StatusConflict, "Gallery already exists")
+		return
+	}
+	gallery := &models.Gallery{}
+	req.apply(gallery)
+	if err := h.galleryRepo.CreateGallery(c.Request.Context(), gallery); err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to create gallery")
+		return
+	}
+
+	audit.Record(c, audit.ActionGalleryUpdated, "gallery/"+gallery.Slug, gallery)
+	c.JSON(http.StatusCreated, gallery)
+}
+
+// UpdateGallery replaces the settings of an existing gallery
+func (h *GalleryHandler) UpdateGallery(c *gin.Context) {
+	gallery, err := h.galleryRepo.GetGalleryBySlug(c.Request.Context(), c.Param("slug"))
+	if err != nil {
+		problem.NotFound(c, "Gallery not found")
+		return
+	}
+	var req galleryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Invalid(c, err)
+		return
+	}
+	if !validSlug(req.Slug) {
+		problem.InvalidFields(c, problem.FieldError{Field: "slug", Rule: "slug", Message: "must consist of lowercase letters, digits and single hyphens"})
+		return
+	}
+	if req.Slug != gallery.Slug {
+		if existing, _ := h.galleryRepo.GetGalleryBySlug(c.Request.Context(), req.Slug); existing != nil {
+			problem.Write(c, http.StatusConflict, "Gallery already exists")
+			return
+		}
+	}
+	req.apply(gallery)
+	if err := h.galleryRepo.UpdateGallery(c.Request.Context(), gallery); err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to update gallery")
+		return
+	}
+
+	audit.Record(c, audit.ActionGalleryUpdated, "gallery/"+gallery.Slug, gallery)
+	c.JSON(http.StatusOK, gallery)
+}
+
+// DeleteGallery unpublishes a gallery
+func (h *GalleryHandler) DeleteGallery(c *gin.Context) {
+	slug := c.Param("slug")
+	err := h.galleryRepo.DeleteGallery(c.Request.Context(), slug)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		problem.NotFound(c, "Gallery not found")
+		return
+	} else if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to delete gallery")
+		return
+	}
+
+	audit.Record(c, audit.ActionGalleryUpdated, "gallery/"+slug, gin.H{"deleted": true})
+	c.JSON(http.StatusOK, gin.H{"message": "Gallery deleted"})
+}
+
+// HandlePublicGallery lists the files of a gallery without authentication,
+// newest first, with absolute URLs so other sites can render them. ?limit=
+// (100 by default, at most 500) and ?offset= page through the files. Files
+// that expired or are not approved are left out.
+func (h *GalleryHandler) HandlePublicGallery(c *gin.Context) {
+	gallery, err := h.galleryRepo.GetGalleryBySlug(c.Request.Context(), c.Param("slug"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		problem.NotFound(c, "Gallery not found")
+		return
+	} else if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to fetch gallery")
+		return
+	}
+
+	limit, offset := defaultGalleryLimit, 0
+	if val := c.Query("limit"); val != "" {
+		parsed, err := strconv.Atoi(val)
+		if err != nil || parsed < 1 || parsed > maxGalleryLimit {
+			problem.Write(c, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxGalleryLimit))
+			return
+		}
+		limit = parsed
+	}
+	if val := c.Query("offset"); val != "" {
+		parsed, err := strconv.Atoi(val)
+		if err != nil || parsed < 0 {
+			problem.Write(c, http.StatusBadRequest, "offset must not be negative")
+			return
+		}
+		offset = parsed
+	}
+
+	items, err := h.galleryItems(c, gallery)
+	if err != nil {
+		log.Printf("Failed to list gallery %s: %s\n", gallery.Slug, err.Error())
+		problem.Write(c, http.StatusInternalServerError, "Failed to list gallery")
+		return
+	}
+	total := len(items)
+	items = items[min(offset, total):min(offset+limit, total)]
+
+	folder := models.MediaFolder(gallery.MediaType)
+	for i := range items {
+		if gallery.MediaType != models.MediaTypeImage {
+			continue
+		}
+		if file, err := os.Open(filepath.Join(util.ExPath, "uploads", folder, items[i].FileName)); err == nil {
+			if config, _, err := image.DecodeConfig(file); err == nil {
+				items[i].Width, items[i].Height = config.Width, config.Height
+			}
+			file.Close()
+		}
+	}
+
+	c.Header("Cache-Control", "public, max-age=60")
+	c.JSON(http.StatusOK, gin.H{
+		"slug":        gallery.Slug,
+		"title":       gallery.Title,
+		"description": gallery.Description,
+		"media_type":  gallery.MediaType,
+		"total":       total,
+		"items":       items,
+	})
+}
+
+// galleryItems returns every file listed by gallery, newest first, without
+// dimensions.
+func (h *GalleryHandler) galleryItems(c *gin.Context, gallery *models.Gallery) ([]galleryItem, error) {
+	baseURL := requestBaseURL(c) + "/api/cdn/download/" + models.MediaFolder(gallery.MediaType) + "/"
+	now := time.Now()
+	listed := func(orgID *uint, moderationStatus string, expiresAt *time.Time) bool {
+		if gallery.OrganizationID != nil && (orgID == nil || *orgID != *gallery.OrganizationID) {
+			return false
+		}
+		return models.ModerationApproved(moderationStatus) && (expiresAt == nil || expiresAt.After(now))
+	}
+
+	var items []galleryItem
+	ctx := c.Request.Context()
+	if gallery.MediaType == models.MediaTypeDoc {
+		docs, err := h.docRepo.GetAllDocs(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range docs {
+			if listed(d.OrganizationID, d.ModerationStatus, d.ExpiresAt) {
+				items = append(items, galleryItem{
+					UUID: d.UUID, FileName: d.FileName, URL: baseURL + d.FileName, MimeType: d.MimeType,
+					Title: d.Title, AltText: d.AltText, Description: d.Description, CreatedAt: d.CreatedAt,
+				})
+			}
+		}
+	} else {
+		images, err := h.imageRepo.GetAllImages(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, i := range images {
+			if listed(i.OrganizationID, i.ModerationStatus, i.ExpiresAt) {
+				items = append(items, galleryItem{
+					UUID: i.UUID, FileName: i.FileName, URL: baseURL + i.FileName, MimeType: i.MimeType,
+					Title: i.Title, AltText: i.AltText, Description: i.Description, CreatedAt: i.CreatedAt,
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(items, func(a, b int) bool { return items[a].CreatedAt.After(items[b].CreatedAt) })
+	return items, nil
+}
+
+// requestBaseURL returns the scheme and host the request was sent to, e.g.
+// https://cdn.example.com.
+func requestBaseURL(c *gin.Context) string {
+	scheme := "http"
+	if auth.IsHTTPS(c) {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+// validSlug reports whether slug is non-empty and unchanged by util.Slugify.
+func validSlug(slug string) bool {
+	return slug != "" && util.Slugify(slug) == slug
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGalleryHandler(t *testing.T) {
+	// Arrange
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	db := database.DB
+	imageDir := filepath.Join(util.ExPath, "uploads", "images")
+	require.NoError(t, os.MkdirAll(imageDir, 0o755))
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 3))))
+
+	org := models.Organization{Name: "Acme"}
+	require.NoError(t, db.Create(&org).Error)
+	past := time.Now().Add(-time.Hour)
+	for i, img := range []models.Image{
+		{FileName: "old.png", MediaMetadata: models.MediaMetadata{AltText: "Old logo"}},
+		{FileName: "new.png", MediaMetadata: models.MediaMetadata{Title: "New", AltText: "New logo"}},
+		{FileName: "rejected.png", ModerationStatus: models.ModerationStatusRejected},
+		{FileName: "expired.png", ExpiresAt: &past},
+		{FileName: "other.png", OrganizationID: new(uint)},
+	} {
+		img.Checksum = []byte(img.FileName)
+		img.CreatedAt = time.Now().Add(time.Duration(i) * time.Minute)
+		if img.OrganizationID == nil {
+			img.OrganizationID = &org.ID
+		}
+		require.NoError(t, db.Create(&img).Error)
+		require.NoError(t, os.WriteFile(filepath.Join(imageDir, img.FileName), buf.Bytes(), 0o644))
+	}
+
+	h := NewGalleryHandler(database.NewGalleryRepo(db), database.NewImageRepo(db), database.NewDocRepo(db))
+	r := gin.New()
+	r.POST("/admin/galleries", h.CreateGallery)
+	r.GET("/public/galleries/:slug", h.HandlePublicGallery)
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	// Act & Assert
+	require.Equal(t, http.StatusNotFound, request(http.MethodGet, "/public/galleries/logos", "").Code)
+	require.Equal(t, http.StatusBadRequest, request(http.MethodPost, "/admin/galleries", `{"slug": "Our Logos"}`).Code)
+	require.Equal(t, http.StatusCreated, request(http.MethodPost, "/admin/galleries", `{"slug": "logos", "title": "Logos", "organization_id": 1}`).Code)
+	require.Equal(t, http.StatusConflict, request(http.MethodPost, "/admin/galleries", `{"slug": "logos"}`).Code)
+
+	w := request(http.MethodGet, "/public/galleries/logos", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Title string        `json:"title"`
+		Total int           `json:"total"`
+		Items []galleryItem `json:"items"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Equal(t, "Logos", resp.Title)
+	require.Equal(t, 2, resp.Total)
+	require.Equal(t, "new.png", resp.Items[0].FileName)
+	require.Equal(t, "http://example.com/api/cdn/download/images/new.png", resp.Items[0].URL)
+	require.Equal(t, "New logo", resp.Items[0].AltText)
+	require.Equal(t, 4, resp.Items[0].Width)
+	require.Equal(t, 3, resp.Items[0].Height)
+
+	w = request(http.MethodGet, "/public/galleries/logos?limit=1&offset=1", "")
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Equal(t, 2, resp.Total)
+	require.Len(t, resp.Items, 1)
+	require.Equal(t, "old.png", resp.Items[0].FileName)
+	require.Equal(t, http.StatusBadRequest, request(http.MethodGet, "/public/galleries/logos?limit=0", "").Code)
+}
@@ -1,31 +1,22 @@
 package handlers
 
 import (
-	"log"
 	"net/http"
-	"os"
-	"path/filepath"
 
 	"github.com/gin-gonic/gin"
-	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/kevinanielsen/go-fast-cdn/src/diskspace"
+	"github.com/kevinanielsen/go-fast-cdn/src/usage"
 )
 
 func GetSizeHandler(c *gin.Context) {
-	var cdnSize int64
-
-	err := filepath.Walk(util.ExPath+"/uploads",
-		func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return err
-			}
-			cdnSize += info.Size()
-			return nil
-		})
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, err)
-		log.Println(err)
-		return
-	}
+	c.JSON(http.StatusOK, gin.H{"cdn_size_bytes": usage.Snapshot().TotalBytes})
+}
 
-	c.JSON(200, gin.H{"cdn_size_bytes": cdnSize})
+// GetUsage returns the storage used per uploads folder and organization, and
+// the space of the uploads volume
+func GetUsage(c *gin.Context) {
+	c.JSON(http.StatusOK, struct {
+		usage.Usage
+		Disk *diskspace.Usage `json:"disk"`
+	}{usage.Snapshot(), diskspace.Default.Usage()})
 }
@@ -0,0 +1,687 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/graph-gophers/graphql-go"
+	"github.com/kevinanielsen/go-fast-cdn/src/acl"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 100
+	// maxQueryDepth is the deepest nesting of fields a query may select, so
+	// nested relations cannot make a single request arbitrarily expensive.
+	maxQueryDepth = 12
+)
+
+const graphSchema = `
+schema {
+	query: Query
+}
+
+scalar Time
+
+type Query {
+	media(type: String, search: String, organizationId: ID, first: Int, after: String): MediaConnection
+	image(fileName: String!): Media
+	doc(fileName: String!): Media
+	mediaByUuid(uuid: ID!): Media
+	folders: [Folder!]
+	# Only admins may list organizations.
+	organizations: [Organization!]
+	organization(id: ID!): Organization
+	# Only admins may list users.
+	users(role: String, search: String, first: Int, after: String): UserConnection
+	me: User
+}
+
+type Media {
+	id: ID!
+	uuid: String!
+	type: String!
+	fileName: String!
+	originalName: String!
+	mimeType: String!
+	url: String!
+	version: String!
+	integrityStatus: String!
+	expiresAt: Time
+	createdAt: Time!
+	updatedAt: Time!
+	folder: Folder!
+	organization: Organization
+	related: [RelatedMedia!]
+}
+
+type RelatedMedia {
+	id: ID!
+	relation: String!
+	direction: String!
+	type: String!
+	fileName: String!
+	media: Media
+}
+
+type Folder {
+	name: String!
+	type: String!
+	mediaCount: Int
+	media(search: String, first: Int, after: String): MediaConnection
+}
+
+type Organization {
+	id: ID!
+	name: String!
+	createdAt: Time!
+	media(type: String, search: String, first: Int, after: String): MediaConnection
+}
+
+type User {
+	id: ID!
+	email: String!
+	role: String!
+	isVerified: Boolean!
+	is2faEnabled: Boolean!
+	lastLogin: Time
+	createdAt: Time!
+}
+
+type MediaConnection {
+	totalCount: Int!
+	nodes: [Media!]!
+	pageInfo: PageInfo!
+}
+
+type UserConnection {
+	totalCount: Int!
+	nodes: [User!]!
+	pageInfo: PageInfo!
+}
+
+type PageInfo {
+	hasNextPage: Boolean!
+	endCursor: String
+}
+`
+
+// GraphQLHandler answers GraphQL queries for media, folders, organizations
+// and users, so clients can fetch nested data in a single request.
+//
+// Queries are executed by graphql-go rather than gqlgen: graphql-go binds
+// graphSchema to the resolver methods below when the handler is created,
+// while gqlgen generates an executor of several thousand lines from the
+// schema, which would have to be regenerated and checked in with every
+// schema change.
+type GraphQLHandler struct {
+	imageRepo    models.ImageRepository
+	docRepo      models.DocRepository
+	relationRepo models.MediaRelationRepository
+	userRepo     models.UserRepository
+	orgRepo      models.OrganizationRepository
+	schema       *graphql.Schema
+}
+
+func NewGraphQLHandler(imageRepo models.ImageRepository, docRepo models.DocRepository, relationRepo models.MediaRelationRepository, userRepo models.UserRepository, orgRepo models.OrganizationRepository) *GraphQLHandler {
+	return &GraphQLHandler{
+		imageRepo:    imageRepo,
+		docRepo:      docRepo,
+		relationRepo: relationRepo,
+		userRepo:     userRepo,
+		orgRepo:      orgRepo,
+		schema:       graphql.MustParseSchema(graphSchema, &graphQuery{}, graphql.MaxDepth(maxQueryDepth)),
+	}
+}
+
+// Query executes a GraphQL query. Invalid queries are answered with 400 and
+// the errors, the others with 200 and the data, next to the errors of single
+// fields if any.
+func (h *GraphQLHandler) Query(c *gin.Context) {
+	var req struct {
+		Query         string         `json:"query" binding:"required"`
+		OperationName string         `json:"operationName"`
+		Variables     map[string]any `json:"variables"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Invalid(c, err)
+		return
+	}
+
+	r := &graphRequest{h: h, c: c, orgs: map[uint]*models.Organization{}, readable: map[string]bool{}}
+	ctx := context.WithValue(c.Request.Context(), graphRequestKey{}, r)
+	resp := h.schema.Exec(ctx, req.Query, req.OperationName, req.Variables)
+	if resp.Data == nil {
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// graphMedia is an image or document as the GraphQL API shows it.
+type graphMedia struct {
+	Type            string
+	ID              uint
+	UUID            string
+	FileName        string
+	OriginalName    string
+	MimeType        string
+	IntegrityStatus string
+	OrganizationID  *uint
+	ExpiresAt       *time.Time
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+// graphRequestKey is the context key of the graphRequest a query runs in.
+type graphRequestKey struct{}
+
+// graphRequest resolves the queries of a single request, loading each list
+// at most once. Media in folders the request may not read are left out.
+// Fields are resolved concurrently, so the lists are guarded by mu.
+type graphRequest struct {
+	h        *GraphQLHandler
+	c        *gin.Context
+	mu       sync.Mutex
+	media    []graphMedia
+	orgs     map[uint]*models.Organization
+	readable map[string]bool
+}
+
+// pageArgs select a page of a list, see paginate.
+type pageArgs struct {
+	First *int32
+	After *string
+}
+
+// graphID is an ID argument. Unlike graphql.ID it also accepts integers in
+// variables, which arrive as JSON numbers.
+type graphID string
+
+func (graphID) ImplementsGraphQLType(name string) bool {
+	return name == "ID"
+}
+
+func (id *graphID) UnmarshalGraphQL(input any) error {
+	switch input := input.(type) {
+	case string:
+		*id = graphID(input)
+	case int32:
+		*id = graphID(strconv.Itoa(int(input)))
+	case float64:
+		if input != math.Trunc(input) {
+			return fmt.Errorf("ID %v is not an integer", input)
+		}
+		*id = graphID(strconv.FormatFloat(input, 'f', -1, 64))
+	default:
+		return fmt.Errorf("wrong type for ID: %T", input)
+	}
+	return nil
+}
+
+// graphQuery resolves the fields of Query for the graphRequest in the
+// context.
+type graphQuery struct{}
+
+func requestOf(ctx context.Context) *graphRequest {
+	return ctx.Value(graphRequestKey{}).(*graphRequest)
+}
+
+func (graphQuery) Media(ctx context.Context, args struct {
+	Type, Search   *string
+	OrganizationID *graphID
+	pageArgs
+}) (*connection[*mediaResolver], error) {
+	var orgID *uint
+	if args.OrganizationID != nil {
+		parsed, err := strconv.ParseUint(string(*args.OrganizationID), 10, 0)
+		if err != nil {
+			return nil, errors.New("invalid organization ID")
+		}
+		value := uint(parsed)
+		orgID = &value
+	}
+	r := requestOf(ctx)
+	all, err := r.filterMedia(deref(args.Type), deref(args.Search), orgID)
+	if err != nil {
+		return nil, err
+	}
+	return paginate(r.mediaResolvers(all), args.pageArgs)
+}
+
+func (graphQuery) Image(ctx context.Context, args struct{ FileName string }) (*mediaResolver, error) {
+	return requestOf(ctx).findMedia(func(m graphMedia) bool { return m.Type == models.MediaTypeImage && m.FileName == args.FileName })
+}
+
+func (graphQuery) Doc(ctx context.Context, args struct{ FileName string }) (*mediaResolver, error) {
+	return requestOf(ctx).findMedia(func(m graphMedia) bool { return m.Type == models.MediaTypeDoc && m.FileName == args.FileName })
+}
+
+func (graphQuery) MediaByUUID(ctx context.Context, args struct{ UUID graphID }) (*mediaResolver, error) {
+	return requestOf(ctx).findMedia(func(m graphMedia) bool { return m.UUID == string(args.UUID) })
+}
+
+func (graphQuery) Folders(ctx context.Context) (*[]*folderResolver, error) {
+	r := requestOf(ctx)
+	folders := []*folderResolver{}
+	for _, mediaType := range []string{models.MediaTypeImage, models.MediaTypeDoc} {
+		readable, err := r.folderReadable(mediaType)
+		if err != nil {
+			return nil, err
+		}
+		if readable {
+			folders = append(folders, &folderResolver{r: r, mediaType: mediaType})
+		}
+	}
+	return &folders, nil
+}
+
+func (graphQuery) Organizations(ctx context.Context) (*[]*organizationResolver, error) {
+	r := requestOf(ctx)
+	if err := r.requireAdmin(); err != nil {
+		return nil, err
+	}
+	orgs, err := r.h.orgRepo.GetAllOrganizations(ctx)
+	if err != nil {
+		return nil, errors.New("failed to fetch organizations")
+	}
+	nodes := make([]*organizationResolver, len(orgs))
+	for i := range orgs {
+		nodes[i] = &organizationResolver{r: r, org: &orgs[i]}
+	}
+	return &nodes, nil
+}
+
+func (graphQuery) Organization(ctx context.Context, args struct{ ID graphID }) (*organizationResolver, error) {
+	id, err := strconv.ParseUint(string(args.ID), 10, 0)
+	if err != nil {
+		return nil, errors.New("invalid organization ID")
+	}
+	orgID := uint(id)
+	return requestOf(ctx).organization(&orgID)
+}
+
+func (graphQuery) Users(ctx context.Context, args struct {
+	Role, Search *string
+	pageArgs
+}) (*connection[*userResolver], error) {
+	r := requestOf(ctx)
+	if err := r.requireAdmin(); err != nil {
+		return nil, err
+	}
+	users, err := r.h.userRepo.GetAllUsers(ctx)
+	if err != nil {
+		return nil, errors.New("failed to fetch users")
+	}
+	role, search := deref(args.Role), strings.ToLower(deref(args.Search))
+	var matching []*userResolver
+	for _, u := range users {
+		if (role == "" || u.Role == role) && strings.Contains(strings.ToLower(u.Email), search) {
+			matching = append(matching, &userResolver{u})
+		}
+	}
+	return paginate(matching, args.pageArgs)
+}
+
+func (graphQuery) Me(ctx context.Context) *userResolver {
+	if u, ok := requestOf(ctx).c.Get("user"); ok {
+		return &userResolver{*u.(*models.User)}
+	}
+	return nil
+}
+
+type mediaResolver struct {
+	r *graphRequest
+	m graphMedia
+}
+
+func (m *mediaResolver) ID() graphql.ID          { return graphql.ID(strconv.FormatUint(uint64(m.m.ID), 10)) }
+func (m *mediaResolver) UUID() string            { return m.m.UUID }
+func (m *mediaResolver) Type() string            { return m.m.Type }
+func (m *mediaResolver) FileName() string        { return m.m.FileName }
+func (m *mediaResolver) OriginalName() string    { return m.m.OriginalName }
+func (m *mediaResolver) MimeType() string        { return m.m.MimeType }
+func (m *mediaResolver) Version() string         { return models.MediaVersion(m.m.UpdatedAt) }
+func (m *mediaResolver) IntegrityStatus() string { return m.m.IntegrityStatus }
+func (m *mediaResolver) ExpiresAt() *graphql.Time {
+	if m.m.ExpiresAt == nil {
+		return nil
+	}
+	return &graphql.Time{Time: *m.m.ExpiresAt}
+}
+func (m *mediaResolver) CreatedAt() graphql.Time { return graphql.Time{Time: m.m.CreatedAt} }
+func (m *mediaResolver) UpdatedAt() graphql.Time { return graphql.Time{Time: m.m.UpdatedAt} }
+
+func (m *mediaResolver) URL() string {
+	return "/api/cdn/download/" + models.MediaFolder(m.m.Type) + "/" + m.m.FileName
+}
+
+func (m *mediaResolver) Folder() *folderResolver {
+	return &folderResolver{r: m.r, mediaType: m.m.Type}
+}
+
+func (m *mediaResolver) Organization() (*organizationResolver, error) {
+	return m.r.organization(m.m.OrganizationID)
+}
+
+func (m *mediaResolver) Related(ctx context.Context) (*[]*relatedResolver, error) {
+	relations, err := m.r.h.relationRepo.GetRelated(ctx, m.m.Type, m.m.ID)
+	if err != nil {
+		log.Printf("Failed to get related media for %s/%s: %s\n", m.m.Type, m.m.FileName, err.Error())
+		return nil, errors.New("failed to get related media")
+	}
+	nodes := []*relatedResolver{}
+	for _, relation := range relations {
+		readable, err := m.r.folderReadable(relation.Type)
+		if err != nil {
+			return nil, err
+		}
+		if readable {
+			nodes = append(nodes, &relatedResolver{r: m.r, rel: relation})
+		}
+	}
+	return &nodes, nil
+}
+
+// relatedResolver is a related media, see models.RelatedMedia.
+type relatedResolver struct {
+	r   *graphRequest
+	rel models.RelatedMedia
+}
+
+func (rel *relatedResolver) ID() graphql.ID {
+	return graphql.ID(strconv.FormatUint(uint64(rel.rel.ID), 10))
+}
+func (rel *relatedResolver) Relation() string  { return rel.rel.Relation }
+func (rel *relatedResolver) Direction() string { return rel.rel.Direction }
+func (rel *relatedResolver) Type() string      { return rel.rel.Type }
+func (rel *relatedResolver) FileName() string  { return rel.rel.FileName }
+
+func (rel *relatedResolver) Media() (*mediaResolver, error) {
+	return rel.r.findMedia(func(m graphMedia) bool { return m.Type == rel.rel.Type && m.FileName == rel.rel.FileName })
+}
+
+// folderResolver is one of the uploads folders.
+type folderResolver struct {
+	r         *graphRequest
+	mediaType string
+}
+
+func (f *folderResolver) Name() string { return models.MediaFolder(f.mediaType) }
+func (f *folderResolver) Type() string { return f.mediaType }
+
+func (f *folderResolver) MediaCount() (*int32, error) {
+	all, err := f.r.filterMedia(f.mediaType, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	count := int32(len(all))
+	return &count, nil
+}
+
+func (f *folderResolver) Media(args struct {
+	Search *string
+	pageArgs
+}) (*connection[*mediaResolver], error) {
+	all, err := f.r.filterMedia(f.mediaType, deref(args.Search), nil)
+	if err != nil {
+		return nil, err
+	}
+	return paginate(f.r.mediaResolvers(all), args.pageArgs)
+}
+
+type organizationResolver struct {
+	r   *graphRequest
+	org *models.Organization
+}
+
+func (o *organizationResolver) ID() graphql.ID {
+	return graphql.ID(strconv.FormatUint(uint64(o.org.ID), 10))
+}
+func (o *organizationResolver) Name() string            { return o.org.Name }
+func (o *organizationResolver) CreatedAt() graphql.Time { return graphql.Time{Time: o.org.CreatedAt} }
+
+func (o *organizationResolver) Media(args struct {
+	Type, Search *string
+	pageArgs
+}) (*connection[*mediaResolver], error) {
+	all, err := o.r.filterMedia(deref(args.Type), deref(args.Search), &o.org.ID)
+	if err != nil {
+		return nil, err
+	}
+	return paginate(o.r.mediaResolvers(all), args.pageArgs)
+}
+
+type userResolver struct {
+	u models.User
+}
+
+func (u *userResolver) ID() graphql.ID          { return graphql.ID(strconv.FormatUint(uint64(u.u.ID), 10)) }
+func (u *userResolver) Email() string           { return u.u.Email }
+func (u *userResolver) Role() string            { return u.u.Role }
+func (u *userResolver) IsVerified() bool        { return u.u.IsVerified }
+func (u *userResolver) Is2faEnabled() bool      { return u.u.Is2FAEnabled != nil && *u.u.Is2FAEnabled }
+func (u *userResolver) CreatedAt() graphql.Time { return graphql.Time{Time: u.u.CreatedAt} }
+
+func (u *userResolver) LastLogin() *graphql.Time {
+	if u.u.LastLogin == nil {
+		return nil
+	}
+	return &graphql.Time{Time: *u.u.LastLogin}
+}
+
+// connection is a page of a list.
+type connection[T any] struct {
+	nodes       []T
+	totalCount  int
+	hasNextPage bool
+	endCursor   *string
+}
+
+func (page *connection[T]) TotalCount() int32        { return int32(page.totalCount) }
+func (page *connection[T]) Nodes() []T               { return page.nodes }
+func (page *connection[T]) PageInfo() *connection[T] { return page }
+func (page *connection[T]) HasNextPage() bool        { return page.hasNextPage }
+func (page *connection[T]) EndCursor() *string       { return page.endCursor }
+
+func (r *graphRequest) requireAdmin() error {
+	if r.c.GetString("user_role") != "admin" {
+		return errors.New("admin access required")
+	}
+	return nil
+}
+
+// folderReadable reports whether the request may read the folder of
+// mediaType, see acl.Readable.
+func (r *graphRequest) folderReadable(mediaType string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.folderReadableLocked(mediaType)
+}
+
+func (r *graphRequest) folderReadableLocked(mediaType string) (bool, error) {
+	if readable, ok := r.readable[mediaType]; ok {
+		return readable, nil
+	}
+	readable, err := acl.Readable(r.c, models.MediaFolder(mediaType))
+	if err != nil {
+		log.Printf("Failed to check the access to the %s folder: %s\n", models.MediaFolder(mediaType), err.Error())
+		return false, errors.New("failed to check folder permissions")
+	}
+	r.readable[mediaType] = readable
+	return readable, nil
+}
+
+// allMedia returns the images and documents in the folders the request may
+// read, newest first.
+func (r *graphRequest) allMedia() ([]graphMedia, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.media != nil {
+		return r.media, nil
+	}
+	ctx := r.c.Request.Context()
+	var images []models.Image
+	var docs []models.Doc
+	if readable, err := r.folderReadableLocked(models.MediaTypeImage); err != nil {
+		return nil, err
+	} else if readable {
+		if images, err = r.h.imageRepo.GetAllImages(ctx); err != nil {
+			log.Printf("Failed to list images: %s\n", err.Error())
+			return nil, errors.New("failed to list images")
+		}
+	}
+	if readable, err := r.folderReadableLocked(models.MediaTypeDoc); err != nil {
+		return nil, err
+	} else if readable {
+		if docs, err = r.h.docRepo.GetAllDocs(ctx); err != nil {
+			log.Printf("Failed to list documents: %s\n", err.Error())
+			return nil, errors.New("failed to list documents")
+		}
+	}
+
+	all := make([]graphMedia, 0, len(images)+len(docs))
+	for _, i := range images {
+		all = append(all, graphMedia{
+			Type: models.MediaTypeImage, ID: i.ID, UUID: i.UUID, FileName: i.FileName, OriginalName: i.OriginalName,
+			MimeType: i.MimeType, IntegrityStatus: i.IntegrityStatus,
+			OrganizationID: i.OrganizationID, ExpiresAt: i.ExpiresAt, CreatedAt: i.CreatedAt, UpdatedAt: i.UpdatedAt,
+		})
+	}
+	for _, d := range docs {
+		all = append(all, graphMedia{
+			Type: models.MediaTypeDoc, ID: d.ID, UUID: d.UUID, FileName: d.FileName, OriginalName: d.OriginalName,
+			MimeType: d.MimeType, IntegrityStatus: d.IntegrityStatus,
+			OrganizationID: d.OrganizationID, ExpiresAt: d.ExpiresAt, CreatedAt: d.CreatedAt, UpdatedAt: d.UpdatedAt,
+		})
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].CreatedAt.After(all[j].CreatedAt) })
+	r.media = all
+	return all, nil
+}
+
+// filterMedia returns the media of the given type, whose names contain search
+// and which belong to the organization, each filter applying unless empty.
+func (r *graphRequest) filterMedia(mediaType, search string, orgID *uint) ([]graphMedia, error) {
+	all, err := r.allMedia()
+	if err != nil {
+		return nil, err
+	}
+	search = strings.ToLower(search)
+	matching := []graphMedia{}
+	for _, m := range all {
+		if mediaType != "" && m.Type != mediaType {
+			continue
+		}
+		if orgID != nil && (m.OrganizationID == nil || *m.OrganizationID != *orgID) {
+			continue
+		}
+		if !strings.Contains(strings.ToLower(m.FileName), search) && !strings.Contains(strings.ToLower(m.OriginalName), search) {
+			continue
+		}
+		matching = append(matching, m)
+	}
+	return matching, nil
+}
+
+func (r *graphRequest) mediaResolvers(media []graphMedia) []*mediaResolver {
+	resolvers := make([]*mediaResolver, len(media))
+	for i, m := range media {
+		resolvers[i] = &mediaResolver{r: r, m: m}
+	}
+	return resolvers
+}
+
+// findMedia returns the first media matching, or nil.
+func (r *graphRequest) findMedia(match func(graphMedia) bool) (*mediaResolver, error) {
+	all, err := r.allMedia()
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range all {
+		if match(m) {
+			return &mediaResolver{r: r, m: m}, nil
+		}
+	}
+	return nil, nil
+}
+
+// organization returns the organization with the given ID, or nil.
+func (r *graphRequest) organization(id *uint) (*organizationResolver, error) {
+	if id == nil {
+		return nil, nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	org, ok := r.orgs[*id]
+	if !ok {
+		var err error
+		org, err = r.h.orgRepo.GetOrganizationByID(r.c.Request.Context(), *id)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			org = nil
+		} else if err != nil {
+			return nil, errors.New("failed to fetch organization")
+		}
+		r.orgs[*id] = org
+	}
+	if org == nil {
+		return nil, nil
+	}
+	return &organizationResolver{r: r, org: org}, nil
+}
+
+// paginate returns the page of items selected by the first and after
+// arguments. Cursors are opaque positions in the list.
+func paginate[T any](items []T, args pageArgs) (*connection[T], error) {
+	first := defaultPageSize
+	if args.First != nil {
+		first = int(*args.First)
+	}
+	if first < 0 || first > maxPageSize {
+		return nil, errors.New("first must be between 0 and " + strconv.Itoa(maxPageSize))
+	}
+
+	start := 0
+	if after := deref(args.After); after != "" {
+		decoded, err := base64.RawURLEncoding.DecodeString(after)
+		if err != nil {
+			return nil, errors.New("invalid cursor")
+		}
+		position, err := strconv.Atoi(strings.TrimPrefix(string(decoded), "cursor:"))
+		if err != nil || position < 0 {
+			return nil, errors.New("invalid cursor")
+		}
+		start = min(position+1, len(items))
+	}
+	end := min(start+first, len(items))
+
+	page := &connection[T]{nodes: append([]T{}, items[start:end]...), totalCount: len(items), hasNextPage: end < len(items)}
+	if end > start {
+		cursor := base64.RawURLEncoding.EncodeToString([]byte("cursor:" + strconv.Itoa(end-1)))
+		page.endCursor = &cursor
+	}
+	return page, nil
+}
+
+// deref returns the value of an optional string argument, or "" if it is
+// not given.
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/acl"
+	"github.com/kevinanielsen/go-fast-cdn/src/auth"
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGraphQLHandler_Query(t *testing.T) {
+	// Arrange
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	db := database.DB
+	org := models.Organization{Name: "Acme"}
+	require.NoError(t, db.Create(&org).Error)
+	require.NoError(t, db.Create(&models.Image{FileName: "logo.png", Checksum: []byte("a"), OrganizationID: &org.ID}).Error)
+	require.NoError(t, db.Create(&models.Image{FileName: "cat.png", Checksum: []byte("b")}).Error)
+	require.NoError(t, db.Create(&models.Doc{FileName: "report.pdf", Checksum: []byte("c"), OrganizationID: &org.ID}).Error)
+	require.NoError(t, db.Create(&models.User{Email: "admin@example.com", PasswordHash: "x", Role: "admin"}).Error)
+
+	h := NewGraphQLHandler(
+		database.NewImageRepo(db),
+		database.NewDocRepo(db),
+		database.NewMediaRelationRepo(db),
+		database.NewUserRepo(db),
+		database.NewOrganizationRepo(db),
+	)
+	query := func(role, body string) (int, map[string]any) {
+		r := gin.New()
+		r.POST("/graphql", func(c *gin.Context) {
+			c.Set("user_role", role)
+			h.Query(c)
+		})
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(body)))
+		var resp map[string]any
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return w.Code, resp
+	}
+
+	// Act & Assert
+	code, resp := query("user", `{"query": "query($org: ID) { media(organizationId: $org, first: 1) { totalCount nodes { type organization { name } } pageInfo { hasNextPage endCursor } } }", "variables": {"org": 1}}`)
+	require.Equal(t, http.StatusOK, code)
+	require.Nil(t, resp["errors"])
+	page := resp["data"].(map[string]any)["media"].(map[string]any)
+	require.EqualValues(t, 2, page["totalCount"])
+	require.Equal(t, "Acme", page["nodes"].([]any)[0].(map[string]any)["organization"].(map[string]any)["name"])
+	pageInfo := page["pageInfo"].(map[string]any)
+	require.Equal(t, true, pageInfo["hasNextPage"])
+
+	// The cursor continues after the first page
+	code, resp = query("user", `{"query": "query($after: String) { media(organizationId: 1, after: $after) { nodes { fileName } pageInfo { hasNextPage } } }", "variables": {"after": "`+pageInfo["endCursor"].(string)+`"}}`)
+	require.Equal(t, http.StatusOK, code)
+	page = resp["data"].(map[string]any)["media"].(map[string]any)
+	require.Len(t, page["nodes"], 1)
+	require.Equal(t, false, page["pageInfo"].(map[string]any)["hasNextPage"])
+
+	code, resp = query("user", `{"query": "{ folders { name mediaCount } image(fileName: \"cat.png\") { fileName url organization { name } } }"}`)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, map[string]any{
+		"folders": []any{
+			map[string]any{"name": "images", "mediaCount": float64(2)},
+			map[string]any{"name": "docs", "mediaCount": float64(1)},
+		},
+		"image": map[string]any{"fileName": "cat.png", "url": "/api/cdn/download/images/cat.png", "organization": nil},
+	}, resp["data"])
+
+	// Users are only listed for admins
+	code, resp = query("user", `{"query": "{ users { totalCount } }"}`)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, map[string]any{"users": nil}, resp["data"])
+	require.Len(t, resp["errors"], 1)
+	_, resp = query("admin", `{"query": "{ users(role: \"admin\") { nodes { email } } }"}`)
+	require.Nil(t, resp["errors"])
+
+	code, resp = query("user", `{"query": "{ media { nodes { size } } }"}`)
+	require.Equal(t, http.StatusBadRequest, code)
+	require.NotContains(t, resp, "data")
+
+	// Nested relations are cut off at maxQueryDepth
+	nested := "fileName"
+	for i := 0; i < maxQueryDepth/2; i++ {
+		nested = "related { media { " + nested + " } }"
+	}
+	code, _ = query("user", `{"query": "{ image(fileName: \"cat.png\") { `+nested+` } }"}`)
+	require.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestGraphQLHandler_FolderAccess(t *testing.T) {
+	// Arrange
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	db := database.DB
+	groups := database.NewGroupRepo(db)
+	acl.Default = acl.New(groups)
+	t.Cleanup(func() { acl.Default = nil })
+	require.NoError(t, db.Create(&models.Image{FileName: "logo.png", Checksum: []byte("a")}).Error)
+	require.NoError(t, db.Create(&models.Doc{FileName: "contract.pdf", Checksum: []byte("b")}).Error)
+	require.NoError(t, db.Create(&models.Doc{FileName: "poster.pdf", Checksum: []byte("c")}).Error)
+	outsider := models.User{Email: "outsider@example.com", PasswordHash: "x", Role: "user"}
+	require.NoError(t, db.Create(&outsider).Error)
+	legal := models.Group{Name: "Legal"}
+	require.NoError(t, groups.CreateGroup(context.Background(), &legal))
+	require.NoError(t, groups.SetFolderPermission(context.Background(), &models.FolderPermission{Folder: "docs", GroupID: legal.ID, Access: models.AccessRead}))
+	var logo models.Image
+	var poster models.Doc
+	require.NoError(t, db.Where("file_name = ?", "logo.png").First(&logo).Error)
+	require.NoError(t, db.Where("file_name = ?", "poster.pdf").First(&poster).Error)
+	require.NoError(t, database.NewMediaRelationRepo(db).AddRelation(context.Background(), &models.MediaRelation{
+		SourceType: models.MediaTypeImage, SourceID: logo.ID, TargetType: models.MediaTypeDoc, TargetID: poster.ID, Relation: "poster",
+	}))
+
+	h := NewGraphQLHandler(
+		database.NewImageRepo(db),
+		database.NewDocRepo(db),
+		database.NewMediaRelationRepo(db),
+		database.NewUserRepo(db),
+		database.NewOrganizationRepo(db),
+	)
+	r := gin.New()
+	r.POST("/graphql", func(c *gin.Context) {
+		auth.SetPrincipal(c, auth.UserPrincipal(auth.MethodJWT, &outsider))
+		h.Query(c)
+	})
+
+	// Act
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(
+		`{"query": "{ folders { name } media { totalCount } doc(fileName: \"contract.pdf\") { fileName } image(fileName: \"logo.png\") { related { fileName } } }"}`,
+	)))
+
+	// Assert
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Nil(t, resp["errors"])
+	require.Equal(t, map[string]any{
+		"folders": []any{map[string]any{"name": "images"}},
+		"media":   map[string]any{"totalCount": float64(1)},
+		"doc":     nil,
+		"image":   map[string]any{"related": []any{}},
+	}, resp["data"])
+}
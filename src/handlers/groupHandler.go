@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/acl"
+	"github.com/kevinanielsen/go-fast-cdn/src/audit"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"gorm.io/gorm"
+)
+
+type GroupHandler struct {
+	groupRepo models.GroupRepository
+	userRepo  models.UserRepository
+}
+
+func NewGroupHandler(groupRepo models.GroupRepository, userRepo models.UserRepository) *GroupHandler {
+	return &GroupHandler{groupRepo: groupRepo, userRepo: userRepo}
+}
+
+// ListGroups returns all groups
+func (h *GroupHandler) ListGroups(c *gin.Context) {
+	groups, err := h.groupRepo.GetAllGroups(c.Request.Context())
+	if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to fetch groups")
+		return
+	}
+	c.JSON(http.StatusOK, groups)
+}
+
+// CreateGroup adds a new group
+func (h *GroupHandler) CreateGroup(c *gin.Context) {
+	var req struct {
+		Name        string `json:"name" binding:"required"`
+		Description string `json:"description"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Invalid(c, err)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+
+	groups, err := h.groupRepo.GetAllGroups(c.Request.Context())
+	if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to create group")
+		return
+	}
+	for _, group := range groups {
+		if strings.EqualFold(group.Name, req.Name) {
+			problem.Write(c, http.StatusConflict, "A group with this name already exists")
+			return
+		}
+	}
+
+	group := &models.Group{Name: req.Name, Description: req.Description}
+	if err := h.groupRepo.CreateGroup(c.Request.Context(), group); err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to create group")
+		return
+	}
+	audit.Record(c, audit.ActionGroupCreated, group.Name, nil)
+	c.JSON(http.StatusCreated, group)
+}
+
+// DeleteGroup removes a group, its members and the folder permissions it
+// was granted
+func (h *GroupHandler) DeleteGroup(c *gin.Context) {
+	group, ok := h.group(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	if err := h.groupRepo.DeleteGroup(c.Request.Context(), group.ID); err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to delete group")
+		return
+	}
+	audit.Record(c, audit.ActionGroupDeleted, group.Name, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Group deleted successfully"})
+}
+
+// ListGroupMembers returns the users in a group
+func (h *GroupHandler) ListGroupMembers(c *gin.Context) {
+	group, ok := h.group(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	users, err := h.groupRepo.GetGroupMembers(c.Request.Context(), group.ID)
+	if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to fetch group members")
+		return
+	}
+	c.JSON(http.StatusOK, users)
+}
+
+// AddGroupMember adds a user to a group
+func (h *GroupHandler) AddGroupMember(c *gin.Context) {
+	group, ok := h.group(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	userID, err := strconv.ParseUint(c.Param("user_id"), 10, 64)
+	if err != nil {
+		problem.Write(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	user, err := h.userRepo.GetUserByID(c.Request.Context(), uint(userID))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		problem.NotFound(c, "User not found")
+		return
+	} else if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to fetch user")
+		return
+	}
+
+	if err := h.groupRepo.AddGroupMember(c.Request.Context(), group.ID, user.ID); err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to add group member")
+		return
+	}
+	audit.Record(c, audit.ActionGroupMemberAdded, group.Name, gin.H{"user_id": user.ID, "email": user.Email})
+	c.JSON(http.StatusOK, gin.H{"message": "Group member added successfully"})
+}
+
+// RemoveGroupMember removes a user from a group
+func (h *GroupHandler) RemoveGroupMember(c *gin.Context) {
+	group, ok := h.group(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	userID, err := strconv.ParseUint(c.Param("user_id"), 10, 64)
+	if err != nil {
+		problem.Write(c, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	err = h.groupRepo.RemoveGroupMember(c.Request.Context(), group.ID, uint(userID))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		problem.NotFound(c, "User is not a member of the group")
+		return
+	} else if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to remove group member")
+		return
+	}
+	audit.Record(c, audit.ActionGroupMemberRemoved, group.Name, gin.H{"user_id": userID})
+	c.JSON(http.StatusOK, gin.H{"message": "Group member removed successfully"})
+}
+
+// ListFolderPermissions returns the groups granted access to a folder
+func (h *GroupHandler) ListFolderPermissions(c *gin.Context) {
+	folder, ok := h.folder(c)
+	if !ok {
+		return
+	}
+	permissions, err := h.groupRepo.GetFolderPermissions(c.Request.Context(), folder)
+	if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to fetch folder permissions")
+		return
+	}
+	c.JSON(http.StatusOK, permissions)
+}
+
+// SetFolderPermission grants a group access to a folder. The first grant
+// restricts the folder to its groups.
+func (h *GroupHandler) SetFolderPermission(c *gin.Context) {
+	folder, ok := h.folder(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Access string `json:"access" binding:"required,oneof=read write admin"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Invalid(c, err)
+		return
+	}
+	group, ok := h.group(c, c.Param("group_id"))
+	if !ok {
+		return
+	}
+
+	permission := &models.FolderPermission{Folder: folder, GroupID: group.ID, Access: req.Access}
+	if err := h.groupRepo.SetFolderPermission(c.Request.Context(), permission); err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to set folder permission")
+		return
+	}
+	audit.Record(c, audit.ActionFolderPermissionGranted, folder, gin.H{"group": group.Name, "access": req.Access})
+	c.JSON(http.StatusOK, permission)
+}
+
+// DeleteFolderPermission revokes the access of a group to a folder. Once the
+// last one is revoked the folder is open again.
+func (h *GroupHandler) DeleteFolderPermission(c *gin.Context) {
+	folder, ok := h.folder(c)
+	if !ok {
+		return
+	}
+	groupID, err := strconv.ParseUint(c.Param("group_id"), 10, 64)
+	if err != nil {
+		problem.Write(c, http.StatusBadRequest, "Invalid group ID")
+		return
+	}
+	err = h.groupRepo.DeleteFolderPermission(c.Request.Context(), folder, uint(groupID))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		problem.NotFound(c, "Folder permission not found")
+		return
+	} else if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to delete folder permission")
+		return
+	}
+	audit.Record(c, audit.ActionFolderPermissionRevoked, folder, gin.H{"group_id": groupID})
+	c.JSON(http.StatusOK, gin.H{"message": "Folder permission deleted successfully"})
+}
+
+// group looks up the group with the ID id, writing a problem if there is
+// none
+func (h *GroupHandler) group(c *gin.Context, id string) (*models.Group, bool) {
+	groupID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		problem.Write(c, http.StatusBadRequest, "Invalid group ID")
+		return nil, false
+	}
+	group, err := h.groupRepo.GetGroupByID(c.Request.Context(), uint(groupID))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		problem.NotFound(c, "Group not found")
+		return nil, false
+	} else if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to fetch group")
+		return nil, false
+	}
+	return group, true
+}
+
+// folder returns the media folder of the request, writing a problem unless
+// it exists and the request may manage its permissions
+func (h *GroupHandler) folder(c *gin.Context) (string, bool) {
+	folder := c.Param("id")
+	if models.MediaTypeFor(folder) == "" {
+		problem.NotFound(c, "Folder not found")
+		return "", false
+	}
+	return folder, acl.CheckManageable(c, folder)
+}
@@ -1,11 +1,22 @@
 package handlers
 
-import "github.com/kevinanielsen/go-fast-cdn/src/models"
+import (
+	"sync"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+)
 
 type ImageHandler struct {
-	repo models.ImageRepository
+	repo          models.ImageRepository
+	relationRepo  models.MediaRelationRepository
+	renditionRepo models.RenditionRepository
+	aliasRepo     models.MediaAliasRepository
+
+	// convertMu serializes the conversions for content negotiation so a
+	// burst of requests for an image is only converted once.
+	convertMu sync.Mutex
 }
 
-func NewImageHandler(repo models.ImageRepository) *ImageHandler {
-	return &ImageHandler{repo}
+func NewImageHandler(repo models.ImageRepository, relationRepo models.MediaRelationRepository, renditionRepo models.RenditionRepository, aliasRepo models.MediaAliasRepository) *ImageHandler {
+	return &ImageHandler{repo: repo, relationRepo: relationRepo, renditionRepo: renditionRepo, aliasRepo: aliasRepo}
 }
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"path/filepath"
+	"sync"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+)
+
+// TransformCacheStats counts how transform preset requests were served.
+type TransformCacheStats struct {
+	Hits        int64 `json:"hits"`
+	Misses      int64 `json:"misses"`
+	Errors      int64 `json:"errors"`
+	CachedFiles int64 `json:"cached_files"`
+	CachedBytes int64 `json:"cached_bytes"`
+}
+
+// TransformHandler serves images transformed by named presets and caches
+// the results on disk.
+type TransformHandler struct {
+	repo models.TransformPresetRepository
+	// imageRepo provides the focal points of images.
+	imageRepo models.ImageRepository
+	// hintWidths are the widths images are scaled to for client hints.
+	hintWidths []int
+	// saveDataQuality is the JPEG quality of images served to clients
+	// saving data, 0 to keep the quality, and slowECT the effective
+	// connection types treated like Save-Data.
+	saveDataQuality int
+	slowECT         map[string]bool
+
+	// mu serializes the generation of transformed images so a burst of
+	// requests for an uncached file is only processed once.
+	mu sync.Mutex
+
+	statsMu sync.Mutex
+	stats   map[string]*TransformCacheStats
+}
+
+func NewTransformHandler(repo models.TransformPresetRepository, imageRepo models.ImageRepository) *TransformHandler {
+	return &TransformHandler{
+		repo:            repo,
+		imageRepo:       imageRepo,
+		hintWidths:      clientHintWidths(),
+		saveDataQuality: saveDataQuality(),
+		slowECT:         slowConnections(),
+		stats:           map[string]*TransformCacheStats{},
+	}
+}
+
+// transformCacheDir returns the folder holding the cached results of a preset.
+func transformCacheDir(preset string) string {
+	return filepath.Join(util.ExPath, "cache", "transforms", preset)
+}
+
+func (h *TransformHandler) record(preset string, update func(stats *TransformCacheStats)) {
+	h.statsMu.Lock()
+	defer h.statsMu.Unlock()
+
+	stats, ok := h.stats[preset]
+	if !ok {
+		stats = &TransformCacheStats{}
+		h.stats[preset] = stats
+	}
+	update(stats)
+}
@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"fmt"
+	"image"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/imaging"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+)
+
+// acceptCH lists the client hints honored on image requests. The legacy
+// names are still sent by some browsers.
+const acceptCH = "Sec-CH-DPR, Sec-CH-Width, DPR, Width, ECT"
+
+// defaultSaveDataQuality is the JPEG quality of images served to clients
+// saving data.
+const defaultSaveDataQuality = 40
+
+// defaultSlowECT are the effective connection types considered slow.
+var defaultSlowECT = []string{"slow-2g", "2g"}
+
+// maxClientDPR is the highest device pixel ratio images are scaled for.
+const maxClientDPR = 3
+
+// defaultHintWidths are the widths images are scaled to for client hints.
+// Requested widths are rounded up to the next one so the cache only holds a
+// few variants of every image.
+var defaultHintWidths = []int{320, 480, 640, 768, 1024, 1280, 1536, 1920, 2560}
+
+// clientHintWidths returns the widths set in CLIENT_HINT_WIDTHS as a comma
+// separated list, or the default widths.
+func clientHintWidths() []int {
+	widths := []int{}
+	for _, val := range strings.Split(os.Getenv("CLIENT_HINT_WIDTHS"), ",") {
+		if width, err := strconv.Atoi(strings.TrimSpace(val)); err == nil && width > 0 {
+			widths = append(widths, width)
+		}
+	}
+	if len(widths) == 0 {
+		return defaultHintWidths
+	}
+	sort.Ints(widths)
+	return widths
+}
+
+// saveDataQuality returns the JPEG quality set in SAVE_DATA_QUALITY, the
+// default one if unset, or 0 if reducing the quality is disabled.
+func saveDataQuality() int {
+	quality, err := strconv.Atoi(strings.TrimSpace(os.Getenv("SAVE_DATA_QUALITY")))
+	if err != nil || quality < 0 || quality > 100 {
+		return defaultSaveDataQuality
+	}
+	return quality
+}
+
+// slowConnections returns the effective connection types set in
+// SAVE_DATA_ECT as a comma separated list, or the default ones.
+func slowConnections() map[string]bool {
+	types := map[string]bool{}
+	for _, val := range strings.Split(os.Getenv("SAVE_DATA_ECT"), ",") {
+		if val = strings.ToLower(strings.TrimSpace(val)); val != "" {
+			types[val] = true
+		}
+	}
+	if len(types) == 0 {
+		for _, val := range defaultSlowECT {
+			types[val] = true
+		}
+	}
+	return types
+}
+
+// variantCacheDir returns the folder holding images scaled for client hints.
+func variantCacheDir() string {
+	return filepath.Join(util.ExPath, "cache", "variants")
+}
+
+// setHintHeaders asks the browser for client hints and marks the response as
+// depending on them and on Save-Data, which is sent without asking.
+func setHintHeaders(c *gin.Context) {
+	c.Header("Accept-CH", acceptCH)
+	c.Writer.Header().Add("Vary", acceptCH+", Save-Data")
+}
+
+// reducedQuality returns the JPEG quality to serve images in to clients
+// asking to save data with Save-Data, or on a slow connection according to
+// the ECT client hint, and 0 to keep the quality of the image.
+func (h *TransformHandler) reducedQuality(c *gin.Context) int {
+	if h.saveDataQuality == 0 {
+		return 0
+	}
+	if strings.EqualFold(strings.TrimSpace(c.GetHeader("Save-Data")), "on") ||
+		h.slowECT[strings.ToLower(strings.TrimSpace(c.GetHeader("ECT")))] {
+		return h.saveDataQuality
+	}
+	return 0
+}
+
+// requestDPR returns the device pixel ratio from ?dpr= or the DPR client
+// hints, rounded up to a multiple of 0.5 and capped at limit.
+func requestDPR(c *gin.Context, limit float64) float64 {
+	if limit <= 0 || limit > maxClientDPR {
+		limit = maxClientDPR
+	}
+	dpr := 1.0
+	for _, val := range []string{c.Query("dpr"), c.GetHeader("Sec-CH-DPR"), c.GetHeader("DPR")} {
+		if parsed, err := strconv.ParseFloat(val, 64); err == nil && parsed > 0 && !math.IsInf(parsed, 0) {
+			dpr = parsed
+			break
+		}
+	}
+	return max(1, min(limit, math.Ceil(dpr*2)/2))
+}
+
+// requestWidth returns the width in physical pixels the client asked for
+// with ?w= or the Width client hints, or 0 if it did not ask for one.
+func requestWidth(c *gin.Context, dpr float64) int {
+	if width, err := strconv.Atoi(c.Query("w")); err == nil && width > 0 {
+		return int(math.Ceil(float64(width) * dpr))
+	}
+	for _, val := range []string{c.GetHeader("Sec-CH-Width"), c.GetHeader("Width")} {
+		if width, err := strconv.Atoi(val); err == nil && width > 0 {
+			return width
+		}
+	}
+	return 0
+}
+
+// snapWidth rounds width up to the next allowed width, or down to the
+// largest one.
+func snapWidth(width int, widths []int) int {
+	for _, allowed := range widths {
+		if allowed >= width {
+			return allowed
+		}
+	}
+	return widths[len(widths)-1]
+}
+
+// ClientHints serves image downloads scaled to the width the client asked
+// for with client hints or ?w= and ?dpr=, and JPEG images in a lower
+// quality to clients saving data, see reducedQuality. Requests without a
+// width, and widths at least as large as the image, fall through to the
+// original file unless the quality is reduced.
+func (h *TransformHandler) ClientHints() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			c.Next()
+			return
+		}
+		setHintHeaders(c)
+
+		width := requestWidth(c, requestDPR(c, maxClientDPR))
+		quality := h.reducedQuality(c)
+		if width == 0 && quality == 0 {
+			c.Next()
+			return
+		}
+
+		fileName, err := util.FilterFilename(path.Base(c.Request.URL.Path))
+		if err != nil {
+			c.Next()
+			return
+		}
+		srcPath := filepath.Join(util.ExPath, "uploads", "images", fileName)
+		srcInfo, err := os.Stat(srcPath)
+		if err != nil || srcInfo.IsDir() {
+			c.Next()
+			return
+		}
+
+		opts := imaging.Options{}
+		if width > 0 {
+			opts.Width = snapWidth(width, h.hintWidths)
+		}
+		format := imaging.Format(srcPath, opts)
+		if _, err := imaging.Encoder(format, 0); err != nil {
+			c.Next()
+			return
+		}
+		if format == "jpg" || format == "jpeg" {
+			opts.Quality = quality
+		}
+		if srcWidth, ok := imageWidth(srcPath); !ok || opts.Width >= srcWidth {
+			opts.Width = 0
+		}
+		if opts.Width == 0 && opts.Quality == 0 {
+			c.Next()
+			return
+		}
+
+		cacheName := fmt.Sprintf("%d-%d-%s.%s",
+			srcInfo.ModTime().Unix(),
+			opts.Width,
+			strings.TrimSuffix(fileName, filepath.Ext(fileName)),
+			format,
+		)
+		if opts.Quality > 0 {
+			cacheName = "q" + strconv.Itoa(opts.Quality) + "-" + cacheName
+		}
+		cachePath := filepath.Join(variantCacheDir(), cacheName)
+		if _, err := h.ensureTransformed(srcPath, cachePath, opts); err != nil {
+			log.Printf("Failed to process %s for client hints: %s\n", fileName, err.Error())
+			c.Next()
+			return
+		}
+		if opts.Width == 0 {
+			// Images already compressed harder are served as they are
+			if info, err := os.Stat(cachePath); err != nil || info.Size() >= srcInfo.Size() {
+				c.Next()
+				return
+			}
+		}
+
+		c.File(cachePath)
+		c.Abort()
+	}
+}
+
+// imageWidth returns the width of the image at path.
+func imageWidth(path string) (int, bool) {
+	width, _, ok := imageSize(path)
+	return width, ok
+}
+
+// imageSize returns the width and height of the image at path.
+func imageSize(path string) (int, int, bool) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0, false
+	}
+	defer file.Close()
+
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return 0, 0, false
+	}
+	return config.Width, config.Height, true
+}
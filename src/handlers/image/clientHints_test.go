@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientHints(t *testing.T) {
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	database.Migrate()
+	imageDir := filepath.Join(util.ExPath, "uploads", "images")
+	require.NoError(t, os.MkdirAll(imageDir, 0o755))
+
+	file, err := os.Create(filepath.Join(imageDir, "photo.png"))
+	require.NoError(t, err)
+	img, _ := createDummyImage(1000, 500)
+	require.NoError(t, png.Encode(file, img))
+	require.NoError(t, file.Close())
+
+	presetRepo := database.NewTransformPresetRepo(database.DB)
+	require.NoError(t, presetRepo.CreateTransformPreset(context.Background(), &models.TransformPreset{Name: "thumb", Width: 100}))
+	require.NoError(t, presetRepo.CreateTransformPreset(context.Background(), &models.TransformPreset{Name: "flat", Width: 100, MaxDPR: 1}))
+
+	transformHandler := NewTransformHandler(presetRepo, database.NewImageRepo(database.DB))
+	router := gin.New()
+	router.Group("/download/images", transformHandler.ClientHints()).Static("/", imageDir)
+	router.GET("/transform/:preset/:filename", transformHandler.HandleImageTransform)
+
+	width := func(target string, headers map[string]string) int {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		for key, val := range headers {
+			req.Header.Set(key, val)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, target)
+		require.Contains(t, w.Header().Get("Accept-CH"), "Sec-CH-Width")
+
+		decoded, err := png.Decode(w.Body)
+		require.NoError(t, err)
+		return decoded.Bounds().Dx()
+	}
+
+	require.Equal(t, 1000, width("/download/images/photo.png", nil))
+	require.Equal(t, 640, width("/download/images/photo.png", map[string]string{"Sec-CH-Width": "500"}))
+	require.Equal(t, 640, width("/download/images/photo.png?w=300&dpr=2", nil))
+	// Images are never scaled up
+	require.Equal(t, 1000, width("/download/images/photo.png", map[string]string{"Width": "1200"}))
+
+	require.Equal(t, 100, width("/transform/thumb/photo.png", nil))
+	require.Equal(t, 200, width("/transform/thumb/photo.png", map[string]string{"Sec-CH-DPR": "2"}))
+	require.Equal(t, 300, width("/transform/thumb/photo.png?dpr=10", nil))
+	require.Equal(t, 100, width("/transform/flat/photo.png?dpr=2", nil))
+}
+
+func TestSnapWidth(t *testing.T) {
+	widths := []int{320, 640, 1280}
+	require.Equal(t, 320, snapWidth(1, widths))
+	require.Equal(t, 640, snapWidth(321, widths))
+	require.Equal(t, 1280, snapWidth(5000, widths))
+}
+
+func TestClientHints_SaveData(t *testing.T) {
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	imageDir := filepath.Join(util.ExPath, "uploads", "images")
+	require.NoError(t, os.MkdirAll(imageDir, 0o755))
+
+	// A detailed image, so a lower quality makes a difference
+	img := image.NewRGBA(image.Rect(0, 0, 400, 300))
+	for y := 0; y < 300; y++ {
+		for x := 0; x < 400; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * y), uint8(x ^ y), uint8(x + y), 255})
+		}
+	}
+	file, err := os.Create(filepath.Join(imageDir, "photo.jpg"))
+	require.NoError(t, err)
+	require.NoError(t, jpeg.Encode(file, img, &jpeg.Options{Quality: 95}))
+	require.NoError(t, file.Close())
+	original, err := os.Stat(filepath.Join(imageDir, "photo.jpg"))
+	require.NoError(t, err)
+
+	transformHandler := NewTransformHandler(database.NewTransformPresetRepo(database.DB), database.NewImageRepo(database.DB))
+	router := gin.New()
+	router.Group("/download/images", transformHandler.ClientHints()).Static("/", imageDir)
+	size := func(headers map[string]string) int64 {
+		req := httptest.NewRequest(http.MethodGet, "/download/images/photo.jpg", nil)
+		for key, val := range headers {
+			req.Header.Set(key, val)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Contains(t, w.Header().Get("Vary"), "Save-Data")
+		return int64(w.Body.Len())
+	}
+
+	require.Equal(t, original.Size(), size(nil))
+	require.Equal(t, original.Size(), size(map[string]string{"ECT": "4g"}))
+	require.Less(t, size(map[string]string{"Save-Data": "on"}), original.Size())
+	require.Less(t, size(map[string]string{"ECT": "2g"}), original.Size())
+
+	t.Setenv("SAVE_DATA_QUALITY", "0")
+	transformHandler = NewTransformHandler(database.NewTransformPresetRepo(database.DB), database.NewImageRepo(database.DB))
+	router = gin.New()
+	router.Group("/download/images", transformHandler.ClientHints()).Static("/", imageDir)
+	require.Equal(t, original.Size(), size(map[string]string{"Save-Data": "on"}))
+}
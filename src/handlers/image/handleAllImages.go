@@ -4,11 +4,15 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
 )
 
 func (h *ImageHandler) HandleAllImages(c *gin.Context) {
-
-	entries := h.repo.GetAllImages()
+	entries, err := h.repo.GetAllImages(c.Request.Context())
+	if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to list images")
+		return
+	}
 
 	c.JSON(http.StatusOK, entries)
 }
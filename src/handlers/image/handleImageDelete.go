@@ -1,37 +1,79 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/auth"
+	"github.com/kevinanielsen/go-fast-cdn/src/cache"
+	"github.com/kevinanielsen/go-fast-cdn/src/events"
+	"github.com/kevinanielsen/go-fast-cdn/src/hooks"
+	"github.com/kevinanielsen/go-fast-cdn/src/middleware"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"github.com/kevinanielsen/go-fast-cdn/src/usage"
 	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"gorm.io/gorm"
 )
 
 func (h *ImageHandler) HandleImageDelete(c *gin.Context) {
 	fileName := c.Param("filename")
 	if fileName == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Doc name is required",
-		})
+		problem.Write(c, http.StatusBadRequest, "Doc name is required")
 		return
 	}
 
-	deletedFileName, success := h.repo.DeleteImage(fileName)
-	if !success {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "Image not found",
-		})
+	ctx := c.Request.Context()
+	image, err := h.repo.GetImageByFileName(ctx, fileName)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		problem.Write(c, http.StatusInternalServerError, "Failed to look up image")
+		return
+	}
+	if err == nil && !auth.InScope(c, image.OrganizationID) {
+		problem.Write(c, http.StatusForbidden, "Image belongs to another organization")
+		return
+	}
+
+	if middleware.AbortIfStale(c, models.MediaVersion(image.UpdatedAt)) {
+		return
+	}
+	if image.ID != 0 {
+		err := hooks.PreDelete(c, hooks.Stored(hooks.Media{
+			Type: models.MediaTypeImage, FileName: image.FileName, MimeType: image.MimeType,
+			UUID: image.UUID, OrganizationID: image.OrganizationID,
+		}))
+		if err != nil {
+			hooks.Abort(c, err)
+			return
+		}
+	}
+
+	deletedFileName, err := h.repo.DeleteImage(middleware.Unchanged(c, image.UpdatedAt), fileName)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		problem.NotFound(c, "Image not found")
+		return
+	}
+	if errors.Is(err, models.ErrStale) {
+		middleware.AbortStale(c)
+		return
+	}
+	if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to delete image")
 		return
 	}
 
-	err := util.DeleteFile(deletedFileName, "images")
+	cache.Invalidate(models.MediaTypeImage, deletedFileName)
+	err = usage.Track(models.MediaTypeImage, image.OrganizationID, deletedFileName, func() error {
+		return util.DeleteFile(deletedFileName, "images")
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to delete image",
-		})
+		problem.Write(c, http.StatusInternalServerError, "Failed to delete image")
 		return
 	}
 
+	events.Record(c, events.TypeDeleted, models.MediaTypeImage+"/"+deletedFileName, nil)
+
 	c.JSON(http.StatusOK, gin.H{
 		"message":  "Image deleted successfully",
 		"fileName": deletedFileName,
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/auth"
+	"github.com/kevinanielsen/go-fast-cdn/src/imaging"
+	"github.com/kevinanielsen/go-fast-cdn/src/middleware"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"gorm.io/gorm"
+)
+
+// HandleImageFocalPoint sets the focal point kept in view when the image is
+// cropped with the focal gravity, given as fractions of the width and height
+// from the top left corner. Null coordinates clear it.
+func (h *ImageHandler) HandleImageFocalPoint(c *gin.Context) {
+	body := struct {
+		Filename string   `json:"filename" binding:"required,filename"`
+		X        *float64 `json:"x" binding:"required_with=Y,omitempty,min=0,max=1"`
+		Y        *float64 `json:"y" binding:"required_with=X,omitempty,min=0,max=1"`
+	}{}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		problem.Invalid(c, err)
+		return
+	}
+
+	filename, err := util.FilterFilename(body.Filename)
+	if err != nil {
+		problem.Write(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx := c.Request.Context()
+	image, err := h.repo.GetImageByFileName(ctx, filename)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		problem.NotFound(c, "Image does not exist")
+		return
+	} else if err != nil {
+		problem.WriteDetails(c, http.StatusInternalServerError, "Failed to look up image", err.Error())
+		return
+	}
+	if !auth.InScope(c, image.OrganizationID) {
+		problem.Write(c, http.StatusForbidden, "Image belongs to another organization")
+		return
+	}
+
+	if middleware.AbortIfStale(c, models.MediaVersion(image.UpdatedAt)) {
+		return
+	}
+
+	err = h.repo.UpdateImageFocalPoint(middleware.Unchanged(c, image.UpdatedAt), filename, body.X, body.Y)
+	if errors.Is(err, models.ErrStale) {
+		middleware.AbortStale(c)
+		return
+	}
+	if err != nil {
+		problem.WriteDetails(c, http.StatusInternalServerError, "Failed to update focal point", err.Error())
+		return
+	}
+
+	image.FocalX, image.FocalY = body.X, body.Y
+	c.JSON(http.StatusOK, gin.H{"filename": filename, "focal_point": focalPoint(image)})
+}
+
+// focalPoint returns the focal point of image, or nil if it has none.
+func focalPoint(image models.Image) *imaging.FocalPoint {
+	if image.FocalX == nil || image.FocalY == nil {
+		return nil
+	}
+	return &imaging.FocalPoint{X: *image.FocalX, Y: *image.FocalY}
+}
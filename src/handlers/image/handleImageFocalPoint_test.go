@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleImageFocalPoint(t *testing.T) {
+	// Arrange
+	h := newTestImageHandler(t)
+	require.NoError(t, database.DB.Create(&models.Image{FileName: "cat.png", Checksum: []byte("cat")}).Error)
+	request := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPut, "/focal-point", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		h.HandleImageFocalPoint(c)
+		return w
+	}
+
+	// Act & Assert
+	require.Equal(t, http.StatusBadRequest, request(`{"filename": "cat.png", "x": 0.5}`).Code)
+	require.Equal(t, http.StatusBadRequest, request(`{"filename": "cat.png", "x": 1.5, "y": 0.5}`).Code)
+	require.Equal(t, http.StatusNotFound, request(`{"filename": "dog.png", "x": 0.5, "y": 0.5}`).Code)
+
+	require.Equal(t, http.StatusOK, request(`{"filename": "cat.png", "x": 0.25, "y": 0.75}`).Code)
+	image, err := database.NewImageRepo(database.DB).GetImageByFileName(context.Background(), "cat.png")
+	require.NoError(t, err)
+	require.Equal(t, 0.25, *image.FocalX)
+	require.Equal(t, 0.75, *image.FocalY)
+
+	require.Equal(t, http.StatusOK, request(`{"filename": "cat.png", "x": null, "y": null}`).Code)
+	image, err = database.NewImageRepo(database.DB).GetImageByFileName(context.Background(), "cat.png")
+	require.NoError(t, err)
+	require.Nil(t, image.FocalX)
+}
+
+func TestHandleImageFocalPoint_IfMatch(t *testing.T) {
+	// Arrange
+	h := newTestImageHandler(t)
+	require.NoError(t, database.DB.Create(&models.Image{FileName: "cat.png", Checksum: []byte("cat")}).Error)
+	repo := database.NewImageRepo(database.DB)
+	image, err := repo.GetImageByFileName(context.Background(), "cat.png")
+	require.NoError(t, err)
+	version := models.MediaVersion(image.UpdatedAt)
+	request := func(ifMatch string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPut, "/focal-point", strings.NewReader(`{"filename": "cat.png", "x": 0.5, "y": 0.5}`))
+		c.Request.Header.Set("Content-Type", "application/json")
+		if ifMatch != "" {
+			c.Request.Header.Set("If-Match", ifMatch)
+		}
+		h.HandleImageFocalPoint(c)
+		return w
+	}
+
+	// Act & Assert
+	w := request(`"stale"`)
+	require.Equal(t, http.StatusPreconditionFailed, w.Code)
+	require.Equal(t, `"`+version+`"`, w.Header().Get("ETag"))
+
+	require.Equal(t, http.StatusOK, request(`"`+version+`"`).Code)
+	image, err = repo.GetImageByFileName(context.Background(), "cat.png")
+	require.NoError(t, err)
+	require.NotEqual(t, version, models.MediaVersion(image.UpdatedAt))
+	require.Equal(t, http.StatusPreconditionFailed, request(version).Code)
+
+	t.Setenv("REQUIRE_IF_MATCH", "true")
+	require.Equal(t, http.StatusPreconditionRequired, request("").Code)
+	require.Equal(t, http.StatusOK, request("*").Code)
+}
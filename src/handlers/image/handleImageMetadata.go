@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"errors"
 	"image"
 	"log"
@@ -9,15 +10,18 @@ import (
 	"path/filepath"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/metrics"
+	"github.com/kevinanielsen/go-fast-cdn/src/middleware"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
 	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"gorm.io/gorm"
 )
 
-func HandleImageMetadata(c *gin.Context) {
+func (h *ImageHandler) HandleImageMetadata(c *gin.Context) {
 	fileName := c.Param("filename")
 	if fileName == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Image name is required",
-		})
+		problem.Write(c, http.StatusBadRequest, "Image name is required")
 		return
 	}
 
@@ -26,9 +30,7 @@ func HandleImageMetadata(c *gin.Context) {
 	if fileinfo, err := os.Stat(filePath); err == nil {
 		if file, err := os.Open(filePath); err != nil {
 			log.Printf("Failed to open the image %s: %s\n", fileName, err.Error())
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": "Internal server error",
-			})
+			problem.Write(c, http.StatusInternalServerError, "Internal server error")
 			return
 		} else {
 			defer file.Close()
@@ -36,9 +38,7 @@ func HandleImageMetadata(c *gin.Context) {
 			img, _, err := image.Decode(file)
 			if err != nil {
 				log.Printf("Failed to decode image %s: %s\n", fileName, err.Error())
-				c.JSON(http.StatusInternalServerError, gin.H{
-					"error": "Internal server error",
-				})
+				problem.Write(c, http.StatusInternalServerError, "Internal server error")
 				return
 			}
 			width := img.Bounds().Dx()
@@ -51,19 +51,74 @@ func HandleImageMetadata(c *gin.Context) {
 				"width":        width,
 				"height":       height,
 			}
+			h.addRecordFields(c.Request.Context(), fileName, body)
+			if downloads, err := metrics.DownloadCount(c.Request.Context(), models.MediaTypeImage, fileName); err == nil {
+				body["downloads"] = downloads
+			} else {
+				log.Printf("Failed to count downloads of image %s: %s\n", fileName, err.Error())
+			}
+			if integrity, err := util.Integrity(filePath); err == nil {
+				body["integrity"] = integrity
+			} else {
+				log.Printf("Failed to hash image %s: %s\n", fileName, err.Error())
+			}
 
+			if version, ok := body["version"].(string); ok {
+				c.Header("ETag", middleware.ETag(version))
+			}
 			c.JSON(http.StatusOK, body)
 		}
 	} else if errors.Is(err, os.ErrNotExist) {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "Image does not exist",
-		})
+		problem.NotFound(c, "Image does not exist")
 		return
 	} else {
 		log.Printf("Failed to get the image %s: %s\n", fileName, err.Error())
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Internal server error",
-		})
+		problem.Write(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+}
+
+// addRecordFields adds the version, descriptive fields, download settings
+// and related media of the image to body, using defaults if the image has no
+// database record or the lookup fails.
+func (h *ImageHandler) addRecordFields(ctx context.Context, fileName string, body gin.H) {
+	body["related"] = []models.RelatedMedia{}
+	body["disposition"] = models.DispositionInline
+	body["download_name"] = fileName
+
+	image, err := h.repo.GetImageByFileName(ctx, fileName)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Failed to get image %s: %s\n", fileName, err.Error())
+		}
+		return
+	}
+
+	body["version"] = models.MediaVersion(image.UpdatedAt)
+	body["original_name"] = image.OriginalName
+	body["title"] = image.Title
+	body["alt_text"] = image.AltText
+	body["description"] = image.Description
+	if len(image.Attributes) > 0 {
+		body["attributes"] = image.Attributes
+	}
+	if image.Disposition != "" {
+		body["disposition"] = image.Disposition
+	}
+	body["download_name"] = util.DefaultDownloadName(fileName, image.DownloadName, image.OriginalName)
+	if image.Blurhash != "" {
+		body["blurhash"] = image.Blurhash
+		body["dominant_color"] = image.DominantColor
+	}
+	if image.OriginalSize > 0 {
+		body["original_size"] = image.OriginalSize
+		body["optimized_size"] = image.OptimizedSize
+	}
+
+	related, err := h.relationRepo.GetRelated(ctx, models.MediaTypeImage, image.ID)
+	if err != nil {
+		log.Printf("Failed to get related media for image %s: %s\n", fileName, err.Error())
 		return
 	}
+	body["related"] = related
 }
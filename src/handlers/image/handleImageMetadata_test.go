@@ -13,12 +13,14 @@ import (
 	"testing"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
 	"github.com/kevinanielsen/go-fast-cdn/src/util"
 	"github.com/stretchr/testify/require"
 )
 
 func TestHandleImageMetadata_NoError(t *testing.T) {
 	// Arrange
+	h := newTestImageHandler(t)
 	testFileName := "test_image.jpg"
 	testFileDir := filepath.Join(util.ExPath, "uploads", "images")
 	defer os.RemoveAll(filepath.Join(util.ExPath, "uploads"))
@@ -36,7 +38,7 @@ func TestHandleImageMetadata_NoError(t *testing.T) {
 	}}
 
 	// Act
-	HandleImageMetadata(c)
+	h.HandleImageMetadata(c)
 
 	// Assert
 	require.Equal(t, http.StatusOK, w.Result().StatusCode)
@@ -48,18 +50,20 @@ func TestHandleImageMetadata_NoError(t *testing.T) {
 	require.Contains(t, result, "download_url")
 	require.NotEmpty(t, result["download_url"])
 	require.Contains(t, result, "file_size")
+	require.Contains(t, result, "related")
 	require.Contains(t, result, "width")
 	require.Contains(t, result, "height")
 }
 
 func TestHandleImageMetadata_NameNotProvided(t *testing.T) {
 	// Arrange
+	h := newTestImageHandler(t)
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
 	c.Request = httptest.NewRequest(http.MethodGet, "/test", nil)
 
 	// Act
-	HandleImageMetadata(c)
+	h.HandleImageMetadata(c)
 
 	// Assert
 	require.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
@@ -72,6 +76,7 @@ func TestHandleImageMetadata_NameNotProvided(t *testing.T) {
 
 func TestHandleImageMetadata_NotFound(t *testing.T) {
 	// Arrange
+	h := newTestImageHandler(t)
 	testFileName := "test_file.jpg"
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
@@ -82,7 +87,7 @@ func TestHandleImageMetadata_NotFound(t *testing.T) {
 	}}
 
 	// Act
-	HandleImageMetadata(c)
+	h.HandleImageMetadata(c)
 
 	// Assert
 	require.Equal(t, http.StatusNotFound, w.Result().StatusCode)
@@ -94,6 +99,13 @@ func TestHandleImageMetadata_NotFound(t *testing.T) {
 }
 
 // Helper functions
+func newTestImageHandler(t *testing.T) *ImageHandler {
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+
+	return NewImageHandler(database.NewImageRepo(database.DB), database.NewMediaRelationRepo(database.DB), database.NewRenditionRepo(database.DB), database.NewMediaAliasRepo(database.DB))
+}
+
 func EncodeImage(w io.Writer, img image.Image) error {
 	return jpeg.Encode(w, img, &jpeg.Options{Quality: jpeg.DefaultQuality})
 }
@@ -1,38 +1,73 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"os"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/auth"
+	"github.com/kevinanielsen/go-fast-cdn/src/cache"
+	"github.com/kevinanielsen/go-fast-cdn/src/middleware"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
 	"github.com/kevinanielsen/go-fast-cdn/src/util"
-	"github.com/kevinanielsen/go-fast-cdn/src/validations"
+	"gorm.io/gorm"
 )
 
 func (h *ImageHandler) HandleImageRename(c *gin.Context) {
-	oldName := c.PostForm("filename")
-	newName := c.PostForm("newname")
+	var body struct {
+		Filename string `json:"filename" form:"filename" binding:"required"`
+		NewName  string `json:"newname" form:"newname" binding:"required,nefield=Filename,filename"`
+	}
+	if err := c.ShouldBind(&body); err != nil {
+		problem.Invalid(c, err)
+		return
+	}
+	oldName, newName := body.Filename, body.NewName
 
-	err := validations.ValidateRenameInput(oldName, newName)
-	if err != nil {
-		c.String(http.StatusBadRequest, err.Error())
+	ctx := c.Request.Context()
+	image, err := h.repo.GetImageByFileName(ctx, oldName)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		problem.WriteDetails(c, http.StatusInternalServerError, "Failed to look up image", err.Error())
+		return
+	}
+	if err == nil && !auth.InScope(c, image.OrganizationID) {
+		problem.Write(c, http.StatusForbidden, "Image belongs to another organization")
+		return
+	}
+
+	if middleware.AbortIfStale(c, models.MediaVersion(image.UpdatedAt)) {
 		return
 	}
 
 	filteredNewName, err := util.FilterFilename(newName)
 	if err != nil {
-		c.String(http.StatusBadRequest, err.Error())
+		problem.Write(c, http.StatusBadRequest, err.Error())
 		return
 	}
 
 	err = util.RenameFile(oldName, filteredNewName, "images")
+	if errors.Is(err, os.ErrNotExist) {
+		problem.NotFound(c, "Image does not exist")
+		return
+	}
 	if err != nil {
-		c.String(http.StatusInternalServerError, "Failed to rename file: %s", err.Error())
+		problem.WriteDetails(c, http.StatusInternalServerError, "Failed to rename file", err.Error())
 		return
 	}
+	cache.Invalidate(models.MediaTypeImage, oldName)
+	cache.Invalidate(models.MediaTypeImage, filteredNewName)
 
-	err = h.repo.RenameImage(oldName, filteredNewName)
+	err = h.repo.RenameImage(middleware.Unchanged(c, image.UpdatedAt), oldName, filteredNewName)
+	if errors.Is(err, models.ErrStale) {
+		// The file was renamed for the version that was checked
+		util.RenameFile(filteredNewName, oldName, "images")
+		middleware.AbortStale(c)
+		return
+	}
 	if err != nil {
-		c.String(http.StatusInternalServerError, "Failed to rename file: %s", err.Error())
+		problem.WriteDetails(c, http.StatusInternalServerError, "Failed to rename file", err.Error())
 		return
 	}
 
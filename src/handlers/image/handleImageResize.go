@@ -1,77 +1,143 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
+	"mime"
 	"net/http"
+	"os"
 	"path/filepath"
-	"strings"
 
-	"github.com/anthonynsimon/bild/imgio"
-	"github.com/anthonynsimon/bild/transform"
 	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/auth"
+	"github.com/kevinanielsen/go-fast-cdn/src/cache"
+	"github.com/kevinanielsen/go-fast-cdn/src/imaging"
+	"github.com/kevinanielsen/go-fast-cdn/src/middleware"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/placeholder"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"github.com/kevinanielsen/go-fast-cdn/src/renditions"
+	"github.com/kevinanielsen/go-fast-cdn/src/similarity"
+	"github.com/kevinanielsen/go-fast-cdn/src/usage"
 	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"gorm.io/gorm"
 )
 
 // TODO: add logging package
-func HandleImageResize(c *gin.Context) {
+func (h *ImageHandler) HandleImageResize(c *gin.Context) {
 	body := struct {
-		Filename string `json:"filename" binding:"required"`
+		Filename string `json:"filename" binding:"required,filename"`
 		Width    int    `json:"width" binding:"required"`
 		Height   int    `json:"height" binding:"required"`
+		Fit      string `json:"fit" binding:"omitempty,oneof=fill contain cover"`
+		// Gravity places the crop of the cover fit, see imaging.GravityCenter.
+		Gravity string `json:"gravity" binding:"gravity"`
+		// FocalX and FocalY override the stored focal point of the image for
+		// the focal gravity.
+		FocalX *float64 `json:"focal_x" binding:"required_with=FocalY,omitempty,min=0,max=1"`
+		FocalY *float64 `json:"focal_y" binding:"required_with=FocalX,omitempty,min=0,max=1"`
+		// Copy stores the result as a rendition of the image and leaves the
+		// image itself unchanged.
+		Copy bool `json:"copy"`
 	}{}
-	if e := c.BindJSON(&body); e != nil {
-		// TODO: add shared error handling across handler package
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
-			"error": e.Error(),
-		})
+	if err := c.ShouldBindJSON(&body); err != nil {
+		problem.Invalid(c, err)
 		return
 	}
 
 	filename, err := util.FilterFilename(body.Filename)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
-			"error": err.Error(),
-		})
+		problem.Write(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	image, err := h.repo.GetImageByFileName(c.Request.Context(), filename)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		problem.Write(c, http.StatusInternalServerError, "Failed to look up image")
+		return
+	}
+	if err == nil && !auth.InScope(c, image.OrganizationID) {
+		problem.Write(c, http.StatusForbidden, "Image belongs to another organization")
 		return
 	}
-	imgType := strings.Split(filename, ".")[1]
 
 	filepath := filepath.Join(util.ExPath, "uploads", "images", filename)
+	opts := imaging.Options{Width: body.Width, Height: body.Height, Fit: body.Fit, Gravity: body.Gravity, Focal: focalPoint(image)}
+	if body.FocalX != nil {
+		opts.Focal = &imaging.FocalPoint{X: *body.FocalX, Y: *body.FocalY}
+	}
 
-	img, err := imgio.Open(filepath)
+	if body.Copy {
+		h.resizeCopy(c, image, filepath, opts)
+		return
+	}
+	if middleware.AbortIfStale(c, models.MediaVersion(image.UpdatedAt)) {
+		return
+	}
+
+	err = usage.Track(models.MediaTypeImage, image.OrganizationID, filename, func() error {
+		return imaging.ProcessFile(filepath, filepath, opts)
+	})
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
-			"error": err.Error(),
-		})
+		problem.Write(c, http.StatusBadRequest, err.Error())
 		return
 	}
-	img = transform.Resize(img, body.Width, body.Height, transform.Linear)
+	cache.Invalidate(models.MediaTypeImage, filename)
+	placeholder.Enqueue(c.Request.Context(), h.repo, filename)
+	similarity.Enqueue(c.Request.Context(), h.repo, filename)
 
-	// TODO: a shared accepted image type data could be added to be shared between upload and resize api
-	var encoder imgio.Encoder
-	switch imgType {
-	case "png":
-		encoder = imgio.PNGEncoder()
-	case "jpg", "jpeg":
-		// 75 is the default quality encoding parameter
-		encoder = imgio.JPEGEncoder(75)
-	case "bmp":
-		encoder = imgio.BMPEncoder()
-	default:
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
-			"error": fmt.Sprintf("Image of type %s is not supported", imgType),
-		})
+	c.JSON(http.StatusOK, gin.H{
+		"status": "File resized successfully",
+	})
+}
+
+// resizeCopy stores the image at path resized with opts as a rendition,
+// replacing an earlier copy of the same size and fit.
+func (h *ImageHandler) resizeCopy(c *gin.Context, image models.Image, path string, opts imaging.Options) {
+	if image.ID == 0 {
+		problem.NotFound(c, "Image not found")
+		return
+	}
+
+	ext := filepath.Ext(path)
+	tmp, err := renditions.CreateTemp(ext)
+	if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to store the copy")
+		return
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	if err := imaging.ProcessFile(path, tmp.Name(), opts); err != nil {
+		problem.Write(c, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	if err := imgio.Save(filepath, img, encoder); err != nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
-			"error": err.Error(),
-		})
+	variant := fmt.Sprintf("%dx%d", opts.Width, opts.Height)
+	if opts.Fit != "" {
+		variant += "-" + opts.Fit
+	}
+	if opts.Gravity != "" {
+		variant += "-" + opts.Gravity
+	}
+	rendition := models.Rendition{
+		SourceType:  models.MediaTypeImage,
+		SourceID:    image.ID,
+		Kind:        models.RenditionResized,
+		Variant:     variant,
+		ContentType: mime.TypeByExtension(ext),
+	}
+	if width, height, ok := imageSize(tmp.Name()); ok {
+		rendition.Width, rendition.Height = width, height
+	}
+	if err := renditions.Save(c.Request.Context(), h.renditionRepo, &rendition, tmp.Name(), ext); err != nil {
+		problem.WriteDetails(c, http.StatusInternalServerError, "Failed to store the copy", err.Error())
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"status": "File resized successfully",
+		"status":    "File resized successfully",
+		"rendition": rendition,
+		"url":       renditions.URL(rendition.FileName),
 	})
 }
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/renditions"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleImageResize_Copy(t *testing.T) {
+	// Arrange
+	h := newTestImageHandler(t)
+	imagesDir := filepath.Join(util.ExPath, "uploads", "images")
+	require.NoError(t, os.MkdirAll(imagesDir, 0o755))
+	img, err := createDummyImage(40, 20)
+	require.NoError(t, err)
+	file, err := os.Create(filepath.Join(imagesDir, "cat.png"))
+	require.NoError(t, err)
+	require.NoError(t, png.Encode(file, img))
+	file.Close()
+	require.NoError(t, database.DB.Create(&models.Image{FileName: "cat.png", Checksum: []byte("cat")}).Error)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPut, "/resize", strings.NewReader(`{"filename": "cat.png", "width": 20, "height": 10, "copy": true}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	// Act
+	h.HandleImageResize(c)
+
+	// Assert
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	result := struct {
+		Rendition models.Rendition `json:"rendition"`
+	}{}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&result))
+	require.Equal(t, models.RenditionResized, result.Rendition.Kind)
+	require.Equal(t, "20x10", result.Rendition.Variant)
+	require.Equal(t, 20, result.Rendition.Width)
+	require.Equal(t, 10, result.Rendition.Height)
+	require.FileExists(t, filepath.Join(renditions.Dir(), result.Rendition.FileName))
+
+	// The image itself is unchanged
+	width, height, ok := imageSize(filepath.Join(imagesDir, "cat.png"))
+	require.True(t, ok)
+	require.Equal(t, []int{40, 20}, []int{width, height})
+
+	_, err = database.NewImageRepo(database.DB).DeleteImage(context.Background(), "cat.png")
+	require.NoError(t, err)
+	require.NoFileExists(t, filepath.Join(renditions.Dir(), result.Rendition.FileName))
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/imaging"
+	"github.com/kevinanielsen/go-fast-cdn/src/janitor"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/kevinanielsen/go-fast-cdn/src/watermark"
+	"gorm.io/gorm"
+)
+
+// HandleImageTransform serves an image transformed by a named preset, e.g.
+// /api/cdn/transform/thumb/cat.png. Results are cached on disk and
+// regenerated when either the image or the preset changes. The preset size
+// is multiplied by the device pixel ratio from client hints or ?dpr=.
+func (h *TransformHandler) HandleImageTransform(c *gin.Context) {
+	preset, err := h.repo.GetTransformPresetByName(c.Request.Context(), c.Param("preset"))
+	if err != nil {
+		problem.NotFound(c, "Transform preset not found")
+		return
+	}
+
+	fileName, err := util.FilterFilename(c.Param("filename"))
+	if err != nil {
+		problem.Write(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if preset.Signed && !imaging.VerifySignature(preset.Name, fileName, c.Query("s")) {
+		problem.Write(c, http.StatusForbidden, "Invalid signature")
+		return
+	}
+
+	srcPath := filepath.Join(util.ExPath, "uploads", "images", fileName)
+	srcInfo, err := os.Stat(srcPath)
+	if errors.Is(err, os.ErrNotExist) {
+		problem.NotFound(c, "Image does not exist")
+		return
+	} else if err != nil {
+		log.Printf("Failed to get the image %s: %s\n", fileName, err.Error())
+		problem.Write(c, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	opts := presetOptions(preset)
+	suffix := ""
+	if opts.Fit == imaging.FitCover && opts.Gravity == imaging.GravityFocal {
+		if image, err := h.imageRepo.GetImageByFileName(c.Request.Context(), fileName); err == nil {
+			opts.Focal = focalPoint(image)
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Failed to get the focal point of %s: %s\n", fileName, err.Error())
+		}
+		// Moving the focal point must not serve the old crop
+		if opts.Focal != nil {
+			suffix = fmt.Sprintf("-f%g,%g", opts.Focal.X, opts.Focal.Y)
+		}
+	}
+	if opts.Width > 0 || opts.Height > 0 {
+		setHintHeaders(c)
+		if dpr := requestDPR(c, preset.MaxDPR); dpr > 1 {
+			opts.Width = int(math.Round(float64(opts.Width) * dpr))
+			opts.Height = int(math.Round(float64(opts.Height) * dpr))
+			suffix += fmt.Sprintf("@%gx", dpr)
+		}
+	}
+	cacheName := fmt.Sprintf("%d-%d-%s%s.%s",
+		preset.UpdatedAt.Unix(),
+		srcInfo.ModTime().Unix(),
+		strings.TrimSuffix(fileName, filepath.Ext(fileName)),
+		suffix,
+		imaging.Format(srcPath, opts),
+	)
+	cachePath := filepath.Join(transformCacheDir(preset.Name), cacheName)
+
+	hit, err := h.ensureTransformed(srcPath, cachePath, opts)
+	if err != nil {
+		h.record(preset.Name, func(stats *TransformCacheStats) { stats.Errors++ })
+		log.Printf("Failed to apply transform %s to %s: %s\n", preset.Name, fileName, err.Error())
+		problem.Write(c, http.StatusUnprocessableEntity, "Failed to transform image")
+		return
+	}
+	h.record(preset.Name, func(stats *TransformCacheStats) {
+		if hit {
+			stats.Hits++
+		} else {
+			stats.Misses++
+		}
+	})
+
+	served, ok := watermark.Default.File(c, fileName, cachePath)
+	if !ok {
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	c.File(served)
+}
+
+// ensureTransformed makes sure cachePath holds the transformed image and
+// reports whether it was already cached.
+func (h *TransformHandler) ensureTransformed(srcPath, cachePath string, opts imaging.Options) (bool, error) {
+	if info, err := os.Stat(cachePath); err == nil {
+		janitor.Touch(cachePath, info)
+		return true, nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, err := os.Stat(cachePath); err == nil {
+		return true, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0o755); err != nil {
+		return false, err
+	}
+
+	tmpPath := cachePath + ".tmp"
+	if err := imaging.ProcessFile(srcPath, tmpPath, opts); err != nil {
+		os.Remove(tmpPath)
+		return false, err
+	}
+
+	return false, os.Rename(tmpPath, cachePath)
+}
+
+// uploadOptions returns how images uploaded with preset are processed. The
+// transform preset it links to replaces its width and height, except for the
+// format as uploaded files keep their name.
+func uploadOptions(preset *models.UploadPreset) imaging.Options {
+	if preset.Transform == nil {
+		return imaging.Options{Width: preset.Width, Height: preset.Height}
+	}
+	opts := presetOptions(preset.Transform)
+	opts.Format = ""
+	return opts
+}
+
+func presetOptions(preset *models.TransformPreset) imaging.Options {
+	return imaging.Options{
+		Width:   preset.Width,
+		Height:  preset.Height,
+		Fit:     preset.Fit,
+		Gravity: preset.Gravity,
+		Format:  preset.Format,
+		Quality: preset.Quality,
+	}
+}
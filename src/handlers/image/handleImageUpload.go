@@ -1,13 +1,34 @@
 package handlers
 
 import (
-	"crypto/md5"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"image"
+	"io"
+	"log"
 	"net/http"
+	"os"
 	"path/filepath"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/auth"
+	"github.com/kevinanielsen/go-fast-cdn/src/events"
+	"github.com/kevinanielsen/go-fast-cdn/src/hooks"
+	"github.com/kevinanielsen/go-fast-cdn/src/imaging"
 	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/moderation"
+	"github.com/kevinanielsen/go-fast-cdn/src/placeholder"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"github.com/kevinanielsen/go-fast-cdn/src/settings"
+	"github.com/kevinanielsen/go-fast-cdn/src/similarity"
+	"github.com/kevinanielsen/go-fast-cdn/src/usage"
 	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/kevinanielsen/go-fast-cdn/src/validations"
+	"gorm.io/gorm"
 )
 
 func (h *ImageHandler) HandleImageUpload(c *gin.Context) {
@@ -15,13 +36,18 @@ func (h *ImageHandler) HandleImageUpload(c *gin.Context) {
 
 	fileHeader, err := c.FormFile("image")
 	if err != nil {
-		c.String(http.StatusBadRequest, "Failed to read file: %s", err.Error())
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			problem.Write(c, http.StatusRequestEntityTooLarge, "File is too large")
+			return
+		}
+		problem.WriteDetails(c, http.StatusBadRequest, "Failed to read file", err.Error())
 		return
 	}
 
 	file, err := fileHeader.Open()
 	if err != nil {
-		c.String(http.StatusBadRequest, "Failed to open file: %s", err.Error())
+		problem.WriteDetails(c, http.StatusBadRequest, "Failed to open file", err.Error())
 		return
 	}
 
@@ -29,29 +55,53 @@ func (h *ImageHandler) HandleImageUpload(c *gin.Context) {
 
 	fileBuffer := make([]byte, 512)
 
-	_, err = file.Read(fileBuffer)
+	n, err := file.Read(fileBuffer)
 	if err != nil {
-		c.String(http.StatusInternalServerError, "Failed to read file: %s", err.Error())
+		problem.WriteDetails(c, http.StatusInternalServerError, "Failed to read file", err.Error())
 		return
 	}
 
-	fileType := http.DetectContentType(fileBuffer)
-
-	allowedMimeTypes := map[string]bool{
-		"image/jpeg": true,
-		"image/jpg":  true,
-		"image/png":  true,
-		"image/gif":  true,
-		"image/webp": true,
-		"image/bmp":  true,
+	err = hooks.PreValidate(c, hooks.Media{
+		Type: models.MediaTypeImage, FileName: fileHeader.Filename, Size: fileHeader.Size,
+		OrganizationID: auth.OrganizationID(c), Header: fileBuffer[:n],
+		Open: func() (io.ReadCloser, error) { return fileHeader.Open() },
+	})
+	if err != nil {
+		hooks.Abort(c, err)
+		return
 	}
 
-	if !allowedMimeTypes[fileType] {
-		c.String(http.StatusBadRequest, "Invalid file type")
+	if err := validations.ValidateContentType(models.MediaTypeImage, fileHeader.Filename, fileBuffer); err != nil {
+		problem.Abort(c, problem.New(http.StatusBadRequest, problem.CodeMediaInvalidType, "Invalid file type"))
 		return
 	}
 
-	fileHashBuffer := md5.Sum(fileBuffer)
+	checksumAlgorithm := util.ChecksumAlgorithm()
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		problem.WriteDetails(c, http.StatusInternalServerError, "Failed to read file", err.Error())
+		return
+	}
+	// Files whose extension is registered for sanitizing are checksummed
+	// and stored without their active content
+	var content io.Reader = file
+	var sanitized []byte
+	if validations.RequiresSanitizing(fileHeader.Filename) {
+		data, err := io.ReadAll(file)
+		if err != nil {
+			problem.WriteDetails(c, http.StatusInternalServerError, "Failed to read file", err.Error())
+			return
+		}
+		if sanitized, err = validations.Sanitize(fileHeader.Filename, data); err != nil {
+			problem.Abort(c, problem.New(http.StatusBadRequest, problem.CodeMediaInvalidType, err.Error()))
+			return
+		}
+		content = bytes.NewReader(sanitized)
+	}
+	fileHashBuffer, err := util.Checksum(checksumAlgorithm, content)
+	if err != nil {
+		problem.WriteDetails(c, http.StatusInternalServerError, "Failed to read file", err.Error())
+		return
+	}
 
 	var filename string
 
@@ -61,40 +111,231 @@ func (h *ImageHandler) HandleImageUpload(c *gin.Context) {
 		filename = newName + filepath.Ext(fileHeader.Filename)
 	}
 
-	filteredFilename, err := util.FilterFilename(filename)
+	filteredFilename, err := util.FilterFilename(util.StoredName(settings.Default.Get(settings.FileNamingStrategy), filename, fileHashBuffer))
 	if err != nil {
-		c.String(http.StatusBadRequest, err.Error())
+		problem.Write(c, http.StatusBadRequest, err.Error())
 		return
 	}
 
 	image := models.Image{
-		FileName: filteredFilename,
-		Checksum: fileHashBuffer[:],
+		FileName:          filteredFilename,
+		OriginalName:      filename,
+		MimeType:          validations.DetectMimeType(filteredFilename, fileBuffer[:n]),
+		Checksum:          fileHashBuffer,
+		ChecksumAlgorithm: checksumAlgorithm,
+		OrganizationID:    auth.OrganizationID(c),
+		ModerationStatus:  moderation.UploadStatus(c),
+	}
+	if preset, ok := c.Get("upload_preset"); ok {
+		image.ExpiresAt = preset.(*models.UploadPreset).Expiry(time.Now())
+	}
+	if expiresAt, ok := c.Get("upload_expires_at"); ok {
+		expiresAt := expiresAt.(time.Time)
+		image.ExpiresAt = &expiresAt
 	}
 
-	imageInDatabase := h.repo.GetImageByCheckSum(fileHashBuffer[:])
-	if len(imageInDatabase.Checksum) > 0 {
-		c.JSON(http.StatusConflict, gin.H{
-			"error": "File already exists",
-		})
+	ctx := c.Request.Context()
+	imageInDatabase, err := h.repo.GetImageByCheckSum(ctx, fileHashBuffer)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		problem.Write(c, http.StatusInternalServerError, "Failed to look up existing images")
+		return
+	}
+	if err == nil {
+		existing := existingImage(c, imageInDatabase)
+		// With on_duplicate=link the upload resolves to the stored file
+		// instead of failing
+		if c.PostForm("on_duplicate") == "link" {
+			c.JSON(http.StatusOK, gin.H{
+				"file_url":  existing.FileURL,
+				"duplicate": true,
+				"existing":  existing,
+			})
+			return
+		}
+		// With ?allow_duplicate=true the new name becomes an alias of the
+		// stored file
+		if allow, _ := strconv.ParseBool(c.Query("allow_duplicate")); allow {
+			h.linkDuplicate(c, imageInDatabase, filteredFilename, existing)
+			return
+		}
+		problem.Abort(c, problem.New(http.StatusConflict, problem.CodeMediaDuplicate, "File already exists").With("existing", existing))
 		return
 	}
 
-	savedFilename, err := h.repo.AddImage(image)
+	savedFilename, err := h.repo.AddImage(ctx, image)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, err.Error())
+		problem.WriteDetails(c, http.StatusInternalServerError, "Failed to save file", err.Error())
 		return
 	}
 
-	err = c.SaveUploadedFile(fileHeader, util.ExPath+"/uploads/images/"+savedFilename)
+	err = usage.Track(models.MediaTypeImage, image.OrganizationID, savedFilename, func() error {
+		savedPath := util.ExPath + "/uploads/images/" + savedFilename
+		if sanitized != nil {
+			return os.WriteFile(savedPath, sanitized, 0o644)
+		}
+		return c.SaveUploadedFile(fileHeader, savedPath)
+	})
 	if err != nil {
-		c.String(http.StatusInternalServerError, "Failed to save file: %s", err.Error())
+		problem.WriteDetails(c, http.StatusInternalServerError, "Failed to save file", err.Error())
+		return
+	}
+
+	optimized := h.optimizeUpload(ctx, image.OrganizationID, savedFilename)
+
+	if preset, ok := c.Get("upload_preset"); ok {
+		preset := preset.(*models.UploadPreset)
+		savedPath := util.ExPath + "/uploads/images/" + savedFilename
+		err = usage.Track(models.MediaTypeImage, image.OrganizationID, savedFilename, func() error {
+			return imaging.ProcessFile(savedPath, savedPath, uploadOptions(preset))
+		})
+		if err != nil {
+			problem.WriteDetails(c, http.StatusInternalServerError, "Failed to apply preset "+preset.Name, err.Error())
+			return
+		}
+	}
+
+	placeholder.Enqueue(ctx, h.repo, savedFilename)
+	similarity.Enqueue(ctx, h.repo, savedFilename)
+	events.Record(c, events.TypeUploaded, models.MediaTypeImage+"/"+savedFilename, gin.H{"size": fileHeader.Size})
+
+	uploaded := h.uploadedImage(c, image, savedFilename, optimized)
+	notifyPending(c, image.OrganizationID, uploaded.ExistingMedia)
+	postStore(c, image.OrganizationID, uploaded.ExistingMedia)
+	c.JSON(http.StatusOK, uploaded)
+}
+
+// notifyPending tells the moderation hooks about an upload held back until
+// an admin approves it.
+func notifyPending(c *gin.Context, orgID *uint, uploaded models.ExistingMedia) {
+	if uploaded.ModerationStatus != models.ModerationStatusPending {
 		return
 	}
+	moderation.Notify(c, moderation.Notification{
+		Type: moderation.TypePending, MediaType: models.MediaTypeImage, FileName: uploaded.FileName,
+		UUID: uploaded.UUID, OrganizationID: orgID,
+	})
+}
+
+// postStore tells the upload hooks about a stored image.
+func postStore(c *gin.Context, orgID *uint, uploaded models.ExistingMedia) {
+	hooks.PostStore(c, hooks.Stored(hooks.Media{
+		Type: models.MediaTypeImage, FileName: uploaded.FileName, MimeType: uploaded.MimeType,
+		UUID: uploaded.UUID, OrganizationID: orgID,
+	}))
+}
+
+// uploadedImage describes the image an upload stored as fileName, so
+// clients do not need to look up its metadata afterwards. image is used if
+// its record cannot be read back.
+func (h *ImageHandler) uploadedImage(c *gin.Context, image models.Image, fileName string, optimized *imaging.Optimized) models.UploadedMedia {
+	stored, err := h.repo.GetImageByFileName(c.Request.Context(), fileName)
+	if err != nil {
+		log.Printf("Failed to look up uploaded image %s: %s\n", fileName, err.Error())
+		stored = image
+		stored.FileName = fileName
+	}
+
+	body := models.UploadedMedia{ExistingMedia: existingImage(c, stored)}
+	if optimized != nil {
+		body.OriginalSize = optimized.OriginalSize
+		body.OptimizedSize = optimized.OptimizedSize
+	}
+	return body
+}
+
+// optimizeUpload optimizes the newly saved image fileName if the
+// optimize_on_upload setting is on, and records its sizes before and after.
+// The image is kept as uploaded if it cannot be optimized.
+func (h *ImageHandler) optimizeUpload(ctx context.Context, orgID *uint, fileName string) *imaging.Optimized {
+	if !settings.Default.Bool(settings.OptimizeOnUpload) {
+		return nil
+	}
+
+	path := filepath.Join(util.ExPath, "uploads", "images", fileName)
+	var optimized imaging.Optimized
+	err := usage.Track(models.MediaTypeImage, orgID, fileName, func() error {
+		var err error
+		optimized, err = imaging.Optimize(path, imaging.OptimizeOptions{
+			Quality:      settings.Default.Int(settings.OptimizeQuality),
+			MaxDimension: settings.Default.Int(settings.OptimizeMaxDimension),
+		})
+		return err
+	})
+	if errors.Is(err, imaging.ErrNotOptimizable) {
+		return nil
+	} else if err != nil {
+		log.Printf("Failed to optimize image %s: %s\n", fileName, err.Error())
+		return nil
+	}
 
-	body := gin.H{
-		"file_url": c.Request.Host + "/download/images/" + savedFilename,
+	// The checksum follows the content so integrity checks still match
+	algorithm := util.ChecksumAlgorithm()
+	checksum, err := util.FileChecksum(algorithm, path)
+	if err == nil {
+		err = h.repo.UpdateImageOptimization(ctx, fileName, optimized.OriginalSize, optimized.OptimizedSize, algorithm, checksum)
+	}
+	if err != nil {
+		log.Printf("Failed to record the optimization of image %s: %s\n", fileName, err.Error())
+	}
+	return &optimized
+}
+
+// linkDuplicate answers an upload of the content of stored under fileName by
+// making fileName an alias of stored, so downloads of it are redirected
+func (h *ImageHandler) linkDuplicate(c *gin.Context, stored models.Image, fileName string, existing models.ExistingMedia) {
+	ctx := c.Request.Context()
+	if fileName != stored.FileName {
+		_, err := h.repo.GetImageByFileName(ctx, fileName)
+		if err == nil {
+			problem.Abort(c, problem.New(http.StatusConflict, problem.CodeMediaNameTaken, "File name already taken").With("existing", existing))
+			return
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			problem.Write(c, http.StatusInternalServerError, "Failed to look up existing images")
+			return
+		}
+		if err := h.aliasRepo.AddAlias(ctx, models.MediaTypeImage, fileName, stored.UUID); err != nil {
+			problem.WriteDetails(c, http.StatusInternalServerError, "Failed to link the file", err.Error())
+			return
+		}
+		events.Record(c, events.TypeUploaded, models.MediaTypeImage+"/"+fileName, gin.H{"alias_of": stored.FileName})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"file_url":  c.Request.Host + "/download/images/" + fileName,
+		"duplicate": true,
+		"alias":     fileName != stored.FileName,
+		"existing":  existing,
+	})
+}
+
+// existingImage describes a stored image for duplicate upload responses
+func existingImage(c *gin.Context, img models.Image) models.ExistingMedia {
+	existing := models.ExistingMedia{
+		UUID:             img.UUID,
+		ID:               img.ID,
+		Type:             models.MediaTypeImage,
+		FileName:         img.FileName,
+		FileURL:          c.Request.Host + "/download/images/" + img.FileName,
+		DownloadURL:      c.Request.Host + "/api/cdn/download/images/" + img.FileName,
+		Checksum:         hex.EncodeToString(img.Checksum),
+		CreatedAt:        img.CreatedAt,
+		MimeType:         img.MimeType,
+		ExpiresAt:        img.ExpiresAt,
+		ModerationStatus: img.ModerationStatus,
+		RenditionsURL:    c.Request.Host + "/api/cdn/media/" + img.UUID + "/renditions",
+	}
+
+	filePath := filepath.Join(util.ExPath, "uploads", "images", img.FileName)
+	if info, err := os.Stat(filePath); err == nil {
+		existing.FileSize = info.Size()
+	}
+	if file, err := os.Open(filePath); err == nil {
+		defer file.Close()
+		if config, _, err := image.DecodeConfig(file); err == nil {
+			existing.Width = config.Width
+			existing.Height = config.Height
+		}
 	}
 
-	c.JSON(http.StatusOK, body)
+	return existing
 }
@@ -1,17 +1,25 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"image"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/gin-gonic/gin"
 	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
 	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/kevinanielsen/go-fast-cdn/src/validations"
 	"github.com/stretchr/testify/require"
 )
 
@@ -45,11 +53,20 @@ func TestHandleImageUpload_NoError(t *testing.T) {
 	}()
 
 	// handling
-	imageHandler := NewImageHandler(database.NewImageRepo(database.DB))
+	imageHandler := NewImageHandler(database.NewImageRepo(database.DB), database.NewMediaRelationRepo(database.DB), database.NewRenditionRepo(database.DB), database.NewMediaAliasRepo(database.DB))
 	imageHandler.HandleImageUpload(c)
 
 	// assert
 	require.Equal(t, http.StatusOK, w.Result().StatusCode)
+	var body models.UploadedMedia
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	require.NotZero(t, body.ID)
+	require.Equal(t, models.MediaTypeImage, body.Type)
+	require.Equal(t, 200, body.Width)
+	require.Equal(t, 200, body.Height)
+	require.Equal(t, "image/jpeg", body.MimeType)
+	require.NotEmpty(t, body.Checksum)
+	require.Positive(t, body.FileSize)
 }
 
 func TestHandleImageUpload_ReadFailed_NoFile(t *testing.T) {
@@ -82,12 +99,15 @@ func TestHandleImageUpload_ReadFailed_NoFile(t *testing.T) {
 	}()
 
 	// handling
-	imageHandler := NewImageHandler(database.NewImageRepo(database.DB))
+	imageHandler := NewImageHandler(database.NewImageRepo(database.DB), database.NewMediaRelationRepo(database.DB), database.NewRenditionRepo(database.DB), database.NewMediaAliasRepo(database.DB))
 	imageHandler.HandleImageUpload(c)
 
 	// assert
 	require.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
-	require.Equal(t, w.Body.String(), "Failed to read file: http: no such file")
+	var body problem.Details
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	require.Equal(t, "Failed to read file", body.Detail)
+	require.Equal(t, "http: no such file", body.Details)
 }
 
 func TestHandleImageUpload_ReadFailed_EOF(t *testing.T) {
@@ -119,12 +139,15 @@ func TestHandleImageUpload_ReadFailed_EOF(t *testing.T) {
 	}()
 
 	// handling
-	imageHandler := NewImageHandler(database.NewImageRepo(database.DB))
+	imageHandler := NewImageHandler(database.NewImageRepo(database.DB), database.NewMediaRelationRepo(database.DB), database.NewRenditionRepo(database.DB), database.NewMediaAliasRepo(database.DB))
 	imageHandler.HandleImageUpload(c)
 
 	// assert
 	require.Equal(t, http.StatusInternalServerError, w.Result().StatusCode)
-	require.Equal(t, w.Body.String(), "Failed to read file: EOF")
+	var body problem.Details
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	require.Equal(t, "Failed to read file", body.Detail)
+	require.Equal(t, "EOF", body.Details)
 }
 
 func TestHandleImageUpload_InvalidType(t *testing.T) {
@@ -156,12 +179,14 @@ func TestHandleImageUpload_InvalidType(t *testing.T) {
 	}()
 
 	// handling
-	imageHandler := NewImageHandler(database.NewImageRepo(database.DB))
+	imageHandler := NewImageHandler(database.NewImageRepo(database.DB), database.NewMediaRelationRepo(database.DB), database.NewRenditionRepo(database.DB), database.NewMediaAliasRepo(database.DB))
 	imageHandler.HandleImageUpload(c)
 
 	// assert
 	require.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
-	require.Equal(t, w.Body.String(), "Invalid file type")
+	var body problem.Details
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	require.Equal(t, "Invalid file type", body.Detail)
 }
 
 func TestHandleImageUpload_InvalidFilename(t *testing.T) {
@@ -194,12 +219,14 @@ func TestHandleImageUpload_InvalidFilename(t *testing.T) {
 	}()
 
 	// handling
-	imageHandler := NewImageHandler(database.NewImageRepo(database.DB))
+	imageHandler := NewImageHandler(database.NewImageRepo(database.DB), database.NewMediaRelationRepo(database.DB), database.NewRenditionRepo(database.DB), database.NewMediaAliasRepo(database.DB))
 	imageHandler.HandleImageUpload(c)
 
 	// assert
 	require.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
-	require.Equal(t, w.Body.String(), "filename cannot contain more than one period character")
+	var body problem.Details
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	require.Equal(t, "filename cannot contain more than one period character", body.Detail)
 }
 
 func TestHandleImageUpload_FileExist(t *testing.T) {
@@ -232,7 +259,7 @@ func TestHandleImageUpload_FileExist(t *testing.T) {
 	c.Request.Header.Add("Content-Type", writer.FormDataContentType())
 
 	// first handling
-	imageHandler := NewImageHandler(database.NewImageRepo(database.DB))
+	imageHandler := NewImageHandler(database.NewImageRepo(database.DB), database.NewMediaRelationRepo(database.DB), database.NewRenditionRepo(database.DB), database.NewMediaAliasRepo(database.DB))
 	imageHandler.HandleImageUpload(c)
 
 	// first statement
@@ -255,5 +282,141 @@ func TestHandleImageUpload_FileExist(t *testing.T) {
 
 	// second statement
 	require.Equal(t, http.StatusConflict, ww.Result().StatusCode)
-	require.Equal(t, ww.Body.String(), `{"error":"File already exists"}`)
+	var body struct {
+		Error    string               `json:"error"`
+		Existing models.ExistingMedia `json:"existing"`
+	}
+	require.NoError(t, json.Unmarshal(ww.Body.Bytes(), &body))
+	require.Equal(t, "File already exists", body.Error)
+	require.NotEmpty(t, body.Existing.UUID)
+	require.Equal(t, "image.img", body.Existing.FileName)
+	require.Equal(t, models.MediaTypeImage, body.Existing.Type)
+	require.Contains(t, body.Existing.DownloadURL, "/api/cdn/download/images/image.img")
+	require.Equal(t, 200, body.Existing.Width)
+}
+
+func TestHandleImageUpload_Optimize(t *testing.T) {
+	// Arrange
+	t.Setenv("OPTIMIZE_ON_UPLOAD", "true")
+	t.Setenv("OPTIMIZE_MAX_DIMENSION", "100")
+	h := newTestImageHandler(t)
+	require.NoError(t, os.MkdirAll(filepath.Join(util.ExPath, "uploads", "images"), 0o755))
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("image", "large.jpg")
+	require.NoError(t, err)
+	img, _ := createDummyImage(400, 200)
+	require.NoError(t, EncodeImage(part, img))
+	require.NoError(t, writer.Close())
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/cdn/upload/image", body)
+	c.Request.Header.Add("Content-Type", writer.FormDataContentType())
+
+	// Act
+	h.HandleImageUpload(c)
+
+	// Assert
+	require.Equal(t, http.StatusOK, w.Code)
+	stored, err := database.NewImageRepo(database.DB).GetImageByFileName(c.Request.Context(), "large.jpg")
+	require.NoError(t, err)
+	require.Positive(t, stored.OriginalSize)
+	path := filepath.Join(util.ExPath, "uploads", "images", "large.jpg")
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, info.Size(), stored.OptimizedSize)
+	checksum, err := util.FileChecksum(stored.ChecksumAlgorithm, path)
+	require.NoError(t, err)
+	require.Equal(t, checksum, stored.Checksum)
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	config, _, err := image.DecodeConfig(file)
+	require.NoError(t, err)
+	require.Equal(t, 100, config.Width)
+	require.Equal(t, 50, config.Height)
+}
+
+func TestHandleImageUpload_SanitizeSVG(t *testing.T) {
+	// Arrange
+	h := newTestImageHandler(t)
+	require.NoError(t, os.MkdirAll(filepath.Join(util.ExPath, "uploads", "images"), 0o755))
+	repo := database.NewMimeTypeRuleRepo(database.DB)
+	require.NoError(t, repo.SaveMimeTypeRule(context.Background(), &models.MimeTypeRule{Extension: ".svg", MimeType: "image/svg+xml", MediaType: models.MediaTypeImage, Sanitize: true}))
+	require.NoError(t, validations.LoadMimeTypeRules(context.Background(), repo))
+	t.Cleanup(func() {
+		repo.DeleteMimeTypeRule(context.Background(), ".svg")
+		validations.LoadMimeTypeRules(context.Background(), repo)
+	})
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("image", "logo.svg")
+	require.NoError(t, err)
+	_, err = part.Write([]byte(`<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" onload="alert(1)">` +
+		`<script>alert(2)</script><a xlink:href=" java&#x09;script:alert(3)"><circle r="4"/></a></svg>`))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/cdn/upload/image", body)
+	c.Request.Header.Add("Content-Type", writer.FormDataContentType())
+
+	// Act
+	h.HandleImageUpload(c)
+
+	// Assert
+	require.Equal(t, http.StatusOK, w.Code)
+	path := filepath.Join(util.ExPath, "uploads", "images", "logo.svg")
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, `<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink"><a><circle r="4"></circle></a></svg>`, string(data))
+	stored, err := database.NewImageRepo(database.DB).GetImageByFileName(c.Request.Context(), "logo.svg")
+	require.NoError(t, err)
+	require.Equal(t, "image/svg+xml; charset=utf-8", stored.MimeType)
+	checksum, err := util.FileChecksum(stored.ChecksumAlgorithm, path)
+	require.NoError(t, err)
+	require.Equal(t, checksum, stored.Checksum)
+}
+
+func TestHandleImageUpload_TransformPreset(t *testing.T) {
+	// Arrange
+	h := newTestImageHandler(t)
+	require.NoError(t, os.MkdirAll(filepath.Join(util.ExPath, "uploads", "images"), 0o755))
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("image", "avatar.jpg")
+	require.NoError(t, err)
+	img, _ := createDummyImage(400, 200)
+	require.NoError(t, EncodeImage(part, img))
+	require.NoError(t, writer.Close())
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/cdn/upload/image?preset=avatar", body)
+	c.Request.Header.Add("Content-Type", writer.FormDataContentType())
+	c.Set("upload_preset", &models.UploadPreset{
+		Name:            "avatar",
+		TransformPreset: "square",
+		Transform:       &models.TransformPreset{Name: "square", Width: 64, Height: 64, Fit: "cover", Format: "webp"},
+	})
+
+	// Act
+	h.HandleImageUpload(c)
+
+	// Assert
+	require.Equal(t, http.StatusOK, w.Code)
+	file, err := os.Open(filepath.Join(util.ExPath, "uploads", "images", "avatar.jpg"))
+	require.NoError(t, err)
+	defer file.Close()
+	config, format, err := image.DecodeConfig(file)
+	require.NoError(t, err)
+	require.Equal(t, "jpeg", format)
+	require.Equal(t, 64, config.Width)
+	require.Equal(t, 64, config.Height)
 }
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/auth"
+	"github.com/kevinanielsen/go-fast-cdn/src/events"
+	"github.com/kevinanielsen/go-fast-cdn/src/hooks"
+	"github.com/kevinanielsen/go-fast-cdn/src/imaging"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/moderation"
+	"github.com/kevinanielsen/go-fast-cdn/src/placeholder"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"github.com/kevinanielsen/go-fast-cdn/src/settings"
+	"github.com/kevinanielsen/go-fast-cdn/src/similarity"
+	"github.com/kevinanielsen/go-fast-cdn/src/usage"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/kevinanielsen/go-fast-cdn/src/validations"
+	"gorm.io/gorm"
+)
+
+// maxPasteSize limits the size of a pasted image
+const maxPasteSize = 32 << 20
+
+// pasteExtensions maps the detected content type of a pasted image to the
+// extension of the stored file
+var pasteExtensions = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+	"image/bmp":  ".bmp",
+}
+
+// HandlePasteUpload stores an image sent as the raw request body, as done by
+// clipboard pastes and screenshot tools. Unless ?filename= is given the file
+// is named after the current date, e.g. screenshot-2024-05-01.png.
+func (h *ImageHandler) HandlePasteUpload(c *gin.Context) {
+	data, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxPasteSize))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			problem.Write(c, http.StatusRequestEntityTooLarge, "Pasted image is too large")
+			return
+		}
+		problem.Write(c, http.StatusBadRequest, "Failed to read body: "+err.Error())
+		return
+	}
+	if len(data) == 0 {
+		problem.Write(c, http.StatusBadRequest, "Request body is empty")
+		return
+	}
+
+	ext, ok := pasteExtensions[http.DetectContentType(data)]
+	if !ok {
+		problem.Abort(c, problem.New(http.StatusBadRequest, problem.CodeMediaInvalidType, "Invalid file type"))
+		return
+	}
+
+	err = hooks.PreValidate(c, hooks.Media{
+		Type: models.MediaTypeImage, FileName: c.DefaultQuery("filename", "screenshot") + ext, Size: int64(len(data)),
+		OrganizationID: auth.OrganizationID(c), Header: data[:min(len(data), 512)],
+		Open: func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(data)), nil },
+	})
+	if err != nil {
+		hooks.Abort(c, err)
+		return
+	}
+
+	// The checksum is computed like for regular uploads so that duplicates
+	// are detected across both endpoints
+	checksumAlgorithm := util.ChecksumAlgorithm()
+	fileHashBuffer, err := util.Checksum(checksumAlgorithm, bytes.NewReader(data))
+	if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to read file")
+		return
+	}
+
+	ctx := c.Request.Context()
+	imageInDatabase, err := h.repo.GetImageByCheckSum(ctx, fileHashBuffer)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		problem.Write(c, http.StatusInternalServerError, "Failed to look up existing images")
+		return
+	}
+	if err == nil {
+		existing := existingImage(c, imageInDatabase)
+		if c.Query("on_duplicate") == "link" {
+			c.JSON(http.StatusOK, gin.H{
+				"file_url":  existing.FileURL,
+				"duplicate": true,
+				"existing":  existing,
+			})
+			return
+		}
+		problem.Abort(c, problem.New(http.StatusConflict, problem.CodeMediaDuplicate, "File already exists").With("existing", existing))
+		return
+	}
+
+	now := time.Now()
+	baseName := c.Query("filename")
+	if baseName == "" {
+		baseName = "screenshot-" + now.Format("2006-01-02")
+	}
+	filteredFilename, err := util.FilterFilename(util.StoredName(settings.Default.Get(settings.FileNamingStrategy), baseName+ext, fileHashBuffer))
+	if err != nil {
+		problem.Write(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	filename, err := h.availableName(ctx, strings.TrimSuffix(filteredFilename, ext), ext)
+	if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to look up existing images")
+		return
+	}
+
+	image := models.Image{
+		FileName:          filename,
+		OriginalName:      baseName + ext,
+		MimeType:          validations.DetectMimeType(filename, data),
+		Checksum:          fileHashBuffer,
+		ChecksumAlgorithm: checksumAlgorithm,
+		OrganizationID:    auth.OrganizationID(c),
+		ModerationStatus:  moderation.UploadStatus(c),
+	}
+	preset, hasPreset := c.Get("upload_preset")
+	if hasPreset {
+		image.ExpiresAt = preset.(*models.UploadPreset).Expiry(now)
+	}
+	if expiresAt, ok := c.Get("upload_expires_at"); ok {
+		expiresAt := expiresAt.(time.Time)
+		image.ExpiresAt = &expiresAt
+	}
+
+	savedFilename, err := h.repo.AddImage(ctx, image)
+	if err != nil {
+		problem.Write(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	savedPath := filepath.Join(util.ExPath, "uploads", "images", savedFilename)
+	err = usage.Track(models.MediaTypeImage, image.OrganizationID, savedFilename, func() error {
+		return os.WriteFile(savedPath, data, 0o644)
+	})
+	if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to save file: "+err.Error())
+		return
+	}
+
+	optimized := h.optimizeUpload(ctx, image.OrganizationID, savedFilename)
+
+	if hasPreset {
+		preset := preset.(*models.UploadPreset)
+		err = usage.Track(models.MediaTypeImage, image.OrganizationID, savedFilename, func() error {
+			return imaging.ProcessFile(savedPath, savedPath, uploadOptions(preset))
+		})
+		if err != nil {
+			problem.Write(c, http.StatusInternalServerError, fmt.Sprintf("Failed to apply preset %s: %s", preset.Name, err.Error()))
+			return
+		}
+	}
+
+	placeholder.Enqueue(ctx, h.repo, savedFilename)
+	similarity.Enqueue(ctx, h.repo, savedFilename)
+	events.Record(c, events.TypeUploaded, models.MediaTypeImage+"/"+savedFilename, gin.H{"size": len(data)})
+
+	uploaded := h.uploadedImage(c, image, savedFilename, optimized)
+	notifyPending(c, image.OrganizationID, uploaded.ExistingMedia)
+	postStore(c, image.OrganizationID, uploaded.ExistingMedia)
+	c.JSON(http.StatusOK, uploaded)
+}
+
+// availableName returns baseName+ext, or baseName-2+ext, baseName-3+ext and
+// so on if that name is taken
+func (h *ImageHandler) availableName(ctx context.Context, baseName, ext string) (string, error) {
+	name := baseName + ext
+	for i := 2; ; i++ {
+		_, err := h.repo.GetImageByFileName(ctx, name)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return name, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		name = fmt.Sprintf("%s-%d%s", baseName, i, ext)
+	}
+}
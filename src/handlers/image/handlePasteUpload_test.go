@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandlePasteUpload(t *testing.T) {
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	require.NoError(t, os.MkdirAll(filepath.Join(util.ExPath, "uploads", "images"), 0o755))
+
+	imageRepo := database.NewImageRepo(database.DB)
+	imageHandler := NewImageHandler(imageRepo, database.NewMediaRelationRepo(database.DB), database.NewRenditionRepo(database.DB), database.NewMediaAliasRepo(database.DB))
+
+	paste := func(width int, preset *models.UploadPreset) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		img, _ := createDummyImage(width, 10)
+		require.NoError(t, png.Encode(&body, img))
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/cdn/upload/paste", &body)
+		if preset != nil {
+			c.Set("upload_preset", preset)
+		}
+		imageHandler.HandlePasteUpload(c)
+		return w
+	}
+
+	expected := "screenshot-" + time.Now().Format("2006-01-02")
+
+	w := paste(10, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var res map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	require.Equal(t, expected+".png", res["file_name"])
+	require.Nil(t, res["expires_at"])
+	require.FileExists(t, filepath.Join(util.ExPath, "uploads", "images", expected+".png"))
+
+	w = paste(20, &models.UploadPreset{Name: "screenshots", ExpiresIn: 3600})
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	require.Equal(t, expected+"-2.png", res["file_name"])
+	image, err := imageRepo.GetImageByFileName(context.Background(), expected+"-2.png")
+	require.NoError(t, err)
+	require.NotNil(t, image.ExpiresAt)
+
+	w = paste(20, nil)
+	require.Equal(t, http.StatusConflict, w.Code)
+
+	w = httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/cdn/upload/paste", bytes.NewBufferString("not an image"))
+	imageHandler.HandlePasteUpload(c)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
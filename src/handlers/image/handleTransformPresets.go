@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/imaging"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"gorm.io/gorm"
+)
+
+type transformPresetRequest struct {
+	Name    string  `json:"name" binding:"required"`
+	Width   int     `json:"width" binding:"min=0"`
+	Height  int     `json:"height" binding:"min=0"`
+	Fit     string  `json:"fit" binding:"omitempty,oneof=fill contain cover"`
+	Gravity string  `json:"gravity" binding:"omitempty,oneof=center north south east west focal smart"`
+	Format  string  `json:"format" binding:"omitempty,oneof=png jpg jpeg bmp"`
+	Quality int     `json:"quality" binding:"min=0,max=100"`
+	Signed  bool    `json:"signed"`
+	MaxDPR  float64 `json:"max_dpr" binding:"min=0,max=3"`
+}
+
+func (r transformPresetRequest) apply(preset *models.TransformPreset) {
+	preset.Name = r.Name
+	preset.Width = r.Width
+	preset.Height = r.Height
+	preset.Fit = r.Fit
+	preset.Gravity = r.Gravity
+	preset.Format = r.Format
+	preset.Quality = r.Quality
+	preset.Signed = r.Signed
+	preset.MaxDPR = r.MaxDPR
+}
+
+// HandleListTransformPresets returns all transform presets together with
+// their cache statistics.
+func (h *TransformHandler) HandleListTransformPresets(c *gin.Context) {
+	presets, err := h.repo.GetAllTransformPresets(c.Request.Context())
+	if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to fetch transform presets")
+		return
+	}
+
+	result := []gin.H{}
+	for _, preset := range presets {
+		result = append(result, gin.H{
+			"preset": preset,
+			"stats":  h.cacheStats(preset.Name),
+		})
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// HandleCreateTransformPreset adds a transform preset
+func (h *TransformHandler) HandleCreateTransformPreset(c *gin.Context) {
+	var req transformPresetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Invalid(c, err)
+		return
+	}
+	if existing, _ := h.repo.GetTransformPresetByName(c.Request.Context(), req.Name); existing != nil {
+		problem.Write(c, http.StatusConflict, "Transform preset already exists")
+		return
+	}
+
+	preset := &models.TransformPreset{}
+	req.apply(preset)
+	if err := h.repo.CreateTransformPreset(c.Request.Context(), preset); err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to create transform preset")
+		return
+	}
+	c.JSON(http.StatusCreated, preset)
+}
+
+// HandleUpdateTransformPreset changes a transform preset and drops its
+// cached results.
+func (h *TransformHandler) HandleUpdateTransformPreset(c *gin.Context) {
+	preset, err := h.repo.GetTransformPresetByName(c.Request.Context(), c.Param("name"))
+	if err != nil {
+		problem.NotFound(c, "Transform preset not found")
+		return
+	}
+	var req transformPresetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Invalid(c, err)
+		return
+	}
+
+	oldName := preset.Name
+	req.apply(preset)
+	if err := h.repo.UpdateTransformPreset(c.Request.Context(), preset); err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to update transform preset")
+		return
+	}
+	h.purge(oldName)
+	c.JSON(http.StatusOK, preset)
+}
+
+// HandleDeleteTransformPreset removes a transform preset and its cached
+// results.
+func (h *TransformHandler) HandleDeleteTransformPreset(c *gin.Context) {
+	name := c.Param("name")
+	err := h.repo.DeleteTransformPreset(c.Request.Context(), name)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		problem.NotFound(c, "Transform preset not found")
+		return
+	} else if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to delete transform preset")
+		return
+	}
+	h.purge(name)
+	c.JSON(http.StatusOK, gin.H{"message": "Transform preset deleted"})
+}
+
+// HandleSignTransformURL returns a signed URL applying the preset to the
+// image given in the "filename" query parameter.
+func (h *TransformHandler) HandleSignTransformURL(c *gin.Context) {
+	preset, err := h.repo.GetTransformPresetByName(c.Request.Context(), c.Param("name"))
+	if err != nil {
+		problem.NotFound(c, "Transform preset not found")
+		return
+	}
+	fileName := c.Query("filename")
+	if fileName == "" {
+		problem.Write(c, http.StatusBadRequest, "Image name is required")
+		return
+	}
+
+	signature := imaging.Sign(preset.Name, fileName)
+	c.JSON(http.StatusOK, gin.H{
+		"signature": signature,
+		"url": c.Request.Host + "/api/cdn/transform/" + url.PathEscape(preset.Name) + "/" +
+			url.PathEscape(fileName) + "?s=" + url.QueryEscape(signature),
+	})
+}
+
+// cacheStats combines the request counters of a preset with the size of its
+// cache folder.
+func (h *TransformHandler) cacheStats(preset string) TransformCacheStats {
+	h.statsMu.Lock()
+	stats := TransformCacheStats{}
+	if counters, ok := h.stats[preset]; ok {
+		stats = *counters
+	}
+	h.statsMu.Unlock()
+
+	_ = filepath.Walk(transformCacheDir(preset), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			stats.CachedFiles++
+			stats.CachedBytes += info.Size()
+		}
+		return nil
+	})
+
+	return stats
+}
+
+// purge removes the cached results and counters of a preset.
+func (h *TransformHandler) purge(preset string) {
+	h.statsMu.Lock()
+	delete(h.stats, preset)
+	h.statsMu.Unlock()
+
+	os.RemoveAll(transformCacheDir(preset))
+}
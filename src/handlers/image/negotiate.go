@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/imaging"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/renditions"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"gorm.io/gorm"
+)
+
+// negotiatedFormat is a format images are converted to for clients that
+// advertise support for it in Accept.
+type negotiatedFormat struct {
+	Format   string
+	MimeType string
+	// Kind is the kind of the renditions storing the conversions.
+	Kind string
+}
+
+// negotiatedFormats are the formats offered, best compression first.
+var negotiatedFormats = []negotiatedFormat{
+	{Format: "avif", MimeType: "image/avif", Kind: models.RenditionAVIF},
+	{Format: "webp", MimeType: "image/webp", Kind: models.RenditionWebP},
+}
+
+// negotiableSources are the formats of the images converted. GIFs would lose
+// their animation, and other formats are rare or already compact.
+var negotiableSources = map[string]bool{"jpg": true, "jpeg": true, "png": true}
+
+// offeredFormats returns the negotiated formats the image backend writes.
+func offeredFormats() []negotiatedFormat {
+	offered := []negotiatedFormat{}
+	for _, format := range negotiatedFormats {
+		if imaging.Saves(format.Format) {
+			offered = append(offered, format)
+		}
+	}
+	return offered
+}
+
+// acceptedFormat returns the offered format with the highest quality value
+// in the Accept header, preferring the earlier one on ties, or nil if the
+// client accepts none. Only the exact media types count, since clients
+// send image/* without being able to decode every format.
+func acceptedFormat(accept string, offered []negotiatedFormat) *negotiatedFormat {
+	var best *negotiatedFormat
+	bestQ := 0.0
+	for i := range offered {
+		if q := acceptQuality(accept, offered[i].MimeType); q > bestQ {
+			best, bestQ = &offered[i], q
+		}
+	}
+	return best
+}
+
+// acceptQuality returns the quality value Accept gives mimeType, 0 if it is
+// not listed.
+func acceptQuality(accept, mimeType string) float64 {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, _ := strings.Cut(part, ";")
+		if !strings.EqualFold(strings.TrimSpace(mediaType), mimeType) {
+			continue
+		}
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(name, "q") {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil && parsed >= 0 && parsed <= 1 {
+					q = parsed
+				}
+			}
+		}
+		return q
+	}
+	return 0
+}
+
+// NegotiateFormat serves image downloads as AVIF or WebP to clients that
+// advertise support for them in Accept, when the image backend writes the
+// format and the result is smaller than the original. Conversions are
+// stored as renditions of the image, so every image is converted once and
+// the copies are deleted with it. Downloads with ?download=true keep the
+// original file.
+func (h *ImageHandler) NegotiateFormat() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			c.Next()
+			return
+		}
+		offered := offeredFormats()
+		fileName, err := util.FilterFilename(path.Base(c.Request.URL.Path))
+		if len(offered) == 0 || err != nil || !negotiableSources[imaging.Format(fileName, imaging.Options{})] {
+			c.Next()
+			return
+		}
+		if download, err := strconv.ParseBool(c.Query("download")); err == nil && download {
+			c.Next()
+			return
+		}
+		// Shared caches must not serve a converted image to clients that
+		// cannot decode it, nor the original to those that can
+		c.Writer.Header().Add("Vary", "Accept")
+
+		format := acceptedFormat(c.GetHeader("Accept"), offered)
+		if format == nil {
+			c.Next()
+			return
+		}
+		srcPath := filepath.Join(util.ExPath, "uploads", "images", fileName)
+		srcInfo, err := os.Stat(srcPath)
+		if err != nil || srcInfo.IsDir() {
+			c.Next()
+			return
+		}
+		image, err := h.repo.GetImageByFileName(c.Request.Context(), fileName)
+		if err != nil {
+			c.Next()
+			return
+		}
+
+		rendition, err := h.formatRendition(c.Request.Context(), image, srcPath, srcInfo, *format)
+		if err != nil {
+			log.Printf("Failed to convert %s to %s: %s\n", fileName, format.Format, err.Error())
+			c.Next()
+			return
+		}
+		if rendition.Size >= srcInfo.Size() {
+			c.Next()
+			return
+		}
+
+		renditions.Touch(c.Request.Context(), h.renditionRepo, &rendition)
+		c.Header("Content-Type", format.MimeType)
+		c.File(filepath.Join(renditions.Dir(), rendition.FileName))
+		c.Abort()
+	}
+}
+
+// formatRendition returns the rendition of the image in format, converting
+// the file at srcPath when there is none yet or the file changed since.
+func (h *ImageHandler) formatRendition(ctx context.Context, image models.Image, srcPath string, srcInfo os.FileInfo, format negotiatedFormat) (models.Rendition, error) {
+	current := func() (models.Rendition, bool, error) {
+		rendition, err := h.renditionRepo.GetRendition(ctx, models.MediaTypeImage, image.ID, format.Kind, "")
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return rendition, false, nil
+		} else if err != nil {
+			return rendition, false, err
+		}
+		if rendition.UpdatedAt.Before(srcInfo.ModTime()) {
+			return rendition, false, nil
+		}
+		_, err = os.Stat(filepath.Join(renditions.Dir(), rendition.FileName))
+		return rendition, err == nil, nil
+	}
+	if rendition, ok, err := current(); ok || err != nil {
+		return rendition, err
+	}
+
+	h.convertMu.Lock()
+	defer h.convertMu.Unlock()
+	if rendition, ok, err := current(); ok || err != nil {
+		return rendition, err
+	}
+
+	ext := "." + format.Format
+	tmp, err := renditions.CreateTemp(ext)
+	if err != nil {
+		return models.Rendition{}, err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	if err := imaging.ProcessFile(srcPath, tmp.Name(), imaging.Options{Format: format.Format}); err != nil {
+		return models.Rendition{}, err
+	}
+
+	rendition := models.Rendition{
+		SourceType:  models.MediaTypeImage,
+		SourceID:    image.ID,
+		Kind:        format.Kind,
+		ContentType: format.MimeType,
+	}
+	if width, height, ok := imageSize(srcPath); ok {
+		rendition.Width, rendition.Height = width, height
+	}
+	err = renditions.Save(ctx, h.renditionRepo, &rendition, tmp.Name(), ext)
+	return rendition, err
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"context"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/imaging"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/stretchr/testify/require"
+)
+
+// webpProcessor pretends to convert images to WebP, leaving other formats
+// to the Go backend.
+type webpProcessor struct {
+	imaging.GoProcessor
+	conversions int
+}
+
+func (p *webpProcessor) Saves(format string) bool {
+	return format == "webp" || p.GoProcessor.Saves(format)
+}
+
+func (p *webpProcessor) ProcessFile(src, dst string, opts imaging.Options) error {
+	if opts.Format != "webp" {
+		return p.GoProcessor.ProcessFile(src, dst, opts)
+	}
+	p.conversions++
+	return os.WriteFile(dst, []byte("RIFF webp"), 0o644)
+}
+
+func TestAcceptedFormat(t *testing.T) {
+	offered := negotiatedFormats
+	require.Nil(t, acceptedFormat("", offered))
+	require.Nil(t, acceptedFormat("image/*,*/*;q=0.8", offered))
+	require.Equal(t, "avif", acceptedFormat("image/avif,image/webp,image/apng,image/*,*/*;q=0.8", offered).Format)
+	require.Equal(t, "webp", acceptedFormat("image/avif;q=0.5, image/webp", offered).Format)
+	require.Equal(t, "webp", acceptedFormat("image/avif;q=0,image/webp", offered).Format)
+	require.Equal(t, "webp", acceptedFormat("image/avif,image/webp", offered[1:]).Format)
+}
+
+func TestNegotiateFormat(t *testing.T) {
+	h := newTestImageHandler(t)
+	processor := &webpProcessor{}
+	imaging.SetProcessor(processor)
+	t.Cleanup(func() { imaging.SetProcessor(imaging.GoProcessor{}) })
+
+	imageDir := filepath.Join(util.ExPath, "uploads", "images")
+	require.NoError(t, os.MkdirAll(imageDir, 0o755))
+	file, err := os.Create(filepath.Join(imageDir, "photo.png"))
+	require.NoError(t, err)
+	img, _ := createDummyImage(200, 100)
+	require.NoError(t, png.Encode(file, img))
+	require.NoError(t, file.Close())
+	_, err = database.NewImageRepo(database.DB).AddImage(context.Background(), models.Image{FileName: "photo.png", Checksum: []byte("photo")})
+	require.NoError(t, err)
+
+	router := gin.New()
+	router.Group("/download/images", h.NegotiateFormat()).Static("/", imageDir)
+	get := func(target, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		return w
+	}
+
+	webp := get("/download/images/photo.png", "image/avif,image/webp,*/*")
+	require.Equal(t, "image/webp", webp.Header().Get("Content-Type"))
+	require.Equal(t, "RIFF webp", webp.Body.String())
+	require.Equal(t, "Accept", webp.Header().Get("Vary"))
+
+	original := get("/download/images/photo.png", "image/*")
+	require.Equal(t, "image/png", original.Header().Get("Content-Type"))
+	require.Equal(t, "Accept", original.Header().Get("Vary"))
+
+	// The conversion is stored as a rendition and reused
+	get("/download/images/photo.png", "image/webp")
+	require.Equal(t, 1, processor.conversions)
+	renditions, err := database.NewRenditionRepo(database.DB).GetRenditions(context.Background(), models.MediaTypeImage, 1)
+	require.NoError(t, err)
+	require.Len(t, renditions, 1)
+	require.Equal(t, models.RenditionWebP, renditions[0].Kind)
+
+	download := get("/download/images/photo.png?download=true", "image/webp")
+	require.Equal(t, "image/png", download.Header().Get("Content-Type"))
+}
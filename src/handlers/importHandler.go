@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/audit"
+	"github.com/kevinanielsen/go-fast-cdn/src/importer"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+)
+
+type ImportHandler struct {
+	jobs    *importer.Jobs
+	orgRepo models.OrganizationRepository
+}
+
+func NewImportHandler(jobs *importer.Jobs, orgRepo models.OrganizationRepository) *ImportHandler {
+	return &ImportHandler{jobs: jobs, orgRepo: orgRepo}
+}
+
+// CreateImport starts importing a directory inside IMPORT_ROOT, selected with
+// {"dir": "old-cdn", "dry_run": true, "organization_id": 1}. The import runs
+// in the background; poll GetImport for its progress.
+func (h *ImportHandler) CreateImport(c *gin.Context) {
+	var req struct {
+		Dir            string `json:"dir" binding:"required"`
+		DryRun         bool   `json:"dry_run"`
+		OrganizationID *uint  `json:"organization_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Invalid(c, err)
+		return
+	}
+	if req.OrganizationID != nil {
+		if _, err := h.orgRepo.GetOrganizationByID(c.Request.Context(), *req.OrganizationID); err != nil {
+			problem.NotFound(c, "No organization with this ID")
+			return
+		}
+	}
+
+	job, err := h.jobs.Start(req.Dir, req.DryRun, req.OrganizationID, c.GetString("user_email"))
+	switch {
+	case errors.Is(err, importer.ErrDisabled):
+		problem.Write(c, http.StatusForbidden, err.Error())
+		return
+	case errors.Is(err, importer.ErrAlreadyRunning):
+		problem.Write(c, http.StatusConflict, err.Error())
+		return
+	case errors.Is(err, importer.ErrOutsideRoot), errors.Is(err, fs.ErrNotExist):
+		problem.WriteDetails(c, http.StatusBadRequest, "Invalid directory", err.Error())
+		return
+	case err != nil:
+		problem.WriteDetails(c, http.StatusInternalServerError, "Failed to start import", err.Error())
+		return
+	}
+	audit.Record(c, audit.ActionImportStarted, job.Dir, gin.H{"dry_run": job.DryRun, "organization_id": job.OrganizationID})
+
+	c.JSON(http.StatusAccepted, job)
+}
+
+// ListImports returns every import since the server started, newest first
+func (h *ImportHandler) ListImports(c *gin.Context) {
+	c.JSON(http.StatusOK, h.jobs.List())
+}
+
+// GetImport returns the status and progress of an import
+func (h *ImportHandler) GetImport(c *gin.Context) {
+	job, err := h.jobs.Get(c.Param("id"))
+	if err != nil {
+		problem.NotFound(c, "Import not found")
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
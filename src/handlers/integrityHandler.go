@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/audit"
+	"github.com/kevinanielsen/go-fast-cdn/src/integrity"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+)
+
+type IntegrityHandler struct {
+	checker *integrity.Checker
+}
+
+func NewIntegrityHandler(checker *integrity.Checker) *IntegrityHandler {
+	return &IntegrityHandler{checker: checker}
+}
+
+// GetIntegrityStatus returns the state of the integrity checker and the
+// report of its last check
+func (h *IntegrityHandler) GetIntegrityStatus(c *gin.Context) {
+	if h.checker == nil {
+		c.JSON(http.StatusOK, integrity.Status{})
+		return
+	}
+	c.JSON(http.StatusOK, h.checker.Status())
+}
+
+// ListIntegrityIssues returns the files found missing or corrupted by their
+// last check
+func (h *IntegrityHandler) ListIntegrityIssues(c *gin.Context) {
+	if h.checker == nil {
+		c.JSON(http.StatusOK, []integrity.Issue{})
+		return
+	}
+	issues, err := h.checker.Issues(c.Request.Context())
+	if err != nil {
+		problem.WriteDetails(c, http.StatusInternalServerError, "Failed to list integrity issues", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, issues)
+}
+
+// RunIntegrityCheck starts re-hashing every file in the background; poll
+// GetIntegrityStatus for the report
+func (h *IntegrityHandler) RunIntegrityCheck(c *gin.Context) {
+	if h.checker == nil {
+		problem.Write(c, http.StatusConflict, "The integrity checker is not running")
+		return
+	}
+	go h.checker.Run()
+	audit.Record(c, audit.ActionIntegrityCheckRun, "", nil)
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Integrity check started"})
+}
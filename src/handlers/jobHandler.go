@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/audit"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"github.com/kevinanielsen/go-fast-cdn/src/queue"
+	"gorm.io/gorm"
+)
+
+const maxJobsListed = 500
+
+type JobHandler struct {
+	repo  models.JobRepository
+	queue *queue.Queue
+}
+
+func NewJobHandler(repo models.JobRepository, q *queue.Queue) *JobHandler {
+	return &JobHandler{repo: repo, queue: q}
+}
+
+// ListJobs returns the newest background jobs, optionally filtered with
+// ?status=queued|running|done|failed
+func (h *JobHandler) ListJobs(c *gin.Context) {
+	status := c.Query("status")
+	switch status {
+	case "", models.JobStatusQueued, models.JobStatusRunning, models.JobStatusDone, models.JobStatusFailed:
+	default:
+		problem.Write(c, http.StatusBadRequest, "Invalid status")
+		return
+	}
+
+	jobs, err := h.repo.GetJobs(c.Request.Context(), status, maxJobsListed)
+	if err != nil {
+		problem.WriteDetails(c, http.StatusInternalServerError, "Failed to list jobs", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, jobs)
+}
+
+// GetJob returns a background job
+func (h *JobHandler) GetJob(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		problem.Write(c, http.StatusBadRequest, "Invalid job ID")
+		return
+	}
+	job, err := h.repo.GetJob(c.Request.Context(), uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		problem.NotFound(c, "Job not found")
+		return
+	} else if err != nil {
+		problem.WriteDetails(c, http.StatusInternalServerError, "Failed to get job", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// RequeueJob runs a failed job again with a fresh set of attempts
+func (h *JobHandler) RequeueJob(c *gin.Context) {
+	if h.queue == nil {
+		problem.Write(c, http.StatusConflict, "The job queue is not running")
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		problem.Write(c, http.StatusBadRequest, "Invalid job ID")
+		return
+	}
+
+	job, err := h.queue.Requeue(c.Request.Context(), uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		problem.NotFound(c, "Job not found")
+		return
+	} else if errors.Is(err, queue.ErrNotFailed) {
+		problem.Write(c, http.StatusConflict, "Only failed jobs can be requeued")
+		return
+	} else if err != nil {
+		problem.WriteDetails(c, http.StatusInternalServerError, "Failed to requeue job", err.Error())
+		return
+	}
+	audit.Record(c, audit.ActionJobRequeued, strconv.FormatUint(uint64(job.ID), 10), gin.H{"kind": job.Kind})
+
+	c.JSON(http.StatusOK, job)
+}
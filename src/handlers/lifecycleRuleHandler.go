@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/audit"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"gorm.io/gorm"
+)
+
+// LifecycleRuleHandler manages the rules that delete files once they reach
+// a certain age, applied by the expiry sweeper.
+type LifecycleRuleHandler struct {
+	ruleRepo models.LifecycleRuleRepository
+}
+
+func NewLifecycleRuleHandler(ruleRepo models.LifecycleRuleRepository) *LifecycleRuleHandler {
+	return &LifecycleRuleHandler{ruleRepo: ruleRepo}
+}
+
+type lifecycleRuleRequest struct {
+	Name           string `json:"name" binding:"required"`
+	MediaType      string `json:"media_type" binding:"omitempty,oneof=image doc"`
+	OrganizationID *uint  `json:"organization_id"`
+	Action         string `json:"action" binding:"omitempty,oneof=delete"`
+	AfterDays      int    `json:"after_days" binding:"required,min=1"`
+}
+
+func (req *lifecycleRuleRequest) apply(rule *models.LifecycleRule) {
+	rule.Name = req.Name
+	rule.MediaType = req.MediaType
+	rule.OrganizationID = req.OrganizationID
+	rule.Action = req.Action
+	if rule.Action == "" {
+		rule.Action = models.LifecycleActionDelete
+	}
+	rule.AfterDays = req.AfterDays
+}
+
+// ListLifecycleRules returns all lifecycle rules
+func (h *LifecycleRuleHandler) ListLifecycleRules(c *gin.Context) {
+	rules, err := h.ruleRepo.GetAllLifecycleRules(c.Request.Context())
+	if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to fetch lifecycle rules")
+		return
+	}
+	c.JSON(http.StatusOK, rules)
+}
+
+// CreateLifecycleRule adds a new lifecycle rule
+func (h *LifecycleRuleHandler) CreateLifecycleRule(c *gin.Context) {
+	var req lifecycleRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Invalid(c, err)
+		return
+	}
+	if existing, _ := h.ruleRepo.GetLifecycleRuleByName(c.Request.Context(), req.Name); existing != nil {
+		problem.Write(c, http.StatusConflict, "Lifecycle rule already exists")
+		return
+	}
+	rule := &models.LifecycleRule{}
+	req.apply(rule)
+	if err := h.ruleRepo.CreateLifecycleRule(c.Request.Context(), rule); err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to create lifecycle rule")
+		return
+	}
+
+	audit.Record(c, audit.ActionLifecycleUpdated, "lifecycle_rules", rule)
+	c.JSON(http.StatusCreated, rule)
+}
+
+// UpdateLifecycleRule replaces an existing lifecycle rule
+func (h *LifecycleRuleHandler) UpdateLifecycleRule(c *gin.Context) {
+	rule, err := h.ruleRepo.GetLifecycleRuleByName(c.Request.Context(), c.Param("name"))
+	if err != nil {
+		problem.NotFound(c, "Lifecycle rule not found")
+		return
+	}
+	var req lifecycleRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Invalid(c, err)
+		return
+	}
+	req.apply(rule)
+	if err := h.ruleRepo.UpdateLifecycleRule(c.Request.Context(), rule); err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to update lifecycle rule")
+		return
+	}
+
+	audit.Record(c, audit.ActionLifecycleUpdated, "lifecycle_rules", rule)
+	c.JSON(http.StatusOK, rule)
+}
+
+// DeleteLifecycleRule removes a lifecycle rule
+func (h *LifecycleRuleHandler) DeleteLifecycleRule(c *gin.Context) {
+	name := c.Param("name")
+	err := h.ruleRepo.DeleteLifecycleRule(c.Request.Context(), name)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		problem.NotFound(c, "Lifecycle rule not found")
+		return
+	} else if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to delete lifecycle rule")
+		return
+	}
+
+	audit.Record(c, audit.ActionLifecycleUpdated, "lifecycle_rules", gin.H{"name": name, "deleted": true})
+	c.JSON(http.StatusOK, gin.H{"message": "Lifecycle rule deleted"})
+}
@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+)
+
+// CommentHandler manages the comments users leave on media, e.g. to review
+// them.
+type CommentHandler struct {
+	media       *MediaHandler
+	commentRepo models.MediaCommentRepository
+}
+
+func NewCommentHandler(imageRepo models.ImageRepository, docRepo models.DocRepository, commentRepo models.MediaCommentRepository) *CommentHandler {
+	return &CommentHandler{
+		media:       &MediaHandler{imageRepo: imageRepo, docRepo: docRepo},
+		commentRepo: commentRepo,
+	}
+}
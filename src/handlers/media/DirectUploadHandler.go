@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"github.com/kevinanielsen/go-fast-cdn/src/fallback"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+)
+
+// DirectUploadHandler lets clients put files straight into object storage
+// with presigned URLs, so large uploads do not pass through the server.
+type DirectUploadHandler struct {
+	media      *MediaHandler
+	uploadRepo models.DirectUploadRepository
+	repairRepo models.RepairTaskRepository
+	// uploader returns the storage files are put into, or nil if none is
+	// configured.
+	uploader func() fallback.Uploader
+}
+
+func NewDirectUploadHandler(imageRepo models.ImageRepository, docRepo models.DocRepository, uploadRepo models.DirectUploadRepository, repairRepo models.RepairTaskRepository) *DirectUploadHandler {
+	return &DirectUploadHandler{
+		media:      &MediaHandler{imageRepo: imageRepo, docRepo: docRepo},
+		uploadRepo: uploadRepo,
+		repairRepo: repairRepo,
+		uploader:   fallback.DirectUploader,
+	}
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/acl"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"gorm.io/gorm"
+)
+
+// MediaHandler serves the endpoints that work across images and documents.
+type MediaHandler struct {
+	imageRepo     models.ImageRepository
+	docRepo       models.DocRepository
+	relationRepo  models.MediaRelationRepository
+	renditionRepo models.RenditionRepository
+}
+
+func NewMediaHandler(imageRepo models.ImageRepository, docRepo models.DocRepository, relationRepo models.MediaRelationRepository, renditionRepo models.RenditionRepository) *MediaHandler {
+	return &MediaHandler{
+		imageRepo:     imageRepo,
+		docRepo:       docRepo,
+		relationRepo:  relationRepo,
+		renditionRepo: renditionRepo,
+	}
+}
+
+// mediaRecord holds the fields images and documents have in common.
+type mediaRecord struct {
+	Type           string
+	ID             uint
+	UUID           string
+	FileName       string
+	MimeType       string
+	OrganizationID *uint
+	// Checksum was computed with ChecksumAlgorithm, see models.ChecksumMD5.
+	Checksum          []byte
+	ChecksumAlgorithm string
+	// Version is the version of the record, see models.MediaVersion, as of
+	// UpdatedAt.
+	Version   string
+	UpdatedAt time.Time
+	Metadata  models.MediaMetadata
+	// ModerationStatus tells whether the media is served publicly, see
+	// models.ModerationStatusApproved.
+	ModerationStatus string
+}
+
+func imageRecord(image models.Image) mediaRecord {
+	return mediaRecord{
+		Type: models.MediaTypeImage, ID: image.ID, UUID: image.UUID, FileName: image.FileName, MimeType: image.MimeType,
+		OrganizationID: image.OrganizationID, Version: models.MediaVersion(image.UpdatedAt), UpdatedAt: image.UpdatedAt,
+		Metadata: image.MediaMetadata, ModerationStatus: image.ModerationStatus,
+		Checksum: image.Checksum, ChecksumAlgorithm: image.ChecksumAlgorithm,
+	}
+}
+
+func docRecord(doc models.Doc) mediaRecord {
+	return mediaRecord{
+		Type: models.MediaTypeDoc, ID: doc.ID, UUID: doc.UUID, FileName: doc.FileName, MimeType: doc.MimeType,
+		OrganizationID: doc.OrganizationID, Version: models.MediaVersion(doc.UpdatedAt), UpdatedAt: doc.UpdatedAt,
+		Metadata: doc.MediaMetadata, ModerationStatus: doc.ModerationStatus,
+		Checksum: doc.Checksum, ChecksumAlgorithm: doc.ChecksumAlgorithm,
+	}
+}
+
+// resolveMedia looks up the media stored under fileName. mediaType may be
+// empty, in which case images take precedence over documents with the same
+// name. It returns gorm.ErrRecordNotFound if there is no such media.
+func (h *MediaHandler) resolveMedia(ctx context.Context, fileName, mediaType string) (mediaRecord, error) {
+	if mediaType == "" || mediaType == models.MediaTypeImage {
+		image, err := h.imageRepo.GetImageByFileName(ctx, fileName)
+		if err == nil {
+			return imageRecord(image), nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) || mediaType != "" {
+			return mediaRecord{}, err
+		}
+	}
+
+	if mediaType == "" || mediaType == models.MediaTypeDoc {
+		doc, err := h.docRepo.GetDocByFileName(ctx, fileName)
+		if err != nil {
+			return mediaRecord{}, err
+		}
+		return docRecord(doc), nil
+	}
+
+	return mediaRecord{}, gorm.ErrRecordNotFound
+}
+
+// resolveMediaByUUID looks up the image or document with the given UUID. It
+// returns gorm.ErrRecordNotFound if there is no such media.
+func (h *MediaHandler) resolveMediaByUUID(ctx context.Context, id string) (mediaRecord, error) {
+	image, err := h.imageRepo.GetImageByUUID(ctx, id)
+	if err == nil {
+		return imageRecord(image), nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return mediaRecord{}, err
+	}
+
+	doc, err := h.docRepo.GetDocByUUID(ctx, id)
+	if err != nil {
+		return mediaRecord{}, err
+	}
+	return docRecord(doc), nil
+}
+
+// abortLookup responds to a failed resolveMedia with 404 and notFound if the
+// media does not exist, or 500 otherwise.
+func abortLookup(c *gin.Context, err error, notFound string) {
+	problem.Lookup(c, err, notFound, "Failed to look up media")
+}
+
+// readableTypes returns which media types the request may read the folders
+// of, see acl.Readable, so lists can leave out the others. It responds with
+// 500 if the permissions could not be checked.
+func readableTypes(c *gin.Context) (map[string]bool, bool) {
+	readable := map[string]bool{}
+	for _, mediaType := range []string{models.MediaTypeImage, models.MediaTypeDoc} {
+		ok, err := acl.Readable(c, models.MediaFolder(mediaType))
+		if err != nil {
+			log.Printf("Failed to check the access to the %s folder: %s\n", models.MediaFolder(mediaType), err.Error())
+			problem.Write(c, http.StatusInternalServerError, "Failed to check folder permissions")
+			return nil, false
+		}
+		readable[mediaType] = ok
+	}
+	return readable, true
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"github.com/kevinanielsen/go-fast-cdn/src/auth"
+	"github.com/kevinanielsen/go-fast-cdn/src/branding"
+	"github.com/kevinanielsen/go-fast-cdn/src/middleware"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+)
+
+// ShareHandler manages share links and serves them to the public.
+type ShareHandler struct {
+	media        *MediaHandler
+	shareRepo    models.ShareLinkRepository
+	takedownRepo models.TakedownRepository
+	tripwires    *middleware.TripwireMonitor
+	branding     *branding.Store
+	jwtService   *auth.JWTService
+}
+
+func NewShareHandler(
+	imageRepo models.ImageRepository,
+	docRepo models.DocRepository,
+	shareRepo models.ShareLinkRepository,
+	takedownRepo models.TakedownRepository,
+	tripwires *middleware.TripwireMonitor,
+	branding *branding.Store,
+) *ShareHandler {
+	return &ShareHandler{
+		media:        &MediaHandler{imageRepo: imageRepo, docRepo: docRepo},
+		shareRepo:    shareRepo,
+		takedownRepo: takedownRepo,
+		tripwires:    tripwires,
+		branding:     branding,
+		jwtService:   auth.NewJWTService(),
+	}
+}
@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+)
+
+// TakedownHandler removes files for policy or legal reasons and manages the
+// tombstones served in their place.
+type TakedownHandler struct {
+	media        *MediaHandler
+	takedownRepo models.TakedownRepository
+}
+
+func NewTakedownHandler(imageRepo models.ImageRepository, docRepo models.DocRepository, takedownRepo models.TakedownRepository) *TakedownHandler {
+	return &TakedownHandler{
+		media:        &MediaHandler{imageRepo: imageRepo, docRepo: docRepo},
+		takedownRepo: takedownRepo,
+	}
+}
@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+)
+
+// TransferHandler moves and copies media between folders and organizations.
+type TransferHandler struct {
+	media        *MediaHandler
+	transferRepo models.MediaTransferRepository
+	orgRepo      models.OrganizationRepository
+	searchRepo   models.SearchRepository
+}
+
+func NewTransferHandler(imageRepo models.ImageRepository, docRepo models.DocRepository, transferRepo models.MediaTransferRepository, orgRepo models.OrganizationRepository, searchRepo models.SearchRepository) *TransferHandler {
+	return &TransferHandler{
+		media:        &MediaHandler{imageRepo: imageRepo, docRepo: docRepo},
+		transferRepo: transferRepo,
+		orgRepo:      orgRepo,
+		searchRepo:   searchRepo,
+	}
+}
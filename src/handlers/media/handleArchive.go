@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/kevinanielsen/go-fast-cdn/src/watermark"
+	"gorm.io/gorm"
+)
+
+type mediaFile struct {
+	Type     string `json:"type" binding:"omitempty,oneof=image doc"`
+	FileName string `json:"filename" binding:"required"`
+}
+
+// archiveRequest lists the files of an archive, at most 100.
+type archiveRequest struct {
+	Name  string      `json:"name"`
+	Files []mediaFile `json:"files" binding:"required,min=1,max=100,dive"`
+}
+
+// archiveItem is a file of an archive or bundle, resolved to its record and
+// location on disk.
+type archiveItem struct {
+	MediaType string
+	FileName  string
+	Path      string
+	Size      int64
+	// Available is false when the file no longer exists or was not
+	// approved. Unavailable files are left out of archives.
+	Available bool
+}
+
+// HandleArchive streams the requested files as a zip archive. Files that do
+// not exist, are not approved or are in folders the request may not read are
+// left out.
+func (h *MediaHandler) HandleArchive(c *gin.Context) {
+	var req archiveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Invalid(c, err)
+		return
+	}
+	readable, ok := readableTypes(c)
+	if !ok {
+		return
+	}
+
+	files := make([]models.ShareLinkFile, 0, len(req.Files))
+	for _, file := range req.Files {
+		media, err := h.resolveMedia(c.Request.Context(), file.FileName, file.Type)
+		if err != nil {
+			abortLookup(c, err, "Media not found: "+file.FileName)
+			return
+		}
+		if !readable[media.Type] {
+			continue
+		}
+		files = append(files, models.ShareLinkFile{MediaType: media.Type, FileName: file.FileName})
+	}
+
+	items, err := h.archiveItems(c.Request.Context(), files)
+	if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to look up media")
+		return
+	}
+	streamArchive(c, req.Name, items)
+}
+
+// archiveItems resolves files to archive items. Files without a database
+// record are included but unavailable, as are images that must be
+// watermarked in a format the watermark cannot be applied to. The other
+// images are watermarked when the settings force it, see watermark.Path.
+func (h *MediaHandler) archiveItems(ctx context.Context, files []models.ShareLinkFile) ([]archiveItem, error) {
+	items := make([]archiveItem, 0, len(files))
+	for _, file := range files {
+		item := archiveItem{
+			MediaType: file.MediaType,
+			FileName:  file.FileName,
+			Path:      filepath.Join(util.ExPath, "uploads", models.MediaFolder(file.MediaType), file.FileName),
+		}
+		media, err := h.resolveMedia(ctx, file.FileName, file.MediaType)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		if err == nil && models.ModerationApproved(media.ModerationStatus) {
+			if item.Available, err = locateItem(ctx, &item); err != nil {
+				return nil, err
+			}
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// locateItem sets the path and size of the file of item, watermarked when
+// it is an image the settings force the watermark on, and reports whether
+// it can be served.
+func locateItem(ctx context.Context, item *archiveItem) (bool, error) {
+	if item.MediaType == models.MediaTypeImage {
+		marked, err := watermark.Default.Path(ctx, item.FileName, item.Path, false)
+		if errors.Is(err, watermark.ErrCannotWatermark) || errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+		item.Path = marked
+	}
+	info, err := os.Stat(item.Path)
+	if err != nil {
+		return false, nil
+	}
+	item.Size = info.Size()
+	return true, nil
+}
+
+// streamArchive writes the available items as a zip attachment called
+// name.zip.
+func streamArchive(c *gin.Context, name string, items []archiveItem) {
+	entries := []util.ZipEntry{}
+	for _, item := range items {
+		if item.Available {
+			entries = append(entries, util.ZipEntry{Name: item.FileName, Path: item.Path})
+		}
+	}
+	if len(entries) == 0 {
+		problem.NotFound(c, "None of the files are available")
+		return
+	}
+
+	name = strings.NewReplacer("/", "", `\`, "").Replace(strings.TrimSpace(name))
+	if name == "" {
+		name = "download"
+	}
+	name += ".zip"
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	c.Status(http.StatusOK)
+	if err := util.WriteZip(c.Writer, entries); err != nil {
+		// The status is already sent, so the client sees a truncated archive
+		log.Printf("Failed to stream archive %s: %s", name, err.Error())
+	}
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/auth"
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	testutils "github.com/kevinanielsen/go-fast-cdn/src/testUtils"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleArchive_RestrictedFolder(t *testing.T) {
+	// Arrange
+	h := newTestMediaHandler(t)
+	for folder, name := range map[string]string{"images": "logo.png", "docs": "contract.pdf"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(util.ExPath, "uploads", folder), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(util.ExPath, "uploads", folder, name), []byte(name), 0o644))
+	}
+	require.NoError(t, database.DB.Create(&models.Image{FileName: "logo.png", Checksum: []byte("logo")}).Error)
+	require.NoError(t, database.DB.Create(&models.Doc{FileName: "contract.pdf", Checksum: []byte("contract")}).Error)
+	outsider := restrictFolder(t, "docs")
+	archive := func(files ...string) *httptest.ResponseRecorder {
+		var body []map[string]string
+		for _, file := range files {
+			body = append(body, map[string]string{"filename": file})
+		}
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/test", nil)
+		auth.SetPrincipal(c, auth.UserPrincipal(auth.MethodJWT, outsider))
+		testutils.MockJsonPost(c, map[string]any{"files": body})
+		h.HandleArchive(c)
+		return w
+	}
+
+	// Act & Assert
+	w := archive("logo.png", "contract.pdf")
+	require.Equal(t, http.StatusOK, w.Code)
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	require.NoError(t, err)
+	require.Len(t, zr.File, 1)
+	require.Equal(t, "logo.png", zr.File[0].Name)
+
+	require.Equal(t, http.StatusNotFound, archive("contract.pdf").Code)
+}
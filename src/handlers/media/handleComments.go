@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/acl"
+	"github.com/kevinanielsen/go-fast-cdn/src/auth"
+	"github.com/kevinanielsen/go-fast-cdn/src/events"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"gorm.io/gorm"
+)
+
+type commentRequest struct {
+	Body        *string `json:"body" binding:"omitempty,min=1,max=10000"`
+	TimestampMs *int64  `json:"timestamp_ms" binding:"omitempty,min=0"`
+	Resolved    *bool   `json:"resolved"`
+}
+
+// HandleListComments returns the comments on a media, oldest first. The
+// media is given by its UUID, or by its file name with an optional ?type=.
+func (h *CommentHandler) HandleListComments(c *gin.Context) {
+	media, ok := h.commentedMedia(c)
+	if !ok {
+		return
+	}
+	comments, err := h.commentRepo.GetComments(c.Request.Context(), media.Type, media.UUID)
+	if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to fetch comments")
+		return
+	}
+	c.JSON(http.StatusOK, comments)
+}
+
+// HandleAddComment leaves a comment on a media, e.g. {"body": "Too dark",
+// "timestamp_ms": 12500}. Only comments on audio and video files may have a
+// timestamp.
+func (h *CommentHandler) HandleAddComment(c *gin.Context) {
+	var req commentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Invalid(c, err)
+		return
+	}
+	if req.Body == nil || strings.TrimSpace(*req.Body) == "" {
+		problem.InvalidFields(c, problem.FieldError{Field: "body", Rule: "required", Message: "is required"})
+		return
+	}
+	media, ok := h.commentedMedia(c)
+	if !ok {
+		return
+	}
+	if req.TimestampMs != nil && !timed(media) {
+		problem.InvalidFields(c, problem.FieldError{Field: "timestamp_ms", Rule: "timed", Message: "is only allowed on audio and video files"})
+		return
+	}
+
+	comment := &models.MediaComment{
+		MediaType:   media.Type,
+		MediaUUID:   media.UUID,
+		UserID:      c.GetUint("user_id"),
+		Author:      c.GetString("user_email"),
+		Body:        *req.Body,
+		TimestampMs: req.TimestampMs,
+	}
+	if req.Resolved != nil {
+		comment.Resolved = *req.Resolved
+	}
+	if err := h.commentRepo.AddComment(c.Request.Context(), comment); err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to add comment")
+		return
+	}
+
+	events.Record(c, events.TypeCommented, media.Type+"/"+media.FileName, gin.H{"comment_id": comment.ID})
+	c.JSON(http.StatusCreated, comment)
+}
+
+// HandleUpdateComment changes the fields of a comment in the body. Only its
+// author may change the text and timestamp, while anyone who can see the
+// media may mark it resolved.
+func (h *CommentHandler) HandleUpdateComment(c *gin.Context) {
+	var req commentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Invalid(c, err)
+		return
+	}
+	media, comment, ok := h.comment(c)
+	if !ok {
+		return
+	}
+
+	if req.Body != nil || req.TimestampMs != nil {
+		if comment.UserID != c.GetUint("user_id") {
+			problem.Write(c, http.StatusForbidden, "Only the author can edit a comment")
+			return
+		}
+		if req.Body != nil {
+			if strings.TrimSpace(*req.Body) == "" {
+				problem.InvalidFields(c, problem.FieldError{Field: "body", Rule: "required", Message: "must not be empty"})
+				return
+			}
+			comment.Body = *req.Body
+		}
+		if req.TimestampMs != nil {
+			if !timed(media) {
+				problem.InvalidFields(c, problem.FieldError{Field: "timestamp_ms", Rule: "timed", Message: "is only allowed on audio and video files"})
+				return
+			}
+			comment.TimestampMs = req.TimestampMs
+		}
+	}
+	if req.Resolved != nil {
+		comment.Resolved = *req.Resolved
+	}
+
+	if err := h.commentRepo.UpdateComment(c.Request.Context(), &comment); err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to update comment")
+		return
+	}
+	c.JSON(http.StatusOK, comment)
+}
+
+// HandleDeleteComment removes a comment. Users may delete their own
+// comments and admins any comment.
+func (h *CommentHandler) HandleDeleteComment(c *gin.Context) {
+	_, comment, ok := h.comment(c)
+	if !ok {
+		return
+	}
+	if comment.UserID != c.GetUint("user_id") && c.GetString("user_role") != "admin" {
+		problem.Write(c, http.StatusForbidden, "Only the author or an admin can delete a comment")
+		return
+	}
+
+	if err := h.commentRepo.DeleteComment(c.Request.Context(), comment.ID); err != nil {
+		problem.Lookup(c, err, "Comment not found", "Failed to delete comment")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Comment deleted successfully"})
+}
+
+// commentedMedia resolves the media of the request and checks the user may
+// see it, in its organization and folder, responding with an error
+// otherwise.
+func (h *CommentHandler) commentedMedia(c *gin.Context) (mediaRecord, bool) {
+	ctx := c.Request.Context()
+	id := c.Param("filename")
+	media, err := h.media.resolveMediaByUUID(ctx, id)
+	if err != nil {
+		media, err = h.media.resolveMedia(ctx, id, c.Query("type"))
+	}
+	if err != nil {
+		abortLookup(c, err, "Media not found")
+		return mediaRecord{}, false
+	}
+	if !auth.InScope(c, media.OrganizationID) {
+		problem.Write(c, http.StatusForbidden, "Media belongs to another organization")
+		return mediaRecord{}, false
+	}
+	if !acl.Check(c, models.MediaFolder(media.Type), models.AccessRead) {
+		return mediaRecord{}, false
+	}
+	return media, true
+}
+
+// comment resolves the media and the comment on it the request is for.
+func (h *CommentHandler) comment(c *gin.Context) (mediaRecord, models.MediaComment, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		problem.Write(c, http.StatusBadRequest, "Invalid comment ID")
+		return mediaRecord{}, models.MediaComment{}, false
+	}
+	media, ok := h.commentedMedia(c)
+	if !ok {
+		return mediaRecord{}, models.MediaComment{}, false
+	}
+
+	comment, err := h.commentRepo.GetComment(c.Request.Context(), uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && (comment.MediaType != media.Type || comment.MediaUUID != media.UUID)) {
+		problem.NotFound(c, "Comment not found")
+		return mediaRecord{}, models.MediaComment{}, false
+	} else if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to look up comment")
+		return mediaRecord{}, models.MediaComment{}, false
+	}
+	return media, comment, true
+}
+
+// timed reports whether media is an audio or video file, whose comments may
+// point at a position. Media whose type was not detected yet are judged by
+// their extension.
+func timed(media mediaRecord) bool {
+	mimeType := media.MimeType
+	if mimeType == "" {
+		mimeType = mime.TypeByExtension(filepath.Ext(media.FileName))
+	}
+	return strings.HasPrefix(mimeType, "audio/") || strings.HasPrefix(mimeType, "video/")
+}
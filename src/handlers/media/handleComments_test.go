@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/auth"
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	testutils "github.com/kevinanielsen/go-fast-cdn/src/testUtils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleComments(t *testing.T) {
+	// Arrange
+	media := newTestMediaHandler(t)
+	ctx := context.Background()
+	commentRepo := database.NewMediaCommentRepo(database.DB)
+	h := NewCommentHandler(media.imageRepo, media.docRepo, commentRepo)
+	_, err := media.imageRepo.AddImage(ctx, models.Image{FileName: "cover.png", Checksum: []byte("a"), MimeType: "image/png"})
+	require.NoError(t, err)
+	_, err = media.docRepo.AddDoc(ctx, models.Doc{FileName: "cut.mp4", Checksum: []byte("b")})
+	require.NoError(t, err)
+
+	call := func(handler gin.HandlerFunc, userID uint, role, fileName, commentID string, body any) (int, map[string]any) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/test", nil)
+		c.Params = []gin.Param{{Key: "filename", Value: fileName}, {Key: "id", Value: commentID}}
+		c.Set("user_id", userID)
+		c.Set("user_email", "user"+strconv.Itoa(int(userID))+"@example.com")
+		c.Set("user_role", role)
+		if body != nil {
+			testutils.MockJsonPost(c, body)
+		}
+		handler(c)
+		resp := map[string]any{}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp
+	}
+
+	// Act & Assert
+	code, _ := call(h.HandleAddComment, 1, "user", "cover.png", "", map[string]any{"body": "Too dark", "timestamp_ms": 1000})
+	require.Equal(t, http.StatusBadRequest, code, "images have no timestamps")
+	code, comment := call(h.HandleAddComment, 1, "user", "cover.png", "", map[string]any{"body": "Too dark"})
+	require.Equal(t, http.StatusCreated, code)
+	require.Equal(t, "user1@example.com", comment["author"])
+	imageComment := strconv.Itoa(int(comment["ID"].(float64)))
+
+	code, comment = call(h.HandleAddComment, 2, "user", "cut.mp4", "", map[string]any{"body": "Cut here", "timestamp_ms": 12500})
+	require.Equal(t, http.StatusCreated, code)
+	require.EqualValues(t, 12500, comment["timestamp_ms"])
+	videoComment := strconv.Itoa(int(comment["ID"].(float64)))
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/test", nil)
+	c.Params = []gin.Param{{Key: "filename", Value: "cover.png"}}
+	h.HandleListComments(c)
+	var comments []models.MediaComment
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &comments))
+	require.Len(t, comments, 1)
+	require.Equal(t, "Too dark", comments[0].Body)
+
+	// Others may resolve a comment but not edit it
+	code, _ = call(h.HandleUpdateComment, 2, "user", "cover.png", imageComment, map[string]any{"body": "Too bright"})
+	require.Equal(t, http.StatusForbidden, code)
+	code, comment = call(h.HandleUpdateComment, 2, "user", "cover.png", imageComment, map[string]any{"resolved": true})
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, true, comment["resolved"])
+	require.Equal(t, "Too dark", comment["body"])
+
+	// Comments are only found through their media
+	code, _ = call(h.HandleUpdateComment, 1, "user", "cut.mp4", imageComment, map[string]any{"resolved": false})
+	require.Equal(t, http.StatusNotFound, code)
+
+	code, _ = call(h.HandleDeleteComment, 1, "user", "cut.mp4", videoComment, nil)
+	require.Equal(t, http.StatusForbidden, code)
+	code, _ = call(h.HandleDeleteComment, 3, "admin", "cut.mp4", videoComment, nil)
+	require.Equal(t, http.StatusOK, code)
+
+	// Deleting the media deletes its comments
+	image, err := media.imageRepo.GetImageByFileName(ctx, "cover.png")
+	require.NoError(t, err)
+	_, err = media.imageRepo.DeleteImage(ctx, "cover.png")
+	require.NoError(t, err)
+	comments, err = commentRepo.GetComments(ctx, models.MediaTypeImage, image.UUID)
+	require.NoError(t, err)
+	require.Empty(t, comments)
+}
+
+func TestHandleComments_RestrictedFolder(t *testing.T) {
+	// Arrange
+	media := newTestMediaHandler(t)
+	h := NewCommentHandler(media.imageRepo, media.docRepo, database.NewMediaCommentRepo(database.DB))
+	_, err := media.docRepo.AddDoc(context.Background(), models.Doc{FileName: "contract.pdf", Checksum: []byte("contract")})
+	require.NoError(t, err)
+	outsider := restrictFolder(t, "docs")
+	call := func(handler gin.HandlerFunc, body any) int {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/test", nil)
+		c.Params = []gin.Param{{Key: "filename", Value: "contract.pdf"}}
+		auth.SetPrincipal(c, auth.UserPrincipal(auth.MethodJWT, outsider))
+		if body != nil {
+			testutils.MockJsonPost(c, body)
+		}
+		handler(c)
+		return w.Code
+	}
+
+	// Act & Assert
+	require.Equal(t, http.StatusForbidden, call(h.HandleListComments, nil))
+	require.Equal(t, http.StatusForbidden, call(h.HandleAddComment, map[string]any{"body": "Looks fine"}))
+}
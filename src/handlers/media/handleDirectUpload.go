@@ -0,0 +1,384 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/kevinanielsen/go-fast-cdn/src/acl"
+	"github.com/kevinanielsen/go-fast-cdn/src/auth"
+	"github.com/kevinanielsen/go-fast-cdn/src/events"
+	"github.com/kevinanielsen/go-fast-cdn/src/fallback"
+	"github.com/kevinanielsen/go-fast-cdn/src/hooks"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/moderation"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"github.com/kevinanielsen/go-fast-cdn/src/settings"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/kevinanielsen/go-fast-cdn/src/validations"
+	"gorm.io/gorm"
+)
+
+// defaultDirectUploadTTL is how long presigned URLs work without
+// DIRECT_UPLOAD_TTL.
+const defaultDirectUploadTTL = 15 * time.Minute
+
+// errUploadMismatch is returned when an uploaded file differs from the one
+// announced when the upload was presigned.
+var errUploadMismatch = errors.New("uploaded file does not match")
+
+// presignRequest announces a file to be put into object storage.
+type presignRequest struct {
+	Folder   string `json:"folder" binding:"required,oneof=images docs"`
+	FileName string `json:"filename" binding:"required,filename"`
+	Size     int64  `json:"size" binding:"required,gt=0"`
+	// SHA256 is the hex encoded SHA-256 checksum of the whole file.
+	SHA256 string `json:"sha256" binding:"required,len=64,hexadecimal"`
+}
+
+// HandlePresignUpload reserves a name for a file and returns a presigned
+// URL the client PUTs the file to, e.g. {"folder": "images", "filename":
+// "photo.jpg", "size": 1048576, "sha256": "9f86..."}. The file becomes a
+// media once the client calls the confirm URL of the upload.
+func (h *DirectUploadHandler) HandlePresignUpload(c *gin.Context) {
+	uploader := h.uploader()
+	if uploader == nil {
+		abortNoUploader(c)
+		return
+	}
+
+	var body presignRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		problem.Invalid(c, err)
+		return
+	}
+	if limit := settings.Default.Int(settings.MaxUploadBodySize); limit > 0 && body.Size > int64(limit) {
+		problem.Write(c, http.StatusRequestEntityTooLarge, "File is too large")
+		return
+	}
+	if !acl.Check(c, body.Folder, models.AccessWrite) {
+		return
+	}
+	checksum, _ := hex.DecodeString(body.SHA256)
+	mediaType := models.MediaTypeFor(body.Folder)
+
+	err := hooks.PreValidate(c, hooks.Media{
+		Type: mediaType, FileName: body.FileName, Size: body.Size,
+		OrganizationID: auth.OrganizationID(c),
+	})
+	if err != nil {
+		hooks.Abort(c, err)
+		return
+	}
+
+	fileName, err := util.FilterFilename(util.StoredName(settings.Default.Get(settings.FileNamingStrategy), body.FileName, checksum))
+	if err != nil {
+		problem.Write(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx := c.Request.Context()
+	// Without SHA-256 checksums duplicates are only found on confirmation
+	if util.ChecksumAlgorithm() == models.ChecksumSHA256 {
+		if existing, err := h.duplicate(ctx, mediaType, checksum); err != nil {
+			problem.Write(c, http.StatusInternalServerError, "Failed to look up existing media")
+			return
+		} else if existing != "" {
+			problem.Abort(c, problem.New(http.StatusConflict, problem.CodeMediaDuplicate, "File already exists").With("existing", existing))
+			return
+		}
+	}
+	if taken, err := h.reserved(ctx, mediaType, fileName); err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to look up media")
+		return
+	} else if taken {
+		problem.Abort(c, problem.New(http.StatusConflict, problem.CodeMediaNameTaken, "File name already taken"))
+		return
+	}
+
+	ttl, err := directUploadTTL()
+	if err != nil {
+		problem.WriteDetails(c, http.StatusInternalServerError, "Failed to presign upload", err.Error())
+		return
+	}
+	url, err := uploader.PresignPut(ctx, body.Folder, fileName, ttl)
+	if err != nil {
+		log.Printf("Failed to presign upload of %s/%s: %s\n", body.Folder, fileName, err.Error())
+		problem.WriteDetails(c, http.StatusBadGateway, "Failed to presign upload", err.Error())
+		return
+	}
+
+	upload := models.DirectUpload{
+		Token:          uuid.NewString(),
+		MediaType:      mediaType,
+		FileName:       fileName,
+		OriginalName:   body.FileName,
+		Size:           body.Size,
+		SHA256:         checksum,
+		OrganizationID: auth.OrganizationID(c),
+		CreatedBy:      c.GetString("user_email"),
+		ExpiresAt:      time.Now().Add(ttl),
+	}
+	if err := h.uploadRepo.AddDirectUpload(ctx, &upload); err != nil {
+		problem.WriteDetails(c, http.StatusInternalServerError, "Failed to record upload", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"upload_id":   upload.Token,
+		"method":      http.MethodPut,
+		"url":         url,
+		"file_name":   fileName,
+		"expires_at":  upload.ExpiresAt,
+		"confirm_url": c.Request.Host + "/api/cdn/upload/presign/" + upload.Token + "/confirm",
+	})
+}
+
+// HandleConfirmUpload registers the file put with a presigned URL as a
+// media, after checking that its size, SHA-256 checksum and content type
+// match the announced file. Files that do not match are deleted from the
+// storage. Confirmed files are served from the storage, and copied into the
+// uploads folder by the next repair run.
+func (h *DirectUploadHandler) HandleConfirmUpload(c *gin.Context) {
+	uploader := h.uploader()
+	if uploader == nil {
+		abortNoUploader(c)
+		return
+	}
+
+	ctx := c.Request.Context()
+	upload, err := h.uploadRepo.GetDirectUpload(ctx, c.Param("id"))
+	if err == nil && upload.CreatedBy != c.GetString("user_email") {
+		err = gorm.ErrRecordNotFound
+	}
+	if err != nil {
+		problem.Lookup(c, err, "Upload not found", "Failed to look up upload")
+		return
+	}
+	if upload.Expired() {
+		h.discard(ctx, uploader, upload)
+		problem.Write(c, http.StatusGone, "Upload expired, request a new URL")
+		return
+	}
+
+	folder := models.MediaFolder(upload.MediaType)
+	if !acl.Check(c, folder, models.AccessWrite) {
+		return
+	}
+	header, err := verifyDirectUpload(ctx, uploader, upload)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		problem.Write(c, http.StatusConflict, "File has not been uploaded yet")
+		return
+	case errors.Is(err, errUploadMismatch):
+		h.discard(ctx, uploader, upload)
+		problem.Write(c, http.StatusUnprocessableEntity, err.Error())
+		return
+	case err != nil:
+		var invalid *problem.Error
+		if errors.As(err, &invalid) {
+			h.discard(ctx, uploader, upload)
+			problem.Abort(c, invalid)
+			return
+		}
+		log.Printf("Failed to verify upload of %s/%s: %s\n", folder, upload.FileName, err.Error())
+		problem.WriteDetails(c, http.StatusBadGateway, "Failed to verify upload", err.Error())
+		return
+	}
+
+	algorithm := util.ChecksumAlgorithm()
+	checksum := upload.SHA256
+	if algorithm != models.ChecksumSHA256 {
+		if checksum, err = util.Checksum(algorithm, bytes.NewReader(header)); err != nil {
+			problem.WriteDetails(c, http.StatusInternalServerError, "Failed to verify upload", err.Error())
+			return
+		}
+	}
+	if existing, err := h.duplicate(ctx, upload.MediaType, checksum); err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to look up existing media")
+		return
+	} else if existing != "" {
+		h.discard(ctx, uploader, upload)
+		problem.Abort(c, problem.New(http.StatusConflict, problem.CodeMediaDuplicate, "File already exists").With("existing", existing))
+		return
+	}
+
+	// Regular uploads may have taken the name in the meantime
+	if taken, err := h.media.nameTaken(ctx, upload.MediaType, upload.FileName); err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to look up media")
+		return
+	} else if taken {
+		h.discard(ctx, uploader, upload)
+		problem.Abort(c, problem.New(http.StatusConflict, problem.CodeMediaNameTaken, "File name already taken"))
+		return
+	}
+
+	status := moderation.UploadStatus(c)
+	mimeType := validations.DetectMimeType(upload.FileName, header)
+	if upload.MediaType == models.MediaTypeImage {
+		_, err = h.media.imageRepo.AddImage(ctx, models.Image{
+			FileName: upload.FileName, OriginalName: upload.OriginalName, MimeType: mimeType,
+			Checksum: checksum, ChecksumAlgorithm: algorithm, OrganizationID: upload.OrganizationID,
+			ModerationStatus: status,
+		})
+	} else {
+		_, err = h.media.docRepo.AddDoc(ctx, models.Doc{
+			FileName: upload.FileName, OriginalName: upload.OriginalName, MimeType: mimeType,
+			Checksum: checksum, ChecksumAlgorithm: algorithm, OrganizationID: upload.OrganizationID,
+			ModerationStatus: status,
+		})
+	}
+	if err != nil {
+		problem.WriteDetails(c, http.StatusInternalServerError, "Failed to save file", err.Error())
+		return
+	}
+	if err := h.uploadRepo.DeleteDirectUpload(ctx, upload.Token); err != nil {
+		log.Printf("Failed to delete confirmed upload %s: %s\n", upload.Token, err.Error())
+	}
+	task := &models.RepairTask{MediaType: upload.MediaType, FileName: upload.FileName, Source: uploader.String()}
+	if err := h.repairRepo.AddRepairTask(ctx, task); err != nil {
+		log.Printf("Failed to record the repair of %s/%s: %s\n", folder, upload.FileName, err.Error())
+	}
+
+	media, err := h.media.resolveMedia(ctx, upload.FileName, upload.MediaType)
+	if err != nil {
+		problem.Lookup(c, err, "Media not found", "Failed to look up media")
+		return
+	}
+	events.Record(c, events.TypeUploaded, media.Type+"/"+media.FileName, gin.H{"size": upload.Size, "direct": true})
+	if media.ModerationStatus == models.ModerationStatusPending {
+		moderation.Notify(c, moderation.Notification{
+			Type: moderation.TypePending, MediaType: media.Type, FileName: media.FileName,
+			UUID: media.UUID, OrganizationID: media.OrganizationID,
+		})
+	}
+	hooks.PostStore(c, hooks.Media{
+		Type: media.Type, FileName: media.FileName, MimeType: media.MimeType, Size: upload.Size,
+		UUID: media.UUID, OrganizationID: media.OrganizationID,
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"type":              media.Type,
+		"uuid":              media.UUID,
+		"file_name":         media.FileName,
+		"mime_type":         media.MimeType,
+		"size":              upload.Size,
+		"moderation_status": media.ModerationStatus,
+		"url":               c.Request.Host + "/api/cdn/download/" + folder + "/" + media.FileName,
+	})
+}
+
+// verifyDirectUpload reads the uploaded file back and checks it against the
+// announced one. It returns the first 512 bytes of the file for detecting
+// its type.
+func verifyDirectUpload(ctx context.Context, uploader fallback.Uploader, upload models.DirectUpload) ([]byte, error) {
+	folder := models.MediaFolder(upload.MediaType)
+	size, err := uploader.Stat(ctx, folder, upload.FileName)
+	if err != nil {
+		return nil, err
+	}
+	if size != upload.Size {
+		return nil, fmt.Errorf("%w: the file is %d bytes, not %d", errUploadMismatch, size, upload.Size)
+	}
+
+	r, _, err := uploader.Open(ctx, folder, upload.FileName)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	header := make([]byte, 512)
+	n, err := io.ReadFull(r, header)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+	header = header[:n]
+	if err := validations.ValidateContentType(upload.MediaType, upload.FileName, header); err != nil {
+		return nil, problem.New(http.StatusBadRequest, problem.CodeMediaInvalidType, "Invalid file type")
+	}
+
+	hash := sha256.New()
+	hash.Write(header)
+	if _, err := io.Copy(hash, r); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(hash.Sum(nil), upload.SHA256) {
+		return nil, fmt.Errorf("%w the sha256 checksum", errUploadMismatch)
+	}
+	return header, nil
+}
+
+// reserved reports whether fileName is taken by a media, or by an upload
+// that may still be confirmed.
+func (h *DirectUploadHandler) reserved(ctx context.Context, mediaType, fileName string) (bool, error) {
+	taken, err := h.media.nameTaken(ctx, mediaType, fileName)
+	if err != nil || taken {
+		return taken, err
+	}
+	return h.uploadRepo.PendingDirectUpload(ctx, mediaType, fileName)
+}
+
+// duplicate returns the name of the media of mediaType with checksum, or ""
+// if there is none.
+func (h *DirectUploadHandler) duplicate(ctx context.Context, mediaType string, checksum []byte) (string, error) {
+	var fileName string
+	var err error
+	if mediaType == models.MediaTypeImage {
+		var image models.Image
+		image, err = h.media.imageRepo.GetImageByCheckSum(ctx, checksum)
+		fileName = image.FileName
+	} else {
+		var doc models.Doc
+		doc, err = h.media.docRepo.GetDocByCheckSum(ctx, checksum)
+		fileName = doc.FileName
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+	return fileName, err
+}
+
+// discard deletes an upload and its file, unless another upload reserved
+// the name of the file since.
+func (h *DirectUploadHandler) discard(ctx context.Context, uploader fallback.Uploader, upload models.DirectUpload) {
+	if err := h.uploadRepo.DeleteDirectUpload(ctx, upload.Token); err != nil {
+		log.Printf("Failed to delete upload %s: %s\n", upload.Token, err.Error())
+		return
+	}
+	if taken, err := h.reserved(ctx, upload.MediaType, upload.FileName); err != nil || taken {
+		return
+	}
+	folder := models.MediaFolder(upload.MediaType)
+	if err := uploader.Remove(ctx, folder, upload.FileName); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("Failed to delete uploaded file %s/%s: %s\n", folder, upload.FileName, err.Error())
+	}
+}
+
+func abortNoUploader(c *gin.Context) {
+	problem.Write(c, http.StatusNotImplemented, "Direct uploads need an s3:// source in MEDIA_FALLBACKS")
+}
+
+// directUploadTTL returns how long presigned URLs work: DIRECT_UPLOAD_TTL
+// seconds, 15 minutes by default.
+func directUploadTTL() (time.Duration, error) {
+	value := os.Getenv("DIRECT_UPLOAD_TTL")
+	if value == "" {
+		return defaultDirectUploadTTL, nil
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 1 {
+		return 0, fmt.Errorf("invalid DIRECT_UPLOAD_TTL %q", value)
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
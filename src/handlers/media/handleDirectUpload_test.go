@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/fallback"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	testutils "github.com/kevinanielsen/go-fast-cdn/src/testUtils"
+	"github.com/stretchr/testify/require"
+)
+
+// bucket is an Uploader keeping files in a directory, whose presigned URLs
+// are the paths files are put to.
+type bucket string
+
+func (b bucket) String() string { return "s3://test" }
+
+func (b bucket) Open(ctx context.Context, folder, fileName string) (io.ReadCloser, int64, error) {
+	f, err := os.Open(filepath.Join(string(b), folder, fileName))
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, info.Size(), nil
+}
+
+func (b bucket) PresignPut(ctx context.Context, folder, fileName string, expiry time.Duration) (string, error) {
+	return filepath.Join(string(b), folder, fileName), nil
+}
+
+func (b bucket) Stat(ctx context.Context, folder, fileName string) (int64, error) {
+	info, err := os.Stat(filepath.Join(string(b), folder, fileName))
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func (b bucket) Remove(ctx context.Context, folder, fileName string) error {
+	return os.Remove(filepath.Join(string(b), folder, fileName))
+}
+
+func TestHandleDirectUpload(t *testing.T) {
+	// Arrange
+	media := newTestMediaHandler(t)
+	ctx := context.Background()
+	uploads := database.NewDirectUploadRepo(database.DB)
+	repairs := database.NewRepairTaskRepo(database.DB)
+	h := NewDirectUploadHandler(media.imageRepo, media.docRepo, uploads, repairs)
+	storage := bucket(t.TempDir())
+	require.NoError(t, os.MkdirAll(filepath.Join(string(storage), "images"), 0o755))
+
+	call := func(handler gin.HandlerFunc, user, id string, body any) (int, map[string]any) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/test", nil)
+		c.Params = []gin.Param{{Key: "id", Value: id}}
+		c.Set("user_email", user)
+		testutils.MockJsonPost(c, body)
+		handler(c)
+		resp := map[string]any{}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp
+	}
+	png := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{7}, 1024)...)
+	sum := sha256.Sum256(png)
+	announce := map[string]any{"folder": "images", "filename": "large.png", "size": len(png), "sha256": hex.EncodeToString(sum[:])}
+
+	// Act & Assert
+	h.uploader = func() fallback.Uploader { return nil }
+	code, _ := call(h.HandlePresignUpload, "alice@example.com", "", announce)
+	require.Equal(t, http.StatusNotImplemented, code, "direct uploads need object storage")
+	h.uploader = func() fallback.Uploader { return storage }
+
+	code, presigned := call(h.HandlePresignUpload, "alice@example.com", "", announce)
+	require.Equal(t, http.StatusCreated, code)
+	require.Equal(t, "large.png", presigned["file_name"])
+	id := presigned["upload_id"].(string)
+	code, _ = call(h.HandlePresignUpload, "bob@example.com", "", announce)
+	require.Equal(t, http.StatusConflict, code, "the name is reserved for the pending upload")
+
+	code, _ = call(h.HandleConfirmUpload, "alice@example.com", id, nil)
+	require.Equal(t, http.StatusConflict, code, "nothing was put yet")
+	code, _ = call(h.HandleConfirmUpload, "bob@example.com", id, nil)
+	require.Equal(t, http.StatusNotFound, code, "only the uploader confirms")
+
+	require.NoError(t, os.WriteFile(presigned["url"].(string), png, 0o644))
+	code, confirmed := call(h.HandleConfirmUpload, "alice@example.com", id, nil)
+	require.Equal(t, http.StatusCreated, code)
+	require.Equal(t, "image/png", confirmed["mime_type"])
+	image, err := media.imageRepo.GetImageByFileName(ctx, "large.png")
+	require.NoError(t, err)
+	require.Equal(t, confirmed["uuid"], image.UUID)
+	tasks, err := repairs.GetRepairTasks(ctx, models.RepairStatusPending)
+	require.NoError(t, err)
+	require.Len(t, tasks, 1, "the file is copied into the uploads folder later")
+	_, err = uploads.GetDirectUpload(ctx, id)
+	require.Error(t, err, "confirmed uploads are forgotten")
+
+	announce["filename"] = "tampered.png"
+	code, presigned = call(h.HandlePresignUpload, "alice@example.com", "", announce)
+	require.Equal(t, http.StatusCreated, code)
+	tampered := bytes.Clone(png)
+	tampered[len(tampered)-1] = 8
+	require.NoError(t, os.WriteFile(presigned["url"].(string), tampered, 0o644))
+	code, _ = call(h.HandleConfirmUpload, "alice@example.com", presigned["upload_id"].(string), nil)
+	require.Equal(t, http.StatusUnprocessableEntity, code, "the checksum does not match")
+	require.NoFileExists(t, presigned["url"].(string), "rejected files are deleted")
+	_, err = media.imageRepo.GetImageByFileName(ctx, "tampered.png")
+	require.Error(t, err)
+
+	announce["filename"] = "late.png"
+	code, presigned = call(h.HandlePresignUpload, "alice@example.com", "", announce)
+	require.Equal(t, http.StatusCreated, code)
+	require.NoError(t, database.DB.Model(&models.DirectUpload{}).Where("token = ?", presigned["upload_id"]).
+		Update("expires_at", time.Now().Add(-time.Minute)).Error)
+	code, _ = call(h.HandleConfirmUpload, "alice@example.com", presigned["upload_id"].(string), nil)
+	require.Equal(t, http.StatusGone, code)
+}
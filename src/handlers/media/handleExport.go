@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+)
+
+// exportBatchSize is the number of records read from the database at once
+// while exporting.
+const exportBatchSize = 500
+
+// exportRow is a file listed by a media export.
+type exportRow struct {
+	Type              string     `json:"type"`
+	UUID              string     `json:"uuid"`
+	FileName          string     `json:"file_name"`
+	OriginalName      string     `json:"original_name"`
+	URL               string     `json:"url"`
+	Size              int64      `json:"size"`
+	MimeType          string     `json:"mime_type"`
+	Checksum          string     `json:"checksum"`
+	ChecksumAlgorithm string     `json:"checksum_algorithm"`
+	OrganizationID    *uint      `json:"organization_id"`
+	Title             string     `json:"title"`
+	AltText           string     `json:"alt_text"`
+	Description       string     `json:"description"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+	ExpiresAt         *time.Time `json:"expires_at"`
+}
+
+var exportColumns = []string{
+	"type", "uuid", "file_name", "original_name", "url", "size", "mime_type", "checksum", "checksum_algorithm",
+	"organization_id", "title", "alt_text", "description", "created_at", "updated_at", "expires_at",
+}
+
+func (row exportRow) csv() []string {
+	organizationID, expiresAt := "", ""
+	if row.OrganizationID != nil {
+		organizationID = strconv.FormatUint(uint64(*row.OrganizationID), 10)
+	}
+	if row.ExpiresAt != nil {
+		expiresAt = row.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+	return []string{
+		row.Type, row.UUID, row.FileName, row.OriginalName, row.URL, strconv.FormatInt(row.Size, 10), row.MimeType,
+		row.Checksum, row.ChecksumAlgorithm, organizationID, row.Title, row.AltText, row.Description,
+		row.CreatedAt.UTC().Format(time.RFC3339), row.UpdatedAt.UTC().Format(time.RFC3339), expiresAt,
+	}
+}
+
+// exportWriter writes the rows of an export in one format.
+type exportWriter interface {
+	Write(row exportRow) error
+	Flush() error
+}
+
+type ndjsonWriter struct {
+	encoder *json.Encoder
+}
+
+func (w ndjsonWriter) Write(row exportRow) error {
+	return w.encoder.Encode(row)
+}
+
+func (w ndjsonWriter) Flush() error {
+	return nil
+}
+
+type csvWriter struct {
+	writer *csv.Writer
+}
+
+func (w csvWriter) Write(row exportRow) error {
+	return w.writer.Write(row.csv())
+}
+
+func (w csvWriter) Flush() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+// HandleExportMedia streams the records of all files as newline delimited
+// JSON (format=ndjson, the default) or CSV (format=csv), optionally only
+// images or documents (type=image or type=doc). Records are read from the
+// database in batches and flushed to the client as they go, so the export of
+// a large library never sits in memory as a whole. Files in folders the
+// request may not read are left out.
+func (h *MediaHandler) HandleExportMedia(c *gin.Context) {
+	format := c.DefaultQuery("format", "ndjson")
+	if format != "ndjson" && format != "csv" {
+		problem.Write(c, http.StatusBadRequest, "format must be ndjson or csv")
+		return
+	}
+	mediaType := c.Query("type")
+	if mediaType != "" && mediaType != models.MediaTypeImage && mediaType != models.MediaTypeDoc {
+		problem.Write(c, http.StatusBadRequest, "type must be image or doc")
+		return
+	}
+
+	readable, ok := readableTypes(c)
+	if !ok {
+		return
+	}
+	var pages []func(afterID uint) ([]exportRow, uint, error)
+	if mediaType != models.MediaTypeDoc && readable[models.MediaTypeImage] {
+		pages = append(pages, h.imageExportPage(c))
+	}
+	if mediaType != models.MediaTypeImage && readable[models.MediaTypeDoc] {
+		pages = append(pages, h.docExportPage(c))
+	}
+
+	// The response starts with the first batch, so a failing database still
+	// gets a proper error response
+	var w exportWriter
+	for _, page := range pages {
+		var afterID uint
+		for {
+			rows, lastID, err := page(afterID)
+			if err != nil && w == nil {
+				problem.Write(c, http.StatusInternalServerError, "Failed to export media")
+				return
+			} else if err != nil {
+				// The response is already under way and can only be cut short
+				log.Printf("Failed to export media: %s", err.Error())
+				c.Abort()
+				return
+			}
+			if w == nil {
+				if w, err = startExport(c, format); err != nil {
+					return
+				}
+			}
+
+			for _, row := range rows {
+				if err := w.Write(row); err != nil {
+					return
+				}
+			}
+			if err := w.Flush(); err != nil {
+				return
+			}
+			c.Writer.Flush()
+
+			if len(rows) < exportBatchSize {
+				break
+			}
+			afterID = lastID
+		}
+	}
+	// Without folders to read the export is empty
+	if w == nil {
+		if w, err := startExport(c, format); err == nil {
+			w.Flush()
+		}
+	}
+}
+
+// startExport sends the headers of an export in format and returns the
+// writer of its rows.
+func startExport(c *gin.Context, format string) (exportWriter, error) {
+	c.Header("Content-Disposition", `attachment; filename="media-export.`+format+`"`)
+	if format == "csv" {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Status(http.StatusOK)
+		w := csv.NewWriter(c.Writer)
+		return csvWriter{w}, w.Write(exportColumns)
+	}
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(http.StatusOK)
+	return ndjsonWriter{json.NewEncoder(c.Writer)}, nil
+}
+
+func (h *MediaHandler) imageExportPage(c *gin.Context) func(afterID uint) ([]exportRow, uint, error) {
+	return func(afterID uint) ([]exportRow, uint, error) {
+		images, err := h.imageRepo.GetImagesAfter(c.Request.Context(), afterID, exportBatchSize)
+		if err != nil {
+			return nil, afterID, err
+		}
+		rows := make([]exportRow, 0, len(images))
+		for _, image := range images {
+			rows = append(rows, exportRow{
+				Type: models.MediaTypeImage, UUID: image.UUID, FileName: image.FileName, OriginalName: image.OriginalName,
+				MimeType: image.MimeType, Checksum: hex.EncodeToString(image.Checksum), ChecksumAlgorithm: image.ChecksumAlgorithm,
+				OrganizationID: image.OrganizationID, Title: image.Title, AltText: image.AltText,
+				Description: image.Description, CreatedAt: image.CreatedAt, UpdatedAt: image.UpdatedAt, ExpiresAt: image.ExpiresAt,
+			})
+			afterID = image.ID
+		}
+		return withFileInfo(c, rows), afterID, nil
+	}
+}
+
+func (h *MediaHandler) docExportPage(c *gin.Context) func(afterID uint) ([]exportRow, uint, error) {
+	return func(afterID uint) ([]exportRow, uint, error) {
+		docs, err := h.docRepo.GetDocsAfter(c.Request.Context(), afterID, exportBatchSize)
+		if err != nil {
+			return nil, afterID, err
+		}
+		rows := make([]exportRow, 0, len(docs))
+		for _, doc := range docs {
+			rows = append(rows, exportRow{
+				Type: models.MediaTypeDoc, UUID: doc.UUID, FileName: doc.FileName, OriginalName: doc.OriginalName,
+				MimeType: doc.MimeType, Checksum: hex.EncodeToString(doc.Checksum), ChecksumAlgorithm: doc.ChecksumAlgorithm,
+				OrganizationID: doc.OrganizationID, Title: doc.Title, AltText: doc.AltText,
+				Description: doc.Description, CreatedAt: doc.CreatedAt, UpdatedAt: doc.UpdatedAt, ExpiresAt: doc.ExpiresAt,
+			})
+			afterID = doc.ID
+		}
+		return withFileInfo(c, rows), afterID, nil
+	}
+}
+
+// withFileInfo fills in the download URL and size of the rows.
+func withFileInfo(c *gin.Context, rows []exportRow) []exportRow {
+	for i, row := range rows {
+		folder := models.MediaFolder(row.Type)
+		rows[i].URL = c.Request.Host + "/api/cdn/download/" + folder + "/" + row.FileName
+		if info, err := os.Stat(filepath.Join(util.ExPath, "uploads", folder, row.FileName)); err == nil {
+			rows[i].Size = info.Size()
+		}
+	}
+	return rows
+}
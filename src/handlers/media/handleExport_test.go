@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/auth"
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleExportMedia(t *testing.T) {
+	// Arrange
+	h := newTestMediaHandler(t)
+	var images []models.Image
+	for i := 0; i < exportBatchSize+2; i++ {
+		name := fmt.Sprintf("image-%03d.png", i)
+		images = append(images, models.Image{FileName: name, Checksum: []byte(name)})
+	}
+	require.NoError(t, database.DB.CreateInBatches(images, 100).Error)
+	require.NoError(t, database.DB.Create(&models.Doc{FileName: "report, final.pdf", Checksum: []byte{0xab}, MediaMetadata: models.MediaMetadata{Title: "Report"}}).Error)
+	request := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/export?"+query, nil)
+		h.HandleExportMedia(c)
+		return w
+	}
+
+	// Act & Assert
+	require.Equal(t, http.StatusBadRequest, request("format=xml").Code)
+	require.Equal(t, http.StatusBadRequest, request("type=video").Code)
+
+	w := request("")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+	var rows []exportRow
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var row exportRow
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &row))
+		rows = append(rows, row)
+	}
+	require.Len(t, rows, exportBatchSize+3)
+	require.Equal(t, "image-000.png", rows[0].FileName)
+	require.Equal(t, "image-501.png", rows[exportBatchSize+1].FileName)
+	require.Equal(t, "doc", rows[exportBatchSize+2].Type)
+
+	w = request("format=csv&type=doc")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, `attachment; filename="media-export.csv"`, w.Header().Get("Content-Disposition"))
+	records, err := csv.NewReader(strings.NewReader(w.Body.String())).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	require.Equal(t, exportColumns, records[0])
+	require.Equal(t, []string{"doc", "report, final.pdf", "ab", "Report"}, []string{records[1][0], records[1][2], records[1][7], records[1][10]})
+}
+
+func TestHandleExportMedia_RestrictedFolder(t *testing.T) {
+	// Arrange
+	h := newTestMediaHandler(t)
+	require.NoError(t, database.DB.Create(&models.Image{FileName: "logo.png", Checksum: []byte("logo")}).Error)
+	require.NoError(t, database.DB.Create(&models.Doc{FileName: "contract.pdf", Checksum: []byte("contract")}).Error)
+	outsider := restrictFolder(t, "docs")
+	request := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/export?"+query, nil)
+		auth.SetPrincipal(c, auth.UserPrincipal(auth.MethodJWT, outsider))
+		h.HandleExportMedia(c)
+		return w
+	}
+
+	// Act & Assert
+	w := request("")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), "logo.png")
+	require.NotContains(t, w.Body.String(), "contract.pdf")
+
+	// Only the header is left of an export of the restricted folder
+	w = request("format=csv&type=doc")
+	require.Equal(t, http.StatusOK, w.Code)
+	records, err := csv.NewReader(strings.NewReader(w.Body.String())).ReadAll()
+	require.NoError(t, err)
+	require.Equal(t, [][]string{exportColumns}, records)
+}
@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/acl"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+)
+
+// rootFolder is the ID of the folder holding the folder of every media
+// type. Media folders hold files only, so the tree is two levels deep.
+const rootFolder = "root"
+
+const (
+	defaultFolderDepth = 1
+	maxFolderDepth     = 10
+
+	defaultFolderLimit = 100
+	maxFolderLimit     = 1000
+)
+
+// folderMediaTypes are the media types with a folder, in listing order.
+var folderMediaTypes = []string{models.MediaTypeImage, models.MediaTypeDoc}
+
+// folderNode is a folder of a folder tree.
+type folderNode struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Path      string `json:"path"`
+	MediaType string `json:"media_type,omitempty"`
+	// FileCount counts the files directly in the folder, TotalFileCount
+	// those in its subfolders too.
+	FileCount      int64 `json:"file_count"`
+	TotalFileCount int64 `json:"total_file_count"`
+	HasChildren    bool  `json:"has_children"`
+	// Children are only listed down to the requested depth.
+	Children []folderNode `json:"children,omitempty"`
+}
+
+// folderEntry is a folder or file listed by HandleFolderChildren.
+type folderEntry struct {
+	Kind string `json:"kind"`
+	// folderNode is set for folders and folderFile for files.
+	*folderNode
+	*folderFile
+}
+
+type folderFile struct {
+	Type      string    `json:"type"`
+	UUID      string    `json:"uuid"`
+	FileName  string    `json:"file_name"`
+	MimeType  string    `json:"mime_type"`
+	Size      int64     `json:"size"`
+	URL       string    `json:"url"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// HandleFolderTree returns a folder with its subfolders nested down to
+// ?depth= levels (1 by default), along with their file counts, so file
+// managers can render the tree in one request. The folders the request may
+// not read are left out, along with their files in the counts.
+func (h *MediaHandler) HandleFolderTree(c *gin.Context) {
+	depth := defaultFolderDepth
+	if val := c.Query("depth"); val != "" {
+		parsed, err := strconv.Atoi(val)
+		if err != nil || parsed < 0 || parsed > maxFolderDepth {
+			problem.InvalidFields(c, problem.FieldError{Field: "depth", Rule: "max", Message: "must be between 0 and " + strconv.Itoa(maxFolderDepth)})
+			return
+		}
+		depth = parsed
+	}
+
+	id := c.Param("id")
+	if !validFolder(id) {
+		problem.NotFound(c, "Folder not found")
+		return
+	}
+	if id != rootFolder && !acl.Check(c, id, models.AccessRead) {
+		return
+	}
+	readable, ok := readableTypes(c)
+	if !ok {
+		return
+	}
+	node, err := h.folderTree(c.Request.Context(), id, depth, readable)
+	if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to list folders")
+		return
+	}
+	c.JSON(http.StatusOK, node)
+}
+
+// HandleFolderChildren returns a page of the folders and files in a folder,
+// selected by ?limit= and ?offset=. Files are listed newest first, and the
+// folders the request may not read are left out.
+func (h *MediaHandler) HandleFolderChildren(c *gin.Context) {
+	limit, offset := defaultFolderLimit, 0
+	if val := c.Query("limit"); val != "" {
+		parsed, err := strconv.Atoi(val)
+		if err != nil || parsed < 1 || parsed > maxFolderLimit {
+			problem.InvalidFields(c, problem.FieldError{Field: "limit", Rule: "max", Message: "must be between 1 and " + strconv.Itoa(maxFolderLimit)})
+			return
+		}
+		limit = parsed
+	}
+	if val := c.Query("offset"); val != "" {
+		parsed, err := strconv.Atoi(val)
+		if err != nil || parsed < 0 {
+			problem.InvalidFields(c, problem.FieldError{Field: "offset", Rule: "min", Message: "must not be negative"})
+			return
+		}
+		offset = parsed
+	}
+
+	id := c.Param("id")
+	if !validFolder(id) {
+		problem.NotFound(c, "Folder not found")
+		return
+	}
+	if id != rootFolder && !acl.Check(c, id, models.AccessRead) {
+		return
+	}
+
+	ctx := c.Request.Context()
+	items := []folderEntry{}
+	var total int64
+	if id == rootFolder {
+		readable, ok := readableTypes(c)
+		if !ok {
+			return
+		}
+		root, err := h.folderTree(ctx, rootFolder, 1, readable)
+		if err != nil {
+			problem.Write(c, http.StatusInternalServerError, "Failed to list folder")
+			return
+		}
+		total = int64(len(root.Children))
+		for i := range root.Children[min(offset, len(root.Children)):min(offset+limit, len(root.Children))] {
+			items = append(items, folderEntry{Kind: "folder", folderNode: &root.Children[offset+i]})
+		}
+	} else {
+		files, count, err := h.folderFiles(ctx, models.MediaTypeFor(id), limit, offset)
+		if err != nil {
+			problem.Write(c, http.StatusInternalServerError, "Failed to list folder")
+			return
+		}
+		total = count
+		for i := range files {
+			files[i].URL = c.Request.Host + "/api/cdn/download/" + id + "/" + files[i].FileName
+			items = append(items, folderEntry{Kind: "file", folderFile: &files[i]})
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":     id,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+		"items":  items,
+	})
+}
+
+func validFolder(id string) bool {
+	return id == rootFolder || models.MediaTypeFor(id) != ""
+}
+
+// folderTree returns the folder with its subfolders down to depth levels,
+// leaving out the folders of the media types not readable.
+func (h *MediaHandler) folderTree(ctx context.Context, id string, depth int, readable map[string]bool) (folderNode, error) {
+	if id != rootFolder {
+		mediaType := models.MediaTypeFor(id)
+		count, err := h.countMedia(ctx, mediaType)
+		if err != nil {
+			return folderNode{}, err
+		}
+		return folderNode{ID: id, Name: id, Path: "/" + id, MediaType: mediaType, FileCount: count, TotalFileCount: count}, nil
+	}
+
+	root := folderNode{ID: rootFolder, Name: "", Path: "/"}
+	for _, mediaType := range folderMediaTypes {
+		if !readable[mediaType] {
+			continue
+		}
+		child, err := h.folderTree(ctx, models.MediaFolder(mediaType), depth-1, readable)
+		if err != nil {
+			return folderNode{}, err
+		}
+		root.HasChildren = true
+		root.TotalFileCount += child.TotalFileCount
+		if depth > 0 {
+			root.Children = append(root.Children, child)
+		}
+	}
+	return root, nil
+}
+
+func (h *MediaHandler) countMedia(ctx context.Context, mediaType string) (int64, error) {
+	if mediaType == models.MediaTypeImage {
+		return h.imageRepo.CountImages(ctx)
+	}
+	return h.docRepo.CountDocs(ctx)
+}
+
+// folderFiles returns a page of the files of a media type and their total
+// number.
+func (h *MediaHandler) folderFiles(ctx context.Context, mediaType string, limit, offset int) ([]folderFile, int64, error) {
+	total, err := h.countMedia(ctx, mediaType)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	files := []folderFile{}
+	if mediaType == models.MediaTypeImage {
+		images, err := h.imageRepo.GetImagesPage(ctx, limit, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, image := range images {
+			files = append(files, folderFile{Type: mediaType, UUID: image.UUID, FileName: image.FileName, MimeType: image.MimeType, CreatedAt: image.CreatedAt})
+		}
+	} else {
+		docs, err := h.docRepo.GetDocsPage(ctx, limit, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, doc := range docs {
+			files = append(files, folderFile{Type: mediaType, UUID: doc.UUID, FileName: doc.FileName, MimeType: doc.MimeType, CreatedAt: doc.CreatedAt})
+		}
+	}
+
+	for i, file := range files {
+		if info, err := os.Stat(filepath.Join(util.ExPath, "uploads", models.MediaFolder(mediaType), file.FileName)); err == nil {
+			files[i].Size = info.Size()
+		}
+	}
+	return files, total, nil
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleFolders(t *testing.T) {
+	// Arrange
+	h := newTestMediaHandler(t)
+	start := time.Now().Add(-time.Hour)
+	for i := 0; i < 3; i++ {
+		name := fmt.Sprintf("image-%d.png", i)
+		image := models.Image{FileName: name, Checksum: []byte(name)}
+		image.CreatedAt = start.Add(time.Duration(i) * time.Minute)
+		require.NoError(t, database.DB.Create(&image).Error)
+	}
+	require.NoError(t, database.DB.Create(&models.Doc{FileName: "report.pdf", Checksum: []byte("report")}).Error)
+
+	r := gin.New()
+	r.GET("/folders/:id/tree", h.HandleFolderTree)
+	r.GET("/folders/:id/children", h.HandleFolderChildren)
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+
+	// Act & Assert
+	w := get("/folders/root/tree")
+	require.Equal(t, http.StatusOK, w.Code)
+	var tree folderNode
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &tree))
+	require.Equal(t, int64(4), tree.TotalFileCount)
+	require.Len(t, tree.Children, 2)
+	require.Equal(t, "images", tree.Children[0].ID)
+	require.Equal(t, int64(3), tree.Children[0].FileCount)
+	require.Equal(t, int64(1), tree.Children[1].FileCount)
+
+	var shallow folderNode
+	require.NoError(t, json.Unmarshal(get("/folders/root/tree?depth=0").Body.Bytes(), &shallow))
+	require.Empty(t, shallow.Children)
+	require.True(t, shallow.HasChildren)
+	require.Equal(t, int64(4), shallow.TotalFileCount)
+	require.Equal(t, http.StatusBadRequest, get("/folders/root/tree?depth=99").Code)
+	require.Equal(t, http.StatusNotFound, get("/folders/videos/tree").Code)
+
+	var page struct {
+		Total int64            `json:"total"`
+		Items []map[string]any `json:"items"`
+	}
+	w = get("/folders/images/children?limit=2&offset=1")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	require.Equal(t, int64(3), page.Total)
+	require.Len(t, page.Items, 2)
+	require.Equal(t, "file", page.Items[0]["kind"])
+	require.Equal(t, "image-1.png", page.Items[0]["file_name"])
+	require.Equal(t, "image-0.png", page.Items[1]["file_name"])
+
+	require.NoError(t, json.Unmarshal(get("/folders/root/children").Body.Bytes(), &page))
+	require.Equal(t, int64(2), page.Total)
+	require.Equal(t, "folder", page.Items[1]["kind"])
+	require.Equal(t, "docs", page.Items[1]["id"])
+	require.Equal(t, http.StatusBadRequest, get("/folders/root/children?limit=0").Code)
+}
+
+func TestHandleFolders_Restricted(t *testing.T) {
+	// Arrange
+	h := newTestMediaHandler(t)
+	require.NoError(t, database.DB.Create(&models.Image{FileName: "poster.png", Checksum: []byte("poster")}).Error)
+	require.NoError(t, database.DB.Create(&models.Doc{FileName: "salaries.pdf", Checksum: []byte("salaries")}).Error)
+	restrictFolder(t, "docs")
+
+	r := gin.New()
+	r.GET("/folders/:id/tree", h.HandleFolderTree)
+	r.GET("/folders/:id/children", h.HandleFolderChildren)
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+
+	// Act & Assert
+	w := get("/folders/root/tree")
+	require.Equal(t, http.StatusOK, w.Code)
+	var tree folderNode
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &tree))
+	require.Equal(t, int64(1), tree.TotalFileCount)
+	require.Len(t, tree.Children, 1)
+	require.Equal(t, "images", tree.Children[0].ID)
+
+	var page struct {
+		Total int64            `json:"total"`
+		Items []map[string]any `json:"items"`
+	}
+	require.NoError(t, json.Unmarshal(get("/folders/root/children").Body.Bytes(), &page))
+	require.Equal(t, int64(1), page.Total)
+	require.Equal(t, "images", page.Items[0]["id"])
+	require.Equal(t, http.StatusUnauthorized, get("/folders/docs/tree").Code)
+	require.Equal(t, http.StatusUnauthorized, get("/folders/docs/children").Code)
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/acl"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"github.com/kevinanielsen/go-fast-cdn/src/settings"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+)
+
+// IntegrityEntry describes a file in an integrity manifest.
+type IntegrityEntry struct {
+	URL       string `json:"url"`
+	Integrity string `json:"integrity"`
+	Size      int64  `json:"size"`
+}
+
+// IntegrityManifestEnabled reports whether the integrity_manifest_enabled
+// setting, INTEGRITY_MANIFEST_ENABLED by default, turns on the public
+// integrity manifests.
+func IntegrityManifestEnabled() bool {
+	return settings.Default.Bool(settings.IntegrityManifestEnabled)
+}
+
+// HandleIntegrityManifest lists the subresource integrity hashes of every
+// image or document, e.g. /api/cdn/integrity/images, so websites can
+// generate integrity attributes for the assets they embed. Files waiting for
+// approval or rejected are left out, as they are not served, and restricted
+// folders are only listed to the users who may read them.
+func (h *MediaHandler) HandleIntegrityManifest(c *gin.Context) {
+	if !IntegrityManifestEnabled() {
+		problem.NotFound(c, "Integrity manifests are disabled")
+		return
+	}
+
+	folder := c.Param("type")
+	if models.MediaTypeFor(folder) != "" && !acl.Check(c, folder, models.AccessRead) {
+		return
+	}
+	// approved maps the file names to whether they are served
+	approved := map[string]bool{}
+	switch folder {
+	case models.MediaFolder(models.MediaTypeImage):
+		images, err := h.imageRepo.GetAllImages(c.Request.Context())
+		if err != nil {
+			problem.Write(c, http.StatusInternalServerError, "Failed to list images")
+			return
+		}
+		for _, image := range images {
+			approved[image.FileName] = models.ModerationApproved(image.ModerationStatus)
+		}
+	case models.MediaFolder(models.MediaTypeDoc):
+		docs, err := h.docRepo.GetAllDocs(c.Request.Context())
+		if err != nil {
+			problem.Write(c, http.StatusInternalServerError, "Failed to list documents")
+			return
+		}
+		for _, doc := range docs {
+			approved[doc.FileName] = models.ModerationApproved(doc.ModerationStatus)
+		}
+	default:
+		problem.Write(c, http.StatusBadRequest, "Type must be images or docs")
+		return
+	}
+
+	entries := map[string]IntegrityEntry{}
+	for name, served := range approved {
+		if !served {
+			continue
+		}
+		filePath := filepath.Join(util.ExPath, "uploads", folder, name)
+		info, err := os.Stat(filePath)
+		if err != nil {
+			continue
+		}
+		integrity, err := util.Integrity(filePath)
+		if err != nil {
+			log.Printf("Failed to hash %s/%s: %s\n", folder, name, err.Error())
+			continue
+		}
+		entries[name] = IntegrityEntry{
+			URL:       c.Request.Host + "/api/cdn/download/" + folder + "/" + name,
+			Integrity: integrity,
+			Size:      info.Size(),
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"algorithm":    "sha384",
+		"generated_at": time.Now().UTC(),
+		"files":        entries,
+	})
+}
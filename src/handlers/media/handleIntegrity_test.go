@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/auth"
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleIntegrityManifest(t *testing.T) {
+	// Arrange
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	docRepo := database.NewDocRepo(database.DB)
+	h := NewMediaHandler(database.NewImageRepo(database.DB), docRepo, database.NewMediaRelationRepo(database.DB), database.NewRenditionRepo(database.DB))
+
+	docsDir := filepath.Join(util.ExPath, "uploads", "docs")
+	require.NoError(t, os.MkdirAll(docsDir, 0o755))
+	for _, doc := range []models.Doc{
+		{FileName: "app.js", Checksum: []byte("a")},
+		{FileName: "bad.js", Checksum: []byte("b"), ModerationStatus: models.ModerationStatusPending},
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(docsDir, doc.FileName), []byte("alert(1)"), 0o644))
+		_, err := docRepo.AddDoc(context.Background(), doc)
+		require.NoError(t, err)
+	}
+
+	manifest := func(folder string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/cdn/integrity/"+folder, nil)
+		c.Params = []gin.Param{{Key: "type", Value: folder}}
+		h.HandleIntegrityManifest(c)
+		return w
+	}
+
+	// Act & Assert
+	require.Equal(t, http.StatusNotFound, manifest("docs").Code, "manifests are disabled by default")
+
+	t.Setenv("INTEGRITY_MANIFEST_ENABLED", "true")
+	require.Equal(t, http.StatusBadRequest, manifest("other").Code)
+
+	w := manifest("docs")
+	require.Equal(t, http.StatusOK, w.Code)
+	var body struct {
+		Files map[string]IntegrityEntry `json:"files"`
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&body))
+
+	sum := sha512.Sum384([]byte("alert(1)"))
+	require.Len(t, body.Files, 1)
+	require.Equal(t, "sha384-"+base64.StdEncoding.EncodeToString(sum[:]), body.Files["app.js"].Integrity)
+	require.Equal(t, int64(8), body.Files["app.js"].Size)
+}
+
+func TestHandleIntegrityManifest_RestrictedFolder(t *testing.T) {
+	// Arrange
+	h := newTestMediaHandler(t)
+	t.Setenv("INTEGRITY_MANIFEST_ENABLED", "true")
+	outsider := restrictFolder(t, "docs")
+	manifest := func(folder string) int {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/cdn/integrity/"+folder, nil)
+		c.Params = []gin.Param{{Key: "type", Value: folder}}
+		auth.SetPrincipal(c, auth.UserPrincipal(auth.MethodJWT, outsider))
+		h.HandleIntegrityManifest(c)
+		return w.Code
+	}
+
+	// Act & Assert
+	require.Equal(t, http.StatusForbidden, manifest("docs"))
+	require.Equal(t, http.StatusOK, manifest("images"))
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/acl"
+	"github.com/kevinanielsen/go-fast-cdn/src/auth"
+	"github.com/kevinanielsen/go-fast-cdn/src/middleware"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+)
+
+// HandleMediaDisposition sets how downloads of the given file are presented
+// unless the request asks otherwise, e.g.
+// {"disposition": "attachment", "download_name": "Annual report.pdf"}.
+// Empty values restore the defaults: inline, under the uploaded name.
+func (h *MediaHandler) HandleMediaDisposition(c *gin.Context) {
+	fileName := c.Param("filename")
+	body := struct {
+		Disposition  string `json:"disposition" binding:"omitempty,oneof=inline attachment"`
+		DownloadName string `json:"download_name"`
+	}{}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		problem.Invalid(c, err)
+		return
+	}
+	downloadName := util.DownloadName(body.DownloadName)
+	if body.DownloadName != "" && downloadName == "" {
+		problem.Write(c, http.StatusBadRequest, "Invalid download name")
+		return
+	}
+
+	ctx := c.Request.Context()
+	media, err := h.resolveMedia(ctx, fileName, c.Query("type"))
+	if err != nil {
+		abortLookup(c, err, "Media not found")
+		return
+	}
+	if !auth.InScope(c, media.OrganizationID) {
+		problem.Write(c, http.StatusForbidden, "Media belongs to another organization")
+		return
+	}
+	if !acl.Check(c, models.MediaFolder(media.Type), models.AccessWrite) {
+		return
+	}
+
+	if middleware.AbortIfStale(c, media.Version) {
+		return
+	}
+
+	ctx = middleware.Unchanged(c, media.UpdatedAt)
+	if media.Type == models.MediaTypeImage {
+		err = h.imageRepo.UpdateImageDisposition(ctx, fileName, body.Disposition, downloadName)
+	} else {
+		err = h.docRepo.UpdateDocDisposition(ctx, fileName, body.Disposition, downloadName)
+	}
+	if errors.Is(err, models.ErrStale) {
+		middleware.AbortStale(c)
+		return
+	}
+	if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to update disposition")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"filename":      fileName,
+		"type":          media.Type,
+		"disposition":   body.Disposition,
+		"download_name": downloadName,
+	})
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleMediaDisposition(t *testing.T) {
+	// Arrange
+	h := newTestMediaHandler(t)
+	require.NoError(t, database.DB.Create(&models.Doc{FileName: "form.pdf", Checksum: []byte("form")}).Error)
+	request := func(fileName, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPut, "/test", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Params = []gin.Param{{Key: "filename", Value: fileName}}
+		h.HandleMediaDisposition(c)
+		return w
+	}
+
+	// Act & Assert
+	require.Equal(t, http.StatusBadRequest, request("form.pdf", `{"disposition": "download"}`).Code)
+	require.Equal(t, http.StatusBadRequest, request("form.pdf", `{"download_name": "../"}`).Code)
+	require.Equal(t, http.StatusNotFound, request("missing.pdf", `{"disposition": "attachment"}`).Code)
+
+	require.Equal(t, http.StatusOK, request("form.pdf", `{"disposition": "attachment", "download_name": "forms/Form 2024.pdf"}`).Code)
+	doc, err := database.NewDocRepo(database.DB).GetDocByFileName(context.Background(), "form.pdf")
+	require.NoError(t, err)
+	require.Equal(t, models.DispositionAttachment, doc.Disposition)
+	require.Equal(t, "Form 2024.pdf", doc.DownloadName)
+}
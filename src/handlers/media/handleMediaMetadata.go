@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/acl"
+	"github.com/kevinanielsen/go-fast-cdn/src/auth"
+	"github.com/kevinanielsen/go-fast-cdn/src/middleware"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+)
+
+// HandleUpdateMediaMetadata changes the descriptive fields of a media, e.g.
+// {"alt_text": "A red bicycle", "attributes": {"photographer": "Ann"}}.
+// Fields left out keep their value, and a null attributes clears them. The
+// media is given by its UUID, or by its file name with an optional ?type=.
+func (h *MediaHandler) HandleUpdateMediaMetadata(c *gin.Context) {
+	body := struct {
+		Title       *string         `json:"title" binding:"omitempty,max=255"`
+		AltText     *string         `json:"alt_text" binding:"omitempty,max=1000"`
+		Description *string         `json:"description" binding:"omitempty,max=10000"`
+		Attributes  json.RawMessage `json:"attributes"`
+	}{}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		problem.Invalid(c, err)
+		return
+	}
+
+	ctx := c.Request.Context()
+	id := c.Param("filename")
+	media, err := h.resolveMediaByUUID(ctx, id)
+	if err != nil {
+		media, err = h.resolveMedia(ctx, id, c.Query("type"))
+	}
+	if err != nil {
+		abortLookup(c, err, "Media not found")
+		return
+	}
+	if !auth.InScope(c, media.OrganizationID) {
+		problem.Write(c, http.StatusForbidden, "Media belongs to another organization")
+		return
+	}
+	if !acl.Check(c, models.MediaFolder(media.Type), models.AccessWrite) {
+		return
+	}
+
+	metadata := media.Metadata
+	if body.Title != nil {
+		metadata.Title = *body.Title
+	}
+	if body.AltText != nil {
+		metadata.AltText = *body.AltText
+	}
+	if body.Description != nil {
+		metadata.Description = *body.Description
+	}
+	if len(body.Attributes) > 0 {
+		attributes, ok := compactObject(body.Attributes)
+		if !ok {
+			problem.InvalidFields(c, problem.FieldError{Field: "attributes", Rule: "object", Message: "must be a JSON object or null"})
+			return
+		}
+		metadata.Attributes = attributes
+	}
+
+	if middleware.AbortIfStale(c, media.Version) {
+		return
+	}
+
+	ctx = middleware.Unchanged(c, media.UpdatedAt)
+	if media.Type == models.MediaTypeImage {
+		err = h.imageRepo.UpdateImageMetadata(ctx, media.FileName, metadata)
+	} else {
+		err = h.docRepo.UpdateDocMetadata(ctx, media.FileName, metadata)
+	}
+	if errors.Is(err, models.ErrStale) {
+		middleware.AbortStale(c)
+		return
+	}
+	if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to update metadata")
+		return
+	}
+
+	c.JSON(http.StatusOK, struct {
+		Type     string `json:"type"`
+		FileName string `json:"file_name"`
+		models.MediaMetadata
+	}{media.Type, media.FileName, metadata})
+}
+
+// compactObject returns the JSON object in data without insignificant
+// whitespace, or nil for null. ok is false for anything else.
+func compactObject(data json.RawMessage) (json.RawMessage, bool) {
+	var object map[string]any
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil, false
+	}
+	if object == nil {
+		return nil, true
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, data); err != nil {
+		return nil, false
+	}
+	return buf.Bytes(), true
+}
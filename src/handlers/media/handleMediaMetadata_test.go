@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleUpdateMediaMetadata(t *testing.T) {
+	// Arrange
+	h := newTestMediaHandler(t)
+	image := models.Image{FileName: "bike.png", Checksum: []byte("bike")}
+	require.NoError(t, database.DB.Create(&image).Error)
+	request := func(id, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPatch, "/test", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Params = []gin.Param{{Key: "filename", Value: id}}
+		h.HandleUpdateMediaMetadata(c)
+		return w
+	}
+	stored := func() models.Image {
+		image, err := database.NewImageRepo(database.DB).GetImageByFileName(context.Background(), "bike.png")
+		require.NoError(t, err)
+		return image
+	}
+
+	// Act & Assert
+	require.Equal(t, http.StatusBadRequest, request("bike.png", `{"attributes": [1, 2]}`).Code)
+	require.Equal(t, http.StatusBadRequest, request("bike.png", `{"title": "`+strings.Repeat("a", 256)+`"}`).Code)
+	require.Equal(t, http.StatusNotFound, request("missing.png", `{"title": "Missing"}`).Code)
+
+	w := request("bike.png", `{"title": "Bike", "alt_text": "A red bicycle", "attributes": {"photographer": "Ann", "year": 2024}}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"type": "image", "file_name": "bike.png", "title": "Bike", "alt_text": "A red bicycle", "description": "", "attributes": {"photographer": "Ann", "year": 2024}}`, w.Body.String())
+
+	// Fields left out keep their value, also when addressed by UUID
+	require.Equal(t, http.StatusOK, request(image.UUID, `{"description": "Parked outside"}`).Code)
+	got := stored()
+	require.Equal(t, "Bike", got.Title)
+	require.Equal(t, "A red bicycle", got.AltText)
+	require.Equal(t, "Parked outside", got.Description)
+	require.JSONEq(t, `{"photographer": "Ann", "year": 2024}`, string(got.Attributes))
+
+	require.Equal(t, http.StatusOK, request("bike.png", `{"attributes": null}`).Code)
+	require.Empty(t, stored().Attributes)
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/acl"
+	"github.com/kevinanielsen/go-fast-cdn/src/auth"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"gorm.io/gorm"
+)
+
+// HandleMediaRelated lists every media linked to the given file, in both
+// directions of the relation, leaving out the ones in folders the request
+// may not read.
+func (h *MediaHandler) HandleMediaRelated(c *gin.Context) {
+	fileName := c.Param("filename")
+	if fileName == "" {
+		problem.Write(c, http.StatusBadRequest, "Media name is required")
+		return
+	}
+
+	media, err := h.resolveMedia(c.Request.Context(), fileName, c.Query("type"))
+	if err != nil {
+		abortLookup(c, err, "Media not found")
+		return
+	}
+	if !acl.Check(c, models.MediaFolder(media.Type), models.AccessRead) {
+		return
+	}
+
+	all, err := h.relationRepo.GetRelated(c.Request.Context(), media.Type, media.ID)
+	if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to get related media")
+		return
+	}
+	readable, ok := readableTypes(c)
+	if !ok {
+		return
+	}
+	related := []models.RelatedMedia{}
+	for _, rel := range all {
+		if readable[rel.Type] {
+			related = append(related, rel)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"filename": fileName,
+		"type":     media.Type,
+		"related":  related,
+	})
+}
+
+// HandleAddMediaRelation links the given file to another media with a typed
+// relation, e.g. {"target": "poster.png", "relation": "poster"}.
+func (h *MediaHandler) HandleAddMediaRelation(c *gin.Context) {
+	fileName := c.Param("filename")
+	body := struct {
+		Target     string `json:"target" binding:"required"`
+		TargetType string `json:"target_type"`
+		Relation   string `json:"relation" binding:"required"`
+	}{}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		problem.Invalid(c, err)
+		return
+	}
+
+	source, err := h.resolveMedia(c.Request.Context(), fileName, c.Query("type"))
+	if err != nil {
+		abortLookup(c, err, "Media not found")
+		return
+	}
+
+	target, err := h.resolveMedia(c.Request.Context(), body.Target, body.TargetType)
+	if err != nil {
+		abortLookup(c, err, "Target media not found")
+		return
+	}
+
+	if !auth.InScope(c, source.OrganizationID) || !auth.InScope(c, target.OrganizationID) {
+		problem.Write(c, http.StatusForbidden, "Media belongs to another organization")
+		return
+	}
+	if !acl.Check(c, models.MediaFolder(source.Type), models.AccessWrite) || !acl.Check(c, models.MediaFolder(target.Type), models.AccessRead) {
+		return
+	}
+
+	if source.Type == target.Type && source.ID == target.ID {
+		problem.Write(c, http.StatusBadRequest, "Media cannot be related to itself")
+		return
+	}
+
+	relation := models.MediaRelation{
+		SourceType: source.Type,
+		SourceID:   source.ID,
+		TargetType: target.Type,
+		TargetID:   target.ID,
+		Relation:   body.Relation,
+	}
+	if err := h.relationRepo.AddRelation(c.Request.Context(), &relation); err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to add relation")
+		return
+	}
+
+	c.JSON(http.StatusCreated, relation)
+}
+
+// HandleDeleteMediaRelation removes a relation the given file takes part in.
+func (h *MediaHandler) HandleDeleteMediaRelation(c *gin.Context) {
+	fileName := c.Param("filename")
+	relationID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		problem.Write(c, http.StatusBadRequest, "Invalid relation ID")
+		return
+	}
+
+	media, err := h.resolveMedia(c.Request.Context(), fileName, c.Query("type"))
+	if err != nil {
+		abortLookup(c, err, "Media not found")
+		return
+	}
+
+	if !auth.InScope(c, media.OrganizationID) {
+		problem.Write(c, http.StatusForbidden, "Media belongs to another organization")
+		return
+	}
+	if !acl.Check(c, models.MediaFolder(media.Type), models.AccessWrite) {
+		return
+	}
+
+	err = h.relationRepo.DeleteRelation(c.Request.Context(), media.Type, media.ID, uint(relationID))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		problem.NotFound(c, "Relation not found")
+		return
+	} else if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to delete relation")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Relation deleted successfully",
+	})
+}
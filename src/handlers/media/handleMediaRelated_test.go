@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/acl"
+	"github.com/kevinanielsen/go-fast-cdn/src/auth"
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	testutils "github.com/kevinanielsen/go-fast-cdn/src/testUtils"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleMediaRelated_AddAndList(t *testing.T) {
+	// Arrange
+	h := newTestMediaHandler(t)
+	_, err := database.NewImageRepo(database.DB).AddImage(context.Background(), models.Image{FileName: "poster.png", Checksum: []byte("poster")})
+	require.NoError(t, err)
+	_, err = database.NewDocRepo(database.DB).AddDoc(context.Background(), models.Doc{FileName: "script.pdf", Checksum: []byte("script")})
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/test", nil)
+	c.Params = []gin.Param{{Key: "filename", Value: "script.pdf"}}
+	testutils.MockJsonPost(c, map[string]string{"target": "poster.png", "relation": "poster"})
+
+	// Act
+	h.HandleAddMediaRelation(c)
+
+	// Assert
+	require.Equal(t, http.StatusCreated, w.Result().StatusCode)
+
+	// Act
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/test", nil)
+	c.Params = []gin.Param{{Key: "filename", Value: "poster.png"}}
+	h.HandleMediaRelated(c)
+
+	// Assert
+	require.Equal(t, http.StatusOK, w.Result().StatusCode)
+	result := struct {
+		Type    string                `json:"type"`
+		Related []models.RelatedMedia `json:"related"`
+	}{}
+	err = json.NewDecoder(w.Body).Decode(&result)
+	require.NoError(t, err)
+	require.Equal(t, models.MediaTypeImage, result.Type)
+	require.Len(t, result.Related, 1)
+	require.Equal(t, "poster", result.Related[0].Relation)
+	require.Equal(t, "incoming", result.Related[0].Direction)
+	require.Equal(t, "script.pdf", result.Related[0].FileName)
+}
+
+func TestHandleMediaRelated_NotFound(t *testing.T) {
+	// Arrange
+	h := newTestMediaHandler(t)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/test", nil)
+	c.Params = []gin.Param{{Key: "filename", Value: "missing.png"}}
+
+	// Act
+	h.HandleMediaRelated(c)
+
+	// Assert
+	require.Equal(t, http.StatusNotFound, w.Result().StatusCode)
+}
+
+func TestHandleMediaRelated_RestrictedFolder(t *testing.T) {
+	// Arrange
+	h := newTestMediaHandler(t)
+	poster := models.Image{FileName: "poster.png", Checksum: []byte("poster")}
+	require.NoError(t, database.DB.Create(&poster).Error)
+	script := models.Doc{FileName: "script.pdf", Checksum: []byte("script")}
+	require.NoError(t, database.DB.Create(&script).Error)
+	require.NoError(t, database.NewMediaRelationRepo(database.DB).AddRelation(context.Background(), &models.MediaRelation{
+		SourceType: models.MediaTypeDoc, SourceID: script.ID, TargetType: models.MediaTypeImage, TargetID: poster.ID, Relation: "poster",
+	}))
+	outsider := restrictFolder(t, "docs")
+	request := func(method, fileName string, body any) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(method, "/test", nil)
+		c.Params = []gin.Param{{Key: "filename", Value: fileName}, {Key: "id", Value: "1"}}
+		auth.SetPrincipal(c, auth.UserPrincipal(auth.MethodJWT, outsider))
+		switch {
+		case body != nil:
+			testutils.MockJsonPost(c, body)
+			h.HandleAddMediaRelation(c)
+		case method == http.MethodDelete:
+			h.HandleDeleteMediaRelation(c)
+		default:
+			h.HandleMediaRelated(c)
+		}
+		return w
+	}
+
+	// Act & Assert
+	// Media in the restricted folder are hidden from the related list
+	w := request(http.MethodGet, "poster.png", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"filename": "poster.png", "type": "image", "related": []}`, w.Body.String())
+
+	require.Equal(t, http.StatusForbidden, request(http.MethodGet, "script.pdf", nil).Code)
+	require.Equal(t, http.StatusForbidden, request(http.MethodPost, "script.pdf", map[string]string{"target": "poster.png", "relation": "cover"}).Code)
+	require.Equal(t, http.StatusForbidden, request(http.MethodPost, "poster.png", map[string]string{"target": "script.pdf", "relation": "script"}).Code)
+	require.Equal(t, http.StatusForbidden, request(http.MethodDelete, "script.pdf", nil).Code)
+}
+
+// restrictFolder grants a new group access to folder, so that only its
+// members may use it, and returns a user outside of the group.
+func restrictFolder(t *testing.T, folder string) *models.User {
+	t.Helper()
+	groups := database.NewGroupRepo(database.DB)
+	acl.Default = acl.New(groups)
+	t.Cleanup(func() { acl.Default = nil })
+
+	group := models.Group{Name: "Owners of " + folder}
+	require.NoError(t, groups.CreateGroup(context.Background(), &group))
+	require.NoError(t, groups.SetFolderPermission(context.Background(), &models.FolderPermission{Folder: folder, GroupID: group.ID, Access: models.AccessAdmin}))
+	outsider := &models.User{Email: "outsider@example.com", PasswordHash: "x", Role: "user"}
+	require.NoError(t, database.DB.Create(outsider).Error)
+	return outsider
+}
+
+func newTestMediaHandler(t *testing.T) *MediaHandler {
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+
+	return NewMediaHandler(
+		database.NewImageRepo(database.DB),
+		database.NewDocRepo(database.DB),
+		database.NewMediaRelationRepo(database.DB),
+		database.NewRenditionRepo(database.DB),
+	)
+}
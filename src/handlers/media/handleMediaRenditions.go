@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/acl"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"github.com/kevinanielsen/go-fast-cdn/src/renditions"
+)
+
+// renditionResponse is a rendition with the URL its file is downloaded from.
+type renditionResponse struct {
+	models.Rendition
+	URL string `json:"url"`
+}
+
+// HandleMediaRenditions lists the files derived from a media, e.g. the PDF
+// preview of a document. The media is given by its UUID, or by its file name
+// with an optional ?type= for names used by both an image and a document.
+func (h *MediaHandler) HandleMediaRenditions(c *gin.Context) {
+	id := c.Param("filename")
+	if id == "" {
+		problem.Write(c, http.StatusBadRequest, "Media ID is required")
+		return
+	}
+
+	ctx := c.Request.Context()
+	media, err := h.resolveMediaByUUID(ctx, id)
+	if err != nil {
+		media, err = h.resolveMedia(ctx, id, c.Query("type"))
+	}
+	if err != nil {
+		abortLookup(c, err, "Media not found")
+		return
+	}
+	if !acl.Check(c, models.MediaFolder(media.Type), models.AccessRead) {
+		return
+	}
+
+	list, err := h.renditionRepo.GetRenditions(ctx, media.Type, media.ID)
+	if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to get renditions")
+		return
+	}
+
+	result := make([]renditionResponse, 0, len(list))
+	for _, rendition := range list {
+		result = append(result, renditionResponse{rendition, renditions.URL(rendition.FileName)})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"type":       media.Type,
+		"id":         media.ID,
+		"renditions": result,
+	})
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/auth"
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/renditions"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleMediaRenditions(t *testing.T) {
+	// Arrange
+	h := newTestMediaHandler(t)
+	ctx := context.Background()
+	docRepo := database.NewDocRepo(database.DB)
+	_, err := docRepo.AddDoc(ctx, models.Doc{FileName: "report.docx", Checksum: []byte("report")})
+	require.NoError(t, err)
+	doc, err := docRepo.GetDocByFileName(ctx, "report.docx")
+	require.NoError(t, err)
+
+	tmp, err := renditions.CreateTemp(".pdf")
+	require.NoError(t, err)
+	tmp.WriteString("%PDF-1.7")
+	tmp.Close()
+	rendition := models.Rendition{SourceType: models.MediaTypeDoc, SourceID: doc.ID, Kind: models.RenditionPDF}
+	require.NoError(t, renditions.Save(ctx, database.NewRenditionRepo(database.DB), &rendition, tmp.Name(), ".pdf"))
+
+	list := func(id string) (int, []renditionResponse) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/test", nil)
+		c.Params = []gin.Param{{Key: "filename", Value: id}}
+		h.HandleMediaRenditions(c)
+		result := struct {
+			Renditions []renditionResponse `json:"renditions"`
+		}{}
+		json.NewDecoder(w.Body).Decode(&result)
+		return w.Code, result.Renditions
+	}
+
+	// Act & Assert
+	code, result := list(doc.UUID)
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, result, 1)
+	require.Equal(t, models.RenditionPDF, result[0].Kind)
+	require.Equal(t, int64(8), result[0].Size)
+	require.Equal(t, "/api/cdn/download/renditions/"+rendition.FileName, result[0].URL)
+
+	code, result = list("report.docx")
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, result, 1)
+
+	code, _ = list("missing.docx")
+	require.Equal(t, http.StatusNotFound, code)
+
+	// Deleting the document deletes its renditions
+	_, err = docRepo.DeleteDoc(ctx, "report.docx")
+	require.NoError(t, err)
+	require.NoFileExists(t, filepath.Join(renditions.Dir(), rendition.FileName))
+	remaining, err := database.NewRenditionRepo(database.DB).GetRenditions(ctx, models.MediaTypeDoc, doc.ID)
+	require.NoError(t, err)
+	require.Empty(t, remaining)
+}
+
+func TestHandleMediaRenditions_RestrictedFolder(t *testing.T) {
+	// Arrange
+	h := newTestMediaHandler(t)
+	_, err := database.NewDocRepo(database.DB).AddDoc(context.Background(), models.Doc{FileName: "report.docx", Checksum: []byte("report")})
+	require.NoError(t, err)
+	outsider := restrictFolder(t, "docs")
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/test", nil)
+	c.Params = []gin.Param{{Key: "filename", Value: "report.docx"}}
+	auth.SetPrincipal(c, auth.UserPrincipal(auth.MethodJWT, outsider))
+
+	// Act
+	h.HandleMediaRenditions(c)
+
+	// Assert
+	require.Equal(t, http.StatusForbidden, w.Code)
+}
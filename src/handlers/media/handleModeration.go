@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/audit"
+	"github.com/kevinanielsen/go-fast-cdn/src/cache"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/moderation"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+)
+
+// pendingMedia is an upload waiting for review.
+type pendingMedia struct {
+	Type           string    `json:"type"`
+	ID             uint      `json:"id"`
+	UUID           string    `json:"uuid"`
+	FileName       string    `json:"file_name"`
+	OrganizationID *uint     `json:"organization_id"`
+	CreatedAt      time.Time `json:"created_at"`
+	// DownloadURL serves the file to admins reviewing it.
+	DownloadURL string `json:"download_url"`
+}
+
+// HandleListPendingMedia returns the uploads waiting for review, oldest
+// first, optionally of one ?type=.
+func (h *MediaHandler) HandleListPendingMedia(c *gin.Context) {
+	mediaType := c.Query("type")
+	if mediaType != "" && models.MediaFolder(mediaType) == "" {
+		problem.InvalidFields(c, problem.FieldError{Field: "type", Rule: "oneof", Message: "must be image or doc"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	pending := []pendingMedia{}
+	if mediaType == "" || mediaType == models.MediaTypeImage {
+		images, err := h.imageRepo.GetImagesByModerationStatus(ctx, models.ModerationStatusPending)
+		if err != nil {
+			problem.Write(c, http.StatusInternalServerError, "Failed to fetch pending media")
+			return
+		}
+		for _, image := range images {
+			pending = append(pending, pendingMedia{
+				Type: models.MediaTypeImage, ID: image.ID, UUID: image.UUID, FileName: image.FileName,
+				OrganizationID: image.OrganizationID, CreatedAt: image.CreatedAt,
+				DownloadURL: c.Request.Host + "/api/cdn/download/images/" + image.FileName,
+			})
+		}
+	}
+	if mediaType == "" || mediaType == models.MediaTypeDoc {
+		docs, err := h.docRepo.GetDocsByModerationStatus(ctx, models.ModerationStatusPending)
+		if err != nil {
+			problem.Write(c, http.StatusInternalServerError, "Failed to fetch pending media")
+			return
+		}
+		for _, doc := range docs {
+			pending = append(pending, pendingMedia{
+				Type: models.MediaTypeDoc, ID: doc.ID, UUID: doc.UUID, FileName: doc.FileName,
+				OrganizationID: doc.OrganizationID, CreatedAt: doc.CreatedAt,
+				DownloadURL: c.Request.Host + "/api/cdn/download/docs/" + doc.FileName,
+			})
+		}
+	}
+
+	sort.SliceStable(pending, func(i, j int) bool { return pending[i].CreatedAt.Before(pending[j].CreatedAt) })
+	c.JSON(http.StatusOK, pending)
+}
+
+// HandleApproveMedia lets the media be served publicly. The media is given
+// by its UUID, or by its file name with an optional ?type=.
+func (h *MediaHandler) HandleApproveMedia(c *gin.Context) {
+	h.moderate(c, models.ModerationStatusApproved, "")
+}
+
+// HandleRejectMedia keeps the media from being served, with an optional
+// {"reason": "..."} passed on to the moderation hooks. The file is kept, so
+// a rejection can be reverted by approving the media, or the media deleted
+// as usual.
+func (h *MediaHandler) HandleRejectMedia(c *gin.Context) {
+	var body struct {
+		Reason string `json:"reason" binding:"max=1000"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil && !errors.Is(err, io.EOF) {
+		problem.Invalid(c, err)
+		return
+	}
+	h.moderate(c, models.ModerationStatusRejected, body.Reason)
+}
+
+func (h *MediaHandler) moderate(c *gin.Context, status, reason string) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+	media, err := h.resolveMediaByUUID(ctx, id)
+	if err != nil {
+		media, err = h.resolveMedia(ctx, id, c.Query("type"))
+	}
+	if err != nil {
+		abortLookup(c, err, "Media not found")
+		return
+	}
+
+	if media.Type == models.MediaTypeImage {
+		err = h.imageRepo.UpdateImageModerationStatus(ctx, media.FileName, status)
+	} else {
+		err = h.docRepo.UpdateDocModerationStatus(ctx, media.FileName, status)
+	}
+	if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to update moderation status")
+		return
+	}
+	cache.Invalidate(media.Type, media.FileName)
+
+	action, notification := audit.ActionMediaApproved, moderation.TypeApproved
+	if status == models.ModerationStatusRejected {
+		action, notification = audit.ActionMediaRejected, moderation.TypeRejected
+	}
+	audit.Record(c, action, media.Type+"/"+media.FileName, gin.H{
+		"previous_status": media.ModerationStatus,
+		"reason":          reason,
+	})
+	moderation.Notify(c, moderation.Notification{
+		Type: notification, MediaType: media.Type, FileName: media.FileName,
+		OrganizationID: media.OrganizationID, Reason: reason,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"type":              media.Type,
+		"file_name":         media.FileName,
+		"moderation_status": status,
+	})
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/auth"
+	"github.com/kevinanielsen/go-fast-cdn/src/middleware"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/moderation"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	testutils "github.com/kevinanielsen/go-fast-cdn/src/testUtils"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleModeration(t *testing.T) {
+	// Arrange
+	h := newTestMediaHandler(t)
+	ctx := context.Background()
+	imagesDir := filepath.Join(util.ExPath, "uploads", "images")
+	require.NoError(t, os.MkdirAll(imagesDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(imagesDir, "draft.png"), []byte("png"), 0o644))
+	_, err := h.imageRepo.AddImage(ctx, models.Image{FileName: "draft.png", Checksum: []byte("a"), ModerationStatus: models.ModerationStatusPending})
+	require.NoError(t, err)
+	_, err = h.docRepo.AddDoc(ctx, models.Doc{FileName: "terms.pdf", Checksum: []byte("b")})
+	require.NoError(t, err)
+	image, err := h.imageRepo.GetImageByFileName(ctx, "draft.png")
+	require.NoError(t, err)
+
+	var notifications []moderation.Notification
+	moderation.AddHook(func(n moderation.Notification) { notifications = append(notifications, n) })
+
+	r := gin.New()
+	r.Group("/download/images", func(c *gin.Context) {
+		if c.GetHeader("X-Admin") != "" {
+			auth.SetPrincipal(c, auth.UserPrincipal(auth.MethodJWT, &models.User{Email: "admin@example.com", Role: "admin"}))
+		}
+	}, middleware.Moderation(h.imageRepo, h.docRepo, models.MediaTypeImage)).Static("/", imagesDir)
+	download := func(admin bool) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/download/images/draft.png", nil)
+		if admin {
+			req.Header.Set("X-Admin", "1")
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+	moderate := func(handler gin.HandlerFunc, id string, body any) int {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/test", nil)
+		c.Params = []gin.Param{{Key: "id", Value: id}}
+		if body != nil {
+			testutils.MockJsonPost(c, body)
+		}
+		handler(c)
+		return w.Code
+	}
+
+	// Act & Assert
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/test", nil)
+	h.HandleListPendingMedia(c)
+	var pending []pendingMedia
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &pending))
+	require.Len(t, pending, 1)
+	require.Equal(t, "draft.png", pending[0].FileName)
+
+	w = download(false)
+	require.Equal(t, http.StatusForbidden, w.Code)
+	body := map[string]any{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	require.Equal(t, problem.CodeMediaNotApproved, body["code"])
+	require.Equal(t, models.ModerationStatusPending, body["moderation_status"])
+	w = download(true)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "private, no-store", w.Header().Get("Cache-Control"))
+
+	require.Equal(t, http.StatusOK, moderate(h.HandleRejectMedia, "draft.png", map[string]string{"reason": "Blurry"}))
+	require.Equal(t, http.StatusForbidden, download(false).Code)
+	require.Len(t, notifications, 1)
+	require.Equal(t, moderation.TypeRejected, notifications[0].Type)
+	require.Equal(t, "Blurry", notifications[0].Reason)
+
+	require.Equal(t, http.StatusOK, moderate(h.HandleApproveMedia, image.UUID, nil))
+	require.Equal(t, http.StatusOK, download(false).Code)
+	require.Equal(t, moderation.TypeApproved, notifications[1].Type)
+
+	require.Equal(t, http.StatusNotFound, moderate(h.HandleApproveMedia, "missing.png", nil))
+}
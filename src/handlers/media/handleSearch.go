@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+type SearchHandler struct {
+	searchRepo models.SearchRepository
+}
+
+func NewSearchHandler(searchRepo models.SearchRepository) *SearchHandler {
+	return &SearchHandler{searchRepo: searchRepo}
+}
+
+// searchHit is a search result with the URL to download the file.
+type searchHit struct {
+	models.SearchResult
+	DownloadURL string `json:"download_url"`
+}
+
+// HandleSearch finds documents containing every word of ?q=, best matches
+// first, with an excerpt of the matching text. ?limit= caps the number of
+// results (default 20, at most 100). Files in folders the request may not
+// read are left out.
+func (h *SearchHandler) HandleSearch(c *gin.Context) {
+	query := c.Query("q")
+	if query == "" {
+		problem.Write(c, http.StatusBadRequest, "Query is required")
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultSearchLimit)))
+	if err != nil || limit < 1 {
+		problem.Write(c, http.StatusBadRequest, "Invalid limit")
+		return
+	}
+	limit = min(limit, maxSearchLimit)
+
+	results, err := h.searchRepo.Search(c.Request.Context(), query, limit)
+	if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to search")
+		return
+	}
+
+	readable, ok := readableTypes(c)
+	if !ok {
+		return
+	}
+	hits := make([]searchHit, 0, len(results))
+	for _, result := range results {
+		if !readable[result.Type] {
+			continue
+		}
+		hits = append(hits, searchHit{
+			SearchResult: result,
+			DownloadURL:  c.Request.Host + "/api/cdn/download/" + models.MediaFolder(result.Type) + "/" + result.FileName,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"query":   query,
+		"results": hits,
+	})
+}
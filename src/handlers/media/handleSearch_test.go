@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/auth"
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/search"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleSearch(t *testing.T) {
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	ctx := context.Background()
+	docRepo := database.NewDocRepo(database.DB)
+	searchRepo := database.NewSearchRepo(database.DB)
+
+	docsDir := filepath.Join(util.ExPath, "uploads", "docs")
+	require.NoError(t, os.MkdirAll(docsDir, 0o755))
+	for name, text := range map[string]string{
+		"minutes.txt": "The board was running late and approved the budget.",
+		"recipe.txt":  "Mix flour and water.",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(docsDir, name), []byte(text), 0o644))
+		_, err := docRepo.AddDoc(ctx, models.Doc{FileName: name, Checksum: []byte(name)})
+		require.NoError(t, err)
+	}
+	require.Equal(t, 2, search.Backfill(ctx, searchRepo))
+
+	h := NewSearchHandler(searchRepo)
+	query := func(q string) (int, []searchHit) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/cdn/search?q="+q, nil)
+		h.HandleSearch(c)
+
+		var body struct {
+			Results []searchHit `json:"results"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &body)
+		return w.Code, body.Results
+	}
+
+	// Words are stemmed and the last one matches as a prefix
+	code, hits := query("run+budg")
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, hits, 1)
+	require.Equal(t, "minutes.txt", hits[0].FileName)
+	require.Equal(t, models.MediaTypeDoc, hits[0].Type)
+	require.Contains(t, hits[0].Snippet, "<mark>running</mark>")
+	require.Contains(t, hits[0].DownloadURL, "/api/cdn/download/docs/minutes.txt")
+
+	// FTS syntax is matched literally instead of failing
+	code, hits = query(`flour+%22AND+(`)
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, hits, 1)
+	require.Equal(t, "recipe.txt", hits[0].FileName)
+
+	code, _ = query("")
+	require.Equal(t, http.StatusBadRequest, code)
+
+	// The index follows renames and deletions
+	require.NoError(t, docRepo.RenameDoc(ctx, "recipe.txt", "bread.txt"))
+	_, hits = query("flour")
+	require.Len(t, hits, 1)
+	require.Equal(t, "bread.txt", hits[0].FileName)
+
+	_, err := docRepo.DeleteDoc(ctx, "bread.txt")
+	require.NoError(t, err)
+	_, hits = query("flour")
+	require.Empty(t, hits)
+}
+
+func TestHandleSearch_RestrictedFolder(t *testing.T) {
+	// Arrange
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	ctx := context.Background()
+	searchRepo := database.NewSearchRepo(database.DB)
+	docsDir := filepath.Join(util.ExPath, "uploads", "docs")
+	require.NoError(t, os.MkdirAll(docsDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(docsDir, "salaries.txt"), []byte("Salaries of the board"), 0o644))
+	_, err := database.NewDocRepo(database.DB).AddDoc(ctx, models.Doc{FileName: "salaries.txt", Checksum: []byte("salaries")})
+	require.NoError(t, err)
+	require.Equal(t, 1, search.Backfill(ctx, searchRepo))
+	outsider := restrictFolder(t, "docs")
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/cdn/search?q=salaries", nil)
+	auth.SetPrincipal(c, auth.UserPrincipal(auth.MethodJWT, outsider))
+
+	// Act
+	NewSearchHandler(searchRepo).HandleSearch(c)
+
+	// Assert
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"query": "salaries", "results": []}`, w.Body.String())
+}
@@ -0,0 +1,470 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/acl"
+	"github.com/kevinanielsen/go-fast-cdn/src/audit"
+	"github.com/kevinanielsen/go-fast-cdn/src/auth"
+	"github.com/kevinanielsen/go-fast-cdn/src/branding"
+	"github.com/kevinanielsen/go-fast-cdn/src/middleware"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/kevinanielsen/go-fast-cdn/src/watermark"
+	"gorm.io/gorm"
+)
+
+type shareRequest struct {
+	Type     string `json:"type" binding:"omitempty,oneof=image doc"`
+	FileName string `json:"filename" binding:"required_without=Files,excluded_with=Files"`
+	// Files makes the link a bundle of up to 100 files, named Name.
+	Files []mediaFile `json:"files" binding:"omitempty,min=1,max=100,dive"`
+	Name  string      `json:"name"`
+	// ExpiresIn is the lifetime of the link in seconds, 0 for no expiry.
+	ExpiresIn int64 `json:"expires_in" binding:"min=0"`
+	Landing   bool  `json:"landing"`
+	// Password must be entered by visitors before they get the files.
+	Password string `json:"password" binding:"omitempty,min=4,max=72"`
+	// MaxDownloads is the number of downloads allowed, 0 for no limit.
+	MaxDownloads int `json:"max_downloads" binding:"min=0"`
+}
+
+type shareResponse struct {
+	models.ShareLink
+	URL               string `json:"url"`
+	PasswordProtected bool   `json:"password_protected"`
+	Active            bool   `json:"active"`
+}
+
+// shareDetails is the data of the share landing page.
+type shareDetails struct {
+	FileName string
+	Size     string
+	IsImage  bool
+	RawURL   string
+	Download string
+}
+
+// bundleDetails is the data of the landing page of a bundle.
+type bundleDetails struct {
+	Files     []bundleFile
+	Size      string
+	Available int
+}
+
+type bundleFile struct {
+	shareDetails
+	Available bool
+}
+
+var shareTemplate = branding.NewTemplate(`{{define "content"}}
+<h1 style="word-break:break-all">{{.Data.FileName}}</h1>
+{{if .Data.IsImage}}<p><img src="{{.Data.RawURL}}" alt="{{.Data.FileName}}" style="max-width:100%;max-height:60vh;border-radius:6px"></p>{{end}}
+<p>Size: {{.Data.Size}}</p>
+<p><a class="button" href="{{.Data.Download}}">Download</a></p>
+{{end}}`)
+
+var bundleTemplate = branding.NewTemplate(`{{define "content"}}
+<h1 style="word-break:break-all">{{.Title}}</h1>
+<p>{{len .Data.Files}} files, {{.Data.Size}}</p>
+<table style="width:100%;border-collapse:collapse">
+{{range .Data.Files}}<tr style="border-top:1px solid #ddd">
+<td style="padding:8px 0;word-break:break-all">{{.FileName}}</td>
+<td>{{.Size}}</td>
+<td>{{if .Available}}<a href="{{.Download}}">Download</a>{{else}}Unavailable{{end}}</td>
+</tr>{{end}}
+</table>
+{{if .Data.Available}}<p><a class="button" href="?download=1">Download all as zip</a></p>{{end}}
+{{end}}`)
+
+var sharePasswordTemplate = branding.NewTemplate(`{{define "content"}}
+<h1 style="word-break:break-all">{{.Title}}</h1>
+<p>This link is protected with a password.</p>
+{{if .Data}}<p><strong>{{.Data}}</strong></p>{{end}}
+<form method="post">
+<p><input type="password" name="password" placeholder="Password" required autofocus></p>
+<p><button class="button" type="submit">Continue</button></p>
+</form>
+{{end}}`)
+
+var shareErrorTemplate = branding.NewTemplate(`{{define "content"}}<h1>{{.Title}}</h1><p>{{.Data}}</p>{{end}}`)
+
+// HandleCreateShareLink creates a share link for a file, or a bundle of
+// files, in folders the caller may read
+func (h *ShareHandler) HandleCreateShareLink(c *gin.Context) {
+	var req shareRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Invalid(c, err)
+		return
+	}
+
+	var mediaType string
+	var orgID *uint
+	var files []models.ShareLinkFile
+	if req.FileName != "" {
+		media, err := h.media.resolveMedia(c.Request.Context(), req.FileName, req.Type)
+		if err != nil {
+			abortLookup(c, err, "Media not found")
+			return
+		}
+		if !acl.Check(c, models.MediaFolder(media.Type), models.AccessRead) {
+			return
+		}
+		mediaType, orgID = media.Type, media.OrganizationID
+	} else {
+		// A bundle is branded as the organization owning its files, so they
+		// must all belong to the same one
+		for i, file := range req.Files {
+			media, err := h.media.resolveMedia(c.Request.Context(), file.FileName, file.Type)
+			if err != nil {
+				abortLookup(c, err, "Media not found: "+file.FileName)
+				return
+			}
+			if !acl.Check(c, models.MediaFolder(media.Type), models.AccessRead) {
+				return
+			}
+			if i > 0 && !sameOrganization(orgID, media.OrganizationID) {
+				problem.Write(c, http.StatusBadRequest, "All files of a bundle must belong to the same organization")
+				return
+			}
+			orgID = media.OrganizationID
+			files = append(files, models.ShareLinkFile{MediaType: media.Type, FileName: file.FileName})
+		}
+	}
+	if !auth.InScope(c, orgID) {
+		problem.Write(c, http.StatusForbidden, "Media belongs to another organization")
+		return
+	}
+
+	token, err := newShareToken()
+	if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to generate share token")
+		return
+	}
+	link := &models.ShareLink{
+		Token:          token,
+		MediaType:      mediaType,
+		FileName:       req.FileName,
+		Name:           req.Name,
+		Files:          files,
+		OrganizationID: orgID,
+		Landing:        req.Landing || len(files) > 0,
+		CreatedBy:      c.GetUint("user_id"),
+		MaxDownloads:   req.MaxDownloads,
+	}
+	if req.ExpiresIn > 0 {
+		expiresAt := time.Now().Add(time.Duration(req.ExpiresIn) * time.Second)
+		link.ExpiresAt = &expiresAt
+	}
+	if req.Password != "" {
+		if err := link.SetPassword(req.Password); err != nil {
+			problem.Write(c, http.StatusInternalServerError, "Failed to hash share link password")
+			return
+		}
+	}
+	if err := h.shareRepo.CreateShareLink(c.Request.Context(), link); err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to create share link")
+		return
+	}
+
+	audit.Record(c, audit.ActionShareCreated, shareTarget(link), gin.H{
+		"share_link_id":      link.ID,
+		"expires_at":         link.ExpiresAt,
+		"password_protected": link.HasPassword(),
+		"max_downloads":      link.MaxDownloads,
+	})
+	c.JSON(http.StatusCreated, newShareResponse(c, link))
+}
+
+// HandleListShareLinks returns the share links the caller may manage
+func (h *ShareHandler) HandleListShareLinks(c *gin.Context) {
+	h.listShareLinks(c, false)
+}
+
+// HandleListActiveShareLinks returns the share links of all organizations
+// that still serve their files, for admins auditing what is shared. ?all=1
+// includes expired links and those that reached their download limit.
+func (h *ShareHandler) HandleListActiveShareLinks(c *gin.Context) {
+	h.listShareLinks(c, c.Query("all") != "1")
+}
+
+func (h *ShareHandler) listShareLinks(c *gin.Context, activeOnly bool) {
+	links, err := h.shareRepo.GetAllShareLinks(c.Request.Context())
+	if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to fetch share links")
+		return
+	}
+
+	response := []shareResponse{}
+	for _, link := range links {
+		if auth.InScope(c, link.OrganizationID) && (!activeOnly || link.Active()) {
+			response = append(response, newShareResponse(c, &link))
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// HandleDeleteShareLink revokes a share link
+func (h *ShareHandler) HandleDeleteShareLink(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		problem.Write(c, http.StatusBadRequest, "Invalid share link ID")
+		return
+	}
+
+	link, err := h.shareRepo.GetShareLinkByID(c.Request.Context(), uint(id))
+	if err != nil || !auth.InScope(c, link.OrganizationID) {
+		problem.NotFound(c, "Share link not found")
+		return
+	}
+	if err := h.shareRepo.DeleteShareLink(c.Request.Context(), link.ID); err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to delete share link")
+		return
+	}
+
+	audit.Record(c, audit.ActionShareRevoked, shareTarget(link), gin.H{"share_link_id": link.ID})
+	c.JSON(http.StatusOK, gin.H{"message": "Share link deleted successfully"})
+}
+
+// HandleShareLink serves a share link. Links with a landing page show it
+// unless ?raw=1 is given, which serves the file bytes for programmatic
+// consumers; ?download=1 serves them as an attachment. For bundles both
+// serve all files as a zip archive, and ?file=<n> selects a single file.
+func (h *ShareHandler) HandleShareLink(c *gin.Context) {
+	raw := c.Query("raw") == "1" || c.Query("download") == "1"
+
+	link, err := h.shareRepo.GetShareLinkByToken(c.Request.Context(), c.Param("token"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		h.shareError(c, raw, http.StatusNotFound, nil, "Link not found", "This link does not exist or was revoked.")
+		return
+	} else if err != nil {
+		h.shareError(c, raw, http.StatusInternalServerError, nil, "Something went wrong", "The link could not be loaded.")
+		return
+	}
+	if link.Expired() {
+		h.shareError(c, raw, http.StatusGone, link.OrganizationID, "Link expired", "This link has expired.")
+		return
+	}
+	if link.Exhausted() && !h.resumesDownload(c, link, c.Query("file")) {
+		h.shareError(c, raw, http.StatusGone, link.OrganizationID, "Download limit reached", "This link reached its download limit.")
+		return
+	}
+	if !h.unlocked(c, link, raw) {
+		return
+	}
+
+	if link.IsBundle() {
+		h.serveBundle(c, link, raw)
+		return
+	}
+
+	h.tripwires.Check(c, link.MediaType, link.FileName)
+	if middleware.AbortIfTakenDown(c, h.takedownRepo, link.MediaType, link.FileName) {
+		return
+	}
+	if middleware.AbortIfNotApproved(c, h.media.imageRepo, h.media.docRepo, link.MediaType, link.FileName) {
+		return
+	}
+
+	filePath := filepath.Join(util.ExPath, "uploads", models.MediaFolder(link.MediaType), link.FileName)
+	info, err := os.Stat(filePath)
+	if err != nil {
+		h.shareError(c, raw, http.StatusNotFound, link.OrganizationID, "File not found", "The shared file no longer exists.")
+		return
+	}
+
+	if raw || !link.Landing {
+		if link.MediaType == models.MediaTypeImage {
+			marked, ok := watermark.Default.File(c, link.FileName, filePath)
+			if !ok {
+				return
+			}
+			filePath = marked
+		}
+		if !h.countDownload(c, link, raw, "") {
+			return
+		}
+		if c.Query("download") == "1" {
+			c.FileAttachment(filePath, link.FileName)
+			return
+		}
+		c.File(filePath)
+		return
+	}
+
+	branding.Render(c, http.StatusOK, shareTemplate, branding.Page{
+		Title:    link.FileName,
+		Branding: h.branding.Effective(link.OrganizationID),
+		Data: shareDetails{
+			FileName: link.FileName,
+			Size:     formatSize(info.Size()),
+			IsImage:  link.MediaType == models.MediaTypeImage,
+			RawURL:   "?raw=1",
+			Download: "?download=1",
+		},
+	})
+}
+
+// serveBundle serves the landing page of a bundle, the zip archive of its
+// files or, with ?file=<n>, one of its files.
+func (h *ShareHandler) serveBundle(c *gin.Context, link *models.ShareLink, raw bool) {
+	for _, file := range link.Files {
+		h.tripwires.Check(c, file.MediaType, file.FileName)
+	}
+	items, err := h.shareItems(c, link)
+	if err != nil {
+		h.shareError(c, raw, http.StatusInternalServerError, link.OrganizationID, "Something went wrong", "The bundle could not be loaded.")
+		return
+	}
+
+	if index := c.Query("file"); index != "" {
+		i, err := strconv.Atoi(index)
+		if err != nil || i < 0 || i >= len(link.Files) {
+			h.shareError(c, raw, http.StatusNotFound, link.OrganizationID, "File not found", "The bundle does not contain this file.")
+			return
+		}
+		file := link.Files[i]
+		if middleware.AbortIfTakenDown(c, h.takedownRepo, file.MediaType, file.FileName) {
+			return
+		}
+		if !items[i].Available {
+			h.shareError(c, raw, http.StatusNotFound, link.OrganizationID, "File not available", "This file is no longer available.")
+			return
+		}
+		if !h.countDownload(c, link, raw, index) {
+			return
+		}
+		if c.Query("download") == "1" {
+			c.FileAttachment(items[i].Path, file.FileName)
+			return
+		}
+		c.File(items[i].Path)
+		return
+	}
+
+	if raw {
+		// Archives are streamed without range support, so every request
+		// is counted
+		if !h.recordDownload(c, link, raw) {
+			return
+		}
+		streamArchive(c, link.Name, items)
+		return
+	}
+
+	details := bundleDetails{}
+	var total int64
+	for i, item := range items {
+		details.Files = append(details.Files, bundleFile{
+			shareDetails: shareDetails{
+				FileName: item.FileName,
+				Size:     formatSize(item.Size),
+				Download: "?file=" + strconv.Itoa(i) + "&download=1",
+			},
+			Available: item.Available,
+		})
+		if item.Available {
+			details.Available++
+			total += item.Size
+		}
+	}
+	details.Size = formatSize(total)
+
+	title := link.Name
+	if title == "" {
+		title = "Shared files"
+	}
+	branding.Render(c, http.StatusOK, bundleTemplate, branding.Page{
+		Title:    title,
+		Branding: h.branding.Effective(link.OrganizationID),
+		Data:     details,
+	})
+}
+
+// shareError answers with a problem for programmatic consumers and a
+// branded error page otherwise.
+func (h *ShareHandler) shareError(c *gin.Context, raw bool, status int, orgID *uint, title, message string) {
+	if raw {
+		problem.Write(c, status, message)
+		return
+	}
+	branding.Render(c, status, shareErrorTemplate, branding.Page{
+		Title:    title,
+		Branding: h.branding.Effective(orgID),
+		Data:     message,
+	})
+}
+
+// shareItems returns the files of the link, which are unavailable when
+// taken down in addition to the reasons of archiveItems.
+func (h *ShareHandler) shareItems(c *gin.Context, link *models.ShareLink) ([]archiveItem, error) {
+	files := link.Files
+	if !link.IsBundle() {
+		files = []models.ShareLinkFile{{MediaType: link.MediaType, FileName: link.FileName}}
+	}
+	items, err := h.media.archiveItems(c.Request.Context(), files)
+	if err != nil {
+		return nil, err
+	}
+	for i, file := range files {
+		if _, err := h.takedownRepo.GetTakedown(c.Request.Context(), file.MediaType, file.FileName); err == nil {
+			items[i].Available = false
+		}
+	}
+	return items, nil
+}
+
+func newShareResponse(c *gin.Context, link *models.ShareLink) shareResponse {
+	return shareResponse{
+		ShareLink:         *link,
+		URL:               shareURL(c, link),
+		PasswordProtected: link.HasPassword(),
+		Active:            link.Active(),
+	}
+}
+
+func shareTarget(link *models.ShareLink) string {
+	if link.IsBundle() {
+		return "bundle:" + link.Name
+	}
+	return link.MediaType + "/" + link.FileName
+}
+
+func sameOrganization(a, b *uint) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+}
+
+func shareURL(c *gin.Context, link *models.ShareLink) string {
+	return c.Request.Host + "/s/" + link.Token
+}
+
+func newShareToken() (string, error) {
+	b := make([]byte, 18)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// formatSize formats a file size in bytes for humans.
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return strconv.FormatInt(size, 10) + " B"
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return strconv.FormatFloat(float64(size)/float64(div), 'f', 1, 64) + " " + string("KMGTPE"[exp]) + "B"
+}
@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/branding"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"gorm.io/gorm"
+)
+
+// sharePasswordHeader carries the password of a share link for programmatic
+// consumers, which cannot fill in the form of the landing page.
+const sharePasswordHeader = "X-Share-Password"
+
+// shareInfo is the metadata of a share link, for frontends rendering their
+// own landing page.
+type shareInfo struct {
+	Token            string     `json:"token"`
+	Name             string     `json:"name,omitempty"`
+	Bundle           bool       `json:"bundle"`
+	ExpiresAt        *time.Time `json:"expires_at"`
+	PasswordRequired bool       `json:"password_required"`
+	// Locked is set when the password was not given, in which case the
+	// files are left out.
+	Locked       bool `json:"locked"`
+	MaxDownloads int  `json:"max_downloads"`
+	// DownloadsRemaining is null for links without a download limit.
+	DownloadsRemaining *int            `json:"downloads_remaining"`
+	Files              []shareInfoFile `json:"files,omitempty"`
+	Size               int64           `json:"size"`
+}
+
+type shareInfoFile struct {
+	MediaType string `json:"media_type"`
+	FileName  string `json:"file_name"`
+	Size      int64  `json:"size"`
+	Available bool   `json:"available"`
+	// URL downloads the file.
+	URL string `json:"url"`
+}
+
+// HandleShareLinkInfo returns the metadata of a share link. The files of
+// password protected links are only listed when the password is given in
+// the X-Share-Password header, or the visitor unlocked the link before.
+func (h *ShareHandler) HandleShareLinkInfo(c *gin.Context) {
+	link, err := h.shareRepo.GetShareLinkByToken(c.Request.Context(), c.Param("token"))
+	if err != nil {
+		problem.Lookup(c, err, "Share link not found", "Failed to fetch share link")
+		return
+	}
+	if link.Expired() {
+		problem.Write(c, http.StatusGone, "Share link expired")
+		return
+	}
+	if link.Exhausted() {
+		problem.Write(c, http.StatusGone, "Share link reached its download limit")
+		return
+	}
+
+	info := shareInfo{
+		Token:            link.Token,
+		Name:             link.Name,
+		Bundle:           link.IsBundle(),
+		ExpiresAt:        link.ExpiresAt,
+		PasswordRequired: link.HasPassword(),
+		MaxDownloads:     link.MaxDownloads,
+	}
+	if link.MaxDownloads > 0 {
+		remaining := link.MaxDownloads - link.DownloadCount
+		info.DownloadsRemaining = &remaining
+	}
+	if link.HasPassword() && !unlockedByCookie(c, link) {
+		password := c.GetHeader(sharePasswordHeader)
+		if password == "" {
+			info.Locked = true
+			c.JSON(http.StatusOK, info)
+			return
+		}
+		if !link.CheckPassword(password) {
+			problem.Abort(c, problem.New(http.StatusUnauthorized, problem.CodeInvalidCredentials, "Incorrect password"))
+			return
+		}
+	}
+
+	items, err := h.shareItems(c, link)
+	if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to fetch shared files")
+		return
+	}
+	for i, item := range items {
+		url := shareURL(c, link) + "?download=1"
+		if link.IsBundle() {
+			url = shareURL(c, link) + "?file=" + strconv.Itoa(i) + "&download=1"
+		}
+		info.Files = append(info.Files, shareInfoFile{
+			MediaType: item.MediaType,
+			FileName:  item.FileName,
+			Size:      item.Size,
+			Available: item.Available,
+			URL:       url,
+		})
+		if item.Available {
+			info.Size += item.Size
+		}
+	}
+	c.JSON(http.StatusOK, info)
+}
+
+// HandleUnlockShareLink checks the password entered on the landing page of
+// a password protected link and, when it matches, remembers it in a cookie
+// scoped to the link and sends the visitor back to the link.
+func (h *ShareHandler) HandleUnlockShareLink(c *gin.Context) {
+	link, err := h.shareRepo.GetShareLinkByToken(c.Request.Context(), c.Param("token"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		h.shareError(c, false, http.StatusNotFound, nil, "Link not found", "This link does not exist or was revoked.")
+		return
+	} else if err != nil {
+		h.shareError(c, false, http.StatusInternalServerError, nil, "Something went wrong", "The link could not be loaded.")
+		return
+	}
+	if link.Expired() {
+		h.shareError(c, false, http.StatusGone, link.OrganizationID, "Link expired", "This link has expired.")
+		return
+	}
+
+	if link.HasPassword() {
+		if !link.CheckPassword(c.PostForm("password")) {
+			h.renderPasswordForm(c, link, "Incorrect password.")
+			return
+		}
+		cookie := &http.Cookie{
+			Name:     shareCookieName(link),
+			Value:    shareCookieValue(link),
+			Path:     "/s/" + link.Token,
+			HttpOnly: true,
+			Secure:   c.Request.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		}
+		if link.ExpiresAt != nil {
+			cookie.Expires = *link.ExpiresAt
+		}
+		http.SetCookie(c.Writer, cookie)
+	}
+	c.Redirect(http.StatusSeeOther, "/s/"+link.Token)
+}
+
+// unlocked reports whether the visitor may get the files of the link,
+// answering with the password form or a JSON error otherwise.
+func (h *ShareHandler) unlocked(c *gin.Context, link *models.ShareLink, raw bool) bool {
+	if !link.HasPassword() || unlockedByCookie(c, link) {
+		return true
+	}
+	if password := c.GetHeader(sharePasswordHeader); password != "" && link.CheckPassword(password) {
+		return true
+	}
+	if raw {
+		problem.Write(c, http.StatusUnauthorized, "This link requires a password.")
+		return false
+	}
+	h.renderPasswordForm(c, link, "")
+	return false
+}
+
+func (h *ShareHandler) renderPasswordForm(c *gin.Context, link *models.ShareLink, message string) {
+	title := link.Name
+	if title == "" {
+		title = link.FileName
+	}
+	if title == "" {
+		title = "Shared files"
+	}
+	branding.Render(c, http.StatusUnauthorized, sharePasswordTemplate, branding.Page{
+		Title:    title,
+		Branding: h.branding.Effective(link.OrganizationID),
+		Data:     message,
+	})
+}
+
+// shareDownloadTTL is how long a counted download may be resumed without
+// being counted again.
+const shareDownloadTTL = time.Hour
+
+// countDownload counts a download of file, the index of a bundle file or
+// empty for single files, answering 410 once the link reached its download
+// limit. Ranged requests continuing a counted download are not counted
+// again, see resumesDownload; every other request is.
+func (h *ShareHandler) countDownload(c *gin.Context, link *models.ShareLink, raw bool, file string) bool {
+	if h.resumesDownload(c, link, file) {
+		return true
+	}
+	if !h.recordDownload(c, link, raw) {
+		return false
+	}
+	if link.MaxDownloads > 0 {
+		expires := time.Now().Add(shareDownloadTTL)
+		http.SetCookie(c.Writer, &http.Cookie{
+			Name:     shareDownloadCookieName(link, file),
+			Value:    h.shareDownloadCookieValue(link, file, expires.Unix()),
+			Path:     "/s/" + link.Token,
+			Expires:  expires,
+			HttpOnly: true,
+			Secure:   c.Request.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+	return true
+}
+
+// recordDownload counts a download of the link, answering 410 once it
+// reached its download limit.
+func (h *ShareHandler) recordDownload(c *gin.Context, link *models.ShareLink, raw bool) bool {
+	counted, err := h.shareRepo.RecordShareDownload(c.Request.Context(), link.ID)
+	if err != nil {
+		h.shareError(c, raw, http.StatusInternalServerError, link.OrganizationID, "Something went wrong", "The download could not be started.")
+		return false
+	}
+	if !counted {
+		h.shareError(c, raw, http.StatusGone, link.OrganizationID, "Download limit reached", "This link reached its download limit.")
+		return false
+	}
+	return true
+}
+
+// resumesDownload reports whether the request asks for a range of file and
+// carries the cookie countDownload hands out with a counted download of it,
+// which proves the download was counted less than shareDownloadTTL ago.
+func (h *ShareHandler) resumesDownload(c *gin.Context, link *models.ShareLink, file string) bool {
+	if c.GetHeader("Range") == "" {
+		return false
+	}
+	value, err := c.Cookie(shareDownloadCookieName(link, file))
+	if err != nil {
+		return false
+	}
+	unix, _, _ := strings.Cut(value, ".")
+	expires, err := strconv.ParseInt(unix, 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return false
+	}
+	return hmac.Equal([]byte(value), []byte(h.shareDownloadCookieValue(link, file, expires)))
+}
+
+func shareDownloadCookieName(link *models.ShareLink, file string) string {
+	name := "share_download_" + strconv.FormatUint(uint64(link.ID), 10)
+	if file != "" {
+		name += "_" + file
+	}
+	return name
+}
+
+func (h *ShareHandler) shareDownloadCookieValue(link *models.ShareLink, file string, expires int64) string {
+	unix := strconv.FormatInt(expires, 10)
+	return unix + "." + h.jwtService.SignValue("share-download", link.Token+"/"+file+"/"+unix)
+}
+
+func unlockedByCookie(c *gin.Context, link *models.ShareLink) bool {
+	value, err := c.Cookie(shareCookieName(link))
+	return err == nil && subtle.ConstantTimeCompare([]byte(value), []byte(shareCookieValue(link))) == 1
+}
+
+func shareCookieName(link *models.ShareLink) string {
+	return "share_" + strconv.FormatUint(uint64(link.ID), 10)
+}
+
+// shareCookieValue proves that the visitor entered the password of the
+// link. It derives from the password hash, which never leaves the server,
+// so it cannot be forged and stops working when the link is recreated.
+func shareCookieValue(link *models.ShareLink) string {
+	sum := sha256.Sum256([]byte(link.Token + "\x00" + link.PasswordHash))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,409 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/auth"
+	"github.com/kevinanielsen/go-fast-cdn/src/branding"
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/middleware"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	testutils "github.com/kevinanielsen/go-fast-cdn/src/testUtils"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/kevinanielsen/go-fast-cdn/src/watermark"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestShareHandler(t *testing.T) *ShareHandler {
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	return NewShareHandler(
+		database.NewImageRepo(database.DB),
+		database.NewDocRepo(database.DB),
+		database.NewShareLinkRepo(database.DB),
+		database.NewTakedownRepo(database.DB),
+		middleware.NewTripwireMonitor(database.NewTripwireRepo(database.DB)),
+		branding.NewStore(database.NewConfigRepo(database.DB)),
+	)
+}
+
+func TestHandleShareLink_Landing(t *testing.T) {
+	// Arrange
+	h := newTestShareHandler(t)
+	docsDir := filepath.Join(util.ExPath, "uploads", "docs")
+	require.NoError(t, os.MkdirAll(docsDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(docsDir, "report.txt"), []byte("quarterly numbers"), 0o644))
+	_, err := database.NewDocRepo(database.DB).AddDoc(context.Background(), models.Doc{FileName: "report.txt", Checksum: []byte("report")})
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/test", nil)
+	testutils.MockJsonPost(c, map[string]any{"filename": "report.txt", "landing": true})
+	h.HandleCreateShareLink(c)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var created shareResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	require.Equal(t, models.MediaTypeDoc, created.MediaType)
+	require.True(t, strings.HasSuffix(created.URL, "/s/"+created.Token))
+
+	r := gin.New()
+	r.GET("/s/:token", h.HandleShareLink)
+	get := func(url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		return w
+	}
+
+	// Act & Assert
+	landing := get("/s/" + created.Token)
+	require.Equal(t, http.StatusOK, landing.Code)
+	require.Contains(t, landing.Header().Get("Content-Type"), "text/html")
+	require.Contains(t, landing.Body.String(), "report.txt")
+	require.Contains(t, landing.Body.String(), "17 B")
+	require.Contains(t, landing.Body.String(), "?download=1")
+
+	raw := get("/s/" + created.Token + "?raw=1")
+	require.Equal(t, http.StatusOK, raw.Code)
+	require.Equal(t, "quarterly numbers", raw.Body.String())
+
+	missing := get("/s/unknown?raw=1")
+	require.Equal(t, http.StatusNotFound, missing.Code)
+	require.Equal(t, problem.ContentType, missing.Header().Get("Content-Type"))
+	require.Contains(t, missing.Body.String(), `"code":"resource.not_found"`)
+
+	expired := time.Now().Add(-time.Minute)
+	link := &models.ShareLink{Token: "expired", MediaType: models.MediaTypeDoc, FileName: "report.txt", ExpiresAt: &expired}
+	require.NoError(t, database.NewShareLinkRepo(database.DB).CreateShareLink(context.Background(), link))
+	require.Equal(t, http.StatusGone, get("/s/expired").Code)
+}
+
+func TestFormatSize(t *testing.T) {
+	require.Equal(t, "512 B", formatSize(512))
+	require.Equal(t, "1.5 KB", formatSize(1536))
+	require.Equal(t, "2.0 MB", formatSize(2*1024*1024))
+}
+
+func TestHandleShareLink_Bundle(t *testing.T) {
+	// Arrange
+	h := newTestShareHandler(t)
+	docsDir := filepath.Join(util.ExPath, "uploads", "docs")
+	require.NoError(t, os.MkdirAll(docsDir, 0o755))
+	for _, name := range []string{"a.txt", "b.txt"} {
+		require.NoError(t, os.WriteFile(filepath.Join(docsDir, name), []byte("contents of "+name), 0o644))
+		_, err := database.NewDocRepo(database.DB).AddDoc(context.Background(), models.Doc{FileName: name, Checksum: []byte(name)})
+		require.NoError(t, err)
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/test", nil)
+	testutils.MockJsonPost(c, map[string]any{
+		"name":  "Quarterly report",
+		"files": []map[string]string{{"filename": "a.txt"}, {"filename": "b.txt", "type": "doc"}},
+	})
+	h.HandleCreateShareLink(c)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var created shareResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	require.True(t, created.Landing)
+	require.Len(t, created.Files, 2)
+
+	r := gin.New()
+	r.GET("/s/:token", h.HandleShareLink)
+	get := func(url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		return w
+	}
+
+	// Act & Assert
+	landing := get("/s/" + created.Token)
+	require.Equal(t, http.StatusOK, landing.Code)
+	require.Contains(t, landing.Body.String(), "Quarterly report")
+	require.Contains(t, landing.Body.String(), "b.txt")
+	require.Contains(t, landing.Body.String(), "Download all as zip")
+
+	single := get("/s/" + created.Token + "?file=1&raw=1")
+	require.Equal(t, "contents of b.txt", single.Body.String())
+
+	archive := get("/s/" + created.Token + "?download=1")
+	require.Equal(t, http.StatusOK, archive.Code)
+	require.Equal(t, `attachment; filename="Quarterly report.zip"`, archive.Header().Get("Content-Disposition"))
+	zr, err := zip.NewReader(bytes.NewReader(archive.Body.Bytes()), int64(archive.Body.Len()))
+	require.NoError(t, err)
+	require.Len(t, zr.File, 2)
+	require.Equal(t, "a.txt", zr.File[0].Name)
+}
+
+func TestHandleShareLink_PasswordAndDownloadLimit(t *testing.T) {
+	// Arrange
+	h := newTestShareHandler(t)
+	docsDir := filepath.Join(util.ExPath, "uploads", "docs")
+	require.NoError(t, os.MkdirAll(docsDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(docsDir, "secret.txt"), []byte("secret"), 0o644))
+	_, err := database.NewDocRepo(database.DB).AddDoc(context.Background(), models.Doc{FileName: "secret.txt", Checksum: []byte("secret")})
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/test", nil)
+	testutils.MockJsonPost(c, map[string]any{"filename": "secret.txt", "landing": true, "password": "hunter22", "max_downloads": 2})
+	h.HandleCreateShareLink(c)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var created shareResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	require.True(t, created.PasswordProtected)
+	require.Equal(t, 2, created.MaxDownloads)
+	require.NotContains(t, w.Body.String(), "hash")
+
+	r := gin.New()
+	r.GET("/s/:token", h.HandleShareLink)
+	r.POST("/s/:token", h.HandleUnlockShareLink)
+	r.GET("/s/:token/info", h.HandleShareLinkInfo)
+	r.GET("/admin/shares", h.HandleListActiveShareLinks)
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	path := "/s/" + created.Token
+
+	// Act & Assert: locked until the password is given
+	form := serve(httptest.NewRequest(http.MethodGet, path, nil))
+	require.Equal(t, http.StatusUnauthorized, form.Code)
+	require.Contains(t, form.Body.String(), `type="password"`)
+	require.Equal(t, http.StatusUnauthorized, serve(httptest.NewRequest(http.MethodGet, path+"?raw=1", nil)).Code)
+
+	info := serve(httptest.NewRequest(http.MethodGet, path+"/info", nil))
+	require.Equal(t, http.StatusOK, info.Code)
+	require.Contains(t, info.Body.String(), `"locked":true`)
+	require.NotContains(t, info.Body.String(), "secret.txt")
+
+	wrong := httptest.NewRequest(http.MethodPost, path, strings.NewReader("password=wrong"))
+	wrong.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	require.Equal(t, http.StatusUnauthorized, serve(wrong).Code)
+
+	unlock := httptest.NewRequest(http.MethodPost, path, strings.NewReader("password=hunter22"))
+	unlock.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	unlocked := serve(unlock)
+	require.Equal(t, http.StatusSeeOther, unlocked.Code)
+	cookies := unlocked.Result().Cookies()
+	require.Len(t, cookies, 1)
+
+	landing := httptest.NewRequest(http.MethodGet, path, nil)
+	landing.AddCookie(cookies[0])
+	require.Equal(t, http.StatusOK, serve(landing).Code)
+
+	withHeader := httptest.NewRequest(http.MethodGet, path+"/info", nil)
+	withHeader.Header.Set(sharePasswordHeader, "hunter22")
+	info = serve(withHeader)
+	require.Equal(t, http.StatusOK, info.Code)
+	var details shareInfo
+	require.NoError(t, json.Unmarshal(info.Body.Bytes(), &details))
+	require.False(t, details.Locked)
+	require.Len(t, details.Files, 1)
+	require.Equal(t, 2, *details.DownloadsRemaining)
+
+	// Two downloads are allowed, resuming a counted one is not counted
+	first := httptest.NewRequest(http.MethodGet, path+"?raw=1", nil)
+	first.Header.Set(sharePasswordHeader, "hunter22")
+	started := serve(first)
+	require.Equal(t, http.StatusOK, started.Code)
+	downloadCookies := started.Result().Cookies()
+	require.Len(t, downloadCookies, 1)
+	resume := httptest.NewRequest(http.MethodGet, path+"?raw=1", nil)
+	resume.Header.Set(sharePasswordHeader, "hunter22")
+	resume.Header.Set("Range", "bytes=3-")
+	resume.AddCookie(downloadCookies[0])
+	require.Equal(t, http.StatusPartialContent, serve(resume).Code)
+	download := httptest.NewRequest(http.MethodGet, path+"?raw=1", nil)
+	download.Header.Set(sharePasswordHeader, "hunter22")
+	require.Equal(t, http.StatusOK, serve(download).Code)
+
+	// The last counted download may still be resumed
+	require.Equal(t, http.StatusPartialContent, serve(resume).Code)
+	download = httptest.NewRequest(http.MethodGet, path+"?raw=1", nil)
+	download.Header.Set(sharePasswordHeader, "hunter22")
+	require.Equal(t, http.StatusGone, serve(download).Code)
+
+	active := serve(httptest.NewRequest(http.MethodGet, "/admin/shares", nil))
+	require.Equal(t, "[]", active.Body.String())
+	all := serve(httptest.NewRequest(http.MethodGet, "/admin/shares?all=1", nil))
+	require.Contains(t, all.Body.String(), `"download_count":2`)
+	require.Contains(t, all.Body.String(), `"active":false`)
+}
+
+func TestHandleShareLink_RangesAreCounted(t *testing.T) {
+	// Arrange
+	h := newTestShareHandler(t)
+	docsDir := filepath.Join(util.ExPath, "uploads", "docs")
+	require.NoError(t, os.MkdirAll(docsDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(docsDir, "once.txt"), []byte("only once"), 0o644))
+	_, err := database.NewDocRepo(database.DB).AddDoc(context.Background(), models.Doc{FileName: "once.txt", Checksum: []byte("once")})
+	require.NoError(t, err)
+
+	r := gin.New()
+	r.GET("/s/:token", h.HandleShareLink)
+	links := database.NewShareLinkRepo(database.DB)
+	share := func() (*models.ShareLink, string) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/test", nil)
+		testutils.MockJsonPost(c, map[string]any{"filename": "once.txt", "max_downloads": 1})
+		h.HandleCreateShareLink(c)
+		require.Equal(t, http.StatusCreated, w.Code)
+		var created shareResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+		link, err := links.GetShareLinkByToken(context.Background(), created.Token)
+		require.NoError(t, err)
+		return link, "/s/" + created.Token + "?raw=1"
+	}
+	download := func(path, rangeHeader string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Range", rangeHeader)
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// Act & Assert: ranges not continuing a counted download are counted
+	for _, rangeHeader := range []string{"bytes=-9", "bytes=-8", "bytes=1-", "bytes=0-"} {
+		_, path := share()
+		first := download(path, rangeHeader)
+		require.Equal(t, http.StatusPartialContent, first.Code, rangeHeader)
+		again := download(path, rangeHeader)
+		require.Equal(t, http.StatusGone, again.Code, rangeHeader)
+		require.Equal(t, problem.ContentType, again.Header().Get("Content-Type"))
+	}
+
+	// Cookies of other links, forged and expired ones do not resume
+	link, path := share()
+	started := download(path, "bytes=0-3")
+	require.Equal(t, "only", started.Body.String())
+	cookie := started.Result().Cookies()[0]
+	require.Equal(t, "y once", download(path, "bytes=3-", cookie).Body.String())
+
+	_, other := share()
+	require.Equal(t, http.StatusPartialContent, download(other, "bytes=3-", cookie).Code)
+	require.Equal(t, http.StatusGone, download(other, "bytes=3-", cookie).Code)
+
+	unix, _, _ := strings.Cut(cookie.Value, ".")
+	forged := &http.Cookie{Name: cookie.Name, Value: unix + ".forged"}
+	require.Equal(t, http.StatusGone, download(path, "bytes=3-", forged).Code)
+	expired := &http.Cookie{Name: cookie.Name, Value: h.shareDownloadCookieValue(link, "", time.Now().Add(-time.Minute).Unix())}
+	require.Equal(t, http.StatusGone, download(path, "bytes=3-", expired).Code)
+}
+
+func TestHandleCreateShareLink_RestrictedFolder(t *testing.T) {
+	// Arrange
+	h := newTestShareHandler(t)
+	require.NoError(t, database.DB.Create(&models.Image{FileName: "logo.png", Checksum: []byte("logo")}).Error)
+	require.NoError(t, database.DB.Create(&models.Doc{FileName: "contract.pdf", Checksum: []byte("contract")}).Error)
+	outsider := restrictFolder(t, "docs")
+	create := func(body any) int {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/test", nil)
+		auth.SetPrincipal(c, auth.UserPrincipal(auth.MethodJWT, outsider))
+		testutils.MockJsonPost(c, body)
+		h.HandleCreateShareLink(c)
+		return w.Code
+	}
+
+	// Act & Assert
+	require.Equal(t, http.StatusForbidden, create(map[string]any{"filename": "contract.pdf"}))
+	require.Equal(t, http.StatusForbidden, create(map[string]any{"files": []map[string]string{{"filename": "logo.png"}, {"filename": "contract.pdf"}}}))
+	require.Equal(t, http.StatusCreated, create(map[string]any{"filename": "logo.png"}))
+	links, err := database.NewShareLinkRepo(database.DB).GetAllShareLinks(context.Background())
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+}
+
+func TestHandleShareLink_Watermark(t *testing.T) {
+	// Arrange
+	h := newTestShareHandler(t)
+	imagesDir := filepath.Join(util.ExPath, "uploads", "images")
+	require.NoError(t, os.MkdirAll(imagesDir, 0o755))
+	black := image.NewNRGBA(image.Rect(0, 0, 100, 100))
+	draw.Draw(black, black.Bounds(), image.NewUniform(color.Black), image.Point{}, draw.Src)
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, black))
+	require.NoError(t, os.WriteFile(filepath.Join(imagesDir, "cat.png"), buf.Bytes(), 0o644))
+	_, err := database.NewImageRepo(database.DB).AddImage(context.Background(), models.Image{FileName: "cat.png", Checksum: []byte("cat")})
+	require.NoError(t, err)
+
+	watermarks := watermark.New(database.NewConfigRepo(database.DB), database.NewImageRepo(database.DB))
+	white := image.NewNRGBA(image.Rect(0, 0, 20, 20))
+	draw.Draw(white, white.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	buf.Reset()
+	require.NoError(t, png.Encode(&buf, white))
+	require.NoError(t, watermarks.SetImage(&buf))
+	settings := models.DefaultWatermarkSettings()
+	settings.Enabled, settings.Always, settings.Opacity = true, true, 1
+	require.NoError(t, watermarks.Update(settings))
+	watermark.Default = watermarks
+	t.Cleanup(func() { watermark.Default = nil })
+
+	r := gin.New()
+	r.POST("/share", h.HandleCreateShareLink)
+	r.GET("/s/:token", h.HandleShareLink)
+	share := func(body string) string {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/share", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var created shareResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+		return "/s/" + created.Token
+	}
+	marked := func(body []byte) bool {
+		img, err := png.Decode(bytes.NewReader(body))
+		require.NoError(t, err)
+		red, _, _, _ := img.At(75, 75).RGBA()
+		return red > 0
+	}
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		return w
+	}
+
+	// Act & Assert: single files, bundle files and bundle archives are
+	// watermarked
+	require.True(t, marked(get(share(`{"filename": "cat.png"}`)+"?raw=1").Body.Bytes()))
+	bundle := share(`{"name": "cats", "files": [{"type": "image", "filename": "cat.png"}]}`)
+	require.True(t, marked(get(bundle+"?file=0&raw=1").Body.Bytes()))
+	archive := get(bundle + "?raw=1").Body.Bytes()
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	require.NoError(t, err)
+	require.Len(t, zr.File, 1)
+	f, err := zr.File[0].Open()
+	require.NoError(t, err)
+	defer f.Close()
+	content, err := io.ReadAll(f)
+	require.NoError(t, err)
+	require.True(t, marked(content))
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/audit"
+	"github.com/kevinanielsen/go-fast-cdn/src/cache"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"github.com/kevinanielsen/go-fast-cdn/src/usage"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"gorm.io/gorm"
+)
+
+type takedownRequest struct {
+	Status     int    `json:"status" binding:"omitempty,oneof=410 451"`
+	ReasonCode string `json:"reason_code" binding:"required"`
+	Reason     string `json:"reason"`
+	BlockedBy  string `json:"blocked_by"`
+}
+
+// HandleListTakedowns returns all active takedowns
+func (h *TakedownHandler) HandleListTakedowns(c *gin.Context) {
+	takedowns, err := h.takedownRepo.GetAllTakedowns(c.Request.Context())
+	if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to fetch takedowns")
+		return
+	}
+	c.JSON(http.StatusOK, takedowns)
+}
+
+// HandleTakedown deletes a file and leaves a tombstone in its place. Requests
+// for the file are answered with the takedown's status (451 by default) and
+// reason code.
+func (h *TakedownHandler) HandleTakedown(c *gin.Context) {
+	fileName := c.Param("filename")
+
+	var req takedownRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Invalid(c, err)
+		return
+	}
+	if req.Status == 0 {
+		req.Status = http.StatusUnavailableForLegalReasons
+	}
+
+	ctx := c.Request.Context()
+	media, err := h.media.resolveMedia(ctx, fileName, c.Query("type"))
+	if err != nil {
+		abortLookup(c, err, "Media not found")
+		return
+	}
+	mediaType := media.Type
+
+	takedown := &models.Takedown{
+		MediaType:  mediaType,
+		FileName:   fileName,
+		Status:     req.Status,
+		ReasonCode: req.ReasonCode,
+		Reason:     req.Reason,
+		BlockedBy:  req.BlockedBy,
+		CreatedBy:  c.GetUint("user_id"),
+	}
+	if err := h.takedownRepo.AddTakedown(ctx, takedown); err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to record takedown")
+		return
+	}
+
+	if mediaType == models.MediaTypeImage {
+		_, err = h.media.imageRepo.DeleteImage(ctx, fileName)
+	} else {
+		_, err = h.media.docRepo.DeleteDoc(ctx, fileName)
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		problem.Write(c, http.StatusInternalServerError, "Failed to delete media record")
+		return
+	}
+	cache.Invalidate(mediaType, fileName)
+	err = usage.Track(mediaType, media.OrganizationID, fileName, func() error {
+		return util.DeleteFile(fileName, models.MediaFolder(mediaType))
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		problem.Write(c, http.StatusInternalServerError, "Failed to delete file")
+		return
+	}
+
+	audit.Record(c, audit.ActionTakedown, mediaType+"/"+fileName, gin.H{
+		"status":      takedown.Status,
+		"reason_code": takedown.ReasonCode,
+		"reason":      takedown.Reason,
+	})
+
+	c.JSON(http.StatusCreated, takedown)
+}
+
+// HandleLiftTakedown removes a tombstone. The file itself is not restored, so
+// requests for it will return 404 until it is uploaded again.
+func (h *TakedownHandler) HandleLiftTakedown(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		problem.Write(c, http.StatusBadRequest, "Invalid takedown ID")
+		return
+	}
+
+	takedown, err := h.takedownRepo.DeleteTakedown(c.Request.Context(), uint(id))
+	if err != nil {
+		problem.NotFound(c, "Takedown not found")
+		return
+	}
+
+	audit.Record(c, audit.ActionTakedownLifted, takedown.MediaType+"/"+takedown.FileName, gin.H{
+		"takedown_id": takedown.ID,
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Takedown lifted"})
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/audit"
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/middleware"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	testutils "github.com/kevinanielsen/go-fast-cdn/src/testUtils"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestHandleTakedown_ServesTombstone(t *testing.T) {
+	// Arrange
+	h := newTestTakedownHandler(t)
+	imagesDir := filepath.Join(util.ExPath, "uploads", "images")
+	require.NoError(t, os.MkdirAll(imagesDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(imagesDir, "leak.png"), []byte("png"), 0o644))
+	_, err := database.NewImageRepo(database.DB).AddImage(context.Background(), models.Image{FileName: "leak.png", Checksum: []byte("leak")})
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/test", nil)
+	c.Params = []gin.Param{{Key: "filename", Value: "leak.png"}}
+	testutils.MockJsonPost(c, map[string]any{"reason_code": "DMCA-42", "reason": "Copyright claim", "blocked_by": "https://example.com"})
+
+	// Act
+	h.HandleTakedown(c)
+
+	// Assert
+	require.Equal(t, http.StatusCreated, w.Result().StatusCode)
+	require.NoFileExists(t, filepath.Join(imagesDir, "leak.png"))
+	_, err = database.NewImageRepo(database.DB).GetImageByFileName(context.Background(), "leak.png")
+	require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	// Act
+	r := gin.New()
+	r.Group("/download/images", middleware.Tombstone(h.takedownRepo, models.MediaTypeImage)).Static("/", imagesDir)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/download/images/leak.png", nil))
+
+	// Assert
+	require.Equal(t, http.StatusUnavailableForLegalReasons, w.Code)
+	require.Equal(t, `<https://example.com>; rel="blocked-by"`, w.Header().Get("Link"))
+	body := map[string]any{}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&body))
+	require.Equal(t, "DMCA-42", body["reason_code"])
+}
+
+func TestHandleTakedown_Gone(t *testing.T) {
+	// Arrange
+	h := newTestTakedownHandler(t)
+	_, err := database.NewDocRepo(database.DB).AddDoc(context.Background(), models.Doc{FileName: "spam.pdf", Checksum: []byte("spam")})
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/test", nil)
+	c.Params = []gin.Param{{Key: "filename", Value: "spam.pdf"}}
+	testutils.MockJsonPost(c, map[string]any{"status": 410, "reason_code": "TOS-SPAM"})
+
+	// Act
+	h.HandleTakedown(c)
+
+	// Assert
+	require.Equal(t, http.StatusCreated, w.Result().StatusCode)
+	takedown, err := h.takedownRepo.GetTakedown(context.Background(), models.MediaTypeDoc, "spam.pdf")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusGone, takedown.Status)
+	entries, err := database.NewAuditLogRepo(database.DB).GetAuditLogs(context.Background(), "", 10)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, audit.ActionTakedown, entries[0].Action)
+	require.Equal(t, "doc/spam.pdf", entries[0].Target)
+}
+
+func newTestTakedownHandler(t *testing.T) *TakedownHandler {
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	audit.Init(database.NewAuditLogRepo(database.DB))
+
+	return NewTakedownHandler(
+		database.NewImageRepo(database.DB),
+		database.NewDocRepo(database.DB),
+		database.NewTakedownRepo(database.DB),
+	)
+}
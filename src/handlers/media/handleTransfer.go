@@ -0,0 +1,343 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/acl"
+	"github.com/kevinanielsen/go-fast-cdn/src/audit"
+	"github.com/kevinanielsen/go-fast-cdn/src/auth"
+	"github.com/kevinanielsen/go-fast-cdn/src/cache"
+	"github.com/kevinanielsen/go-fast-cdn/src/middleware"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"github.com/kevinanielsen/go-fast-cdn/src/search"
+	"github.com/kevinanielsen/go-fast-cdn/src/usage"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/kevinanielsen/go-fast-cdn/src/validations"
+	"gorm.io/gorm"
+)
+
+// errChecksumMismatch is returned when a copied file does not match the
+// checksum recorded for its source.
+var errChecksumMismatch = errors.New("copy does not match the checksum of the media")
+
+// transferRequest selects where media is moved or copied to. Fields left out
+// keep the folder, name and organization of the media.
+type transferRequest struct {
+	Folder   string `json:"folder" binding:"omitempty,oneof=images docs"`
+	FileName string `json:"filename" binding:"omitempty,filename"`
+	// OrganizationID hands the media to another organization, or to none for
+	// 0. Only admins may change the organization.
+	OrganizationID *uint `json:"organization_id"`
+}
+
+// HandleMoveMedia moves a media to another folder, name or organization,
+// e.g. {"folder": "docs", "filename": "report.pdf"}. The file and the record
+// are moved together, so a failure leaves both where they were. The media
+// is given by its UUID, or by its file name with an optional ?type=.
+func (h *TransferHandler) HandleMoveMedia(c *gin.Context) {
+	h.transfer(c, false)
+}
+
+// HandleCopyMedia copies a media to another folder, name or organization,
+// taking the same body as HandleMoveMedia. The copy is a new media, and is
+// discarded unless its content matches the checksum of the original.
+func (h *TransferHandler) HandleCopyMedia(c *gin.Context) {
+	h.transfer(c, true)
+}
+
+func (h *TransferHandler) transfer(c *gin.Context, duplicate bool) {
+	var body transferRequest
+	if err := c.ShouldBindJSON(&body); err != nil && !errors.Is(err, io.EOF) {
+		problem.Invalid(c, err)
+		return
+	}
+
+	ctx := c.Request.Context()
+	id := c.Param("filename")
+	media, err := h.media.resolveMediaByUUID(ctx, id)
+	if err != nil {
+		media, err = h.media.resolveMedia(ctx, id, c.Query("type"))
+	}
+	if err != nil {
+		abortLookup(c, err, "Media not found")
+		return
+	}
+	if !auth.InScope(c, media.OrganizationID) {
+		problem.Write(c, http.StatusForbidden, "Media belongs to another organization")
+		return
+	}
+
+	transfer := models.MediaTransfer{
+		SourceType: media.Type, SourceFileName: media.FileName,
+		TargetType: media.Type, TargetFileName: media.FileName,
+		OrganizationID: media.OrganizationID, Copy: duplicate,
+	}
+	if body.Folder != "" {
+		transfer.TargetType = models.MediaTypeFor(body.Folder)
+	}
+	// Moves take the media out of its folder, copies only read it
+	sourceAccess := models.AccessWrite
+	if duplicate {
+		sourceAccess = models.AccessRead
+	}
+	if !acl.Check(c, models.MediaFolder(media.Type), sourceAccess) {
+		return
+	}
+	if !acl.Check(c, models.MediaFolder(transfer.TargetType), models.AccessWrite) {
+		return
+	}
+	if body.FileName != "" {
+		transfer.TargetFileName, err = util.FilterFilename(body.FileName)
+		if err != nil {
+			problem.Write(c, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if body.OrganizationID != nil {
+		var orgID *uint
+		if *body.OrganizationID != 0 {
+			orgID = body.OrganizationID
+		}
+		if !sameOrganization(orgID, media.OrganizationID) {
+			if c.GetString("user_role") != "admin" {
+				problem.Write(c, http.StatusForbidden, "Only admins may hand media to another organization")
+				return
+			}
+			if orgID != nil {
+				if _, err := h.orgRepo.GetOrganizationByID(ctx, *orgID); err != nil {
+					problem.Lookup(c, err, "Organization not found", "Failed to look up organization")
+					return
+				}
+			}
+		}
+		transfer.OrganizationID = orgID
+	}
+
+	sameFile := transfer.TargetType == media.Type && transfer.TargetFileName == media.FileName
+	if sameFile && (duplicate || sameOrganization(transfer.OrganizationID, media.OrganizationID)) {
+		problem.InvalidFields(c, problem.FieldError{Field: "filename", Rule: "nefield", Message: "must differ from the name of the media, or the folder or organization must change"})
+		return
+	}
+
+	srcPath := mediaPath(media.Type, media.FileName)
+	dstPath := mediaPath(transfer.TargetType, transfer.TargetFileName)
+	if !sameFile {
+		taken, err := h.media.nameTaken(ctx, transfer.TargetType, transfer.TargetFileName)
+		if err != nil {
+			problem.Write(c, http.StatusInternalServerError, "Failed to look up media")
+			return
+		}
+		if taken {
+			problem.Abort(c, problem.New(http.StatusConflict, problem.CodeMediaNameTaken, "File name already taken"))
+			return
+		}
+	}
+	if transfer.TargetType != media.Type {
+		if err := validateFolderContent(transfer.TargetType, transfer.TargetFileName, srcPath); errors.Is(err, fs.ErrNotExist) {
+			problem.NotFound(c, "Media file not found")
+			return
+		} else if err != nil {
+			problem.Abort(c, problem.New(http.StatusBadRequest, problem.CodeMediaInvalidType, err.Error()))
+			return
+		}
+	}
+	if !duplicate {
+		if middleware.AbortIfStale(c, media.Version) {
+			return
+		}
+		ctx = middleware.Unchanged(c, media.UpdatedAt)
+	}
+
+	transferred := false
+	uuid, err := h.transferRepo.TransferMedia(ctx, transfer, func() error {
+		var err error
+		if duplicate {
+			err = copyMediaFile(srcPath, dstPath)
+		} else {
+			err = os.Rename(srcPath, dstPath)
+		}
+		if err != nil {
+			return err
+		}
+		transferred = true
+		if duplicate {
+			return verifyChecksum(dstPath, media)
+		}
+		return nil
+	})
+	if err != nil {
+		if transferred {
+			undoTransfer(srcPath, dstPath, duplicate)
+		}
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			problem.NotFound(c, "Media file not found")
+		case errors.Is(err, errChecksumMismatch):
+			problem.WriteDetails(c, http.StatusInternalServerError, "Failed to copy media", err.Error())
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			problem.NotFound(c, "Media not found")
+		case errors.Is(err, models.ErrStale):
+			middleware.AbortStale(c)
+		default:
+			log.Printf("Failed to transfer %s/%s: %s\n", media.Type, media.FileName, err.Error())
+			problem.Write(c, http.StatusInternalServerError, "Failed to transfer media")
+		}
+		return
+	}
+
+	h.afterTransfer(c, media, transfer, dstPath)
+
+	action, status := audit.ActionMediaMoved, http.StatusOK
+	if duplicate {
+		action, status = audit.ActionMediaCopied, http.StatusCreated
+	}
+	audit.Record(c, action, media.Type+"/"+media.FileName, gin.H{
+		"target":               transfer.TargetType + "/" + transfer.TargetFileName,
+		"organization_id":      transfer.OrganizationID,
+		"from_organization_id": media.OrganizationID,
+	})
+
+	c.JSON(status, gin.H{
+		"type":            transfer.TargetType,
+		"uuid":            uuid,
+		"file_name":       transfer.TargetFileName,
+		"organization_id": transfer.OrganizationID,
+		"url":             c.Request.Host + "/api/cdn/download/" + models.MediaFolder(transfer.TargetType) + "/" + transfer.TargetFileName,
+	})
+}
+
+// nameTaken reports whether a media of mediaType is named fileName, or a
+// file without a record is in the way.
+func (h *MediaHandler) nameTaken(ctx context.Context, mediaType, fileName string) (bool, error) {
+	_, err := h.resolveMedia(ctx, fileName, mediaType)
+	if err == nil {
+		return true, nil
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, err
+	}
+	_, err = os.Lstat(mediaPath(mediaType, fileName))
+	return err == nil, nil
+}
+
+// afterTransfer updates the caches, usage and search index derived from the
+// transferred files.
+func (h *TransferHandler) afterTransfer(c *gin.Context, media mediaRecord, transfer models.MediaTransfer, dstPath string) {
+	ctx := c.Request.Context()
+	var size int64
+	if info, err := os.Stat(dstPath); err == nil {
+		size = info.Size()
+	}
+	usage.Add(transfer.TargetType, transfer.OrganizationID, size)
+	cache.Invalidate(transfer.TargetType, transfer.TargetFileName)
+
+	if !transfer.Copy {
+		usage.Add(media.Type, media.OrganizationID, -size)
+		cache.Invalidate(media.Type, media.FileName)
+		if media.Type == models.MediaTypeDoc {
+			var err error
+			if transfer.TargetType == models.MediaTypeDoc {
+				err = h.searchRepo.Rename(ctx, media.Type, media.FileName, transfer.TargetFileName)
+			} else {
+				err = h.searchRepo.Remove(ctx, media.Type, media.FileName)
+			}
+			if err != nil {
+				log.Printf("Failed to update search index for %s: %s\n", media.FileName, err.Error())
+			}
+			return
+		}
+	}
+	if transfer.TargetType == models.MediaTypeDoc {
+		search.EnqueueIndexDoc(ctx, h.searchRepo, transfer.TargetFileName)
+	}
+}
+
+func mediaPath(mediaType, fileName string) string {
+	return filepath.Join(util.ExPath, "uploads", models.MediaFolder(mediaType), fileName)
+}
+
+// validateFolderContent checks that the file at path may be stored in the
+// folder of mediaType, as uploads to it are.
+func validateFolderContent(mediaType, fileName, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	header := make([]byte, 512)
+	n, err := io.ReadFull(f, header)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return err
+	}
+	return validations.ValidateContentType(mediaType, fileName, header[:n])
+}
+
+// copyMediaFile copies the file at src to dst, which must not exist yet.
+func copyMediaFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
+
+// verifyChecksum reads the copy at path back and compares its checksum to
+// the one recorded for the media, so a corrupted original or a failed write
+// is not copied over.
+func verifyChecksum(path string, media mediaRecord) error {
+	if len(media.Checksum) == 0 {
+		return nil
+	}
+	algorithm := media.ChecksumAlgorithm
+	if algorithm == "" {
+		algorithm = models.ChecksumMD5
+	}
+	checksum, err := util.FileChecksum(algorithm, path)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(checksum, media.Checksum) {
+		return fmt.Errorf("%w (%s)", errChecksumMismatch, algorithm)
+	}
+	return nil
+}
+
+// undoTransfer removes a copied file, or moves a moved file back, after the
+// records could not be updated.
+func undoTransfer(srcPath, dstPath string, duplicate bool) {
+	var err error
+	if duplicate {
+		err = os.Remove(dstPath)
+	} else {
+		err = os.Rename(dstPath, srcPath)
+	}
+	if err != nil {
+		log.Printf("Failed to undo transfer of %s: %s\n", srcPath, err.Error())
+	}
+}
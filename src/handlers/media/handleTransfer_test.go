@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	testutils "github.com/kevinanielsen/go-fast-cdn/src/testUtils"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/kevinanielsen/go-fast-cdn/src/validations"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleTransferMedia(t *testing.T) {
+	// Arrange
+	media := newTestMediaHandler(t)
+	ctx := context.Background()
+	h := NewTransferHandler(media.imageRepo, media.docRepo, database.NewMediaTransferRepo(database.DB),
+		database.NewOrganizationRepo(database.DB), database.NewSearchRepo(database.DB))
+	org := models.Organization{Name: "Acme"}
+	require.NoError(t, database.NewOrganizationRepo(database.DB).CreateOrganization(ctx, &org))
+
+	store := func(mediaType, fileName string, content []byte) string {
+		path := mediaPath(mediaType, fileName)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, content, 0o644))
+		checksum, err := util.Checksum(models.ChecksumMD5, bytes.NewReader(content))
+		require.NoError(t, err)
+		if mediaType == models.MediaTypeImage {
+			_, err = media.imageRepo.AddImage(ctx, models.Image{FileName: fileName, Checksum: checksum, ChecksumAlgorithm: models.ChecksumMD5})
+		} else {
+			_, err = media.docRepo.AddDoc(ctx, models.Doc{FileName: fileName, Checksum: checksum, ChecksumAlgorithm: models.ChecksumMD5})
+		}
+		require.NoError(t, err)
+		return path
+	}
+	png := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{1}, 64)...)
+	store(models.MediaTypeImage, "photo.png", png)
+	store(models.MediaTypeDoc, "scene.glb", []byte("glTF\x02\x00\x00\x00binary model"))
+
+	call := func(handler gin.HandlerFunc, role, id string, body any) (int, map[string]any) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/test", nil)
+		c.Params = []gin.Param{{Key: "filename", Value: id}}
+		c.Set("user_role", role)
+		testutils.MockJsonPost(c, body)
+		handler(c)
+		resp := map[string]any{}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp
+	}
+
+	// Act & Assert
+	original, err := media.imageRepo.GetImageByFileName(ctx, "photo.png")
+	require.NoError(t, err)
+	code, moved := call(h.HandleMoveMedia, "user", "photo.png", map[string]any{"filename": "cover.png"})
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, original.UUID, moved["uuid"], "moves keep the UUID")
+	require.NoFileExists(t, mediaPath(models.MediaTypeImage, "photo.png"))
+	require.FileExists(t, mediaPath(models.MediaTypeImage, "cover.png"))
+	_, err = media.imageRepo.GetImageByFileName(ctx, "cover.png")
+	require.NoError(t, err)
+
+	code, _ = call(h.HandleMoveMedia, "user", "cover.png", map[string]any{})
+	require.Equal(t, http.StatusBadRequest, code, "nothing to move")
+	code, _ = call(h.HandleMoveMedia, "user", "cover.png", map[string]any{"folder": "docs"})
+	require.Equal(t, http.StatusBadRequest, code, "images are not accepted as documents")
+	require.FileExists(t, mediaPath(models.MediaTypeImage, "cover.png"))
+
+	code, _ = call(h.HandleCopyMedia, "user", "cover.png", map[string]any{"organization_id": org.ID})
+	require.Equal(t, http.StatusForbidden, code, "only admins change organizations")
+	code, _ = call(h.HandleCopyMedia, "admin", "cover.png", map[string]any{"organization_id": org.ID + 1})
+	require.Equal(t, http.StatusNotFound, code)
+	code, _ = call(h.HandleCopyMedia, "admin", "cover.png", map[string]any{"organization_id": org.ID})
+	require.Equal(t, http.StatusBadRequest, code, "copies need another name in the same folder")
+
+	code, copied := call(h.HandleCopyMedia, "admin", original.UUID, map[string]any{"filename": "acme.png", "organization_id": org.ID})
+	require.Equal(t, http.StatusCreated, code)
+	require.NotEqual(t, original.UUID, copied["uuid"])
+	require.Equal(t, float64(org.ID), copied["organization_id"])
+	acme, err := media.imageRepo.GetImageByFileName(ctx, "acme.png")
+	require.NoError(t, err)
+	require.Equal(t, org.ID, *acme.OrganizationID)
+	require.Equal(t, original.Checksum, acme.Checksum)
+	content, err := os.ReadFile(mediaPath(models.MediaTypeImage, "acme.png"))
+	require.NoError(t, err)
+	require.Equal(t, png, content)
+	code, _ = call(h.HandleCopyMedia, "user", "cover.png", map[string]any{"filename": "acme.png"})
+	require.Equal(t, http.StatusConflict, code)
+
+	// A corrupted original is not copied
+	require.NoError(t, os.WriteFile(mediaPath(models.MediaTypeImage, "cover.png"), append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{2}, 64)...), 0o644))
+	code, _ = call(h.HandleCopyMedia, "user", "cover.png", map[string]any{"filename": "backup.png"})
+	require.Equal(t, http.StatusInternalServerError, code)
+	require.NoFileExists(t, mediaPath(models.MediaTypeImage, "backup.png"))
+	_, err = media.imageRepo.GetImageByFileName(ctx, "backup.png")
+	require.Error(t, err)
+
+	// Documents move to the images once their extension is registered there
+	code, _ = call(h.HandleMoveMedia, "user", "scene.glb", map[string]any{"folder": "images"})
+	require.Equal(t, http.StatusBadRequest, code)
+	rules := database.NewMimeTypeRuleRepo(database.DB)
+	require.NoError(t, rules.SaveMimeTypeRule(ctx, &models.MimeTypeRule{Extension: ".glb", MimeType: "model/gltf-binary", MediaType: models.MediaTypeImage}))
+	require.NoError(t, validations.LoadMimeTypeRules(context.Background(), rules))
+	t.Cleanup(func() {
+		rules.DeleteMimeTypeRule(ctx, ".glb")
+		validations.LoadMimeTypeRules(context.Background(), rules)
+	})
+	doc, err := media.docRepo.GetDocByFileName(ctx, "scene.glb")
+	require.NoError(t, err)
+	code, moved = call(h.HandleMoveMedia, "user", "scene.glb", map[string]any{"folder": "images"})
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, models.MediaTypeImage, moved["type"])
+	require.Equal(t, doc.UUID, moved["uuid"])
+	require.FileExists(t, mediaPath(models.MediaTypeImage, "scene.glb"))
+	require.NoFileExists(t, mediaPath(models.MediaTypeDoc, "scene.glb"))
+	_, err = media.docRepo.GetDocByFileName(ctx, "scene.glb")
+	require.Error(t, err)
+	image, err := media.imageRepo.GetImageByUUID(ctx, doc.UUID)
+	require.NoError(t, err)
+	require.Equal(t, "scene.glb", image.FileName)
+}
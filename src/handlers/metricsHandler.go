@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/breaker"
+	"github.com/kevinanielsen/go-fast-cdn/src/diskspace"
+	"github.com/kevinanielsen/go-fast-cdn/src/janitor"
+	"github.com/kevinanielsen/go-fast-cdn/src/metrics"
+)
+
+type MetricsHandler struct {
+	delivery *metrics.Delivery
+}
+
+func NewMetricsHandler(delivery *metrics.Delivery) *MetricsHandler {
+	return &MetricsHandler{delivery: delivery}
+}
+
+// GetMetrics returns the sampled delivery latencies per file size bucket,
+// the durations of database queries, the space of the uploads volume, the
+// space reclaimed by the janitor and the circuit breakers of external
+// services
+func (h *MetricsHandler) GetMetrics(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"delivery": h.delivery.Stats(),
+		"database": metrics.DefaultQueries.Stats(),
+		"disk":     diskspace.Default.Usage(),
+		"janitor":  janitor.Default.Stats(),
+		"breakers": breaker.All(),
+	})
+}
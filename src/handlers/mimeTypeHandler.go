@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/audit"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"github.com/kevinanielsen/go-fast-cdn/src/validations"
+	"gorm.io/gorm"
+)
+
+// MimeTypeHandler manages the extensions accepted for uploads in addition
+// to the built-in ones.
+type MimeTypeHandler struct {
+	mimeTypeRepo models.MimeTypeRuleRepository
+}
+
+func NewMimeTypeHandler(mimeTypeRepo models.MimeTypeRuleRepository) *MimeTypeHandler {
+	return &MimeTypeHandler{mimeTypeRepo: mimeTypeRepo}
+}
+
+type mimeTypeRequest struct {
+	MimeType  string `json:"mime_type" binding:"required"`
+	MediaType string `json:"media_type" binding:"required,oneof=image doc"`
+	Sanitize  bool   `json:"sanitize"`
+}
+
+// ListMimeTypes returns the registered extensions
+func (h *MimeTypeHandler) ListMimeTypes(c *gin.Context) {
+	rules, err := h.mimeTypeRepo.GetAllMimeTypeRules(c.Request.Context())
+	if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to fetch MIME types")
+		return
+	}
+	c.JSON(http.StatusOK, rules)
+}
+
+// UpdateMimeType registers an extension, or replaces its rule. It applies
+// to the next upload and download without a restart.
+func (h *MimeTypeHandler) UpdateMimeType(c *gin.Context) {
+	extension, ok := normalizeExtension(c.Param("extension"))
+	if !ok {
+		problem.Write(c, http.StatusBadRequest, "Invalid extension")
+		return
+	}
+	var req mimeTypeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Invalid(c, err)
+		return
+	}
+	mimeType, params, err := mime.ParseMediaType(req.MimeType)
+	if err != nil || len(params) > 0 || !strings.Contains(mimeType, "/") {
+		problem.InvalidFields(c, problem.FieldError{Field: "mime_type", Rule: "mime", Message: "must be a MIME type without parameters, e.g. model/gltf-binary"})
+		return
+	}
+	if req.Sanitize && !validations.CanSanitize(mimeType) {
+		problem.InvalidFields(c, problem.FieldError{Field: "sanitize", Rule: "sanitizable", Message: "only image/svg+xml files can be sanitized"})
+		return
+	}
+
+	rule, err := h.mimeTypeRepo.GetMimeTypeRule(c.Request.Context(), extension)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		rule = &models.MimeTypeRule{Extension: extension}
+	} else if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to fetch MIME type")
+		return
+	}
+	rule.MimeType = mimeType
+	rule.MediaType = req.MediaType
+	rule.Sanitize = req.Sanitize
+	if err := h.mimeTypeRepo.SaveMimeTypeRule(c.Request.Context(), rule); err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to save MIME type")
+		return
+	}
+	if err := validations.LoadMimeTypeRules(c.Request.Context(), h.mimeTypeRepo); err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to reload MIME types")
+		return
+	}
+
+	audit.Record(c, audit.ActionMimeTypesUpdated, "mime_types", rule)
+	c.JSON(http.StatusOK, rule)
+}
+
+// DeleteMimeType unregisters an extension
+func (h *MimeTypeHandler) DeleteMimeType(c *gin.Context) {
+	extension, ok := normalizeExtension(c.Param("extension"))
+	if !ok {
+		problem.Write(c, http.StatusBadRequest, "Invalid extension")
+		return
+	}
+	err := h.mimeTypeRepo.DeleteMimeTypeRule(c.Request.Context(), extension)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		problem.NotFound(c, "MIME type not found")
+		return
+	} else if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to delete MIME type")
+		return
+	}
+	if err := validations.LoadMimeTypeRules(c.Request.Context(), h.mimeTypeRepo); err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to reload MIME types")
+		return
+	}
+
+	audit.Record(c, audit.ActionMimeTypesUpdated, "mime_types", gin.H{"extension": extension, "deleted": true})
+	c.JSON(http.StatusOK, gin.H{"message": "MIME type deleted"})
+}
+
+// normalizeExtension returns extension lower-cased with a leading dot, and
+// whether it consists of letters, digits, dashes and underscores only.
+func normalizeExtension(extension string) (string, bool) {
+	extension = strings.ToLower(strings.TrimPrefix(extension, "."))
+	if extension == "" || len(extension) > 32 {
+		return "", false
+	}
+	for _, r := range extension {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return "", false
+		}
+	}
+	return "." + extension, true
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/kevinanielsen/go-fast-cdn/src/validations"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMimeTypeHandler(t *testing.T) {
+	// Arrange
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	repo := database.NewMimeTypeRuleRepo(database.DB)
+	h := NewMimeTypeHandler(repo)
+	t.Cleanup(func() {
+		repo.DeleteMimeTypeRule(context.Background(), ".glb")
+		validations.LoadMimeTypeRules(context.Background(), repo)
+	})
+
+	r := gin.New()
+	r.PUT("/mime-types/:extension", h.UpdateMimeType)
+	r.DELETE("/mime-types/:extension", h.DeleteMimeType)
+	request := func(method, path, body string) int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w.Code
+	}
+	glb := append([]byte("glTF\x02\x00\x00\x00"), make([]byte, 32)...)
+	require.Error(t, validations.ValidateContentType(models.MediaTypeDoc, "scene.glb", glb))
+
+	// Act & Assert
+	require.Equal(t, http.StatusOK, request(http.MethodPut, "/mime-types/GLB", `{"mime_type": "model/gltf-binary", "media_type": "doc"}`))
+	require.NoError(t, validations.ValidateContentType(models.MediaTypeDoc, "scene.glb", glb))
+	require.Error(t, validations.ValidateContentType(models.MediaTypeImage, "scene.glb", glb))
+	require.Equal(t, "model/gltf-binary", validations.DetectMimeType("scene.glb", glb))
+	// Content the sniffer recognizes must still match the registered type
+	require.Error(t, validations.ValidateContentType(models.MediaTypeDoc, "scene.glb", []byte("<html><script>alert(1)</script></html>")))
+
+	require.Equal(t, http.StatusBadRequest, request(http.MethodPut, "/mime-types/glb", `{"mime_type": "model/gltf-binary", "media_type": "doc", "sanitize": true}`))
+	require.Equal(t, http.StatusBadRequest, request(http.MethodPut, "/mime-types/glb", `{"mime_type": "gltf", "media_type": "doc"}`))
+	require.Equal(t, http.StatusBadRequest, request(http.MethodPut, "/mime-types/g.lb", `{"mime_type": "model/gltf-binary", "media_type": "doc"}`))
+
+	require.Equal(t, http.StatusOK, request(http.MethodDelete, "/mime-types/glb", ""))
+	require.Error(t, validations.ValidateContentType(models.MediaTypeDoc, "scene.glb", glb))
+	require.Equal(t, http.StatusNotFound, request(http.MethodDelete, "/mime-types/glb", ""))
+}
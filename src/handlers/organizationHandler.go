@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/branding"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"gorm.io/gorm"
+)
+
+type OrganizationHandler struct {
+	orgRepo  models.OrganizationRepository
+	branding *branding.Store
+}
+
+func NewOrganizationHandler(orgRepo models.OrganizationRepository, branding *branding.Store) *OrganizationHandler {
+	return &OrganizationHandler{orgRepo: orgRepo, branding: branding}
+}
+
+// ListOrganizations returns all organizations
+func (h *OrganizationHandler) ListOrganizations(c *gin.Context) {
+	orgs, err := h.orgRepo.GetAllOrganizations(c.Request.Context())
+	if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to fetch organizations")
+		return
+	}
+	c.JSON(http.StatusOK, orgs)
+}
+
+// CreateOrganization adds a new organization
+func (h *OrganizationHandler) CreateOrganization(c *gin.Context) {
+	var req struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Invalid(c, err)
+		return
+	}
+	org := &models.Organization{Name: req.Name}
+	if err := h.orgRepo.CreateOrganization(c.Request.Context(), org); err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to create organization")
+		return
+	}
+	c.JSON(http.StatusCreated, org)
+}
+
+// DeleteOrganization removes an organization
+func (h *OrganizationHandler) DeleteOrganization(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		problem.Write(c, http.StatusBadRequest, "Invalid organization ID")
+		return
+	}
+	err = h.orgRepo.DeleteOrganization(c.Request.Context(), uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		problem.NotFound(c, "Organization not found")
+		return
+	} else if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to delete organization")
+		return
+	}
+	// IDs can be reused, so the branding must not outlive the organization
+	if err := h.branding.Delete(uint(id)); err != nil {
+		log.Printf("Failed to delete branding of organization %d: %s", id, err.Error())
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Organization deleted successfully"})
+}
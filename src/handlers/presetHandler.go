@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"gorm.io/gorm"
+)
+
+type PresetHandler struct {
+	presetRepo    models.UploadPresetRepository
+	transformRepo models.TransformPresetRepository
+}
+
+func NewPresetHandler(presetRepo models.UploadPresetRepository, transformRepo models.TransformPresetRepository) *PresetHandler {
+	return &PresetHandler{presetRepo: presetRepo, transformRepo: transformRepo}
+}
+
+type presetRequest struct {
+	Name            string `json:"name" binding:"required"`
+	Description     string `json:"description"`
+	MediaType       string `json:"media_type" binding:"omitempty,oneof=image doc"`
+	Width           int    `json:"width" binding:"min=0"`
+	Height          int    `json:"height" binding:"min=0"`
+	ExpiresIn       int    `json:"expires_in" binding:"min=0"`
+	TransformPreset string `json:"transform_preset"`
+}
+
+// bind reads the preset of the request, writing a problem unless it is
+// valid
+func (h *PresetHandler) bind(c *gin.Context) (*presetRequest, bool) {
+	var req presetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Invalid(c, err)
+		return nil, false
+	}
+	if req.TransformPreset == "" {
+		return &req, true
+	}
+	field := problem.FieldError{Field: "transform_preset"}
+	if req.MediaType == models.MediaTypeDoc {
+		field.Rule, field.Message = "media_type", "cannot be used for documents"
+	} else if req.Width != 0 || req.Height != 0 {
+		field.Rule, field.Message = "excluded_with", "cannot be combined with width and height"
+	} else if _, err := h.transformRepo.GetTransformPresetByName(c.Request.Context(), req.TransformPreset); errors.Is(err, gorm.ErrRecordNotFound) {
+		field.Rule, field.Message = "exists", "must name an existing transform preset"
+	} else if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to fetch transform preset")
+		return nil, false
+	} else {
+		return &req, true
+	}
+	problem.InvalidFields(c, field)
+	return nil, false
+}
+
+// ListPresets returns all upload presets
+func (h *PresetHandler) ListPresets(c *gin.Context) {
+	presets, err := h.presetRepo.GetAllPresets(c.Request.Context())
+	if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to fetch presets")
+		return
+	}
+	c.JSON(http.StatusOK, presets)
+}
+
+// CreatePreset adds a new upload preset
+func (h *PresetHandler) CreatePreset(c *gin.Context) {
+	req, ok := h.bind(c)
+	if !ok {
+		return
+	}
+	if existing, _ := h.presetRepo.GetPresetByName(c.Request.Context(), req.Name); existing != nil {
+		problem.Write(c, http.StatusConflict, "Preset already exists")
+		return
+	}
+	preset := &models.UploadPreset{
+		Name:            req.Name,
+		Description:     req.Description,
+		MediaType:       req.MediaType,
+		Width:           req.Width,
+		Height:          req.Height,
+		ExpiresIn:       req.ExpiresIn,
+		TransformPreset: req.TransformPreset,
+	}
+	if err := h.presetRepo.CreatePreset(c.Request.Context(), preset); err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to create preset")
+		return
+	}
+	c.JSON(http.StatusCreated, preset)
+}
+
+// UpdatePreset replaces the settings of an existing upload preset
+func (h *PresetHandler) UpdatePreset(c *gin.Context) {
+	preset, err := h.presetRepo.GetPresetByName(c.Request.Context(), c.Param("name"))
+	if err != nil {
+		problem.NotFound(c, "Preset not found")
+		return
+	}
+	req, ok := h.bind(c)
+	if !ok {
+		return
+	}
+	preset.Name = req.Name
+	preset.Description = req.Description
+	preset.MediaType = req.MediaType
+	preset.Width = req.Width
+	preset.Height = req.Height
+	preset.ExpiresIn = req.ExpiresIn
+	preset.TransformPreset = req.TransformPreset
+	if err := h.presetRepo.UpdatePreset(c.Request.Context(), preset); err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to update preset")
+		return
+	}
+	c.JSON(http.StatusOK, preset)
+}
+
+// DeletePreset removes an upload preset
+func (h *PresetHandler) DeletePreset(c *gin.Context) {
+	err := h.presetRepo.DeletePreset(c.Request.Context(), c.Param("name"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		problem.NotFound(c, "Preset not found")
+		return
+	} else if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to delete preset")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Preset deleted"})
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPresetHandler(t *testing.T) {
+	// Arrange
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	presets := database.NewPresetRepo(database.DB)
+	transforms := database.NewTransformPresetRepo(database.DB)
+	require.NoError(t, transforms.CreateTransformPreset(context.Background(), &models.TransformPreset{Name: "square", Width: 64, Height: 64, Fit: "cover"}))
+	h := NewPresetHandler(presets, transforms)
+
+	r := gin.New()
+	r.GET("/presets", h.ListPresets)
+	r.POST("/presets", h.CreatePreset)
+	r.PUT("/presets/:name", h.UpdatePreset)
+	r.DELETE("/presets/:name", h.DeletePreset)
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+	rule := func(w *httptest.ResponseRecorder) string {
+		var body struct {
+			Errors []struct{ Field, Rule string }
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		require.Len(t, body.Errors, 1)
+		require.Equal(t, "transform_preset", body.Errors[0].Field)
+		return body.Errors[0].Rule
+	}
+
+	// Act & Assert
+	w := request(http.MethodPost, "/presets", `{"name": "avatar", "media_type": "image", "transform_preset": "square", "expires_in": 3600}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	preset, err := presets.GetPresetByName(context.Background(), "avatar")
+	require.NoError(t, err)
+	require.Equal(t, "square", preset.TransformPreset)
+	require.Equal(t, 3600, preset.ExpiresIn)
+	require.Equal(t, http.StatusConflict, request(http.MethodPost, "/presets", `{"name": "avatar"}`).Code)
+
+	w = request(http.MethodPost, "/presets", `{"name": "banner", "transform_preset": "wide"}`)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Equal(t, "exists", rule(w))
+	w = request(http.MethodPost, "/presets", `{"name": "banner", "transform_preset": "square", "width": 800}`)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Equal(t, "excluded_with", rule(w))
+	w = request(http.MethodPost, "/presets", `{"name": "banner", "media_type": "doc", "transform_preset": "square"}`)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Equal(t, "media_type", rule(w))
+
+	// Updates replace every setting, including the link
+	require.Equal(t, http.StatusBadRequest, request(http.MethodPut, "/presets/avatar", `{"name": "avatar", "transform_preset": "wide"}`).Code)
+	require.Equal(t, http.StatusOK, request(http.MethodPut, "/presets/avatar", `{"name": "avatar", "width": 128}`).Code)
+	preset, err = presets.GetPresetByName(context.Background(), "avatar")
+	require.NoError(t, err)
+	require.Empty(t, preset.TransformPreset)
+	require.Equal(t, 128, preset.Width)
+	require.Equal(t, http.StatusNotFound, request(http.MethodPut, "/presets/banner", `{"name": "banner"}`).Code)
+
+	w = request(http.MethodGet, "/presets", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var listed []models.UploadPreset
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &listed))
+	require.Len(t, listed, 1)
+
+	require.Equal(t, http.StatusOK, request(http.MethodDelete, "/presets/avatar", "").Code)
+	require.Equal(t, http.StatusNotFound, request(http.MethodDelete, "/presets/avatar", "").Code)
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/audit"
+	"github.com/kevinanielsen/go-fast-cdn/src/fallback"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+)
+
+type RepairHandler struct {
+	fallbacks *fallback.Fallback
+	repairs   models.RepairTaskRepository
+}
+
+func NewRepairHandler(fallbacks *fallback.Fallback, repairs models.RepairTaskRepository) *RepairHandler {
+	return &RepairHandler{fallbacks: fallbacks, repairs: repairs}
+}
+
+// ListRepairs returns the files served from a fallback source, optionally
+// filtered with ?status=pending|repaired|failed
+func (h *RepairHandler) ListRepairs(c *gin.Context) {
+	status := c.Query("status")
+	switch status {
+	case "", models.RepairStatusPending, models.RepairStatusRepaired, models.RepairStatusFailed:
+	default:
+		problem.Write(c, http.StatusBadRequest, "Invalid status")
+		return
+	}
+
+	tasks, err := h.repairs.GetRepairTasks(c.Request.Context(), status)
+	if err != nil {
+		problem.WriteDetails(c, http.StatusInternalServerError, "Failed to list repairs", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, tasks)
+}
+
+// RunRepairs copies the files of the pending repairs back into the uploads
+// folder
+func (h *RepairHandler) RunRepairs(c *gin.Context) {
+	repaired, failed, err := h.fallbacks.Repair(c.Request.Context())
+	if err != nil {
+		problem.WriteDetails(c, http.StatusInternalServerError, "Failed to run repairs", err.Error())
+		return
+	}
+	audit.Record(c, audit.ActionRepairsRun, "", gin.H{"repaired": repaired, "failed": failed})
+
+	c.JSON(http.StatusOK, gin.H{"repaired": repaired, "failed": failed})
+}
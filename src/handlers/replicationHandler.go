@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"net/http"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/audit"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"github.com/kevinanielsen/go-fast-cdn/src/replication"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+)
+
+type ReplicationHandler struct {
+	repo   models.ReplicationRepository
+	syncer *replication.Syncer
+}
+
+func NewReplicationHandler(repo models.ReplicationRepository, syncer *replication.Syncer) *ReplicationHandler {
+	return &ReplicationHandler{repo: repo, syncer: syncer}
+}
+
+// GetChanges returns the records of a media type changed after ?cursor=,
+// for secondary instances. Up to ?limit= changes are returned per page.
+func (h *ReplicationHandler) GetChanges(c *gin.Context) {
+	mediaType := c.Param("type")
+	if models.MediaFolder(mediaType) == "" {
+		problem.Write(c, http.StatusBadRequest, "Invalid media type")
+		return
+	}
+	cursor, err := replication.ParseCursor(c.Query("cursor"))
+	if err != nil {
+		problem.Write(c, http.StatusBadRequest, "Invalid cursor")
+		return
+	}
+	limit := replication.DefaultPageSize
+	if val := c.Query("limit"); val != "" {
+		if limit, err = strconv.Atoi(val); err != nil || limit <= 0 {
+			problem.Write(c, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+	}
+
+	page, err := replication.Changes(c.Request.Context(), h.repo, mediaType, cursor, limit)
+	if err != nil {
+		problem.WriteDetails(c, http.StatusInternalServerError, "Failed to list changes", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// GetFile serves a file to secondary instances, bypassing the download
+// routes so replication doesn't count as delivery
+func (h *ReplicationHandler) GetFile(c *gin.Context) {
+	mediaType := c.Param("type")
+	fileName, err := util.FilterFilename(c.Param("filename"))
+	if models.MediaFolder(mediaType) == "" || err != nil {
+		problem.Write(c, http.StatusBadRequest, "Invalid file")
+		return
+	}
+	c.File(filepath.Join(util.ExPath, "uploads", models.MediaFolder(mediaType), fileName))
+}
+
+// GetReplicationStatus returns the state of replication from the primary
+func (h *ReplicationHandler) GetReplicationStatus(c *gin.Context) {
+	if h.syncer == nil {
+		c.JSON(http.StatusOK, replication.Status{Enabled: false})
+		return
+	}
+	c.JSON(http.StatusOK, h.syncer.Status())
+}
+
+// SyncReplication starts pulling the changes from the primary without
+// waiting for the next interval
+func (h *ReplicationHandler) SyncReplication(c *gin.Context) {
+	if h.syncer == nil {
+		problem.Write(c, http.StatusConflict, "Replication is not enabled")
+		return
+	}
+	go h.syncer.Run()
+	audit.Record(c, audit.ActionReplicationSync, h.syncer.Primary, nil)
+
+	c.JSON(http.StatusAccepted, h.syncer.Status())
+}
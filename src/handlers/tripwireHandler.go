@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"gorm.io/gorm"
+)
+
+type TripwireHandler struct {
+	tripwireRepo models.TripwireRepository
+}
+
+func NewTripwireHandler(tripwireRepo models.TripwireRepository) *TripwireHandler {
+	return &TripwireHandler{tripwireRepo: tripwireRepo}
+}
+
+type tripwireRequest struct {
+	MediaType string `json:"media_type" binding:"omitempty,oneof=image doc"`
+	Pattern   string `json:"pattern" binding:"required"`
+	Note      string `json:"note"`
+}
+
+// ListTripwires returns all tripwires
+func (h *TripwireHandler) ListTripwires(c *gin.Context) {
+	tripwires, err := h.tripwireRepo.GetAllTripwires(c.Request.Context())
+	if err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to fetch tripwires")
+		return
+	}
+	c.JSON(http.StatusOK, tripwires)
+}
+
+// CreateTripwire marks the files matching a glob pattern as honeypots
+func (h *TripwireHandler) CreateTripwire(c *gin.Context) {
+	var req tripwireRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Invalid(c, err)
+		return
+	}
+	if _, err := path.Match(req.Pattern, ""); err != nil {
+		problem.Write(c, http.StatusBadRequest, "Invalid pattern")
+		return
+	}
+
+	tripwire := &models.Tripwire{
+		MediaType: req.MediaType,
+		Pattern:   req.Pattern,
+		Note:      req.Note,
+		CreatedBy: c.GetUint("user_id"),
+	}
+	if err := h.tripwireRepo.AddTripwire(c.Request.Context(), tripwire); err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to create tripwire")
+		return
+	}
+	c.JSON(http.StatusCreated, tripwire)
+}
+
+// DeleteTripwire removes a tripwire
+func (h *TripwireHandler) DeleteTripwire(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		problem.Write(c, http.StatusBadRequest, "Invalid tripwire ID")
+		return
+	}
+	if err := h.tripwireRepo.DeleteTripwire(c.Request.Context(), uint(id)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			problem.NotFound(c, "Tripwire not found")
+			return
+		}
+		problem.Write(c, http.StatusInternalServerError, "Failed to delete tripwire")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Tripwire deleted successfully"})
+}
@@ -0,0 +1,14 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/ui"
+)
+
+// GetUIInfo reports whether the admin UI is embedded and served, and which
+// build of it, so a UI left open across an upgrade can reload itself
+func GetUIInfo(c *gin.Context) {
+	c.JSON(http.StatusOK, ui.Current())
+}
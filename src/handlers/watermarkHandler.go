@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/audit"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"github.com/kevinanielsen/go-fast-cdn/src/watermark"
+)
+
+// maxWatermarkSize is the largest watermark image accepted, in bytes.
+const maxWatermarkSize = 5 << 20
+
+type WatermarkHandler struct {
+	watermarker *watermark.Watermarker
+}
+
+func NewWatermarkHandler(watermarker *watermark.Watermarker) *WatermarkHandler {
+	return &WatermarkHandler{watermarker: watermarker}
+}
+
+// GetWatermark returns the watermark settings and whether a watermark image
+// was uploaded
+func (h *WatermarkHandler) GetWatermark(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"settings":  h.watermarker.Settings(),
+		"has_image": h.watermarker.HasImage(),
+	})
+}
+
+// UpdateWatermark replaces the watermark settings. They apply to the next
+// download without a restart.
+func (h *WatermarkHandler) UpdateWatermark(c *gin.Context) {
+	var settings models.WatermarkSettings
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		problem.Invalid(c, err)
+		return
+	}
+
+	if settings.Folders == nil {
+		settings.Folders = []string{}
+	}
+	if settings.Organizations == nil {
+		settings.Organizations = []uint{}
+	}
+
+	if err := h.watermarker.Update(settings); err != nil {
+		problem.Write(c, http.StatusInternalServerError, "Failed to update config")
+		return
+	}
+
+	audit.Record(c, audit.ActionWatermarkUpdated, "watermark", settings)
+	c.JSON(http.StatusOK, h.watermarker.Settings())
+}
+
+// UploadWatermarkImage replaces the watermark image with the image in the
+// "image" form field
+func (h *WatermarkHandler) UploadWatermarkImage(c *gin.Context) {
+	fileHeader, err := c.FormFile("image")
+	if err != nil {
+		problem.WriteDetails(c, http.StatusBadRequest, "Failed to read file", err.Error())
+		return
+	}
+	if fileHeader.Size > maxWatermarkSize {
+		problem.Write(c, http.StatusRequestEntityTooLarge, "Watermark image is too large")
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		problem.WriteDetails(c, http.StatusBadRequest, "Failed to open file", err.Error())
+		return
+	}
+	defer file.Close()
+
+	if err := h.watermarker.SetImage(file); err != nil {
+		problem.WriteDetails(c, http.StatusBadRequest, "Invalid image", err.Error())
+		return
+	}
+
+	audit.Record(c, audit.ActionWatermarkUpdated, "watermark", gin.H{"image": fileHeader.Filename})
+	c.JSON(http.StatusOK, gin.H{"message": "Watermark image uploaded successfully"})
+}
+
+// DeleteWatermarkImage removes the watermark image, which stops
+// watermarking
+func (h *WatermarkHandler) DeleteWatermarkImage(c *gin.Context) {
+	err := h.watermarker.DeleteImage()
+	if errors.Is(err, watermark.ErrNoImage) {
+		problem.NotFound(c, "No watermark image uploaded")
+		return
+	} else if err != nil {
+		problem.WriteDetails(c, http.StatusInternalServerError, "Failed to delete watermark image", err.Error())
+		return
+	}
+
+	audit.Record(c, audit.ActionWatermarkUpdated, "watermark", gin.H{"image": nil})
+	c.JSON(http.StatusOK, gin.H{"message": "Watermark image deleted successfully"})
+}
@@ -0,0 +1,102 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout is how long a command may run, unless UPLOAD_HOOK_TIMEOUT
+// sets another number of seconds.
+const DefaultTimeout = 10 * time.Second
+
+// Command is a hook running an executable for every step, with the event as
+// its argument, e.g. `hook pre_validate`, and the Media as JSON on stdin.
+// Exiting with a non-zero status rejects the upload or deletion, with the
+// output on stderr as the reason.
+type Command struct {
+	Path    string
+	Timeout time.Duration
+}
+
+func (h Command) PreValidate(ctx context.Context, m Media) error {
+	return h.run(ctx, EventPreValidate, m)
+}
+
+func (h Command) PostStore(ctx context.Context, m Media) {
+	if err := h.run(ctx, EventPostStore, m); err != nil {
+		log.Printf("Upload hook %s failed after storing %s: %s\n", h.Path, m.FileName, err.Error())
+	}
+}
+
+func (h Command) PreDelete(ctx context.Context, m Media) error {
+	return h.run(ctx, EventPreDelete, m)
+}
+
+func (h Command) run(ctx context.Context, event string, m Media) error {
+	input, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, h.Path, event)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stderr = &stderr
+	// Children left behind by the command must not hold up the request
+	cmd.WaitDelay = time.Second
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && ctx.Err() == nil {
+		reason := strings.TrimSpace(stderr.String())
+		if reason == "" {
+			reason = fmt.Sprintf("rejected with exit status %d", exitErr.ExitCode())
+		}
+		return Reject(reason)
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("timed out after %s", timeout)
+	}
+	return err
+}
+
+// Start registers a Command for every executable in UPLOAD_HOOK_COMMANDS, a
+// comma separated list of paths, relative ones to the working directory.
+func Start() error {
+	timeout := DefaultTimeout
+	if val := os.Getenv("UPLOAD_HOOK_TIMEOUT"); val != "" {
+		seconds, err := strconv.Atoi(val)
+		if err != nil || seconds <= 0 {
+			return fmt.Errorf("UPLOAD_HOOK_TIMEOUT must be a positive number of seconds")
+		}
+		timeout = time.Duration(seconds) * time.Second
+	}
+
+	for _, path := range strings.Split(os.Getenv("UPLOAD_HOOK_COMMANDS"), ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		resolved, err := exec.LookPath(path)
+		if err != nil {
+			return fmt.Errorf("upload hook %s: %w", path, err)
+		}
+		Register(filepath.Base(path), Command{Path: resolved, Timeout: timeout})
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+// Package hooks lets plugins take part in the upload pipeline, e.g. to add
+// custom validation or notifications, without forking the server. Plugins
+// are compiled in by calling Register from an init function, or run as
+// executables listed in UPLOAD_HOOK_COMMANDS, see Command.
+package hooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+)
+
+// Events the hooks are called for, passed to commands as their argument.
+const (
+	EventPreValidate = "pre_validate"
+	EventPostStore   = "post_store"
+	EventPreDelete   = "pre_delete"
+)
+
+// Media describes the upload or the media a hook is called for.
+type Media struct {
+	Type string `json:"type"`
+	// FileName is the name the client gave an upload before PostStore, and
+	// the name it is stored as from then on.
+	FileName       string `json:"file_name"`
+	MimeType       string `json:"mime_type,omitempty"`
+	Size           int64  `json:"size"`
+	UUID           string `json:"uuid,omitempty"`
+	OrganizationID *uint  `json:"organization_id,omitempty"`
+	// Actor and Role are the user making the request and their role, and IP
+	// the address of the client.
+	Actor string `json:"actor,omitempty"`
+	Role  string `json:"role,omitempty"`
+	IP    string `json:"ip,omitempty"`
+	// Header holds the first bytes of an upload for PreValidate.
+	Header []byte `json:"header,omitempty"`
+	// Path is the stored file for PostStore and PreDelete.
+	Path string `json:"path,omitempty"`
+	// Open reads the whole upload for PreValidate.
+	Open func() (io.ReadCloser, error) `json:"-"`
+	// Request is the request uploading or deleting the media.
+	Request *http.Request `json:"-"`
+}
+
+// Hook is called at every step of the upload pipeline. Embed Base to
+// implement only some of the steps.
+type Hook interface {
+	// PreValidate is called with every upload before it is validated and
+	// stored. An error rejects the upload.
+	PreValidate(ctx context.Context, m Media) error
+	// PostStore is called after an upload was stored. It runs on a
+	// goroutine of its own, so it does not hold up the response.
+	PostStore(ctx context.Context, m Media)
+	// PreDelete is called before media is deleted. An error keeps it.
+	PreDelete(ctx context.Context, m Media) error
+}
+
+// Base implements every step of Hook by doing nothing.
+type Base struct{}
+
+func (Base) PreValidate(context.Context, Media) error { return nil }
+func (Base) PostStore(context.Context, Media)         {}
+func (Base) PreDelete(context.Context, Media) error   { return nil }
+
+// Rejection is returned by hooks refusing an upload or deletion. Its reason
+// is shown to the client, while other errors are only logged.
+type Rejection struct {
+	Hook   string
+	Reason string
+}
+
+// Reject returns a Rejection for reason.
+func Reject(reason string) error {
+	return &Rejection{Reason: reason}
+}
+
+func (r *Rejection) Error() string {
+	if r.Hook == "" {
+		return r.Reason
+	}
+	return r.Hook + ": " + r.Reason
+}
+
+type registered struct {
+	name string
+	hook Hook
+}
+
+var (
+	mu    sync.RWMutex
+	hooks []registered
+)
+
+// Register adds hook under name, which identifies it in logs and
+// rejections. Hooks are called in the order they were registered.
+func Register(name string, hook Hook) {
+	mu.Lock()
+	defer mu.Unlock()
+	hooks = append(hooks, registered{name: name, hook: hook})
+}
+
+func registeredHooks() []registered {
+	mu.RLock()
+	defer mu.RUnlock()
+	return hooks
+}
+
+// Stored completes m, which describes stored media, with the path and size
+// of its file.
+func Stored(m Media) Media {
+	m.Path = filepath.Join(util.ExPath, "uploads", models.MediaFolder(m.Type), m.FileName)
+	if info, err := os.Stat(m.Path); err == nil {
+		m.Size = info.Size()
+	}
+	return m
+}
+
+// PreValidate calls the hooks with the upload of the request, stopping at
+// the first to return an error. The actor defaults to the user making the
+// request.
+func PreValidate(c *gin.Context, m Media) error {
+	m = withRequest(c, m)
+	for _, r := range registeredHooks() {
+		if err := r.hook.PreValidate(c.Request.Context(), m); err != nil {
+			return named(r.name, err)
+		}
+	}
+	return nil
+}
+
+// PostStore calls the hooks with the media stored by the request in the
+// background.
+func PostStore(c *gin.Context, m Media) {
+	m = withRequest(c, m)
+	m.Header, m.Open, m.Request = nil, nil, nil
+	ctx := context.WithoutCancel(c.Request.Context())
+	for _, r := range registeredHooks() {
+		go r.hook.PostStore(ctx, m)
+	}
+}
+
+// PreDelete calls the hooks with the media the request deletes, stopping at
+// the first to return an error.
+func PreDelete(c *gin.Context, m Media) error {
+	m = withRequest(c, m)
+	for _, r := range registeredHooks() {
+		if err := r.hook.PreDelete(c.Request.Context(), m); err != nil {
+			return named(r.name, err)
+		}
+	}
+	return nil
+}
+
+// Abort answers the request with the error returned by PreValidate or
+// PreDelete: 422 with the reason of a rejection, and 502 if a hook failed,
+// since hooks guarding uploads must not be skipped.
+func Abort(c *gin.Context, err error) {
+	var rejection *Rejection
+	if errors.As(err, &rejection) {
+		problem.Abort(c, problem.New(http.StatusUnprocessableEntity, problem.CodeMediaRejected, rejection.Reason).With("hook", rejection.Hook))
+		return
+	}
+	log.Printf("Upload hook failed: %s\n", err.Error())
+	problem.Write(c, http.StatusBadGateway, "Upload hook failed")
+}
+
+func withRequest(c *gin.Context, m Media) Media {
+	if m.Actor == "" {
+		m.Actor = c.GetString("user_email")
+		m.Role = c.GetString("user_role")
+	}
+	m.IP = c.ClientIP()
+	m.Request = c.Request
+	return m
+}
+
+// named attributes a rejection to the hook returning it.
+func named(name string, err error) error {
+	var rejection *Rejection
+	if errors.As(err, &rejection) {
+		copied := *rejection
+		copied.Hook = name
+		return &copied
+	}
+	return fmt.Errorf("%s: %w", name, err)
+}
@@ -0,0 +1,109 @@
+package hooks
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingHook struct {
+	Base
+	stored chan Media
+}
+
+func (h recordingHook) PreValidate(ctx context.Context, m Media) error {
+	if m.MimeType == "application/x-msdownload" {
+		return Reject("executables are not allowed")
+	}
+	return nil
+}
+
+func (h recordingHook) PostStore(ctx context.Context, m Media) {
+	h.stored <- m
+}
+
+func TestHooks(t *testing.T) {
+	// Arrange
+	t.Cleanup(func() { hooks = nil })
+	hook := recordingHook{stored: make(chan Media, 1)}
+	Register("policy", hook)
+	Register("failing", failingHook{})
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/cdn/upload/image", nil)
+	c.Set("user_email", "jane@example.com")
+
+	// Act & Assert
+	err := PreValidate(c, Media{Type: "image", FileName: "setup.exe", MimeType: "application/x-msdownload"})
+	var rejection *Rejection
+	require.ErrorAs(t, err, &rejection)
+	require.Equal(t, "policy", rejection.Hook)
+	Abort(c, err)
+	require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	require.Contains(t, w.Body.String(), problem.CodeMediaRejected)
+	require.Contains(t, w.Body.String(), "executables are not allowed")
+
+	err = PreValidate(c, Media{Type: "image", FileName: "cat.png"})
+	require.ErrorIs(t, err, errHookDown, "failing hooks stop the upload")
+	require.False(t, errors.As(err, &rejection))
+
+	PostStore(c, Media{Type: "image", FileName: "cat.png", Header: []byte("\x89PNG")})
+	select {
+	case m := <-hook.stored:
+		require.Equal(t, "cat.png", m.FileName)
+		require.Equal(t, "jane@example.com", m.Actor)
+		require.Nil(t, m.Header)
+	case <-time.After(time.Second):
+		t.Fatal("PostStore was not called")
+	}
+	require.NoError(t, PreDelete(c, Media{Type: "image", FileName: "cat.png"}))
+}
+
+var errHookDown = errors.New("hook is down")
+
+type failingHook struct{ Base }
+
+func (failingHook) PreValidate(context.Context, Media) error { return errHookDown }
+
+func TestCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hook script needs a POSIX shell")
+	}
+	// Arrange
+	script := filepath.Join(t.TempDir(), "hook.sh")
+	require.NoError(t, os.WriteFile(script, []byte(`#!/bin/sh
+input=$(cat)
+case "$1:$input" in
+pre_validate:*'"file_name":"virus.txt"'*) echo "infected" >&2; exit 1 ;;
+pre_delete:*) exit 3 ;;
+pre_validate:*'"file_name":"slow.txt"'*) sleep 5 ;;
+esac
+`), 0o755))
+	t.Setenv("UPLOAD_HOOK_COMMANDS", script)
+	t.Setenv("UPLOAD_HOOK_TIMEOUT", "1")
+	t.Cleanup(func() { hooks = nil })
+	require.NoError(t, Start())
+	require.Len(t, hooks, 1)
+	command := hooks[0].hook
+	ctx := context.Background()
+
+	// Act & Assert
+	require.NoError(t, command.PreValidate(ctx, Media{Type: "doc", FileName: "notes.txt"}))
+	require.EqualError(t, command.PreValidate(ctx, Media{Type: "doc", FileName: "virus.txt"}), "infected")
+	require.EqualError(t, command.PreDelete(ctx, Media{Type: "doc", FileName: "notes.txt"}), "rejected with exit status 3")
+	err := command.PreValidate(ctx, Media{Type: "doc", FileName: "slow.txt"})
+	require.EqualError(t, err, "timed out after 1s")
+
+	t.Setenv("UPLOAD_HOOK_COMMANDS", filepath.Join(t.TempDir(), "missing"))
+	require.Error(t, Start())
+}
@@ -0,0 +1,100 @@
+package imaging
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/anthonynsimon/bild/imgio"
+)
+
+// Image processing backends selectable with IMAGE_BACKEND.
+const (
+	BackendGo   = "go"
+	BackendVips = "vips"
+)
+
+// Processor transforms image files. Implementations fit images to the
+// requested size like Transform.
+type Processor interface {
+	// Name returns the backend name, e.g. BackendGo.
+	Name() string
+	// ProcessFile reads the image at src, transforms it and writes the
+	// result to dst. src and dst may be the same file.
+	ProcessFile(src, dst string, opts Options) error
+	// Saves reports whether the backend writes images in format, e.g.
+	// "webp".
+	Saves(format string) bool
+}
+
+var active atomic.Pointer[Processor]
+
+func init() {
+	SetProcessor(GoProcessor{})
+}
+
+// SetProcessor makes p the Processor used by ProcessFile.
+func SetProcessor(p Processor) {
+	active.Store(&p)
+}
+
+// Backend returns the name of the active Processor.
+func Backend() string {
+	return (*active.Load()).Name()
+}
+
+// Saves reports whether the active Processor writes images in format.
+func Saves(format string) bool {
+	return (*active.Load()).Saves(strings.ToLower(format))
+}
+
+// GoProcessor is the pure Go backend, slow for large images but without
+// dependencies.
+type GoProcessor struct{}
+
+func (GoProcessor) Name() string {
+	return BackendGo
+}
+
+func (GoProcessor) Saves(format string) bool {
+	_, err := Encoder(format, 0)
+	return err == nil
+}
+
+func (GoProcessor) ProcessFile(src, dst string, opts Options) error {
+	encoder, err := Encoder(Format(src, opts), opts.Quality)
+	if err != nil {
+		return err
+	}
+
+	img, err := imgio.Open(src)
+	if err != nil {
+		return err
+	}
+
+	return imgio.Save(dst, Transform(img, opts), encoder)
+}
+
+// Start selects the backend set in IMAGE_BACKEND, the pure Go one by
+// default. The libvips backend is only available in builds with the vips
+// build tag; without it images are processed in Go.
+func Start() error {
+	switch backend := os.Getenv("IMAGE_BACKEND"); backend {
+	case "", BackendGo:
+		SetProcessor(GoProcessor{})
+	case BackendVips:
+		vips, err := NewVipsProcessor()
+		if err != nil {
+			log.Printf("libvips is not available, processing images in Go: %s", err.Error())
+			SetProcessor(GoProcessor{})
+			return nil
+		}
+		SetProcessor(vips)
+		log.Printf("Processing images with libvips %s", vips.Version())
+	default:
+		return fmt.Errorf("invalid IMAGE_BACKEND %q, expected %s or %s", backend, BackendGo, BackendVips)
+	}
+	return nil
+}
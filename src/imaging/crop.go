@@ -0,0 +1,83 @@
+package imaging
+
+import (
+	"image"
+	"math"
+)
+
+// smartCropSteps is the number of crop positions compared by GravitySmart.
+const smartCropSteps = 20
+
+// cropOrigin returns the top left corner of the width x height crop of img,
+// which covers the box, placed according to the gravity of opts.
+func cropOrigin(img image.Image, width, height int, opts Options) (int, int) {
+	bounds := img.Bounds()
+	overflowX, overflowY := bounds.Dx()-width, bounds.Dy()-height
+
+	switch opts.Gravity {
+	case GravityNorth:
+		return overflowX / 2, 0
+	case GravitySouth:
+		return overflowX / 2, overflowY
+	case GravityWest:
+		return 0, overflowY / 2
+	case GravityEast:
+		return overflowX, overflowY / 2
+	case GravityFocal:
+		if opts.Focal != nil {
+			x := int(math.Round(opts.Focal.X*float64(bounds.Dx()))) - width/2
+			y := int(math.Round(opts.Focal.Y*float64(bounds.Dy()))) - height/2
+			return min(max(x, 0), overflowX), min(max(y, 0), overflowY)
+		}
+	case GravitySmart:
+		return smartCropOrigin(img, width, height)
+	}
+	return overflowX / 2, overflowY / 2
+}
+
+// smartCropOrigin slides the crop along the axis the image overflows and
+// returns the position whose content has the highest entropy, which is
+// usually the subject rather than a plain background.
+func smartCropOrigin(img image.Image, width, height int) (int, int) {
+	bounds := img.Bounds()
+	overflowX, overflowY := bounds.Dx()-width, bounds.Dy()-height
+	overflow := max(overflowX, overflowY)
+	if overflow <= 0 {
+		return 0, 0
+	}
+
+	bestX, bestY, best := overflowX/2, overflowY/2, -1.0
+	steps := min(smartCropSteps, overflow)
+	for i := 0; i <= steps; i++ {
+		x, y := overflowX*i/steps, overflowY*i/steps
+		if e := entropy(img, image.Rect(x, y, x+width, y+height).Add(bounds.Min)); e > best {
+			bestX, bestY, best = x, y, e
+		}
+	}
+	return bestX, bestY
+}
+
+// entropy returns the Shannon entropy of the luminance histogram of the
+// rect of img, sampling at most about 10000 pixels.
+func entropy(img image.Image, rect image.Rectangle) float64 {
+	step := max(1, int(math.Sqrt(float64(rect.Dx()*rect.Dy())/10000)))
+	var histogram [256]int
+	total := 0
+	for y := rect.Min.Y; y < rect.Max.Y; y += step {
+		for x := rect.Min.X; x < rect.Max.X; x += step {
+			r, g, b, _ := img.At(x, y).RGBA()
+			luma := (299*r + 587*g + 114*b) / 1000 >> 8
+			histogram[luma]++
+			total++
+		}
+	}
+
+	var e float64
+	for _, count := range histogram {
+		if count > 0 {
+			p := float64(count) / float64(total)
+			e -= p * math.Log2(p)
+		}
+	}
+	return e
+}
@@ -0,0 +1,41 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCropOrigin(t *testing.T) {
+	// A plain image with a noisy square on its right side
+	img := image.NewRGBA(image.Rect(0, 0, 400, 100))
+	for y := 20; y < 80; y++ {
+		for x := 300; x < 360; x++ {
+			img.Set(x, y, color.Gray{Y: uint8(x*7 + y*13)})
+		}
+	}
+
+	testCases := []struct {
+		name string
+		opts Options
+		x, y int
+	}{
+		{"center", Options{}, 150, 0},
+		{"west", Options{Gravity: GravityWest}, 0, 0},
+		{"east", Options{Gravity: GravityEast}, 300, 0},
+		{"focal", Options{Gravity: GravityFocal, Focal: &FocalPoint{X: 0.25, Y: 0.5}}, 50, 0},
+		{"focal near the edge", Options{Gravity: GravityFocal, Focal: &FocalPoint{X: 0.01, Y: 0.5}}, 0, 0},
+		{"focal without point", Options{Gravity: GravityFocal}, 150, 0},
+		{"smart", Options{Gravity: GravitySmart}, 270, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			x, y := cropOrigin(img, 100, 100, tc.opts)
+			require.Equal(t, tc.x, x)
+			require.Equal(t, tc.y, y)
+		})
+	}
+}
@@ -0,0 +1,137 @@
+// Package imaging contains the image transformations shared by the resize
+// endpoint, upload presets and transform presets.
+package imaging
+
+import (
+	"fmt"
+	"image"
+	"path/filepath"
+	"strings"
+
+	"github.com/anthonynsimon/bild/imgio"
+	"github.com/anthonynsimon/bild/transform"
+)
+
+// Fit modes describing how an image is made to match the requested box.
+const (
+	// FitFill stretches the image to exactly the requested size.
+	FitFill = "fill"
+	// FitContain scales the image to fit inside the box, keeping the
+	// aspect ratio.
+	FitContain = "contain"
+	// FitCover scales the image to cover the box, keeping the aspect ratio,
+	// and crops the overflow around the center.
+	FitCover = "cover"
+)
+
+// Gravities choosing the part of the image kept when FitCover crops it.
+const (
+	GravityCenter = "center"
+	GravityNorth  = "north"
+	GravitySouth  = "south"
+	GravityEast   = "east"
+	GravityWest   = "west"
+	// GravityFocal keeps the focal point of the image in view.
+	GravityFocal = "focal"
+	// GravitySmart keeps the most detailed part of the image, measured by
+	// its entropy.
+	GravitySmart = "smart"
+)
+
+// ValidGravity reports whether gravity is empty or one of the gravities.
+func ValidGravity(gravity string) bool {
+	switch gravity {
+	case "", GravityCenter, GravityNorth, GravitySouth, GravityEast, GravityWest, GravityFocal, GravitySmart:
+		return true
+	}
+	return false
+}
+
+// FocalPoint is the position of the subject of an image, as fractions of
+// its width and height from the top left corner.
+type FocalPoint struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// DefaultQuality is the JPEG quality used when none is configured.
+const DefaultQuality = 75
+
+// Options describe a transformation. A zero Width or Height is derived from
+// the other one, keeping the aspect ratio. An empty Format keeps the format
+// of the source image.
+type Options struct {
+	Width   int
+	Height  int
+	Fit     string
+	Format  string
+	Quality int
+	// Gravity applies to FitCover, see GravityCenter.
+	Gravity string
+	// Focal is the focal point used by GravityFocal. Without one the image
+	// is cropped around its center.
+	Focal *FocalPoint
+}
+
+// Transform resizes img according to opts.
+func Transform(img image.Image, opts Options) image.Image {
+	bounds := img.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+	width, height := opts.Width, opts.Height
+
+	if width == 0 && height == 0 {
+		return img
+	} else if width == 0 {
+		width = srcW * height / srcH
+	} else if height == 0 {
+		height = srcH * width / srcW
+	}
+
+	switch opts.Fit {
+	case FitContain:
+		scale := min(float64(width)/float64(srcW), float64(height)/float64(srcH))
+		return transform.Resize(img, max(1, int(float64(srcW)*scale)), max(1, int(float64(srcH)*scale)), transform.Linear)
+	case FitCover:
+		scale := max(float64(width)/float64(srcW), float64(height)/float64(srcH))
+		scaledW, scaledH := max(width, int(float64(srcW)*scale)), max(height, int(float64(srcH)*scale))
+		resized := transform.Resize(img, scaledW, scaledH, transform.Linear)
+		x, y := cropOrigin(resized, width, height, opts)
+		return transform.Crop(resized, image.Rect(x, y, x+width, y+height))
+	default:
+		return transform.Resize(img, width, height, transform.Linear)
+	}
+}
+
+// Encoder returns the encoder for the given format or file extension
+// (without the leading dot).
+func Encoder(format string, quality int) (imgio.Encoder, error) {
+	if quality <= 0 || quality > 100 {
+		quality = DefaultQuality
+	}
+
+	switch strings.ToLower(format) {
+	case "png":
+		return imgio.PNGEncoder(), nil
+	case "jpg", "jpeg":
+		return imgio.JPEGEncoder(quality), nil
+	case "bmp":
+		return imgio.BMPEncoder(), nil
+	default:
+		return nil, fmt.Errorf("Image of type %s is not supported", format)
+	}
+}
+
+// Format returns the output format for a source file, honouring an explicit
+// format in opts.
+func Format(path string, opts Options) string {
+	if opts.Format != "" {
+		return strings.ToLower(opts.Format)
+	}
+	return strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+}
+
+// ProcessFile reads the image at src, transforms it and writes the result to
+// dst with the active Processor. src and dst may be the same file.
+func ProcessFile(src, dst string, opts Options) error {
+	return (*active.Load()).ProcessFile(src, dst, opts)
+}
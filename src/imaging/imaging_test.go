@@ -0,0 +1,42 @@
+package imaging
+
+import (
+	"image"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransform(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 400, 200))
+
+	testCases := []struct {
+		name   string
+		opts   Options
+		width  int
+		height int
+	}{
+		{"fill", Options{Width: 100, Height: 100, Fit: FitFill}, 100, 100},
+		{"contain", Options{Width: 100, Height: 100, Fit: FitContain}, 100, 50},
+		{"cover", Options{Width: 100, Height: 100, Fit: FitCover}, 100, 100},
+		{"width only", Options{Width: 200}, 200, 100},
+		{"height only", Options{Height: 50}, 100, 50},
+		{"no size", Options{}, 400, 200},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			bounds := Transform(src, tc.opts).Bounds()
+			require.Equal(t, tc.width, bounds.Dx())
+			require.Equal(t, tc.height, bounds.Dy())
+		})
+	}
+}
+
+func TestSignature(t *testing.T) {
+	signature := Sign("thumb", "cat.png")
+
+	require.True(t, VerifySignature("thumb", "cat.png", signature))
+	require.False(t, VerifySignature("hero", "cat.png", signature))
+	require.False(t, VerifySignature("thumb", "dog.png", signature))
+}
@@ -0,0 +1,284 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+)
+
+// ErrNotOptimizable is returned by Optimize for images other than JPEG and
+// PNG.
+var ErrNotOptimizable = errors.New("only JPEG and PNG images can be optimized")
+
+// OptimizeOptions configure Optimize.
+type OptimizeOptions struct {
+	// Quality is the JPEG quality, DefaultQuality if zero.
+	Quality int
+	// MaxDimension caps the width and height of the image, 0 for no cap.
+	MaxDimension int
+}
+
+// Optimized describes an optimized image.
+type Optimized struct {
+	OriginalSize  int64
+	OptimizedSize int64
+	Width         int
+	Height        int
+}
+
+// Optimize rewrites the JPEG or PNG image at path without metadata, e.g.
+// camera details or GPS positions. JPEG images are turned upright according
+// to their EXIF orientation, and images larger than MaxDimension are scaled
+// down. Unless the image had to be turned or scaled, the smaller of the
+// re-encoded image and the original without its metadata is kept.
+func Optimize(path string, opts OptimizeOptions) (Optimized, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Optimized{}, err
+	}
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || (format != "jpeg" && format != "png") {
+		return Optimized{}, ErrNotOptimizable
+	}
+
+	var stripped []byte
+	orientation := 1
+	if format == "jpeg" {
+		stripped, orientation, err = stripJPEG(data)
+	} else {
+		stripped, err = stripPNG(data)
+	}
+	if err != nil {
+		return Optimized{}, err
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return Optimized{}, err
+	}
+	changed := orientation > 1 && orientation <= 8
+	if changed {
+		img = orient(img, orientation)
+	}
+	if limit := opts.MaxDimension; limit > 0 && (img.Bounds().Dx() > limit || img.Bounds().Dy() > limit) {
+		img = Transform(img, Options{Width: limit, Height: limit, Fit: FitContain})
+		changed = true
+	}
+
+	var encoded bytes.Buffer
+	if format == "jpeg" {
+		quality := opts.Quality
+		if quality <= 0 || quality > 100 {
+			quality = DefaultQuality
+		}
+		err = jpeg.Encode(&encoded, img, &jpeg.Options{Quality: quality})
+	} else {
+		err = (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(&encoded, img)
+	}
+	if err != nil {
+		return Optimized{}, err
+	}
+
+	result := encoded.Bytes()
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	if !changed && len(stripped) <= len(result) {
+		result = stripped
+		width, height = config.Width, config.Height
+	}
+	if err := writeFile(path, result); err != nil {
+		return Optimized{}, err
+	}
+	return Optimized{
+		OriginalSize:  int64(len(data)),
+		OptimizedSize: int64(len(result)),
+		Width:         width,
+		Height:        height,
+	}, nil
+}
+
+// writeFile replaces the file at path with data through a temporary file, so
+// readers never see it half written.
+func writeFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".optimize-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// stripJPEG returns the JPEG data without comments and the application
+// segments holding metadata, i.e. all but JFIF, ICC profiles and the Adobe
+// segment needed to decode CMYK images, and the EXIF orientation of the
+// image, 1 if it has none.
+func stripJPEG(data []byte) ([]byte, int, error) {
+	errInvalid := errors.New("invalid JPEG")
+	if len(data) < 2 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, 0, errInvalid
+	}
+
+	out := append(make([]byte, 0, len(data)), data[:2]...)
+	orientation := 1
+	pos := 2
+	for pos < len(data) {
+		if data[pos] != 0xFF {
+			return nil, 0, errInvalid
+		}
+		// Markers may be padded with fill bytes
+		for pos+1 < len(data) && data[pos+1] == 0xFF {
+			pos++
+		}
+		if pos+1 >= len(data) {
+			return nil, 0, errInvalid
+		}
+		marker := data[pos+1]
+		if marker == 0xD9 || marker == 0xDA {
+			// The entropy-coded data starting at SOS runs to the end
+			return append(out, data[pos:]...), orientation, nil
+		}
+		if marker == 0x01 || marker >= 0xD0 && marker <= 0xD7 {
+			out = append(out, data[pos:pos+2]...)
+			pos += 2
+			continue
+		}
+		if pos+4 > len(data) {
+			return nil, 0, errInvalid
+		}
+		end := pos + 2 + int(binary.BigEndian.Uint16(data[pos+2:]))
+		if end > len(data) || end < pos+4 {
+			return nil, 0, errInvalid
+		}
+		segment, payload := data[pos:end], data[pos+4:end]
+
+		keep := true
+		switch {
+		case marker == 0xE1:
+			if bytes.HasPrefix(payload, []byte("Exif\x00\x00")) {
+				if o := exifOrientation(payload[6:]); o != 0 {
+					orientation = o
+				}
+			}
+			keep = false
+		case marker == 0xE2:
+			keep = bytes.HasPrefix(payload, []byte("ICC_PROFILE\x00"))
+		case marker == 0xEE:
+			keep = bytes.HasPrefix(payload, []byte("Adobe"))
+		case marker > 0xE0 && marker <= 0xEF, marker == 0xFE:
+			keep = false
+		}
+		if keep {
+			out = append(out, segment...)
+		}
+		pos = end
+	}
+	return nil, 0, errInvalid
+}
+
+// exifOrientation returns the orientation tag of the TIFF structure of EXIF
+// data, or 0 if it has none.
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 0
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+	return 0
+}
+
+// stripPNG returns the PNG data without its text, time and EXIF chunks.
+func stripPNG(data []byte) ([]byte, error) {
+	const signature = "\x89PNG\r\n\x1a\n"
+	if !bytes.HasPrefix(data, []byte(signature)) {
+		return nil, errors.New("invalid PNG")
+	}
+
+	out := append(make([]byte, 0, len(data)), signature...)
+	for pos := len(signature); pos < len(data); {
+		if pos+8 > len(data) {
+			return nil, errors.New("invalid PNG")
+		}
+		end := pos + 12 + int(binary.BigEndian.Uint32(data[pos:]))
+		if end > len(data) || end < pos {
+			return nil, errors.New("invalid PNG")
+		}
+		switch string(data[pos+4 : pos+8]) {
+		case "tEXt", "zTXt", "iTXt", "eXIf", "tIME":
+		default:
+			out = append(out, data[pos:end]...)
+		}
+		pos = end
+	}
+	return out, nil
+}
+
+// orient turns img upright according to its EXIF orientation, 2 to 8.
+func orient(img image.Image, orientation int) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	src := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+
+	dstW, dstH := w, h
+	if orientation >= 5 {
+		dstW, dstH = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			i, j := src.PixOffset(x, y), dst.PixOffset(dx, dy)
+			copy(dst.Pix[j:j+4], src.Pix[i:i+4])
+		}
+	}
+	return dst
+}
@@ -0,0 +1,99 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// exifSegment returns an APP1 segment holding the EXIF orientation.
+func exifSegment(orientation uint16) []byte {
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x01")
+	tiff = binary.BigEndian.AppendUint16(tiff, 0x0112)
+	tiff = binary.BigEndian.AppendUint16(tiff, 3)
+	tiff = binary.BigEndian.AppendUint32(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0)
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xFF, 0xE1}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+func TestOptimize_JPEG(t *testing.T) {
+	// A 40x20 image, red on the left, that has to be turned clockwise
+	img := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 40; x++ {
+			if x < 20 {
+				img.Set(x, y, color.RGBA{255, 0, 0, 255})
+			} else {
+				img.Set(x, y, color.RGBA{0, 0, 255, 255})
+			}
+		}
+	}
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, img, &jpeg.Options{Quality: 100}))
+	data := append(append([]byte{0xFF, 0xD8}, exifSegment(6)...), buf.Bytes()[2:]...)
+	path := filepath.Join(t.TempDir(), "photo.jpg")
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+
+	result, err := Optimize(path, OptimizeOptions{Quality: 80})
+	require.NoError(t, err)
+	require.Equal(t, int64(len(data)), result.OriginalSize)
+	require.Equal(t, 20, result.Width)
+	require.Equal(t, 40, result.Height)
+
+	optimized, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, result.OptimizedSize, int64(len(optimized)))
+	require.NotContains(t, string(optimized), "Exif")
+	decoded, err := jpeg.Decode(bytes.NewReader(optimized))
+	require.NoError(t, err)
+	r, _, b, _ := decoded.At(10, 5).RGBA()
+	require.Greater(t, r, b, "the red half is on top")
+
+	// Large images are scaled down
+	result, err = Optimize(path, OptimizeOptions{MaxDimension: 10})
+	require.NoError(t, err)
+	require.Equal(t, 5, result.Width)
+	require.Equal(t, 10, result.Height)
+}
+
+func TestOptimize_PNG(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, image.NewGray(image.Rect(0, 0, 8, 8))))
+	data := buf.Bytes()
+	// Insert a text chunk after the header chunk
+	text := []byte("Author\x00someone")
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(text)))
+	chunk = append(append(chunk, "tEXt"...), text...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+	headerEnd := 8 + 12 + 13
+	data = append(append(append([]byte{}, data[:headerEnd]...), chunk...), data[headerEnd:]...)
+	path := filepath.Join(t.TempDir(), "image.png")
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+
+	result, err := Optimize(path, OptimizeOptions{})
+	require.NoError(t, err)
+	require.Less(t, result.OptimizedSize, result.OriginalSize)
+	optimized, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NotContains(t, string(optimized), "someone")
+	_, err = png.Decode(bytes.NewReader(optimized))
+	require.NoError(t, err)
+
+	bmp := filepath.Join(t.TempDir(), "image.bmp")
+	require.NoError(t, os.WriteFile(bmp, []byte("BM not really"), 0o644))
+	_, err = Optimize(bmp, OptimizeOptions{})
+	require.ErrorIs(t, err, ErrNotOptimizable)
+}
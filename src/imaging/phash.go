@@ -0,0 +1,87 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/bits"
+	"os"
+	"sort"
+)
+
+// phashSize is the size images are scaled to before their DCT is taken. The
+// hash keeps the 8x8 lowest frequencies.
+const phashSize = 32
+
+// PerceptualHashFile computes the perceptual hash of the image at path.
+func PerceptualHashFile(path string) (uint64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return 0, err
+	}
+	return PerceptualHash(img), nil
+}
+
+// PerceptualHash computes the DCT based perceptual hash (pHash) of img.
+// Re-encoded, resized or slightly edited copies of an image have hashes that
+// differ in few bits, see HashDistance.
+func PerceptualHash(img image.Image) uint64 {
+	small := Transform(img, Options{Width: phashSize, Height: phashSize})
+	bounds := small.Bounds()
+	var gray [phashSize][phashSize]float64
+	for y := 0; y < phashSize; y++ {
+		for x := 0; x < phashSize; x++ {
+			gray[y][x] = float64(color.GrayModel.Convert(small.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.Gray).Y)
+		}
+	}
+
+	// Only the 8x8 lowest frequencies of the 2D DCT are needed
+	var cosines [8][phashSize]float64
+	for u := 0; u < 8; u++ {
+		for x := 0; x < phashSize; x++ {
+			cosines[u][x] = math.Cos(float64(2*x+1) * float64(u) * math.Pi / (2 * phashSize))
+		}
+	}
+	var rows [phashSize][8]float64
+	for y := 0; y < phashSize; y++ {
+		for u := 0; u < 8; u++ {
+			for x := 0; x < phashSize; x++ {
+				rows[y][u] += gray[y][x] * cosines[u][x]
+			}
+		}
+	}
+	coefficients := make([]float64, 0, 64)
+	for v := 0; v < 8; v++ {
+		for u := 0; u < 8; u++ {
+			sum := 0.0
+			for y := 0; y < phashSize; y++ {
+				sum += rows[y][u] * cosines[v][y]
+			}
+			coefficients = append(coefficients, sum)
+		}
+	}
+
+	// The DC coefficient only reflects the overall brightness
+	sorted := append([]float64(nil), coefficients[1:]...)
+	sort.Float64s(sorted)
+	median := (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+
+	var hash uint64
+	for i, c := range coefficients {
+		if c > median {
+			hash |= 1 << uint(i)
+		}
+	}
+	return hash
+}
+
+// HashDistance returns the number of bits two perceptual hashes differ in,
+// 0 for identical looking images and up to 64.
+func HashDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
@@ -0,0 +1,36 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPerceptualHash(t *testing.T) {
+	waves := func(fx, fy float64) image.Image {
+		img := image.NewNRGBA(image.Rect(0, 0, 240, 160))
+		for y := 0; y < 160; y++ {
+			for x := 0; x < 240; x++ {
+				v := 128 + 60*math.Sin(fx*float64(x)/240) + 60*math.Cos(fy*float64(y)/160+float64(x)/100)
+				img.Set(x, y, color.NRGBA{R: uint8(v), G: uint8(v * 0.8), B: 90, A: 255})
+			}
+		}
+		return img
+	}
+	original := waves(7, 5)
+
+	// A scaled down, re-encoded copy looks the same
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, Transform(original, Options{Width: 120}), &jpeg.Options{Quality: 40}))
+	copied, err := jpeg.Decode(&buf)
+	require.NoError(t, err)
+	require.LessOrEqual(t, HashDistance(PerceptualHash(original), PerceptualHash(copied)), 8)
+
+	// Another picture does not
+	require.Greater(t, HashDistance(PerceptualHash(original), PerceptualHash(waves(3, 11))), 16)
+}
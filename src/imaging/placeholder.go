@@ -0,0 +1,183 @@
+package imaging
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"os"
+)
+
+const (
+	// placeholderSize is the size images are scaled down to before their
+	// placeholder is computed. Blurhashes only keep the coarsest details.
+	placeholderSize = 32
+
+	blurhashXComponents = 4
+	blurhashYComponents = 3
+
+	base83 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+)
+
+// Placeholder describes an image for front-ends to render while it loads.
+type Placeholder struct {
+	// Blurhash is a compact representation of a blurred version of the
+	// image, see https://blurha.sh.
+	Blurhash string
+	// DominantColor is the most common color of the image, e.g. "#3a6ea5".
+	DominantColor string
+}
+
+// PlaceholderFile computes the placeholder of the image at path.
+func PlaceholderFile(path string) (Placeholder, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Placeholder{}, err
+	}
+	defer file.Close()
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return Placeholder{}, err
+	}
+	return PlaceholderOf(img), nil
+}
+
+// PlaceholderOf computes the placeholder of img.
+func PlaceholderOf(img image.Image) Placeholder {
+	if b := img.Bounds(); b.Dx() > placeholderSize || b.Dy() > placeholderSize {
+		img = Transform(img, Options{Width: placeholderSize, Height: placeholderSize, Fit: FitContain})
+	}
+	return Placeholder{Blurhash: Blurhash(img), DominantColor: DominantColor(img)}
+}
+
+// Blurhash encodes img with 4 horizontal and 3 vertical components. Every
+// pixel is visited for each component, so large images should be scaled
+// down first.
+func Blurhash(img image.Image) string {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width == 0 || height == 0 {
+		return ""
+	}
+
+	// Linear RGB values, so the cosine transform mixes light correctly
+	pixels := make([][3]float64, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.NRGBAModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.NRGBA)
+			pixels[y*width+x] = [3]float64{srgbToLinear(c.R), srgbToLinear(c.G), srgbToLinear(c.B)}
+		}
+	}
+
+	factors := make([][3]float64, 0, blurhashXComponents*blurhashYComponents)
+	for j := 0; j < blurhashYComponents; j++ {
+		for i := 0; i < blurhashXComponents; i++ {
+			normalisation := 2.0
+			if i == 0 && j == 0 {
+				normalisation = 1
+			}
+			var factor [3]float64
+			for y := 0; y < height; y++ {
+				for x := 0; x < width; x++ {
+					basis := normalisation *
+						math.Cos(math.Pi*float64(i)*float64(x)/float64(width)) *
+						math.Cos(math.Pi*float64(j)*float64(y)/float64(height))
+					p := pixels[y*width+x]
+					factor[0] += basis * p[0]
+					factor[1] += basis * p[1]
+					factor[2] += basis * p[2]
+				}
+			}
+			scale := 1 / float64(width*height)
+			factors = append(factors, [3]float64{factor[0] * scale, factor[1] * scale, factor[2] * scale})
+		}
+	}
+
+	hash := encode83((blurhashXComponents-1)+(blurhashYComponents-1)*9, 1)
+
+	dc, ac := factors[0], factors[1:]
+	maxValue := 1.0
+	if len(ac) > 0 {
+		actualMax := 0.0
+		for _, f := range ac {
+			actualMax = math.Max(actualMax, math.Max(math.Abs(f[0]), math.Max(math.Abs(f[1]), math.Abs(f[2]))))
+		}
+		quantisedMax := int(math.Max(0, math.Min(82, math.Floor(actualMax*166-0.5))))
+		maxValue = float64(quantisedMax+1) / 166
+		hash += encode83(quantisedMax, 1)
+	} else {
+		hash += encode83(0, 1)
+	}
+
+	hash += encode83(linearToSRGB(dc[0])<<16+linearToSRGB(dc[1])<<8+linearToSRGB(dc[2]), 4)
+	for _, f := range ac {
+		quantise := func(v float64) int {
+			return int(math.Max(0, math.Min(18, math.Floor(signPow(v/maxValue, 0.5)*9+9.5))))
+		}
+		hash += encode83(quantise(f[0])*19*19+quantise(f[1])*19+quantise(f[2]), 2)
+	}
+	return hash
+}
+
+// DominantColor returns the most common color of img as a hex triplet,
+// ignoring mostly transparent pixels. Similar colors are counted together
+// and averaged. It returns an empty string if every pixel is transparent.
+func DominantColor(img image.Image) string {
+	type bucket struct {
+		count   int
+		r, g, b int
+	}
+	var buckets [4096]bucket
+	bounds := img.Bounds()
+	best := -1
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if c.A < 128 {
+				continue
+			}
+			i := int(c.R>>4)<<8 | int(c.G>>4)<<4 | int(c.B>>4)
+			buckets[i].count++
+			buckets[i].r += int(c.R)
+			buckets[i].g += int(c.G)
+			buckets[i].b += int(c.B)
+			if best < 0 || buckets[i].count > buckets[best].count {
+				best = i
+			}
+		}
+	}
+	if best < 0 {
+		return ""
+	}
+	b := buckets[best]
+	return fmt.Sprintf("#%02x%02x%02x", b.r/b.count, b.g/b.count, b.b/b.count)
+}
+
+func encode83(value, length int) string {
+	digits := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		digits[i] = base83[value%83]
+		value /= 83
+	}
+	return string(digits)
+}
+
+func srgbToLinear(value uint8) float64 {
+	v := float64(value) / 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(value float64) int {
+	v := math.Max(0, math.Min(1, value))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(value, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(value), exp), value)
+}
@@ -0,0 +1,30 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlaceholderOf(t *testing.T) {
+	black := image.NewNRGBA(image.Rect(0, 0, 8, 6))
+	draw.Draw(black, black.Bounds(), image.NewUniform(color.Black), image.Point{}, draw.Src)
+	require.Equal(t, Placeholder{Blurhash: "L00000fQfQfQfQfQfQfQfQfQfQfQ", DominantColor: "#000000"}, PlaceholderOf(black))
+
+	// A mostly red image with a blue stripe keeps red as its dominant color
+	img := image.NewNRGBA(image.Rect(0, 0, 100, 60))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.NRGBA{R: 255, A: 255}), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(0, 0, 100, 10), image.NewUniform(color.NRGBA{B: 255, A: 255}), image.Point{}, draw.Src)
+	placeholder := PlaceholderOf(img)
+	require.Equal(t, "#ff0000", placeholder.DominantColor)
+	require.Len(t, placeholder.Blurhash, 28)
+	require.Equal(t, "L", placeholder.Blurhash[:1])
+	// The stripe shows in the components past the average color
+	require.NotEqual(t, strings.Repeat("fQ", 11), placeholder.Blurhash[6:])
+
+	require.Empty(t, DominantColor(image.NewNRGBA(image.Rect(0, 0, 2, 2))))
+}
@@ -0,0 +1,33 @@
+package imaging
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"os"
+)
+
+func signingKey() []byte {
+	key := os.Getenv("TRANSFORM_SIGNING_KEY")
+	if key == "" {
+		key = os.Getenv("JWT_SECRET")
+	}
+	if key == "" {
+		key = "your-super-secret-jwt-key"
+	}
+	return []byte(key)
+}
+
+// Sign returns the URL signature authorizing preset to be applied to
+// fileName.
+func Sign(preset, fileName string) string {
+	mac := hmac.New(sha256.New, signingKey())
+	mac.Write([]byte(preset + "/" + fileName))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature reports whether signature authorizes preset to be applied
+// to fileName.
+func VerifySignature(preset, fileName, signature string) bool {
+	return hmac.Equal([]byte(Sign(preset, fileName)), []byte(signature))
+}
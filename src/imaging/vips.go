@@ -0,0 +1,221 @@
+//go:build vips
+
+package imaging
+
+import (
+	"fmt"
+	"image"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/davidbyttow/govips/v2/vips"
+)
+
+// VipsProcessor processes images with libvips through govips, which is much
+// faster and lighter on memory than the Go backend for large images. It is
+// only built with the vips build tag, as it needs cgo and libvips. Formats
+// libvips cannot save, and images it fails on, are processed in Go.
+type VipsProcessor struct {
+	// savers are the formats beyond vipsFormat the libvips build writes,
+	// depending on the optional modules it was built with.
+	savers map[string]bool
+	// fallback processes the images libvips does not handle.
+	fallback Processor
+}
+
+var startVips sync.Once
+
+// NewVipsProcessor starts libvips, logging its warnings, and returns a
+// processor using it.
+func NewVipsProcessor() (*VipsProcessor, error) {
+	startVips.Do(func() {
+		vips.LoggingSettings(func(domain string, _ vips.LogLevel, message string) {
+			log.Printf("libvips: %s: %s", domain, message)
+		}, vips.LogLevelWarning)
+		vips.Startup(nil)
+	})
+	return &VipsProcessor{savers: vipsSavers(), fallback: GoProcessor{}}, nil
+}
+
+// vipsOptionalSavers maps the formats of optional libvips modules to their
+// image types. AVIF is written by the heif module when built with an AV1
+// encoder.
+var vipsOptionalSavers = map[string]vips.ImageType{
+	"webp": vips.ImageTypeWEBP,
+	"avif": vips.ImageTypeAVIF,
+}
+
+// vipsSavers returns the formats of vipsOptionalSavers the libvips build
+// supports.
+func vipsSavers() map[string]bool {
+	savers := map[string]bool{}
+	for format, imageType := range vipsOptionalSavers {
+		if vips.IsTypeSupported(imageType) {
+			savers[format] = true
+		}
+	}
+	return savers
+}
+
+func (p *VipsProcessor) Name() string {
+	return BackendVips
+}
+
+// Version returns the libvips version, e.g. "8.15.1".
+func (p *VipsProcessor) Version() string {
+	return vips.Version
+}
+
+// Saves reports whether libvips or the Go backend write images in format.
+func (p *VipsProcessor) Saves(format string) bool {
+	return vipsFormat(format) || p.savers[format] || p.fallback.Saves(format)
+}
+
+func (p *VipsProcessor) ProcessFile(src, dst string, opts Options) error {
+	format := Format(src, opts)
+	if !(vipsFormat(format) || p.savers[format]) || !vipsFormat(Format(src, Options{})) || !vipsGravity(opts) {
+		return p.fallback.ProcessFile(src, dst, opts)
+	}
+	if _, err := Encoder(format, opts.Quality); err != nil && !p.savers[format] {
+		return err
+	}
+
+	if err := p.process(src, dst, format, opts); err != nil {
+		log.Printf("libvips failed to process %s, processing it in Go: %s", filepath.Base(src), err.Error())
+		return p.fallback.ProcessFile(src, dst, opts)
+	}
+	return nil
+}
+
+// vipsFormat reports whether libvips reads and writes format without
+// optional modules.
+func vipsFormat(format string) bool {
+	switch format {
+	case "png", "jpg", "jpeg":
+		return true
+	}
+	return false
+}
+
+// vipsGravity reports whether libvips can crop with the gravity of opts:
+// around the center, or smartly with its attention strategy.
+func vipsGravity(opts Options) bool {
+	if opts.Fit != FitCover {
+		return true
+	}
+	switch opts.Gravity {
+	case "", GravityCenter, GravitySmart:
+		return true
+	}
+	return false
+}
+
+func (p *VipsProcessor) process(src, dst, format string, opts Options) error {
+	img, err := vipsLoad(src, opts)
+	if err != nil {
+		return err
+	}
+	defer img.Close()
+
+	data, err := vipsExport(img, format, opts.Quality)
+	if err != nil {
+		return err
+	}
+
+	// src and dst may be the same file, which must stay intact if writing
+	// the result fails
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".vips-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+// vipsLoad loads the image at src fitted into the box of opts like
+// Transform.
+func vipsLoad(src string, opts Options) (*vips.ImageRef, error) {
+	if opts.Width == 0 && opts.Height == 0 {
+		return vips.NewImageFromFile(src)
+	}
+
+	width, height, err := vipsSize(src, opts)
+	if err != nil {
+		return nil, err
+	}
+	crop, size := vips.InterestingNone, vips.SizeForce
+	switch opts.Fit {
+	case FitContain:
+		size = vips.SizeBoth
+	case FitCover:
+		crop, size = vips.InterestingCentre, vips.SizeBoth
+		if opts.Gravity == GravitySmart {
+			crop = vips.InterestingAttention
+		}
+	}
+	return vips.NewThumbnailWithSizeFromFile(src, width, height, crop, size)
+}
+
+// vipsSize returns the box of opts, computing a missing width or height
+// from the aspect ratio of the image at src.
+func vipsSize(src string, opts Options) (int, int, error) {
+	width, height := opts.Width, opts.Height
+	if width != 0 && height != 0 {
+		return width, height, nil
+	}
+
+	f, err := os.Open(src)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	config, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if width == 0 {
+		width = max(1, config.Width*height/config.Height)
+	} else {
+		height = max(1, config.Height*width/config.Width)
+	}
+	return width, height, nil
+}
+
+// vipsExport encodes img in format, with quality for the lossy formats.
+func vipsExport(img *vips.ImageRef, format string, quality int) ([]byte, error) {
+	if quality <= 0 || quality > 100 {
+		quality = DefaultQuality
+	}
+
+	var data []byte
+	var err error
+	switch format {
+	case "jpg", "jpeg":
+		params := vips.NewJpegExportParams()
+		params.Quality = quality
+		data, _, err = img.ExportJpeg(params)
+	case "png":
+		data, _, err = img.ExportPng(vips.NewPngExportParams())
+	case "webp":
+		params := vips.NewWebpExportParams()
+		params.Quality = quality
+		data, _, err = img.ExportWebp(params)
+	case "avif":
+		params := vips.NewAvifExportParams()
+		params.Quality = quality
+		data, _, err = img.ExportAvif(params)
+	default:
+		return nil, fmt.Errorf("libvips does not write %s images", format)
+	}
+	return data, err
+}
@@ -0,0 +1,21 @@
+//go:build !vips
+
+package imaging
+
+import "errors"
+
+// VipsProcessor is the libvips backend, only built with the vips build tag
+// as it needs cgo and libvips.
+type VipsProcessor struct {
+	GoProcessor
+}
+
+// NewVipsProcessor fails, as this binary was built without libvips.
+func NewVipsProcessor() (*VipsProcessor, error) {
+	return nil, errors.New("built without libvips, build with -tags vips to use it")
+}
+
+// Version returns the libvips version, empty without libvips.
+func (p *VipsProcessor) Version() string {
+	return ""
+}
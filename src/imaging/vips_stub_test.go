@@ -0,0 +1,19 @@
+//go:build !vips
+
+package imaging
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStart_VipsFallback(t *testing.T) {
+	// Arrange
+	t.Setenv("IMAGE_BACKEND", BackendVips)
+	t.Cleanup(func() { SetProcessor(GoProcessor{}) })
+
+	// Act & Assert
+	require.NoError(t, Start())
+	require.Equal(t, BackendGo, Backend())
+}
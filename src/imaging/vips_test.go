@@ -0,0 +1,80 @@
+//go:build vips
+
+package imaging
+
+import (
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writePNG(t *testing.T, path string, width, height int) {
+	t.Helper()
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+	require.NoError(t, png.Encode(f, image.NewRGBA(image.Rect(0, 0, width, height))))
+}
+
+func imageSize(t *testing.T, path string) (int, int) {
+	t.Helper()
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	config, _, err := image.DecodeConfig(f)
+	require.NoError(t, err)
+	return config.Width, config.Height
+}
+
+func TestVipsSize(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "cat.png")
+	writePNG(t, src, 400, 200)
+
+	width, height, err := vipsSize(src, Options{Width: 200})
+	require.NoError(t, err)
+	require.Equal(t, 200, width)
+	require.Equal(t, 100, height)
+
+	width, height, err = vipsSize(src, Options{Height: 50})
+	require.NoError(t, err)
+	require.Equal(t, 100, width)
+	require.Equal(t, 50, height)
+}
+
+func TestVipsProcessor(t *testing.T) {
+	p, err := NewVipsProcessor()
+	require.NoError(t, err)
+	src := filepath.Join(t.TempDir(), "cat.png")
+	writePNG(t, src, 400, 200)
+
+	dst := filepath.Join(t.TempDir(), "cat.jpg")
+	require.NoError(t, p.ProcessFile(src, dst+".tmp", Options{Width: 100, Height: 100, Fit: FitContain, Format: "jpg"}))
+	require.NoError(t, os.Rename(dst+".tmp", dst))
+	width, height := imageSize(t, dst)
+	require.Equal(t, 100, width)
+	require.Equal(t, 50, height)
+
+	require.NoError(t, p.ProcessFile(src, src, Options{Width: 100, Height: 100, Fit: FitCover}))
+	width, height = imageSize(t, src)
+	require.Equal(t, 100, width)
+	require.Equal(t, 100, height)
+}
+
+func TestVipsProcessor_Fallback(t *testing.T) {
+	p, err := NewVipsProcessor()
+	require.NoError(t, err)
+	src := filepath.Join(t.TempDir(), "cat.png")
+	writePNG(t, src, 400, 200)
+
+	// libvips cannot crop towards an edge, leaving the work to Go
+	require.False(t, vipsGravity(Options{Fit: FitCover, Gravity: GravityNorth}))
+	require.NoError(t, p.ProcessFile(src, src, Options{Width: 100, Height: 100, Fit: FitCover, Gravity: GravityNorth}))
+	width, height := imageSize(t, src)
+	require.Equal(t, 100, width)
+	require.Equal(t, 100, height)
+	require.True(t, p.Saves("png"))
+}
@@ -0,0 +1,395 @@
+// Package importer ingests existing file trees, e.g. the files of a previous
+// CDN, through the same validation and duplicate detection as uploads. The
+// CDN has no folders, so the relative path of a file is kept in its name,
+// with the folders joined by "-": photos/2023/cat.png becomes
+// photos-2023-cat.png.
+//
+// Directories written by the export command carry a manifest, see package
+// portable. The files listed there keep their name, UUID, owner, timestamps
+// and expiry, and are checked against their SHA-256.
+package importer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/portable"
+	"github.com/kevinanielsen/go-fast-cdn/src/search"
+	"github.com/kevinanielsen/go-fast-cdn/src/usage"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/kevinanielsen/go-fast-cdn/src/validations"
+	"gorm.io/gorm"
+)
+
+// Outcomes of importing a file.
+const (
+	OutcomeImported  = "imported"
+	OutcomeDuplicate = "duplicate"
+	OutcomeSkipped   = "skipped"
+	OutcomeFailed    = "failed"
+)
+
+// Result is the outcome of importing one file. In a dry run, files that
+// would be imported have OutcomeImported.
+type Result struct {
+	Path     string `json:"path"`
+	FileName string `json:"file_name,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Outcome  string `json:"outcome"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// Summary counts the outcomes of a run. Resumed counts the files handled by
+// a previous run with the same journal, which are not imported again.
+type Summary struct {
+	Total      int `json:"total"`
+	Done       int `json:"done"`
+	Resumed    int `json:"resumed"`
+	Imported   int `json:"imported"`
+	Duplicates int `json:"duplicates"`
+	Skipped    int `json:"skipped"`
+	Failed     int `json:"failed"`
+}
+
+func (s *Summary) add(result Result) {
+	s.Done++
+	switch result.Outcome {
+	case OutcomeImported:
+		s.Imported++
+	case OutcomeDuplicate:
+		s.Duplicates++
+	case OutcomeSkipped:
+		s.Skipped++
+	case OutcomeFailed:
+		s.Failed++
+	}
+}
+
+// Importer imports the files of a directory.
+type Importer struct {
+	Images     models.ImageRepository
+	Docs       models.DocRepository
+	SearchRepo models.SearchRepository
+	// DryRun reports what would be imported without changing anything.
+	DryRun bool
+	// OrganizationID owns the imported files, if set.
+	OrganizationID *uint
+	// Organizations, if set, is used to give the files of a manifest the
+	// organization of the same name as their owner, if there is one, instead
+	// of OrganizationID.
+	Organizations models.OrganizationRepository
+	// Journal is the path of the file recording the outcome of every file,
+	// if set. Files recorded there by a previous run, except failed ones,
+	// are not imported again, so an interrupted import can be resumed.
+	Journal string
+}
+
+// Run imports the regular files below dir, calling progress, if not nil,
+// after each one.
+func (im *Importer) Run(ctx context.Context, dir string, progress func(Summary, Result)) (Summary, error) {
+	var paths []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return Summary{}, err
+	}
+
+	entries, orgIDs, err := im.readManifest(ctx, dir)
+	if err != nil {
+		return Summary{}, err
+	}
+	if entries != nil {
+		manifest := filepath.Join(dir, portable.ManifestName)
+		for i, path := range paths {
+			if path == manifest {
+				paths = append(paths[:i], paths[i+1:]...)
+				break
+			}
+		}
+	}
+
+	var done map[string]bool
+	var journal *os.File
+	if im.Journal != "" && !im.DryRun {
+		if done, err = readJournal(im.Journal); err != nil {
+			return Summary{}, err
+		}
+		if journal, err = os.OpenFile(im.Journal, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644); err != nil {
+			return Summary{}, err
+		}
+		defer journal.Close()
+	}
+
+	summary := Summary{Total: len(paths)}
+	planned := newDryRunPlan()
+	for _, path := range paths {
+		if err := ctx.Err(); err != nil {
+			return summary, err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		rel = filepath.ToSlash(rel)
+		if done[rel] {
+			summary.Done++
+			summary.Resumed++
+			continue
+		}
+
+		var entry *portable.Entry
+		if e, ok := entries[rel]; ok {
+			entry = &e
+		}
+		result := im.importFile(ctx, path, rel, entry, orgIDs, planned)
+		summary.add(result)
+		if journal != nil {
+			if err := appendJournal(journal, result); err != nil {
+				return summary, err
+			}
+		}
+		if progress != nil {
+			progress(summary, result)
+		}
+	}
+	return summary, nil
+}
+
+// readManifest returns the entries of the manifest in dir by path, or nil if
+// there is none, and the IDs of the organizations named in it by name.
+func (im *Importer) readManifest(ctx context.Context, dir string) (map[string]portable.Entry, map[string]uint, error) {
+	manifest, err := portable.ReadManifest(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	entries := map[string]portable.Entry{}
+	for _, entry := range manifest.Files {
+		entries[entry.Path] = entry
+	}
+	orgIDs := map[string]uint{}
+	if im.Organizations != nil {
+		orgs, err := im.Organizations.GetAllOrganizations(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, org := range orgs {
+			orgIDs[org.Name] = org.ID
+		}
+	}
+	return entries, orgIDs, nil
+}
+
+// FileName returns the name a file at the relative path rel is imported as
+func FileName(rel string) string {
+	return strings.ReplaceAll(filepath.ToSlash(rel), "/", "-")
+}
+
+// dryRunPlan remembers the files a dry run would have imported, which are
+// not in the database, to report the duplicates among them.
+type dryRunPlan struct {
+	checksums map[string]string
+	names     map[string]bool
+}
+
+func newDryRunPlan() *dryRunPlan {
+	return &dryRunPlan{checksums: map[string]string{}, names: map[string]bool{}}
+}
+
+// record is the metadata a file is stored with
+type record struct {
+	fileName  string
+	checksum  []byte
+	algorithm string
+	orgID     *uint
+	uuid      string
+	createdAt time.Time
+	expiresAt *time.Time
+}
+
+func (im *Importer) importFile(ctx context.Context, path, rel string, entry *portable.Entry, orgIDs map[string]uint, planned *dryRunPlan) Result {
+	result := Result{Path: rel, FileName: FileName(rel)}
+	if entry != nil {
+		result.FileName = entry.FileName
+	}
+	skip := func(outcome, reason string) Result {
+		result.Outcome, result.Reason = outcome, reason
+		return result
+	}
+
+	fileName, err := util.FilterFilename(result.FileName)
+	if err != nil {
+		return skip(OutcomeSkipped, err.Error())
+	}
+	result.FileName = fileName
+
+	f, err := os.Open(path)
+	if err != nil {
+		return skip(OutcomeFailed, err.Error())
+	}
+	header := make([]byte, 512)
+	n, err := io.ReadFull(f, header)
+	f.Close()
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return skip(OutcomeFailed, err.Error())
+	}
+	if n == 0 {
+		return skip(OutcomeSkipped, "empty file")
+	}
+
+	if validations.ValidateContentType(models.MediaTypeImage, fileName, header[:n]) == nil {
+		result.Type = models.MediaTypeImage
+	} else if err := validations.ValidateContentType(models.MediaTypeDoc, fileName, header[:n]); err == nil {
+		result.Type = models.MediaTypeDoc
+	} else {
+		return skip(OutcomeSkipped, err.Error())
+	}
+	// Sanitizing would change the content the manifest checksums
+	if validations.RequiresSanitizing(fileName) {
+		return skip(OutcomeSkipped, "files of this type must be uploaded to be sanitized")
+	}
+
+	rec := record{fileName: fileName, orgID: im.OrganizationID}
+	if entry != nil {
+		sum, err := sha256File(path)
+		if err != nil {
+			return skip(OutcomeFailed, err.Error())
+		}
+		if sum != entry.SHA256 {
+			return skip(OutcomeFailed, "content does not match the SHA-256 in the manifest")
+		}
+		if id, ok := orgIDs[entry.Organization]; ok && entry.Organization != "" {
+			rec.orgID = &id
+		}
+		rec.uuid, rec.createdAt, rec.expiresAt = entry.UUID, entry.CreatedAt, entry.ExpiresAt
+	}
+
+	// The checksum is computed like for uploads through the API, so that
+	// duplicates are detected across both
+	rec.algorithm = util.ChecksumAlgorithm()
+	checksum, err := util.FileChecksum(rec.algorithm, path)
+	if err != nil {
+		return skip(OutcomeFailed, err.Error())
+	}
+	rec.checksum = checksum
+	duplicate, err := im.nameByChecksum(ctx, result.Type, checksum)
+	if err == nil {
+		return skip(OutcomeDuplicate, "same content as "+duplicate)
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return skip(OutcomeFailed, err.Error())
+	}
+	if _, err := os.Stat(filepath.Join(util.ExPath, "uploads", models.MediaFolder(result.Type), fileName)); err == nil {
+		return skip(OutcomeSkipped, "a file named "+fileName+" already exists")
+	}
+
+	if im.DryRun {
+		key := result.Type + "/" + string(checksum)
+		if duplicate, ok := planned.checksums[key]; ok {
+			return skip(OutcomeDuplicate, "same content as "+duplicate)
+		}
+		if planned.names[result.Type+"/"+fileName] {
+			return skip(OutcomeSkipped, "a file named "+fileName+" already exists")
+		}
+		planned.checksums[key] = fileName
+		planned.names[result.Type+"/"+fileName] = true
+		return skip(OutcomeImported, "")
+	}
+	if err := im.store(ctx, result.Type, rec, path); err != nil {
+		return skip(OutcomeFailed, err.Error())
+	}
+	return skip(OutcomeImported, "")
+}
+
+func (im *Importer) nameByChecksum(ctx context.Context, mediaType string, checksum []byte) (string, error) {
+	if mediaType == models.MediaTypeImage {
+		image, err := im.Images.GetImageByCheckSum(ctx, checksum)
+		return image.FileName, err
+	}
+	doc, err := im.Docs.GetDocByCheckSum(ctx, checksum)
+	return doc.FileName, err
+}
+
+// store records the file and copies it into the uploads folder
+func (im *Importer) store(ctx context.Context, mediaType string, rec record, path string) error {
+	fileName := rec.fileName
+	model := gorm.Model{CreatedAt: rec.createdAt}
+	var err error
+	if mediaType == models.MediaTypeImage {
+		_, err = im.Images.AddImage(ctx, models.Image{Model: model, UUID: rec.uuid, FileName: fileName, Checksum: rec.checksum, ChecksumAlgorithm: rec.algorithm, OrganizationID: rec.orgID, ExpiresAt: rec.expiresAt})
+	} else {
+		_, err = im.Docs.AddDoc(ctx, models.Doc{Model: model, UUID: rec.uuid, FileName: fileName, Checksum: rec.checksum, ChecksumAlgorithm: rec.algorithm, OrganizationID: rec.orgID, ExpiresAt: rec.expiresAt})
+	}
+	if err != nil {
+		return err
+	}
+
+	dest := filepath.Join(util.ExPath, "uploads", models.MediaFolder(mediaType), fileName)
+	err = usage.Track(mediaType, rec.orgID, fileName, func() error {
+		return copyFile(path, dest)
+	})
+	if err != nil {
+		if mediaType == models.MediaTypeImage {
+			im.Images.DeleteImage(ctx, fileName)
+		} else {
+			im.Docs.DeleteDoc(ctx, fileName)
+		}
+		return fmt.Errorf("failed to copy file: %w", err)
+	}
+
+	if mediaType == models.MediaTypeDoc {
+		if err := search.IndexDoc(ctx, im.SearchRepo, fileName); err != nil {
+			log.Printf("Failed to index document %s: %s", fileName, err.Error())
+		}
+	}
+	return nil
+}
+
+func sha256File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func copyFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dest, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dest)
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,146 @@
+package importer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/portable"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/stretchr/testify/require"
+)
+
+var png = append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{1}, 600)...)
+
+func writeTree(t *testing.T, files map[string][]byte) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, data := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, data, 0o644))
+	}
+	return dir
+}
+
+func newImporter(t *testing.T) *Importer {
+	t.Helper()
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	for _, folder := range []string{"images", "docs"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(util.ExPath, "uploads", folder), 0o755))
+	}
+	return &Importer{
+		Images:     database.NewImageRepo(database.DB),
+		Docs:       database.NewDocRepo(database.DB),
+		SearchRepo: database.NewSearchRepo(database.DB),
+		Journal:    filepath.Join(t.TempDir(), "journal.jsonl"),
+	}
+}
+
+func TestImporter_Run(t *testing.T) {
+	src := writeTree(t, map[string][]byte{
+		"photos/2023/cat.png": png,
+		"photos/copy.png":     png,
+		"notes/recipe.txt":    []byte("flour and sugar"),
+		"bin/tool.exe":        {0x4d, 0x5a, 0x90, 0x00, 0x03},
+		"my.old.photo.png":    png,
+	})
+	im := newImporter(t)
+	ctx := context.Background()
+
+	im.DryRun = true
+	summary, err := im.Run(ctx, src, nil)
+	require.NoError(t, err)
+	require.Equal(t, Summary{Total: 5, Done: 5, Imported: 2, Duplicates: 1, Skipped: 2}, summary)
+	require.NoFileExists(t, filepath.Join(util.ExPath, "uploads", "images", "photos-2023-cat.png"))
+	require.NoFileExists(t, im.Journal)
+
+	im.DryRun = false
+	summary, err = im.Run(ctx, src, nil)
+	require.NoError(t, err)
+	require.Equal(t, Summary{Total: 5, Done: 5, Imported: 2, Duplicates: 1, Skipped: 2}, summary)
+	require.FileExists(t, filepath.Join(util.ExPath, "uploads", "images", "photos-2023-cat.png"))
+	require.FileExists(t, filepath.Join(util.ExPath, "uploads", "docs", "notes-recipe.txt"))
+	_, err = im.Images.GetImageByFileName(ctx, "photos-2023-cat.png")
+	require.NoError(t, err)
+	results, err := im.SearchRepo.Search(ctx, "flour", 10)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+
+	// A second run resumes from the journal instead of importing again
+	summary, err = im.Run(ctx, src, nil)
+	require.NoError(t, err)
+	require.Equal(t, Summary{Total: 5, Done: 5, Resumed: 5}, summary)
+}
+
+func TestImporter_RetriesFailures(t *testing.T) {
+	src := writeTree(t, map[string][]byte{"cat.png": png})
+	im := newImporter(t)
+
+	require.NoError(t, os.WriteFile(im.Journal, []byte(`{"path":"cat.png","outcome":"failed","reason":"disk full"}`+"\n"+`{"path":"cut sh`), 0o644))
+	summary, err := im.Run(context.Background(), src, nil)
+	require.NoError(t, err)
+	require.Equal(t, 1, summary.Imported)
+}
+
+func TestImporter_Manifest(t *testing.T) {
+	other := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{2}, 600)...)
+	sum := sha256.Sum256(png)
+	manifest, err := json.Marshal(portable.Manifest{
+		Version: portable.ManifestVersion,
+		Files: []portable.Entry{
+			{Path: "images/logo.png", Type: "image", FileName: "logo.png", UUID: "uuid-1", SHA256: hex.EncodeToString(sum[:]), Organization: "Acme", CreatedAt: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+			{Path: "images/tampered.png", Type: "image", FileName: "tampered.png", SHA256: hex.EncodeToString(sum[:])},
+		},
+	})
+	require.NoError(t, err)
+	src := writeTree(t, map[string][]byte{
+		"images/logo.png":     png,
+		"images/tampered.png": other,
+		portable.ManifestName: manifest,
+	})
+	im := newImporter(t)
+	im.Organizations = database.NewOrganizationRepo(database.DB)
+	org := models.Organization{Name: "Acme"}
+	require.NoError(t, database.DB.Create(&org).Error)
+	ctx := context.Background()
+
+	summary, err := im.Run(ctx, src, nil)
+	require.NoError(t, err)
+	require.Equal(t, Summary{Total: 2, Done: 2, Imported: 1, Failed: 1}, summary)
+
+	// Files listed in the manifest keep their name and metadata
+	image, err := im.Images.GetImageByFileName(ctx, "logo.png")
+	require.NoError(t, err)
+	require.Equal(t, "uuid-1", image.UUID)
+	require.Equal(t, org.ID, *image.OrganizationID)
+	require.Equal(t, 2020, image.CreatedAt.Year())
+}
+
+func TestJobs_Resolve(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(root, "old-cdn"), 0o755))
+	jobs := NewJobs(root, t.TempDir(), nil, nil, nil)
+
+	dir, err := jobs.resolve("old-cdn")
+	require.NoError(t, err)
+	require.Equal(t, "old-cdn", filepath.Base(dir))
+
+	_, err = jobs.resolve("..")
+	require.ErrorIs(t, err, ErrOutsideRoot)
+	_, err = jobs.resolve(t.TempDir())
+	require.ErrorIs(t, err, ErrOutsideRoot)
+
+	jobs.Root = ""
+	_, err = jobs.resolve("old-cdn")
+	require.ErrorIs(t, err, ErrDisabled)
+}
@@ -0,0 +1,229 @@
+package importer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+)
+
+// Job states.
+const (
+	StatusRunning = "running"
+	StatusDone    = "done"
+	StatusFailed  = "failed"
+)
+
+// maxProblems is the number of skipped and failed files kept per job
+const maxProblems = 100
+
+var (
+	ErrDisabled       = errors.New("imports are disabled, set IMPORT_ROOT to enable them")
+	ErrOutsideRoot    = errors.New("directory is not inside IMPORT_ROOT")
+	ErrAlreadyRunning = errors.New("the directory is already being imported")
+	ErrJobNotFound    = errors.New("import not found")
+)
+
+// Job describes an import started through the API and its progress.
+// Problems lists the first files that were skipped or failed.
+type Job struct {
+	ID             string     `json:"id"`
+	Dir            string     `json:"dir"`
+	DryRun         bool       `json:"dry_run"`
+	OrganizationID *uint      `json:"organization_id"`
+	RequestedBy    string     `json:"requested_by"`
+	Status         string     `json:"status"`
+	Summary        Summary    `json:"summary"`
+	Problems       []Result   `json:"problems"`
+	Error          string     `json:"error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	FinishedAt     *time.Time `json:"finished_at"`
+}
+
+// Jobs runs imports of directories inside Root in the background. Each
+// directory has its own journal in JournalDir, so importing it again resumes
+// where the last import stopped.
+type Jobs struct {
+	Root       string
+	JournalDir string
+	Images     models.ImageRepository
+	Docs       models.DocRepository
+	SearchRepo models.SearchRepository
+	// Organizations, if set, maps the owners in manifests to organizations,
+	// see Importer.Organizations.
+	Organizations models.OrganizationRepository
+
+	mu   sync.Mutex
+	jobs map[string]*Job
+}
+
+func NewJobs(root, journalDir string, images models.ImageRepository, docs models.DocRepository, searchRepo models.SearchRepository) *Jobs {
+	return &Jobs{
+		Root:       root,
+		JournalDir: journalDir,
+		Images:     images,
+		Docs:       docs,
+		SearchRepo: searchRepo,
+		jobs:       map[string]*Job{},
+	}
+}
+
+// NewDefaultJobs returns Jobs importing from IMPORT_ROOT into the application
+// database, with the journals next to the database file.
+func NewDefaultJobs() *Jobs {
+	jobs := NewJobs(
+		os.Getenv("IMPORT_ROOT"),
+		filepath.Join(util.ExPath, database.DbFolder, "imports"),
+		database.NewImageRepo(database.DB),
+		database.NewDocRepo(database.DB),
+		database.NewSearchRepo(database.DB),
+	)
+	jobs.Organizations = database.NewOrganizationRepo(database.DB)
+	return jobs
+}
+
+// JournalPath returns the path of the journal of importing the directory at
+// the absolute path dir, in journalDir.
+func JournalPath(journalDir, dir string) string {
+	sum := sha256.Sum256([]byte(dir))
+	return filepath.Join(journalDir, hex.EncodeToString(sum[:8])+".jsonl")
+}
+
+// resolve returns the absolute path of dir, which may be relative to Root,
+// after checking it is a directory inside Root.
+func (j *Jobs) resolve(dir string) (string, error) {
+	if j.Root == "" {
+		return "", ErrDisabled
+	}
+	root, err := filepath.EvalSymlinks(j.Root)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(root, dir)
+	}
+	dir, err = filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+	if rel, err := filepath.Rel(root, dir); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", ErrOutsideRoot
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", errors.New(dir + " is not a directory")
+	}
+	return dir, nil
+}
+
+// Start begins importing dir in the background
+func (j *Jobs) Start(dir string, dryRun bool, orgID *uint, requestedBy string) (Job, error) {
+	dir, err := j.resolve(dir)
+	if err != nil {
+		return Job{}, err
+	}
+	if err := os.MkdirAll(j.JournalDir, 0o755); err != nil {
+		return Job{}, err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, job := range j.jobs {
+		if job.Dir == dir && job.Status == StatusRunning {
+			return Job{}, ErrAlreadyRunning
+		}
+	}
+
+	job := &Job{
+		ID:             uuid.NewString(),
+		Dir:            dir,
+		DryRun:         dryRun,
+		OrganizationID: orgID,
+		RequestedBy:    requestedBy,
+		Status:         StatusRunning,
+		Problems:       []Result{},
+		CreatedAt:      time.Now(),
+	}
+	j.jobs[job.ID] = job
+
+	im := &Importer{
+		Images:         j.Images,
+		Docs:           j.Docs,
+		SearchRepo:     j.SearchRepo,
+		Organizations:  j.Organizations,
+		DryRun:         dryRun,
+		OrganizationID: orgID,
+		Journal:        JournalPath(j.JournalDir, dir),
+	}
+	go j.run(job, im)
+
+	return *job, nil
+}
+
+func (j *Jobs) run(job *Job, im *Importer) {
+	summary, err := im.Run(context.Background(), job.Dir, func(summary Summary, result Result) {
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		job.Summary = summary
+		if (result.Outcome == OutcomeSkipped || result.Outcome == OutcomeFailed) && len(job.Problems) < maxProblems {
+			job.Problems = append(job.Problems, result)
+		}
+	})
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now()
+	job.Summary = summary
+	job.FinishedAt = &now
+	job.Status = StatusDone
+	if err != nil {
+		job.Status = StatusFailed
+		job.Error = err.Error()
+	}
+}
+
+// Get returns the import with the given ID
+func (j *Jobs) Get(id string) (Job, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	job, ok := j.jobs[id]
+	if !ok {
+		return Job{}, ErrJobNotFound
+	}
+	return copyJob(job), nil
+}
+
+// List returns every import since the server started, newest first
+func (j *Jobs) List() []Job {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	jobs := make([]Job, 0, len(j.jobs))
+	for _, job := range j.jobs {
+		jobs = append(jobs, copyJob(job))
+	}
+	sort.Slice(jobs, func(a, b int) bool {
+		return jobs[a].CreatedAt.After(jobs[b].CreatedAt)
+	})
+	return jobs
+}
+
+// copyJob copies job so it can be read while the import updates it
+func copyJob(job *Job) Job {
+	c := *job
+	c.Problems = append([]Result{}, job.Problems...)
+	return c
+}
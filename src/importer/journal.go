@@ -0,0 +1,43 @@
+package importer
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+)
+
+// readJournal returns the relative paths of the files a previous run
+// finished, i.e. did not fail on.
+func readJournal(path string) (map[string]bool, error) {
+	done := map[string]bool{}
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return done, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var result Result
+		// A line cut short by a crash is ignored; its file is retried
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			continue
+		}
+		done[result.Path] = result.Outcome != OutcomeFailed
+	}
+	return done, scanner.Err()
+}
+
+// appendJournal records the result as a JSON line
+func appendJournal(f *os.File, result Result) error {
+	line, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
@@ -0,0 +1,99 @@
+package initializers
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// Step is one part of the startup of the server.
+type Step struct {
+	Name string
+	// After lists the names of the steps that must finish before this one
+	// starts.
+	After []string
+	Run   func() error
+}
+
+type stepResult struct {
+	name    string
+	err     error
+	elapsed time.Duration
+}
+
+// Bootstrap runs steps in the order given by their dependencies, running the
+// steps that don't depend on each other in parallel, and logs how long each
+// one took. It stops starting steps after the first failure and returns its
+// error once the running ones have finished.
+func Bootstrap(steps []Step) error {
+	byName := make(map[string]Step, len(steps))
+	for _, step := range steps {
+		if _, ok := byName[step.Name]; ok {
+			return fmt.Errorf("duplicate startup step %q", step.Name)
+		}
+		byName[step.Name] = step
+	}
+	for _, step := range steps {
+		for _, dep := range step.After {
+			if _, ok := byName[dep]; !ok {
+				return fmt.Errorf("startup step %q depends on unknown step %q", step.Name, dep)
+			}
+		}
+	}
+
+	start := time.Now()
+	done := map[string]bool{}
+	started := map[string]bool{}
+	results := make(chan stepResult)
+	running := 0
+	var failed error
+
+	for {
+		if failed == nil {
+			for _, step := range steps {
+				if started[step.Name] || !ready(step, done) {
+					continue
+				}
+				started[step.Name] = true
+				running++
+				go func(step Step) {
+					stepStart := time.Now()
+					err := step.Run()
+					results <- stepResult{step.Name, err, time.Since(stepStart)}
+				}(step)
+			}
+		}
+		if running == 0 {
+			break
+		}
+
+		result := <-results
+		running--
+		if result.err != nil {
+			if failed == nil {
+				failed = fmt.Errorf("%s: %w", result.name, result.err)
+			}
+			continue
+		}
+		done[result.name] = true
+		log.Printf("Startup: %s took %s", result.name, result.elapsed.Round(time.Millisecond))
+	}
+
+	if failed != nil {
+		return failed
+	}
+	if len(done) < len(steps) {
+		return fmt.Errorf("startup steps have circular dependencies")
+	}
+	log.Printf("Startup finished in %s", time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+func ready(step Step, done map[string]bool) bool {
+	for _, dep := range step.After {
+		if !done[dep] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,65 @@
+package initializers
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBootstrap_Order(t *testing.T) {
+	var mu sync.Mutex
+	var order []string
+	record := func(name string) func() error {
+		return func() error {
+			mu.Lock()
+			defer mu.Unlock()
+			order = append(order, name)
+			return nil
+		}
+	}
+
+	err := Bootstrap([]Step{
+		{Name: "migrations", After: []string{"database"}, Run: record("migrations")},
+		{Name: "database", After: []string{"environment"}, Run: record("database")},
+		{Name: "folders", After: []string{"environment"}, Run: record("folders")},
+		{Name: "environment", Run: record("environment")},
+	})
+	require.NoError(t, err)
+	require.Len(t, order, 4)
+	require.Equal(t, "environment", order[0])
+	require.Less(t, indexOf(order, "database"), indexOf(order, "migrations"))
+}
+
+func TestBootstrap_Failure(t *testing.T) {
+	ran := false
+	err := Bootstrap([]Step{
+		{Name: "database", Run: func() error { return errors.New("locked") }},
+		{Name: "migrations", After: []string{"database"}, Run: func() error {
+			ran = true
+			return nil
+		}},
+	})
+	require.EqualError(t, err, "database: locked")
+	require.False(t, ran)
+}
+
+func TestBootstrap_InvalidSteps(t *testing.T) {
+	noop := func() error { return nil }
+	require.Error(t, Bootstrap([]Step{{Name: "a", Run: noop}, {Name: "a", Run: noop}}))
+	require.Error(t, Bootstrap([]Step{{Name: "a", After: []string{"b"}, Run: noop}}))
+	require.Error(t, Bootstrap([]Step{
+		{Name: "a", After: []string{"b"}, Run: noop},
+		{Name: "b", After: []string{"a"}, Run: noop},
+	}))
+}
+
+func indexOf(names []string, name string) int {
+	for i, n := range names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
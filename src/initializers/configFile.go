@@ -0,0 +1,359 @@
+package initializers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"gopkg.in/yaml.v3"
+)
+
+// configFileNames are the files FindConfigFile looks for, in order.
+var configFileNames = []string{"config.yaml", "config.yml", "config.json"}
+
+// Kinds of values of environment variables.
+const (
+	kindString = iota
+	kindInt
+	kindFloat
+	kindBool
+	// kindList is a comma separated list, which config files may also give
+	// as a sequence.
+	kindList
+)
+
+type variable struct {
+	kind int
+	// options lists the allowed values, if restricted.
+	options []string
+}
+
+// variables is the schema of config files: the environment variables read
+// by the server and the kind of their values.
+var variables = map[string]variable{
+	"PORT":                         {kind: kindInt},
+	"PUBLIC_ADDR":                  {kind: kindString},
+	"ADMIN_ADDR":                   {kind: kindString},
+	"LISTEN_SOCKET":                {kind: kindString},
+	"LISTEN_SOCKET_MODE":           {kind: kindString},
+	"LISTEN_SOCKET_PROXY_PROTOCOL": {kind: kindBool},
+	"TRUSTED_PROXIES":              {kind: kindList},
+	"DB_SECRET":                    {kind: kindString},
+	"DB_MAX_OPEN_CONNS":            {kind: kindInt},
+	"DB_MAX_IDLE_CONNS":            {kind: kindInt},
+	"DB_CONN_MAX_LIFETIME":         {kind: kindInt},
+	"DB_READ_REPLICAS":             {kind: kindList},
+
+	"JWT_SECRET":               {kind: kindString},
+	"JWT_EXPIRES_IN":           {kind: kindInt},
+	"REFRESH_TOKEN_EXPIRES_IN": {kind: kindInt},
+	"AUTH_COOKIE_MODE":         {kind: kindBool},
+	"AUTH_RATE_LIMIT":          {kind: kindInt},
+	"MAX_AUTH_BODY_SIZE":       {kind: kindInt},
+	"MAX_UPLOAD_BODY_SIZE":     {kind: kindInt},
+	"MIN_FREE_DISK_SPACE":      {kind: kindInt},
+	"MAX_CONCURRENT_UPLOADS":   {kind: kindInt},
+	"UPLOAD_QUEUE_TIMEOUT":     {kind: kindInt},
+
+	"BACKUP_SCHEDULE":                      {kind: kindString},
+	"BACKUP_RETENTION_COUNT":               {kind: kindInt},
+	"BACKUP_RETENTION_DAYS":                {kind: kindInt},
+	"BACKUP_INCLUDE_FILES":                 {kind: kindBool},
+	"BACKUP_TARGETS":                       {kind: kindList},
+	"BACKUP_S3_ENDPOINT":                   {kind: kindString},
+	"BACKUP_S3_REGION":                     {kind: kindString},
+	"BACKUP_S3_ACCESS_KEY_ID":              {kind: kindString},
+	"BACKUP_S3_SECRET_ACCESS_KEY":          {kind: kindString},
+	"BACKUP_S3_USE_SSL":                    {kind: kindBool},
+	"BACKUP_SFTP_PASSWORD":                 {kind: kindString},
+	"BACKUP_SFTP_KEY_FILE":                 {kind: kindString},
+	"BACKUP_SFTP_KNOWN_HOSTS":              {kind: kindString},
+	"BACKUP_SFTP_INSECURE_IGNORE_HOST_KEY": {kind: kindBool},
+
+	"TRANSFORM_SIGNING_KEY": {kind: kindString},
+	"IMAGE_BACKEND":         {kind: kindString, options: []string{"go", "vips"}},
+	"CLIENT_HINT_WIDTHS":    {kind: kindList},
+	"SAVE_DATA_QUALITY":     {kind: kindInt},
+	"SAVE_DATA_ECT":         {kind: kindList},
+
+	"OPTIMIZE_ON_UPLOAD":     {kind: kindBool},
+	"OPTIMIZE_QUALITY":       {kind: kindInt},
+	"OPTIMIZE_MAX_DIMENSION": {kind: kindInt},
+
+	"AUDIT_SIEM_URL":         {kind: kindString},
+	"AUDIT_SIEM_FORMAT":      {kind: kindString, options: []string{"json", "cef"}},
+	"AUDIT_SIEM_AUTH_HEADER": {kind: kindString},
+	"AUDIT_SIEM_BUFFER_SIZE": {kind: kindInt},
+	"ALERT_WEBHOOK_URL":      {kind: kindString},
+	"EVENTS_BUS_URL":         {kind: kindString},
+	"EVENTS_BUS_SUBJECT":     {kind: kindString},
+	"EVENTS_BUS_TYPES":       {kind: kindList},
+	"EVENTS_BUS_AUTH_HEADER": {kind: kindString},
+	"EVENTS_BUS_CA_FILE":     {kind: kindString},
+	"EVENTS_BUS_BUFFER_SIZE": {kind: kindInt},
+	"UPLOAD_HOOK_COMMANDS":   {kind: kindList},
+	"UPLOAD_HOOK_TIMEOUT":    {kind: kindInt},
+	"POLICY_FILE":            {kind: kindString},
+
+	"TLS_CERT_FILE":          {kind: kindString},
+	"TLS_KEY_FILE":           {kind: kindString},
+	"TLS_AUTOCERT_DOMAINS":   {kind: kindList},
+	"TLS_AUTOCERT_EMAIL":     {kind: kindString},
+	"TLS_AUTOCERT_CACHE_DIR": {kind: kindString},
+	"TLS_REDIRECT_ADDR":      {kind: kindString},
+
+	"PASTE_UPLOAD_PRESET":   {kind: kindString},
+	"MEDIA_EXPIRY_INTERVAL": {kind: kindInt},
+
+	"CACHE_MEMORY_SIZE":             {kind: kindInt},
+	"CACHE_MAX_FILE_SIZE":           {kind: kindInt},
+	"CACHE_REDIS_URL":               {kind: kindString},
+	"CACHE_REDIS_TTL":               {kind: kindInt},
+	"METRICS_DOWNLOAD_SAMPLE_RATE":  {kind: kindFloat},
+	"DOWNLOAD_STATS_FLUSH_INTERVAL": {kind: kindInt},
+	"STATE_REDIS_URL":               {kind: kindString},
+
+	"INTEGRITY_MANIFEST_ENABLED": {kind: kindBool},
+	"REQUIRE_IF_MATCH":           {kind: kindBool},
+	"UI_ENABLED":                 {kind: kindBool},
+	"INTEGRITY_CHECK_INTERVAL":   {kind: kindInt},
+	"CHECKSUM_ALGORITHM":         {kind: kindString, options: []string{"md5", "sha256"}},
+	"FILE_NAMING_STRATEGY":       {kind: kindString, options: []string{util.NamingOriginal, util.NamingUUID, util.NamingContentHash, util.NamingSlug}},
+
+	"EXPORT_SIGNING_KEY":       {kind: kindString},
+	"EXPORT_LINK_TTL":          {kind: kindInt},
+	"USAGE_RECONCILE_INTERVAL": {kind: kindInt},
+	"DISK_CHECK_INTERVAL":      {kind: kindInt},
+	"JANITOR_INTERVAL":         {kind: kindInt},
+	"JANITOR_TEMP_MAX_AGE":     {kind: kindInt},
+	"JANITOR_CACHE_MAX_AGE":    {kind: kindInt},
+	"JANITOR_DERIVED_MAX_SIZE": {kind: kindInt},
+	"JANITOR_RENDITION_KINDS":  {kind: kindList},
+	"IMPORT_ROOT":              {kind: kindString},
+
+	"MEDIA_FALLBACKS":               {kind: kindList},
+	"FALLBACK_S3_ENDPOINT":          {kind: kindString},
+	"FALLBACK_S3_REGION":            {kind: kindString},
+	"FALLBACK_S3_ACCESS_KEY_ID":     {kind: kindString},
+	"FALLBACK_S3_SECRET_ACCESS_KEY": {kind: kindString},
+	"FALLBACK_S3_USE_SSL":           {kind: kindBool},
+	"DIRECT_UPLOAD_TTL":             {kind: kindInt},
+
+	"REPLICATION_PRIMARY_URL": {kind: kindString},
+	"REPLICATION_API_KEY":     {kind: kindString},
+	"REPLICATION_INTERVAL":    {kind: kindInt},
+
+	"QUEUE_WORKERS":     {kind: kindInt},
+	"CONVERTER_URL":     {kind: kindString},
+	"CONVERTER_TIMEOUT": {kind: kindInt},
+
+	"BREAKER_FAILURE_THRESHOLD": {kind: kindInt},
+	"BREAKER_COOLDOWN":          {kind: kindInt},
+	"BREAKER_RETRIES":           {kind: kindInt},
+	"BREAKER_BACKOFF":           {kind: kindInt},
+}
+
+// ConfigFile holds the environment variables set by a config file. A config
+// file is a YAML or JSON object mapping variables to values, with an
+// optional "profiles" object of named sets of variables that override them:
+//
+//	PORT: 8080
+//	TRUSTED_PROXIES: [10.0.0.0/8]
+//	profiles:
+//	  dev:
+//	    AUTH_RATE_LIMIT: 0
+//	  prod:
+//	    TLS_AUTOCERT_DOMAINS: [cdn.example.com]
+type ConfigFile struct {
+	Values   map[string]string
+	Profiles map[string]map[string]string
+}
+
+// FindConfigFile returns the path of the config.yaml, config.yml or
+// config.json file in dir, or an empty string if there is none.
+func FindConfigFile(dir string) string {
+	for _, name := range configFileNames {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// ReadConfigFile parses the config file at path and checks it against the
+// schema, returning every problem found.
+func ReadConfigFile(path string) (*ConfigFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	file := &ConfigFile{Values: map[string]string{}, Profiles: map[string]map[string]string{}}
+	var problems []string
+	if len(root.Content) == 0 {
+		return file, nil
+	}
+	doc := root.Content[0]
+	if doc.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s: must be an object", path)
+	}
+	for i := 0; i < len(doc.Content); i += 2 {
+		key, value := doc.Content[i].Value, doc.Content[i+1]
+		if key != "profiles" {
+			problems = append(problems, readVariable(file.Values, key, value)...)
+			continue
+		}
+		if value.Kind != yaml.MappingNode {
+			problems = append(problems, "profiles: must be an object")
+			continue
+		}
+		for j := 0; j < len(value.Content); j += 2 {
+			name, profile := value.Content[j].Value, value.Content[j+1]
+			if profile.Kind != yaml.MappingNode {
+				problems = append(problems, "profiles."+name+": must be an object")
+				continue
+			}
+			values := map[string]string{}
+			for k := 0; k < len(profile.Content); k += 2 {
+				for _, problem := range readVariable(values, profile.Content[k].Value, profile.Content[k+1]) {
+					problems = append(problems, "profiles."+name+"."+problem)
+				}
+			}
+			file.Profiles[name] = values
+		}
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("%s: %s", path, strings.Join(problems, "; "))
+	}
+	return file, nil
+}
+
+// readVariable stores the value of the variable name in values, returning
+// the problems with it.
+func readVariable(values map[string]string, name string, node *yaml.Node) []string {
+	v, ok := variables[name]
+	if !ok {
+		return []string{name + ": unknown variable"}
+	}
+
+	var value string
+	switch {
+	case node.Kind == yaml.ScalarNode && node.Tag == "!!null":
+	case node.Kind == yaml.ScalarNode:
+		value = node.Value
+	case node.Kind == yaml.SequenceNode && v.kind == kindList:
+		items := make([]string, 0, len(node.Content))
+		for _, item := range node.Content {
+			if item.Kind != yaml.ScalarNode {
+				return []string{name + ": list items must be strings"}
+			}
+			items = append(items, item.Value)
+		}
+		value = strings.Join(items, ",")
+	default:
+		return []string{name + ": must be a single value"}
+	}
+
+	if err := v.validate(value); err != nil {
+		return []string{name + ": " + err.Error()}
+	}
+	values[name] = value
+	return nil
+}
+
+// validate returns an error if value is not of the kind or options of v. An
+// empty value leaves the variable unset.
+func (v variable) validate(value string) error {
+	if value == "" {
+		return nil
+	}
+	switch v.kind {
+	case kindInt:
+		if n, err := strconv.Atoi(value); err != nil || n < 0 {
+			return errors.New("must be a non-negative integer")
+		}
+	case kindFloat:
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return errors.New("must be a number")
+		}
+	case kindBool:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return errors.New("must be true or false")
+		}
+	}
+	if len(v.options) > 0 {
+		for _, option := range v.options {
+			if value == option {
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of %s", strings.Join(v.options, ", "))
+	}
+	return nil
+}
+
+// Resolve returns the variables of the file, overridden by those of
+// profile unless it is empty.
+func (f *ConfigFile) Resolve(profile string) (map[string]string, error) {
+	values := map[string]string{}
+	for name, value := range f.Values {
+		values[name] = value
+	}
+	if profile == "" {
+		return values, nil
+	}
+	overrides, ok := f.Profiles[profile]
+	if !ok {
+		names := make([]string, 0, len(f.Profiles))
+		for name := range f.Profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown config profile %q, the config file has: %s", profile, strings.Join(names, ", "))
+	}
+	for name, value := range overrides {
+		values[name] = value
+	}
+	return values, nil
+}
+
+// LoadConfigFile sets the environment variables of the config file at path
+// and profile. Variables already set in the environment keep their value.
+func LoadConfigFile(path, profile string) error {
+	file, err := ReadConfigFile(path)
+	if err != nil {
+		return err
+	}
+	values, err := file.Resolve(profile)
+	if err != nil {
+		return err
+	}
+
+	set := 0
+	for name, value := range values {
+		if _, ok := os.LookupEnv(name); ok || value == "" {
+			continue
+		}
+		if err := os.Setenv(name, value); err != nil {
+			return err
+		}
+		set++
+	}
+	if profile != "" {
+		log.Printf("Loaded %d variables from %s with the %s profile", set, path, profile)
+	} else {
+		log.Printf("Loaded %d variables from %s", set, path)
+	}
+	return nil
+}
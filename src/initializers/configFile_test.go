@@ -0,0 +1,102 @@
+package initializers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func TestReadConfigFile(t *testing.T) {
+	path := writeConfig(t, "config.yaml", `
+PORT: 9000
+LISTEN_SOCKET_MODE: 0660
+TRUSTED_PROXIES: [10.0.0.0/8, 192.168.0.1]
+METRICS_DOWNLOAD_SAMPLE_RATE: 0.5
+CONVERTER_URL:
+profiles:
+  dev:
+    AUTH_RATE_LIMIT: 0
+    PORT: 3000
+  prod:
+    IMAGE_BACKEND: vips
+`)
+	file, err := ReadConfigFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "0660", file.Values["LISTEN_SOCKET_MODE"])
+	require.Equal(t, "10.0.0.0/8,192.168.0.1", file.Values["TRUSTED_PROXIES"])
+
+	values, err := file.Resolve("dev")
+	require.NoError(t, err)
+	require.Equal(t, "3000", values["PORT"])
+	require.Equal(t, "0", values["AUTH_RATE_LIMIT"])
+	require.Equal(t, "0.5", values["METRICS_DOWNLOAD_SAMPLE_RATE"])
+
+	values, err = file.Resolve("")
+	require.NoError(t, err)
+	require.Equal(t, "9000", values["PORT"])
+	require.NotContains(t, values, "AUTH_RATE_LIMIT")
+
+	_, err = file.Resolve("staging")
+	require.ErrorContains(t, err, "dev, prod")
+}
+
+func TestReadConfigFile_JSON(t *testing.T) {
+	path := writeConfig(t, "config.json", `{"PORT": 9000, "BACKUP_INCLUDE_FILES": true, "profiles": {"staging": {"QUEUE_WORKERS": 4}}}`)
+	file, err := ReadConfigFile(path)
+	require.NoError(t, err)
+	values, err := file.Resolve("staging")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"PORT": "9000", "BACKUP_INCLUDE_FILES": "true", "QUEUE_WORKERS": "4"}, values)
+}
+
+func TestReadConfigFile_Invalid(t *testing.T) {
+	path := writeConfig(t, "config.yaml", `
+PORT: eighty
+POTR: 80
+IMAGE_BACKEND: magick
+CLIENT_HINT_WIDTHS: [[320]]
+profiles:
+  prod:
+    AUTH_COOKIE_MODE: maybe
+`)
+	_, err := ReadConfigFile(path)
+	require.Error(t, err)
+	for _, problem := range []string{
+		"PORT: must be a non-negative integer",
+		"POTR: unknown variable",
+		"IMAGE_BACKEND: must be one of go, vips",
+		"CLIENT_HINT_WIDTHS: list items must be strings",
+		"profiles.prod.AUTH_COOKIE_MODE: must be true or false",
+	} {
+		require.ErrorContains(t, err, problem)
+	}
+
+	_, err = ReadConfigFile(writeConfig(t, "config.yaml", "- PORT"))
+	require.ErrorContains(t, err, "must be an object")
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	path := writeConfig(t, "config.yml", "QUEUE_WORKERS: 8\nCONVERTER_TIMEOUT: 30\n")
+	require.Equal(t, path, FindConfigFile(filepath.Dir(path)))
+	require.Equal(t, "", FindConfigFile(t.TempDir()))
+
+	t.Setenv("QUEUE_WORKERS", "2")
+	t.Setenv("CONVERTER_TIMEOUT", "")
+	os.Unsetenv("CONVERTER_TIMEOUT")
+
+	require.NoError(t, LoadConfigFile(path, ""))
+	// The environment takes precedence over the file
+	require.Equal(t, "2", os.Getenv("QUEUE_WORKERS"))
+	require.Equal(t, "30", os.Getenv("CONVERTER_TIMEOUT"))
+
+	require.Error(t, LoadConfigFile(path, "prod"))
+}
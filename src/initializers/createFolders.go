@@ -12,4 +12,5 @@ func CreateFolders() {
 	os.Mkdir(uploadsFolder, 0o755)
 	os.Mkdir(fmt.Sprintf("%v/docs", uploadsFolder), 0o755)
 	os.Mkdir(fmt.Sprintf("%v/images", uploadsFolder), 0o755)
+	os.Mkdir(fmt.Sprintf("%v/renditions", uploadsFolder), 0o755)
 }
@@ -0,0 +1,250 @@
+// Package integrity periodically re-hashes the uploaded files and flags the
+// media records whose file is missing or no longer matches its checksum.
+// Records with an MD5 checksum, which only covers the first 512 bytes, are
+// moved to the configured algorithm once their file has been verified, so
+// switching CHECKSUM_ALGORITHM to sha256 gradually covers every file.
+package integrity
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/alert"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultInterval = 24 * time.Hour
+	batchSize       = 500
+	// maxIssues is the number of issues kept in a report
+	maxIssues = 1000
+)
+
+// ActiveChecker is the checker created by Start.
+var ActiveChecker *Checker
+
+// Issue is a record whose file is missing or corrupted.
+type Issue struct {
+	Type     string `json:"type"`
+	FileName string `json:"file_name"`
+	Status   string `json:"status"`
+}
+
+// Report is the outcome of a check. Upgraded counts the records moved to the
+// configured checksum algorithm.
+type Report struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Checked    int       `json:"checked"`
+	OK         int       `json:"ok"`
+	Missing    int       `json:"missing"`
+	Corrupted  int       `json:"corrupted"`
+	Upgraded   int       `json:"upgraded"`
+	Issues     []Issue   `json:"issues"`
+}
+
+// Status is a snapshot of the checker state exposed to admins.
+type Status struct {
+	// Interval is the number of seconds between checks, 0 when only admins
+	// start them.
+	Interval   int     `json:"interval_seconds"`
+	Running    bool    `json:"running"`
+	LastReport *Report `json:"last_report"`
+	LastError  string  `json:"last_error,omitempty"`
+}
+
+// Checker verifies the files of the image and doc records.
+type Checker struct {
+	db         *gorm.DB
+	uploadsDir string
+	interval   time.Duration
+
+	mu     sync.Mutex
+	status Status
+}
+
+func NewChecker(db *gorm.DB, uploadsDir string) *Checker {
+	return &Checker{db: db, uploadsDir: uploadsDir}
+}
+
+// Start checks the files every INTEGRITY_CHECK_INTERVAL seconds, a day by
+// default; 0 leaves checks to admins. It also rejects an invalid
+// CHECKSUM_ALGORITHM, which would otherwise silently fall back to MD5.
+func Start(db *gorm.DB) error {
+	if err := util.ValidateChecksumAlgorithm(os.Getenv("CHECKSUM_ALGORITHM")); err != nil {
+		return err
+	}
+	interval := defaultInterval
+	if val := os.Getenv("INTEGRITY_CHECK_INTERVAL"); val != "" {
+		parsed, err := strconv.Atoi(val)
+		if err != nil || parsed < 0 {
+			return fmt.Errorf("invalid INTEGRITY_CHECK_INTERVAL %q", val)
+		}
+		interval = time.Duration(parsed) * time.Second
+	}
+
+	c := NewChecker(db, filepath.Join(util.ExPath, "uploads"))
+	c.interval = interval
+	if interval > 0 {
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for range ticker.C {
+				c.Run()
+			}
+		}()
+	}
+	ActiveChecker = c
+	return nil
+}
+
+// Run checks the files and records the report in the status. It does nothing
+// if a check is already running.
+func (c *Checker) Run() {
+	c.mu.Lock()
+	if c.status.Running {
+		c.mu.Unlock()
+		return
+	}
+	c.status.Running = true
+	c.mu.Unlock()
+
+	report, err := c.Check(context.Background())
+	if err == nil && report.Missing+report.Corrupted > 0 {
+		alert.Notify(alert.Alert{
+			Type:    "integrity",
+			Text:    fmt.Sprintf("Integrity check found %d missing and %d corrupted files", report.Missing, report.Corrupted),
+			Details: map[string]any{"issues": report.Issues},
+		})
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.status.Running = false
+	c.status.LastReport = &report
+	c.status.LastError = ""
+	if err != nil {
+		log.Printf("Integrity check failed: %s", err.Error())
+		c.status.LastError = err.Error()
+	}
+}
+
+// Status returns the current checker state.
+func (c *Checker) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	status := c.status
+	status.Interval = int(c.interval / time.Second)
+	return status
+}
+
+// record holds the columns of the images and docs tables a check reads
+type record struct {
+	ID                uint
+	FileName          string
+	Checksum          []byte
+	ChecksumAlgorithm string
+}
+
+// Check re-hashes the file of every record and stores the outcome in its
+// integrity status.
+func (c *Checker) Check(ctx context.Context) (Report, error) {
+	report := Report{StartedAt: time.Now().UTC(), Issues: []Issue{}}
+	algorithm := util.ChecksumAlgorithm()
+	for _, mediaType := range []string{models.MediaTypeImage, models.MediaTypeDoc} {
+		folder := models.MediaFolder(mediaType)
+		var lastID uint
+		for {
+			var records []record
+			err := c.db.WithContext(ctx).Table(folder).Select("id, file_name, checksum, checksum_algorithm").
+				Where("deleted_at IS NULL AND id > ?", lastID).Order("id").Limit(batchSize).Scan(&records).Error
+			if err != nil {
+				return report, err
+			}
+			if len(records) == 0 {
+				break
+			}
+			for _, r := range records {
+				if err := c.check(ctx, mediaType, r, algorithm, &report); err != nil {
+					return report, err
+				}
+			}
+			lastID = records[len(records)-1].ID
+		}
+	}
+	report.FinishedAt = time.Now().UTC()
+	return report, nil
+}
+
+func (c *Checker) check(ctx context.Context, mediaType string, r record, algorithm string, report *Report) error {
+	report.Checked++
+	path := filepath.Join(c.uploadsDir, models.MediaFolder(mediaType), r.FileName)
+	if r.ChecksumAlgorithm == "" {
+		r.ChecksumAlgorithm = models.ChecksumMD5
+	}
+
+	updates := map[string]any{"verified_at": time.Now()}
+	checksum, err := util.FileChecksum(r.ChecksumAlgorithm, path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		updates["integrity_status"] = models.IntegrityStatusMissing
+		report.Missing++
+	case err != nil:
+		return err
+	case !bytes.Equal(checksum, r.Checksum):
+		updates["integrity_status"] = models.IntegrityStatusCorrupted
+		report.Corrupted++
+	default:
+		updates["integrity_status"] = models.IntegrityStatusOK
+		report.OK++
+		if r.ChecksumAlgorithm != algorithm {
+			upgraded, err := util.FileChecksum(algorithm, path)
+			if err != nil {
+				return err
+			}
+			// A new updated_at lets replicas pick up the new checksum
+			updates["checksum"] = upgraded
+			updates["checksum_algorithm"] = algorithm
+			updates["updated_at"] = time.Now()
+			report.Upgraded++
+		}
+	}
+	if status := updates["integrity_status"]; status != models.IntegrityStatusOK && len(report.Issues) < maxIssues {
+		report.Issues = append(report.Issues, Issue{Type: mediaType, FileName: r.FileName, Status: status.(string)})
+	}
+
+	return c.db.WithContext(ctx).Table(models.MediaFolder(mediaType)).Where("id = ?", r.ID).Updates(updates).Error
+}
+
+// Issues returns the records flagged as missing or corrupted by the last
+// check of their file.
+func (c *Checker) Issues(ctx context.Context) ([]Issue, error) {
+	issues := []Issue{}
+	for _, mediaType := range []string{models.MediaTypeImage, models.MediaTypeDoc} {
+		var records []struct {
+			FileName        string
+			IntegrityStatus string
+		}
+		err := c.db.WithContext(ctx).Table(models.MediaFolder(mediaType)).Select("file_name, integrity_status").
+			Where("deleted_at IS NULL AND integrity_status IN ?", []string{models.IntegrityStatusMissing, models.IntegrityStatusCorrupted}).
+			Order("id").Scan(&records).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range records {
+			issues = append(issues, Issue{Type: mediaType, FileName: r.FileName, Status: r.IntegrityStatus})
+		}
+	}
+	return issues, nil
+}
@@ -0,0 +1,63 @@
+package integrity
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecker_Check(t *testing.T) {
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	uploadsDir := filepath.Join(util.ExPath, "uploads")
+	require.NoError(t, os.MkdirAll(filepath.Join(uploadsDir, "images"), 0o755))
+	require.NoError(t, os.MkdirAll(filepath.Join(uploadsDir, "docs"), 0o755))
+	ctx := context.Background()
+
+	add := func(fileName, algorithm, content string) {
+		path := filepath.Join(uploadsDir, "images", fileName)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+		checksum, err := util.FileChecksum(algorithm, path)
+		require.NoError(t, err)
+		require.NoError(t, database.DB.Create(&models.Image{FileName: fileName, Checksum: checksum, ChecksumAlgorithm: algorithm}).Error)
+	}
+	add("ok.png", models.ChecksumSHA256, "ok")
+	add("legacy.png", models.ChecksumMD5, "legacy")
+	add("corrupted.png", models.ChecksumSHA256, "original")
+	add("missing.png", models.ChecksumSHA256, "missing")
+	require.NoError(t, os.WriteFile(filepath.Join(uploadsDir, "images", "corrupted.png"), []byte("bit rot"), 0o644))
+	require.NoError(t, os.Remove(filepath.Join(uploadsDir, "images", "missing.png")))
+
+	t.Setenv("CHECKSUM_ALGORITHM", models.ChecksumSHA256)
+	c := NewChecker(database.DB, uploadsDir)
+	report, err := c.Check(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 4, report.Checked)
+	require.Equal(t, 2, report.OK)
+	require.Equal(t, 1, report.Missing)
+	require.Equal(t, 1, report.Corrupted)
+	require.Equal(t, 1, report.Upgraded)
+
+	issues, err := c.Issues(ctx)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []Issue{
+		{Type: models.MediaTypeImage, FileName: "corrupted.png", Status: models.IntegrityStatusCorrupted},
+		{Type: models.MediaTypeImage, FileName: "missing.png", Status: models.IntegrityStatusMissing},
+	}, issues)
+
+	// Verified MD5 records are moved to the configured algorithm
+	image, err := database.NewImageRepo(database.DB).GetImageByFileName(ctx, "legacy.png")
+	require.NoError(t, err)
+	require.Equal(t, models.ChecksumSHA256, image.ChecksumAlgorithm)
+	require.Equal(t, models.IntegrityStatusOK, image.IntegrityStatus)
+	require.NotNil(t, image.VerifiedAt)
+	report, err = c.Check(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 0, report.Upgraded)
+}
@@ -0,0 +1,358 @@
+// Package janitor periodically removes what interrupted writes leave behind,
+// such as temporary files of uploads and image processing, and keeps
+// derived files such as cached image variants and renditions within their
+// age and size limits.
+package janitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+)
+
+const (
+	defaultInterval    = time.Hour
+	defaultTempMaxAge  = 24 * time.Hour
+	defaultCacheMaxAge = 30 * 24 * time.Hour
+	// touchInterval is how often uses of a cached file are recorded.
+	touchInterval = time.Hour
+)
+
+// defaultRenditionKinds are the kinds of renditions cleaned up by default:
+// the conversions served in place of images, which are rendered again on
+// request, and resized copies.
+var defaultRenditionKinds = []string{models.RenditionWebP, models.RenditionAVIF, models.RenditionResized}
+
+// tempPrefixes start the names of the temporary files written next to media
+// before they are renamed into place, by WebDAV uploads, optimization,
+// libvips, replication, repairs and renditions.
+var tempPrefixes = []string{".dav-", ".optimize-", ".vips-", ".replica-", ".repair-", ".rendition-"}
+
+// Stats sums up the work of the janitor since the start.
+type Stats struct {
+	Runs              int64      `json:"runs"`
+	LastRunAt         *time.Time `json:"last_run_at"`
+	TempFilesRemoved  int64      `json:"temp_files_removed"`
+	CacheFilesRemoved int64      `json:"cache_files_removed"`
+	RenditionsRemoved int64      `json:"renditions_removed"`
+	BytesReclaimed    int64      `json:"bytes_reclaimed"`
+	// LastBytesReclaimed is what the last run reclaimed.
+	LastBytesReclaimed int64 `json:"last_bytes_reclaimed"`
+	// DerivedFiles and DerivedBytes count the cached image variants and
+	// renditions subject to cleanup that the last run kept.
+	DerivedFiles int64 `json:"derived_files"`
+	DerivedBytes int64 `json:"derived_bytes"`
+}
+
+// Janitor cleans up the folders of the application in Root.
+type Janitor struct {
+	Root string
+	// TempMaxAge is how long a temporary file may go unmodified before it
+	// is considered orphaned.
+	TempMaxAge time.Duration
+	// CacheMaxAge is how long cached image variants and renditions of
+	// RenditionKinds may go unused before they are removed. 0 keeps them.
+	CacheMaxAge time.Duration
+	// DerivedMaxSize is the number of bytes cached image variants and
+	// renditions of RenditionKinds may take up, beyond which the least
+	// recently used are removed. 0 does not limit them.
+	DerivedMaxSize int64
+	// Renditions holds the renditions to clean up, only those of
+	// RenditionKinds since the others are not rendered again.
+	Renditions     models.RenditionRepository
+	RenditionKinds []string
+
+	mu    sync.Mutex
+	stats Stats
+}
+
+func New(root string) *Janitor {
+	return &Janitor{Root: root, TempMaxAge: defaultTempMaxAge, CacheMaxAge: defaultCacheMaxAge, RenditionKinds: defaultRenditionKinds}
+}
+
+// Default is the janitor of the application, replaced by Start.
+var Default = New(util.ExPath)
+
+// Stats returns the work done so far.
+func (j *Janitor) Stats() Stats {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.stats
+}
+
+// Run cleans up once, removing the files older than their maximum age at
+// now, and returns the work done.
+func (j *Janitor) Run(now time.Time) Stats {
+	run := Stats{Runs: 1, LastRunAt: &now}
+
+	uploads := filepath.Join(j.Root, "uploads")
+	for _, folder := range []string{"images", "docs", "renditions"} {
+		j.sweep(filepath.Join(uploads, folder), false, func(name string, info fs.FileInfo) bool {
+			return isTemp(name) && now.Sub(info.ModTime()) > j.TempMaxAge
+		}, &run.TempFilesRemoved, &run)
+	}
+
+	cache := filepath.Join(j.Root, "cache")
+	j.sweep(cache, true, func(name string, info fs.FileInfo) bool {
+		return (isTemp(name) || strings.HasSuffix(name, ".tmp")) && now.Sub(info.ModTime()) > j.TempMaxAge
+	}, &run.TempFilesRemoved, &run)
+	j.cleanDerived(now, &run)
+
+	run.LastBytesReclaimed = run.BytesReclaimed
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.stats.Runs++
+	j.stats.LastRunAt = run.LastRunAt
+	j.stats.TempFilesRemoved += run.TempFilesRemoved
+	j.stats.CacheFilesRemoved += run.CacheFilesRemoved
+	j.stats.RenditionsRemoved += run.RenditionsRemoved
+	j.stats.BytesReclaimed += run.BytesReclaimed
+	j.stats.LastBytesReclaimed = run.LastBytesReclaimed
+	j.stats.DerivedFiles = run.DerivedFiles
+	j.stats.DerivedBytes = run.DerivedBytes
+	return run
+}
+
+// derivedFile is a cached image variant, or the file of a rendition.
+type derivedFile struct {
+	path      string
+	size      int64
+	lastUsed  time.Time
+	rendition *models.Rendition
+}
+
+// cleanDerived removes the derived files unused for longer than
+// CacheMaxAge, then the least recently used ones until they fit in
+// DerivedMaxSize.
+func (j *Janitor) cleanDerived(now time.Time, run *Stats) {
+	var kept []derivedFile
+	var total int64
+	for _, file := range j.derivedFiles() {
+		if j.CacheMaxAge > 0 && now.Sub(file.lastUsed) > j.CacheMaxAge && j.removeDerived(file, run) {
+			continue
+		}
+		kept = append(kept, file)
+		total += file.size
+	}
+
+	if j.DerivedMaxSize > 0 && total > j.DerivedMaxSize {
+		sort.SliceStable(kept, func(a, b int) bool { return kept[a].lastUsed.Before(kept[b].lastUsed) })
+		for i := 0; i < len(kept) && total > j.DerivedMaxSize; {
+			if !j.removeDerived(kept[i], run) {
+				i++
+				continue
+			}
+			total -= kept[i].size
+			kept = append(kept[:i], kept[i+1:]...)
+		}
+	}
+	run.DerivedFiles, run.DerivedBytes = int64(len(kept)), total
+}
+
+// derivedFiles lists the cached image variants, whose modification time is
+// their last use, see Touch, and the renditions of RenditionKinds.
+func (j *Janitor) derivedFiles() []derivedFile {
+	var files []derivedFile
+	cache := filepath.Join(j.Root, "cache")
+	err := filepath.WalkDir(cache, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		// Temporary files are being written, or left to the sweep of
+		// orphans
+		if !entry.Type().IsRegular() || isTemp(entry.Name()) || strings.HasSuffix(entry.Name(), ".tmp") {
+			return nil
+		}
+		if info, err := entry.Info(); err == nil {
+			files = append(files, derivedFile{path: path, size: info.Size(), lastUsed: info.ModTime()})
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to list %s: %s", cache, err.Error())
+	}
+
+	if j.Renditions == nil || len(j.RenditionKinds) == 0 {
+		return files
+	}
+	renditions, err := j.Renditions.GetRenditionsOfKinds(context.Background(), j.RenditionKinds)
+	if err != nil {
+		log.Printf("Failed to list renditions: %s", err.Error())
+		return files
+	}
+	for i := range renditions {
+		files = append(files, derivedFile{
+			path:      filepath.Join(j.Root, "uploads", "renditions", renditions[i].FileName),
+			size:      renditions[i].Size,
+			lastUsed:  renditions[i].LastUsed(),
+			rendition: &renditions[i],
+		})
+	}
+	return files
+}
+
+// removeDerived removes a derived file, and the record of its rendition
+// first, and reports whether it did.
+func (j *Janitor) removeDerived(file derivedFile, run *Stats) bool {
+	if file.rendition != nil {
+		if err := j.Renditions.DeleteRendition(context.Background(), file.rendition.ID); err != nil {
+			log.Printf("Failed to delete rendition %s: %s", file.rendition.FileName, err.Error())
+			return false
+		}
+	}
+	if err := os.Remove(file.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("Failed to remove %s: %s", file.path, err.Error())
+		if file.rendition == nil {
+			return false
+		}
+	}
+	if file.rendition != nil {
+		run.RenditionsRemoved++
+	} else {
+		run.CacheFilesRemoved++
+	}
+	run.BytesReclaimed += file.size
+	return true
+}
+
+// Touch records a use of the cached file at path, whose info is given, by
+// moving its modification time forward, so the janitor removes the least
+// recently used files first. Uses are recorded at most once per hour.
+func Touch(path string, info fs.FileInfo) {
+	now := time.Now()
+	if now.Sub(info.ModTime()) < touchInterval {
+		return
+	}
+	if err := os.Chtimes(path, now, now); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("Failed to record use of %s: %s", path, err.Error())
+	}
+}
+
+// sweep removes the regular files in dir, and its subfolders if recursive,
+// that stale reports as stale, counting them in removed and their size in
+// run.
+func (j *Janitor) sweep(dir string, recursive bool, stale func(name string, info fs.FileInfo) bool, removed *int64, run *Stats) {
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() {
+			if path != dir && !recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil || !stale(entry.Name(), info) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			log.Printf("Failed to remove %s: %s", path, err.Error())
+			return nil
+		}
+		*removed++
+		run.BytesReclaimed += info.Size()
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to clean up %s: %s", dir, err.Error())
+	}
+}
+
+func isTemp(name string) bool {
+	for _, prefix := range tempPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Start cleans up every JANITOR_INTERVAL seconds, an hour by default; 0
+// disables the janitor. Temporary files are removed once unmodified for
+// JANITOR_TEMP_MAX_AGE seconds, a day by default. Cached image variants and
+// the renditions of the JANITOR_RENDITION_KINDS, by default webp, avif and
+// resized, are removed once unused for JANITOR_CACHE_MAX_AGE seconds, 30
+// days by default, and beyond JANITOR_DERIVED_MAX_SIZE megabytes, least
+// recently used first; 0 keeps them.
+func Start(renditions models.RenditionRepository) error {
+	interval, err := durationFromEnv("JANITOR_INTERVAL", defaultInterval)
+	if err != nil {
+		return err
+	}
+	j := New(util.ExPath)
+	j.Renditions = renditions
+	if j.TempMaxAge, err = durationFromEnv("JANITOR_TEMP_MAX_AGE", defaultTempMaxAge); err != nil {
+		return err
+	}
+	if j.CacheMaxAge, err = durationFromEnv("JANITOR_CACHE_MAX_AGE", defaultCacheMaxAge); err != nil {
+		return err
+	}
+	if val := os.Getenv("JANITOR_DERIVED_MAX_SIZE"); val != "" {
+		parsed, err := strconv.ParseInt(val, 10, 64)
+		if err != nil || parsed < 0 {
+			return fmt.Errorf("invalid JANITOR_DERIVED_MAX_SIZE %q", val)
+		}
+		j.DerivedMaxSize = parsed << 20
+	}
+	if val, ok := os.LookupEnv("JANITOR_RENDITION_KINDS"); ok {
+		j.RenditionKinds = nil
+		for _, kind := range strings.Split(val, ",") {
+			if kind = strings.TrimSpace(kind); kind != "" {
+				j.RenditionKinds = append(j.RenditionKinds, kind)
+			}
+		}
+	}
+	Default = j
+	if interval == 0 {
+		return nil
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			if run := j.Run(now); run.BytesReclaimed > 0 {
+				log.Printf("Janitor removed %d temporary and %d cached files and %d renditions (%d bytes)",
+					run.TempFilesRemoved, run.CacheFilesRemoved, run.RenditionsRemoved, run.BytesReclaimed)
+			}
+		}
+	}()
+	return nil
+}
+
+// durationFromEnv returns the seconds in the environment variable key, or
+// fallback if it is unset.
+func durationFromEnv(key string, fallback time.Duration) (time.Duration, error) {
+	val := os.Getenv(key)
+	if val == "" {
+		return fallback, nil
+	}
+	parsed, err := strconv.Atoi(val)
+	if err != nil || parsed < 0 {
+		return 0, fmt.Errorf("invalid %s %q", key, val)
+	}
+	return time.Duration(parsed) * time.Second, nil
+}
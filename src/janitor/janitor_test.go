@@ -0,0 +1,116 @@
+package janitor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJanitor_Run(t *testing.T) {
+	root := t.TempDir()
+	now := time.Now()
+	write := func(path string, size int, age time.Duration) string {
+		path = filepath.Join(root, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, make([]byte, size), 0o644))
+		require.NoError(t, os.Chtimes(path, now.Add(-age), now.Add(-age)))
+		return path
+	}
+	orphan := write("uploads/images/.dav-123", 100, 2*time.Hour)
+	writing := write("uploads/docs/.optimize-456", 10, time.Minute)
+	upload := write("uploads/docs/.profile", 10, 48*time.Hour)
+	oldUpload := write("uploads/images/old.png", 10, 48*time.Hour)
+	cacheTemp := write("cache/transforms/thumb/a.jpg.tmp", 20, 2*time.Hour)
+	staleVariant := write("cache/variants/b-320.webp", 30, 72*time.Hour)
+	freshVariant := write("cache/variants/c-320.webp", 30, time.Hour)
+
+	j := New(root)
+	j.TempMaxAge = time.Hour
+	j.CacheMaxAge = 48 * time.Hour
+
+	run := j.Run(now)
+	require.Equal(t, int64(2), run.TempFilesRemoved)
+	require.Equal(t, int64(1), run.CacheFilesRemoved)
+	require.Equal(t, int64(150), run.BytesReclaimed)
+	for _, path := range []string{orphan, cacheTemp, staleVariant} {
+		require.NoFileExists(t, path)
+	}
+	for _, path := range []string{writing, upload, oldUpload, freshVariant} {
+		require.FileExists(t, path)
+	}
+
+	// Runs add up
+	write("uploads/renditions/.rendition-1.pdf", 50, 2*time.Hour)
+	j.Run(now)
+	stats := j.Stats()
+	require.Equal(t, int64(2), stats.Runs)
+	require.Equal(t, int64(200), stats.BytesReclaimed)
+	require.Equal(t, int64(50), stats.LastBytesReclaimed)
+}
+
+func TestJanitor_DerivedMaxSize(t *testing.T) {
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	ctx := context.Background()
+	repo := database.NewRenditionRepo(database.DB)
+	now := time.Now()
+	write := func(path string, size int, unused time.Duration) string {
+		path = filepath.Join(util.ExPath, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, make([]byte, size), 0o644))
+		require.NoError(t, os.Chtimes(path, now.Add(-unused), now.Add(-unused)))
+		return path
+	}
+	rendition := func(kind, fileName string, unused time.Duration) models.Rendition {
+		path := write("uploads/renditions/"+fileName, 100, 0)
+		r := models.Rendition{SourceType: models.MediaTypeImage, SourceID: 1, Kind: kind, FileName: fileName, Size: 100}
+		require.NoError(t, repo.SaveRendition(ctx, &r))
+		require.NoError(t, database.DB.Model(&r).UpdateColumn("updated_at", now.Add(-72*time.Hour)).Error)
+		require.NoError(t, repo.TouchRendition(ctx, r.ID, now.Add(-unused)))
+		require.FileExists(t, path)
+		return r
+	}
+	oldest := write("cache/transforms/thumb/a.jpg", 100, 5*time.Hour)
+	recent := write("cache/variants/b-320.webp", 100, time.Hour)
+	webp := rendition(models.RenditionWebP, "c.webp", 3*time.Hour)
+	preview := rendition(models.RenditionPDF, "d.pdf", 48*time.Hour)
+
+	j := New(util.ExPath)
+	j.CacheMaxAge = 0
+	j.Renditions = repo
+	j.DerivedMaxSize = 250
+
+	run := j.Run(now)
+	require.Equal(t, int64(1), run.CacheFilesRemoved)
+	require.Equal(t, int64(0), run.RenditionsRemoved)
+	require.Equal(t, int64(2), run.DerivedFiles)
+	require.Equal(t, int64(200), run.DerivedBytes)
+	require.NoFileExists(t, oldest)
+
+	// Renditions go before files used more recently, previews never
+	j.DerivedMaxSize = 150
+	run = j.Run(now)
+	require.Equal(t, int64(1), run.RenditionsRemoved)
+	require.Equal(t, int64(100), run.DerivedBytes)
+	require.FileExists(t, recent)
+	require.NoFileExists(t, filepath.Join(util.ExPath, "uploads/renditions", webp.FileName))
+	_, err := repo.GetRenditionByFileName(ctx, webp.FileName)
+	require.Error(t, err)
+	_, err = repo.GetRenditionByFileName(ctx, preview.FileName)
+	require.NoError(t, err)
+
+	// Uses move files to the back of the queue
+	info, err := os.Stat(recent)
+	require.NoError(t, err)
+	Touch(recent, info)
+	info, err = os.Stat(recent)
+	require.NoError(t, err)
+	require.WithinDuration(t, time.Now(), info.ModTime(), time.Minute)
+}
@@ -0,0 +1,245 @@
+// Package metrics samples how media is delivered so admins can see where
+// caching or a faster storage backend would help.
+package metrics
+
+import (
+	"log"
+	"math"
+	"math/rand"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultSampleRate = 0.1
+	// maxSamples is the number of most recent samples kept per bucket.
+	maxSamples = 1000
+)
+
+// sizeBuckets are the upper bounds of the file size buckets. Files larger
+// than the last bound fall into a final open bucket.
+var sizeBuckets = []struct {
+	Name  string
+	Limit int64
+}{
+	{"<10KB", 10 << 10},
+	{"<100KB", 100 << 10},
+	{"<1MB", 1 << 20},
+	{"<10MB", 10 << 20},
+	{">=10MB", -1},
+}
+
+// Sample describes a single download.
+type Sample struct {
+	TTFB     time.Duration
+	Duration time.Duration
+	Bytes    int64
+	Aborted  bool
+}
+
+type bucket struct {
+	samples []Sample
+	next    int
+	total   int64
+	aborted int64
+	bytes   int64
+}
+
+// Delivery keeps timing and transfer size samples of downloads.
+type Delivery struct {
+	rate float64
+
+	mu      sync.Mutex
+	buckets []bucket
+}
+
+// NewDelivery returns a sampler recording the given fraction of downloads,
+// between 0 (disabled) and 1 (every download).
+func NewDelivery(rate float64) *Delivery {
+	return &Delivery{
+		rate:    min(max(rate, 0), 1),
+		buckets: make([]bucket, len(sizeBuckets)),
+	}
+}
+
+// SampleRateFromEnv returns the rate set in METRICS_DOWNLOAD_SAMPLE_RATE,
+// 0.1 by default.
+func SampleRateFromEnv() float64 {
+	value := os.Getenv("METRICS_DOWNLOAD_SAMPLE_RATE")
+	if value == "" {
+		return defaultSampleRate
+	}
+	rate, err := strconv.ParseFloat(value, 64)
+	if err != nil || rate < 0 || rate > 1 {
+		log.Printf("Invalid METRICS_DOWNLOAD_SAMPLE_RATE %q, using %g", value, defaultSampleRate)
+		return defaultSampleRate
+	}
+	return rate
+}
+
+// Record adds a sample for a file of the given size.
+func (d *Delivery) Record(size int64, sample Sample) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	b := &d.buckets[bucketIndex(size)]
+	if len(b.samples) < maxSamples {
+		b.samples = append(b.samples, sample)
+	} else {
+		b.samples[b.next] = sample
+	}
+	b.next = (b.next + 1) % maxSamples
+	b.total++
+	b.bytes += sample.Bytes
+	if sample.Aborted {
+		b.aborted++
+	}
+}
+
+func bucketIndex(size int64) int {
+	for i, b := range sizeBuckets {
+		if b.Limit < 0 || size < b.Limit {
+			return i
+		}
+	}
+	return len(sizeBuckets) - 1
+}
+
+// Middleware samples the downloads it wraps. Only successful responses are
+// recorded; a transfer counts as aborted when the client went away or fewer
+// bytes than announced were sent.
+func (d *Delivery) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if d.rate == 0 || rand.Float64() >= d.rate {
+			c.Next()
+			return
+		}
+
+		w := &timingWriter{ResponseWriter: c.Writer, start: time.Now()}
+		c.Writer = w
+		c.Next()
+		c.Writer = w.ResponseWriter
+
+		status := w.Status()
+		if status != http.StatusOK && status != http.StatusPartialContent {
+			return
+		}
+
+		sent := int64(max(w.Size(), 0))
+		size := sent
+		if length, err := strconv.ParseInt(w.Header().Get("Content-Length"), 10, 64); err == nil {
+			size = length
+		}
+		sample := Sample{
+			TTFB:     w.ttfb(),
+			Duration: time.Since(w.start),
+			Bytes:    sent,
+			Aborted:  c.Request.Context().Err() != nil || sent < size,
+		}
+		d.Record(size, sample)
+	}
+}
+
+// timingWriter notes when the first byte of the body was written.
+type timingWriter struct {
+	gin.ResponseWriter
+	start     time.Time
+	firstByte time.Time
+}
+
+func (w *timingWriter) Write(data []byte) (int, error) {
+	if w.firstByte.IsZero() {
+		w.firstByte = time.Now()
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *timingWriter) WriteString(s string) (int, error) {
+	if w.firstByte.IsZero() {
+		w.firstByte = time.Now()
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *timingWriter) ttfb() time.Duration {
+	if w.firstByte.IsZero() {
+		return time.Since(w.start)
+	}
+	return w.firstByte.Sub(w.start)
+}
+
+// BucketStats summarizes the samples of a file size bucket. Sampled,
+// Aborted and Bytes count every sampled download since the start, while the
+// percentiles are computed over the most recent Samples. Latencies are in
+// milliseconds.
+type BucketStats struct {
+	Bucket        string  `json:"bucket"`
+	Sampled       int64   `json:"sampled"`
+	Aborted       int64   `json:"aborted"`
+	Bytes         int64   `json:"bytes"`
+	Samples       int     `json:"samples"`
+	TTFBP50       float64 `json:"ttfb_p50_ms"`
+	TTFBP95       float64 `json:"ttfb_p95_ms"`
+	DurationP50   float64 `json:"duration_p50_ms"`
+	DurationP95   float64 `json:"duration_p95_ms"`
+	ThroughputP50 float64 `json:"throughput_p50_bytes_per_sec"`
+}
+
+// DeliveryStats is the delivery section of the metrics endpoint.
+type DeliveryStats struct {
+	SampleRate float64       `json:"sample_rate"`
+	Buckets    []BucketStats `json:"buckets"`
+}
+
+// Stats summarizes the recorded samples per file size bucket.
+func (d *Delivery) Stats() DeliveryStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	stats := DeliveryStats{SampleRate: d.rate, Buckets: []BucketStats{}}
+	for i, b := range d.buckets {
+		bs := BucketStats{
+			Bucket:  sizeBuckets[i].Name,
+			Sampled: b.total,
+			Aborted: b.aborted,
+			Bytes:   b.bytes,
+			Samples: len(b.samples),
+		}
+
+		var ttfb, duration, throughput []float64
+		for _, s := range b.samples {
+			ttfb = append(ttfb, milliseconds(s.TTFB))
+			duration = append(duration, milliseconds(s.Duration))
+			if !s.Aborted && s.Duration > 0 {
+				throughput = append(throughput, float64(s.Bytes)/s.Duration.Seconds())
+			}
+		}
+		bs.TTFBP50, bs.TTFBP95 = percentile(ttfb, 0.5), percentile(ttfb, 0.95)
+		bs.DurationP50, bs.DurationP95 = percentile(duration, 0.5), percentile(duration, 0.95)
+		bs.ThroughputP50 = percentile(throughput, 0.5)
+
+		stats.Buckets = append(stats.Buckets, bs)
+	}
+	return stats
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// percentile returns the p-th percentile of values using the nearest rank
+// method, or 0 for no values.
+func percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sort.Float64s(values)
+	rank := int(math.Ceil(p*float64(len(values)))) - 1
+	return values[min(max(rank, 0), len(values)-1)]
+}
@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDelivery_Middleware(t *testing.T) {
+	delivery := NewDelivery(1)
+	router := gin.New()
+	router.GET("/file/:size", delivery.Middleware(), func(c *gin.Context) {
+		size := map[string]int{"small": 100, "large": 2 << 20}[c.Param("size")]
+		c.String(http.StatusOK, strings.Repeat("x", size))
+	})
+	router.GET("/missing", delivery.Middleware(), func(c *gin.Context) {
+		c.Status(http.StatusNotFound)
+	})
+
+	for _, target := range []string{"/file/small", "/file/small", "/file/large", "/missing"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+
+	stats := delivery.Stats()
+	require.Equal(t, 1.0, stats.SampleRate)
+	require.Len(t, stats.Buckets, len(sizeBuckets))
+	require.Equal(t, "<10KB", stats.Buckets[0].Bucket)
+	require.Equal(t, int64(2), stats.Buckets[0].Sampled)
+	require.Equal(t, int64(200), stats.Buckets[0].Bytes)
+	require.Equal(t, int64(1), stats.Buckets[3].Sampled)
+	require.Zero(t, stats.Buckets[1].Sampled)
+}
+
+func TestDelivery_Disabled(t *testing.T) {
+	delivery := NewDelivery(0)
+	router := gin.New()
+	router.GET("/", delivery.Middleware(), func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	require.Zero(t, delivery.Stats().Buckets[0].Sampled)
+}
+
+func TestDelivery_Percentiles(t *testing.T) {
+	delivery := NewDelivery(1)
+	for i := 1; i <= 100; i++ {
+		delivery.Record(1<<20, Sample{
+			TTFB:     time.Duration(i) * time.Millisecond,
+			Duration: time.Duration(i) * 10 * time.Millisecond,
+			Bytes:    1 << 20,
+			Aborted:  i == 100,
+		})
+	}
+
+	bucket := delivery.Stats().Buckets[3]
+	require.Equal(t, int64(100), bucket.Sampled)
+	require.Equal(t, int64(1), bucket.Aborted)
+	require.Equal(t, 50.0, bucket.TTFBP50)
+	require.Equal(t, 95.0, bucket.TTFBP95)
+	require.Equal(t, 950.0, bucket.DurationP95)
+}
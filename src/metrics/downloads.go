@@ -0,0 +1,220 @@
+package metrics
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+)
+
+const (
+	defaultFlushInterval = 10 * time.Second
+	// maxPending is the number of counters kept in memory before they are
+	// written without waiting for the next flush.
+	maxPending = 10000
+)
+
+// ActiveDownloads is the download counter started by StartDownloads, nil
+// until then.
+var ActiveDownloads *Downloads
+
+type downloadKey struct {
+	mediaType string
+	fileName  string
+	day       time.Time
+}
+
+// Downloads counts the downloads of each file. Downloads are counted in
+// memory and written to the database in batches, so serving a file costs no
+// database write. Counts not yet written are lost if the process exits.
+type Downloads struct {
+	repo models.DownloadStatRepository
+
+	mu      sync.Mutex
+	pending map[downloadKey]int64
+	// flushing is closed when the write in progress finishes.
+	flushing chan struct{}
+}
+
+func NewDownloads(repo models.DownloadStatRepository) *Downloads {
+	return &Downloads{repo: repo, pending: map[downloadKey]int64{}}
+}
+
+// Add counts a download of a file at t.
+func (d *Downloads) Add(mediaType, fileName string, t time.Time) {
+	day := t.UTC().Truncate(24 * time.Hour)
+	d.mu.Lock()
+	d.pending[downloadKey{mediaType, fileName, day}]++
+	full := len(d.pending) >= maxPending
+	d.mu.Unlock()
+
+	if full {
+		go func() {
+			if err := d.Flush(context.Background()); err != nil {
+				log.Printf("Failed to write download counts: %s", err.Error())
+			}
+		}()
+	}
+}
+
+// Flush writes the counted downloads to the database. Counts that fail to be
+// written are kept for the next flush.
+func (d *Downloads) Flush(ctx context.Context) error {
+	d.mu.Lock()
+	// Wait for a concurrent flush so counts are never written twice
+	for d.flushing != nil {
+		done := d.flushing
+		d.mu.Unlock()
+		<-done
+		d.mu.Lock()
+	}
+	pending := d.pending
+	d.pending = map[downloadKey]int64{}
+	done := make(chan struct{})
+	d.flushing = done
+	d.mu.Unlock()
+
+	defer func() {
+		d.mu.Lock()
+		d.flushing = nil
+		d.mu.Unlock()
+		close(done)
+	}()
+
+	if len(pending) == 0 {
+		return nil
+	}
+	stats := make([]models.DownloadStat, 0, len(pending))
+	for k, count := range pending {
+		stats = append(stats, models.DownloadStat{MediaType: k.mediaType, FileName: k.fileName, Day: k.day, Count: count})
+	}
+	if err := d.repo.AddDownloads(ctx, stats); err != nil {
+		d.mu.Lock()
+		for k, count := range pending {
+			d.pending[k] += count
+		}
+		d.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Count returns the number of downloads of a file, including those not
+// written yet.
+func (d *Downloads) Count(ctx context.Context, mediaType, fileName string) (int64, error) {
+	count, err := d.repo.GetDownloadCount(ctx, mediaType, fileName)
+	if err != nil {
+		return 0, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for k, pending := range d.pending {
+		if k.mediaType == mediaType && k.fileName == fileName {
+			count += pending
+		}
+	}
+	return count, nil
+}
+
+// Top returns up to limit files with the most downloads on the days from
+// since until before until, see models.DownloadStatRepository.
+func (d *Downloads) Top(ctx context.Context, mediaType string, since, until time.Time, limit int) ([]models.DownloadTotal, error) {
+	if err := d.Flush(ctx); err != nil {
+		return nil, err
+	}
+	return d.repo.GetTopDownloads(ctx, mediaType, since, until, limit)
+}
+
+// Middleware counts the downloads of mediaType it wraps. Only successful GET
+// requests count, and ranged requests only when they start at the beginning
+// of the file, so a file fetched in chunks counts once.
+func (d *Downloads) Middleware(mediaType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if fileName, ok := downloadedFile(c); ok {
+			d.Add(mediaType, fileName, time.Now())
+		}
+	}
+}
+
+// CountDownloads is Middleware for ActiveDownloads, passing requests through
+// while downloads are not counted.
+func CountDownloads(mediaType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if d := ActiveDownloads; d != nil {
+			if fileName, ok := downloadedFile(c); ok {
+				d.Add(mediaType, fileName, time.Now())
+			}
+		}
+	}
+}
+
+// downloadedFile returns the name of the file served by a finished request,
+// and whether the request counts as a download.
+func downloadedFile(c *gin.Context) (string, bool) {
+	if c.Request.Method != http.MethodGet {
+		return "", false
+	}
+	switch c.Writer.Status() {
+	case http.StatusOK:
+	case http.StatusPartialContent:
+		if !strings.HasPrefix(c.GetHeader("Range"), "bytes=0-") {
+			return "", false
+		}
+	default:
+		return "", false
+	}
+	fileName, err := util.FilterFilename(path.Base(c.Request.URL.Path))
+	if err != nil {
+		return "", false
+	}
+	return fileName, true
+}
+
+// Run flushes the counts every interval.
+func (d *Downloads) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := d.Flush(context.Background()); err != nil {
+			log.Printf("Failed to write download counts: %s", err.Error())
+		}
+	}
+}
+
+// StartDownloads sets ActiveDownloads and writes its counts every
+// DOWNLOAD_STATS_FLUSH_INTERVAL seconds, 10 by default.
+func StartDownloads(repo models.DownloadStatRepository) error {
+	interval := defaultFlushInterval
+	if val := os.Getenv("DOWNLOAD_STATS_FLUSH_INTERVAL"); val != "" {
+		parsed, err := strconv.Atoi(val)
+		if err != nil || parsed <= 0 {
+			log.Printf("Invalid DOWNLOAD_STATS_FLUSH_INTERVAL %q, using %s", val, defaultFlushInterval)
+		} else {
+			interval = time.Duration(parsed) * time.Second
+		}
+	}
+
+	ActiveDownloads = NewDownloads(repo)
+	go ActiveDownloads.Run(interval)
+	return nil
+}
+
+// DownloadCount returns the number of downloads of a file counted by
+// ActiveDownloads, 0 when downloads are not counted.
+func DownloadCount(ctx context.Context, mediaType, fileName string) (int64, error) {
+	if ActiveDownloads == nil {
+		return 0, nil
+	}
+	return ActiveDownloads.Count(ctx, mediaType, fileName)
+}
@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloads(t *testing.T) {
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	ctx := context.Background()
+	downloads := NewDownloads(database.NewDownloadStatRepo(database.DB))
+
+	router := gin.New()
+	router.GET("/images/:name", downloads.Middleware(models.MediaTypeImage), func(c *gin.Context) {
+		if c.Param("name") == "missing.png" {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		if c.GetHeader("Range") != "" {
+			c.Status(http.StatusPartialContent)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+	get := func(target, rangeHeader string) {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	get("/images/logo.png", "")
+	get("/images/logo.png", "bytes=0-99")
+	get("/images/logo.png", "bytes=100-199")
+	get("/images/missing.png", "")
+	get("/images/banner.png", "")
+
+	// Counts are visible before and after they are written
+	count, err := downloads.Count(ctx, models.MediaTypeImage, "logo.png")
+	require.NoError(t, err)
+	require.Equal(t, int64(2), count)
+	require.NoError(t, downloads.Flush(ctx))
+	count, err = downloads.Count(ctx, models.MediaTypeImage, "logo.png")
+	require.NoError(t, err)
+	require.Equal(t, int64(2), count)
+
+	// Flushes add to the stored counters
+	downloads.Add(models.MediaTypeImage, "banner.png", time.Now())
+	downloads.Add(models.MediaTypeImage, "banner.png", time.Now())
+	downloads.Add(models.MediaTypeImage, "old.png", time.Now().AddDate(0, 0, -10))
+	downloads.Add(models.MediaTypeDoc, "report.pdf", time.Now())
+
+	top, err := downloads.Top(ctx, models.MediaTypeImage, time.Now().UTC().Truncate(24*time.Hour), time.Time{}, 10)
+	require.NoError(t, err)
+	require.Equal(t, []models.DownloadTotal{
+		{MediaType: models.MediaTypeImage, FileName: "banner.png", Count: 3},
+		{MediaType: models.MediaTypeImage, FileName: "logo.png", Count: 2},
+	}, top)
+
+	top, err = downloads.Top(ctx, "", time.Time{}, time.Time{}, 2)
+	require.NoError(t, err)
+	require.Len(t, top, 2)
+	require.Equal(t, "banner.png", top[0].FileName)
+
+	// Renaming a file keeps its counters
+	require.NoError(t, database.NewImageRepo(database.DB).RenameImage(ctx, "logo.png", "brand.png"))
+	count, err = downloads.Count(ctx, models.MediaTypeImage, "brand.png")
+	require.NoError(t, err)
+	require.Equal(t, int64(2), count)
+}
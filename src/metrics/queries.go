@@ -0,0 +1,125 @@
+package metrics
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// queryBuckets are the upper bounds of the query duration histogram. Slower
+// queries fall into a final open bucket.
+var queryBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+}
+
+type queryHistogram struct {
+	counts []int64
+	total  int64
+	sum    time.Duration
+	max    time.Duration
+	errors int64
+}
+
+// Queries keeps histograms of the duration of database queries per
+// operation, e.g. "query" or "update", and table.
+type Queries struct {
+	mu         sync.Mutex
+	histograms map[queryKey]*queryHistogram
+}
+
+type queryKey struct {
+	Operation string
+	Table     string
+}
+
+// NewQueries returns an empty set of query histograms.
+func NewQueries() *Queries {
+	return &Queries{histograms: map[queryKey]*queryHistogram{}}
+}
+
+// DefaultQueries records the queries of the database package.
+var DefaultQueries = NewQueries()
+
+// Record adds a query of the given operation on table that took duration,
+// and failed if failed is set.
+func (q *Queries) Record(operation, table string, duration time.Duration, failed bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	key := queryKey{operation, table}
+	h, ok := q.histograms[key]
+	if !ok {
+		h = &queryHistogram{counts: make([]int64, len(queryBuckets)+1)}
+		q.histograms[key] = h
+	}
+	i := sort.Search(len(queryBuckets), func(i int) bool { return duration <= queryBuckets[i] })
+	h.counts[i]++
+	h.total++
+	h.sum += duration
+	h.max = max(h.max, duration)
+	if failed {
+		h.errors++
+	}
+}
+
+// QueryBucket is a bucket of a query duration histogram, counting the
+// queries that took at most LessOrEqualMs milliseconds and more than the
+// bound of the previous bucket. The last bucket has no bound.
+type QueryBucket struct {
+	LessOrEqualMs *float64 `json:"le_ms"`
+	Count         int64    `json:"count"`
+}
+
+// QueryStats summarizes the queries of an operation on a table. Durations
+// are in milliseconds.
+type QueryStats struct {
+	Operation string        `json:"operation"`
+	Table     string        `json:"table"`
+	Count     int64         `json:"count"`
+	Errors    int64         `json:"errors"`
+	TotalMs   float64       `json:"total_ms"`
+	MaxMs     float64       `json:"max_ms"`
+	Buckets   []QueryBucket `json:"buckets"`
+}
+
+// Stats returns the histograms ordered by the total time spent, most first.
+func (q *Queries) Stats() []QueryStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	stats := []QueryStats{}
+	for key, h := range q.histograms {
+		s := QueryStats{
+			Operation: key.Operation,
+			Table:     key.Table,
+			Count:     h.total,
+			Errors:    h.errors,
+			TotalMs:   milliseconds(h.sum),
+			MaxMs:     milliseconds(h.max),
+		}
+		for i, count := range h.counts {
+			bucket := QueryBucket{Count: count}
+			if i < len(queryBuckets) {
+				bound := milliseconds(queryBuckets[i])
+				bucket.LessOrEqualMs = &bound
+			}
+			s.Buckets = append(s.Buckets, bucket)
+		}
+		stats = append(stats, s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].TotalMs != stats[j].TotalMs {
+			return stats[i].TotalMs > stats[j].TotalMs
+		}
+		return stats[i].Operation+stats[i].Table < stats[j].Operation+stats[j].Table
+	})
+	return stats
+}
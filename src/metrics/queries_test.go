@@ -0,0 +1,34 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueries(t *testing.T) {
+	q := NewQueries()
+	q.Record("query", "images", 3*time.Millisecond, false)
+	q.Record("query", "images", 5*time.Millisecond, false)
+	q.Record("query", "images", 2*time.Second, true)
+	q.Record("update", "docs", time.Millisecond/2, false)
+
+	stats := q.Stats()
+	require.Len(t, stats, 2)
+	images := stats[0]
+	require.Equal(t, "query", images.Operation)
+	require.Equal(t, "images", images.Table)
+	require.EqualValues(t, 3, images.Count)
+	require.EqualValues(t, 1, images.Errors)
+	require.Equal(t, 2008.0, images.TotalMs)
+	require.Equal(t, 2000.0, images.MaxMs)
+	require.Len(t, images.Buckets, len(queryBuckets)+1)
+	require.EqualValues(t, 2, images.Buckets[1].Count)
+	require.Equal(t, 5.0, *images.Buckets[1].LessOrEqualMs)
+	last := images.Buckets[len(queryBuckets)]
+	require.Nil(t, last.LessOrEqualMs)
+	require.EqualValues(t, 1, last.Count)
+
+	require.EqualValues(t, 1, stats[1].Buckets[0].Count)
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+)
+
+// aliasCacheControl lets clients and proxies cache alias redirects for a
+// day, so they notice when a new file takes the old name.
+const aliasCacheControl = "public, max-age=86400"
+
+// Aliases redirects downloads of the former name of a renamed file to its
+// current name with a 301. Files that exist under the requested name are
+// served as usual.
+func Aliases(aliases models.MediaAliasRepository, images models.ImageRepository, docs models.DocRepository, mediaType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			c.Next()
+			return
+		}
+		fileName, err := util.FilterFilename(requestedFileName(c))
+		if err != nil {
+			c.Next()
+			return
+		}
+		if _, err := os.Stat(filepath.Join(util.ExPath, "uploads", models.MediaFolder(mediaType), fileName)); !errors.Is(err, fs.ErrNotExist) {
+			c.Next()
+			return
+		}
+
+		ctx := c.Request.Context()
+		alias, err := aliases.GetAlias(ctx, mediaType, fileName)
+		if err != nil {
+			c.Next()
+			return
+		}
+		current, err := currentFileName(ctx, images, docs, mediaType, alias.MediaUUID)
+		if err != nil || current == fileName {
+			c.Next()
+			return
+		}
+
+		location := url.URL{Path: path.Join(path.Dir(c.Request.URL.Path), current), RawQuery: c.Request.URL.RawQuery}
+		c.Header("Cache-Control", aliasCacheControl)
+		c.Redirect(http.StatusMovedPermanently, location.String())
+		c.Abort()
+	}
+}
+
+// currentFileName returns the file name of the media with uuid.
+func currentFileName(ctx context.Context, images models.ImageRepository, docs models.DocRepository, mediaType, uuid string) (string, error) {
+	if mediaType == models.MediaTypeImage {
+		image, err := images.GetImageByUUID(ctx, uuid)
+		return image.FileName, err
+	}
+	doc, err := docs.GetDocByUUID(ctx, uuid)
+	return doc.FileName, err
+}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAliases(t *testing.T) {
+	// Arrange
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	imagesDir := filepath.Join(util.ExPath, "uploads", "images")
+	require.NoError(t, os.MkdirAll(imagesDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(imagesDir, "logo final.png"), []byte("png"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(imagesDir, "reused.png"), []byte("png"), 0o644))
+
+	ctx := context.Background()
+	images := database.NewImageRepo(database.DB)
+	_, err := images.AddImage(ctx, models.Image{FileName: "logo.png", Checksum: []byte("a")})
+	require.NoError(t, err)
+	require.NoError(t, images.RenameImage(ctx, "logo.png", "logo-v2.png"))
+	require.NoError(t, images.RenameImage(ctx, "logo-v2.png", "logo final.png"))
+	_, err = images.AddImage(ctx, models.Image{FileName: "other.png", Checksum: []byte("b")})
+	require.NoError(t, err)
+	require.NoError(t, images.RenameImage(ctx, "other.png", "reused.png"))
+	// Renaming back turns the alias into the current name again
+	require.NoError(t, images.RenameImage(ctx, "reused.png", "other.png"))
+
+	aliases := database.NewMediaAliasRepo(database.DB)
+	r := gin.New()
+	r.GET("/images/*filepath", Aliases(aliases, images, database.NewDocRepo(database.DB), models.MediaTypeImage), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+
+	// Act & Assert
+	w := get("/images/logo.png?w=100")
+	require.Equal(t, http.StatusMovedPermanently, w.Code)
+	require.Equal(t, "/images/logo%20final.png?w=100", w.Header().Get("Location"))
+	require.Equal(t, aliasCacheControl, w.Header().Get("Cache-Control"))
+	require.Equal(t, http.StatusMovedPermanently, get("/images/logo-v2.png").Code)
+
+	// Existing files are served even when the name is an alias
+	require.Equal(t, http.StatusOK, get("/images/reused.png").Code)
+	require.Equal(t, http.StatusOK, get("/images/unknown.png").Code)
+
+	// Deleting the image removes its aliases
+	_, err = images.DeleteImage(ctx, "logo final.png")
+	require.NoError(t, err)
+	_, err = aliases.GetAlias(ctx, models.MediaTypeImage, "logo.png")
+	require.Error(t, err)
+	require.Equal(t, http.StatusOK, get("/images/logo.png").Code)
+}
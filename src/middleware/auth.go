@@ -1,67 +1,87 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
-	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/kevinanielsen/go-fast-cdn/src/auth"
 	"github.com/kevinanielsen/go-fast-cdn/src/database"
-	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
 )
 
+// ErrNoCredentials is returned by authenticators for requests without
+// credentials they understand, so the next one in the chain is tried.
+var ErrNoCredentials = errors.New("no credentials")
+
+// Authenticator resolves a source of credentials, e.g. bearer tokens, to the
+// principal making the request. Invalid credentials are reported as a
+// *problem.Error.
+type Authenticator interface {
+	Authenticate(c *gin.Context) (*auth.Principal, error)
+}
+
+// AuthenticatorFunc adapts a function to an Authenticator.
+type AuthenticatorFunc func(c *gin.Context) (*auth.Principal, error)
+
+func (f AuthenticatorFunc) Authenticate(c *gin.Context) (*auth.Principal, error) {
+	return f(c)
+}
+
+// AuthMiddleware authenticates requests with a chain of authenticators and
+// checks the roles and permissions of the resulting principal. Handlers
+// read the principal with auth.PrincipalFrom, or the context keys set by
+// auth.SetPrincipal, whatever credentials were used.
 type AuthMiddleware struct {
-	jwtService *auth.JWTService
-	userRepo   models.UserRepository
+	authenticators []Authenticator
 }
 
-func NewAuthMiddleware() *AuthMiddleware {
-	return &AuthMiddleware{
-		jwtService: auth.NewJWTService(),
-		userRepo:   database.NewUserRepo(database.DB),
+// NewAuthMiddleware returns the middleware trying client certificates, API
+// keys, signed URLs and JWT bearer tokens, in this order, followed by
+// extra.
+func NewAuthMiddleware(extra ...Authenticator) *AuthMiddleware {
+	jwtService := auth.NewJWTService()
+	userRepo := database.NewUserRepo(database.DB)
+	serviceAccountRepo := database.NewServiceAccountRepo(database.DB)
+	return &AuthMiddleware{authenticators: append([]Authenticator{
+		ClientCertAuthenticator(serviceAccountRepo),
+		APIKeyAuthenticator(serviceAccountRepo),
+		SignedURLAuthenticator(jwtService, userRepo, serviceAccountRepo),
+		JWTAuthenticator(jwtService, userRepo),
+	}, extra...)}
+}
+
+// authenticate returns the principal of the first authenticator that found
+// credentials in the request, or ErrNoCredentials if none did.
+func (a *AuthMiddleware) authenticate(c *gin.Context) (*auth.Principal, error) {
+	for _, authenticator := range a.authenticators {
+		principal, err := authenticator.Authenticate(c)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		return principal, err
 	}
+	return nil, ErrNoCredentials
 }
 
-// RequireAuth middleware that validates JWT tokens
+// RequireAuth middleware that rejects requests without valid credentials
 func (a *AuthMiddleware) RequireAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
-			c.Abort()
-			return
-		}
-
-		// Extract token from "Bearer <token>"
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header format"})
-			c.Abort()
+		principal, err := a.authenticate(c)
+		if errors.Is(err, ErrNoCredentials) {
+			problem.Abort(c, problem.New(http.StatusUnauthorized, problem.CodeTokenMissing, "Authorization header required"))
 			return
 		}
-
-		token := parts[1]
-		claims, err := a.jwtService.ValidateToken(token)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-			c.Abort()
+		var p *problem.Error
+		if errors.As(err, &p) {
+			problem.Abort(c, p)
 			return
-		}
-
-		// Get user from database to ensure they still exist and are active
-		user, err := a.userRepo.GetUserByID(claims.UserID)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
-			c.Abort()
+		} else if err != nil {
+			problem.Write(c, http.StatusUnauthorized, "Invalid credentials")
 			return
 		}
 
-		// Set user information in context for use in handlers
-		c.Set("user_id", user.ID)
-		c.Set("user_email", user.Email)
-		c.Set("user_role", user.Role)
-		c.Set("user", user)
-
+		auth.SetPrincipal(c, principal)
 		c.Next()
 	}
 }
@@ -69,23 +89,20 @@ func (a *AuthMiddleware) RequireAuth() gin.HandlerFunc {
 // RequireRole middleware that checks if user has required role
 func (a *AuthMiddleware) RequireRole(roles ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userRole, exists := c.Get("user_role")
+		principal, exists := auth.PrincipalFrom(c)
 		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "User role not found in context"})
-			c.Abort()
+			problem.Write(c, http.StatusUnauthorized, "User role not found in context")
 			return
 		}
 
-		role := userRole.(string)
 		for _, requiredRole := range roles {
-			if role == requiredRole {
+			if principal.Role == requiredRole {
 				c.Next()
 				return
 			}
 		}
 
-		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
-		c.Abort()
+		problem.Write(c, http.StatusForbidden, "Insufficient permissions")
 	}
 }
 
@@ -94,40 +111,70 @@ func (a *AuthMiddleware) RequireAdmin() gin.HandlerFunc {
 	return a.RequireRole("admin")
 }
 
-// OptionalAuth middleware that tries to authenticate but doesn't require it
-func (a *AuthMiddleware) OptionalAuth() gin.HandlerFunc {
+// RequireUser middleware that rejects service accounts from endpoints meant
+// for human users
+func (a *AuthMiddleware) RequireUser() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.Next()
+		if principal, exists := auth.PrincipalFrom(c); !exists || principal.User == nil {
+			problem.Write(c, http.StatusForbidden, "This endpoint is not available to service accounts")
 			return
 		}
+		c.Next()
+	}
+}
 
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.Next()
+// RequirePermission middleware that checks service accounts were granted
+// permission. Human users are governed by their role and always pass.
+func (a *AuthMiddleware) RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if principal, exists := auth.PrincipalFrom(c); exists && !principal.HasPermission(permission) {
+			problem.Write(c, http.StatusForbidden, "Service account lacks permission "+permission)
 			return
 		}
+		c.Next()
+	}
+}
 
-		token := parts[1]
-		claims, err := a.jwtService.ValidateToken(token)
-		if err != nil {
+// RequireGlobalPermission middleware that lets admins and service accounts
+// granted permission through. Accounts limited to an organization are
+// rejected, for endpoints exposing the media of every organization.
+func (a *AuthMiddleware) RequireGlobalPermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, _ := auth.PrincipalFrom(c)
+		if principal != nil && principal.ServiceAccount != nil {
+			if !principal.HasPermission(permission) || principal.OrganizationID != nil {
+				problem.Write(c, http.StatusForbidden, "Service account lacks permission "+permission)
+				return
+			}
 			c.Next()
 			return
 		}
-
-		user, err := a.userRepo.GetUserByID(claims.UserID)
-		if err != nil {
-			c.Next()
+		if principal == nil || principal.Role != "admin" {
+			problem.Write(c, http.StatusForbidden, "Insufficient permissions")
 			return
 		}
+		c.Next()
+	}
+}
 
-		// Set user information in context if authentication succeeds
-		c.Set("user_id", user.ID)
-		c.Set("user_email", user.Email)
-		c.Set("user_role", user.Role)
-		c.Set("user", user)
+// OptionalAuth middleware that tries to authenticate but doesn't require it
+func (a *AuthMiddleware) OptionalAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if principal, err := a.authenticate(c); err == nil {
+			auth.SetPrincipal(c, principal)
+		}
+		c.Next()
+	}
+}
 
+// WebSocketToken lets WebSocket handshakes pass their token as
+// ?access_token=, since browsers cannot set the Authorization header on
+// them. It must run before RequireAuth.
+func WebSocketToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token := c.Query("access_token"); token != "" && c.IsWebsocket() && c.GetHeader("Authorization") == "" {
+			c.Request.Header.Set("Authorization", "Bearer "+token)
+		}
 		c.Next()
 	}
 }
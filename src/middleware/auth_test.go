@@ -0,0 +1,207 @@
+package middleware
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/auth"
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequireAuth_ServiceAccount(t *testing.T) {
+	// Arrange
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	repo := database.NewServiceAccountRepo(database.DB)
+	orgID := uint(7)
+	account := &models.ServiceAccount{Name: "ci", OrganizationID: &orgID, Permissions: models.PermissionMediaUpload}
+	require.NoError(t, repo.CreateServiceAccount(context.Background(), account))
+	key, prefix, hash, err := auth.GenerateAPIKey()
+	require.NoError(t, err)
+	require.NoError(t, repo.CreateAPIKey(context.Background(), &models.APIKey{ServiceAccountID: account.ID, Prefix: prefix, KeyHash: hash}))
+
+	a := NewAuthMiddleware()
+	ok := func(c *gin.Context) {
+		require.Equal(t, orgID, c.GetUint("organization_id"))
+		c.Status(http.StatusOK)
+	}
+	r := gin.New()
+	r.GET("/upload", a.RequireAuth(), a.RequirePermission(models.PermissionMediaUpload), ok)
+	r.GET("/delete", a.RequireAuth(), a.RequirePermission(models.PermissionMediaDelete), ok)
+	r.GET("/profile", a.RequireAuth(), a.RequireUser(), ok)
+
+	tests := []struct {
+		path   string
+		header string
+		value  string
+		status int
+	}{
+		{"/upload", "X-API-Key", key, http.StatusOK},
+		{"/upload", "Authorization", "Bearer " + key, http.StatusOK},
+		{"/upload", "X-API-Key", auth.APIKeyPrefix + "invalid", http.StatusUnauthorized},
+		{"/delete", "X-API-Key", key, http.StatusForbidden},
+		{"/profile", "X-API-Key", key, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		// Act
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		req.Header.Set(tt.header, tt.value)
+		r.ServeHTTP(w, req)
+
+		// Assert
+		require.Equal(t, tt.status, w.Code, "%s with %s", tt.path, tt.header)
+	}
+
+	keys, err := repo.GetAPIKeys(context.Background(), account.ID)
+	require.NoError(t, err)
+	require.NotNil(t, keys[0].LastUsedAt)
+}
+
+func TestRequireGlobalPermission(t *testing.T) {
+	// Arrange
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	repo := database.NewServiceAccountRepo(database.DB)
+	orgID := uint(7)
+	newKey := func(name string, orgID *uint) string {
+		account := &models.ServiceAccount{Name: name, OrganizationID: orgID, Permissions: models.PermissionReplicationRead}
+		require.NoError(t, repo.CreateServiceAccount(context.Background(), account))
+		key, prefix, hash, err := auth.GenerateAPIKey()
+		require.NoError(t, err)
+		require.NoError(t, repo.CreateAPIKey(context.Background(), &models.APIKey{ServiceAccountID: account.ID, Prefix: prefix, KeyHash: hash}))
+		return key
+	}
+	global := newKey("secondary", nil)
+	scoped := newKey("scoped", &orgID)
+
+	a := NewAuthMiddleware()
+	r := gin.New()
+	r.GET("/changes", a.RequireAuth(), a.RequireGlobalPermission(models.PermissionReplicationRead), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	for key, status := range map[string]int{global: http.StatusOK, scoped: http.StatusForbidden} {
+		// Act
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/changes", nil)
+		req.Header.Set("X-API-Key", key)
+		r.ServeHTTP(w, req)
+
+		// Assert
+		require.Equal(t, status, w.Code)
+	}
+}
+
+func TestRequireAuth_SignedURL(t *testing.T) {
+	// Arrange
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	user := &models.User{Email: "user@example.com", PasswordHash: "x", Role: "user"}
+	require.NoError(t, database.DB.Create(user).Error)
+	jwtService := auth.NewJWTService()
+	principal := auth.UserPrincipal(auth.MethodJWT, user).ID()
+	target := &url.URL{Path: "/file", RawQuery: "width=100"}
+	valid := jwtService.SignURL(target, principal, time.Now().Add(time.Hour)).String()
+	expired := jwtService.SignURL(target, principal, time.Now().Add(-time.Minute)).String()
+
+	a := NewAuthMiddleware()
+	r := gin.New()
+	handler := func(c *gin.Context) {
+		p, ok := auth.PrincipalFrom(c)
+		require.True(t, ok)
+		require.Equal(t, auth.MethodSignedURL, p.Method)
+		require.Equal(t, user.ID, c.GetUint("user_id"))
+		c.Status(http.StatusOK)
+	}
+	r.GET("/file", a.RequireAuth(), handler)
+	r.POST("/file", a.RequireAuth(), handler)
+
+	tests := []struct {
+		method string
+		target string
+		status int
+	}{
+		{http.MethodGet, valid, http.StatusOK},
+		{http.MethodGet, strings.Replace(valid, "width=100", "width=200", 1), http.StatusUnauthorized},
+		{http.MethodGet, expired, http.StatusUnauthorized},
+		{http.MethodPost, valid, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		// Act
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(tt.method, tt.target, nil))
+
+		// Assert
+		require.Equal(t, tt.status, w.Code, "%s %s", tt.method, tt.target)
+	}
+}
+
+func TestRequireAuth_ClientCert(t *testing.T) {
+	// Arrange
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	repo := database.NewServiceAccountRepo(database.DB)
+	require.NoError(t, repo.CreateServiceAccount(context.Background(), &models.ServiceAccount{Name: "edge", Permissions: models.PermissionMediaUpload}))
+
+	a := NewAuthMiddleware()
+	r := gin.New()
+	r.GET("/upload", a.RequireAuth(), a.RequirePermission(models.PermissionMediaUpload), func(c *gin.Context) {
+		p, _ := auth.PrincipalFrom(c)
+		require.Equal(t, auth.MethodClientCert, p.Method)
+		c.Status(http.StatusOK)
+	})
+
+	for name, status := range map[string]int{"edge": http.StatusOK, "unknown": http.StatusUnauthorized} {
+		// Act
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/upload", nil)
+		req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: name}}}}}
+		r.ServeHTTP(w, req)
+
+		// Assert
+		require.Equal(t, status, w.Code, name)
+	}
+}
+
+func TestRequireAuth_CustomAuthenticator(t *testing.T) {
+	// Arrange
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	custom := AuthenticatorFunc(func(c *gin.Context) (*auth.Principal, error) {
+		if c.GetHeader("X-Test-User") == "" {
+			return nil, ErrNoCredentials
+		}
+		return auth.UserPrincipal("test", &models.User{Email: c.GetHeader("X-Test-User"), Role: "admin"}), nil
+	})
+	a := NewAuthMiddleware(custom)
+	r := gin.New()
+	r.GET("/admin", a.RequireAuth(), a.RequireRole("admin"), func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString("user_email"))
+	})
+
+	// Act
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+	req.Header.Set("X-Test-User", "ops@example.com")
+	r.ServeHTTP(w, req)
+	missing := httptest.NewRecorder()
+	r.ServeHTTP(missing, httptest.NewRequest(http.MethodGet, "/admin", nil))
+
+	// Assert
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "ops@example.com", w.Body.String())
+	require.Equal(t, http.StatusUnauthorized, missing.Code)
+}
@@ -0,0 +1,139 @@
+package middleware
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kevinanielsen/go-fast-cdn/src/auth"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+)
+
+// JWTAuthenticator authenticates users with the access tokens sent as
+// "Authorization: Bearer <token>".
+func JWTAuthenticator(jwtService *auth.JWTService, userRepo models.UserRepository) Authenticator {
+	return AuthenticatorFunc(func(c *gin.Context) (*auth.Principal, error) {
+		authHeader := c.GetHeader("Authorization")
+		if authHeader == "" {
+			return nil, ErrNoCredentials
+		}
+
+		// Extract token from "Bearer <token>"
+		parts := strings.Split(authHeader, " ")
+		if len(parts) != 2 || parts[0] != "Bearer" {
+			return nil, problem.New(http.StatusUnauthorized, "", "Invalid authorization header format")
+		}
+
+		claims, err := jwtService.ValidateToken(parts[1])
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, problem.New(http.StatusUnauthorized, problem.CodeTokenExpired, "Token has expired")
+		}
+		if err != nil {
+			return nil, problem.New(http.StatusUnauthorized, problem.CodeTokenInvalid, "Invalid token")
+		}
+
+		// Get user from database to ensure they still exist and are active
+		user, err := userRepo.GetUserByID(c.Request.Context(), claims.UserID)
+		if err != nil {
+			return nil, problem.New(http.StatusUnauthorized, "", "User not found")
+		}
+		return auth.UserPrincipal(auth.MethodJWT, user), nil
+	})
+}
+
+// APIKeyAuthenticator authenticates service accounts with their API keys,
+// see apiKeyFromRequest.
+func APIKeyAuthenticator(serviceAccountRepo models.ServiceAccountRepository) Authenticator {
+	return AuthenticatorFunc(func(c *gin.Context) (*auth.Principal, error) {
+		apiKey := apiKeyFromRequest(c)
+		if apiKey == "" {
+			return nil, ErrNoCredentials
+		}
+
+		key, err := serviceAccountRepo.GetAPIKeyByHash(c.Request.Context(), auth.HashAPIKey(apiKey))
+		if err != nil || key.ServiceAccount.Disabled {
+			return nil, problem.New(http.StatusUnauthorized, "", "Invalid API key")
+		}
+		if err := serviceAccountRepo.TouchAPIKey(c.Request.Context(), key); err != nil {
+			log.Printf("[ERROR] Failed to update API key usage: %v", err)
+		}
+
+		account := key.ServiceAccount
+		return auth.ServiceAccountPrincipal(auth.MethodAPIKey, &account), nil
+	})
+}
+
+// apiKeyFromRequest returns the API key sent in the X-API-Key header, as a
+// bearer token or as the basic auth password of clients that support nothing
+// else, such as WebDAV clients, if any.
+func apiKeyFromRequest(c *gin.Context) string {
+	if key := c.GetHeader("X-API-Key"); key != "" {
+		return key
+	}
+	if token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok && auth.IsAPIKey(token) {
+		return token
+	}
+	if _, password, ok := c.Request.BasicAuth(); ok && auth.IsAPIKey(password) {
+		return password
+	}
+	return ""
+}
+
+// SignedURLAuthenticator authenticates GET and HEAD requests to URLs signed
+// with auth.JWTService.SignURL as the user or service account they were
+// signed for, as long as it still exists and isn't disabled.
+func SignedURLAuthenticator(jwtService *auth.JWTService, userRepo models.UserRepository, serviceAccountRepo models.ServiceAccountRepository) Authenticator {
+	return AuthenticatorFunc(func(c *gin.Context) (*auth.Principal, error) {
+		if c.Query(auth.SignedURLSignatureParam) == "" {
+			return nil, ErrNoCredentials
+		}
+		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			return nil, problem.New(http.StatusUnauthorized, "", "Signed URLs only allow GET requests")
+		}
+
+		id, err := jwtService.VerifySignedURL(c.Request.URL, time.Now())
+		if errors.Is(err, auth.ErrSignedURLExpired) {
+			return nil, problem.New(http.StatusUnauthorized, problem.CodeTokenExpired, "Signed URL has expired")
+		} else if err != nil {
+			return nil, problem.New(http.StatusUnauthorized, problem.CodeTokenInvalid, "Invalid signed URL")
+		}
+
+		kind, recordID, _ := auth.ParsePrincipalID(id)
+		if kind == "service_account" {
+			account, err := serviceAccountRepo.GetServiceAccountByID(c.Request.Context(), recordID)
+			if err != nil || account.Disabled {
+				return nil, problem.New(http.StatusUnauthorized, problem.CodeTokenInvalid, "Invalid signed URL")
+			}
+			return auth.ServiceAccountPrincipal(auth.MethodSignedURL, account), nil
+		}
+		user, err := userRepo.GetUserByID(c.Request.Context(), recordID)
+		if err != nil {
+			return nil, problem.New(http.StatusUnauthorized, problem.CodeTokenInvalid, "Invalid signed URL")
+		}
+		return auth.UserPrincipal(auth.MethodSignedURL, user), nil
+	})
+}
+
+// ClientCertAuthenticator authenticates service accounts with TLS client
+// certificates verified against TLS_CLIENT_CA_FILE. The common name of the
+// certificate is the name of the account.
+func ClientCertAuthenticator(serviceAccountRepo models.ServiceAccountRepository) Authenticator {
+	return AuthenticatorFunc(func(c *gin.Context) (*auth.Principal, error) {
+		state := c.Request.TLS
+		if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+			return nil, ErrNoCredentials
+		}
+
+		name := state.VerifiedChains[0][0].Subject.CommonName
+		account, err := serviceAccountRepo.GetServiceAccountByName(c.Request.Context(), name)
+		if err != nil || account.Disabled {
+			return nil, problem.New(http.StatusUnauthorized, "", "No service account for client certificate "+name)
+		}
+		return auth.ServiceAccountPrincipal(auth.MethodClientCert, account), nil
+	})
+}
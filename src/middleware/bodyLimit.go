@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"github.com/kevinanielsen/go-fast-cdn/src/settings"
+)
+
+// BodyLimit caps the request bodies of the routes it guards to the size in
+// bytes held by the setting with key, e.g. settings.MaxUploadBodySize.
+// Requests announcing a larger Content-Length are rejected with a 413 before
+// their body is read; chunked bodies fail once they read past the limit,
+// which handlers report as a 413 too. Changes of the setting apply to the
+// next request.
+func BodyLimit(key string) gin.HandlerFunc {
+	var limit atomic.Int64
+	settings.Default.Watch(key, func(value string) {
+		parsed, _ := strconv.ParseInt(value, 10, 64)
+		limit.Store(parsed)
+	})
+	return func(c *gin.Context) {
+		limit := limit.Load()
+		if limit <= 0 || c.Request.Body == nil {
+			c.Next()
+			return
+		}
+
+		if c.Request.ContentLength > limit {
+			// The body is not read, so the connection cannot be reused
+			c.Header("Connection", "close")
+			problem.Write(c, http.StatusRequestEntityTooLarge, "Request body is too large")
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		c.Next()
+	}
+}
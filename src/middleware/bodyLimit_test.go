@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"github.com/kevinanielsen/go-fast-cdn/src/settings"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBodyLimit(t *testing.T) {
+	t.Setenv("MAX_AUTH_BODY_SIZE", "64")
+
+	reached := false
+	r := gin.New()
+	r.POST("/login", BodyLimit(settings.MaxAuthBodySize), func(c *gin.Context) {
+		reached = true
+		var body struct {
+			Email string `json:"email"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			problem.Invalid(c, err)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+	login := func(body io.Reader) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/login", body))
+		return w
+	}
+
+	require.Equal(t, http.StatusOK, login(strings.NewReader(`{"email": "a@example.com"}`)).Code)
+
+	// Bodies announcing a larger size are rejected without reaching the
+	// handler
+	reached = false
+	large := `{"email": "` + strings.Repeat("a", 64) + `@example.com"}`
+	w := login(strings.NewReader(large))
+	require.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	require.Equal(t, "close", w.Header().Get("Connection"))
+	require.False(t, reached)
+
+	// Bodies of unknown size fail once they read past the limit
+	w = login(io.MultiReader(strings.NewReader(large)))
+	require.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	require.True(t, reached)
+}
+
+func TestBodyLimit_Multipart(t *testing.T) {
+	t.Setenv("MAX_UPLOAD_BODY_SIZE", "1024")
+
+	r := gin.New()
+	r.POST("/upload", BodyLimit(settings.MaxUploadBodySize), func(c *gin.Context) {
+		if _, err := c.FormFile("doc"); err != nil {
+			problem.Invalid(c, err)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+	upload := func(size int, chunked bool) int {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, err := writer.CreateFormFile("doc", "doc.txt")
+		require.NoError(t, err)
+		_, err = part.Write(bytes.Repeat([]byte("a"), size))
+		require.NoError(t, err)
+		require.NoError(t, writer.Close())
+
+		var reader io.Reader = body
+		if chunked {
+			reader = io.MultiReader(body)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/upload", reader)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	require.Equal(t, http.StatusOK, upload(512, false))
+	require.Equal(t, http.StatusOK, upload(512, true))
+	require.Equal(t, http.StatusRequestEntityTooLarge, upload(2048, false))
+	require.Equal(t, http.StatusRequestEntityTooLarge, upload(2048, true))
+}
@@ -1,19 +1,80 @@
 package middleware
 
-import "github.com/gin-gonic/gin"
+import (
+	"net/http"
+	"strings"
+	"sync/atomic"
 
-func CORSMiddleware() gin.HandlerFunc {
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+)
+
+// CORS applies the CORS policy stored in the config table. The policy is
+// cached and replaced by Update, so changes apply without a restart.
+type CORS struct {
+	repo   *database.ConfigRepo
+	policy atomic.Pointer[models.CORSPolicy]
+}
+
+// NewCORS loads the CORS policy from repo.
+func NewCORS(repo *database.ConfigRepo) *CORS {
+	cors := &CORS{repo: repo}
+	policy := repo.GetCORSPolicy()
+	cors.policy.Store(&policy)
+	return cors
+}
+
+// Policy returns the policy currently in effect.
+func (cors *CORS) Policy() models.CORSPolicy {
+	return *cors.policy.Load()
+}
+
+// Update stores policy and applies it to subsequent requests.
+func (cors *CORS) Update(policy models.CORSPolicy) error {
+	if err := cors.repo.SetCORSPolicy(policy); err != nil {
+		return err
+	}
+	cors.policy.Store(&policy)
+	return nil
+}
+
+// Middleware sets the CORS headers and answers preflight requests.
+func (cors *CORS) Middleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT")
+		policy := cors.policy.Load()
+
+		if origin := allowedOrigin(policy.AllowedOrigins, c.GetHeader("Origin")); origin != "" {
+			c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
+			if origin != "*" {
+				c.Writer.Header().Add("Vary", "Origin")
+			}
+			if policy.AllowCredentials {
+				c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+			c.Writer.Header().Set("Access-Control-Allow-Headers", strings.Join(policy.AllowedHeaders, ", "))
+			c.Writer.Header().Set("Access-Control-Allow-Methods", strings.Join(policy.AllowedMethods, ", "))
+		}
 
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
+		if c.Request.Method == http.MethodOptions {
+			c.AbortWithStatus(http.StatusNoContent)
 			return
 		}
 
 		c.Next()
 	}
 }
+
+// allowedOrigin returns the value of Access-Control-Allow-Origin for a
+// request from origin, or an empty string if the origin is not allowed.
+func allowedOrigin(allowed []string, origin string) string {
+	for _, candidate := range allowed {
+		if candidate == "*" {
+			return "*"
+		}
+		if origin != "" && strings.EqualFold(candidate, origin) {
+			return origin
+		}
+	}
+	return ""
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCORS_Update(t *testing.T) {
+	// Arrange
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	cors := NewCORS(database.NewConfigRepo(database.DB))
+	r := gin.New()
+	r.Use(cors.Middleware())
+	r.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	request := func(origin string) http.Header {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Origin", origin)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Header()
+	}
+
+	// Act & Assert
+	require.Equal(t, "*", request("https://app.example.com").Get("Access-Control-Allow-Origin"))
+
+	require.NoError(t, cors.Update(models.CORSPolicy{
+		AllowedOrigins: []string{"https://app.example.com"},
+		AllowedMethods: []string{"GET", "DELETE"},
+		AllowedHeaders: []string{"Authorization"},
+	}))
+
+	allowed := request("https://app.example.com")
+	require.Equal(t, "https://app.example.com", allowed.Get("Access-Control-Allow-Origin"))
+	require.Equal(t, "GET, DELETE", allowed.Get("Access-Control-Allow-Methods"))
+	require.Empty(t, allowed.Get("Access-Control-Allow-Credentials"))
+	require.Empty(t, request("https://evil.example.com").Get("Access-Control-Allow-Origin"))
+
+	// The policy survives a restart
+	reloaded := NewCORS(database.NewConfigRepo(database.DB)).Policy()
+	require.Equal(t, []string{"https://app.example.com"}, reloaded.AllowedOrigins)
+	require.False(t, reloaded.AllowCredentials)
+}
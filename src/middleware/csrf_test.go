@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/auth"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCSRF(t *testing.T) {
+	// Arrange
+	r := gin.New()
+	r.Use(CSRF())
+	r.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.POST("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+	token := auth.NewJWTService().CSRFToken("refresh")
+
+	tests := []struct {
+		name   string
+		method string
+		cookie bool
+		header string
+		want   int
+	}{
+		{"safe method", http.MethodGet, true, "", http.StatusOK},
+		{"no cookie", http.MethodPost, false, "", http.StatusOK},
+		{"missing token", http.MethodPost, true, "", http.StatusForbidden},
+		{"wrong token", http.MethodPost, true, "wrong", http.StatusForbidden},
+		{"valid token", http.MethodPost, true, token, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			req := httptest.NewRequest(tt.method, "/", nil)
+			if tt.cookie {
+				req.AddCookie(&http.Cookie{Name: auth.RefreshCookieName, Value: "refresh"})
+			}
+			if tt.header != "" {
+				req.Header.Set(auth.CSRFHeaderName, tt.header)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			// Assert
+			require.Equal(t, tt.want, w.Code)
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/kevinanielsen/go-fast-cdn/src/validations"
+)
+
+// DownloadHeaders sets the Content-Type and Content-Disposition of
+// downloads from the media records.
+//
+// The Content-Type is the MIME type detected when the file was stored,
+// detected and recorded on the first download after the content changed,
+// and sent with X-Content-Type-Options: nosniff so browsers do not guess.
+//
+// Files are named after their download name or the name they were uploaded
+// with, see util.NamingStrategy, and presented with their default
+// disposition. Requests override both with ?download=1 for an attachment,
+// ?download=0 to display the file inline, and ?name=custom-name.ext.
+func DownloadHeaders(images models.ImageRepository, docs models.DocRepository, mediaType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("X-Content-Type-Options", "nosniff")
+		fileName := requestedFileName(c)
+		if fileName == "" {
+			c.Next()
+			return
+		}
+
+		ctx := c.Request.Context()
+		found := false
+		disposition, name, mimeType := "", fileName, ""
+		switch mediaType {
+		case models.MediaTypeImage:
+			if image, err := images.GetImageByFileName(ctx, fileName); err == nil {
+				found = true
+				disposition, name = image.Disposition, util.DefaultDownloadName(fileName, image.DownloadName, image.OriginalName)
+				mimeType = image.MimeType
+			}
+		case models.MediaTypeDoc:
+			if doc, err := docs.GetDocByFileName(ctx, fileName); err == nil {
+				found = true
+				disposition, name = doc.Disposition, util.DefaultDownloadName(fileName, doc.DownloadName, doc.OriginalName)
+				mimeType = doc.MimeType
+			}
+		}
+
+		if found && mimeType == "" {
+			mimeType = detectMimeType(ctx, images, docs, mediaType, fileName)
+		}
+		if mimeType != "" {
+			c.Header("Content-Type", mimeType)
+		}
+
+		if custom := util.DownloadName(c.Query("name")); custom != "" {
+			name = custom
+			if filepath.Ext(name) == "" {
+				name += filepath.Ext(fileName)
+			}
+		}
+		if download, err := strconv.ParseBool(c.Query("download")); err == nil {
+			disposition = models.DispositionInline
+			if download {
+				disposition = models.DispositionAttachment
+			}
+		}
+		if disposition == "" {
+			disposition = models.DispositionInline
+		}
+
+		if disposition != models.DispositionInline || name != fileName {
+			c.Header("Content-Disposition", util.ContentDisposition(disposition, name))
+		}
+		c.Next()
+	}
+}
+
+// detectMimeType detects the MIME type of a stored file and records it, so
+// later downloads skip the detection. It returns an empty string if the file
+// cannot be read.
+func detectMimeType(ctx context.Context, images models.ImageRepository, docs models.DocRepository, mediaType, fileName string) string {
+	file, err := os.Open(filepath.Join(util.ExPath, "uploads", models.MediaFolder(mediaType), fileName))
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+	header := make([]byte, 512)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return ""
+	}
+	mimeType := validations.DetectMimeType(fileName, header[:n])
+
+	if mediaType == models.MediaTypeImage {
+		err = images.UpdateImageMimeType(ctx, fileName, mimeType)
+	} else {
+		err = docs.UpdateDocMimeType(ctx, fileName, mimeType)
+	}
+	if err != nil {
+		log.Printf("Failed to record the MIME type of %s: %s\n", fileName, err.Error())
+	}
+	return mimeType
+}
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadHeaders(t *testing.T) {
+	// Arrange
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	require.NoError(t, database.DB.Create(&models.Doc{FileName: "3f2a.pdf", OriginalName: "Rapport été.pdf", Checksum: []byte("a")}).Error)
+	require.NoError(t, database.DB.Create(&models.Doc{FileName: "notes.pdf", OriginalName: "notes.pdf", Checksum: []byte("b")}).Error)
+	require.NoError(t, database.DB.Create(&models.Doc{FileName: "form.pdf", Disposition: models.DispositionAttachment, DownloadName: "Form 2024.pdf", Checksum: []byte("c")}).Error)
+
+	r := gin.New()
+	r.GET("/docs/*filepath", DownloadHeaders(database.NewImageRepo(database.DB), database.NewDocRepo(database.DB), models.MediaTypeDoc), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	disposition := func(target string) string {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w.Header().Get("Content-Disposition")
+	}
+
+	// Act & Assert
+	require.Equal(t, `inline; filename="Rapport ete.pdf"; filename*=UTF-8''Rapport%20%C3%A9t%C3%A9.pdf`, disposition("/docs/3f2a.pdf"))
+	require.Empty(t, disposition("/docs/notes.pdf"))
+	require.Equal(t, `attachment; filename="notes.pdf"`, disposition("/docs/notes.pdf?download=true"))
+	require.Equal(t, `attachment; filename="missing.pdf"`, disposition("/docs/missing.pdf?download=1"))
+	require.Equal(t, `attachment; filename="custom-name.pdf"`, disposition("/docs/notes.pdf?download=1&name=../custom-name"))
+
+	// Per-file defaults apply unless the request overrides them
+	require.Equal(t, `attachment; filename="Form 2024.pdf"`, disposition("/docs/form.pdf"))
+	require.Equal(t, `inline; filename="Form 2024.pdf"`, disposition("/docs/form.pdf?download=0"))
+}
+
+func TestDownloadHeaders_MimeType(t *testing.T) {
+	// Arrange
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	docsDir := filepath.Join(util.ExPath, "uploads", "docs")
+	require.NoError(t, os.MkdirAll(docsDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(docsDir, "prices.csv"), []byte("item,price\ncafé,2\n"), 0o644))
+	require.NoError(t, database.DB.Create(&models.Doc{FileName: "prices.csv", Checksum: []byte("a")}).Error)
+	require.NoError(t, database.DB.Create(&models.Doc{FileName: "stored.txt", MimeType: "application/pdf", Checksum: []byte("b")}).Error)
+
+	docs := database.NewDocRepo(database.DB)
+	r := gin.New()
+	r.GET("/docs/*filepath", DownloadHeaders(database.NewImageRepo(database.DB), docs, models.MediaTypeDoc), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	get := func(target string) http.Header {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w.Header()
+	}
+
+	// Act & Assert
+	header := get("/docs/prices.csv")
+	require.Equal(t, "text/csv; charset=utf-8", header.Get("Content-Type"))
+	require.Equal(t, "nosniff", header.Get("X-Content-Type-Options"))
+	doc, err := docs.GetDocByFileName(context.Background(), "prices.csv")
+	require.NoError(t, err)
+	require.Equal(t, "text/csv; charset=utf-8", doc.MimeType)
+
+	require.Equal(t, "application/pdf", get("/docs/stored.txt").Get("Content-Type"))
+	require.Empty(t, get("/docs/unknown.txt").Get("Content-Type"))
+}
@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+)
+
+// Hotlink applies the hotlink policy stored in the config table to
+// downloads. Like CORS, the policy is cached and replaced by Update.
+type Hotlink struct {
+	repo   *database.ConfigRepo
+	policy atomic.Pointer[models.HotlinkPolicy]
+}
+
+// NewHotlink loads the hotlink policy from repo.
+func NewHotlink(repo *database.ConfigRepo) *Hotlink {
+	hotlink := &Hotlink{repo: repo}
+	policy := repo.GetHotlinkPolicy()
+	hotlink.policy.Store(&policy)
+	return hotlink
+}
+
+// Policy returns the policy currently in effect.
+func (hotlink *Hotlink) Policy() models.HotlinkPolicy {
+	return *hotlink.policy.Load()
+}
+
+// Update stores policy and applies it to subsequent requests.
+func (hotlink *Hotlink) Update(policy models.HotlinkPolicy) error {
+	if err := hotlink.repo.SetHotlinkPolicy(policy); err != nil {
+		return err
+	}
+	hotlink.policy.Store(&policy)
+	return nil
+}
+
+// Middleware rejects downloads of mediaType linked from sites the policy
+// does not allow, with a 403 or a placeholder image.
+func (hotlink *Hotlink) Middleware(mediaType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rule := hotlink.policy.Load().Rule(mediaType)
+		if !rule.Enabled || (c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead) {
+			c.Next()
+			return
+		}
+
+		if hotlinkAllowed(rule, c.Request) {
+			c.Next()
+			return
+		}
+
+		// Shared caches must not serve the rejection to allowed sites
+		c.Header("Cache-Control", "no-store")
+		if rule.Action == models.HotlinkActionPlaceholder && mediaType == models.MediaTypeImage {
+			c.Data(http.StatusOK, "image/png", placeholderImage())
+			c.Abort()
+			return
+		}
+		problem.Write(c, http.StatusForbidden, "Hotlinking is not allowed")
+	}
+}
+
+// hotlinkAllowed reports whether rule allows the site linking to r, taken
+// from its Origin or, without one, its Referer.
+func hotlinkAllowed(rule models.HotlinkRule, r *http.Request) bool {
+	source := r.Header.Get("Origin")
+	if source == "" || source == "null" {
+		source = r.Header.Get("Referer")
+	}
+	if source == "" {
+		return rule.AllowEmpty
+	}
+	u, err := url.Parse(source)
+	if err != nil || u.Hostname() == "" {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	return host == requestHost(r) || hostAllowed(rule.AllowedHosts, host)
+}
+
+func requestHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	return strings.ToLower(host)
+}
+
+// hostAllowed reports whether host is in allowed, where "*.example.com"
+// matches the subdomains of example.com.
+func hostAllowed(allowed []string, host string) bool {
+	for _, candidate := range allowed {
+		candidate = strings.ToLower(candidate)
+		if suffix, ok := strings.CutPrefix(candidate, "*"); ok {
+			if strings.HasSuffix(host, suffix) {
+				return true
+			}
+		} else if host == candidate {
+			return true
+		}
+	}
+	return false
+}
+
+// placeholderImage returns a transparent 1x1 PNG.
+var placeholderImage = sync.OnceValue(func() []byte {
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 1, 1)))
+	return buf.Bytes()
+})
@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHotlink(t *testing.T) {
+	// Arrange
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	hotlink := NewHotlink(database.NewConfigRepo(database.DB))
+	r := gin.New()
+	r.GET("/images/:name", hotlink.Middleware(models.MediaTypeImage), func(c *gin.Context) { c.String(http.StatusOK, "image") })
+	r.GET("/docs/:name", hotlink.Middleware(models.MediaTypeDoc), func(c *gin.Context) { c.String(http.StatusOK, "doc") })
+
+	request := func(target string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Host = "cdn.example.com:8080"
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	evil := map[string]string{"Referer": "https://evil.example.org/page"}
+
+	// Act & Assert
+	require.Equal(t, http.StatusOK, request("/images/a.png", evil).Code)
+
+	require.NoError(t, hotlink.Update(models.HotlinkPolicy{
+		HotlinkRule: models.HotlinkRule{Enabled: true, AllowedHosts: []string{"*.example.com"}, Action: models.HotlinkActionForbid},
+		Overrides: map[string]models.HotlinkRule{
+			models.MediaTypeImage: {Enabled: true, AllowedHosts: []string{"blog.example.net"}, AllowEmpty: true, Action: models.HotlinkActionPlaceholder},
+		},
+	}))
+
+	require.Equal(t, http.StatusForbidden, request("/docs/a.pdf", evil).Code)
+	require.Equal(t, http.StatusForbidden, request("/docs/a.pdf", nil).Code)
+	require.Equal(t, "doc", request("/docs/a.pdf", map[string]string{"Origin": "https://app.example.com"}).Body.String())
+	require.Equal(t, "doc", request("/docs/a.pdf", map[string]string{"Referer": "http://cdn.example.com:8080/dashboard"}).Body.String())
+
+	placeholder := request("/images/a.png", evil)
+	require.Equal(t, http.StatusOK, placeholder.Code)
+	require.Equal(t, "image/png", placeholder.Header().Get("Content-Type"))
+	require.Equal(t, "no-store", placeholder.Header().Get("Cache-Control"))
+	require.Equal(t, "image", request("/images/a.png", nil).Body.String())
+	require.Equal(t, "image", request("/images/a.png", map[string]string{"Referer": "https://blog.example.net/post"}).Body.String())
+
+	// The policy survives a restart
+	reloaded := NewHotlink(database.NewConfigRepo(database.DB)).Policy()
+	require.Equal(t, models.HotlinkActionPlaceholder, reloaded.Rule(models.MediaTypeImage).Action)
+	require.Equal(t, []string{"*.example.com"}, reloaded.Rule(models.MediaTypeDoc).AllowedHosts)
+}
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"github.com/kevinanielsen/go-fast-cdn/src/settings"
+)
+
+// AbortIfStale checks the If-Match header of a request changing a media
+// against version, see models.MediaVersion, or "" if it has no record, so two
+// admins editing the same file do not overwrite each other's changes. It
+// aborts the request with 412 if the header does not match, or with 428 if
+// it is missing and the require_if_match setting is on, and reports whether
+// it did.
+func AbortIfStale(c *gin.Context, version string) bool {
+	header := c.GetHeader("If-Match")
+	if header == "" {
+		if settings.Default.Bool(settings.RequireIfMatch) {
+			problem.Write(c, http.StatusPreconditionRequired, "Send the version of the media in If-Match")
+			return true
+		}
+		return false
+	}
+
+	if ifMatch(header, version) {
+		return false
+	}
+	if version != "" {
+		c.Header("ETag", ETag(version))
+	}
+	AbortStale(c)
+	return true
+}
+
+// Unchanged returns the context to change a media last updated at updatedAt
+// with, after AbortIfStale accepted the request. If the request sent
+// If-Match, repositories only make the changes while the media is still
+// unchanged, see models.IfUnchanged, since another request may have changed
+// it after it was checked. Their models.ErrStale is answered with
+// AbortStale.
+func Unchanged(c *gin.Context, updatedAt time.Time) context.Context {
+	ctx := c.Request.Context()
+	if c.GetHeader("If-Match") == "" || updatedAt.IsZero() {
+		return ctx
+	}
+	return models.IfUnchanged(ctx, updatedAt)
+}
+
+// AbortStale aborts a request changing a media that was changed since the
+// version the request was based on with 412.
+func AbortStale(c *gin.Context) {
+	problem.Write(c, http.StatusPreconditionFailed, "The media was changed since it was read")
+}
+
+// ETag returns the entity tag of a media version.
+func ETag(version string) string {
+	return `"` + version + `"`
+}
+
+// ifMatch reports whether the If-Match header matches version. Versions are
+// also accepted without quotes, as shown in the metadata.
+func ifMatch(header, version string) bool {
+	if version == "" {
+		return false
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.Trim(tag, `"`) == version {
+			return true
+		}
+	}
+	return false
+}
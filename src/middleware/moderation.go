@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/auth"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+)
+
+// Moderation answers requests for files awaiting approval or rejected by an
+// admin with 403, so uploads held back by moderation are not served
+// publicly. Admins may still fetch them to review them, when OptionalAuth
+// runs first.
+func Moderation(images models.ImageRepository, docs models.DocRepository, mediaType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		fileName := requestedFileName(c)
+		if fileName == "" {
+			c.Next()
+			return
+		}
+
+		if AbortIfNotApproved(c, images, docs, mediaType, fileName) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// AbortIfNotApproved aborts the request with 403 if the file awaits approval
+// or was rejected and the request is not made by an admin, for handlers that
+// resolve the file themselves. Files without a record are left to the
+// handler.
+func AbortIfNotApproved(c *gin.Context, images models.ImageRepository, docs models.DocRepository, mediaType, fileName string) bool {
+	ctx := c.Request.Context()
+	var status string
+	if mediaType == models.MediaTypeImage {
+		image, err := images.GetImageByFileName(ctx, fileName)
+		if err != nil {
+			return false
+		}
+		status = image.ModerationStatus
+	} else {
+		doc, err := docs.GetDocByFileName(ctx, fileName)
+		if err != nil {
+			return false
+		}
+		status = doc.ModerationStatus
+	}
+	if models.ModerationApproved(status) {
+		return false
+	}
+
+	if principal, ok := auth.PrincipalFrom(c); ok && principal.Role == "admin" {
+		// Keep shared caches from serving the file to anyone else
+		c.Header("Cache-Control", "private, no-store")
+		return false
+	}
+	problem.Abort(c, problem.New(http.StatusForbidden, problem.CodeMediaNotApproved, "Media has not been approved").
+		With("moderation_status", status))
+	return true
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/hooks"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/policy"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+)
+
+// Policy applies the download rules of policy.Default, rejecting or
+// redirecting the download of the first rule that applies. It needs
+// OptionalAuth to run first for rules about the user.
+func Policy(images models.ImageRepository, docs models.DocRepository, mediaType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		fileName := requestedFileName(c)
+		if fileName == "" || !policy.Default.Applies(policy.EventDownload) {
+			c.Next()
+			return
+		}
+
+		m := hooks.Media{
+			Type: mediaType, FileName: fileName,
+			Actor: c.GetString("user_email"), Role: c.GetString("user_role"),
+			IP: c.ClientIP(), Request: c.Request,
+		}
+		ctx := c.Request.Context()
+		if mediaType == models.MediaTypeImage {
+			if image, err := images.GetImageByFileName(ctx, fileName); err == nil {
+				m.UUID, m.MimeType, m.OrganizationID = image.UUID, image.MimeType, image.OrganizationID
+			}
+		} else if doc, err := docs.GetDocByFileName(ctx, fileName); err == nil {
+			m.UUID, m.MimeType, m.OrganizationID = doc.UUID, doc.MimeType, doc.OrganizationID
+		}
+		m = hooks.Stored(m)
+
+		d, err := policy.Default.Evaluate(policy.EventDownload, m)
+		if err != nil {
+			log.Printf("Failed to evaluate policy for %s: %s\n", fileName, err.Error())
+			problem.Write(c, http.StatusInternalServerError, "Failed to evaluate policy")
+			return
+		}
+		switch {
+		case d == nil:
+			c.Next()
+		case d.Redirect != "":
+			c.Redirect(http.StatusFound, d.Redirect)
+			c.Abort()
+		default:
+			status := d.Status
+			if status == 0 {
+				status = http.StatusForbidden
+			}
+			problem.Abort(c, problem.New(status, problem.CodeMediaRejected, d.Reject).With("rule", d.Rule))
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/policy"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicy(t *testing.T) {
+	// Arrange
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	images := database.NewImageRepo(database.DB)
+	orgID := uint(7)
+	_, err := images.AddImage(context.Background(), models.Image{FileName: "acme.png", Checksum: []byte("a"), OrganizationID: &orgID})
+	require.NoError(t, err)
+
+	p, err := policy.Parse([]byte(`
+rules:
+  - name: acme-only
+    on: [download]
+    when: media.organization_id == 7 && !has_suffix(header("Referer"), "acme.example/")
+    reject: Only acme.example may embed {{ media.file_name }}
+  - name: moved
+    on: [download]
+    when: has_prefix(media.file_name, "old-")
+    redirect: '"/api/cdn/download/images/" + media.file_name'
+`))
+	require.NoError(t, err)
+	policy.Default = p
+	t.Cleanup(func() { policy.Default = nil })
+
+	r := gin.New()
+	r.GET("/images/*filepath", Policy(images, database.NewDocRepo(database.DB), models.MediaTypeImage), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	get := func(target, referer string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Referer", referer)
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// Act & Assert
+	w := get("/images/acme.png", "https://evil.example/")
+	require.Equal(t, http.StatusForbidden, w.Code)
+	require.Contains(t, w.Body.String(), "Only acme.example may embed acme.png")
+	require.Equal(t, http.StatusOK, get("/images/acme.png", "https://acme.example/").Code)
+	require.Equal(t, http.StatusOK, get("/images/other.png", "").Code)
+	w = get("/images/old-logo.png", "")
+	require.Equal(t, http.StatusFound, w.Code)
+	require.Equal(t, "/api/cdn/download/images/old-logo.png", w.Header().Get("Location"))
+}
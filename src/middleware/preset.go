@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+)
+
+// UploadPreset resolves the preset selected with ?preset=<name> and stores it
+// in the context as "upload_preset" for the upload handlers, together with
+// the transform preset it links to. Unknown presets and presets restricted
+// to another media type are rejected.
+func UploadPreset(repo models.UploadPresetRepository, transforms models.TransformPresetRepository, mediaType string) gin.HandlerFunc {
+	return UploadPresetOrDefault(repo, transforms, mediaType, "")
+}
+
+// UploadPresetOrDefault works like UploadPreset but falls back to the preset
+// named fallback when the request does not select one. A fallback that does
+// not exist is ignored.
+func UploadPresetOrDefault(repo models.UploadPresetRepository, transforms models.TransformPresetRepository, mediaType, fallback string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := c.Query("preset")
+		if name == "" {
+			if fallback != "" {
+				if preset, err := repo.GetPresetByName(c.Request.Context(), fallback); err == nil && (preset.MediaType == "" || preset.MediaType == mediaType) {
+					if !resolveTransform(c, transforms, preset) {
+						return
+					}
+					c.Set("upload_preset", preset)
+				}
+			}
+			c.Next()
+			return
+		}
+
+		preset, err := repo.GetPresetByName(c.Request.Context(), name)
+		if err != nil {
+			problem.Write(c, http.StatusBadRequest, "Unknown upload preset: "+name)
+			return
+		}
+
+		if preset.MediaType != "" && preset.MediaType != mediaType {
+			problem.Write(c, http.StatusBadRequest, "Upload preset "+name+" cannot be used for this media type")
+			return
+		}
+
+		if !resolveTransform(c, transforms, preset) {
+			return
+		}
+		c.Set("upload_preset", preset)
+		c.Next()
+	}
+}
+
+// resolveTransform loads the transform preset linked to preset, writing a
+// problem if it was deleted since
+func resolveTransform(c *gin.Context, transforms models.TransformPresetRepository, preset *models.UploadPreset) bool {
+	if preset.TransformPreset == "" {
+		return true
+	}
+	transform, err := transforms.GetTransformPresetByName(c.Request.Context(), preset.TransformPreset)
+	if err != nil {
+		problem.Write(c, http.StatusConflict, "Upload preset "+preset.Name+" uses the missing transform preset "+preset.TransformPreset)
+		return false
+	}
+	preset.Transform = transform
+	return true
+}
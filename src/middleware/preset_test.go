@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUploadPreset(t *testing.T) {
+	// Arrange
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	presets := database.NewPresetRepo(database.DB)
+	transforms := database.NewTransformPresetRepo(database.DB)
+	ctx := context.Background()
+	require.NoError(t, transforms.CreateTransformPreset(ctx, &models.TransformPreset{Name: "square", Width: 64, Height: 64}))
+	require.NoError(t, presets.CreatePreset(ctx, &models.UploadPreset{Name: "avatar", MediaType: models.MediaTypeImage, TransformPreset: "square"}))
+	require.NoError(t, presets.CreatePreset(ctx, &models.UploadPreset{Name: "contract", MediaType: models.MediaTypeDoc}))
+	require.NoError(t, presets.CreatePreset(ctx, &models.UploadPreset{Name: "banner", TransformPreset: "wide"}))
+
+	var selected *models.UploadPreset
+	r := gin.New()
+	r.POST("/image", UploadPreset(presets, transforms, models.MediaTypeImage), func(c *gin.Context) {
+		selected = nil
+		if preset, ok := c.Get("upload_preset"); ok {
+			selected = preset.(*models.UploadPreset)
+		}
+		c.Status(http.StatusOK)
+	})
+	upload := func(query string) int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/image"+query, nil))
+		return w.Code
+	}
+
+	// Act & Assert
+	require.Equal(t, http.StatusOK, upload("?preset=avatar"))
+	require.NotNil(t, selected.Transform)
+	require.Equal(t, 64, selected.Transform.Width)
+	require.Equal(t, http.StatusOK, upload(""))
+	require.Nil(t, selected)
+
+	require.Equal(t, http.StatusBadRequest, upload("?preset=missing"))
+	require.Equal(t, http.StatusBadRequest, upload("?preset=contract"))
+	// The linked transform preset was deleted
+	require.Equal(t, http.StatusConflict, upload("?preset=banner"))
+}
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"github.com/kevinanielsen/go-fast-cdn/src/settings"
+	"github.com/kevinanielsen/go-fast-cdn/src/state"
+)
+
+// RateLimit rejects clients sending more than limit requests per window to
+// the routes it guards. Clients are told apart by IP address and name keeps
+// the counters of different route groups apart. The counters live in
+// state.Limiter, so they are shared by all instances when Redis is
+// configured. A limit of 0 disables the check.
+func RateLimit(name string, limit int, window time.Duration) gin.HandlerFunc {
+	return rateLimit(name, func() int { return limit }, window)
+}
+
+// rateLimit is RateLimit with a limit that can change between requests.
+func rateLimit(name string, limit func() int, window time.Duration) gin.HandlerFunc {
+	return rateLimitBy(func(c *gin.Context) string { return name + ":" + c.ClientIP() }, limit, window)
+}
+
+// rateLimitBy is rateLimit with counters keyed by key.
+func rateLimitBy(key func(c *gin.Context) string, limit func() int, window time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := limit()
+		if limit <= 0 {
+			c.Next()
+			return
+		}
+
+		allowed, retryAfter := state.Limiter.Allow(key(c), limit, window)
+		if !allowed {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			problem.Write(c, http.StatusTooManyRequests, "Too many requests, try again later")
+			return
+		}
+		c.Next()
+	}
+}
+
+// AuthRateLimit limits login and registration attempts per client to the
+// auth_rate_limit setting per minute, AUTH_RATE_LIMIT or 20 by default.
+// Changes of the setting apply to the next request.
+func AuthRateLimit() gin.HandlerFunc {
+	return rateLimit("auth", authRateLimit(), time.Minute)
+}
+
+// ShareRateLimit limits the requests of each client to a share link like
+// AuthRateLimit, so the password of a link cannot be guessed faster than
+// the password of an account. Counters are kept per link and client.
+func ShareRateLimit() gin.HandlerFunc {
+	return rateLimitBy(func(c *gin.Context) string {
+		return "share:" + c.Param("token") + ":" + c.ClientIP()
+	}, authRateLimit(), time.Minute)
+}
+
+// authRateLimit returns the current auth_rate_limit setting.
+func authRateLimit() func() int {
+	var limit atomic.Int64
+	settings.Default.Watch(settings.AuthRateLimit, func(value string) {
+		parsed, _ := strconv.Atoi(value)
+		limit.Store(int64(parsed))
+	})
+	return func() int { return int(limit.Load()) }
+}
@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/settings"
+	"github.com/kevinanielsen/go-fast-cdn/src/state"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimit(t *testing.T) {
+	state.Limiter = state.NewMemoryRateLimiter()
+
+	r := gin.New()
+	r.POST("/login", RateLimit("test", 2, time.Minute), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	login := func(ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/login", nil)
+		req.RemoteAddr = ip + ":1234"
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	require.Equal(t, http.StatusOK, login("10.0.0.1").Code)
+	require.Equal(t, http.StatusOK, login("10.0.0.1").Code)
+	w := login("10.0.0.1")
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	require.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	require.Equal(t, http.StatusOK, login("10.0.0.2").Code)
+}
+
+func TestAuthRateLimit(t *testing.T) {
+	state.Limiter = state.NewMemoryRateLimiter()
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	require.NoError(t, settings.Default.Load(database.NewConfigRepo(database.DB)))
+	limit := "1"
+	require.NoError(t, settings.Default.Update(map[string]*string{settings.AuthRateLimit: &limit}))
+	t.Cleanup(func() { settings.Default.Update(map[string]*string{settings.AuthRateLimit: nil}) })
+
+	r := gin.New()
+	r.POST("/login", AuthRateLimit(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	login := func() int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/login", nil))
+		return w.Code
+	}
+
+	require.Equal(t, http.StatusOK, login())
+	require.Equal(t, http.StatusTooManyRequests, login())
+
+	// Raising the limit applies to the next request
+	limit = "0"
+	require.NoError(t, settings.Default.Update(map[string]*string{settings.AuthRateLimit: &limit}))
+	require.Equal(t, http.StatusOK, login())
+}
+
+func TestShareRateLimit(t *testing.T) {
+	state.Limiter = state.NewMemoryRateLimiter()
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	require.NoError(t, settings.Default.Load(database.NewConfigRepo(database.DB)))
+	limit := "2"
+	require.NoError(t, settings.Default.Update(map[string]*string{settings.AuthRateLimit: &limit}))
+	t.Cleanup(func() { settings.Default.Update(map[string]*string{settings.AuthRateLimit: nil}) })
+
+	r := gin.New()
+	shares := r.Group("/s/:token", ShareRateLimit())
+	shares.GET("", func(c *gin.Context) { c.Status(http.StatusOK) })
+	shares.POST("", func(c *gin.Context) { c.Status(http.StatusOK) })
+	shares.GET("/info", func(c *gin.Context) { c.Status(http.StatusOK) })
+	request := func(method, path, ip string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = ip + ":1234"
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	require.Equal(t, http.StatusOK, request(http.MethodPost, "/s/abc", "10.0.0.1"))
+	require.Equal(t, http.StatusOK, request(http.MethodGet, "/s/abc/info", "10.0.0.1"))
+	require.Equal(t, http.StatusTooManyRequests, request(http.MethodGet, "/s/abc", "10.0.0.1"))
+
+	// Other links and clients have their own counters
+	require.Equal(t, http.StatusOK, request(http.MethodPost, "/s/def", "10.0.0.1"))
+	require.Equal(t, http.StatusOK, request(http.MethodPost, "/s/abc", "10.0.0.2"))
+}
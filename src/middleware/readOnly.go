@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+)
+
+// ReadOnly rejects every request that could modify data. The listed paths
+// stay writable, e.g. so users can still log in.
+func ReadOnly(allowedPaths ...string) gin.HandlerFunc {
+	allowed := make(map[string]bool, len(allowedPaths))
+	for _, path := range allowedPaths {
+		allowed[path] = true
+	}
+
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+		if allowed[c.Request.URL.Path] {
+			c.Next()
+			return
+		}
+
+		problem.Write(c, http.StatusMethodNotAllowed, "This server is read-only")
+	}
+}
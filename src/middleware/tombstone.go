@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+)
+
+// Tombstone answers requests for files that were taken down with the status
+// and reason recorded for the takedown instead of a generic 404.
+func Tombstone(repo models.TakedownRepository, mediaType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		fileName := requestedFileName(c)
+		if fileName == "" {
+			c.Next()
+			return
+		}
+
+		if AbortIfTakenDown(c, repo, mediaType, fileName) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// AbortIfTakenDown aborts the request with the takedown status and reason if
+// the file was taken down, for handlers that resolve the file themselves.
+func AbortIfTakenDown(c *gin.Context, repo models.TakedownRepository, mediaType, fileName string) bool {
+	takedown, err := repo.GetTakedown(c.Request.Context(), mediaType, fileName)
+	if err != nil {
+		return false
+	}
+
+	if takedown.Status == http.StatusUnavailableForLegalReasons && takedown.BlockedBy != "" {
+		c.Header("Link", "<"+takedown.BlockedBy+`>; rel="blocked-by"`)
+	}
+	problem.Abort(c, problem.New(takedown.Status, problem.CodeMediaTakenDown, http.StatusText(takedown.Status)).
+		With("reason_code", takedown.ReasonCode).
+		With("reason", takedown.Reason).
+		With("taken_down_at", takedown.CreatedAt))
+	return true
+}
+
+// requestedFileName returns the file a media route was called for, taken from
+// the "filename" route parameter or "filepath" for static routes.
+func requestedFileName(c *gin.Context) string {
+	if fileName := c.Param("filename"); fileName != "" {
+		return fileName
+	}
+	return strings.TrimPrefix(c.Param("filepath"), "/")
+}
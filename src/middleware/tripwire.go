@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/alert"
+	"github.com/kevinanielsen/go-fast-cdn/src/audit"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+)
+
+// tripwireAlertInterval limits alerts to one per requester and tripwire in
+// this window so a scraper cannot flood the webhook. Every hit is still
+// written to the audit log.
+const tripwireAlertInterval = time.Minute
+
+// TripwireMonitor raises alerts when honeypot files are requested.
+type TripwireMonitor struct {
+	repo models.TripwireRepository
+
+	mu        sync.Mutex
+	lastAlert map[string]time.Time
+}
+
+func NewTripwireMonitor(repo models.TripwireRepository) *TripwireMonitor {
+	return &TripwireMonitor{
+		repo:      repo,
+		lastAlert: make(map[string]time.Time),
+	}
+}
+
+// Watch returns middleware that checks requests for mediaType files against
+// the tripwires. Matching requests are audited and alerted on, then served
+// as usual so the requester is not tipped off.
+func (m *TripwireMonitor) Watch(mediaType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if fileName := requestedFileName(c); fileName != "" {
+			m.Check(c, mediaType, fileName)
+		}
+		c.Next()
+	}
+}
+
+// Check audits and alerts on the request if fileName matches a tripwire, for
+// handlers that resolve the file themselves.
+func (m *TripwireMonitor) Check(c *gin.Context, mediaType, fileName string) {
+	tripwires, err := m.repo.GetAllTripwires(c.Request.Context())
+	if err != nil {
+		log.Printf("[ERROR] Failed to load tripwires: %v", err)
+		return
+	}
+
+	for _, tripwire := range tripwires {
+		if tripwire.MediaType != "" && tripwire.MediaType != mediaType {
+			continue
+		}
+		if matched, _ := path.Match(tripwire.Pattern, fileName); matched {
+			m.trip(c, tripwire, mediaType+"/"+fileName)
+			return
+		}
+	}
+}
+
+func (m *TripwireMonitor) trip(c *gin.Context, tripwire models.Tripwire, target string) {
+	details := map[string]any{
+		"tripwire_id": tripwire.ID,
+		"pattern":     tripwire.Pattern,
+		"note":        tripwire.Note,
+		"ip":          c.ClientIP(),
+		"method":      c.Request.Method,
+		"path":        c.Request.URL.Path,
+		"user_agent":  c.Request.UserAgent(),
+		"referer":     c.Request.Referer(),
+	}
+	if userID := c.GetUint("user_id"); userID != 0 {
+		details["user_id"] = userID
+		details["user_email"] = c.GetString("user_email")
+	}
+
+	audit.Record(c, audit.ActionTripwire, target, details)
+
+	key := fmt.Sprintf("%d|%s", tripwire.ID, c.ClientIP())
+	now := time.Now()
+	m.mu.Lock()
+	for k, last := range m.lastAlert {
+		if now.Sub(last) >= tripwireAlertInterval {
+			delete(m.lastAlert, k)
+		}
+	}
+	if last, ok := m.lastAlert[key]; ok && now.Sub(last) < tripwireAlertInterval {
+		m.mu.Unlock()
+		return
+	}
+	m.lastAlert[key] = now
+	m.mu.Unlock()
+
+	alert.Notify(alert.Alert{
+		Type:    "tripwire",
+		Text:    fmt.Sprintf("Tripwire %q triggered by %s requesting %s", tripwire.Pattern, c.ClientIP(), target),
+		Time:    now,
+		Details: details,
+	})
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/audit"
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTripwireMonitor_Watch(t *testing.T) {
+	// Arrange
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	auditRepo := database.NewAuditLogRepo(database.DB)
+	audit.Init(auditRepo)
+	tripwireRepo := database.NewTripwireRepo(database.DB)
+	require.NoError(t, tripwireRepo.AddTripwire(context.Background(), &models.Tripwire{MediaType: models.MediaTypeDoc, Pattern: "secret-*"}))
+
+	r := gin.New()
+	r.GET("/doc/:filename", NewTripwireMonitor(tripwireRepo).Watch(models.MediaTypeDoc), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	// Act
+	for _, fileName := range []string{"report.pdf", "secret-keys.pdf"} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/doc/"+fileName, nil)
+		req.Header.Set("User-Agent", "scraper/1.0")
+		r.ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+
+	// Assert
+	entries, err := auditRepo.GetAuditLogs(context.Background(), audit.ActionTripwire, 10)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "doc/secret-keys.pdf", entries[0].Target)
+	require.Contains(t, entries[0].Details, "scraper/1.0")
+}
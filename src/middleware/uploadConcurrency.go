@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"github.com/kevinanielsen/go-fast-cdn/src/settings"
+)
+
+// UploadConcurrency caps the uploads handled at once to the
+// max_concurrent_uploads setting, so a burst of uploads cannot overwhelm the
+// disk and the database. Further uploads queue for a slot, in order, for up
+// to upload_queue_timeout seconds and are then rejected with 503 and
+// Retry-After. Clients that go away leave the queue. The routes guarded by
+// the returned middleware share its slots; a limit of 0 disables it.
+// Changes of the settings apply to the next request.
+func UploadConcurrency() gin.HandlerFunc {
+	var maxUploads, queueTimeout atomic.Int64
+	settings.Default.Watch(settings.MaxConcurrentUploads, func(value string) {
+		parsed, _ := strconv.ParseInt(value, 10, 64)
+		maxUploads.Store(parsed)
+	})
+	settings.Default.Watch(settings.UploadQueueTimeout, func(value string) {
+		parsed, _ := strconv.ParseInt(value, 10, 64)
+		queueTimeout.Store(parsed)
+	})
+
+	slots := &semaphore{}
+	return func(c *gin.Context) {
+		limit := int(maxUploads.Load())
+		if limit <= 0 {
+			c.Next()
+			return
+		}
+
+		wait := time.Duration(queueTimeout.Load()) * time.Second
+		if !slots.acquire(c.Request.Context(), limit, wait) {
+			c.Header("Retry-After", strconv.Itoa(max(1, int(wait.Seconds()))))
+			problem.Write(c, http.StatusServiceUnavailable, "Too many uploads in progress, try again later")
+			return
+		}
+		defer func() { slots.release(int(maxUploads.Load())) }()
+		c.Next()
+	}
+}
+
+// semaphore hands out a limited number of slots, in the order they were
+// asked for. The limit is passed on every call, so it can change while
+// slots are held.
+type semaphore struct {
+	mu     sync.Mutex
+	active int
+	queue  []chan struct{}
+}
+
+// acquire takes a slot, waiting at most wait for one. It reports whether it
+// got a slot, which must then be released.
+func (s *semaphore) acquire(ctx context.Context, limit int, wait time.Duration) bool {
+	s.mu.Lock()
+	if s.active < limit && len(s.queue) == 0 {
+		s.active++
+		s.mu.Unlock()
+		return true
+	}
+	if wait <= 0 {
+		s.mu.Unlock()
+		return false
+	}
+	ready := make(chan struct{})
+	s.queue = append(s.queue, ready)
+	s.mu.Unlock()
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ready:
+		return true
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	s.mu.Lock()
+	for i, waiting := range s.queue {
+		if waiting == ready {
+			s.queue = append(s.queue[:i], s.queue[i+1:]...)
+			s.mu.Unlock()
+			return false
+		}
+	}
+	s.mu.Unlock()
+	// The slot was handed over while giving up
+	s.release(limit)
+	return false
+}
+
+// release gives a slot back, handing free slots to the queued callers.
+func (s *semaphore) release(limit int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.active--
+	for len(s.queue) > 0 && (limit <= 0 || s.active < limit) {
+		s.active++
+		close(s.queue[0])
+		s.queue = s.queue[1:]
+	}
+}
@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUploadConcurrency(t *testing.T) {
+	t.Setenv("MAX_CONCURRENT_UPLOADS", "1")
+	t.Setenv("UPLOAD_QUEUE_TIMEOUT", "0")
+
+	started, finish := make(chan struct{}), make(chan struct{})
+	r := gin.New()
+	r.POST("/upload", UploadConcurrency(), func(c *gin.Context) {
+		if c.Query("block") != "" {
+			close(started)
+			<-finish
+		}
+		c.Status(http.StatusOK)
+	})
+	upload := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, target, nil))
+		return w
+	}
+
+	done := make(chan int)
+	go func() { done <- upload("/upload?block=1").Code }()
+	<-started
+	w := upload("/upload")
+	require.Equal(t, http.StatusServiceUnavailable, w.Code, "the only slot is taken")
+	require.Equal(t, "1", w.Header().Get("Retry-After"))
+
+	close(finish)
+	require.Equal(t, http.StatusOK, <-done)
+	require.Equal(t, http.StatusOK, upload("/upload").Code, "the slot was released")
+}
+
+func TestSemaphore(t *testing.T) {
+	// Arrange
+	s := &semaphore{}
+	ctx := context.Background()
+	require.True(t, s.acquire(ctx, 1, 0))
+
+	// Act & Assert
+	require.False(t, s.acquire(ctx, 1, 10*time.Millisecond), "queued callers give up after waiting")
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	require.False(t, s.acquire(canceled, 1, time.Minute), "queued callers leave when their request ends")
+
+	order := make(chan int, 2)
+	for i := 1; i <= 2; i++ {
+		i := i
+		go func() {
+			if s.acquire(ctx, 1, time.Minute) {
+				order <- i
+			}
+		}()
+		require.Eventually(t, func() bool {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			return len(s.queue) == i
+		}, time.Second, time.Millisecond)
+	}
+	s.release(1)
+	require.Equal(t, 1, <-order, "slots go to the longest waiting caller")
+	s.release(1)
+	require.Equal(t, 2, <-order)
+	s.release(1)
+	require.Zero(t, s.active)
+
+	require.True(t, s.acquire(ctx, 2, 0))
+	require.True(t, s.acquire(ctx, 2, 0), "raising the limit frees slots")
+}
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+)
+
+// UploadExpiry reads the time an upload expires at from the X-Expires-At
+// header or the expires_at form field, in RFC 3339 format, and stores it in
+// the context as "upload_expires_at" for the upload handlers. It takes
+// precedence over the expiry of a preset. Times that are invalid or not in
+// the future are rejected.
+func UploadExpiry() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value := c.GetHeader("X-Expires-At")
+		if value == "" && c.ContentType() == gin.MIMEMultipartPOSTForm {
+			form, err := c.MultipartForm()
+			if err != nil {
+				problem.Invalid(c, err)
+				return
+			}
+			if values := form.Value["expires_at"]; len(values) > 0 {
+				value = values[0]
+			}
+		}
+		if value == "" {
+			c.Next()
+			return
+		}
+
+		expiresAt, err := time.Parse(time.RFC3339, value)
+		if err != nil || !expiresAt.After(time.Now()) {
+			problem.InvalidFields(c, problem.FieldError{Field: "expires_at", Rule: "future", Message: "must be a future time in RFC 3339 format, e.g. 2030-01-01T00:00:00Z"})
+			return
+		}
+		c.Set("upload_expires_at", expiresAt)
+		c.Next()
+	}
+}
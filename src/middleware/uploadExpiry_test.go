@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUploadExpiry(t *testing.T) {
+	var expiresAt any
+	r := gin.New()
+	r.POST("/upload", UploadExpiry(), func(c *gin.Context) {
+		expiresAt, _ = c.Get("upload_expires_at")
+		// The parsed form stays available to the handler
+		if _, err := c.FormFile("file"); err != nil && c.ContentType() == gin.MIMEMultipartPOSTForm {
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+	upload := func(header, field string) *httptest.ResponseRecorder {
+		expiresAt = nil
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		if field != "" {
+			require.NoError(t, writer.WriteField("expires_at", field))
+		}
+		part, err := writer.CreateFormFile("file", "a.txt")
+		require.NoError(t, err)
+		_, err = part.Write([]byte("a"))
+		require.NoError(t, err)
+		require.NoError(t, writer.Close())
+
+		req := httptest.NewRequest(http.MethodPost, "/upload", body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		if header != "" {
+			req.Header.Set("X-Expires-At", header)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	require.Equal(t, http.StatusOK, upload("", "").Code)
+	require.Nil(t, expiresAt)
+
+	future := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	require.Equal(t, http.StatusOK, upload("", future.Format(time.RFC3339)).Code)
+	require.True(t, future.Equal(expiresAt.(time.Time)))
+
+	// The header takes precedence over the form field
+	later := future.Add(time.Hour)
+	require.Equal(t, http.StatusOK, upload(later.Format(time.RFC3339), future.Format(time.RFC3339)).Code)
+	require.True(t, later.Equal(expiresAt.(time.Time)))
+
+	require.Equal(t, http.StatusBadRequest, upload("", "tomorrow").Code)
+	require.Equal(t, http.StatusBadRequest, upload(time.Now().Add(-time.Hour).Format(time.RFC3339), "").Code)
+	require.Nil(t, expiresAt)
+}
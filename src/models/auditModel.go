@@ -0,0 +1,25 @@
+package models
+
+import (
+	"context"
+
+	"time"
+)
+
+// AuditLog records a security or policy relevant action.
+type AuditLog struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt  time.Time `json:"created_at" gorm:"index"`
+	Action     string    `json:"action" gorm:"index;not null"`
+	ActorID    uint      `json:"actor_id"`
+	ActorEmail string    `json:"actor_email"`
+	IP         string    `json:"ip"`
+	Target     string    `json:"target"`
+	Details    string    `json:"details"`
+}
+
+type AuditLogRepository interface {
+	AddAuditLog(ctx context.Context, entry *AuditLog) error
+	GetAuditLogs(ctx context.Context, action string, limit int) ([]AuditLog, error)
+	GetAuditLogsSince(ctx context.Context, since time.Time) ([]AuditLog, error)
+}
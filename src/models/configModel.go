@@ -1,6 +1,122 @@
 package models
 
+import "time"
+
 type Config struct {
 	Key   string `gorm:"primaryKey"`
 	Value string
 }
+
+// CORSPolicy is the cross-origin policy applied to every response. It is
+// stored in the config table and can be changed at runtime.
+type CORSPolicy struct {
+	// AllowedOrigins lists the origins allowed to call the API, or "*" for
+	// any origin.
+	AllowedOrigins   []string `json:"allowed_origins" binding:"required,min=1,dive,origin"`
+	AllowedMethods   []string `json:"allowed_methods" binding:"required,min=1,dive,token"`
+	AllowedHeaders   []string `json:"allowed_headers" binding:"dive,token"`
+	AllowCredentials bool     `json:"allow_credentials"`
+}
+
+// DefaultCORSPolicy returns the policy used until an admin configures one.
+func DefaultCORSPolicy() CORSPolicy {
+	return CORSPolicy{
+		AllowedOrigins:   []string{"*"},
+		AllowedMethods:   []string{"POST", "OPTIONS", "GET", "PUT"},
+		AllowedHeaders:   []string{"Content-Type", "Content-Length", "Accept-Encoding", "X-CSRF-Token", "Authorization", "accept", "origin", "Cache-Control", "X-Requested-With"},
+		AllowCredentials: true,
+	}
+}
+
+// Actions taken on hotlinked downloads.
+const (
+	HotlinkActionForbid = "forbid"
+	// HotlinkActionPlaceholder serves a placeholder image instead of the
+	// hotlinked image. Docs are always forbidden.
+	HotlinkActionPlaceholder = "placeholder"
+)
+
+// HotlinkRule decides which sites may link to downloads, based on the
+// Origin or Referer of the request.
+type HotlinkRule struct {
+	Enabled bool `json:"enabled"`
+	// AllowedHosts lists the hosts allowed to link, e.g. "example.com" or
+	// "*.example.com" for its subdomains. The CDN's own host is always
+	// allowed.
+	AllowedHosts []string `json:"allowed_hosts"`
+	// AllowEmpty lets requests without an Origin or Referer through, e.g.
+	// direct visits or browsers hiding the referer.
+	AllowEmpty bool   `json:"allow_empty"`
+	Action     string `json:"action"`
+}
+
+// HotlinkPolicy is the hotlink protection of downloads. It is stored in the
+// config table and can be changed at runtime.
+type HotlinkPolicy struct {
+	HotlinkRule
+	// Overrides replaces the rule for a media type (image or doc).
+	Overrides map[string]HotlinkRule `json:"overrides"`
+}
+
+// DefaultHotlinkPolicy returns the policy used until an admin configures
+// one, which lets every request through.
+func DefaultHotlinkPolicy() HotlinkPolicy {
+	return HotlinkPolicy{
+		HotlinkRule: HotlinkRule{AllowedHosts: []string{}, AllowEmpty: true, Action: HotlinkActionForbid},
+		Overrides:   map[string]HotlinkRule{},
+	}
+}
+
+// Rule returns the rule applying to downloads of mediaType.
+func (p HotlinkPolicy) Rule(mediaType string) HotlinkRule {
+	if rule, ok := p.Overrides[mediaType]; ok {
+		return rule
+	}
+	return p.HotlinkRule
+}
+
+// Watermark positions.
+const (
+	WatermarkTopLeft     = "top-left"
+	WatermarkTopRight    = "top-right"
+	WatermarkBottomLeft  = "bottom-left"
+	WatermarkBottomRight = "bottom-right"
+	WatermarkCenter      = "center"
+)
+
+// WatermarkSettings configures the watermark composited on image downloads.
+// It is stored in the config table and can be changed at runtime.
+type WatermarkSettings struct {
+	Enabled  bool   `json:"enabled"`
+	Position string `json:"position" binding:"oneof=top-left top-right bottom-left bottom-right center"`
+	// Opacity of the watermark, from 0 (invisible) to 1.
+	Opacity float64 `json:"opacity" binding:"gt=0,lte=1"`
+	// Scale is the width of the watermark as a fraction of the image width.
+	Scale float64 `json:"scale" binding:"gt=0,lte=1"`
+	// Margin is the distance in pixels between the watermark and the edges.
+	Margin int `json:"margin" binding:"min=0"`
+	// Always watermarks every image download, not only those requested with
+	// ?watermark=true.
+	Always bool `json:"always"`
+	// Folders lists the media folders whose images are always watermarked.
+	// Only the images folder holds images.
+	Folders []string `json:"folders" binding:"dive,oneof=images"`
+	// Organizations lists the organizations whose images are always
+	// watermarked.
+	Organizations []uint `json:"organizations"`
+	// UpdatedAt versions the cached watermarked images.
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// DefaultWatermarkSettings returns the settings used until an admin
+// configures the watermark.
+func DefaultWatermarkSettings() WatermarkSettings {
+	return WatermarkSettings{
+		Position:      WatermarkBottomRight,
+		Opacity:       0.5,
+		Scale:         0.2,
+		Margin:        16,
+		Folders:       []string{},
+		Organizations: []uint{},
+	}
+}
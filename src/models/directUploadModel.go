@@ -0,0 +1,42 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DirectUpload is an upload a client puts straight into object storage with
+// a presigned URL, bypassing the server. It becomes a media once the client
+// confirms it and the object matches the announced size and checksum.
+type DirectUpload struct {
+	gorm.Model
+	Token     string `gorm:"uniqueIndex;not null"`
+	MediaType string
+	// FileName is the name the media will be stored as, and the name of the
+	// object in the bucket.
+	FileName     string `gorm:"index"`
+	OriginalName string
+	Size         int64
+	// SHA256 is the checksum of the whole file announced by the client.
+	SHA256         []byte
+	OrganizationID *uint
+	// CreatedBy is the email of the user who must confirm the upload.
+	CreatedBy string
+	ExpiresAt time.Time
+}
+
+// Expired reports whether the presigned URL of the upload stopped working.
+func (u *DirectUpload) Expired() bool {
+	return time.Now().After(u.ExpiresAt)
+}
+
+type DirectUploadRepository interface {
+	AddDirectUpload(ctx context.Context, upload *DirectUpload) error
+	GetDirectUpload(ctx context.Context, token string) (DirectUpload, error)
+	// PendingDirectUpload reports whether an unexpired upload is going to be
+	// stored as fileName.
+	PendingDirectUpload(ctx context.Context, mediaType, fileName string) (bool, error)
+	DeleteDirectUpload(ctx context.Context, token string) error
+}
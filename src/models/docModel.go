@@ -1,20 +1,92 @@
 package models
 
 import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
 type Doc struct {
 	gorm.Model
 
-	FileName string `json:"file_name"`
-	Checksum []byte `json:"checksum"`
+	// UUID is a stable public identifier that survives renames.
+	UUID     string `json:"uuid" gorm:"index"`
+	FileName string `json:"file_name" gorm:"index"`
+	// OriginalName is the name the file was uploaded with, which differs
+	// from FileName under most naming strategies, see util.NamingStrategy.
+	OriginalName string `json:"original_name"`
+	// Disposition is how downloads are presented unless the request asks
+	// otherwise, see DispositionInline. Empty means inline.
+	Disposition string `json:"disposition"`
+	// DownloadName is the default name of downloads, instead of
+	// OriginalName.
+	DownloadName string `json:"download_name"`
+	// MimeType is the content type detected from the file, sent on
+	// downloads. It is empty until detected after the content changed.
+	MimeType string `json:"mime_type"`
+	Checksum []byte `json:"checksum" gorm:"index"`
+	// ChecksumAlgorithm is the algorithm Checksum was computed with, see
+	// ChecksumMD5.
+	ChecksumAlgorithm string `json:"checksum_algorithm" gorm:"default:md5"`
+	// OrganizationID is the organization that owns the file, if any.
+	OrganizationID *uint `json:"organization_id" gorm:"index"`
+	// ModerationStatus tells whether the file may be served publicly, see
+	// ModerationStatusApproved.
+	ModerationStatus string `json:"moderation_status" gorm:"default:approved;index"`
+	// IntegrityStatus is the result of the last integrity check, see
+	// IntegrityStatusUnchecked.
+	IntegrityStatus string     `json:"integrity_status" gorm:"default:unchecked"`
+	VerifiedAt      *time.Time `json:"verified_at"`
+	// ExpiresAt is when the file is deleted automatically, if ever.
+	ExpiresAt *time.Time `json:"expires_at" gorm:"index"`
+
+	MediaMetadata
+}
+
+// BeforeCreate hook to assign a UUID to new records
+func (d *Doc) BeforeCreate(tx *gorm.DB) error {
+	if d.UUID == "" {
+		d.UUID = uuid.NewString()
+	}
+	return nil
 }
 
+// DocRepository stores document records. Lookups of a single record return
+// gorm.ErrRecordNotFound when there is no match.
 type DocRepository interface {
-	GetAllDocs() []Doc
-	GetDocByCheckSum(checksum []byte) Doc
-	AddDoc(doc Doc) (string, error)
-	DeleteDoc(fileName string) (string, bool)
-	RenameDoc(oldFileName, newFileName string) error
+	GetAllDocs(ctx context.Context) ([]Doc, error)
+	// GetDocsAfter returns up to limit documents with an ID above afterID,
+	// ordered by ID, to page through all documents without loading them at
+	// once.
+	GetDocsAfter(ctx context.Context, afterID uint, limit int) ([]Doc, error)
+	// GetDocsPage returns up to limit documents, newest first, skipping the
+	// first offset ones.
+	GetDocsPage(ctx context.Context, limit, offset int) ([]Doc, error)
+	CountDocs(ctx context.Context) (int64, error)
+	GetDocByCheckSum(ctx context.Context, checksum []byte) (Doc, error)
+	GetDocByFileName(ctx context.Context, fileName string) (Doc, error)
+	GetDocByUUID(ctx context.Context, uuid string) (Doc, error)
+	AddDoc(ctx context.Context, doc Doc) (string, error)
+	// DeleteDoc, RenameDoc, UpdateDocDisposition and UpdateDocMetadata
+	// return ErrStale for changes made with IfUnchanged to a document updated
+	// since.
+	DeleteDoc(ctx context.Context, fileName string) (string, error)
+	RenameDoc(ctx context.Context, oldFileName, newFileName string) error
+	UpdateDocChecksum(ctx context.Context, fileName, algorithm string, checksum []byte) error
+	// UpdateDocDisposition sets the default disposition and name of
+	// downloads of the document.
+	UpdateDocDisposition(ctx context.Context, fileName, disposition, downloadName string) error
+	UpdateDocMimeType(ctx context.Context, fileName, mimeType string) error
+	// UpdateDocMetadata replaces the descriptive fields of the document.
+	UpdateDocMetadata(ctx context.Context, fileName string, metadata MediaMetadata) error
+	// UpdateDocModerationStatus records whether the document was approved,
+	// see ModerationStatusApproved.
+	UpdateDocModerationStatus(ctx context.Context, fileName, status string) error
+	// GetDocsByModerationStatus returns the documents with the given
+	// moderation status, oldest first.
+	GetDocsByModerationStatus(ctx context.Context, status string) ([]Doc, error)
+	GetExpiredDocs(ctx context.Context, now time.Time) ([]Doc, error)
+	GetDocsPastLifecycle(ctx context.Context, createdBefore time.Time, orgID *uint) ([]Doc, error)
 }
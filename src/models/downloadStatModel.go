@@ -0,0 +1,39 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// DownloadStat counts the downloads of a file on a day (UTC). Counters are
+// kept per day so reports can cover any range of days.
+type DownloadStat struct {
+	ID        uint      `json:"-" gorm:"primarykey"`
+	MediaType string    `json:"type" gorm:"uniqueIndex:idx_download_stat;not null"`
+	FileName  string    `json:"file_name" gorm:"uniqueIndex:idx_download_stat;not null"`
+	Day       time.Time `json:"day" gorm:"uniqueIndex:idx_download_stat;index;not null"`
+	Count     int64     `json:"count"`
+}
+
+// DownloadTotal is the number of downloads of a file over a range of days.
+type DownloadTotal struct {
+	MediaType string `json:"type"`
+	FileName  string `json:"file_name"`
+	Count     int64  `json:"count"`
+}
+
+type DownloadStatRepository interface {
+	// AddDownloads adds the counts of stats to the stored counters of the same
+	// file and day, creating missing ones.
+	AddDownloads(ctx context.Context, stats []DownloadStat) error
+	// GetDownloadCount returns the number of downloads of a file since it was
+	// first counted.
+	GetDownloadCount(ctx context.Context, mediaType, fileName string) (int64, error)
+	// GetTopDownloads returns up to limit files with the most downloads on the
+	// days from since until before until, of mediaType or of both types for an
+	// empty one. A zero since or until leaves the range open on that side.
+	GetTopDownloads(ctx context.Context, mediaType string, since, until time.Time, limit int) ([]DownloadTotal, error)
+	// RenameDownloadStats moves the counters of a renamed file to its new
+	// name.
+	RenameDownloadStats(ctx context.Context, mediaType, oldFileName, newFileName string) error
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+// Gallery publishes the images or documents of a folder, optionally only
+// those of an organization, as a JSON listing anyone can read at
+// /public/galleries/<slug>. Folders are private unless a gallery lists them.
+type Gallery struct {
+	gorm.Model
+
+	Slug        string `json:"slug" gorm:"unique;not null"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	// MediaType is the folder listed, MediaTypeImage or MediaTypeDoc.
+	MediaType string `json:"media_type" gorm:"not null;default:image"`
+	// OrganizationID limits the gallery to the files of an organization. Nil
+	// lists every file of the folder.
+	OrganizationID *uint `json:"organization_id"`
+}
+
+type GalleryRepository interface {
+	GetAllGalleries(ctx context.Context) ([]Gallery, error)
+	GetGalleryBySlug(ctx context.Context, slug string) (*Gallery, error)
+	CreateGallery(ctx context.Context, gallery *Gallery) error
+	UpdateGallery(ctx context.Context, gallery *Gallery) error
+	DeleteGallery(ctx context.Context, slug string) error
+}
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// Access levels a group can be granted on a folder, each including the ones
+// before it: read lists the folder and reads the metadata of its media,
+// write uploads and changes media, and admin deletes media and manages the
+// access to the folder.
+const (
+	AccessRead  = "read"
+	AccessWrite = "write"
+	AccessAdmin = "admin"
+)
+
+// AccessLevels lists the access levels from least to most.
+var AccessLevels = []string{AccessRead, AccessWrite, AccessAdmin}
+
+// AccessIncludes reports whether access grants at least level.
+func AccessIncludes(access, level string) bool {
+	rank := func(a string) int {
+		for i, l := range AccessLevels {
+			if l == a {
+				return i
+			}
+		}
+		return -1
+	}
+	return rank(level) >= 0 && rank(access) >= rank(level)
+}
+
+// Group is a team of users that folder permissions are granted to.
+type Group struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Name        string    `json:"name" gorm:"unique;not null"`
+	Description string    `json:"description"`
+}
+
+// GroupMember makes a user a member of a group.
+type GroupMember struct {
+	GroupID   uint      `json:"group_id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"primaryKey;index"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// FolderPermission grants a group access to the media folder Folder, images
+// or docs. Folders without permissions are open to every user; once a
+// folder has one, only admins and the members of its groups can use it.
+type FolderPermission struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Folder    string    `json:"folder" gorm:"not null;uniqueIndex:idx_folder_permissions_folder_group"`
+	GroupID   uint      `json:"group_id" gorm:"not null;uniqueIndex:idx_folder_permissions_folder_group"`
+	// Access is the level granted, see AccessRead.
+	Access string `json:"access" gorm:"not null"`
+}
+
+type GroupRepository interface {
+	GetAllGroups(ctx context.Context) ([]Group, error)
+	GetGroupByID(ctx context.Context, id uint) (*Group, error)
+	CreateGroup(ctx context.Context, group *Group) error
+	// DeleteGroup deletes the group with its members and folder
+	// permissions.
+	DeleteGroup(ctx context.Context, id uint) error
+
+	GetGroupMembers(ctx context.Context, groupID uint) ([]User, error)
+	// AddGroupMember adds the user to the group, doing nothing if the user
+	// already is a member.
+	AddGroupMember(ctx context.Context, groupID, userID uint) error
+	RemoveGroupMember(ctx context.Context, groupID, userID uint) error
+
+	// GetFolderPermissions returns the permissions of folder, or of every
+	// folder for an empty folder.
+	GetFolderPermissions(ctx context.Context, folder string) ([]FolderPermission, error)
+	// SetFolderPermission grants the group access to the folder, replacing
+	// the access it had.
+	SetFolderPermission(ctx context.Context, permission *FolderPermission) error
+	DeleteFolderPermission(ctx context.Context, folder string, groupID uint) error
+	// GetUserFolderAccess returns the access levels the groups of the user
+	// were granted on folder.
+	GetUserFolderAccess(ctx context.Context, userID uint, folder string) ([]string, error)
+}
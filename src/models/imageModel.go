@@ -1,18 +1,126 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
 
 type Image struct {
 	gorm.Model
 
-	FileName string `json:"file_name"`
-	Checksum []byte `json:"checksum"`
+	// UUID is a stable public identifier that survives renames.
+	UUID     string `json:"uuid" gorm:"index"`
+	FileName string `json:"file_name" gorm:"index"`
+	// OriginalName is the name the file was uploaded with, which differs
+	// from FileName under most naming strategies, see util.NamingStrategy.
+	OriginalName string `json:"original_name"`
+	// Disposition is how downloads are presented unless the request asks
+	// otherwise, see DispositionInline. Empty means inline.
+	Disposition string `json:"disposition"`
+	// DownloadName is the default name of downloads, instead of
+	// OriginalName.
+	DownloadName string `json:"download_name"`
+	// MimeType is the content type detected from the file, sent on
+	// downloads. It is empty until detected after the content changed.
+	MimeType string `json:"mime_type"`
+	Checksum []byte `json:"checksum" gorm:"index"`
+	// ChecksumAlgorithm is the algorithm Checksum was computed with, see
+	// ChecksumMD5.
+	ChecksumAlgorithm string `json:"checksum_algorithm" gorm:"default:md5"`
+	// OrganizationID is the organization that owns the file, if any.
+	OrganizationID *uint `json:"organization_id" gorm:"index"`
+	// ModerationStatus tells whether the file may be served publicly, see
+	// ModerationStatusApproved.
+	ModerationStatus string `json:"moderation_status" gorm:"default:approved;index"`
+	// IntegrityStatus is the result of the last integrity check, see
+	// IntegrityStatusUnchecked.
+	IntegrityStatus string     `json:"integrity_status" gorm:"default:unchecked"`
+	VerifiedAt      *time.Time `json:"verified_at"`
+	// ExpiresAt is when the file is deleted automatically, if ever.
+	ExpiresAt *time.Time `json:"expires_at" gorm:"index"`
+	// FocalX and FocalY locate the subject of the image as fractions of its
+	// width and height, kept in view when it is cropped. Both are nil when
+	// no focal point is set.
+	FocalX *float64 `json:"focal_x"`
+	FocalY *float64 `json:"focal_y"`
+	// OriginalSize and OptimizedSize are the sizes of the image as uploaded
+	// and after it was optimized, both 0 unless it was.
+	OriginalSize  int64 `json:"original_size,omitempty"`
+	OptimizedSize int64 `json:"optimized_size,omitempty"`
+	// Blurhash and DominantColor let front-ends render a placeholder while
+	// the image loads. Both are empty until computed in the background.
+	Blurhash      string `json:"blurhash,omitempty"`
+	DominantColor string `json:"dominant_color,omitempty"`
+	// PerceptualHash is the hexadecimal pHash of the image, close for
+	// visually similar images. It is empty until computed in the background.
+	PerceptualHash string `json:"perceptual_hash,omitempty"`
+
+	MediaMetadata
+}
+
+// BeforeCreate hook to assign a UUID to new records
+func (i *Image) BeforeCreate(tx *gorm.DB) error {
+	if i.UUID == "" {
+		i.UUID = uuid.NewString()
+	}
+	return nil
 }
 
+// ImageRepository stores image records. Lookups of a single record return
+// gorm.ErrRecordNotFound when there is no match.
 type ImageRepository interface {
-	GetAllImages() []Image
-	GetImageByCheckSum(checksum []byte) Image
-	AddImage(image Image) (string, error)
-	DeleteImage(fileName string) (string, bool)
-	RenameImage(oldFileName, newFileName string) error
+	GetAllImages(ctx context.Context) ([]Image, error)
+	// GetImagesAfter returns up to limit images with an ID above afterID,
+	// ordered by ID, to page through all images without loading them at
+	// once.
+	GetImagesAfter(ctx context.Context, afterID uint, limit int) ([]Image, error)
+	// GetImagesPage returns up to limit images, newest first, skipping the
+	// first offset ones.
+	GetImagesPage(ctx context.Context, limit, offset int) ([]Image, error)
+	CountImages(ctx context.Context) (int64, error)
+	GetImageByCheckSum(ctx context.Context, checksum []byte) (Image, error)
+	GetImageByID(ctx context.Context, id uint) (Image, error)
+	GetImageByFileName(ctx context.Context, fileName string) (Image, error)
+	GetImageByUUID(ctx context.Context, uuid string) (Image, error)
+	AddImage(ctx context.Context, image Image) (string, error)
+	// DeleteImage, RenameImage, UpdateImageFocalPoint, UpdateImageDisposition
+	// and UpdateImageMetadata return ErrStale for changes made with IfUnchanged to a image updated
+	// since.
+	DeleteImage(ctx context.Context, fileName string) (string, error)
+	RenameImage(ctx context.Context, oldFileName, newFileName string) error
+	UpdateImageChecksum(ctx context.Context, fileName, algorithm string, checksum []byte) error
+	// UpdateImageFocalPoint sets the focal point of the image, or clears it
+	// for nil coordinates.
+	UpdateImageFocalPoint(ctx context.Context, fileName string, x, y *float64) error
+	// UpdateImageDisposition sets the default disposition and name of
+	// downloads of the image.
+	UpdateImageDisposition(ctx context.Context, fileName, disposition, downloadName string) error
+	UpdateImageMimeType(ctx context.Context, fileName, mimeType string) error
+	// UpdateImagePlaceholder records the blurhash and dominant color of the
+	// image.
+	UpdateImagePlaceholder(ctx context.Context, fileName, blurhash, dominantColor string) error
+	// GetImagesWithoutPlaceholder returns the names of the images whose
+	// placeholder was not computed yet.
+	GetImagesWithoutPlaceholder(ctx context.Context) ([]string, error)
+	// UpdateImagePerceptualHash records the perceptual hash of the image.
+	UpdateImagePerceptualHash(ctx context.Context, fileName, hash string) error
+	// GetImagesWithoutPerceptualHash returns the names of the images whose
+	// perceptual hash was not computed yet.
+	GetImagesWithoutPerceptualHash(ctx context.Context) ([]string, error)
+	// UpdateImageMetadata replaces the descriptive fields of the image.
+	UpdateImageMetadata(ctx context.Context, fileName string, metadata MediaMetadata) error
+	// UpdateImageOptimization records the sizes of the image before and after
+	// it was optimized, and the checksum of the optimized file.
+	UpdateImageOptimization(ctx context.Context, fileName string, originalSize, optimizedSize int64, algorithm string, checksum []byte) error
+	// UpdateImageModerationStatus records whether the image was approved,
+	// see ModerationStatusApproved.
+	UpdateImageModerationStatus(ctx context.Context, fileName, status string) error
+	// GetImagesByModerationStatus returns the images with the given
+	// moderation status, oldest first.
+	GetImagesByModerationStatus(ctx context.Context, status string) ([]Image, error)
+	GetExpiredImages(ctx context.Context, now time.Time) ([]Image, error)
+	GetImagesPastLifecycle(ctx context.Context, createdBefore time.Time, orgID *uint) ([]Image, error)
 }
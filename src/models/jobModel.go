@@ -0,0 +1,52 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Background job states.
+const (
+	JobStatusQueued  = "queued"
+	JobStatusRunning = "running"
+	JobStatusDone    = "done"
+	JobStatusFailed  = "failed"
+)
+
+// Job is a unit of background work, see package queue. Failed attempts are
+// retried until MaxAttempts is reached, after which the job stays failed
+// until an admin requeues it.
+type Job struct {
+	gorm.Model
+	Kind string `json:"kind" gorm:"index"`
+	// Payload is the JSON encoded input of the job.
+	Payload     string `json:"payload"`
+	Status      string `json:"status" gorm:"index"`
+	Attempts    int    `json:"attempts"`
+	MaxAttempts int    `json:"max_attempts"`
+	// RunAt is when the job is due, later than its creation while it waits
+	// for a retry.
+	RunAt      time.Time  `json:"run_at" gorm:"index"`
+	LastError  string     `json:"last_error,omitempty"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
+
+type JobRepository interface {
+	AddJob(ctx context.Context, job *Job) error
+	// ClaimJob marks the oldest queued job due at now as running and returns
+	// it, or gorm.ErrRecordNotFound if no job is due.
+	ClaimJob(ctx context.Context, now time.Time) (*Job, error)
+	UpdateJob(ctx context.Context, job *Job) error
+	// GetJob returns the job with id, or gorm.ErrRecordNotFound.
+	GetJob(ctx context.Context, id uint) (*Job, error)
+	// GetJobs returns up to limit jobs with status, or of any status for an
+	// empty one, newest first.
+	GetJobs(ctx context.Context, status string, limit int) ([]Job, error)
+	// RequeueRunningJobs queues the jobs left running by a previous process
+	// again and returns their number.
+	RequeueRunningJobs(ctx context.Context) (int64, error)
+	// DeleteFinishedJobs deletes the jobs done before a time.
+	DeleteFinishedJobs(ctx context.Context, before time.Time) error
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+// LifecycleActionDelete deletes files once they reach the age of a
+// lifecycle rule.
+const LifecycleActionDelete = "delete"
+
+// LifecycleRule applies Action to files that were uploaded more than
+// AfterDays days ago and have no expiry time of their own.
+type LifecycleRule struct {
+	gorm.Model
+
+	Name string `json:"name" gorm:"unique;not null"`
+	// MediaType restricts the rule to the images or documents folder. An
+	// empty value applies it to both.
+	MediaType string `json:"media_type"`
+	// OrganizationID restricts the rule to the files of an organization. Nil
+	// applies it to all files.
+	OrganizationID *uint  `json:"organization_id"`
+	Action         string `json:"action" gorm:"not null;default:delete"`
+	AfterDays      int    `json:"after_days" gorm:"not null"`
+}
+
+// Applies reports whether the rule covers files of mediaType.
+func (r *LifecycleRule) Applies(mediaType string) bool {
+	return r.MediaType == "" || r.MediaType == mediaType
+}
+
+type LifecycleRuleRepository interface {
+	GetAllLifecycleRules(ctx context.Context) ([]LifecycleRule, error)
+	GetLifecycleRuleByName(ctx context.Context, name string) (*LifecycleRule, error)
+	CreateLifecycleRule(ctx context.Context, rule *LifecycleRule) error
+	UpdateLifecycleRule(ctx context.Context, rule *LifecycleRule) error
+	DeleteLifecycleRule(ctx context.Context, name string) error
+}
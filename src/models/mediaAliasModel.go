@@ -0,0 +1,30 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// MediaAlias keeps a former name of a renamed image or document, so links
+// using it are redirected to the media under its current name.
+type MediaAlias struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"created_at"`
+	MediaType string    `json:"media_type" gorm:"uniqueIndex:idx_media_alias;not null"`
+	FileName  string    `json:"file_name" gorm:"uniqueIndex:idx_media_alias;not null"`
+	// MediaUUID identifies the media, so aliases survive further renames.
+	MediaUUID string `json:"media_uuid" gorm:"index;not null"`
+}
+
+type MediaAliasRepository interface {
+	// GetAlias returns the alias of mediaType named fileName, or
+	// gorm.ErrRecordNotFound.
+	GetAlias(ctx context.Context, mediaType, fileName string) (MediaAlias, error)
+	// AddAlias makes fileName an alias of the media with mediaUUID, replacing
+	// the alias of the same name.
+	AddAlias(ctx context.Context, mediaType, fileName, mediaUUID string) error
+	// DeleteAlias removes the alias of mediaType named fileName.
+	DeleteAlias(ctx context.Context, mediaType, fileName string) error
+	// DeleteAliasesFor removes the aliases of the media with mediaUUID.
+	DeleteAliasesFor(ctx context.Context, mediaType, mediaUUID string) error
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+// MediaComment is a comment left on an image or document, e.g. during a
+// review. Comments on audio and video files may point at a position in
+// them.
+type MediaComment struct {
+	gorm.Model
+
+	MediaType string `json:"media_type" gorm:"not null;index:idx_media_comment_media"`
+	// MediaUUID identifies the media, so comments survive renames.
+	MediaUUID string `json:"media_uuid" gorm:"not null;index:idx_media_comment_media"`
+	UserID    uint   `json:"user_id" gorm:"not null"`
+	// Author is the email of the user when the comment was left.
+	Author string `json:"author"`
+	Body   string `json:"body" gorm:"type:text;not null"`
+	// TimestampMs is the position the comment refers to in an audio or
+	// video file, in milliseconds from its start, if any.
+	TimestampMs *int64 `json:"timestamp_ms"`
+	// Resolved marks comments that were addressed.
+	Resolved bool `json:"resolved"`
+}
+
+// MediaCommentRepository stores comments. Lookups of a single comment
+// return gorm.ErrRecordNotFound when there is no match.
+type MediaCommentRepository interface {
+	// GetComments returns the comments on the media with mediaUUID, oldest
+	// first.
+	GetComments(ctx context.Context, mediaType, mediaUUID string) ([]MediaComment, error)
+	GetComment(ctx context.Context, id uint) (MediaComment, error)
+	AddComment(ctx context.Context, comment *MediaComment) error
+	UpdateComment(ctx context.Context, comment *MediaComment) error
+	DeleteComment(ctx context.Context, id uint) error
+	// DeleteCommentsFor removes the comments on the media with mediaUUID.
+	DeleteCommentsFor(ctx context.Context, mediaType, mediaUUID string) error
+}
@@ -0,0 +1,188 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Media types shared by every feature that can reference either an image or
+// a document. The values double as the "type" field used in API responses.
+const (
+	MediaTypeImage = "image"
+	MediaTypeDoc   = "doc"
+)
+
+// Moderation states stored on media records. Uploads by users other than
+// admins are pending while moderation is enabled, and only approved files
+// are served publicly.
+const (
+	ModerationStatusPending  = "pending"
+	ModerationStatusApproved = "approved"
+	ModerationStatusRejected = "rejected"
+)
+
+// ModerationApproved reports whether media with the given moderation status
+// may be served publicly. Records without a status predate moderation.
+func ModerationApproved(status string) bool {
+	return status == "" || status == ModerationStatusApproved
+}
+
+// Checksum algorithms stored on media records. MD5 checksums only cover the
+// first 512 bytes of a file.
+const (
+	ChecksumMD5    = "md5"
+	ChecksumSHA256 = "sha256"
+)
+
+// Integrity check results stored on media records.
+const (
+	IntegrityStatusUnchecked = "unchecked"
+	IntegrityStatusOK        = "ok"
+	IntegrityStatusMissing   = "missing"
+	IntegrityStatusCorrupted = "corrupted"
+)
+
+// Content dispositions of downloads stored on media records.
+const (
+	DispositionInline     = "inline"
+	DispositionAttachment = "attachment"
+)
+
+// MediaMetadata holds the descriptive fields of an image or document, e.g.
+// the alt text read out by screen readers.
+type MediaMetadata struct {
+	Title       string `json:"title"`
+	AltText     string `json:"alt_text"`
+	Description string `json:"description"`
+	// Attributes holds custom fields as a JSON object, if any.
+	Attributes json.RawMessage `json:"attributes,omitempty" gorm:"type:text"`
+}
+
+// MediaFolder returns the uploads sub-folder that stores files of the given
+// media type, or an empty string for unknown types.
+func MediaFolder(mediaType string) string {
+	switch mediaType {
+	case MediaTypeImage:
+		return "images"
+	case MediaTypeDoc:
+		return "docs"
+	default:
+		return ""
+	}
+}
+
+// MediaTypeFor returns the media type stored in the uploads sub-folder, the
+// inverse of MediaFolder, or an empty string for other folders.
+func MediaTypeFor(folder string) string {
+	switch folder {
+	case "images":
+		return MediaTypeImage
+	case "docs":
+		return MediaTypeDoc
+	default:
+		return ""
+	}
+}
+
+// MediaVersion returns the version of a media record last updated at
+// updatedAt, served as its ETag. It changes with every update of the record,
+// e.g. a rename or new content, so requests changing the media can send it
+// in If-Match. Media without a record, i.e. with a zero updatedAt, have no
+// version.
+func MediaVersion(updatedAt time.Time) string {
+	if updatedAt.IsZero() {
+		return ""
+	}
+	return strconv.FormatInt(updatedAt.UnixNano(), 36)
+}
+
+// ErrStale is returned by repositories for changes made with IfUnchanged to
+// media whose record was updated since.
+var ErrStale = errors.New("media was changed")
+
+type unchangedKey struct{}
+
+// IfUnchanged makes the changes repositories make to a media with ctx only
+// apply while its record is still last updated at updatedAt, returning
+// ErrStale otherwise. Checking the version of a media before changing it
+// leaves room for another request to change it in between; the condition is
+// checked by the statement making the change.
+func IfUnchanged(ctx context.Context, updatedAt time.Time) context.Context {
+	return context.WithValue(ctx, unchangedKey{}, updatedAt)
+}
+
+// UnchangedSince returns the time set with IfUnchanged, and whether one was.
+func UnchangedSince(ctx context.Context) (time.Time, bool) {
+	updatedAt, ok := ctx.Value(unchangedKey{}).(time.Time)
+	return updatedAt, ok
+}
+
+// ExistingMedia describes a stored file: the one an upload created, or the
+// one it turned out to duplicate, so clients can offer to use it instead of
+// uploading again.
+type ExistingMedia struct {
+	UUID        string    `json:"uuid"`
+	ID          uint      `json:"id"`
+	Type        string    `json:"type"`
+	FileName    string    `json:"file_name"`
+	FileURL     string    `json:"file_url"`
+	DownloadURL string    `json:"download_url"`
+	FileSize    int64     `json:"file_size"`
+	Checksum    string    `json:"checksum"`
+	CreatedAt   time.Time `json:"created_at"`
+	Width       int       `json:"width,omitempty"`
+	Height      int       `json:"height,omitempty"`
+	MimeType    string    `json:"mime_type,omitempty"`
+	// ExpiresAt is when the file is deleted automatically, if ever.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// ModerationStatus tells whether the file is served publicly yet, see
+	// ModerationStatusApproved.
+	ModerationStatus string `json:"moderation_status,omitempty"`
+	// RenditionsURL lists the files derived from the media, such as the PDF
+	// preview of a document, which may still be generated after the upload.
+	RenditionsURL string `json:"renditions_url"`
+}
+
+// UploadedMedia is the response to an upload.
+type UploadedMedia struct {
+	ExistingMedia
+	// OriginalSize and OptimizedSize are the sizes of an image as uploaded
+	// and after it was optimized, both omitted unless it was.
+	OriginalSize  int64 `json:"original_size,omitempty"`
+	OptimizedSize int64 `json:"optimized_size,omitempty"`
+}
+
+// MediaRelation links two media records with a typed, directed relation,
+// e.g. a video and its "poster" image or a document and its "translation".
+type MediaRelation struct {
+	gorm.Model
+
+	SourceType string `json:"source_type" gorm:"not null;index:idx_media_relation_source"`
+	SourceID   uint   `json:"source_id" gorm:"not null;index:idx_media_relation_source"`
+	TargetType string `json:"target_type" gorm:"not null;index:idx_media_relation_target"`
+	TargetID   uint   `json:"target_id" gorm:"not null;index:idx_media_relation_target"`
+	Relation   string `json:"relation" gorm:"not null"`
+}
+
+// RelatedMedia is a resolved view of a MediaRelation from the point of view
+// of one of its ends. Direction is "outgoing" when the queried media is the
+// source of the relation and "incoming" when it is the target.
+type RelatedMedia struct {
+	ID        uint   `json:"id"`
+	Relation  string `json:"relation"`
+	Direction string `json:"direction"`
+	Type      string `json:"type"`
+	FileName  string `json:"file_name"`
+}
+
+type MediaRelationRepository interface {
+	GetRelated(ctx context.Context, mediaType string, mediaID uint) ([]RelatedMedia, error)
+	AddRelation(ctx context.Context, relation *MediaRelation) error
+	DeleteRelation(ctx context.Context, mediaType string, mediaID uint, relationID uint) error
+	DeleteRelationsFor(ctx context.Context, mediaType string, mediaID uint) error
+}
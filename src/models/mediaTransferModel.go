@@ -0,0 +1,30 @@
+package models
+
+import "context"
+
+// MediaTransfer moves or copies a media to another folder, name or
+// organization.
+type MediaTransfer struct {
+	SourceType     string
+	SourceFileName string
+	TargetType     string
+	TargetFileName string
+	// OrganizationID is the organization owning the target.
+	OrganizationID *uint
+	// Copy keeps the source and creates a new media, with a new UUID, for
+	// the target.
+	Copy bool
+}
+
+// MediaTransferRepository moves and copies media records between folders and
+// organizations.
+type MediaTransferRepository interface {
+	// TransferMedia updates the records for the transfer and calls
+	// transferFile, which moves or copies the file, before committing them,
+	// so the records are left unchanged when the file could not be
+	// transferred. Callers undo the file transfer when TransferMedia fails
+	// after it. It returns the UUID of the target,
+	// gorm.ErrRecordNotFound if there is no source, and ErrStale for moves
+	// made with IfUnchanged of a source updated since.
+	TransferMedia(ctx context.Context, transfer MediaTransfer, transferFile func() error) (string, error)
+}
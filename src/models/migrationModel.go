@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+// SchemaMigration records a migration applied to the database. gormigrate
+// only writes the ID, so the time defaults to the insertion time.
+type SchemaMigration struct {
+	ID        string    `json:"id" gorm:"primaryKey"`
+	AppliedAt time.Time `json:"applied_at" gorm:"default:CURRENT_TIMESTAMP"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+// MimeTypeRule registers an extension that is not accepted by default, such
+// as .glb or .wasm, for uploads of MediaType. Files with the extension are
+// served as MimeType.
+type MimeTypeRule struct {
+	gorm.Model
+
+	// Extension is lower case with its leading dot, e.g. ".glb".
+	Extension string `json:"extension" gorm:"unique;not null"`
+	MimeType  string `json:"mime_type" gorm:"not null"`
+	MediaType string `json:"media_type" gorm:"not null"`
+	// Sanitize removes active content from uploaded files, e.g. scripts and
+	// event handlers from SVG images.
+	Sanitize bool `json:"sanitize"`
+}
+
+type MimeTypeRuleRepository interface {
+	GetAllMimeTypeRules(ctx context.Context) ([]MimeTypeRule, error)
+	GetMimeTypeRule(ctx context.Context, extension string) (*MimeTypeRule, error)
+	SaveMimeTypeRule(ctx context.Context, rule *MimeTypeRule) error
+	DeleteMimeTypeRule(ctx context.Context, extension string) error
+}
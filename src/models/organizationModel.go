@@ -0,0 +1,21 @@
+package models
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+// Organization groups media and the service accounts allowed to manage it.
+type Organization struct {
+	gorm.Model
+
+	Name string `json:"name" gorm:"unique;not null"`
+}
+
+type OrganizationRepository interface {
+	GetAllOrganizations(ctx context.Context) ([]Organization, error)
+	GetOrganizationByID(ctx context.Context, id uint) (*Organization, error)
+	CreateOrganization(ctx context.Context, org *Organization) error
+	DeleteOrganization(ctx context.Context, id uint) error
+}
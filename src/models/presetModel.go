@@ -0,0 +1,52 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UploadPreset is a named set of upload parameters that clients can select
+// with ?preset=<name> instead of passing the same options on every upload.
+type UploadPreset struct {
+	gorm.Model
+
+	Name        string `json:"name" gorm:"unique;not null"`
+	Description string `json:"description"`
+	// MediaType restricts the preset to images or documents. An empty value
+	// allows both.
+	MediaType string `json:"media_type"`
+	// Width and Height resize uploaded images. When only one of them is set
+	// the other is derived from the aspect ratio.
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	// TransformPreset names a transform preset whose size, fit, gravity and
+	// quality are applied to uploaded images instead of Width and Height.
+	// Its format is not, as the file keeps its name.
+	TransformPreset string `json:"transform_preset"`
+	// Transform is the preset named by TransformPreset, resolved when the
+	// upload preset is selected.
+	Transform *TransformPreset `json:"-" gorm:"-"`
+	// ExpiresIn deletes uploaded files this many seconds after the upload.
+	// Zero keeps them forever.
+	ExpiresIn int `json:"expires_in"`
+}
+
+// Expiry returns when a file uploaded at uploadedAt with the preset expires,
+// or nil if it does not expire.
+func (p *UploadPreset) Expiry(uploadedAt time.Time) *time.Time {
+	if p.ExpiresIn <= 0 {
+		return nil
+	}
+	expiresAt := uploadedAt.Add(time.Duration(p.ExpiresIn) * time.Second)
+	return &expiresAt
+}
+
+type UploadPresetRepository interface {
+	GetAllPresets(ctx context.Context) ([]UploadPreset, error)
+	GetPresetByName(ctx context.Context, name string) (*UploadPreset, error)
+	CreatePreset(ctx context.Context, preset *UploadPreset) error
+	UpdatePreset(ctx context.Context, preset *UploadPreset) error
+	DeletePreset(ctx context.Context, name string) error
+}
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// Rendition kinds.
+const (
+	RenditionPDF       = "pdf"
+	RenditionThumbnail = "thumbnail"
+	RenditionWebP      = "webp"
+	RenditionAVIF      = "avif"
+	RenditionResized   = "resized"
+)
+
+// Rendition is a file derived from a media, e.g. the PDF preview of a
+// document or a resized copy of an image. Rendition files live in the
+// uploads/renditions folder and are deleted together with their source.
+type Rendition struct {
+	ID         uint      `json:"id" gorm:"primarykey"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	SourceType string    `json:"source_type" gorm:"uniqueIndex:idx_rendition;not null"`
+	SourceID   uint      `json:"source_id" gorm:"uniqueIndex:idx_rendition;not null"`
+	// Kind is what the rendition is, see RenditionPDF.
+	Kind string `json:"kind" gorm:"uniqueIndex:idx_rendition;not null"`
+	// Variant tells renditions of the same kind apart, e.g. "800x600".
+	Variant     string `json:"variant" gorm:"uniqueIndex:idx_rendition;not null;default:''"`
+	FileName    string `json:"file_name" gorm:"uniqueIndex;not null"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	Width       int    `json:"width,omitempty"`
+	Height      int    `json:"height,omitempty"`
+	// LastAccessedAt is when the rendition was last served, to the hour,
+	// or nil if it never was.
+	LastAccessedAt *time.Time `json:"last_accessed_at"`
+}
+
+// LastUsed returns when the rendition was last served, or else written.
+func (r Rendition) LastUsed() time.Time {
+	if r.LastAccessedAt != nil && r.LastAccessedAt.After(r.UpdatedAt) {
+		return *r.LastAccessedAt
+	}
+	return r.UpdatedAt
+}
+
+type RenditionRepository interface {
+	// GetRenditions returns the renditions of a media, oldest first.
+	GetRenditions(ctx context.Context, sourceType string, sourceID uint) ([]Rendition, error)
+	// GetRendition returns the rendition of a media with the given kind and
+	// variant, or gorm.ErrRecordNotFound.
+	GetRendition(ctx context.Context, sourceType string, sourceID uint, kind, variant string) (Rendition, error)
+	// SaveRendition stores the rendition, replacing the one of the same
+	// source, kind and variant.
+	SaveRendition(ctx context.Context, rendition *Rendition) error
+	GetRenditionByFileName(ctx context.Context, fileName string) (Rendition, error)
+	// GetRenditionsOfKinds returns the renditions of the given kinds, least
+	// recently used first.
+	GetRenditionsOfKinds(ctx context.Context, kinds []string) ([]Rendition, error)
+	// TouchRendition records that the rendition was served at the given
+	// time.
+	TouchRendition(ctx context.Context, id uint, at time.Time) error
+	// DeleteRendition removes the record of a rendition, leaving its file to
+	// the caller.
+	DeleteRendition(ctx context.Context, id uint) error
+	// DeleteRenditionsFor removes the renditions of a media and returns them,
+	// so their files can be deleted.
+	DeleteRenditionsFor(ctx context.Context, sourceType string, sourceID uint) ([]Rendition, error)
+}
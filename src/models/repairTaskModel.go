@@ -0,0 +1,38 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Repair task states.
+const (
+	RepairStatusPending  = "pending"
+	RepairStatusRepaired = "repaired"
+	RepairStatusFailed   = "failed"
+)
+
+// RepairTask records a file missing from the uploads folder that was served
+// from a fallback source, so it can be copied back.
+type RepairTask struct {
+	gorm.Model
+	MediaType string `json:"media_type" gorm:"index"`
+	FileName  string `json:"file_name" gorm:"index"`
+	// Source is the fallback the file was found in.
+	Source     string     `json:"source"`
+	Status     string     `json:"status" gorm:"index"`
+	Error      string     `json:"error,omitempty"`
+	RepairedAt *time.Time `json:"repaired_at"`
+}
+
+type RepairTaskRepository interface {
+	// AddRepairTask records a pending task unless one is already pending for
+	// the same file.
+	AddRepairTask(ctx context.Context, task *RepairTask) error
+	// GetRepairTasks returns the tasks with status, or all of them for an
+	// empty status, newest first.
+	GetRepairTasks(ctx context.Context, status string) ([]RepairTask, error)
+	UpdateRepairTask(ctx context.Context, task *RepairTask) error
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// MediaChange is the state of an image or document record as exchanged by
+// replication.
+type MediaChange struct {
+	Type     string
+	ID       uint
+	UUID     string
+	FileName string
+	Checksum []byte
+	// ChecksumAlgorithm is the algorithm Checksum was computed with.
+	ChecksumAlgorithm string
+	ExpiresAt         *time.Time
+	// ChangedAt is when the record was last updated, or deleted.
+	ChangedAt time.Time
+	Deleted   bool
+}
+
+type ReplicationRepository interface {
+	// GetChanges returns up to limit records of mediaType, including deleted
+	// ones, changed after changedAt or at changedAt with an ID above afterID,
+	// in the order they changed.
+	GetChanges(ctx context.Context, mediaType string, changedAt time.Time, afterID uint, limit int) ([]MediaChange, error)
+	// GetMediaByUUID returns the record of mediaType with uuid, or
+	// gorm.ErrRecordNotFound.
+	GetMediaByUUID(ctx context.Context, mediaType, uuid string) (MediaChange, error)
+}
@@ -0,0 +1,25 @@
+package models
+
+import "context"
+
+// SearchResult is a file matching a full-text search, with an excerpt of the
+// matching text. Matched terms in Snippet are wrapped in <mark> tags.
+type SearchResult struct {
+	Type     string `json:"type"`
+	FileName string `json:"file_name"`
+	Snippet  string `json:"snippet"`
+}
+
+// SearchRepository maintains the full-text index of file contents.
+type SearchRepository interface {
+	// Index stores the text of a file, replacing any previous text.
+	Index(ctx context.Context, mediaType, fileName, text string) error
+	Remove(ctx context.Context, mediaType, fileName string) error
+	Rename(ctx context.Context, mediaType, oldFileName, newFileName string) error
+	// Search returns the best matches for query, which is treated as a list
+	// of terms that must all occur.
+	Search(ctx context.Context, query string, limit int) ([]SearchResult, error)
+	// Unindexed returns the names of files of the given type that have a
+	// record but no indexed text.
+	Unindexed(ctx context.Context, mediaType string) ([]string, error)
+}
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Permissions that can be granted to service accounts. Human users are
+// governed by their role instead.
+const (
+	PermissionMediaUpload    = "media:upload"
+	PermissionMediaDelete    = "media:delete"
+	PermissionMediaRename    = "media:rename"
+	PermissionMediaResize    = "media:resize"
+	PermissionMediaRelations = "media:relations"
+	PermissionMediaShare     = "media:share"
+	PermissionPresetsRead    = "presets:read"
+	// PermissionReplicationRead lets secondary instances pull every media
+	// file, see package replication. It is only honored for accounts not
+	// limited to an organization.
+	PermissionReplicationRead = "replication:read"
+)
+
+// Permissions lists every permission a service account can hold.
+var Permissions = []string{
+	PermissionMediaUpload,
+	PermissionMediaDelete,
+	PermissionMediaRename,
+	PermissionMediaResize,
+	PermissionMediaRelations,
+	PermissionMediaShare,
+	PermissionPresetsRead,
+	PermissionReplicationRead,
+}
+
+// ServiceAccount is a non-human principal for integrations such as CI
+// systems. It cannot log in with a password and authenticates with API keys
+// only. When OrganizationID is set the account can only modify media owned
+// by that organization.
+type ServiceAccount struct {
+	gorm.Model
+
+	Name           string     `json:"name" gorm:"unique;not null"`
+	Description    string     `json:"description"`
+	OrganizationID *uint      `json:"organization_id" gorm:"index"`
+	Permissions    string     `json:"permissions"`
+	Disabled       bool       `json:"disabled"`
+	CreatedBy      uint       `json:"created_by"`
+	LastUsedAt     *time.Time `json:"last_used_at"`
+}
+
+// HasPermission reports whether the account was granted permission.
+func (s *ServiceAccount) HasPermission(permission string) bool {
+	for _, p := range strings.Split(s.Permissions, ",") {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKey authenticates a service account. Only a SHA-256 hash of the key is
+// stored; Prefix is kept so keys can be told apart in listings.
+type APIKey struct {
+	gorm.Model
+
+	ServiceAccountID uint           `json:"service_account_id" gorm:"not null;index"`
+	ServiceAccount   ServiceAccount `json:"-" gorm:"foreignKey:ServiceAccountID"`
+	Name             string         `json:"name"`
+	Prefix           string         `json:"prefix" gorm:"not null"`
+	KeyHash          string         `json:"-" gorm:"unique;not null"`
+	ExpiresAt        *time.Time     `json:"expires_at"`
+	LastUsedAt       *time.Time     `json:"last_used_at"`
+}
+
+type ServiceAccountRepository interface {
+	GetAllServiceAccounts(ctx context.Context) ([]ServiceAccount, error)
+	GetServiceAccountByID(ctx context.Context, id uint) (*ServiceAccount, error)
+	GetServiceAccountByName(ctx context.Context, name string) (*ServiceAccount, error)
+	CreateServiceAccount(ctx context.Context, account *ServiceAccount) error
+	UpdateServiceAccount(ctx context.Context, account *ServiceAccount) error
+	DeleteServiceAccount(ctx context.Context, id uint) error
+
+	// API keys
+	CreateAPIKey(ctx context.Context, key *APIKey) error
+	GetAPIKeys(ctx context.Context, serviceAccountID uint) ([]APIKey, error)
+	GetAPIKeyByHash(ctx context.Context, hash string) (*APIKey, error)
+	DeleteAPIKey(ctx context.Context, serviceAccountID, keyID uint) error
+	TouchAPIKey(ctx context.Context, key *APIKey) error
+}
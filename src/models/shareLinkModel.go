@@ -0,0 +1,98 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// ShareLink is a public, unguessable link to a single file or, when Files is
+// set, a bundle of files. Depending on Landing a single file link serves the
+// file itself or a landing page describing it; bundles always have a landing
+// page listing their contents.
+type ShareLink struct {
+	gorm.Model
+
+	Token     string `json:"token" gorm:"uniqueIndex;not null"`
+	MediaType string `json:"media_type"`
+	FileName  string `json:"file_name"`
+	// Name is the title of a bundle and the name of its zip archive.
+	Name  string          `json:"name,omitempty"`
+	Files []ShareLinkFile `json:"files,omitempty"`
+	// OrganizationID is the organization of the shared file, whose branding
+	// the landing page uses.
+	OrganizationID *uint `json:"organization_id" gorm:"index"`
+	// Landing serves a landing page with a preview and a download button
+	// instead of the file bytes. ?raw=1 bypasses it.
+	Landing   bool       `json:"landing"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	CreatedBy uint       `json:"created_by"`
+	// PasswordHash is the bcrypt hash of the password visitors must enter,
+	// empty for links without one.
+	PasswordHash string `json:"-"`
+	// MaxDownloads is the number of downloads after which the link stops
+	// working, 0 for no limit. DownloadCount counts them.
+	MaxDownloads  int `json:"max_downloads"`
+	DownloadCount int `json:"download_count"`
+}
+
+// ShareLinkFile is one of the files of a bundle share link.
+type ShareLinkFile struct {
+	ID          uint   `json:"-" gorm:"primarykey"`
+	ShareLinkID uint   `json:"-" gorm:"index;not null"`
+	MediaType   string `json:"media_type" gorm:"not null"`
+	FileName    string `json:"file_name" gorm:"not null"`
+}
+
+// IsBundle reports whether the link shares several files.
+func (l *ShareLink) IsBundle() bool {
+	return len(l.Files) > 0
+}
+
+// Expired reports whether the link can no longer be used.
+func (l *ShareLink) Expired() bool {
+	return l.ExpiresAt != nil && time.Now().After(*l.ExpiresAt)
+}
+
+// Exhausted reports whether the link reached its download limit.
+func (l *ShareLink) Exhausted() bool {
+	return l.MaxDownloads > 0 && l.DownloadCount >= l.MaxDownloads
+}
+
+// Active reports whether the link still serves its files.
+func (l *ShareLink) Active() bool {
+	return !l.Expired() && !l.Exhausted()
+}
+
+// HasPassword reports whether visitors must enter a password.
+func (l *ShareLink) HasPassword() bool {
+	return l.PasswordHash != ""
+}
+
+// SetPassword hashes password as the one visitors must enter.
+func (l *ShareLink) SetPassword(password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	l.PasswordHash = string(hash)
+	return nil
+}
+
+// CheckPassword verifies a password entered by a visitor.
+func (l *ShareLink) CheckPassword(password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(l.PasswordHash), []byte(password)) == nil
+}
+
+type ShareLinkRepository interface {
+	GetAllShareLinks(ctx context.Context) ([]ShareLink, error)
+	GetShareLinkByToken(ctx context.Context, token string) (*ShareLink, error)
+	GetShareLinkByID(ctx context.Context, id uint) (*ShareLink, error)
+	CreateShareLink(ctx context.Context, link *ShareLink) error
+	// RecordShareDownload counts a download of the link, reporting false
+	// without counting it once the link reached its download limit.
+	RecordShareDownload(ctx context.Context, id uint) (bool, error)
+	DeleteShareLink(ctx context.Context, id uint) error
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+// Takedown is the tombstone left behind when a file is removed for policy or
+// legal reasons. Requests for the file are answered with Status (451 or 410)
+// and the reason instead of a generic 404.
+type Takedown struct {
+	gorm.Model
+
+	MediaType  string `json:"media_type" gorm:"not null;index:idx_takedown_media"`
+	FileName   string `json:"file_name" gorm:"not null;index:idx_takedown_media"`
+	Status     int    `json:"status" gorm:"not null"`
+	ReasonCode string `json:"reason_code" gorm:"not null"`
+	Reason     string `json:"reason"`
+	// BlockedBy identifies the authority that requested the takedown and is
+	// sent in the Link header of 451 responses (RFC 7725).
+	BlockedBy string `json:"blocked_by"`
+	CreatedBy uint   `json:"created_by"`
+}
+
+type TakedownRepository interface {
+	GetAllTakedowns(ctx context.Context) ([]Takedown, error)
+	GetTakedown(ctx context.Context, mediaType, fileName string) (*Takedown, error)
+	AddTakedown(ctx context.Context, takedown *Takedown) error
+	DeleteTakedown(ctx context.Context, id uint) (*Takedown, error)
+}
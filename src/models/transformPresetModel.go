@@ -0,0 +1,38 @@
+package models
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+// TransformPreset is a named image transformation recipe, e.g. "thumb" or
+// "hero". Public URLs can only request transformations through presets so
+// clients cannot force arbitrary, expensive transformations.
+type TransformPreset struct {
+	gorm.Model
+
+	Name    string `json:"name" gorm:"unique;not null"`
+	Width   int    `json:"width"`
+	Height  int    `json:"height"`
+	Fit     string `json:"fit"`
+	Format  string `json:"format"`
+	Quality int    `json:"quality"`
+	// Gravity places the crop of the cover fit, e.g. "focal" to keep the
+	// focal point of each image in view.
+	Gravity string `json:"gravity"`
+	// Signed presets are only served when the URL carries a valid
+	// signature for the preset and file name.
+	Signed bool `json:"signed"`
+	// MaxDPR caps the device pixel ratio requested through client hints or
+	// ?dpr=. Zero allows the highest supported ratio, 1 disables scaling.
+	MaxDPR float64 `json:"max_dpr"`
+}
+
+type TransformPresetRepository interface {
+	GetAllTransformPresets(ctx context.Context) ([]TransformPreset, error)
+	GetTransformPresetByName(ctx context.Context, name string) (*TransformPreset, error)
+	CreateTransformPreset(ctx context.Context, preset *TransformPreset) error
+	UpdateTransformPreset(ctx context.Context, preset *TransformPreset) error
+	DeleteTransformPreset(ctx context.Context, name string) error
+}
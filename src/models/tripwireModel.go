@@ -0,0 +1,26 @@
+package models
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+// Tripwire marks files as honeypots. Any request for a file matching Pattern
+// (a path.Match glob such as "private-*") raises an alert with the
+// requester's details.
+type Tripwire struct {
+	gorm.Model
+
+	// MediaType restricts the tripwire to images or docs; empty matches both.
+	MediaType string `json:"media_type"`
+	Pattern   string `json:"pattern" gorm:"not null"`
+	Note      string `json:"note"`
+	CreatedBy uint   `json:"created_by"`
+}
+
+type TripwireRepository interface {
+	GetAllTripwires(ctx context.Context) ([]Tripwire, error)
+	AddTripwire(ctx context.Context, tripwire *Tripwire) error
+	DeleteTripwire(ctx context.Context, id uint) error
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"context"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
@@ -28,6 +29,10 @@ type UserSession struct {
 	RefreshToken string    `json:"-" gorm:"unique;not null"`
 	ExpiresAt    time.Time `json:"expires_at" gorm:"not null"`
 	IsRevoked    bool      `json:"is_revoked" gorm:"default:false"`
+	// Device details recorded when the session was created or last refreshed
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	LastUsedAt *time.Time `json:"last_used_at"`
 }
 
 type PasswordReset struct {
@@ -39,28 +44,45 @@ type PasswordReset struct {
 	IsUsed    bool      `json:"is_used" gorm:"default:false"`
 }
 
+// BackupCode is a single-use 2FA recovery code. Only a hash of the code is
+// stored.
+type BackupCode struct {
+	gorm.Model
+	UserID   uint       `json:"user_id" gorm:"not null;index"`
+	CodeHash string     `json:"-" gorm:"not null"`
+	UsedAt   *time.Time `json:"used_at"`
+}
+
 // UserRepository interface for database operations
 type UserRepository interface {
-	CreateUser(user *User) error
-	GetUserByEmail(email string) (*User, error)
-	GetUserByID(id uint) (*User, error)
-	UpdateUser(user *User) error
-	DeleteUser(id uint) error
-	GetAllUsers() ([]User, error)
-	CountUsers() (int64, error)
+	CreateUser(ctx context.Context, user *User) error
+	GetUserByEmail(ctx context.Context, email string) (*User, error)
+	GetUserByID(ctx context.Context, id uint) (*User, error)
+	UpdateUser(ctx context.Context, user *User) error
+	DeleteUser(ctx context.Context, id uint) error
+	GetAllUsers(ctx context.Context) ([]User, error)
+	CountUsers(ctx context.Context) (int64, error)
 
 	// Session management
-	CreateSession(session *UserSession) error
-	GetSessionByRefreshToken(token string) (*UserSession, error)
-	RevokeSession(sessionID uint) error
-	RevokeAllUserSessions(userID uint) error
+	CreateSession(ctx context.Context, session *UserSession) error
+	GetSessionByRefreshToken(ctx context.Context, token string) (*UserSession, error)
+	RevokeSession(ctx context.Context, sessionID uint) error
+	RevokeAllUserSessions(ctx context.Context, userID uint) error
+	RotateSession(ctx context.Context, session *UserSession) error
+	GetActiveSessions(ctx context.Context, userID uint) ([]UserSession, error)
+	RevokeUserSession(ctx context.Context, userID, sessionID uint) error
 
 	// Password reset
-	CreatePasswordReset(reset *PasswordReset) error
-	GetPasswordResetByToken(token string) (*PasswordReset, error)
-	MarkPasswordResetAsUsed(resetID uint) error
-	UpdateUserEmail(userID uint, newEmail string) error
-	Set2FA(userID uint, secret string, enabled bool) error
+	CreatePasswordReset(ctx context.Context, reset *PasswordReset) error
+	GetPasswordResetByToken(ctx context.Context, token string) (*PasswordReset, error)
+	MarkPasswordResetAsUsed(ctx context.Context, resetID uint) error
+	UpdateUserEmail(ctx context.Context, userID uint, newEmail string) error
+	Set2FA(ctx context.Context, userID uint, secret string, enabled bool) error
+
+	// 2FA backup codes
+	ReplaceBackupCodes(ctx context.Context, userID uint, hashes []string) error
+	UseBackupCode(ctx context.Context, userID uint, hash string) (bool, error)
+	CountBackupCodes(ctx context.Context, userID uint) (int64, error)
 }
 
 // HashPassword hashes a plain text password
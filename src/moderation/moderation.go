@@ -0,0 +1,120 @@
+// Package moderation holds back uploads by users other than admins until an
+// admin approves them, while the moderation_enabled setting is on, and
+// notifies hooks of the uploads waiting for review and of the decisions.
+package moderation
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/alert"
+	"github.com/kevinanielsen/go-fast-cdn/src/auth"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/settings"
+)
+
+// Types of the notifications.
+const (
+	TypePending  = "moderation.pending"
+	TypeApproved = "moderation.approved"
+	TypeRejected = "moderation.rejected"
+)
+
+// Notification tells about an upload waiting for review or the decision on
+// one.
+type Notification struct {
+	Type           string    `json:"type"`
+	Time           time.Time `json:"time"`
+	MediaType      string    `json:"media_type"`
+	FileName       string    `json:"file_name"`
+	UUID           string    `json:"uuid,omitempty"`
+	OrganizationID *uint     `json:"organization_id,omitempty"`
+	// Actor is the user who uploaded pending media, or the admin who
+	// decided on it.
+	Actor string `json:"actor,omitempty"`
+	// Reason is the explanation given for a rejection, if any.
+	Reason string `json:"reason,omitempty"`
+}
+
+// Hook is called with every notification.
+type Hook func(Notification)
+
+var (
+	hooksMu sync.RWMutex
+	hooks   []Hook
+)
+
+// AddHook registers hook to be called with every notification. Hooks run on
+// the goroutine of the request, so slow work belongs in the job queue.
+func AddHook(hook Hook) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	hooks = append(hooks, hook)
+}
+
+// Enabled reports whether uploads are moderated.
+func Enabled() bool {
+	return settings.Default.Bool(settings.ModerationEnabled)
+}
+
+// UploadStatus returns the moderation status of the media uploaded by the
+// request: pending for users other than admins while moderation is
+// enabled, and approved otherwise. Service accounts are trusted
+// integrations, so their uploads are never held back.
+func UploadStatus(c *gin.Context) string {
+	if !Enabled() {
+		return models.ModerationStatusApproved
+	}
+	principal, ok := auth.PrincipalFrom(c)
+	if !ok || principal.User == nil || principal.Role == "admin" {
+		return models.ModerationStatusApproved
+	}
+	return models.ModerationStatusPending
+}
+
+// Notify calls the hooks with n. The actor defaults to the user making the
+// request.
+func Notify(c *gin.Context, n Notification) {
+	if n.Time.IsZero() {
+		n.Time = time.Now()
+	}
+	if n.Actor == "" {
+		n.Actor = c.GetString("user_email")
+	}
+
+	hooksMu.RLock()
+	defer hooksMu.RUnlock()
+	for _, hook := range hooks {
+		hook(n)
+	}
+}
+
+// AlertHook forwards notifications to the alert webhook, see alert.Notify,
+// so admins learn about uploads waiting for review.
+func AlertHook(n Notification) {
+	text := n.MediaType + " " + n.FileName
+	switch n.Type {
+	case TypePending:
+		text += " awaits approval"
+	case TypeApproved:
+		text += " was approved"
+	case TypeRejected:
+		text += " was rejected"
+	}
+	if n.Actor != "" {
+		text += " (" + n.Actor + ")"
+	}
+	alert.Notify(alert.Alert{
+		Type: n.Type,
+		Text: text,
+		Time: n.Time,
+		Details: map[string]any{
+			"media_type":      n.MediaType,
+			"file_name":       n.FileName,
+			"uuid":            n.UUID,
+			"organization_id": n.OrganizationID,
+			"reason":          n.Reason,
+		},
+	})
+}
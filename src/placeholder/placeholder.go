@@ -0,0 +1,104 @@
+// Package placeholder computes the blurhash and dominant color of images in
+// the background, so front-ends can render a placeholder while an image
+// loads.
+package placeholder
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"image"
+	"log"
+	"path/filepath"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/imaging"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/queue"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"gorm.io/gorm"
+)
+
+// Job is the kind of the background jobs computing a placeholder.
+const Job = "image.placeholder"
+
+type payload struct {
+	FileName string `json:"file_name"`
+}
+
+// RegisterJobs registers the handler of Job with the queue.
+func RegisterJobs(images models.ImageRepository) {
+	queue.Register(Job, func(ctx context.Context, data []byte) error {
+		var p payload
+		if err := json.Unmarshal(data, &p); err != nil {
+			return err
+		}
+		return Compute(ctx, images, p.FileName)
+	})
+}
+
+// Enqueue computes the placeholder of an image in the background, or right
+// away when the queue isn't running. Errors are logged: an image without a
+// placeholder can still be shown.
+func Enqueue(ctx context.Context, images models.ImageRepository, fileName string) {
+	var err error
+	if queue.Running() {
+		err = queue.Enqueue(ctx, Job, payload{FileName: fileName})
+	} else {
+		err = Compute(ctx, images, fileName)
+	}
+	if err != nil {
+		log.Printf("Failed to compute the placeholder of image %s: %s", fileName, err.Error())
+	}
+}
+
+// Compute records the placeholder of the image fileName. Images that were
+// deleted in the meantime or cannot be decoded, e.g. SVG images, are
+// skipped.
+func Compute(ctx context.Context, images models.ImageRepository, fileName string) error {
+	_, err := compute(ctx, images, fileName)
+	return err
+}
+
+// compute works like Compute and reports whether a placeholder was recorded.
+func compute(ctx context.Context, images models.ImageRepository, fileName string) (bool, error) {
+	if _, err := images.GetImageByFileName(ctx, fileName); errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	p, err := imaging.PlaceholderFile(filepath.Join(util.ExPath, "uploads", "images", fileName))
+	if errors.Is(err, image.ErrFormat) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, images.UpdateImagePlaceholder(ctx, fileName, p.Blurhash, p.DominantColor)
+}
+
+// Backfill computes the placeholders of the images uploaded before
+// placeholders were available, or whose content changed since, and returns
+// the number of computed placeholders.
+func Backfill(ctx context.Context, images models.ImageRepository) int {
+	names, err := images.GetImagesWithoutPlaceholder(ctx)
+	if err != nil {
+		log.Printf("Failed to find images without placeholder: %s", err.Error())
+		return 0
+	}
+
+	computed := 0
+	for _, name := range names {
+		ok, err := compute(ctx, images, name)
+		if err != nil {
+			log.Printf("Failed to compute the placeholder of image %s: %s", name, err.Error())
+			continue
+		}
+		if ok {
+			computed++
+		}
+	}
+	if computed > 0 {
+		log.Printf("Computed placeholders of %d images", computed)
+	}
+	return computed
+}
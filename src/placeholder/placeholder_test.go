@@ -0,0 +1,50 @@
+package placeholder
+
+import (
+	"context"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackfill(t *testing.T) {
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	ctx := context.Background()
+	imageDir := filepath.Join(util.ExPath, "uploads", "images")
+	require.NoError(t, os.MkdirAll(imageDir, 0o755))
+
+	file, err := os.Create(filepath.Join(imageDir, "photo.png"))
+	require.NoError(t, err)
+	require.NoError(t, png.Encode(file, image.NewGray(image.Rect(0, 0, 40, 30))))
+	require.NoError(t, file.Close())
+	require.NoError(t, os.WriteFile(filepath.Join(imageDir, "icon.svg"), []byte(`<svg xmlns="http://www.w3.org/2000/svg"/>`), 0o644))
+
+	images := database.NewImageRepo(database.DB)
+	for _, name := range []string{"photo.png", "icon.svg"} {
+		_, err := images.AddImage(ctx, models.Image{FileName: name, Checksum: []byte(name)})
+		require.NoError(t, err)
+	}
+
+	// SVG images cannot be decoded and are skipped
+	require.Equal(t, 1, Backfill(ctx, images))
+	photo, err := images.GetImageByFileName(ctx, "photo.png")
+	require.NoError(t, err)
+	require.Equal(t, "L00000fQfQfQfQfQfQfQfQfQfQfQ", photo.Blurhash)
+	require.Equal(t, "#000000", photo.DominantColor)
+
+	// Changed content clears the placeholder until it is computed again
+	require.NoError(t, images.UpdateImageChecksum(ctx, "photo.png", models.ChecksumMD5, []byte("new")))
+	names, err := images.GetImagesWithoutPlaceholder(ctx)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"photo.png", "icon.svg"}, names)
+	require.NoError(t, Compute(ctx, images, "photo.png"))
+	require.NoError(t, Compute(ctx, images, "deleted.png"))
+}
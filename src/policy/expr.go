@@ -0,0 +1,120 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/vm"
+	"github.com/kevinanielsen/go-fast-cdn/src/hooks"
+)
+
+// Expressions are written in the language of expr-lang/expr, restricted to
+// the fields of media and request and the functions below. Its builtins are
+// disabled and its virtual machine bounds the memory an expression
+// allocates, which keeps policies sandboxed.
+
+// maxExprLength limits the source of a single expression.
+const maxExprLength = 4096
+
+// env is what expressions are evaluated against.
+type env struct {
+	Media   mediaEnv   `expr:"media"`
+	Request requestEnv `expr:"request"`
+	// Header and Query return a header and a query parameter of the
+	// request.
+	Header func(name string) string `expr:"header"`
+	Query  func(name string) string `expr:"query"`
+}
+
+type mediaEnv struct {
+	Kind           string `expr:"kind"`
+	FileName       string `expr:"file_name"`
+	MimeType       string `expr:"mime_type"`
+	Size           int64  `expr:"size"`
+	UUID           string `expr:"uuid"`
+	OrganizationID int64  `expr:"organization_id"`
+}
+
+type requestEnv struct {
+	Method string `expr:"method"`
+	Path   string `expr:"path"`
+	IP     string `expr:"ip"`
+	User   string `expr:"user"`
+	Role   string `expr:"role"`
+}
+
+func newEnv(m hooks.Media) *env {
+	e := &env{
+		Media:   mediaEnv{Kind: m.Type, FileName: m.FileName, MimeType: m.MimeType, Size: m.Size, UUID: m.UUID},
+		Request: requestEnv{IP: m.IP, User: m.Actor, Role: m.Role},
+		Header:  func(string) string { return "" },
+		Query:   func(string) string { return "" },
+	}
+	if m.OrganizationID != nil {
+		e.Media.OrganizationID = int64(*m.OrganizationID)
+	}
+	if m.Request != nil {
+		e.Request.Method = m.Request.Method
+		e.Request.Path = m.Request.URL.Path
+		e.Header = m.Request.Header.Get
+		e.Query = m.Request.URL.Query().Get
+	}
+	return e
+}
+
+var functions = []expr.Option{
+	expr.Function("has_prefix", func(args ...any) (any, error) {
+		return strings.HasPrefix(args[0].(string), args[1].(string)), nil
+	}, new(func(string, string) bool)),
+	expr.Function("has_suffix", func(args ...any) (any, error) {
+		return strings.HasSuffix(args[0].(string), args[1].(string)), nil
+	}, new(func(string, string) bool)),
+	expr.Function("lower", func(args ...any) (any, error) {
+		return strings.ToLower(args[0].(string)), nil
+	}, new(func(string) string)),
+	expr.Function("upper", func(args ...any) (any, error) {
+		return strings.ToUpper(args[0].(string)), nil
+	}, new(func(string) string)),
+	expr.Function("ext", func(args ...any) (any, error) {
+		return strings.ToLower(filepath.Ext(args[0].(string))), nil
+	}, new(func(string) string)),
+	expr.Function("len", func(args ...any) (any, error) {
+		return int64(len(args[0].(string))), nil
+	}, new(func(string) int64)),
+}
+
+// compile parses src and checks it against env. opts set the type of its
+// result, e.g. expr.AsBool().
+func compile(src string, opts ...expr.Option) (*vm.Program, error) {
+	if len(src) > maxExprLength {
+		return nil, fmt.Errorf("expression is longer than %d characters", maxExprLength)
+	}
+	var patterns literalPatterns
+	options := append([]expr.Option{expr.Env(env{}), expr.DisableAllBuiltins(), expr.Patch(&patterns)}, functions...)
+	program, err := expr.Compile(src, append(options, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+	return program, patterns.err
+}
+
+// literalPatterns rejects matches with a pattern that is not a string
+// literal, so that every pattern is compiled once, and checked, when the
+// policy is loaded.
+type literalPatterns struct {
+	err error
+}
+
+func (v *literalPatterns) Visit(node *ast.Node) {
+	n, ok := (*node).(*ast.BinaryNode)
+	if !ok || n.Operator != "matches" {
+		return
+	}
+	if _, ok := n.Right.(*ast.StringNode); !ok && v.err == nil {
+		v.err = errors.New("the pattern of matches must be a string literal")
+	}
+}
@@ -0,0 +1,275 @@
+// Package policy evaluates request-time policies, e.g. naming rules,
+// redirects or custom rejection reasons, without rebuilding the server. A
+// policy is a YAML file of rules whose conditions are sandboxed expressions
+// of expr-lang/expr over the request and the media, see expr.go. Rules are
+// checked at uploads and deletions, WebDAV included, through an upload hook,
+// and at downloads through middleware.Policy.
+//
+// Policies are deliberately limited to expressions deciding between
+// accepting, rejecting and redirecting, rather than Lua or WASM scripts:
+// expressions cover the naming rules, routing and rejection reasons policies
+// are for, while a script engine would add a runtime whose loops, memory
+// and host calls all need sandboxing of their own.
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+	"github.com/kevinanielsen/go-fast-cdn/src/hooks"
+	"gopkg.in/yaml.v3"
+)
+
+// Events the rules of a policy apply to.
+const (
+	EventUpload   = "upload"
+	EventDownload = "download"
+	EventDelete   = "delete"
+)
+
+// Rule is a rule of a policy file:
+//
+//	rules:
+//	  - name: lower-case-names
+//	    on: [upload]
+//	    when: 'not (media.file_name matches "^[a-z0-9._-]+$")'
+//	    reject: "{{ media.file_name }} must be lower case"
+type Rule struct {
+	Name string   `yaml:"name"`
+	On   []string `yaml:"on"`
+	// When is the condition of the rule, which applies to every request if
+	// left out.
+	When string `yaml:"when"`
+	// Reject refuses the request with this reason, in which expressions in
+	// {{ }} are replaced with their value.
+	Reject string `yaml:"reject"`
+	// Status is the status of rejected downloads, 403 by default. Rejected
+	// uploads and deletions are answered with 422.
+	Status int `yaml:"status"`
+	// Redirect is an expression returning the URL to redirect downloads to.
+	Redirect string `yaml:"redirect"`
+
+	when     *vm.Program
+	reason   []reasonPart
+	redirect *vm.Program
+}
+
+type reasonPart struct {
+	text    string
+	program *vm.Program
+}
+
+// Policy is a loaded policy file.
+type Policy struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// Decision is the outcome of the first rule applying to a request.
+type Decision struct {
+	Rule     string
+	Reject   string
+	Status   int
+	Redirect string
+}
+
+var placeholder = regexp.MustCompile(`\{\{(.*?)\}\}`)
+
+// Parse reads a policy file and compiles its expressions, so mistakes are
+// reported when the policy is loaded rather than when it is evaluated.
+func Parse(data []byte) (*Policy, error) {
+	var p Policy
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+	for i := range p.Rules {
+		if err := p.Rules[i].compile(); err != nil {
+			name := p.Rules[i].Name
+			if name == "" {
+				name = fmt.Sprintf("%d", i+1)
+			}
+			return nil, fmt.Errorf("rule %s: %w", name, err)
+		}
+	}
+	return &p, nil
+}
+
+func (r *Rule) compile() error {
+	if len(r.On) == 0 {
+		return errors.New("on lists no events")
+	}
+	for _, event := range r.On {
+		switch event {
+		case EventUpload, EventDelete:
+			if r.Redirect != "" {
+				return fmt.Errorf("only downloads are redirected, not %s", event)
+			}
+		case EventDownload:
+		default:
+			return fmt.Errorf("unknown event %s", event)
+		}
+	}
+	if (r.Reject == "") == (r.Redirect == "") {
+		return errors.New("exactly one of reject and redirect must be set")
+	}
+
+	var err error
+	if r.When != "" {
+		if r.when, err = compile(r.When, expr.AsBool()); err != nil {
+			return fmt.Errorf("when: %w", err)
+		}
+	}
+	if r.Redirect != "" {
+		if r.redirect, err = compile(r.Redirect, expr.AsKind(reflect.String)); err != nil {
+			return fmt.Errorf("redirect: %w", err)
+		}
+	}
+	last := 0
+	for _, match := range placeholder.FindAllStringSubmatchIndex(r.Reject, -1) {
+		compiled, err := compile(strings.TrimSpace(r.Reject[match[2]:match[3]]))
+		if err != nil {
+			return fmt.Errorf("reject: %w", err)
+		}
+		r.reason = append(r.reason, reasonPart{text: r.Reject[last:match[0]]}, reasonPart{program: compiled})
+		last = match[1]
+	}
+	r.reason = append(r.reason, reasonPart{text: r.Reject[last:]})
+	return nil
+}
+
+// Applies reports whether any rule applies to event, so callers can skip
+// looking up what the rules would need.
+func (p *Policy) Applies(event string) bool {
+	if p == nil {
+		return false
+	}
+	for _, r := range p.Rules {
+		if r.appliesTo(event) {
+			return true
+		}
+	}
+	return false
+}
+
+// Evaluate returns the decision of the first rule for event whose condition
+// holds for m, or nil if none does.
+func (p *Policy) Evaluate(event string, m hooks.Media) (*Decision, error) {
+	if p == nil {
+		return nil, nil
+	}
+	env := newEnv(m)
+	for _, r := range p.Rules {
+		if !r.appliesTo(event) {
+			continue
+		}
+		if r.when != nil {
+			holds, err := expr.Run(r.when, env)
+			if err != nil {
+				return nil, fmt.Errorf("rule %s: %w", r.Name, err)
+			}
+			if !holds.(bool) {
+				continue
+			}
+		}
+		d, err := r.decide(env)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", r.Name, err)
+		}
+		return d, nil
+	}
+	return nil, nil
+}
+
+func (r *Rule) appliesTo(event string) bool {
+	for _, on := range r.On {
+		if on == event {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) decide(env *env) (*Decision, error) {
+	d := &Decision{Rule: r.Name, Status: r.Status}
+	if r.redirect != nil {
+		url, err := expr.Run(r.redirect, env)
+		if err != nil {
+			return nil, err
+		}
+		d.Redirect = url.(string)
+		return d, nil
+	}
+
+	var reason strings.Builder
+	for _, part := range r.reason {
+		if part.program == nil {
+			reason.WriteString(part.text)
+			continue
+		}
+		v, err := expr.Run(part.program, env)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprint(&reason, v)
+	}
+	d.Reject = reason.String()
+	return d, nil
+}
+
+// Load reads the policy file at path.
+func Load(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Default is the policy loaded by Start, or nil without POLICY_FILE.
+var Default *Policy
+
+// Start loads the policy file at POLICY_FILE, if set, and checks its upload
+// and delete rules with an upload hook.
+func Start() error {
+	path := os.Getenv("POLICY_FILE")
+	if path == "" {
+		return nil
+	}
+	p, err := Load(path)
+	if err != nil {
+		return fmt.Errorf("policy %s: %w", path, err)
+	}
+	Default = p
+	hooks.Register("policy", Hook{Policy: p})
+	log.Printf("Loaded %d policy rules from %s", len(p.Rules), path)
+	return nil
+}
+
+// Hook applies the upload and delete rules of Policy as an upload hook.
+type Hook struct {
+	hooks.Base
+	Policy *Policy
+}
+
+func (h Hook) PreValidate(ctx context.Context, m hooks.Media) error {
+	return h.check(EventUpload, m)
+}
+
+func (h Hook) PreDelete(ctx context.Context, m hooks.Media) error {
+	return h.check(EventDelete, m)
+}
+
+func (h Hook) check(event string, m hooks.Media) error {
+	d, err := h.Policy.Evaluate(event, m)
+	if err != nil || d == nil {
+		return err
+	}
+	return hooks.Reject(d.Reject)
+}
@@ -0,0 +1,108 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/hooks"
+	"github.com/stretchr/testify/require"
+)
+
+const testPolicy = `
+rules:
+  - name: lower-case-names
+    on: [upload]
+    when: 'not (media.file_name matches "^[a-z0-9._-]+$")'
+    reject: "{{ media.file_name }} must be lower case"
+  - name: large-images
+    on: [upload]
+    when: media.kind == "image" && media.size > 5 * 1024 * 1024 && request.role != "admin"
+    reject: "Images are limited to 5 MB, this one has {{ media.size / 1024 / 1024 }} MB"
+  - name: keep-contracts
+    on: [delete]
+    when: has_prefix(media.file_name, "contract-")
+    reject: Contracts are kept
+  - name: legacy-docs
+    on: [download]
+    when: ext(media.file_name) == ".doc" && query("download") == ""
+    redirect: '"/api/cdn/download/docs/" + media.file_name + "?download=true"'
+  - name: internal
+    on: [download]
+    when: header("X-Internal") != "yes" && media.file_name contains "internal"
+    status: 404
+    reject: Not found
+`
+
+func TestPolicy(t *testing.T) {
+	// Arrange
+	p, err := Parse([]byte(testPolicy))
+	require.NoError(t, err)
+	upload := func(m hooks.Media) *Decision {
+		d, err := p.Evaluate(EventUpload, m)
+		require.NoError(t, err)
+		return d
+	}
+
+	// Act & Assert
+	require.Nil(t, upload(hooks.Media{Type: "image", FileName: "cat.png", Size: 1 << 20}))
+	d := upload(hooks.Media{Type: "image", FileName: "Cat.png"})
+	require.Equal(t, "lower-case-names", d.Rule)
+	require.Equal(t, "Cat.png must be lower case", d.Reject)
+	d = upload(hooks.Media{Type: "image", FileName: "cat.png", Size: 12 << 20})
+	require.Equal(t, "Images are limited to 5 MB, this one has 12 MB", d.Reject)
+	require.Nil(t, upload(hooks.Media{Type: "image", FileName: "cat.png", Size: 12 << 20, Role: "admin"}))
+	require.Nil(t, upload(hooks.Media{Type: "doc", FileName: "report.pdf", Size: 12 << 20}))
+
+	hook := Hook{Policy: p}
+	require.NoError(t, hook.PreDelete(context.Background(), hooks.Media{FileName: "invoice-1.pdf"}))
+	var rejection *hooks.Rejection
+	require.True(t, errors.As(hook.PreDelete(context.Background(), hooks.Media{FileName: "contract-1.pdf"}), &rejection))
+	require.Equal(t, "Contracts are kept", rejection.Reason)
+
+	require.True(t, p.Applies(EventDownload))
+	d, err = p.Evaluate(EventDownload, hooks.Media{Type: "doc", FileName: "old.doc", Request: httptest.NewRequest("GET", "/api/cdn/download/docs/old.doc", nil)})
+	require.NoError(t, err)
+	require.Equal(t, "/api/cdn/download/docs/old.doc?download=true", d.Redirect)
+	d, err = p.Evaluate(EventDownload, hooks.Media{Type: "doc", FileName: "old.doc", Request: httptest.NewRequest("GET", "/api/cdn/download/docs/old.doc?download=true", nil)})
+	require.NoError(t, err)
+	require.Nil(t, d)
+
+	internal := httptest.NewRequest("GET", "/api/cdn/download/docs/internal.pdf", nil)
+	d, err = p.Evaluate(EventDownload, hooks.Media{Type: "doc", FileName: "internal.pdf", Request: internal})
+	require.NoError(t, err)
+	require.Equal(t, 404, d.Status)
+	internal.Header.Set("X-Internal", "yes")
+	d, err = p.Evaluate(EventDownload, hooks.Media{Type: "doc", FileName: "internal.pdf", Request: internal})
+	require.NoError(t, err)
+	require.Nil(t, d)
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for name, rule := range map[string]string{
+		"unknown event":     "{on: [rename], reject: no}",
+		"no action":         "{on: [upload], when: 'true'}",
+		"redirected upload": "{on: [upload], redirect: '\"/\"'}",
+		"not a condition":   "{on: [upload], when: media.size, reject: no}",
+		"unknown field":     "{on: [upload], when: 'media.owner == \"\"', reject: no}",
+		"unknown function":  "{on: [upload], when: 'exec(\"rm\") == \"\"', reject: no}",
+		"kind mismatch":     "{on: [upload], when: 'media.size == \"1\"', reject: no}",
+		"dynamic pattern":   "{on: [upload], when: 'media.file_name matches media.kind', reject: no}",
+		"invalid pattern":   "{on: [upload], when: 'media.file_name matches \"(\"', reject: no}",
+		"no statements":     "{on: [upload], when: 'func() bool { for {} }()', reject: no}",
+		"bad placeholder":   "{on: [upload], reject: '{{ media.nope }}'}",
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := Parse([]byte("rules: [" + rule + "]"))
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestEvaluate_RuntimeError(t *testing.T) {
+	p, err := Parse([]byte(`rules: [{name: ratio, on: [upload], when: "media.size % media.organization_id > 10", reject: no}]`))
+	require.NoError(t, err)
+	_, err = p.Evaluate(EventUpload, hooks.Media{Size: 100})
+	require.ErrorContains(t, err, "integer divide by zero")
+}
@@ -0,0 +1,198 @@
+// Package portable writes every media file plus a manifest of their metadata
+// to a directory or tarball, so the media of one instance can be moved into
+// another one with the importer. The files are stored as images/<file name>
+// and docs/<file name> next to manifest.json.
+package portable
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"gorm.io/gorm"
+)
+
+// ManifestName is the name of the manifest in an archive.
+const ManifestName = "manifest.json"
+
+// ManifestVersion is the version of the manifest format written by Export.
+const ManifestVersion = 1
+
+// Manifest describes the files of an archive.
+type Manifest struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Files     []Entry   `json:"files"`
+	// Missing lists the records, as <folder>/<file name>, whose file is
+	// missing from the uploads folder and was left out.
+	Missing []string `json:"missing,omitempty"`
+}
+
+// Entry describes a file of an archive.
+type Entry struct {
+	// Path is the slash-separated path of the file in the archive.
+	Path     string `json:"path"`
+	Type     string `json:"type"`
+	FileName string `json:"file_name"`
+	UUID     string `json:"uuid"`
+	Size     int64  `json:"size"`
+	SHA256   string `json:"sha256"`
+	// Checksum is the hex encoded checksum used for duplicate detection.
+	Checksum          string `json:"checksum"`
+	ChecksumAlgorithm string `json:"checksum_algorithm"`
+	// Organization is the name of the owning organization, if any. Names
+	// rather than IDs are kept since IDs differ between instances.
+	Organization string     `json:"organization,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+}
+
+// ReadManifest reads the manifest of an extracted archive in dir. It returns
+// an error matching fs.ErrNotExist if dir has no manifest.
+func ReadManifest(dir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ManifestName))
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if m.Version < 1 || m.Version > ManifestVersion {
+		return nil, fmt.Errorf("unsupported manifest version %d", m.Version)
+	}
+	return &m, nil
+}
+
+// Exporter writes the media of an instance to an archive.
+type Exporter struct {
+	Images        models.ImageRepository
+	Docs          models.DocRepository
+	Organizations models.OrganizationRepository
+	// UploadsDir is the folder holding the images and docs folders.
+	UploadsDir string
+}
+
+// Export writes every file and the manifest to dest: a tarball if it ends in
+// .tar, .tar.gz or .tgz, otherwise a directory, which must not exist or be
+// empty. progress, if not nil, is called after each file.
+func (e *Exporter) Export(ctx context.Context, dest string, progress func(done, total int)) (*Manifest, error) {
+	orgNames := map[uint]string{}
+	orgs, err := e.Organizations.GetAllOrganizations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, org := range orgs {
+		orgNames[org.ID] = org.Name
+	}
+
+	images, err := e.Images.GetAllImages(ctx)
+	if err != nil {
+		return nil, err
+	}
+	docs, err := e.Docs.GetAllDocs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	for _, image := range images {
+		entries = append(entries, newEntry(models.MediaTypeImage, image.Model, image.UUID, image.FileName, image.ChecksumAlgorithm, image.Checksum, image.OrganizationID, image.ExpiresAt, orgNames))
+	}
+	for _, doc := range docs {
+		entries = append(entries, newEntry(models.MediaTypeDoc, doc.Model, doc.UUID, doc.FileName, doc.ChecksumAlgorithm, doc.Checksum, doc.OrganizationID, doc.ExpiresAt, orgNames))
+	}
+
+	w, err := newSink(dest)
+	if err != nil {
+		return nil, err
+	}
+	m := &Manifest{Version: ManifestVersion, CreatedAt: time.Now().UTC(), Files: []Entry{}}
+	for i, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			w.Close()
+			return nil, err
+		}
+		err := e.writeFile(w, &entry)
+		if errors.Is(err, fs.ErrNotExist) {
+			m.Missing = append(m.Missing, entry.Path)
+		} else if err != nil {
+			w.Close()
+			return nil, fmt.Errorf("failed to export %s: %w", entry.Path, err)
+		} else {
+			m.Files = append(m.Files, entry)
+		}
+		if progress != nil {
+			progress(i+1, len(entries))
+		}
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err == nil {
+		err = w.WriteFile(ManifestName, int64(len(data)), m.CreatedAt, func(out io.Writer) error {
+			_, err := out.Write(data)
+			return err
+		})
+	}
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func newEntry(mediaType string, model gorm.Model, uuid, fileName, algorithm string, checksum []byte, orgID *uint, expiresAt *time.Time, orgNames map[uint]string) Entry {
+	entry := Entry{
+		Path:              path.Join(models.MediaFolder(mediaType), fileName),
+		Type:              mediaType,
+		FileName:          fileName,
+		UUID:              uuid,
+		Checksum:          hex.EncodeToString(checksum),
+		ChecksumAlgorithm: algorithm,
+		CreatedAt:         model.CreatedAt,
+		UpdatedAt:         model.UpdatedAt,
+		ExpiresAt:         expiresAt,
+	}
+	if orgID != nil {
+		entry.Organization = orgNames[*orgID]
+	}
+	return entry
+}
+
+// writeFile copies the file of entry into the archive, filling in its size
+// and SHA-256
+func (e *Exporter) writeFile(w sink, entry *Entry) error {
+	f, err := os.Open(filepath.Join(e.UploadsDir, filepath.FromSlash(entry.Path)))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	hash := sha256.New()
+	err = w.WriteFile(entry.Path, info.Size(), info.ModTime(), func(out io.Writer) error {
+		_, err := io.Copy(io.MultiWriter(out, hash), f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	entry.Size = info.Size()
+	entry.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return nil
+}
@@ -0,0 +1,97 @@
+package portable
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/stretchr/testify/require"
+)
+
+func newExporter(t *testing.T) *Exporter {
+	t.Helper()
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	uploadsDir := filepath.Join(util.ExPath, "uploads")
+	require.NoError(t, os.MkdirAll(filepath.Join(uploadsDir, "images"), 0o755))
+	require.NoError(t, os.MkdirAll(filepath.Join(uploadsDir, "docs"), 0o755))
+
+	org := models.Organization{Name: "Acme"}
+	require.NoError(t, database.DB.Create(&org).Error)
+	require.NoError(t, database.DB.Create(&models.Image{FileName: "logo.png", Checksum: []byte{1, 2}, OrganizationID: &org.ID}).Error)
+	require.NoError(t, database.DB.Create(&models.Image{FileName: "gone.png", Checksum: []byte{3}}).Error)
+	require.NoError(t, database.DB.Create(&models.Doc{FileName: "notes.txt", Checksum: []byte{4}}).Error)
+	require.NoError(t, os.WriteFile(filepath.Join(uploadsDir, "images", "logo.png"), []byte("logo"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(uploadsDir, "docs", "notes.txt"), []byte("notes"), 0o644))
+
+	return &Exporter{
+		Images:        database.NewImageRepo(database.DB),
+		Docs:          database.NewDocRepo(database.DB),
+		Organizations: database.NewOrganizationRepo(database.DB),
+		UploadsDir:    uploadsDir,
+	}
+}
+
+func TestExport_Directory(t *testing.T) {
+	e := newExporter(t)
+	dest := filepath.Join(t.TempDir(), "export")
+
+	m, err := e.Export(context.Background(), dest, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"images/gone.png"}, m.Missing)
+	require.Len(t, m.Files, 2)
+	logo := m.Files[0]
+	require.Equal(t, "images/logo.png", logo.Path)
+	require.Equal(t, "Acme", logo.Organization)
+	require.Equal(t, "0102", logo.Checksum)
+	require.Equal(t, int64(4), logo.Size)
+	require.NotEmpty(t, logo.UUID)
+
+	data, err := os.ReadFile(filepath.Join(dest, "docs", "notes.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "notes", string(data))
+
+	read, err := ReadManifest(dest)
+	require.NoError(t, err)
+	require.Equal(t, m.Files, read.Files)
+
+	// Exports don't overwrite anything
+	_, err = e.Export(context.Background(), dest, nil)
+	require.Error(t, err)
+}
+
+func TestExport_Tarball(t *testing.T) {
+	e := newExporter(t)
+	dest := filepath.Join(t.TempDir(), "export.tar.gz")
+
+	_, err := e.Export(context.Background(), dest, nil)
+	require.NoError(t, err)
+
+	f, err := os.Open(dest)
+	require.NoError(t, err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	tr := tar.NewReader(gz)
+	files := map[string]string{}
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		data, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		files[header.Name] = string(data)
+	}
+	require.Equal(t, "logo", files["images/logo.png"])
+	require.Equal(t, "notes", files["docs/notes.txt"])
+	require.Contains(t, files, ManifestName)
+}
@@ -0,0 +1,119 @@
+package portable
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// sink is the destination of an archive
+type sink interface {
+	// WriteFile adds the file at the slash-separated path name, whose
+	// contents write produces.
+	WriteFile(name string, size int64, modTime time.Time, write func(io.Writer) error) error
+	Close() error
+}
+
+func newSink(dest string) (sink, error) {
+	lower := strings.ToLower(dest)
+	switch {
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return newTarSink(dest, true)
+	case strings.HasSuffix(lower, ".tar"):
+		return newTarSink(dest, false)
+	default:
+		return newDirSink(dest)
+	}
+}
+
+type dirSink string
+
+func newDirSink(dir string) (sink, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) > 0 {
+		return nil, errors.New(dir + " is not empty")
+	}
+	return dirSink(dir), nil
+}
+
+func (d dirSink) WriteFile(name string, size int64, modTime time.Time, write func(io.Writer) error) error {
+	dest := filepath.Join(string(d), filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if err := write(out); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(dest, modTime, modTime)
+}
+
+func (d dirSink) Close() error {
+	return nil
+}
+
+type tarSink struct {
+	f  *os.File
+	gz *gzip.Writer
+	tw *tar.Writer
+}
+
+func newTarSink(dest string, compress bool) (sink, error) {
+	f, err := os.OpenFile(dest, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	s := &tarSink{f: f}
+	var w io.Writer = f
+	if compress {
+		s.gz = gzip.NewWriter(f)
+		w = s.gz
+	}
+	s.tw = tar.NewWriter(w)
+	return s, nil
+}
+
+func (s *tarSink) WriteFile(name string, size int64, modTime time.Time, write func(io.Writer) error) error {
+	err := s.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     0o644,
+		ModTime:  modTime,
+	})
+	if err != nil {
+		return err
+	}
+	return write(s.tw)
+}
+
+func (s *tarSink) Close() error {
+	err := s.tw.Close()
+	if s.gz != nil {
+		if gzErr := s.gz.Close(); err == nil {
+			err = gzErr
+		}
+	}
+	if closeErr := s.f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,226 @@
+// Package problem writes error responses as RFC 7807 problem details, so
+// clients can tell errors apart by a machine-readable code the same way on
+// every endpoint.
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+	"gorm.io/gorm"
+)
+
+// ContentType is the media type of problem details.
+const ContentType = "application/problem+json"
+
+// Codes identify the kind of problem. Errors without a more specific code get
+// the one of their status, see CodeFor.
+const (
+	CodeInvalidRequest   = "request.invalid"
+	CodeTooLarge         = "request.too_large"
+	CodeUnsupportedMedia = "request.unsupported_media_type"
+	CodeRateLimited      = "request.rate_limited"
+	CodeUnauthorized     = "auth.unauthorized"
+	CodeForbidden        = "auth.forbidden"
+	CodeNotFound         = "resource.not_found"
+	CodeConflict         = "resource.conflict"
+	CodeGone             = "resource.gone"
+	CodeStale            = "resource.precondition_failed"
+	CodeIfMatchRequired  = "request.precondition_required"
+	CodeInternal         = "server.internal"
+	CodeUpstream         = "server.upstream"
+	CodeUnavailable      = "server.unavailable"
+	CodeNoStorage        = "server.insufficient_storage"
+
+	CodeTokenMissing       = "auth.token_missing"
+	CodeTokenInvalid       = "auth.token_invalid"
+	CodeTokenExpired       = "auth.token_expired"
+	CodeInvalidCredentials = "auth.invalid_credentials"
+	Code2FARequired        = "auth.2fa_required"
+	CodeMediaDuplicate     = "media.duplicate"
+	CodeMediaNameTaken     = "media.name_taken"
+	CodeMediaInvalidType   = "media.invalid_type"
+	CodeMediaTakenDown     = "media.taken_down"
+	CodeMediaNotApproved   = "media.not_approved"
+	CodeMediaRejected      = "media.rejected"
+)
+
+// CodeFor returns the code of problems with the given status and no more
+// specific code.
+func CodeFor(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeInvalidRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusGone:
+		return CodeGone
+	case http.StatusPreconditionFailed:
+		return CodeStale
+	case http.StatusPreconditionRequired:
+		return CodeIfMatchRequired
+	case http.StatusRequestEntityTooLarge:
+		return CodeTooLarge
+	case http.StatusUnsupportedMediaType:
+		return CodeUnsupportedMedia
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return CodeUpstream
+	case http.StatusServiceUnavailable:
+		return CodeUnavailable
+	case http.StatusInsufficientStorage:
+		return CodeNoStorage
+	}
+	if status >= 500 {
+		return CodeInternal
+	}
+	return CodeInvalidRequest
+}
+
+// Error is a problem a handler can return through the Gin context with
+// c.Error, to be written by Handler, or write itself with Abort.
+type Error struct {
+	Status int
+	Code   string
+	Detail string
+	// Details describes the cause, e.g. the message of the underlying error.
+	Details string
+	// Extensions are added to the body next to the standard members.
+	Extensions map[string]any
+}
+
+// New returns a problem with the given status, code and detail. An empty
+// code is replaced with the one of the status.
+func New(status int, code, detail string) *Error {
+	if code == "" {
+		code = CodeFor(status)
+	}
+	return &Error{Status: status, Code: code, Detail: detail}
+}
+
+func (e *Error) Error() string {
+	if e.Details != "" {
+		return e.Detail + ": " + e.Details
+	}
+	return e.Detail
+}
+
+// WithDetails returns a copy of the problem describing its cause.
+func (e *Error) WithDetails(details string) *Error {
+	copied := *e
+	copied.Details = details
+	return &copied
+}
+
+// With returns a copy of the problem with an extension member added.
+func (e *Error) With(key string, value any) *Error {
+	copied := *e
+	copied.Extensions = map[string]any{}
+	for k, v := range e.Extensions {
+		copied.Extensions[k] = v
+	}
+	copied.Extensions[key] = value
+	return &copied
+}
+
+// Details is the body of a problem response.
+type Details struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Code     string `json:"code"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// Error repeats Detail and Details the cause, for clients reading the
+	// {"error": ..., "details": ...} bodies the API used before.
+	Error      string         `json:"error"`
+	Details    string         `json:"details,omitempty"`
+	Extensions map[string]any `json:"-"`
+}
+
+// MarshalJSON adds the extension members to the standard ones.
+func (d Details) MarshalJSON() ([]byte, error) {
+	type details Details
+	body, err := json.Marshal(details(d))
+	if err != nil || len(d.Extensions) == 0 {
+		return body, err
+	}
+	members := map[string]any{}
+	for k, v := range d.Extensions {
+		members[k] = v
+	}
+	if err := json.Unmarshal(body, &members); err != nil {
+		return nil, err
+	}
+	return json.Marshal(members)
+}
+
+// Abort aborts the request with err as a problem. Errors other than *Error
+// are reported as internal errors without exposing their message.
+func Abort(c *gin.Context, err error) {
+	var p *Error
+	if !errors.As(err, &p) {
+		p = New(http.StatusInternalServerError, CodeInternal, "Internal server error")
+	}
+	c.Header("Content-Type", ContentType)
+	c.Render(p.Status, render.JSON{Data: Details{
+		Type:       "about:blank",
+		Title:      http.StatusText(p.Status),
+		Status:     p.Status,
+		Code:       p.Code,
+		Detail:     p.Detail,
+		Instance:   c.Request.URL.Path,
+		Error:      p.Detail,
+		Details:    p.Details,
+		Extensions: p.Extensions,
+	}})
+	c.Abort()
+}
+
+// Write aborts the request with a problem of the given status and the code
+// of the status.
+func Write(c *gin.Context, status int, detail string) {
+	Abort(c, New(status, "", detail))
+}
+
+// WriteDetails is Write with a description of the cause.
+func WriteDetails(c *gin.Context, status int, detail, details string) {
+	Abort(c, New(status, "", detail).WithDetails(details))
+}
+
+// NotFound aborts the request with a 404 problem.
+func NotFound(c *gin.Context, detail string) {
+	Write(c, http.StatusNotFound, detail)
+}
+
+// Lookup responds to a failed repository lookup: 404 with notFound if err is
+// gorm.ErrRecordNotFound, or 500 with failed otherwise.
+func Lookup(c *gin.Context, err error, notFound, failed string) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		NotFound(c, notFound)
+		return
+	}
+	Write(c, http.StatusInternalServerError, failed)
+}
+
+// Handler writes the last error a handler added with c.Error as a problem,
+// unless a response was written already.
+func Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if c.Writer.Written() || len(c.Errors) == 0 {
+			return
+		}
+		Abort(c, c.Errors.Last().Err)
+	}
+}
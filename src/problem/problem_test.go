@@ -0,0 +1,86 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestLookup(t *testing.T) {
+	for _, tc := range []struct {
+		err    error
+		status int
+		code   string
+		detail string
+	}{
+		{gorm.ErrRecordNotFound, http.StatusNotFound, CodeNotFound, "Image does not exist"},
+		{errors.New("database is locked"), http.StatusInternalServerError, CodeInternal, "Failed to look up image"},
+	} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/cdn/image/logo.png", nil)
+
+		Lookup(c, tc.err, "Image does not exist", "Failed to look up image")
+		require.True(t, c.IsAborted())
+		require.Equal(t, tc.status, w.Code)
+		require.Equal(t, ContentType, w.Header().Get("Content-Type"))
+
+		var body Details
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		require.Equal(t, Details{
+			Type:     "about:blank",
+			Title:    http.StatusText(tc.status),
+			Status:   tc.status,
+			Code:     tc.code,
+			Detail:   tc.detail,
+			Instance: "/api/cdn/image/logo.png",
+			Error:    tc.detail,
+		}, body)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	engine := gin.New()
+	engine.Use(Handler())
+	engine.GET("/duplicate", func(c *gin.Context) {
+		c.Error(New(http.StatusConflict, CodeMediaDuplicate, "File already exists").With("existing", "logo.png"))
+	})
+	engine.GET("/failed", func(c *gin.Context) {
+		c.Error(errors.New("disk full"))
+	})
+	engine.GET("/written", func(c *gin.Context) {
+		c.Error(errors.New("logged only"))
+		c.String(http.StatusOK, "ok")
+	})
+
+	request := func(path string) (*httptest.ResponseRecorder, map[string]any) {
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		body := map[string]any{}
+		json.Unmarshal(w.Body.Bytes(), &body)
+		return w, body
+	}
+
+	w, body := request("/duplicate")
+	require.Equal(t, http.StatusConflict, w.Code)
+	require.Equal(t, ContentType, w.Header().Get("Content-Type"))
+	require.Equal(t, CodeMediaDuplicate, body["code"])
+	require.Equal(t, "File already exists", body["detail"])
+	require.Equal(t, "logo.png", body["existing"])
+
+	// Other errors do not expose their message
+	w, body = request("/failed")
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+	require.Equal(t, CodeInternal, body["code"])
+	require.NotContains(t, w.Body.String(), "disk full")
+
+	w, _ = request("/written")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "ok", w.Body.String())
+}
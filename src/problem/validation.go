@@ -0,0 +1,112 @@
+package problem
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/kevinanielsen/go-fast-cdn/src/validations"
+)
+
+// CodeValidation is the code of requests with invalid fields, which are
+// listed in the "errors" member of the problem.
+const CodeValidation = "request.validation"
+
+// FieldError describes a field of a request that failed validation.
+type FieldError struct {
+	// Field is the path of the field in the request, e.g. "files[0].type".
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Invalid aborts the request with a 400 problem for a request that could
+// not be bound. Validation errors are listed by field, other errors, e.g.
+// malformed JSON, are described in "details". Bodies cut off by
+// http.MaxBytesReader get a 413 problem instead.
+func Invalid(c *gin.Context, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		Write(c, http.StatusRequestEntityTooLarge, "Request body is too large")
+		return
+	}
+	var errs validator.ValidationErrors
+	if !errors.As(err, &errs) {
+		WriteDetails(c, http.StatusBadRequest, "Invalid request format", err.Error())
+		return
+	}
+	fields := make([]FieldError, 0, len(errs))
+	for _, fe := range errs {
+		fields = append(fields, FieldError{Field: fieldPath(fe), Rule: fe.Tag(), Message: message(fe)})
+	}
+	InvalidFields(c, fields...)
+}
+
+// InvalidFields aborts the request with a 400 problem listing fields that
+// failed validation.
+func InvalidFields(c *gin.Context, fields ...FieldError) {
+	detail := "Invalid request"
+	if len(fields) > 0 {
+		detail = fields[0].Field + " " + fields[0].Message
+	}
+	Abort(c, New(http.StatusBadRequest, CodeValidation, detail).With("errors", fields))
+}
+
+// fieldPath returns the path of the field without the name of the bound
+// struct.
+func fieldPath(fe validator.FieldError) string {
+	if _, path, ok := strings.Cut(fe.Namespace(), "."); ok {
+		return path
+	}
+	return fe.Field()
+}
+
+func message(fe validator.FieldError) string {
+	param := fe.Param()
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "oneof":
+		return "must be one of " + strings.ReplaceAll(param, " ", ", ")
+	case "min", "gte":
+		return "must be at least " + param + unit(fe)
+	case "max", "lte":
+		return "must be at most " + param + unit(fe)
+	case "gt":
+		return "must be greater than " + param
+	case "nefield":
+		return "must be different from " + validations.RequestName(param)
+	case "required_with":
+		return "is required with " + validations.RequestName(param)
+	case "required_without":
+		return "is required without " + validations.RequestName(param)
+	case "excluded_with":
+		return "must not be set with " + validations.RequestName(param)
+	case "email":
+		return "must be a valid email address"
+	case "url", "http_url":
+		return "must be a valid URL"
+	case "filename":
+		return "must be a valid file name"
+	case "gravity":
+		return "must be a valid gravity"
+	case "origin":
+		return "must be * or an origin like https://example.com"
+	case "token":
+		return "must be a valid HTTP token"
+	}
+	return "failed the " + fe.Tag() + " rule"
+}
+
+// unit returns what the limit of a min or max rule counts.
+func unit(fe validator.FieldError) string {
+	switch fe.Kind().String() {
+	case "string":
+		return " characters long"
+	case "slice", "array", "map":
+		return " items"
+	}
+	return ""
+}
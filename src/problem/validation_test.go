@@ -0,0 +1,70 @@
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+type validationProblem struct {
+	Code   string       `json:"code"`
+	Detail string       `json:"detail"`
+	Errors []FieldError `json:"errors"`
+}
+
+func TestInvalid(t *testing.T) {
+	engine := gin.New()
+	engine.POST("/rename", func(c *gin.Context) {
+		var body struct {
+			Filename string   `json:"filename" binding:"required"`
+			NewName  string   `json:"newname" binding:"required,nefield=Filename,filename"`
+			Gravity  string   `json:"gravity" binding:"gravity"`
+			FocalX   *float64 `json:"focal_x" binding:"required_with=FocalY,omitempty,min=0,max=1"`
+			FocalY   *float64 `json:"focal_y" binding:"required_with=FocalX,omitempty,min=0,max=1"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			Invalid(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	request := func(body string) (*httptest.ResponseRecorder, validationProblem) {
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/rename", strings.NewReader(body)))
+		var p validationProblem
+		json.Unmarshal(w.Body.Bytes(), &p)
+		return w, p
+	}
+
+	w, _ := request(`{"filename": "a.png", "newname": "b.png", "gravity": "north", "focal_x": 0.5, "focal_y": 0.5}`)
+	require.Equal(t, http.StatusNoContent, w.Code)
+
+	w, p := request(`{"filename": "a.png", "newname": "a.png", "gravity": "up", "focal_x": 1.5}`)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Equal(t, CodeValidation, p.Code)
+	require.Equal(t, "newname must be different from filename", p.Detail)
+	require.Equal(t, []FieldError{
+		{Field: "newname", Rule: "nefield", Message: "must be different from filename"},
+		{Field: "gravity", Rule: "gravity", Message: "must be a valid gravity"},
+		{Field: "focal_x", Rule: "max", Message: "must be at most 1"},
+		{Field: "focal_y", Rule: "required_with", Message: "is required with focal_x"},
+	}, p.Errors)
+
+	_, p = request(`{"newname": "a.b.png"}`)
+	require.Equal(t, []FieldError{
+		{Field: "filename", Rule: "required", Message: "is required"},
+		{Field: "newname", Rule: "filename", Message: "must be a valid file name"},
+	}, p.Errors)
+
+	// Malformed bodies are not validation errors
+	w, p = request(`{"filename": `)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Equal(t, CodeInvalidRequest, p.Code)
+	require.Equal(t, "Invalid request format", p.Detail)
+}
@@ -0,0 +1,267 @@
+// Package queue runs slow work, such as extracting the text of uploaded
+// documents or posting webhooks, in the background so it doesn't hold up
+// requests. Jobs are stored in the jobs table, so they survive restarts, and
+// are run by a pool of workers. Failed jobs are retried with exponential
+// backoff until they run out of attempts, after which an admin can requeue
+// them.
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultWorkers     = 2
+	defaultMaxAttempts = 5
+	// pollInterval is how often idle workers look for jobs due for a retry
+	// or queued by another instance
+	pollInterval = 5 * time.Second
+	// retention is how long finished jobs are kept
+	retention = 7 * 24 * time.Hour
+
+	minBackoff = 10 * time.Second
+	maxBackoff = time.Hour
+)
+
+var ErrUnknownKind = errors.New("unknown job kind")
+
+// ErrNotFailed is returned when requeueing a job that has not failed.
+var ErrNotFailed = errors.New("job has not failed")
+
+// Handler runs a job with its JSON encoded payload.
+type Handler func(ctx context.Context, payload []byte) error
+
+var (
+	handlersMu sync.RWMutex
+	handlers   = map[string]Handler{}
+)
+
+// Register sets the handler of a kind of job. Kinds are registered before
+// the queue is started.
+func Register(kind string, handler Handler) {
+	handlersMu.Lock()
+	defer handlersMu.Unlock()
+	handlers[kind] = handler
+}
+
+func handlerOf(kind string) (Handler, bool) {
+	handlersMu.RLock()
+	defer handlersMu.RUnlock()
+	handler, ok := handlers[kind]
+	return handler, ok
+}
+
+// Queue runs the stored jobs with a pool of workers.
+type Queue struct {
+	repo        models.JobRepository
+	workers     int
+	maxAttempts int
+	wake        chan struct{}
+
+	mu     sync.Mutex
+	pruned time.Time
+}
+
+func New(repo models.JobRepository, workers int) *Queue {
+	return &Queue{repo: repo, workers: workers, maxAttempts: defaultMaxAttempts, wake: make(chan struct{}, 1)}
+}
+
+var active *Queue
+
+// Running reports whether the queue was started. Without it, e.g. in the
+// command line tools, callers do their work inline.
+func Running() bool {
+	return active != nil
+}
+
+// Start queues the jobs interrupted by the previous shutdown again and starts
+// QUEUE_WORKERS workers, 2 by default.
+func Start(repo models.JobRepository) error {
+	workers := defaultWorkers
+	if val := os.Getenv("QUEUE_WORKERS"); val != "" {
+		parsed, err := strconv.Atoi(val)
+		if err != nil || parsed <= 0 {
+			return fmt.Errorf("invalid QUEUE_WORKERS %q", val)
+		}
+		workers = parsed
+	}
+
+	q := New(repo, workers)
+	requeued, err := repo.RequeueRunningJobs(context.Background())
+	if err != nil {
+		return err
+	}
+	if requeued > 0 {
+		log.Printf("Requeued %d interrupted background jobs", requeued)
+	}
+	for i := 0; i < q.workers; i++ {
+		go q.work(context.Background())
+	}
+	active = q
+	return nil
+}
+
+// Enqueue stores a job for the started queue; see Queue.Enqueue.
+func Enqueue(ctx context.Context, kind string, payload any) error {
+	if active == nil {
+		return errors.New("the job queue is not running")
+	}
+	return active.Enqueue(ctx, kind, payload)
+}
+
+// Active returns the started queue, or nil.
+func Active() *Queue {
+	return active
+}
+
+// Enqueue stores a job running the handler of kind with payload, encoded as
+// JSON, and wakes a worker.
+func (q *Queue) Enqueue(ctx context.Context, kind string, payload any) error {
+	if _, ok := handlerOf(kind); !ok {
+		return fmt.Errorf("%w %q", ErrUnknownKind, kind)
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	job := &models.Job{
+		Kind:        kind,
+		Payload:     string(data),
+		Status:      models.JobStatusQueued,
+		MaxAttempts: q.maxAttempts,
+		RunAt:       time.Now(),
+	}
+	if err := q.repo.AddJob(ctx, job); err != nil {
+		return err
+	}
+	q.notify()
+	return nil
+}
+
+// Requeue gives a failed job a fresh set of attempts.
+func (q *Queue) Requeue(ctx context.Context, id uint) (*models.Job, error) {
+	job, err := q.repo.GetJob(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != models.JobStatusFailed {
+		return nil, ErrNotFailed
+	}
+	job.Status = models.JobStatusQueued
+	job.Attempts = 0
+	job.RunAt = time.Now()
+	job.FinishedAt = nil
+	if err := q.repo.UpdateJob(ctx, job); err != nil {
+		return nil, err
+	}
+	q.notify()
+	return job, nil
+}
+
+func (q *Queue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// work runs due jobs until ctx is done, waiting for new ones in between
+func (q *Queue) work(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		ran, err := q.RunNext(ctx)
+		if err != nil {
+			log.Printf("Failed to run background job: %s", err.Error())
+		}
+		if ran {
+			continue
+		}
+		q.prune(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunNext runs the next due job, if any, and reports whether there was one.
+func (q *Queue) RunNext(ctx context.Context) (bool, error) {
+	job, err := q.repo.ClaimJob(ctx, time.Now())
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	job.Attempts++
+	err = q.run(ctx, job)
+	now := time.Now()
+	switch {
+	case err == nil:
+		job.Status = models.JobStatusDone
+		job.LastError = ""
+		job.FinishedAt = &now
+	case job.Attempts >= job.MaxAttempts:
+		log.Printf("Background job %d (%s) failed for good: %s", job.ID, job.Kind, err.Error())
+		job.Status = models.JobStatusFailed
+		job.LastError = err.Error()
+		job.FinishedAt = &now
+	default:
+		job.Status = models.JobStatusQueued
+		job.LastError = err.Error()
+		job.RunAt = now.Add(Backoff(job.Attempts))
+	}
+	return true, q.repo.UpdateJob(ctx, job)
+}
+
+func (q *Queue) run(ctx context.Context, job *models.Job) (err error) {
+	handler, ok := handlerOf(job.Kind)
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknownKind, job.Kind)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return handler(ctx, []byte(job.Payload))
+}
+
+// prune deletes old finished jobs, at most once an hour
+func (q *Queue) prune(ctx context.Context) {
+	q.mu.Lock()
+	if time.Since(q.pruned) < time.Hour {
+		q.mu.Unlock()
+		return
+	}
+	q.pruned = time.Now()
+	q.mu.Unlock()
+
+	if err := q.repo.DeleteFinishedJobs(ctx, time.Now().Add(-retention)); err != nil {
+		log.Printf("Failed to delete finished background jobs: %s", err.Error())
+	}
+}
+
+// Backoff returns how long to wait before retrying a job that failed
+// attempts times: 10 seconds, doubling with every attempt, up to an hour.
+func Backoff(attempts int) time.Duration {
+	backoff := minBackoff
+	for i := 1; i < attempts && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, maxBackoff)
+}
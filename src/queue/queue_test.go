@@ -0,0 +1,126 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/stretchr/testify/require"
+)
+
+func newQueue(t *testing.T) (*Queue, models.JobRepository) {
+	t.Helper()
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	repo := database.NewJobRepo(database.DB)
+	return New(repo, 1), repo
+}
+
+func TestQueue_Run(t *testing.T) {
+	q, repo := newQueue(t)
+	ctx := context.Background()
+
+	var got []string
+	Register("test.echo", func(ctx context.Context, payload []byte) error {
+		var s string
+		if err := json.Unmarshal(payload, &s); err != nil {
+			return err
+		}
+		got = append(got, s)
+		return nil
+	})
+	require.NoError(t, q.Enqueue(ctx, "test.echo", "first"))
+	require.NoError(t, q.Enqueue(ctx, "test.echo", "second"))
+	require.ErrorIs(t, q.Enqueue(ctx, "test.unknown", nil), ErrUnknownKind)
+
+	for _, want := range []bool{true, true, false} {
+		ran, err := q.RunNext(ctx)
+		require.NoError(t, err)
+		require.Equal(t, want, ran)
+	}
+	require.Equal(t, []string{"first", "second"}, got)
+
+	jobs, err := repo.GetJobs(ctx, models.JobStatusDone, 10)
+	require.NoError(t, err)
+	require.Len(t, jobs, 2)
+	require.Equal(t, 1, jobs[0].Attempts)
+	require.NotNil(t, jobs[0].FinishedAt)
+}
+
+func TestQueue_Retry(t *testing.T) {
+	q, repo := newQueue(t)
+	q.maxAttempts = 2
+	ctx := context.Background()
+
+	calls := 0
+	Register("test.fail", func(ctx context.Context, payload []byte) error {
+		calls++
+		if calls == 2 {
+			panic("boom")
+		}
+		return errors.New("unavailable")
+	})
+	require.NoError(t, q.Enqueue(ctx, "test.fail", nil))
+
+	// The failed job waits for its backoff
+	ran, err := q.RunNext(ctx)
+	require.NoError(t, err)
+	require.True(t, ran)
+	ran, err = q.RunNext(ctx)
+	require.NoError(t, err)
+	require.False(t, ran)
+
+	jobs, err := repo.GetJobs(ctx, models.JobStatusQueued, 10)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	job := jobs[0]
+	require.Equal(t, "unavailable", job.LastError)
+	require.True(t, job.RunAt.After(time.Now()))
+
+	// Panics count as failures, and the last attempt fails the job
+	job.RunAt = time.Now()
+	require.NoError(t, repo.UpdateJob(ctx, &job))
+	ran, err = q.RunNext(ctx)
+	require.NoError(t, err)
+	require.True(t, ran)
+	failed, err := repo.GetJob(ctx, job.ID)
+	require.NoError(t, err)
+	require.Equal(t, models.JobStatusFailed, failed.Status)
+	require.Equal(t, "panic: boom", failed.LastError)
+
+	requeued, err := q.Requeue(ctx, job.ID)
+	require.NoError(t, err)
+	require.Equal(t, models.JobStatusQueued, requeued.Status)
+	require.Equal(t, 0, requeued.Attempts)
+	_, err = q.Requeue(ctx, job.ID)
+	require.ErrorIs(t, err, ErrNotFailed)
+}
+
+func TestJobRepo_ClaimJob(t *testing.T) {
+	_, repo := newQueue(t)
+	ctx := context.Background()
+
+	require.NoError(t, repo.AddJob(ctx, &models.Job{Kind: "test", Status: models.JobStatusQueued, RunAt: time.Now()}))
+	job, err := repo.ClaimJob(ctx, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, models.JobStatusRunning, job.Status)
+	_, err = repo.ClaimJob(ctx, time.Now())
+	require.Error(t, err)
+
+	// Jobs left running by a crash are queued again on start
+	requeued, err := repo.RequeueRunningJobs(ctx)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), requeued)
+}
+
+func TestBackoff(t *testing.T) {
+	require.Equal(t, 10*time.Second, Backoff(1))
+	require.Equal(t, 20*time.Second, Backoff(2))
+	require.Equal(t, 80*time.Second, Backoff(4))
+	require.Equal(t, time.Hour, Backoff(20))
+}
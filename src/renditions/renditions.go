@@ -0,0 +1,124 @@
+// Package renditions stores the files derived from media, e.g. the PDF
+// previews of documents, along with their models.Rendition records.
+package renditions
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"gorm.io/gorm"
+)
+
+// TouchInterval is how often the last access of a rendition is recorded,
+// so serving it does not write to the database on every request.
+const TouchInterval = time.Hour
+
+// Dir returns the folder storing rendition files.
+func Dir() string {
+	return filepath.Join(util.ExPath, "uploads", "renditions")
+}
+
+// URL returns the path rendition files are downloaded from.
+func URL(fileName string) string {
+	return "/api/cdn/download/renditions/" + url.PathEscape(fileName)
+}
+
+// CreateTemp creates a temporary file ending in ext in Dir to write a
+// rendition to before passing it to Save.
+func CreateTemp(ext string) (*os.File, error) {
+	if err := os.MkdirAll(Dir(), 0o755); err != nil {
+		return nil, err
+	}
+	return os.CreateTemp(Dir(), ".rendition-*"+ext)
+}
+
+// Save moves the file at tmpPath into Dir and stores r with its size. A
+// rendition of the same source, kind and variant keeps its file name and gets
+// its content replaced; new renditions get a random name ending in ext.
+func Save(ctx context.Context, repo models.RenditionRepository, r *models.Rendition, tmpPath, ext string) error {
+	existing, err := repo.GetRendition(ctx, r.SourceType, r.SourceID, r.Kind, r.Variant)
+	if err == nil {
+		r.FileName = existing.FileName
+	} else if errors.Is(err, gorm.ErrRecordNotFound) {
+		r.FileName = uuid.NewString() + ext
+	} else {
+		return err
+	}
+
+	info, err := os.Stat(tmpPath)
+	if err != nil {
+		return err
+	}
+	r.Size = info.Size()
+
+	path := filepath.Join(Dir(), r.FileName)
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+	if err := repo.SaveRendition(ctx, r); err != nil {
+		if existing.ID == 0 {
+			os.Remove(path)
+		}
+		return err
+	}
+	return nil
+}
+
+// Touch records that r was served, unless it was recorded within
+// TouchInterval.
+func Touch(ctx context.Context, repo models.RenditionRepository, r *models.Rendition) {
+	now := time.Now()
+	if r.LastAccessedAt != nil && now.Sub(*r.LastAccessedAt) < TouchInterval {
+		return
+	}
+	if err := repo.TouchRendition(ctx, r.ID, now); err != nil {
+		log.Printf("Failed to record access to rendition %s: %s\n", r.FileName, err.Error())
+		return
+	}
+	r.LastAccessedAt = &now
+}
+
+// TrackAccess records the downloads of rendition files, so renditions that
+// are no longer used can be cleaned up first, see janitor.Janitor. Files are
+// looked up at most once per TouchInterval.
+func TrackAccess(repo models.RenditionRepository) gin.HandlerFunc {
+	var mu sync.Mutex
+	touched := map[string]time.Time{}
+	return func(c *gin.Context) {
+		c.Next()
+		if c.Writer.Status() >= http.StatusBadRequest {
+			return
+		}
+		fileName := path.Base(c.Request.URL.Path)
+		now := time.Now()
+		mu.Lock()
+		if now.Sub(touched[fileName]) < TouchInterval {
+			mu.Unlock()
+			return
+		}
+		touched[fileName] = now
+		for name, at := range touched {
+			if now.Sub(at) >= TouchInterval {
+				delete(touched, name)
+			}
+		}
+		mu.Unlock()
+
+		rendition, err := repo.GetRenditionByFileName(c.Request.Context(), fileName)
+		if err == nil {
+			Touch(c.Request.Context(), repo, &rendition)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+// Package replication keeps a secondary instance in sync with a primary one
+// for geo-redundancy. The primary exposes a feed of changed image and
+// document records, ordered by when they changed, and their files; the
+// secondary pulls the feed periodically from the cursor it reached last time
+// and applies every change: new files are downloaded, renames, replaced
+// contents and deletions are repeated.
+package replication
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+)
+
+const (
+	DefaultPageSize = 500
+	MaxPageSize     = 1000
+)
+
+var ErrInvalidCursor = errors.New("invalid replication cursor")
+
+// Cursor is the position in the feed of a media type: the change time and ID
+// of the last record seen. The zero Cursor is the start of the feed.
+type Cursor struct {
+	ChangedAt time.Time
+	ID        uint
+}
+
+// String encodes the cursor as <unix nanoseconds>-<id>, or "" for the start.
+func (c Cursor) String() string {
+	if c.ChangedAt.IsZero() && c.ID == 0 {
+		return ""
+	}
+	return strconv.FormatInt(c.ChangedAt.UnixNano(), 10) + "-" + strconv.FormatUint(uint64(c.ID), 10)
+}
+
+// ParseCursor decodes a cursor from String.
+func ParseCursor(s string) (Cursor, error) {
+	if s == "" {
+		return Cursor{}, nil
+	}
+	nanos, id, ok := strings.Cut(s, "-")
+	if !ok {
+		return Cursor{}, ErrInvalidCursor
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	i, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	return Cursor{ChangedAt: time.Unix(0, n), ID: uint(i)}, nil
+}
+
+// Change is the state of a record in the feed.
+type Change struct {
+	UUID     string `json:"uuid"`
+	FileName string `json:"file_name"`
+	// Checksum is hex encoded.
+	Checksum          string     `json:"checksum"`
+	ChecksumAlgorithm string     `json:"checksum_algorithm"`
+	ExpiresAt         *time.Time `json:"expires_at"`
+	ChangedAt         time.Time  `json:"changed_at"`
+	Deleted           bool       `json:"deleted"`
+}
+
+// Page is a part of the feed of a media type.
+type Page struct {
+	Type    string   `json:"type"`
+	Changes []Change `json:"changes"`
+	// Cursor is where the next page starts.
+	Cursor string `json:"cursor"`
+	// More reports whether there may be further changes after Cursor.
+	More bool `json:"more"`
+}
+
+// Changes returns up to limit changes of mediaType after cursor.
+func Changes(ctx context.Context, repo models.ReplicationRepository, mediaType string, cursor Cursor, limit int) (Page, error) {
+	if models.MediaFolder(mediaType) == "" {
+		return Page{}, fmt.Errorf("unknown media type %q", mediaType)
+	}
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	limit = min(limit, MaxPageSize)
+
+	records, err := repo.GetChanges(ctx, mediaType, cursor.ChangedAt, cursor.ID, limit)
+	if err != nil {
+		return Page{}, err
+	}
+	page := Page{Type: mediaType, Changes: []Change{}, More: len(records) == limit}
+	for _, record := range records {
+		page.Changes = append(page.Changes, Change{
+			UUID:              record.UUID,
+			FileName:          record.FileName,
+			Checksum:          hex.EncodeToString(record.Checksum),
+			ChecksumAlgorithm: record.ChecksumAlgorithm,
+			ExpiresAt:         record.ExpiresAt,
+			ChangedAt:         record.ChangedAt,
+			Deleted:           record.Deleted,
+		})
+		cursor = Cursor{ChangedAt: record.ChangedAt, ID: record.ID}
+	}
+	page.Cursor = cursor.String()
+	return page, nil
+}
@@ -0,0 +1,178 @@
+package replication
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/stretchr/testify/require"
+)
+
+func setup(t *testing.T) {
+	t.Helper()
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	for _, folder := range []string{"images", "docs"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(util.ExPath, "uploads", folder), 0o755))
+	}
+}
+
+func TestCursor(t *testing.T) {
+	cursor, err := ParseCursor("")
+	require.NoError(t, err)
+	require.Equal(t, Cursor{}, cursor)
+	require.Equal(t, "", cursor.String())
+
+	cursor = Cursor{ChangedAt: time.Unix(0, 1700000000123456789), ID: 42}
+	parsed, err := ParseCursor(cursor.String())
+	require.NoError(t, err)
+	require.True(t, cursor.ChangedAt.Equal(parsed.ChangedAt))
+	require.Equal(t, cursor.ID, parsed.ID)
+
+	for _, invalid := range []string{"x", "1-", "-1", "1-x"} {
+		_, err := ParseCursor(invalid)
+		require.ErrorIs(t, err, ErrInvalidCursor, invalid)
+	}
+}
+
+func TestChanges(t *testing.T) {
+	setup(t)
+	ctx := context.Background()
+	images := database.NewImageRepo(database.DB)
+	repo := database.NewReplicationRepo(database.DB)
+
+	for _, name := range []string{"a.png", "b.png", "c.png"} {
+		_, err := images.AddImage(ctx, models.Image{FileName: name, Checksum: []byte(name)})
+		require.NoError(t, err)
+	}
+	_, err := images.DeleteImage(ctx, "a.png")
+	require.NoError(t, err)
+
+	// Paging one change at a time visits every record once, the deleted
+	// one last
+	var seen []Change
+	cursor := Cursor{}
+	for {
+		page, err := Changes(ctx, repo, models.MediaTypeImage, cursor, 1)
+		require.NoError(t, err)
+		seen = append(seen, page.Changes...)
+		cursor, err = ParseCursor(page.Cursor)
+		require.NoError(t, err)
+		if !page.More {
+			break
+		}
+	}
+	require.Len(t, seen, 3)
+	require.Equal(t, "b.png", seen[0].FileName)
+	require.Equal(t, "c.png", seen[1].FileName)
+	require.Equal(t, "a.png", seen[2].FileName)
+	require.True(t, seen[2].Deleted)
+	require.Equal(t, hex.EncodeToString([]byte("b.png")), seen[0].Checksum)
+
+	page, err := Changes(ctx, repo, models.MediaTypeImage, cursor, 10)
+	require.NoError(t, err)
+	require.Empty(t, page.Changes)
+	require.False(t, page.More)
+}
+
+// fakePrimary serves one page of image changes and the files
+func fakePrimary(t *testing.T, changes []Change, files map[string]string) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/replication/changes/", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "key", r.Header.Get("X-API-Key"))
+		page := Page{Changes: []Change{}}
+		if r.URL.Path == "/api/replication/changes/image" && r.URL.Query().Get("cursor") == "" {
+			page.Changes = changes
+			page.Cursor = "1-1"
+		}
+		json.NewEncoder(w).Encode(page)
+	})
+	mux.HandleFunc("/api/replication/files/image/", func(w http.ResponseWriter, r *http.Request) {
+		data, ok := files[filepath.Base(r.URL.Path)]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(data))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestSyncer_Sync(t *testing.T) {
+	setup(t)
+	ctx := context.Background()
+	images := database.NewImageRepo(database.DB)
+	config := database.NewConfigRepo(database.DB)
+
+	// Replicated earlier: one file renamed since, one replaced and one
+	// deleted on the primary
+	for name, uuid := range map[string]string{"old.png": "u-renamed", "replaced.png": "u-replaced", "deleted.png": "u-deleted"} {
+		_, err := images.AddImage(ctx, models.Image{UUID: uuid, FileName: name, Checksum: []byte("old")})
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(util.ExPath, "uploads", "images", name), []byte("old"), 0o644))
+	}
+	// Uploaded to the secondary directly
+	_, err := images.AddImage(ctx, models.Image{FileName: "local.png", Checksum: []byte("local")})
+	require.NoError(t, err)
+
+	checksum := hex.EncodeToString([]byte("old"))
+	server := fakePrimary(t, []Change{
+		{UUID: "u-new", FileName: "new.png", Checksum: hex.EncodeToString([]byte("new"))},
+		{UUID: "u-renamed", FileName: "renamed.png", Checksum: checksum},
+		{UUID: "u-replaced", FileName: "replaced.png", Checksum: hex.EncodeToString([]byte("replaced"))},
+		{UUID: "u-deleted", FileName: "deleted.png", Checksum: checksum, Deleted: true},
+		{UUID: "u-missing", FileName: "missing.png", Checksum: checksum},
+		{UUID: "u-clash", FileName: "local.png", Checksum: checksum},
+	}, map[string]string{"new.png": "new", "replaced.png": "replaced", "local.png": "clash"})
+
+	s := &Syncer{
+		Primary:  server.URL,
+		APIKey:   "key",
+		Client:   server.Client(),
+		Images:   images,
+		Docs:     database.NewDocRepo(database.DB),
+		Replicas: database.NewReplicationRepo(database.DB),
+		Search:   database.NewSearchRepo(database.DB),
+		Cursors:  config,
+	}
+	stats, err := s.Sync(ctx)
+	require.NoError(t, err)
+	require.Equal(t, Stats{Created: 1, Updated: 1, Renamed: 1, Deleted: 1, Failed: 2}, stats)
+
+	read := func(name string) string {
+		data, err := os.ReadFile(filepath.Join(util.ExPath, "uploads", "images", name))
+		require.NoError(t, err)
+		return string(data)
+	}
+	require.Equal(t, "new", read("new.png"))
+	require.Equal(t, "old", read("renamed.png"))
+	require.Equal(t, "replaced", read("replaced.png"))
+	require.NoFileExists(t, filepath.Join(util.ExPath, "uploads", "images", "deleted.png"))
+	image, err := images.GetImageByFileName(ctx, "new.png")
+	require.NoError(t, err)
+	require.Equal(t, "u-new", image.UUID)
+	image, err = images.GetImageByFileName(ctx, "replaced.png")
+	require.NoError(t, err)
+	require.Equal(t, []byte("replaced"), image.Checksum)
+
+	cursor, err := config.Get(cursorKeyPrefix + models.MediaTypeImage)
+	require.NoError(t, err)
+	require.Equal(t, "1-1", cursor)
+
+	// The next sync starts from the saved cursor
+	stats, err = s.Sync(ctx)
+	require.NoError(t, err)
+	require.Equal(t, Stats{}, stats)
+}
@@ -0,0 +1,410 @@
+package replication
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/cache"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/search"
+	"github.com/kevinanielsen/go-fast-cdn/src/usage"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"gorm.io/gorm"
+)
+
+const defaultInterval = 5 * time.Minute
+
+// cursorKeyPrefix prefixes the config keys the cursors are stored under
+const cursorKeyPrefix = "replication_cursor_"
+
+// Changes failing with these errors are skipped rather than retried forever.
+var (
+	errFileMissing = errors.New("the primary does not have the file")
+	errNameTaken   = errors.New("a different file with the same name exists")
+)
+
+// ActiveSyncer is the syncer started by Start, or nil when this instance is
+// not a secondary.
+var ActiveSyncer *Syncer
+
+// CursorStore persists the cursors, e.g. in the config table.
+type CursorStore interface {
+	Get(key string) (string, error)
+	Set(key, value string) error
+}
+
+// Stats counts the changes applied by a sync. Failed counts the skipped
+// changes, whose file the primary did not have or whose name was taken by a
+// file uploaded to the secondary.
+type Stats struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+	Renamed int `json:"renamed"`
+	Deleted int `json:"deleted"`
+	Failed  int `json:"failed"`
+}
+
+// Status is a snapshot of the syncer state exposed to admins.
+type Status struct {
+	Enabled   bool       `json:"enabled"`
+	Primary   string     `json:"primary,omitempty"`
+	Interval  int        `json:"interval_seconds,omitempty"`
+	Running   bool       `json:"running"`
+	LastRun   *time.Time `json:"last_run"`
+	LastError string     `json:"last_error,omitempty"`
+	LastStats Stats      `json:"last_stats"`
+	// Cursors maps the media types to the position reached in their feed.
+	Cursors map[string]string `json:"cursors,omitempty"`
+}
+
+// Syncer pulls the changes of a primary instance.
+type Syncer struct {
+	// Primary is the base URL of the primary, e.g. https://cdn.example.com.
+	Primary string
+	// APIKey belongs to a service account of the primary holding
+	// models.PermissionReplicationRead.
+	APIKey   string
+	Client   *http.Client
+	Interval time.Duration
+
+	Images   models.ImageRepository
+	Docs     models.DocRepository
+	Replicas models.ReplicationRepository
+	Search   models.SearchRepository
+	Cursors  CursorStore
+
+	mu     sync.Mutex
+	status Status
+}
+
+// Start makes this instance a secondary of the primary at
+// REPLICATION_PRIMARY_URL, authenticating with REPLICATION_API_KEY and
+// syncing every REPLICATION_INTERVAL seconds, five minutes by default.
+func Start(images models.ImageRepository, docs models.DocRepository, replicas models.ReplicationRepository, searchRepo models.SearchRepository, cursors CursorStore) error {
+	primary := strings.TrimRight(os.Getenv("REPLICATION_PRIMARY_URL"), "/")
+	if primary == "" {
+		return nil
+	}
+	if _, err := url.ParseRequestURI(primary); err != nil {
+		return fmt.Errorf("invalid REPLICATION_PRIMARY_URL: %w", err)
+	}
+	interval := defaultInterval
+	if val := os.Getenv("REPLICATION_INTERVAL"); val != "" {
+		parsed, err := strconv.Atoi(val)
+		if err != nil || parsed <= 0 {
+			return fmt.Errorf("invalid REPLICATION_INTERVAL %q", val)
+		}
+		interval = time.Duration(parsed) * time.Second
+	}
+
+	s := &Syncer{
+		Primary:  primary,
+		APIKey:   os.Getenv("REPLICATION_API_KEY"),
+		Client:   &http.Client{Timeout: 10 * time.Minute},
+		Interval: interval,
+		Images:   images,
+		Docs:     docs,
+		Replicas: replicas,
+		Search:   searchRepo,
+		Cursors:  cursors,
+	}
+	go func() {
+		s.Run()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.Run()
+		}
+	}()
+	ActiveSyncer = s
+	log.Printf("Replicating media from %s every %s", primary, interval)
+	return nil
+}
+
+// Run syncs and records the outcome in the status. It does nothing if a sync
+// is already running.
+func (s *Syncer) Run() {
+	s.mu.Lock()
+	if s.status.Running {
+		s.mu.Unlock()
+		return
+	}
+	s.status.Running = true
+	s.mu.Unlock()
+
+	stats, err := s.Sync(context.Background())
+
+	now := time.Now().UTC()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.Running = false
+	s.status.LastRun = &now
+	s.status.LastStats = stats
+	s.status.LastError = ""
+	if err != nil {
+		log.Printf("Replication failed: %s", err.Error())
+		s.status.LastError = err.Error()
+	}
+}
+
+// Status returns the current syncer state.
+func (s *Syncer) Status() Status {
+	s.mu.Lock()
+	status := s.status
+	s.mu.Unlock()
+
+	status.Enabled = true
+	status.Primary = s.Primary
+	status.Interval = int(s.Interval / time.Second)
+	status.Cursors = map[string]string{}
+	for _, mediaType := range []string{models.MediaTypeImage, models.MediaTypeDoc} {
+		status.Cursors[mediaType], _ = s.Cursors.Get(cursorKeyPrefix + mediaType)
+	}
+	return status
+}
+
+// Sync applies the changes of the primary since the last sync. The cursors
+// are saved after every page, so a failed sync resumes where it stopped.
+func (s *Syncer) Sync(ctx context.Context) (Stats, error) {
+	var stats Stats
+	for _, mediaType := range []string{models.MediaTypeImage, models.MediaTypeDoc} {
+		cursor, err := s.Cursors.Get(cursorKeyPrefix + mediaType)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return stats, err
+		}
+		for {
+			page, err := s.fetchPage(ctx, mediaType, cursor)
+			if err != nil {
+				return stats, err
+			}
+			for _, change := range page.Changes {
+				if err := s.apply(ctx, mediaType, change, &stats); errors.Is(err, errFileMissing) || errors.Is(err, errNameTaken) {
+					log.Printf("Skipping replication of %s/%s: %s", models.MediaFolder(mediaType), change.FileName, err.Error())
+					stats.Failed++
+				} else if err != nil {
+					return stats, fmt.Errorf("failed to replicate %s/%s: %w", models.MediaFolder(mediaType), change.FileName, err)
+				}
+			}
+			if page.Cursor != cursor {
+				cursor = page.Cursor
+				if err := s.Cursors.Set(cursorKeyPrefix+mediaType, cursor); err != nil {
+					return stats, err
+				}
+			}
+			if !page.More {
+				break
+			}
+		}
+	}
+	return stats, nil
+}
+
+func (s *Syncer) get(ctx context.Context, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.Primary+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-API-Key", s.APIKey)
+	return s.Client.Do(req)
+}
+
+func (s *Syncer) fetchPage(ctx context.Context, mediaType, cursor string) (Page, error) {
+	resp, err := s.get(ctx, "/api/replication/changes/"+mediaType+"?cursor="+url.QueryEscape(cursor))
+	if err != nil {
+		return Page{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Page{}, fmt.Errorf("primary answered %s", resp.Status)
+	}
+
+	var page Page
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return Page{}, fmt.Errorf("invalid page from primary: %w", err)
+	}
+	return page, nil
+}
+
+// apply repeats a change of the primary. Records are matched by UUID, which
+// survives renames.
+func (s *Syncer) apply(ctx context.Context, mediaType string, change Change, stats *Stats) error {
+	checksum, err := hex.DecodeString(change.Checksum)
+	if err != nil {
+		return fmt.Errorf("invalid checksum %q", change.Checksum)
+	}
+	algorithm := change.ChecksumAlgorithm
+	if algorithm == "" {
+		algorithm = models.ChecksumMD5
+	}
+	fileName, err := util.FilterFilename(change.FileName)
+	if err != nil {
+		return err
+	}
+	local, err := s.Replicas.GetMediaByUUID(ctx, mediaType, change.UUID)
+	notFound := errors.Is(err, gorm.ErrRecordNotFound)
+	if err != nil && !notFound {
+		return err
+	}
+
+	switch {
+	case change.Deleted:
+		if notFound {
+			return nil
+		}
+		if err := s.delete(ctx, mediaType, local.FileName); err != nil {
+			return err
+		}
+		stats.Deleted++
+	case notFound:
+		if err := s.checkName(ctx, mediaType, fileName); err != nil {
+			return err
+		}
+		if err := s.download(ctx, mediaType, change.FileName, fileName); err != nil {
+			return err
+		}
+		if mediaType == models.MediaTypeImage {
+			_, err = s.Images.AddImage(ctx, models.Image{UUID: change.UUID, FileName: fileName, Checksum: checksum, ChecksumAlgorithm: algorithm, ExpiresAt: change.ExpiresAt})
+		} else {
+			_, err = s.Docs.AddDoc(ctx, models.Doc{UUID: change.UUID, FileName: fileName, Checksum: checksum, ChecksumAlgorithm: algorithm, ExpiresAt: change.ExpiresAt})
+		}
+		if err != nil {
+			return err
+		}
+		s.indexDoc(ctx, mediaType, fileName)
+		stats.Created++
+	default:
+		if local.FileName != fileName {
+			if err := s.checkName(ctx, mediaType, fileName); err != nil {
+				return err
+			}
+			if err := s.rename(ctx, mediaType, local.FileName, fileName); err != nil {
+				return err
+			}
+			stats.Renamed++
+		}
+		if !bytes.Equal(local.Checksum, checksum) || local.ChecksumAlgorithm != algorithm {
+			if err := s.download(ctx, mediaType, change.FileName, fileName); err != nil {
+				return err
+			}
+			if mediaType == models.MediaTypeImage {
+				err = s.Images.UpdateImageChecksum(ctx, fileName, algorithm, checksum)
+			} else {
+				err = s.Docs.UpdateDocChecksum(ctx, fileName, algorithm, checksum)
+			}
+			if err != nil {
+				return err
+			}
+			s.indexDoc(ctx, mediaType, fileName)
+			stats.Updated++
+		}
+	}
+	return nil
+}
+
+// checkName returns errNameTaken if there is a record named fileName
+func (s *Syncer) checkName(ctx context.Context, mediaType, fileName string) error {
+	var err error
+	if mediaType == models.MediaTypeImage {
+		_, err = s.Images.GetImageByFileName(ctx, fileName)
+	} else {
+		_, err = s.Docs.GetDocByFileName(ctx, fileName)
+	}
+	if err == nil {
+		return errNameTaken
+	} else if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	return err
+}
+
+// download copies the file named remoteName on the primary to fileName in
+// the uploads folder, replacing the file there if any
+func (s *Syncer) download(ctx context.Context, mediaType, remoteName, fileName string) error {
+	resp, err := s.get(ctx, "/api/replication/files/"+mediaType+"/"+url.PathEscape(remoteName))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return errFileMissing
+	} else if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("primary answered %s", resp.Status)
+	}
+
+	dest := filepath.Join(util.ExPath, "uploads", models.MediaFolder(mediaType), fileName)
+	err = usage.Track(mediaType, nil, fileName, func() error {
+		tmp, err := os.CreateTemp(filepath.Dir(dest), ".replica-*")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name())
+		if _, err := io.Copy(tmp, resp.Body); err != nil {
+			tmp.Close()
+			return err
+		}
+		if err := tmp.Close(); err != nil {
+			return err
+		}
+		return os.Rename(tmp.Name(), dest)
+	})
+	if err != nil {
+		return err
+	}
+	cache.Invalidate(mediaType, fileName)
+	return nil
+}
+
+func (s *Syncer) rename(ctx context.Context, mediaType, oldName, newName string) error {
+	if err := util.RenameFile(oldName, newName, models.MediaFolder(mediaType)); err != nil {
+		return err
+	}
+	cache.Invalidate(mediaType, oldName)
+	cache.Invalidate(mediaType, newName)
+	if mediaType == models.MediaTypeImage {
+		return s.Images.RenameImage(ctx, oldName, newName)
+	}
+	return s.Docs.RenameDoc(ctx, oldName, newName)
+}
+
+func (s *Syncer) delete(ctx context.Context, mediaType, fileName string) error {
+	var err error
+	if mediaType == models.MediaTypeImage {
+		_, err = s.Images.DeleteImage(ctx, fileName)
+	} else {
+		_, err = s.Docs.DeleteDoc(ctx, fileName)
+	}
+	if err != nil {
+		return err
+	}
+	cache.Invalidate(mediaType, fileName)
+	err = usage.Track(mediaType, nil, fileName, func() error {
+		return util.DeleteFile(fileName, models.MediaFolder(mediaType))
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *Syncer) indexDoc(ctx context.Context, mediaType, fileName string) {
+	if mediaType != models.MediaTypeDoc {
+		return
+	}
+	if err := search.IndexDoc(ctx, s.Search, fileName); err != nil {
+		log.Printf("Failed to index document %s: %s", fileName, err.Error())
+	}
+}
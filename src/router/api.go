@@ -2,61 +2,143 @@ package router
 
 import (
 	"net/http"
+	"os"
 
 	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/acl"
+	"github.com/kevinanielsen/go-fast-cdn/src/backup"
+	"github.com/kevinanielsen/go-fast-cdn/src/branding"
+	"github.com/kevinanielsen/go-fast-cdn/src/cache"
+	"github.com/kevinanielsen/go-fast-cdn/src/compliance"
 	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/dav"
+	"github.com/kevinanielsen/go-fast-cdn/src/diskspace"
+	"github.com/kevinanielsen/go-fast-cdn/src/events"
+	"github.com/kevinanielsen/go-fast-cdn/src/fallback"
 	"github.com/kevinanielsen/go-fast-cdn/src/handlers"
 	authHandlers "github.com/kevinanielsen/go-fast-cdn/src/handlers/auth"
 	dbHandlers "github.com/kevinanielsen/go-fast-cdn/src/handlers/db"
 	dHandlers "github.com/kevinanielsen/go-fast-cdn/src/handlers/docs"
 	iHandlers "github.com/kevinanielsen/go-fast-cdn/src/handlers/image"
+	mHandlers "github.com/kevinanielsen/go-fast-cdn/src/handlers/media"
+	"github.com/kevinanielsen/go-fast-cdn/src/importer"
+	"github.com/kevinanielsen/go-fast-cdn/src/integrity"
+	"github.com/kevinanielsen/go-fast-cdn/src/metrics"
 	"github.com/kevinanielsen/go-fast-cdn/src/middleware"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/queue"
+	"github.com/kevinanielsen/go-fast-cdn/src/renditions"
+	"github.com/kevinanielsen/go-fast-cdn/src/replication"
+	"github.com/kevinanielsen/go-fast-cdn/src/settings"
 	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/kevinanielsen/go-fast-cdn/src/watermark"
 )
 
 func (s *Server) AddApiRoutes() {
-	api := s.Engine.Group("/api")
+	api := s.Engine.Group("/api", middleware.CSRF())
 	api.GET("/", func(c *gin.Context) {
 		c.JSON(http.StatusOK, "pong")
 	})
+	api.GET("/ui", handlers.GetUIInfo)
 
 	// Authentication routes (public)
 	authHandler := authHandlers.NewAuthHandler(database.NewUserRepo(database.DB))
-	auth := api.Group("/auth")
+	authBodyLimit := middleware.BodyLimit(settings.MaxAuthBodySize)
+	auth := api.Group("/auth", authBodyLimit)
 	{
-		auth.POST("/register", authHandler.Register)
-		auth.POST("/login", authHandler.Login)
+		authRateLimit := middleware.AuthRateLimit()
+		auth.POST("/register", authRateLimit, authHandler.Register)
+		auth.POST("/login", authRateLimit, authHandler.Login)
 		auth.POST("/refresh", authHandler.RefreshToken)
 		auth.POST("/logout", authHandler.Logout)
 	}
 
+	brandingStore := branding.NewStore(database.NewConfigRepo(database.DB))
+
 	// Initialize auth middleware
 	authMiddleware := middleware.NewAuthMiddleware()
 
 	// Protected auth routes
-	authProtected := api.Group("/auth")
-	authProtected.Use(authMiddleware.RequireAuth())
+	authProtected := api.Group("/auth", authBodyLimit)
+	authProtected.Use(authMiddleware.RequireAuth(), authMiddleware.RequireUser())
 	{
 		authProtected.GET("/profile", authHandler.GetProfile)
 		authProtected.PUT("/change-password", authHandler.ChangePassword)
 		authProtected.PUT("/change-email", authHandler.ChangeEmail)
 		authProtected.POST("/2fa", authHandler.Setup2FA)
 		authProtected.POST("/2fa/verify", authHandler.Verify2FA)
+		authProtected.GET("/sessions", authHandler.ListSessions)
+		authProtected.DELETE("/sessions/:id", authHandler.RevokeSession)
+		authProtected.GET("/2fa/backup-codes", authHandler.GetBackupCodes)
+		authProtected.POST("/2fa/backup-codes", authHandler.RegenerateBackupCodes)
 	}
+	// Service accounts may sign URLs too
+	api.POST("/auth/signed-urls", authBodyLimit, authMiddleware.RequireAuth(), authHandler.CreateSignedURL)
 
 	cdn := api.Group("/cdn")
-	docHandler := dHandlers.NewDocHandler(database.NewDocRepo(database.DB))
-	imageHandler := iHandlers.NewImageHandler(database.NewImageRepo(database.DB))
+	docHandler := dHandlers.NewDocHandler(database.NewDocRepo(database.DB), database.NewMediaRelationRepo(database.DB), database.NewSearchRepo(database.DB), database.NewMediaAliasRepo(database.DB))
+	imageHandler := iHandlers.NewImageHandler(database.NewImageRepo(database.DB), database.NewMediaRelationRepo(database.DB), database.NewRenditionRepo(database.DB), database.NewMediaAliasRepo(database.DB))
+	transformPresetRepo := database.NewTransformPresetRepo(database.DB)
+	transformHandler := iHandlers.NewTransformHandler(transformPresetRepo, database.NewImageRepo(database.DB))
+	mediaHandler := mHandlers.NewMediaHandler(
+		database.NewImageRepo(database.DB),
+		database.NewDocRepo(database.DB),
+		database.NewMediaRelationRepo(database.DB),
+		database.NewRenditionRepo(database.DB),
+	)
+	takedownRepo := database.NewTakedownRepo(database.DB)
+	takedownHandler := mHandlers.NewTakedownHandler(
+		database.NewImageRepo(database.DB),
+		database.NewDocRepo(database.DB),
+		takedownRepo,
+	)
+	imageTombstone := middleware.Tombstone(takedownRepo, models.MediaTypeImage)
+	docTombstone := middleware.Tombstone(takedownRepo, models.MediaTypeDoc)
+	tripwireRepo := database.NewTripwireRepo(database.DB)
+	tripwires := middleware.NewTripwireMonitor(tripwireRepo)
+	imageTripwire := tripwires.Watch(models.MediaTypeImage)
+	docTripwire := tripwires.Watch(models.MediaTypeDoc)
+	delivery := metrics.NewDelivery(metrics.SampleRateFromEnv())
+	hotlinks := middleware.NewHotlink(database.NewConfigRepo(database.DB))
+	watermarks := watermark.New(database.NewConfigRepo(database.DB), database.NewImageRepo(database.DB))
+	watermark.Default = watermarks
+	imageHeaders := middleware.DownloadHeaders(database.NewImageRepo(database.DB), database.NewDocRepo(database.DB), models.MediaTypeImage)
+	docHeaders := middleware.DownloadHeaders(database.NewImageRepo(database.DB), database.NewDocRepo(database.DB), models.MediaTypeDoc)
+	aliasRepo := database.NewMediaAliasRepo(database.DB)
+	imageAliases := middleware.Aliases(aliasRepo, database.NewImageRepo(database.DB), database.NewDocRepo(database.DB), models.MediaTypeImage)
+	docAliases := middleware.Aliases(aliasRepo, database.NewImageRepo(database.DB), database.NewDocRepo(database.DB), models.MediaTypeDoc)
+	optionalAuth := authMiddleware.OptionalAuth()
+	imageModeration := middleware.Moderation(database.NewImageRepo(database.DB), database.NewDocRepo(database.DB), models.MediaTypeImage)
+	docModeration := middleware.Moderation(database.NewImageRepo(database.DB), database.NewDocRepo(database.DB), models.MediaTypeDoc)
+	imagePolicy := middleware.Policy(database.NewImageRepo(database.DB), database.NewDocRepo(database.DB), models.MediaTypeImage)
+	docPolicy := middleware.Policy(database.NewImageRepo(database.DB), database.NewDocRepo(database.DB), models.MediaTypeDoc)
+	fallbacks := fallback.New(database.NewImageRepo(database.DB), database.NewDocRepo(database.DB), database.NewRepairTaskRepo(database.DB))
+	groupRepo := database.NewGroupRepo(database.DB)
+	acl.Default = acl.New(groupRepo)
+	imagesReadable := acl.Require("images", models.AccessRead)
+	docsReadable := acl.Require("docs", models.AccessRead)
+	imagesWritable := acl.Require("images", models.AccessWrite)
+	docsWritable := acl.Require("docs", models.AccessWrite)
 
 	// Public CDN routes (read-only)
 	{
 		cdn.GET("/size", handlers.GetSizeHandler)
-		cdn.GET("/doc/all", docHandler.HandleAllDocs)
-		cdn.GET("/doc/:filename", dHandlers.HandleDocMetadata)
-		cdn.GET("/image/all", imageHandler.HandleAllImages)
-		cdn.GET("/image/:filename", iHandlers.HandleImageMetadata)
-		cdn.Static("/download/images", util.ExPath+"/uploads/images")
-		cdn.Static("/download/docs", util.ExPath+"/uploads/docs")
+		cdn.GET("/doc/all", optionalAuth, docsReadable, docHandler.HandleAllDocs)
+		cdn.GET("/doc/:filename", docTripwire, docTombstone, optionalAuth, docsReadable, docHandler.HandleDocMetadata)
+		cdn.GET("/image/all", optionalAuth, imagesReadable, imageHandler.HandleAllImages)
+		cdn.GET("/folders/:id/tree", optionalAuth, mediaHandler.HandleFolderTree)
+		cdn.GET("/folders/:id/children", optionalAuth, mediaHandler.HandleFolderChildren)
+		cdn.GET("/image/:filename", imageTripwire, imageTombstone, optionalAuth, imagesReadable, imageHandler.HandleImageMetadata)
+		cdn.GET("/media/:filename/related", optionalAuth, mediaHandler.HandleMediaRelated)
+		// The wildcard shares its name with the related routes as the router
+		// requires; it holds the UUID or file name of the media.
+		cdn.GET("/media/:filename/renditions", optionalAuth, mediaHandler.HandleMediaRenditions)
+		cdn.GET("/integrity/:type", optionalAuth, mediaHandler.HandleIntegrityManifest)
+		cdn.GET("/search", optionalAuth, mHandlers.NewSearchHandler(database.NewSearchRepo(database.DB)).HandleSearch)
+		cdn.GET("/transform/:preset/:filename", delivery.Middleware(), imageTripwire, imageTombstone, optionalAuth, imageModeration, imagePolicy, hotlinks.Middleware(models.MediaTypeImage), transformHandler.HandleImageTransform)
+		cdn.Group("/download/images", delivery.Middleware(), imageTripwire, imageTombstone, imageAliases, optionalAuth, imageModeration, imagePolicy, hotlinks.Middleware(models.MediaTypeImage), metrics.CountDownloads(models.MediaTypeImage), imageHeaders, watermarks.Middleware(), transformHandler.ClientHints(), imageHandler.NegotiateFormat(), cache.Middleware(models.MediaTypeImage), fallbacks.Middleware(models.MediaTypeImage)).Static("/", util.ExPath+"/uploads/images")
+		cdn.Group("/download/docs", delivery.Middleware(), docTripwire, docTombstone, docAliases, optionalAuth, docModeration, docPolicy, hotlinks.Middleware(models.MediaTypeDoc), metrics.CountDownloads(models.MediaTypeDoc), docHeaders, cache.Middleware(models.MediaTypeDoc), fallbacks.Middleware(models.MediaTypeDoc)).Static("/", util.ExPath+"/uploads/docs")
+		cdn.Group("/download/renditions", delivery.Middleware(), renditions.TrackAccess(database.NewRenditionRepo(database.DB)), watermarks.Renditions(database.NewRenditionRepo(database.DB))).Static("/", util.ExPath+"/uploads/renditions")
 		cdn.GET("/dashboard", handlers.NewDashboardHandler(
 			database.NewDocRepo(database.DB),
 			database.NewImageRepo(database.DB),
@@ -69,28 +151,162 @@ func (s *Server) AddApiRoutes() {
 	cdnProtected := cdn.Group("/")
 	cdnProtected.Use(authMiddleware.RequireAuth())
 
-	upload := cdnProtected.Group("upload")
+	presetRepo := database.NewPresetRepo(database.DB)
+	presetHandler := handlers.NewPresetHandler(presetRepo, transformPresetRepo)
+	cdnProtected.GET("/presets", authMiddleware.RequirePermission(models.PermissionPresetsRead), presetHandler.ListPresets)
+
+	uploadBodyLimit := middleware.BodyLimit(settings.MaxUploadBodySize)
+	diskSpace := diskspace.Default.Middleware()
+	uploadSlots := middleware.UploadConcurrency()
+	directUploadHandler := mHandlers.NewDirectUploadHandler(
+		database.NewImageRepo(database.DB),
+		database.NewDocRepo(database.DB),
+		database.NewDirectUploadRepo(database.DB),
+		database.NewRepairTaskRepo(database.DB),
+	)
+	upload := cdnProtected.Group("upload", uploadBodyLimit, authMiddleware.RequirePermission(models.PermissionMediaUpload), uploadSlots, diskSpace)
+	{
+		upload.POST("/image", imagesWritable, middleware.UploadPreset(presetRepo, transformPresetRepo, models.MediaTypeImage), middleware.UploadExpiry(), imageHandler.HandleImageUpload)
+		upload.POST("/paste", imagesWritable, middleware.UploadPresetOrDefault(presetRepo, transformPresetRepo, models.MediaTypeImage, os.Getenv("PASTE_UPLOAD_PRESET")), middleware.UploadExpiry(), imageHandler.HandlePasteUpload)
+		upload.POST("/doc", docsWritable, middleware.UploadPreset(presetRepo, transformPresetRepo, models.MediaTypeDoc), middleware.UploadExpiry(), docHandler.HandleDocUpload)
+		upload.POST("/presign", directUploadHandler.HandlePresignUpload)
+		upload.POST("/presign/:id/confirm", directUploadHandler.HandleConfirmUpload)
+	}
+
+	delete := cdnProtected.Group("delete", authMiddleware.RequirePermission(models.PermissionMediaDelete))
+	{
+		delete.DELETE("/image/:filename", acl.Require("images", models.AccessAdmin), imageHandler.HandleImageDelete)
+		delete.DELETE("/doc/:filename", acl.Require("docs", models.AccessAdmin), docHandler.HandleDocDelete)
+	}
+
+	rename := cdnProtected.Group("rename", authMiddleware.RequirePermission(models.PermissionMediaRename))
+	{
+		rename.PUT("/image", imagesWritable, imageHandler.HandleImageRename)
+		rename.PUT("/doc", docsWritable, docHandler.HandleDocsRename)
+	}
+
+	media := cdnProtected.Group("media", authMiddleware.RequirePermission(models.PermissionMediaRelations))
+	{
+		media.POST("/:filename/related", mediaHandler.HandleAddMediaRelation)
+		media.DELETE("/:filename/related/:id", mediaHandler.HandleDeleteMediaRelation)
+	}
+	cdnProtected.PUT("/media/:filename/disposition", authMiddleware.RequirePermission(models.PermissionMediaRename), mediaHandler.HandleMediaDisposition)
+	cdnProtected.PATCH("/media/:filename", authMiddleware.RequirePermission(models.PermissionMediaRename), mediaHandler.HandleUpdateMediaMetadata)
+	cdnProtected.GET("/media/export", mediaHandler.HandleExportMedia)
+
+	transferHandler := mHandlers.NewTransferHandler(
+		database.NewImageRepo(database.DB),
+		database.NewDocRepo(database.DB),
+		database.NewMediaTransferRepo(database.DB),
+		database.NewOrganizationRepo(database.DB),
+		database.NewSearchRepo(database.DB),
+	)
+	cdnProtected.POST("/media/:filename/move", authMiddleware.RequirePermission(models.PermissionMediaRename), transferHandler.HandleMoveMedia)
+	// Copies take up space like uploads
+	cdnProtected.POST("/media/:filename/copy", authMiddleware.RequirePermission(models.PermissionMediaUpload), diskSpace, transferHandler.HandleCopyMedia)
+
+	commentHandler := mHandlers.NewCommentHandler(database.NewImageRepo(database.DB), database.NewDocRepo(database.DB), database.NewMediaCommentRepo(database.DB))
+	comments := cdnProtected.Group("media/:filename/comments", authMiddleware.RequireUser())
+	{
+		comments.GET("", commentHandler.HandleListComments)
+		comments.POST("", commentHandler.HandleAddComment)
+		comments.PATCH("/:id", commentHandler.HandleUpdateComment)
+		comments.DELETE("/:id", commentHandler.HandleDeleteComment)
+	}
+
+	shareHandler := mHandlers.NewShareHandler(
+		database.NewImageRepo(database.DB),
+		database.NewDocRepo(database.DB),
+		database.NewShareLinkRepo(database.DB),
+		takedownRepo,
+		tripwires,
+		brandingStore,
+	)
+	// Share links may be password protected, so they are limited like logins
+	shares := s.Engine.Group("/s/:token", middleware.ShareRateLimit())
+	{
+		shares.GET("", shareHandler.HandleShareLink)
+		shares.POST("", shareHandler.HandleUnlockShareLink)
+		shares.GET("/info", shareHandler.HandleShareLinkInfo)
+	}
+
+	// Galleries publish folders as JSON for static sites, without logging in
+	galleryHandler := handlers.NewGalleryHandler(database.NewGalleryRepo(database.DB), database.NewImageRepo(database.DB), database.NewDocRepo(database.DB))
+	s.Engine.GET("/public/galleries/:slug", galleryHandler.HandlePublicGallery)
+	cdnProtected.POST("/archive", mediaHandler.HandleArchive)
+	share := cdnProtected.Group("share", authMiddleware.RequirePermission(models.PermissionMediaShare))
 	{
-		upload.POST("/image", imageHandler.HandleImageUpload)
-		upload.POST("/doc", docHandler.HandleDocUpload)
+		share.GET("", shareHandler.HandleListShareLinks)
+		share.POST("", shareHandler.HandleCreateShareLink)
+		share.DELETE("/:id", shareHandler.HandleDeleteShareLink)
 	}
 
-	delete := cdnProtected.Group("delete")
+	resize := cdnProtected.Group("resize", authMiddleware.RequirePermission(models.PermissionMediaResize))
 	{
-		delete.DELETE("/image/:filename", imageHandler.HandleImageDelete)
-		delete.DELETE("/doc/:filename", docHandler.HandleDocDelete)
+		resize.PUT("/image", imagesWritable, imageHandler.HandleImageResize)
+		resize.PUT("/image/focal-point", imagesWritable, imageHandler.HandleImageFocalPoint)
 	}
 
-	rename := cdnProtected.Group("rename")
+	// Users whose groups were granted admin access to a folder manage its
+	// permissions along with admins
+	groupHandler := handlers.NewGroupHandler(groupRepo, database.NewUserRepo(database.DB))
+	permissions := cdnProtected.Group("folders/:id/permissions", authMiddleware.RequireUser())
 	{
-		rename.PUT("/image", imageHandler.HandleImageRename)
-		rename.PUT("/doc", docHandler.HandleDocsRename)
+		permissions.GET("", groupHandler.ListFolderPermissions)
+		permissions.PUT("/:group_id", groupHandler.SetFolderPermission)
+		permissions.DELETE("/:group_id", groupHandler.DeleteFolderPermission)
 	}
 
-	resize := cdnProtected.Group("resize")
+	// WebDAV clients mount the media folders as a network drive
+	davHandler := handlers.NewDAVHandler(dav.NewFileSystem(database.NewImageRepo(database.DB), database.NewDocRepo(database.DB), database.NewSearchRepo(database.DB)))
+	davRoutes := s.Engine.Group(handlers.DAVPrefix, uploadBodyLimit, davHandler.Challenge, authMiddleware.RequireAuth())
+	davPermissions := map[string]string{
+		"PUT":    models.PermissionMediaUpload,
+		"COPY":   models.PermissionMediaUpload,
+		"LOCK":   models.PermissionMediaUpload,
+		"UNLOCK": models.PermissionMediaUpload,
+		"MOVE":   models.PermissionMediaRename,
+		"DELETE": models.PermissionMediaDelete,
+	}
+	for _, method := range []string{"OPTIONS", "GET", "HEAD", "PROPFIND", "PROPPATCH", "MKCOL", "PUT", "COPY", "MOVE", "DELETE", "LOCK", "UNLOCK"} {
+		chain := []gin.HandlerFunc{davHandler.ServeDAV}
+		if method == "PUT" || method == "COPY" {
+			chain = append([]gin.HandlerFunc{diskSpace}, chain...)
+		}
+		if method == "PUT" {
+			chain = append([]gin.HandlerFunc{uploadSlots}, chain...)
+		}
+		if permission, ok := davPermissions[method]; ok {
+			chain = append([]gin.HandlerFunc{authMiddleware.RequirePermission(permission)}, chain...)
+		}
+		davRoutes.Handle(method, "", chain...)
+		davRoutes.Handle(method, "/*path", chain...)
+	}
+	graphqlHandler := handlers.NewGraphQLHandler(
+		database.NewImageRepo(database.DB),
+		database.NewDocRepo(database.DB),
+		database.NewMediaRelationRepo(database.DB),
+		database.NewUserRepo(database.DB),
+		database.NewOrganizationRepo(database.DB),
+	)
+	api.POST("/graphql", authMiddleware.RequireAuth(), graphqlHandler.Query)
+
+	// Compliance exports are downloaded with signed links, without logging in
+	exportHandler := handlers.NewExportHandler(compliance.NewDefaultExporter())
+	api.GET("/exports/:id/download", exportHandler.DownloadExport)
+
+	// Secondary instances pull the changes of this one with an API key
+	replicationHandler := handlers.NewReplicationHandler(database.NewReplicationRepo(database.DB), replication.ActiveSyncer)
+	replicationRoutes := api.Group("/replication", authMiddleware.RequireAuth(), authMiddleware.RequireGlobalPermission(models.PermissionReplicationRead))
 	{
-		resize.PUT("/image", iHandlers.HandleImageResize)
+		replicationRoutes.GET("/changes/:type", replicationHandler.GetChanges)
+		replicationRoutes.GET("/files/:type/:filename", replicationHandler.GetFile)
 	}
+
+	// The activity feed is registered outside the admin group so browsers
+	// can pass their token in the query before it is checked
+	api.GET("/admin/events", middleware.WebSocketToken(), authMiddleware.RequireAuth(), authMiddleware.RequireAdmin(), handlers.NewEventsHandler(events.Default).StreamEvents)
+
 	// Admin-only routes
 	adminRoutes := api.Group("/admin")
 	adminRoutes.Use(authMiddleware.RequireAuth(), authMiddleware.RequireAdmin())
@@ -105,13 +321,152 @@ func (s *Server) AddApiRoutes() {
 			adminRoutes.DELETE("/users/:id", adminUserHandler.DeleteUser)
 		}
 
+		orgRepo := database.NewOrganizationRepo(database.DB)
+		orgHandler := handlers.NewOrganizationHandler(orgRepo, brandingStore)
+		adminRoutes.GET("/orgs", orgHandler.ListOrganizations)
+		adminRoutes.POST("/orgs", orgHandler.CreateOrganization)
+		adminRoutes.DELETE("/orgs/:id", orgHandler.DeleteOrganization)
+
+		adminRoutes.GET("/groups", groupHandler.ListGroups)
+		adminRoutes.POST("/groups", groupHandler.CreateGroup)
+		adminRoutes.DELETE("/groups/:id", groupHandler.DeleteGroup)
+		adminRoutes.GET("/groups/:id/members", groupHandler.ListGroupMembers)
+		adminRoutes.PUT("/groups/:id/members/:user_id", groupHandler.AddGroupMember)
+		adminRoutes.DELETE("/groups/:id/members/:user_id", groupHandler.RemoveGroupMember)
+
+		brandingHandler := handlers.NewBrandingHandler(brandingStore, orgRepo)
+		adminRoutes.GET("/branding", brandingHandler.GetBranding)
+		adminRoutes.PUT("/branding", brandingHandler.UpdateBranding)
+		adminRoutes.GET("/branding/preview", brandingHandler.PreviewBranding)
+		adminRoutes.GET("/orgs/:id/branding", brandingHandler.GetBranding)
+		adminRoutes.PUT("/orgs/:id/branding", brandingHandler.UpdateBranding)
+		adminRoutes.DELETE("/orgs/:id/branding", brandingHandler.DeleteBranding)
+		adminRoutes.GET("/orgs/:id/branding/preview", brandingHandler.PreviewBranding)
+
+		serviceAccountHandler := authHandlers.NewServiceAccountHandler(database.NewServiceAccountRepo(database.DB), orgRepo)
+		{
+			adminRoutes.GET("/service-accounts", serviceAccountHandler.ListServiceAccounts)
+			adminRoutes.POST("/service-accounts", serviceAccountHandler.CreateServiceAccount)
+			adminRoutes.PUT("/service-accounts/:id", serviceAccountHandler.UpdateServiceAccount)
+			adminRoutes.DELETE("/service-accounts/:id", serviceAccountHandler.DeleteServiceAccount)
+			adminRoutes.GET("/service-accounts/:id/keys", serviceAccountHandler.ListAPIKeys)
+			adminRoutes.POST("/service-accounts/:id/keys", serviceAccountHandler.CreateAPIKey)
+			adminRoutes.DELETE("/service-accounts/:id/keys/:keyId", serviceAccountHandler.DeleteAPIKey)
+		}
+
 		// Config endpoints (admin only)
-		configHandler := handlers.NewConfigHandler(database.NewConfigRepo(database.DB))
+		configHandler := handlers.NewConfigHandler(settings.Default)
+		adminRoutes.GET("/config", configHandler.GetConfig)
+		adminRoutes.PATCH("/config", configHandler.UpdateConfig)
 		adminRoutes.GET("/config/registration", configHandler.GetRegistrationEnabled)
 		adminRoutes.POST("/config/registration", configHandler.SetRegistrationEnabled)
+		if s.CORS != nil {
+			corsHandler := handlers.NewCORSHandler(s.CORS)
+			adminRoutes.GET("/config/cors", corsHandler.GetCORSPolicy)
+			adminRoutes.PUT("/config/cors", corsHandler.UpdateCORSPolicy)
+		}
+		hotlinkHandler := handlers.NewHotlinkHandler(hotlinks)
+		adminRoutes.GET("/config/hotlink", hotlinkHandler.GetHotlinkPolicy)
+		adminRoutes.PUT("/config/hotlink", hotlinkHandler.UpdateHotlinkPolicy)
+		watermarkHandler := handlers.NewWatermarkHandler(watermarks)
+		adminRoutes.GET("/watermark", watermarkHandler.GetWatermark)
+		adminRoutes.PUT("/watermark", watermarkHandler.UpdateWatermark)
+		adminRoutes.PUT("/watermark/image", watermarkHandler.UploadWatermarkImage)
+		adminRoutes.DELETE("/watermark/image", watermarkHandler.DeleteWatermarkImage)
+
+		mimeTypeHandler := handlers.NewMimeTypeHandler(database.NewMimeTypeRuleRepo(database.DB))
+		adminRoutes.GET("/mime-types", mimeTypeHandler.ListMimeTypes)
+		adminRoutes.PUT("/mime-types/:extension", mimeTypeHandler.UpdateMimeType)
+		adminRoutes.DELETE("/mime-types/:extension", mimeTypeHandler.DeleteMimeType)
+
+		adminRoutes.GET("/shares", shareHandler.HandleListActiveShareLinks)
+		adminRoutes.DELETE("/shares/:id", shareHandler.HandleDeleteShareLink)
+
+		adminRoutes.GET("/galleries", galleryHandler.ListGalleries)
+		adminRoutes.POST("/galleries", galleryHandler.CreateGallery)
+		adminRoutes.PUT("/galleries/:slug", galleryHandler.UpdateGallery)
+		adminRoutes.DELETE("/galleries/:slug", galleryHandler.DeleteGallery)
+
+		duplicateHandler := handlers.NewDuplicateHandler(database.NewImageRepo(database.DB))
+		adminRoutes.GET("/duplicates", duplicateHandler.ListDuplicates)
+
+		lifecycleRuleHandler := handlers.NewLifecycleRuleHandler(database.NewLifecycleRuleRepo(database.DB))
+		adminRoutes.GET("/lifecycle-rules", lifecycleRuleHandler.ListLifecycleRules)
+		adminRoutes.POST("/lifecycle-rules", lifecycleRuleHandler.CreateLifecycleRule)
+		adminRoutes.PUT("/lifecycle-rules/:name", lifecycleRuleHandler.UpdateLifecycleRule)
+		adminRoutes.DELETE("/lifecycle-rules/:name", lifecycleRuleHandler.DeleteLifecycleRule)
+
+		adminRoutes.GET("/presets", presetHandler.ListPresets)
+		adminRoutes.POST("/presets", presetHandler.CreatePreset)
+		adminRoutes.PUT("/presets/:name", presetHandler.UpdatePreset)
+		adminRoutes.DELETE("/presets/:name", presetHandler.DeletePreset)
+
+		adminRoutes.GET("/transforms", transformHandler.HandleListTransformPresets)
+		adminRoutes.POST("/transforms", transformHandler.HandleCreateTransformPreset)
+		adminRoutes.PUT("/transforms/:name", transformHandler.HandleUpdateTransformPreset)
+		adminRoutes.DELETE("/transforms/:name", transformHandler.HandleDeleteTransformPreset)
+		adminRoutes.GET("/transforms/:name/sign", transformHandler.HandleSignTransformURL)
+
+		backupHandler := handlers.NewBackupHandler(backup.NewDefaultManager(), backup.ActiveScheduler)
+		adminRoutes.GET("/backups", backupHandler.ListBackups)
+		adminRoutes.POST("/backups", backupHandler.CreateBackup)
+		adminRoutes.GET("/backups/status", backupHandler.GetBackupStatus)
+		adminRoutes.POST("/backups/:name/verify", backupHandler.VerifyBackup)
+		adminRoutes.POST("/backups/:name/restore-media", backupHandler.RestoreMedia)
+		adminRoutes.DELETE("/backups/:name", backupHandler.DeleteBackup)
+
+		adminRoutes.GET("/exports", exportHandler.ListExports)
+		adminRoutes.POST("/exports", exportHandler.CreateExport)
+		adminRoutes.GET("/exports/:id", exportHandler.GetExport)
+		adminRoutes.POST("/exports/:id/link", exportHandler.CreateExportLink)
+		adminRoutes.DELETE("/exports/:id", exportHandler.DeleteExport)
+
+		importHandler := handlers.NewImportHandler(importer.NewDefaultJobs(), orgRepo)
+		adminRoutes.GET("/imports", importHandler.ListImports)
+		adminRoutes.POST("/imports", importHandler.CreateImport)
+		adminRoutes.GET("/imports/:id", importHandler.GetImport)
+
+		adminRoutes.GET("/replication", replicationHandler.GetReplicationStatus)
+		adminRoutes.POST("/replication/sync", replicationHandler.SyncReplication)
+
+		integrityHandler := handlers.NewIntegrityHandler(integrity.ActiveChecker)
+		adminRoutes.GET("/integrity", integrityHandler.GetIntegrityStatus)
+		adminRoutes.GET("/integrity/issues", integrityHandler.ListIntegrityIssues)
+		adminRoutes.POST("/integrity/run", integrityHandler.RunIntegrityCheck)
+
+		jobHandler := handlers.NewJobHandler(database.NewJobRepo(database.DB), queue.Active())
+		adminRoutes.GET("/jobs", jobHandler.ListJobs)
+		adminRoutes.GET("/jobs/:id", jobHandler.GetJob)
+		adminRoutes.POST("/jobs/:id/requeue", jobHandler.RequeueJob)
+
+		repairHandler := handlers.NewRepairHandler(fallbacks, database.NewRepairTaskRepo(database.DB))
+		adminRoutes.GET("/repairs", repairHandler.ListRepairs)
+		adminRoutes.POST("/repairs/run", repairHandler.RunRepairs)
+
+		adminRoutes.GET("/media/pending", mediaHandler.HandleListPendingMedia)
+		adminRoutes.POST("/media/:id/approve", mediaHandler.HandleApproveMedia)
+		adminRoutes.POST("/media/:id/reject", mediaHandler.HandleRejectMedia)
+
+		adminRoutes.GET("/takedowns", takedownHandler.HandleListTakedowns)
+		adminRoutes.POST("/takedowns/:filename", takedownHandler.HandleTakedown)
+		adminRoutes.DELETE("/takedowns/:id", takedownHandler.HandleLiftTakedown)
+
+		tripwireHandler := handlers.NewTripwireHandler(tripwireRepo)
+		adminRoutes.GET("/tripwires", tripwireHandler.ListTripwires)
+		adminRoutes.POST("/tripwires", tripwireHandler.CreateTripwire)
+		adminRoutes.DELETE("/tripwires/:id", tripwireHandler.DeleteTripwire)
+
+		auditHandler := handlers.NewAuditHandler(database.NewAuditLogRepo(database.DB))
+		adminRoutes.GET("/audit", auditHandler.GetAuditLogs)
+		adminRoutes.GET("/audit/export", auditHandler.ExportAuditLogs)
+
+		adminRoutes.GET("/metrics", handlers.NewMetricsHandler(delivery).GetMetrics)
+		adminRoutes.GET("/downloads/top", handlers.NewDownloadStatsHandler(metrics.ActiveDownloads).GetTopDownloads)
+		adminRoutes.GET("/usage", handlers.GetUsage)
 	}
 
 	// Public config endpoint for registration status
-	configHandler := handlers.NewConfigHandler(database.NewConfigRepo(database.DB))
+	configHandler := handlers.NewConfigHandler(settings.Default)
 	api.GET("/config/registration", configHandler.GetRegistrationEnabled)
+	api.GET("/branding", handlers.NewBrandingHandler(brandingStore, database.NewOrganizationRepo(database.DB)).GetEffectiveBranding)
 }
@@ -0,0 +1,148 @@
+package router
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// publicPrefixes are the paths served on the public listener when the admin
+// API and UI have a listener of their own.
+var publicPrefixes = []string{
+	"/api/cdn/download/",
+	"/api/cdn/transform/",
+	"/s/",
+	"/public/galleries/",
+}
+
+// managementPrefix is the path of the routes served on the management
+// listener when there is one: the admin API, including metrics.
+const managementPrefix = "/api/admin/"
+
+// ListenAddrsFromEnv returns the address of the public listener, PUBLIC_ADDR
+// or :PORT, and of the admin listener, ADMIN_ADDR, which is empty when the
+// admin API and UI share the public listener.
+func ListenAddrsFromEnv() (public, admin string) {
+	public = os.Getenv("PUBLIC_ADDR")
+	if public == "" {
+		public = ":" + os.Getenv("PORT")
+	}
+	return public, os.Getenv("ADMIN_ADDR")
+}
+
+// ManagementAddrFromEnv returns the address of the management listener,
+// MANAGEMENT_ADDR, which is empty when the admin API is served with the
+// rest of the API.
+func ManagementAddrFromEnv() string {
+	return os.Getenv("MANAGEMENT_ADDR")
+}
+
+// WithAdminAddr serves the admin API and UI on a separate listener at addr,
+// e.g. 127.0.0.1:8081, leaving only the download routes on the public one.
+func WithAdminAddr(addr string) func(*Server) {
+	return func(s *Server) {
+		s.AdminAddr = addr
+	}
+}
+
+// WithManagementAddr serves the admin API, including metrics, on a separate
+// listener at addr, e.g. 127.0.0.1:9090, and nowhere else.
+func WithManagementAddr(addr string) func(*Server) {
+	return func(s *Server) {
+		s.ManagementAddr = addr
+	}
+}
+
+// isPublicPath reports whether path is served on the public listener.
+func isPublicPath(path string) bool {
+	for _, prefix := range publicPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	// Compliance export bundles are downloaded with signed links
+	rest, ok := strings.CutPrefix(path, "/api/exports/")
+	return ok && strings.Count(rest, "/") == 1 && strings.HasSuffix(rest, "/download")
+}
+
+// publicOnly answers 404 to every request next doesn't serve on the public
+// listener.
+func publicOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isPublicPath(r.URL.Path) {
+			http.NotFound(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isManagementPath reports whether path is served on the management
+// listener.
+func isManagementPath(path string) bool {
+	return strings.HasPrefix(path, managementPrefix) || path == strings.TrimSuffix(managementPrefix, "/")
+}
+
+// managementOnly answers 404 to every request next doesn't serve on the
+// management listener.
+func managementOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isManagementPath(r.URL.Path) {
+			http.NotFound(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// withoutManagement answers 404 to the requests next serves on the
+// management listener.
+func withoutManagement(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isManagementPath(r.URL.Path) {
+			http.NotFound(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// engine returns the engine without the routes of the management listener,
+// if there is one.
+func (s *Server) engine() http.Handler {
+	if s.ManagementAddr == "" {
+		return s.Engine
+	}
+	return withoutManagement(s.Engine)
+}
+
+// handler returns the handler of the public listener.
+func (s *Server) handler() http.Handler {
+	if s.AdminAddr == "" {
+		return s.engine()
+	}
+	return publicOnly(s.Engine)
+}
+
+// runAdmin serves the whole engine over plain HTTP on the admin listener.
+// It is meant for a private interface; TLS only applies to the public
+// listener.
+func (s *Server) runAdmin() {
+	server := &http.Server{Addr: s.AdminAddr, Handler: s.engine(), ReadHeaderTimeout: 10 * time.Second}
+	log.Printf("Serving the admin API and UI on %s", s.AdminAddr)
+	if err := server.ListenAndServe(); err != nil {
+		log.Fatalf("Failed to serve the admin listener: %s", err.Error())
+	}
+}
+
+// runManagement serves the admin API over plain HTTP on the management
+// listener. Like the admin listener, it is meant for a private interface.
+func (s *Server) runManagement() {
+	server := &http.Server{Addr: s.ManagementAddr, Handler: managementOnly(s.Engine), ReadHeaderTimeout: 10 * time.Second}
+	log.Printf("Serving the management API on %s", s.ManagementAddr)
+	if err := server.ListenAndServe(); err != nil {
+		log.Fatalf("Failed to serve the management listener: %s", err.Error())
+	}
+}
@@ -0,0 +1,76 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublicOnly(t *testing.T) {
+	handler := publicOnly(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/api/cdn/download/images/logo.png", http.StatusNoContent},
+		{"/api/cdn/transform/thumb/logo.png", http.StatusNoContent},
+		{"/s/abc123", http.StatusNoContent},
+		{"/public/galleries/team", http.StatusNoContent},
+		{"/api/exports/42/download", http.StatusNoContent},
+		{"/api/exports/42", http.StatusNotFound},
+		{"/api/admin/users", http.StatusNotFound},
+		{"/api/auth/login", http.StatusNotFound},
+		{"/api/cdn/upload/image", http.StatusNotFound},
+		{"/", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			require.Equal(t, tt.want, w.Code)
+		})
+	}
+}
+
+func TestListenAddrsFromEnv(t *testing.T) {
+	t.Setenv("PORT", "8080")
+	t.Setenv("PUBLIC_ADDR", "")
+	t.Setenv("ADMIN_ADDR", "")
+	public, admin := ListenAddrsFromEnv()
+	require.Equal(t, ":8080", public)
+	require.Empty(t, admin)
+
+	t.Setenv("PUBLIC_ADDR", "0.0.0.0:80")
+	t.Setenv("ADMIN_ADDR", "127.0.0.1:8081")
+	public, admin = ListenAddrsFromEnv()
+	require.Equal(t, "0.0.0.0:80", public)
+	require.Equal(t, "127.0.0.1:8081", admin)
+}
+
+func TestManagementListener(t *testing.T) {
+	s := &Server{Engine: gin.New(), ManagementAddr: "127.0.0.1:9090"}
+	for _, path := range []string{"/api/admin/metrics", "/api/cdn/size"} {
+		s.Engine.GET(path, func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	}
+	get := func(handler http.Handler, path string) int {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code
+	}
+
+	require.Equal(t, http.StatusNotFound, get(s.handler(), "/api/admin/metrics"))
+	require.Equal(t, http.StatusNoContent, get(s.handler(), "/api/cdn/size"))
+	require.Equal(t, http.StatusNoContent, get(managementOnly(s.Engine), "/api/admin/metrics"))
+	require.Equal(t, http.StatusNotFound, get(managementOnly(s.Engine), "/api/cdn/size"))
+
+	// The admin listener leaves the admin API to the management listener too
+	s.AdminAddr = "127.0.0.1:8081"
+	require.Equal(t, http.StatusNotFound, get(s.engine(), "/api/admin/metrics"))
+	require.Equal(t, http.StatusNoContent, get(s.engine(), "/api/cdn/size"))
+}
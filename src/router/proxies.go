@@ -0,0 +1,41 @@
+package router
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/auth"
+)
+
+// TrustedProxiesFromEnv reads TRUSTED_PROXIES, a comma separated list of the
+// IP addresses and CIDR ranges of the reverse proxies in front of the server.
+// Only requests from them may set the client IP with X-Forwarded-For or
+// X-Real-IP; for everyone else it is the address of the connection.
+func TrustedProxiesFromEnv() ([]string, error) {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			return nil, fmt.Errorf("TRUSTED_PROXIES contains %q, which is neither an IP address nor a CIDR range", proxy)
+		}
+		proxies = append(proxies, proxy)
+	}
+	return proxies, nil
+}
+
+// WithTrustedProxies trusts the forwarding headers of requests from proxies,
+// IP addresses or CIDR ranges. The client IP used by rate limits, audit logs
+// and tripwires is then the last address in X-Forwarded-For not belonging to
+// a trusted proxy, and their X-Forwarded-Proto marks auth cookies Secure.
+func WithTrustedProxies(proxies []string) func(*Server) {
+	return func(s *Server) {
+		// The proxies are validated by TrustedProxiesFromEnv
+		_ = s.Engine.SetTrustedProxies(proxies)
+		_ = auth.SetTrustedProxies(proxies)
+	}
+}
@@ -0,0 +1,68 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/auth"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrustedProxiesFromEnv(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "")
+	proxies, err := TrustedProxiesFromEnv()
+	require.NoError(t, err)
+	require.Empty(t, proxies)
+
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8, 192.0.2.1")
+	proxies, err = TrustedProxiesFromEnv()
+	require.NoError(t, err)
+	require.Equal(t, []string{"10.0.0.0/8", "192.0.2.1"}, proxies)
+
+	t.Setenv("TRUSTED_PROXIES", "proxy.internal")
+	_, err = TrustedProxiesFromEnv()
+	require.Error(t, err)
+}
+
+func TestWithTrustedProxies(t *testing.T) {
+	clientIP := func(s *Server, remoteAddr string) string {
+		s.Engine.GET("/ip", func(c *gin.Context) { c.String(http.StatusOK, c.ClientIP()) })
+		r := httptest.NewRequest(http.MethodGet, "/ip", nil)
+		r.RemoteAddr = remoteAddr
+		r.Header.Set("X-Forwarded-For", "198.51.100.9, 203.0.113.7, 10.0.0.2")
+		w := httptest.NewRecorder()
+		s.Engine.ServeHTTP(w, r)
+		return w.Body.String()
+	}
+
+	// Forwarding headers are ignored by default
+	require.Equal(t, "10.0.0.1", clientIP(NewServer(), "10.0.0.1:1234"))
+
+	// The first address from the right that isn't a trusted proxy wins,
+	// so clients can't spoof theirs by sending X-Forwarded-For
+	require.Equal(t, "203.0.113.7", clientIP(NewServer(WithTrustedProxies([]string{"10.0.0.0/8"})), "10.0.0.1:1234"))
+	require.Equal(t, "192.0.2.5", clientIP(NewServer(WithTrustedProxies([]string{"10.0.0.0/8"})), "192.0.2.5:1234"))
+}
+
+func TestWithTrustedProxies_HTTPS(t *testing.T) {
+	isHTTPS := func(s *Server, remoteAddr string) string {
+		s.Engine.GET("/https", func(c *gin.Context) { c.String(http.StatusOK, strconv.FormatBool(auth.IsHTTPS(c))) })
+		r := httptest.NewRequest(http.MethodGet, "/https", nil)
+		r.RemoteAddr = remoteAddr
+		r.Header.Set("X-Forwarded-Proto", "https")
+		w := httptest.NewRecorder()
+		s.Engine.ServeHTTP(w, r)
+		return w.Body.String()
+	}
+	t.Cleanup(func() { _ = auth.SetTrustedProxies(nil) })
+
+	// Only trusted proxies may tell the request was sent over HTTPS
+	s := NewServer(WithTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1"}))
+	require.Equal(t, "true", isHTTPS(s, "10.0.0.1:1234"))
+	require.Equal(t, "false", isHTTPS(NewServer(WithTrustedProxies([]string{"192.0.2.1"})), "203.0.113.7:1234"))
+	require.Equal(t, "true", isHTTPS(NewServer(WithTrustedProxies([]string{"192.0.2.1"})), "192.0.2.1:1234"))
+	require.Equal(t, "false", isHTTPS(NewServer(WithTrustedProxies(nil)), "10.0.0.1:1234"))
+}
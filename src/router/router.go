@@ -1,8 +1,10 @@
 package router
 
 import (
-	"os"
+	"log"
 
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/events"
 	"github.com/kevinanielsen/go-fast-cdn/src/middleware"
 	"github.com/kevinanielsen/go-fast-cdn/ui"
 )
@@ -10,11 +12,30 @@ import (
 // Router initializes the router and sets up middleware, routes, etc.
 // It returns a *gin.Engine instance configured with the routes, middleware, etc.
 func Router() {
-	port := ":" + os.Getenv("PORT")
+	port, adminAddr := ListenAddrsFromEnv()
+
+	tlsConfig, err := TLSConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid TLS configuration: %s", err.Error())
+	}
+	socketConfig, err := SocketConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid socket configuration: %s", err.Error())
+	}
+	trustedProxies, err := TrustedProxiesFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid trusted proxies: %s", err.Error())
+	}
 
 	s := NewServer(
 		WithPort(port),
-		WithMiddleware(middleware.CORSMiddleware()),
+		WithAdminAddr(adminAddr),
+		WithManagementAddr(ManagementAddrFromEnv()),
+		WithTrustedProxies(trustedProxies),
+		WithCORS(middleware.NewCORS(database.NewConfigRepo(database.DB))),
+		WithTLS(tlsConfig),
+		WithSocket(socketConfig),
+		WithMiddleware(events.Errors()),
 	)
 
 	// Add all the API routes
@@ -25,3 +46,19 @@ func Router() {
 
 	s.Run()
 }
+
+// ReadOnlyRouter serves the API and UI on port like Router, but rejects every
+// request that could modify data apart from logging in and GraphQL queries,
+// which only read. It is used to inspect restored backups.
+func ReadOnlyRouter(port string) {
+	s := NewServer(
+		WithPort(":"+port),
+		WithCORS(middleware.NewCORS(database.NewConfigRepo(database.DB))),
+		WithMiddleware(middleware.ReadOnly("/api/auth/login", "/api/auth/refresh", "/api/auth/logout", "/api/graphql")),
+	)
+
+	s.AddApiRoutes()
+	ui.AddRoutes(s.Engine)
+
+	s.Run()
+}
@@ -1,10 +1,27 @@
 package router
 
-import "github.com/gin-gonic/gin"
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/middleware"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+)
 
 type Server struct {
 	Engine *gin.Engine
 	Port   string
+	// AdminAddr is the address of the listener for the admin API and UI,
+	// empty if they are served on Port.
+	AdminAddr string
+	// ManagementAddr is the address of the listener for the admin API
+	// alone, empty if it is served with the rest of the API.
+	ManagementAddr string
+	CORS           *middleware.CORS
+	TLS            *TLSConfig
+	Socket         *SocketConfig
 }
 
 func NewServer(options ...func(s *Server)) *Server {
@@ -12,6 +29,10 @@ func NewServer(options ...func(s *Server)) *Server {
 		Engine: gin.Default(),
 		Port:   ":8080",
 	}
+	// Unlike gin's default, no proxy may set the client IP unless configured
+	// with WithTrustedProxies
+	s.Engine.SetTrustedProxies(nil)
+	s.Engine.Use(problem.Handler())
 
 	for _, option := range options {
 		option(s)
@@ -32,6 +53,33 @@ func WithMiddleware(middleware gin.HandlerFunc) func(*Server) {
 	}
 }
 
+// WithCORS applies the CORS policy of cors and lets admins update it through
+// the API.
+func WithCORS(cors *middleware.CORS) func(*Server) {
+	return func(s *Server) {
+		s.CORS = cors
+		s.Engine.Use(cors.Middleware())
+	}
+}
+
 func (s *Server) Run() {
-	s.Engine.Run(s.Port)
+	if s.AdminAddr != "" {
+		go s.runAdmin()
+	}
+	if s.ManagementAddr != "" {
+		go s.runManagement()
+	}
+	if s.Socket != nil {
+		go s.runSocket()
+	}
+	if s.TLS != nil {
+		s.runTLS()
+		return
+	}
+
+	server := &http.Server{Addr: s.Port, Handler: s.handler(), ReadHeaderTimeout: 10 * time.Second}
+	log.Printf("Serving HTTP on %s", s.Port)
+	if err := server.ListenAndServe(); err != nil {
+		log.Fatalf("Failed to serve HTTP: %s", err.Error())
+	}
 }
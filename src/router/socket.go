@@ -0,0 +1,259 @@
+package router
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSocketMode = 0o660
+	// proxyHeaderTimeout bounds the wait for the PROXY protocol header of a
+	// new connection
+	proxyHeaderTimeout = 10 * time.Second
+)
+
+// proxyV2Signature starts version 2 PROXY protocol headers
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// SocketConfig configures a listener on a unix domain socket, for
+// deployments fronted by a reverse proxy on the same host.
+type SocketConfig struct {
+	Path string
+	Mode fs.FileMode
+	// ProxyProtocol makes the listener expect a PROXY protocol header, v1 or
+	// v2, on every connection, giving the address of the client. Without it,
+	// the client address is taken from the X-Real-IP or X-Forwarded-For
+	// headers set by the proxy.
+	ProxyProtocol bool
+}
+
+// SocketConfigFromEnv reads the socket listener configuration from
+// LISTEN_SOCKET, LISTEN_SOCKET_MODE and LISTEN_SOCKET_PROXY_PROTOCOL. It
+// returns nil when LISTEN_SOCKET is not set.
+func SocketConfigFromEnv() (*SocketConfig, error) {
+	path := os.Getenv("LISTEN_SOCKET")
+	if path == "" {
+		return nil, nil
+	}
+
+	config := &SocketConfig{Path: path, Mode: defaultSocketMode}
+	if val := os.Getenv("LISTEN_SOCKET_MODE"); val != "" {
+		mode, err := strconv.ParseUint(val, 8, 32)
+		if err != nil || mode > 0o777 {
+			return nil, fmt.Errorf("LISTEN_SOCKET_MODE must be octal permissions such as 0660, got %q", val)
+		}
+		config.Mode = fs.FileMode(mode)
+	}
+	config.ProxyProtocol = os.Getenv("LISTEN_SOCKET_PROXY_PROTOCOL") == "true"
+	return config, nil
+}
+
+// WithSocket also serves the public routes on a unix domain socket
+func WithSocket(config *SocketConfig) func(*Server) {
+	return func(s *Server) {
+		s.Socket = config
+	}
+}
+
+// listenSocket creates the socket, replacing one left behind by a previous
+// run, and applies its permissions.
+func listenSocket(config *SocketConfig) (net.Listener, error) {
+	if info, err := os.Lstat(config.Path); err == nil {
+		if info.Mode().Type() != fs.ModeSocket {
+			return nil, fmt.Errorf("%s exists and is not a socket", config.Path)
+		}
+		if err := os.Remove(config.Path); err != nil {
+			return nil, err
+		}
+	}
+
+	listener, err := net.Listen("unix", config.Path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(config.Path, config.Mode); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	if config.ProxyProtocol {
+		listener = &proxyListener{Listener: listener}
+	}
+	return listener, nil
+}
+
+// runSocket serves the public routes over plain HTTP on the unix socket
+func (s *Server) runSocket() {
+	listener, err := listenSocket(s.Socket)
+	if err != nil {
+		log.Fatalf("Failed to listen on %s: %s", s.Socket.Path, err.Error())
+	}
+
+	server := &http.Server{Handler: forwardedClient(s.handler()), ReadHeaderTimeout: 10 * time.Second}
+	log.Printf("Serving HTTP on unix socket %s", s.Socket.Path)
+	if err := server.Serve(listener); err != nil {
+		log.Fatalf("Failed to serve the unix socket: %s", err.Error())
+	}
+}
+
+// forwardedClient sets the remote address of requests without an IP address,
+// which arrived through the socket without a PROXY protocol header, to the
+// client address forwarded by the proxy. The forwarding headers are removed
+// once used, so that gin takes the client IP from the remote address.
+func forwardedClient(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err != nil || net.ParseIP(host) == nil {
+			if ip := forwardedIP(r.Header); ip != nil {
+				r.RemoteAddr = net.JoinHostPort(ip.String(), "0")
+			}
+			r.Header.Del("X-Real-IP")
+			r.Header.Del("X-Forwarded-For")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// forwardedIP returns the client address from X-Real-IP or, failing that,
+// the last address in X-Forwarded-For, which is the one added by the proxy.
+func forwardedIP(header http.Header) net.IP {
+	if ip := net.ParseIP(strings.TrimSpace(header.Get("X-Real-IP"))); ip != nil {
+		return ip
+	}
+	forwarded := header.Values("X-Forwarded-For")
+	if len(forwarded) == 0 {
+		return nil
+	}
+	hops := strings.Split(forwarded[len(forwarded)-1], ",")
+	return net.ParseIP(strings.TrimSpace(hops[len(hops)-1]))
+}
+
+// proxyListener reads the PROXY protocol header of accepted connections
+type proxyListener struct {
+	net.Listener
+}
+
+func (l *proxyListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &proxyConn{Conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+// proxyConn reads the PROXY protocol header on first use, in the goroutine
+// serving the connection rather than the accepting one.
+type proxyConn struct {
+	net.Conn
+	reader *bufio.Reader
+	once   sync.Once
+	remote net.Addr
+	err    error
+}
+
+func (c *proxyConn) readHeader() {
+	c.once.Do(func() {
+		c.Conn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout))
+		c.remote, c.err = readProxyHeader(c.reader)
+		c.Conn.SetReadDeadline(time.Time{})
+	})
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	c.readHeader()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(b)
+}
+
+// RemoteAddr returns the client address from the header, or the address of
+// the socket peer for headers without one, e.g. health checks.
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.readHeader()
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// readProxyHeader reads a version 1 or 2 PROXY protocol header and returns
+// the source address it carries, nil for headers without one.
+func readProxyHeader(r *bufio.Reader) (net.Addr, error) {
+	if prefix, err := r.Peek(len(proxyV2Signature)); err == nil && bytes.Equal(prefix, proxyV2Signature) {
+		return readProxyHeaderV2(r)
+	}
+	if prefix, err := r.Peek(6); err != nil || string(prefix) != "PROXY " {
+		return nil, errors.New("missing PROXY protocol header")
+	}
+	return readProxyHeaderV1(r)
+}
+
+// readProxyHeaderV1 reads "PROXY TCP4 <src> <dst> <src port> <dst port>\r\n"
+func readProxyHeaderV1(r *bufio.Reader) (net.Addr, error) {
+	line, err := r.ReadSlice('\n')
+	if err != nil || len(line) > 107 || !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errors.New("invalid PROXY protocol v1 header")
+	}
+
+	fields := strings.Fields(string(line))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, errors.New("invalid PROXY protocol v1 header")
+	}
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if ip == nil || err != nil {
+		return nil, errors.New("invalid PROXY protocol v1 address")
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// readProxyHeaderV2 reads the binary header: the signature, the version and
+// command, the address family, the length of the addresses and the addresses
+func readProxyHeaderV2(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if header[12]>>4 != 2 {
+		return nil, errors.New("unsupported PROXY protocol version")
+	}
+	addresses := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(r, addresses); err != nil {
+		return nil, err
+	}
+
+	// LOCAL connections, e.g. health checks of the proxy, carry no client
+	if header[12]&0x0f == 0 {
+		return nil, nil
+	}
+	switch header[13] >> 4 {
+	case 1: // IPv4
+		if len(addresses) < 12 {
+			return nil, errors.New("truncated PROXY protocol v2 address")
+		}
+		return &net.TCPAddr{IP: net.IP(addresses[0:4]), Port: int(binary.BigEndian.Uint16(addresses[8:10]))}, nil
+	case 2: // IPv6
+		if len(addresses) < 36 {
+			return nil, errors.New("truncated PROXY protocol v2 address")
+		}
+		return &net.TCPAddr{IP: net.IP(addresses[0:16]), Port: int(binary.BigEndian.Uint16(addresses[32:34]))}, nil
+	default:
+		return nil, nil
+	}
+}
@@ -0,0 +1,137 @@
+package router
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSocketConfigFromEnv(t *testing.T) {
+	t.Setenv("LISTEN_SOCKET", "")
+	config, err := SocketConfigFromEnv()
+	require.NoError(t, err)
+	require.Nil(t, config)
+
+	t.Setenv("LISTEN_SOCKET", "/run/cdn.sock")
+	t.Setenv("LISTEN_SOCKET_MODE", "0600")
+	t.Setenv("LISTEN_SOCKET_PROXY_PROTOCOL", "true")
+	config, err = SocketConfigFromEnv()
+	require.NoError(t, err)
+	require.Equal(t, &SocketConfig{Path: "/run/cdn.sock", Mode: 0o600, ProxyProtocol: true}, config)
+
+	t.Setenv("LISTEN_SOCKET_MODE", "rw")
+	_, err = SocketConfigFromEnv()
+	require.Error(t, err)
+}
+
+func TestReadProxyHeader(t *testing.T) {
+	v2 := append([]byte{}, proxyV2Signature...)
+	v2 = append(v2, 0x21, 0x11, 0, 12, 203, 0, 113, 7, 10, 0, 0, 1)
+	v2 = binary.BigEndian.AppendUint16(v2, 51234)
+	v2 = binary.BigEndian.AppendUint16(v2, 80)
+
+	tests := []struct {
+		name    string
+		header  string
+		want    string
+		wantErr bool
+	}{
+		{"v1", "PROXY TCP4 203.0.113.7 10.0.0.1 51234 80\r\n", "203.0.113.7:51234", false},
+		{"v1 IPv6", "PROXY TCP6 2001:db8::1 ::1 51234 80\r\n", "[2001:db8::1]:51234", false},
+		{"v1 unknown", "PROXY UNKNOWN\r\n", "", false},
+		{"v2", string(v2), "203.0.113.7:51234", false},
+		{"v2 local", string(append(append([]byte{}, proxyV2Signature...), 0x20, 0x00, 0, 0)), "", false},
+		{"missing", "GET / HTTP/1.1\r\n", "", true},
+		{"malformed", "PROXY TCP4 nowhere 10.0.0.1 1 80\r\n", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, err := readProxyHeader(bufio.NewReader(strings.NewReader(tt.header + "GET / HTTP/1.1\r\n")))
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			if tt.want == "" {
+				require.Nil(t, addr)
+				return
+			}
+			require.Equal(t, tt.want, addr.String())
+		})
+	}
+}
+
+func TestForwardedClient(t *testing.T) {
+	var remoteAddr string
+	handler := forwardedClient(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remoteAddr = r.RemoteAddr
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "@"
+	r.Header.Set("X-Forwarded-For", "10.9.9.9, 203.0.113.7")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	require.Equal(t, "203.0.113.7:0", remoteAddr)
+	require.Empty(t, r.Header.Get("X-Forwarded-For"))
+
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "@"
+	r.Header.Set("X-Real-IP", "198.51.100.2")
+	r.Header.Set("X-Forwarded-For", "203.0.113.7")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	require.Equal(t, "198.51.100.2:0", remoteAddr)
+
+	// Addresses from PROXY protocol headers are kept
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "203.0.113.7:51234"
+	r.Header.Set("X-Real-IP", "198.51.100.2")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	require.Equal(t, "203.0.113.7:51234", remoteAddr)
+}
+
+func TestListenSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cdn.sock")
+	config := &SocketConfig{Path: path, Mode: 0o600, ProxyProtocol: true}
+
+	// A socket left behind by a previous run is replaced
+	stale, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	listener, err := listenSocket(config)
+	require.NoError(t, err)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	server := &http.Server{Handler: forwardedClient(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.RemoteAddr)
+	}))}
+	go server.Serve(listener)
+	defer server.Close()
+
+	conn, err := net.Dial("unix", path)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "PROXY TCP4 203.0.113.7 10.0.0.1 51234 80\r\nGET / HTTP/1.1\r\nHost: cdn\r\n\r\n")
+	require.NoError(t, err)
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	require.Equal(t, "203.0.113.7:51234", string(body))
+
+	require.NoError(t, os.Remove(path))
+	require.NoError(t, os.WriteFile(path, nil, 0o644))
+	_, err = listenSocket(config)
+	require.Error(t, err, "regular files are not replaced")
+}
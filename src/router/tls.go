@@ -0,0 +1,155 @@
+package router
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// TLSConfig configures native HTTPS. Either CertFile and KeyFile are set, or
+// certificates for Domains are obtained from Let's Encrypt.
+type TLSConfig struct {
+	CertFile string
+	KeyFile  string
+
+	Domains  []string
+	Email    string
+	CacheDir string
+
+	// RedirectAddr is the address of the plain HTTP listener redirecting to
+	// HTTPS. Autocert also answers its HTTP-01 challenges there.
+	RedirectAddr string
+
+	// ClientCAs verify the client certificates service accounts may
+	// authenticate with, nil if client certificates aren't accepted.
+	ClientCAs *x509.CertPool
+}
+
+// TLSConfigFromEnv reads the TLS configuration from TLS_CERT_FILE and
+// TLS_KEY_FILE or TLS_AUTOCERT_DOMAINS. It returns nil when TLS is not
+// configured.
+func TLSConfigFromEnv() (*TLSConfig, error) {
+	config := &TLSConfig{
+		CertFile: os.Getenv("TLS_CERT_FILE"),
+		KeyFile:  os.Getenv("TLS_KEY_FILE"),
+		Email:    os.Getenv("TLS_AUTOCERT_EMAIL"),
+		CacheDir: os.Getenv("TLS_AUTOCERT_CACHE_DIR"),
+	}
+	for _, domain := range strings.Split(os.Getenv("TLS_AUTOCERT_DOMAINS"), ",") {
+		if domain = strings.TrimSpace(domain); domain != "" {
+			config.Domains = append(config.Domains, domain)
+		}
+	}
+
+	manual := config.CertFile != "" || config.KeyFile != ""
+	switch {
+	case !manual && len(config.Domains) == 0:
+		return nil, nil
+	case manual && len(config.Domains) > 0:
+		return nil, errors.New("set either TLS_CERT_FILE and TLS_KEY_FILE or TLS_AUTOCERT_DOMAINS, not both")
+	case manual && (config.CertFile == "" || config.KeyFile == ""):
+		return nil, errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+
+	if file := os.Getenv("TLS_CLIENT_CA_FILE"); file != "" {
+		pem, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("TLS_CLIENT_CA_FILE holds no PEM certificates")
+		}
+	}
+
+	if config.CacheDir == "" {
+		config.CacheDir = filepath.Join(util.ExPath, "certs")
+	}
+
+	// Autocert needs port 80 for its challenges; with static certificates
+	// the redirect is opt-in.
+	config.RedirectAddr = os.Getenv("TLS_REDIRECT_ADDR")
+	if config.RedirectAddr == "" && !manual {
+		config.RedirectAddr = ":80"
+	}
+
+	return config, nil
+}
+
+// WithTLS serves the server over HTTPS.
+func WithTLS(config *TLSConfig) func(*Server) {
+	return func(s *Server) {
+		s.TLS = config
+	}
+}
+
+// runTLS serves the engine over HTTPS on s.Port and, if configured, redirects
+// plain HTTP requests on the redirect listener.
+func (s *Server) runTLS() {
+	server := &http.Server{
+		Addr:              s.Port,
+		Handler:           s.handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	redirect := redirectToHTTPS(s.Port)
+	if len(s.TLS.Domains) > 0 {
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(s.TLS.Domains...),
+			Cache:      autocert.DirCache(s.TLS.CacheDir),
+			Email:      s.TLS.Email,
+		}
+		server.TLSConfig = manager.TLSConfig()
+		redirect = manager.HTTPHandler(redirect)
+	} else {
+		server.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	if s.TLS.ClientCAs != nil {
+		// Clients without a certificate still authenticate otherwise
+		server.TLSConfig.ClientCAs = s.TLS.ClientCAs
+		server.TLSConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	if s.TLS.RedirectAddr != "" {
+		go func() {
+			log.Printf("Redirecting HTTP on %s to HTTPS", s.TLS.RedirectAddr)
+			redirectServer := &http.Server{Addr: s.TLS.RedirectAddr, Handler: redirect, ReadHeaderTimeout: 10 * time.Second}
+			if err := redirectServer.ListenAndServe(); err != nil {
+				log.Printf("[ERROR] HTTP redirect listener stopped: %s", err.Error())
+			}
+		}()
+	}
+
+	log.Printf("Serving HTTPS on %s", s.Port)
+	if err := server.ListenAndServeTLS(s.TLS.CertFile, s.TLS.KeyFile); err != nil {
+		log.Fatalf("Failed to serve HTTPS: %s", err.Error())
+	}
+}
+
+// redirectToHTTPS redirects requests to the same URL on the HTTPS listener
+// at addr.
+func redirectToHTTPS(addr string) http.Handler {
+	_, port, _ := net.SplitHostPort(addr)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
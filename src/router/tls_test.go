@@ -0,0 +1,56 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTLSConfigFromEnv(t *testing.T) {
+	t.Setenv("TLS_CERT_FILE", "")
+	t.Setenv("TLS_KEY_FILE", "")
+	t.Setenv("TLS_AUTOCERT_DOMAINS", "")
+	config, err := TLSConfigFromEnv()
+	require.NoError(t, err)
+	require.Nil(t, config)
+
+	t.Setenv("TLS_AUTOCERT_DOMAINS", "cdn.example.com, static.example.com")
+	config, err = TLSConfigFromEnv()
+	require.NoError(t, err)
+	require.Equal(t, []string{"cdn.example.com", "static.example.com"}, config.Domains)
+	require.Equal(t, ":80", config.RedirectAddr)
+
+	t.Setenv("TLS_CERT_FILE", "cert.pem")
+	_, err = TLSConfigFromEnv()
+	require.Error(t, err, "static certificates and autocert are exclusive")
+
+	t.Setenv("TLS_AUTOCERT_DOMAINS", "")
+	_, err = TLSConfigFromEnv()
+	require.Error(t, err, "the key file is missing")
+
+	t.Setenv("TLS_KEY_FILE", "key.pem")
+	config, err = TLSConfigFromEnv()
+	require.NoError(t, err)
+	require.Empty(t, config.RedirectAddr)
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{":443", "https://cdn.example.com/api/cdn/image/all?x=1"},
+		{":8443", "https://cdn.example.com:8443/api/cdn/image/all?x=1"},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "http://cdn.example.com:8080/api/cdn/image/all?x=1", nil)
+		redirectToHTTPS(tt.addr).ServeHTTP(w, r)
+
+		require.Equal(t, http.StatusMovedPermanently, w.Code)
+		require.Equal(t, tt.want, w.Header().Get("Location"))
+	}
+}
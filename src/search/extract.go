@@ -0,0 +1,146 @@
+// Package search extracts the text of uploaded documents so they can be
+// found by their contents.
+package search
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// maxTextSize is the number of bytes of text indexed per document.
+const maxTextSize = 1 << 20
+
+// ErrUnsupported is returned for documents whose text cannot be extracted.
+var ErrUnsupported = errors.New("unsupported document type")
+
+// ExtractText returns the text of the PDF, DOCX or plain text file at path,
+// truncated to maxTextSize bytes.
+func ExtractText(path string) (string, error) {
+	var text string
+	var err error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".txt", ".md", ".csv":
+		text, err = readText(path)
+	case ".docx":
+		text, err = readDocx(path)
+	case ".pdf":
+		text, err = readPDF(path)
+	default:
+		return "", ErrUnsupported
+	}
+	if err != nil {
+		return "", err
+	}
+	return truncate(text, maxTextSize), nil
+}
+
+func readText(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, maxTextSize))
+	if err != nil {
+		return "", err
+	}
+	return strings.ToValidUTF8(string(data), ""), nil
+}
+
+// readDocx collects the text runs of the main document part, starting a new
+// line for each paragraph.
+func readDocx(path string) (string, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return "", err
+	}
+	defer zr.Close()
+
+	for _, f := range zr.File {
+		if f.Name != "word/document.xml" {
+			continue
+		}
+		r, err := f.Open()
+		if err != nil {
+			return "", err
+		}
+		defer r.Close()
+
+		var text strings.Builder
+		decoder := xml.NewDecoder(r)
+		inText := false
+		for text.Len() < maxTextSize {
+			token, err := decoder.Token()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return "", err
+			}
+			switch t := token.(type) {
+			case xml.StartElement:
+				inText = t.Name.Local == "t"
+				if t.Name.Local == "tab" {
+					text.WriteByte('\t')
+				}
+			case xml.EndElement:
+				inText = false
+				if t.Name.Local == "p" {
+					text.WriteByte('\n')
+				}
+			case xml.CharData:
+				if inText {
+					text.Write(t)
+				}
+			}
+		}
+		return text.String(), nil
+	}
+	return "", errors.New("docx has no word/document.xml")
+}
+
+func readPDF(path string) (text string, err error) {
+	// The PDF reader panics on some malformed files
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.New("malformed PDF")
+		}
+	}()
+
+	f, reader, err := pdf.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	r, err := reader.GetPlainText()
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, io.LimitReader(r, maxTextSize)); err != nil {
+		return "", err
+	}
+	return strings.ToValidUTF8(buf.String(), ""), nil
+}
+
+// truncate cuts s to at most n bytes without splitting a rune.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
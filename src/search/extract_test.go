@@ -0,0 +1,49 @@
+package search
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractText_Docx(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.docx")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	zw := zip.NewWriter(f)
+	w, err := zw.Create("word/document.xml")
+	require.NoError(t, err)
+	_, err = w.Write([]byte(`<?xml version="1.0"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>
+<w:p><w:r><w:t>Quarterly</w:t></w:r><w:r><w:t xml:space="preserve"> report</w:t></w:r></w:p>
+<w:p><w:r><w:t>Revenue grew</w:t></w:r></w:p>
+</w:body></w:document>`))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	require.NoError(t, f.Close())
+
+	text, err := ExtractText(path)
+	require.NoError(t, err)
+	require.Equal(t, "Quarterly report\nRevenue grew\n", text)
+}
+
+func TestExtractText_Text(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	require.NoError(t, os.WriteFile(path, []byte("plain \xffnotes"), 0o644))
+
+	text, err := ExtractText(path)
+	require.NoError(t, err)
+	require.Equal(t, "plain notes", text)
+
+	_, err = ExtractText(filepath.Join(t.TempDir(), "archive.zip"))
+	require.ErrorIs(t, err, ErrUnsupported)
+}
+
+func TestTruncate(t *testing.T) {
+	require.Equal(t, "ab", truncate("abc", 2))
+	require.Equal(t, "a", truncate("aé", 2))
+	require.Equal(t, "abc", truncate("abc", 5))
+}
@@ -0,0 +1,44 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"log"
+	"path/filepath"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+)
+
+// IndexDoc extracts the text of the uploaded document and adds it to the
+// index. Documents whose text cannot be extracted are indexed by name only.
+func IndexDoc(ctx context.Context, repo models.SearchRepository, fileName string) error {
+	text, err := ExtractText(filepath.Join(util.ExPath, "uploads", "docs", fileName))
+	if err != nil && !errors.Is(err, ErrUnsupported) {
+		log.Printf("Failed to extract the text of %s, indexing its name only: %s", fileName, err.Error())
+	}
+	return repo.Index(ctx, models.MediaTypeDoc, fileName, text)
+}
+
+// Backfill indexes the documents uploaded before search was available and
+// returns the number of indexed documents.
+func Backfill(ctx context.Context, repo models.SearchRepository) int {
+	names, err := repo.Unindexed(ctx, models.MediaTypeDoc)
+	if err != nil {
+		log.Printf("Failed to find unindexed documents: %s", err.Error())
+		return 0
+	}
+
+	indexed := 0
+	for _, name := range names {
+		if err := IndexDoc(ctx, repo, name); err != nil {
+			log.Printf("Failed to index %s: %s", name, err.Error())
+			continue
+		}
+		indexed++
+	}
+	if indexed > 0 {
+		log.Printf("Indexed %d documents for search", indexed)
+	}
+	return indexed
+}
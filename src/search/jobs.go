@@ -0,0 +1,43 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/queue"
+)
+
+// IndexJob is the kind of the background jobs indexing a document.
+const IndexJob = "search.index"
+
+type indexPayload struct {
+	FileName string `json:"file_name"`
+}
+
+// RegisterJobs registers the handler of IndexJob with the queue.
+func RegisterJobs(repo models.SearchRepository) {
+	queue.Register(IndexJob, func(ctx context.Context, payload []byte) error {
+		var p indexPayload
+		if err := json.Unmarshal(payload, &p); err != nil {
+			return err
+		}
+		return IndexDoc(ctx, repo, p.FileName)
+	})
+}
+
+// EnqueueIndexDoc indexes a document in the background, or right away when
+// the queue isn't running. Errors are logged: a document missing from the
+// index can still be downloaded.
+func EnqueueIndexDoc(ctx context.Context, repo models.SearchRepository, fileName string) {
+	var err error
+	if queue.Running() {
+		err = queue.Enqueue(ctx, IndexJob, indexPayload{FileName: fileName})
+	} else {
+		err = IndexDoc(ctx, repo, fileName)
+	}
+	if err != nil {
+		log.Printf("Failed to index document %s: %s", fileName, err.Error())
+	}
+}
@@ -0,0 +1,404 @@
+// Package settings holds the settings admins can change at runtime. A
+// setting takes its value from the config table when one was stored, then
+// from its environment variable, then from its default. Changes are
+// published to watchers, so the middlewares and handlers using a setting
+// apply it without a restart.
+package settings
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"gorm.io/gorm"
+)
+
+// Keys of the settings.
+const (
+	RegistrationEnabled      = "registration_enabled"
+	AuthRateLimit            = "auth_rate_limit"
+	FileNamingStrategy       = "file_naming_strategy"
+	IntegrityManifestEnabled = "integrity_manifest_enabled"
+	RequireIfMatch           = "require_if_match"
+	OptimizeOnUpload         = "optimize_on_upload"
+	OptimizeQuality          = "optimize_quality"
+	OptimizeMaxDimension     = "optimize_max_dimension"
+	MaxAuthBodySize          = "max_auth_body_size"
+	MaxUploadBodySize        = "max_upload_body_size"
+	MinFreeDiskSpace         = "min_free_disk_space"
+	MaxConcurrentUploads     = "max_concurrent_uploads"
+	UploadQueueTimeout       = "upload_queue_timeout"
+	ModerationEnabled        = "moderation_enabled"
+)
+
+// Types of the settings.
+const (
+	TypeBool   = "bool"
+	TypeInt    = "int"
+	TypeString = "string"
+)
+
+// Sources of the value of a setting.
+const (
+	SourceStored  = "stored"
+	SourceEnv     = "env"
+	SourceDefault = "default"
+)
+
+// ErrUnknownSetting is returned when updating a setting that does not exist.
+var ErrUnknownSetting = errors.New("unknown setting")
+
+// Setting describes a setting.
+type Setting struct {
+	Key         string `json:"key"`
+	Type        string `json:"type"`
+	Description string `json:"description"`
+	// Env is the environment variable the value is read from when none was
+	// stored.
+	Env     string `json:"env,omitempty"`
+	Default string `json:"default"`
+	// validate checks values on top of their type.
+	validate func(value string) error
+}
+
+var definitions = []Setting{
+	{
+		Key:         RegistrationEnabled,
+		Type:        TypeBool,
+		Description: "Whether new users can register once the first user exists",
+		Default:     "true",
+	},
+	{
+		Key:         AuthRateLimit,
+		Type:        TypeInt,
+		Description: "Login and registration attempts allowed per client and minute, 0 to disable the limit",
+		Env:         "AUTH_RATE_LIMIT",
+		Default:     "20",
+	},
+	{
+		Key:         FileNamingStrategy,
+		Type:        TypeString,
+		Description: "How uploaded files are named: original, uuid, content-hash or slug",
+		Env:         "FILE_NAMING_STRATEGY",
+		Default:     util.NamingOriginal,
+		validate:    util.ValidateNamingStrategy,
+	},
+	{
+		Key:         IntegrityManifestEnabled,
+		Type:        TypeBool,
+		Description: "Whether the public subresource integrity manifests are served",
+		Env:         "INTEGRITY_MANIFEST_ENABLED",
+		Default:     "false",
+	},
+	{
+		Key:         RequireIfMatch,
+		Type:        TypeBool,
+		Description: "Whether renames, deletions and updates of media must send the version they change in If-Match",
+		Env:         "REQUIRE_IF_MATCH",
+		Default:     "false",
+	},
+	{
+		Key:         OptimizeOnUpload,
+		Type:        TypeBool,
+		Description: "Whether uploaded JPEG and PNG images are stripped of metadata, turned upright, capped in size and re-encoded",
+		Env:         "OPTIMIZE_ON_UPLOAD",
+		Default:     "false",
+	},
+	{
+		Key:         OptimizeQuality,
+		Type:        TypeInt,
+		Description: "JPEG quality of optimized uploads, from 1 to 100",
+		Env:         "OPTIMIZE_QUALITY",
+		Default:     "85",
+		validate: func(value string) error {
+			if n, _ := strconv.Atoi(value); n < 1 || n > 100 {
+				return errors.New("must be between 1 and 100")
+			}
+			return nil
+		},
+	},
+	{
+		Key:         OptimizeMaxDimension,
+		Type:        TypeInt,
+		Description: "Largest width and height of optimized uploads in pixels, 0 for no limit",
+		Env:         "OPTIMIZE_MAX_DIMENSION",
+		Default:     "0",
+	},
+	{
+		Key:         MaxAuthBodySize,
+		Type:        TypeInt,
+		Description: "Largest request body in bytes accepted by the authentication endpoints, 0 for no limit",
+		Env:         "MAX_AUTH_BODY_SIZE",
+		Default:     "65536",
+	},
+	{
+		Key:         MaxUploadBodySize,
+		Type:        TypeInt,
+		Description: "Largest request body in bytes accepted by uploads, including WebDAV, 0 for no limit",
+		Env:         "MAX_UPLOAD_BODY_SIZE",
+		Default:     "1073741824",
+	},
+	{
+		Key:         MinFreeDiskSpace,
+		Type:        TypeInt,
+		Description: "Free bytes the uploads volume must keep; uploads are rejected with 507 below it, 0 to never reject them",
+		Env:         "MIN_FREE_DISK_SPACE",
+		Default:     "104857600",
+	},
+	{
+		Key:         MaxConcurrentUploads,
+		Type:        TypeInt,
+		Description: "Uploads, including WebDAV, handled at once; further uploads wait for a slot, 0 for no limit",
+		Env:         "MAX_CONCURRENT_UPLOADS",
+		Default:     "0",
+	},
+	{
+		Key:         UploadQueueTimeout,
+		Type:        TypeInt,
+		Description: "Seconds uploads wait for a slot before they are rejected with 503, 0 to reject them at once",
+		Env:         "UPLOAD_QUEUE_TIMEOUT",
+		Default:     "30",
+	},
+	{
+		Key:         ModerationEnabled,
+		Type:        TypeBool,
+		Description: "Whether uploads by users other than admins are held back from downloads until an admin approves them",
+		Env:         "MODERATION_ENABLED",
+		Default:     "false",
+	},
+}
+
+func definition(key string) (Setting, bool) {
+	for _, setting := range definitions {
+		if setting.Key == key {
+			return setting, true
+		}
+	}
+	return Setting{}, false
+}
+
+// Validate returns an error if value is not a valid value of the setting.
+func (s Setting) Validate(value string) error {
+	switch s.Type {
+	case TypeBool:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return errors.New("must be true or false")
+		}
+	case TypeInt:
+		if n, err := strconv.Atoi(value); err != nil || n < 0 {
+			return errors.New("must be a non-negative integer")
+		}
+	}
+	if s.validate != nil {
+		return s.validate(value)
+	}
+	return nil
+}
+
+// InvalidError is returned when updating a setting to an invalid value.
+type InvalidError struct {
+	Key string
+	Err error
+}
+
+func (e *InvalidError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Key, e.Err.Error())
+}
+
+func (e *InvalidError) Unwrap() error {
+	return e.Err
+}
+
+// Value is a setting with its current value.
+type Value struct {
+	Setting
+	Value string `json:"value"`
+	// Source tells where the value comes from, see SourceStored.
+	Source string `json:"source"`
+}
+
+type watcher struct {
+	key string
+	fn  func(value string)
+}
+
+// Store holds the settings and notifies watchers of their changes.
+type Store struct {
+	mu       sync.RWMutex
+	repo     *database.ConfigRepo
+	stored   map[string]string
+	watchers map[*watcher]struct{}
+}
+
+func NewStore() *Store {
+	return &Store{stored: map[string]string{}, watchers: map[*watcher]struct{}{}}
+}
+
+// Default is the store of the application, loaded on startup.
+var Default = NewStore()
+
+// Load reads the stored settings from repo, which Update then writes to.
+// Until then the settings come from the environment and their defaults.
+func (s *Store) Load(repo *database.ConfigRepo) error {
+	stored := map[string]string{}
+	for _, setting := range definitions {
+		value, err := repo.Get(setting.Key)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		stored[setting.Key] = value
+	}
+
+	s.mu.Lock()
+	before := s.values()
+	s.repo = repo
+	s.stored = stored
+	s.mu.Unlock()
+
+	s.notify(before)
+	return nil
+}
+
+// value returns the value of setting and its source. s.mu must be held.
+func (s *Store) value(setting Setting) (string, string) {
+	if value, ok := s.stored[setting.Key]; ok && setting.Validate(value) == nil {
+		return value, SourceStored
+	}
+	if setting.Env != "" {
+		if value := os.Getenv(setting.Env); value != "" && setting.Validate(value) == nil {
+			return value, SourceEnv
+		}
+	}
+	return setting.Default, SourceDefault
+}
+
+// values returns the value of every setting by key. s.mu must be held.
+func (s *Store) values() map[string]string {
+	values := map[string]string{}
+	for _, setting := range definitions {
+		values[setting.Key], _ = s.value(setting)
+	}
+	return values
+}
+
+// Get returns the value of the setting with key, or an empty string for
+// unknown keys.
+func (s *Store) Get(key string) string {
+	setting, ok := definition(key)
+	if !ok {
+		return ""
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	value, _ := s.value(setting)
+	return value
+}
+
+// Bool returns the value of a bool setting.
+func (s *Store) Bool(key string) bool {
+	value, _ := strconv.ParseBool(s.Get(key))
+	return value
+}
+
+// Int returns the value of an int setting.
+func (s *Store) Int(key string) int {
+	value, _ := strconv.Atoi(s.Get(key))
+	return value
+}
+
+// List returns every setting with its value, sorted by key.
+func (s *Store) List() []Value {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]Value, 0, len(definitions))
+	for _, setting := range definitions {
+		value, source := s.value(setting)
+		list = append(list, Value{Setting: setting, Value: value, Source: source})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	return list
+}
+
+// Update stores the changed settings, or removes the stored value of the
+// settings mapped to nil so they fall back to the environment and their
+// default. Either every change is applied or, if one is unknown or
+// invalid, none.
+func (s *Store) Update(changes map[string]*string) error {
+	for key, value := range changes {
+		setting, ok := definition(key)
+		if !ok {
+			return &InvalidError{Key: key, Err: ErrUnknownSetting}
+		}
+		if value == nil {
+			continue
+		}
+		if err := setting.Validate(*value); err != nil {
+			return &InvalidError{Key: key, Err: err}
+		}
+	}
+
+	s.mu.Lock()
+	if s.repo == nil {
+		s.mu.Unlock()
+		return errors.New("settings are not loaded")
+	}
+	if err := s.repo.SetAll(changes); err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	before := s.values()
+	for key, value := range changes {
+		if value == nil {
+			delete(s.stored, key)
+		} else {
+			s.stored[key] = *value
+		}
+	}
+	s.mu.Unlock()
+
+	s.notify(before)
+	return nil
+}
+
+// Watch calls fn with the value of the setting with key, then again every
+// time the value changes, until cancel is called. fn must not block.
+func (s *Store) Watch(key string, fn func(value string)) (cancel func()) {
+	w := &watcher{key: key, fn: fn}
+
+	s.mu.Lock()
+	s.watchers[w] = struct{}{}
+	s.mu.Unlock()
+
+	fn(s.Get(key))
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.watchers, w)
+	}
+}
+
+// notify calls the watchers of the settings whose value differs from before.
+func (s *Store) notify(before map[string]string) {
+	s.mu.RLock()
+	after := s.values()
+	var calls []func()
+	for w := range s.watchers {
+		if value := after[w.key]; value != before[w.key] {
+			fn := w.fn
+			calls = append(calls, func() { fn(value) })
+		}
+	}
+	s.mu.RUnlock()
+
+	for _, call := range calls {
+		call()
+	}
+}
@@ -0,0 +1,71 @@
+package settings
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/stretchr/testify/require"
+)
+
+func ptr(s string) *string {
+	return &s
+}
+
+func TestStore(t *testing.T) {
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	t.Setenv("AUTH_RATE_LIMIT", "5")
+	repo := database.NewConfigRepo(database.DB)
+	require.NoError(t, repo.Set(RegistrationEnabled, "false"))
+
+	store := NewStore()
+	require.Equal(t, "", store.Get("unknown"))
+	require.True(t, store.Bool(RegistrationEnabled))
+	require.Error(t, store.Update(map[string]*string{AuthRateLimit: ptr("1")}))
+
+	var limits []string
+	cancel := store.Watch(AuthRateLimit, func(value string) { limits = append(limits, value) })
+	var registration []string
+	store.Watch(RegistrationEnabled, func(value string) { registration = append(registration, value) })
+
+	require.NoError(t, store.Load(repo))
+	require.False(t, store.Bool(RegistrationEnabled))
+	require.Equal(t, []string{"true", "false"}, registration)
+	require.Equal(t, 5, store.Int(AuthRateLimit))
+
+	// Invalid changes are rejected as a whole
+	err := store.Update(map[string]*string{AuthRateLimit: ptr("10"), FileNamingStrategy: ptr("random")})
+	var invalid *InvalidError
+	require.True(t, errors.As(err, &invalid))
+	require.Equal(t, FileNamingStrategy, invalid.Key)
+	err = store.Update(map[string]*string{"unknown": ptr("1")})
+	require.ErrorIs(t, err, ErrUnknownSetting)
+	require.Equal(t, []string{"5"}, limits)
+
+	require.NoError(t, store.Update(map[string]*string{AuthRateLimit: ptr("10"), FileNamingStrategy: ptr(util.NamingUUID)}))
+	require.Equal(t, []string{"5", "10"}, limits)
+	require.Equal(t, util.NamingUUID, store.Get(FileNamingStrategy))
+	stored, err := repo.Get(AuthRateLimit)
+	require.NoError(t, err)
+	require.Equal(t, "10", stored)
+
+	for _, value := range store.List() {
+		if value.Key == AuthRateLimit {
+			require.Equal(t, SourceStored, value.Source)
+			require.Equal(t, "AUTH_RATE_LIMIT", value.Env)
+		}
+	}
+
+	// Resetting falls back to the environment
+	require.NoError(t, store.Update(map[string]*string{AuthRateLimit: nil}))
+	require.Equal(t, []string{"5", "10", "5"}, limits)
+	_, err = repo.Get(AuthRateLimit)
+	require.Error(t, err)
+
+	cancel()
+	require.NoError(t, store.Update(map[string]*string{AuthRateLimit: ptr("0")}))
+	require.Equal(t, []string{"5", "10", "5"}, limits)
+	require.Equal(t, 0, store.Int(AuthRateLimit))
+}
@@ -0,0 +1,203 @@
+// Package similarity computes perceptual hashes of images in the background
+// and groups visually similar images, e.g. re-encoded or resized copies that
+// the checksum based duplicate check misses.
+package similarity
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"image"
+	"log"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/imaging"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/queue"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"gorm.io/gorm"
+)
+
+// Job is the kind of the background jobs computing a perceptual hash.
+const Job = "image.perceptual_hash"
+
+type payload struct {
+	FileName string `json:"file_name"`
+}
+
+// RegisterJobs registers the handler of Job with the queue.
+func RegisterJobs(images models.ImageRepository) {
+	queue.Register(Job, func(ctx context.Context, data []byte) error {
+		var p payload
+		if err := json.Unmarshal(data, &p); err != nil {
+			return err
+		}
+		return Compute(ctx, images, p.FileName)
+	})
+}
+
+// Enqueue computes the perceptual hash of an image in the background, or
+// right away when the queue isn't running. Errors are logged: the hash only
+// feeds the duplicate report.
+func Enqueue(ctx context.Context, images models.ImageRepository, fileName string) {
+	var err error
+	if queue.Running() {
+		err = queue.Enqueue(ctx, Job, payload{FileName: fileName})
+	} else {
+		err = Compute(ctx, images, fileName)
+	}
+	if err != nil {
+		log.Printf("Failed to compute the perceptual hash of image %s: %s", fileName, err.Error())
+	}
+}
+
+// Compute records the perceptual hash of the image fileName. Images that
+// were deleted in the meantime or cannot be decoded, e.g. SVG images, are
+// skipped.
+func Compute(ctx context.Context, images models.ImageRepository, fileName string) error {
+	_, err := compute(ctx, images, fileName)
+	return err
+}
+
+// compute works like Compute and reports whether a hash was recorded.
+func compute(ctx context.Context, images models.ImageRepository, fileName string) (bool, error) {
+	if _, err := images.GetImageByFileName(ctx, fileName); errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	hash, err := imaging.PerceptualHashFile(filepath.Join(util.ExPath, "uploads", "images", fileName))
+	if errors.Is(err, image.ErrFormat) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, images.UpdateImagePerceptualHash(ctx, fileName, FormatHash(hash))
+}
+
+// Backfill computes the perceptual hashes of the images uploaded before
+// hashes were available, or whose content changed since, and returns the
+// number of computed hashes.
+func Backfill(ctx context.Context, images models.ImageRepository) int {
+	names, err := images.GetImagesWithoutPerceptualHash(ctx)
+	if err != nil {
+		log.Printf("Failed to find images without perceptual hash: %s", err.Error())
+		return 0
+	}
+
+	computed := 0
+	for _, name := range names {
+		ok, err := compute(ctx, images, name)
+		if err != nil {
+			log.Printf("Failed to compute the perceptual hash of image %s: %s", name, err.Error())
+			continue
+		}
+		if ok {
+			computed++
+		}
+	}
+	if computed > 0 {
+		log.Printf("Computed perceptual hashes of %d images", computed)
+	}
+	return computed
+}
+
+// FormatHash returns the hexadecimal form of a hash stored with images.
+func FormatHash(hash uint64) string {
+	return strconv.FormatUint(hash, 16)
+}
+
+// ParseHash parses a hash stored with images.
+func ParseHash(s string) (uint64, error) {
+	return strconv.ParseUint(s, 16, 64)
+}
+
+// Similarity returns how alike two hashes are, from 0 to 1 for identical
+// hashes.
+func Similarity(a, b uint64) float64 {
+	return 1 - float64(imaging.HashDistance(a, b))/64
+}
+
+// Cluster is a group of visually similar images.
+type Cluster struct {
+	Images []models.Image
+	// Similarity is the lowest similarity of the pairs of images linking
+	// the cluster together.
+	Similarity float64
+}
+
+// Clusters groups the images whose perceptual hashes are at least threshold
+// similar, directly or through other images of the group. Images without a
+// hash and images without a similar one are left out. Clusters are ordered
+// by size, largest first, and their images by upload time.
+func Clusters(images []models.Image, threshold float64) []Cluster {
+	type hashed struct {
+		index int
+		hash  uint64
+	}
+	var candidates []hashed
+	for i, img := range images {
+		if hash, err := ParseHash(img.PerceptualHash); err == nil {
+			candidates = append(candidates, hashed{i, hash})
+		}
+	}
+
+	parent := make([]int, len(candidates))
+	lowest := make([]float64, len(candidates))
+	for i := range parent {
+		parent[i], lowest[i] = i, 1
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	for i := range candidates {
+		for j := i + 1; j < len(candidates); j++ {
+			similarity := Similarity(candidates[i].hash, candidates[j].hash)
+			if similarity < threshold {
+				continue
+			}
+			ri, rj := find(i), find(j)
+			if ri != rj {
+				parent[rj] = ri
+				lowest[ri] = min(lowest[ri], lowest[rj])
+			}
+			lowest[ri] = min(lowest[ri], similarity)
+		}
+	}
+
+	groups := map[int]*Cluster{}
+	var roots []int
+	for i, c := range candidates {
+		root := find(i)
+		group, ok := groups[root]
+		if !ok {
+			group = &Cluster{Similarity: lowest[root]}
+			groups[root] = group
+			roots = append(roots, root)
+		}
+		group.Images = append(group.Images, images[c.index])
+	}
+
+	var clusters []Cluster
+	for _, root := range roots {
+		group := groups[root]
+		if len(group.Images) < 2 {
+			continue
+		}
+		sort.SliceStable(group.Images, func(a, b int) bool {
+			return group.Images[a].CreatedAt.Before(group.Images[b].CreatedAt)
+		})
+		clusters = append(clusters, *group)
+	}
+	sort.SliceStable(clusters, func(a, b int) bool {
+		return len(clusters[a].Images) > len(clusters[b].Images)
+	})
+	return clusters
+}
@@ -0,0 +1,94 @@
+package similarity
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestBackfill(t *testing.T) {
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	ctx := context.Background()
+	imageDir := filepath.Join(util.ExPath, "uploads", "images")
+	require.NoError(t, os.MkdirAll(imageDir, 0o755))
+
+	img := image.NewGray(image.Rect(0, 0, 40, 30))
+	for x := 0; x < 20; x++ {
+		for y := 0; y < 30; y++ {
+			img.Set(x, y, color.White)
+		}
+	}
+	file, err := os.Create(filepath.Join(imageDir, "photo.png"))
+	require.NoError(t, err)
+	require.NoError(t, png.Encode(file, img))
+	require.NoError(t, file.Close())
+	require.NoError(t, os.WriteFile(filepath.Join(imageDir, "icon.svg"), []byte(`<svg xmlns="http://www.w3.org/2000/svg"/>`), 0o644))
+
+	images := database.NewImageRepo(database.DB)
+	for _, name := range []string{"photo.png", "icon.svg"} {
+		_, err := images.AddImage(ctx, models.Image{FileName: name, Checksum: []byte(name)})
+		require.NoError(t, err)
+	}
+
+	// SVG images cannot be decoded and are skipped
+	require.Equal(t, 1, Backfill(ctx, images))
+	photo, err := images.GetImageByFileName(ctx, "photo.png")
+	require.NoError(t, err)
+	require.NotEmpty(t, photo.PerceptualHash)
+
+	// Changed content clears the hash until it is computed again
+	require.NoError(t, images.UpdateImageChecksum(ctx, "photo.png", models.ChecksumMD5, []byte("new")))
+	names, err := images.GetImagesWithoutPerceptualHash(ctx)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"photo.png", "icon.svg"}, names)
+	require.NoError(t, Compute(ctx, images, "deleted.png"))
+}
+
+func TestClusters(t *testing.T) {
+	now := time.Now()
+	image := func(name string, hash uint64, age time.Duration) models.Image {
+		return models.Image{FileName: name, PerceptualHash: FormatHash(hash), Model: gorm.Model{CreatedAt: now.Add(-age)}}
+	}
+	images := []models.Image{
+		image("copy.jpg", 0xff00ff00ff00ff01, time.Minute),
+		image("unique.png", 0x0123456789abcdef, 0),
+		image("original.png", 0xff00ff00ff00ff00, time.Hour),
+		// Similar to copy.jpg but not directly to original.png
+		image("edit.jpg", 0xff00ff00ff00ff0f, 0),
+		image("logo.png", 0x00000000ffffffff, 0),
+		image("logo.webp", 0x00000000ffffffff, 0),
+		{FileName: "pending.png"},
+	}
+
+	clusters := Clusters(images, 0.95)
+	require.Len(t, clusters, 2)
+	names := func(c Cluster) []string {
+		var names []string
+		for _, img := range c.Images {
+			names = append(names, img.FileName)
+		}
+		return names
+	}
+	require.Equal(t, []string{"original.png", "copy.jpg", "edit.jpg"}, names(clusters[0]))
+	require.Equal(t, 1-3.0/64, clusters[0].Similarity)
+	require.Equal(t, []string{"logo.png", "logo.webp"}, names(clusters[1]))
+	require.Equal(t, 1.0, clusters[1].Similarity)
+
+	// A lower threshold links the edit to the original directly
+	clusters = Clusters(images, 0.9)
+	require.Len(t, clusters, 2)
+	require.Equal(t, 1-4.0/64, clusters[0].Similarity)
+	require.Empty(t, Clusters(images[:3], 1))
+}
@@ -0,0 +1,103 @@
+package state
+
+import (
+	"sync"
+	"time"
+)
+
+// expiring is a map whose entries expire. Expired entries are dropped when
+// they are looked up and swept whenever the map has doubled in size.
+type expiring[V any] struct {
+	mu        sync.Mutex
+	entries   map[string]expiringEntry[V]
+	sweepSize int
+}
+
+type expiringEntry[V any] struct {
+	value   V
+	expires time.Time
+}
+
+func newExpiring[V any]() *expiring[V] {
+	return &expiring[V]{entries: map[string]expiringEntry[V]{}, sweepSize: 1024}
+}
+
+// get returns the entry for key. The caller must hold mu.
+func (e *expiring[V]) get(key string, now time.Time) (expiringEntry[V], bool) {
+	entry, ok := e.entries[key]
+	if ok && !now.Before(entry.expires) {
+		delete(e.entries, key)
+		return entry, false
+	}
+	return entry, ok
+}
+
+// set stores value under key until expires. The caller must hold mu.
+func (e *expiring[V]) set(key string, value V, expires time.Time, now time.Time) {
+	e.entries[key] = expiringEntry[V]{value: value, expires: expires}
+	if len(e.entries) >= e.sweepSize {
+		e.sweep(now)
+	}
+}
+
+// sweep drops the expired entries. The caller must hold mu.
+func (e *expiring[V]) sweep(now time.Time) {
+	for k, entry := range e.entries {
+		if !now.Before(entry.expires) {
+			delete(e.entries, k)
+		}
+	}
+	e.sweepSize = max(1024, 2*len(e.entries))
+}
+
+// MemoryRateLimiter is a RateLimiter local to this process.
+type MemoryRateLimiter struct {
+	counts *expiring[int]
+}
+
+func NewMemoryRateLimiter() *MemoryRateLimiter {
+	return &MemoryRateLimiter{counts: newExpiring[int]()}
+}
+
+func (m *MemoryRateLimiter) Allow(key string, limit int, window time.Duration) (bool, time.Duration) {
+	m.counts.mu.Lock()
+	defer m.counts.mu.Unlock()
+
+	now := time.Now()
+	entry, ok := m.counts.get(key, now)
+	if !ok {
+		entry = expiringEntry[int]{expires: now.Add(window)}
+	}
+	entry.value++
+	m.counts.set(key, entry.value, entry.expires, now)
+
+	if entry.value > limit {
+		return false, entry.expires.Sub(now)
+	}
+	return true, 0
+}
+
+// MemoryDenylist is a Denylist local to this process.
+type MemoryDenylist struct {
+	ids *expiring[struct{}]
+}
+
+func NewMemoryDenylist() *MemoryDenylist {
+	return &MemoryDenylist{ids: newExpiring[struct{}]()}
+}
+
+func (m *MemoryDenylist) Add(id string, ttl time.Duration) {
+	m.ids.mu.Lock()
+	defer m.ids.mu.Unlock()
+
+	now := time.Now()
+	m.ids.set(id, struct{}{}, now.Add(ttl), now)
+}
+
+func (m *MemoryDenylist) Contains(id string) bool {
+	m.ids.mu.Lock()
+	defer m.ids.mu.Unlock()
+
+	_, ok := m.ids.get(id, time.Now())
+	return ok
+}
@@ -0,0 +1,41 @@
+package state
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryRateLimiter(t *testing.T) {
+	limiter := NewMemoryRateLimiter()
+
+	for i := 0; i < 3; i++ {
+		allowed, _ := limiter.Allow("login:1.2.3.4", 3, time.Minute)
+		require.True(t, allowed)
+	}
+	allowed, retryAfter := limiter.Allow("login:1.2.3.4", 3, time.Minute)
+	require.False(t, allowed)
+	require.Greater(t, retryAfter, 50*time.Second)
+
+	allowed, _ = limiter.Allow("login:5.6.7.8", 3, time.Minute)
+	require.True(t, allowed)
+
+	// A new window starts once the old one has passed
+	allowed, _ = limiter.Allow("short", 1, time.Millisecond)
+	require.True(t, allowed)
+	time.Sleep(2 * time.Millisecond)
+	allowed, _ = limiter.Allow("short", 1, time.Millisecond)
+	require.True(t, allowed)
+}
+
+func TestMemoryDenylist(t *testing.T) {
+	denylist := NewMemoryDenylist()
+	denylist.Add("a", time.Minute)
+	denylist.Add("b", time.Millisecond)
+	time.Sleep(2 * time.Millisecond)
+
+	require.True(t, denylist.Contains("a"))
+	require.False(t, denylist.Contains("b"))
+	require.False(t, denylist.Contains("c"))
+}
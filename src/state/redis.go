@@ -0,0 +1,87 @@
+package state
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	redisRateLimitPrefix = "gfc:ratelimit:"
+	redisDenylistPrefix  = "gfc:denylist:"
+	redisTimeout         = time.Second
+)
+
+// Redis implements every store on a Redis server shared by all instances.
+// When Redis is unreachable requests are let through rather than failing
+// every request.
+type Redis struct {
+	client *redis.Client
+}
+
+// NewRedis connects to the Redis server at url.
+func NewRedis(url string) (*Redis, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	client := redis.NewClient(opts)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return &Redis{client: client}, nil
+}
+
+func (r *Redis) Allow(key string, limit int, window time.Duration) (bool, time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	key = redisRateLimitPrefix + key
+	count, err := r.client.Incr(ctx, key).Result()
+	if err == nil && count == 1 {
+		err = r.client.PExpire(ctx, key, window).Err()
+	}
+	if err != nil {
+		log.Printf("Failed to count rate limit %s in Redis: %s", key, err.Error())
+		return true, 0
+	}
+
+	if count > int64(limit) {
+		ttl, err := r.client.PTTL(ctx, key).Result()
+		if err != nil || ttl < 0 {
+			// The expiry got lost, e.g. because the server restarted
+			// between INCR and PEXPIRE
+			r.client.PExpire(ctx, key, window)
+			ttl = window
+		}
+		return false, ttl
+	}
+	return true, 0
+}
+
+func (r *Redis) Add(id string, ttl time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	if err := r.client.Set(ctx, redisDenylistPrefix+id, 1, ttl).Err(); err != nil {
+		log.Printf("Failed to add %s to the Redis denylist: %s", id, err.Error())
+	}
+}
+
+func (r *Redis) Contains(id string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	n, err := r.client.Exists(ctx, redisDenylistPrefix+id).Result()
+	if err != nil {
+		log.Printf("Failed to look up %s in the Redis denylist: %s", id, err.Error())
+		return false
+	}
+	return n > 0
+}
@@ -0,0 +1,50 @@
+// Package state holds short-lived state that must be shared by every
+// instance when several of them run behind a load balancer. By default it is
+// kept in memory; setting STATE_REDIS_URL moves it to Redis.
+package state
+
+import (
+	"log"
+	"os"
+	"time"
+)
+
+// RateLimiter counts requests per key in fixed windows.
+type RateLimiter interface {
+	// Allow counts a request for key and reports whether it is within limit
+	// requests per window. If it is not, it also returns the time until the
+	// window resets.
+	Allow(key string, limit int, window time.Duration) (bool, time.Duration)
+}
+
+// Denylist holds revoked identifiers, such as the IDs of access tokens, until
+// they would have expired anyway.
+type Denylist interface {
+	Add(id string, ttl time.Duration)
+	Contains(id string) bool
+}
+
+// The stores used by the application. Start replaces them with shared ones
+// when Redis is configured.
+var (
+	Limiter RateLimiter = NewMemoryRateLimiter()
+	Denied  Denylist    = NewMemoryDenylist()
+)
+
+// Start moves the shared state to the Redis server in STATE_REDIS_URL, e.g.
+// redis://:password@localhost:6379/0. It does nothing when the variable is
+// unset.
+func Start() error {
+	url := os.Getenv("STATE_REDIS_URL")
+	if url == "" {
+		return nil
+	}
+
+	r, err := NewRedis(url)
+	if err != nil {
+		return err
+	}
+	Limiter, Denied = r, r
+	log.Printf("Sharing rate limits and revoked tokens through Redis")
+	return nil
+}
@@ -0,0 +1,234 @@
+// Package usage keeps running totals of the bytes stored per media folder and
+// organization, so storage usage can be read without walking the uploads
+// folder. Uploads and deletions update the totals as they happen, and a
+// periodic reconciliation against the disk corrects any drift, e.g. from
+// files changed outside the application.
+package usage
+
+import (
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"gorm.io/gorm"
+)
+
+const defaultReconcileInterval = time.Hour
+
+// NoOrganization is the key of files without an owning organization in
+// Usage.Organizations.
+const NoOrganization = "none"
+
+type key struct {
+	folder string
+	org    uint
+}
+
+// Gauge holds the byte totals.
+type Gauge struct {
+	mu           sync.Mutex
+	bytes        map[key]int64
+	reconciledAt *time.Time
+	drift        int64
+}
+
+func NewGauge() *Gauge {
+	return &Gauge{bytes: map[key]int64{}}
+}
+
+var gauge = NewGauge()
+
+// Usage is a snapshot of the totals.
+type Usage struct {
+	TotalBytes int64 `json:"total_bytes"`
+	// Folders maps the uploads folders (images, docs) to their size.
+	Folders map[string]int64 `json:"folders"`
+	// Organizations maps organization IDs, or NoOrganization, to the size of
+	// their files.
+	Organizations map[string]int64 `json:"organizations"`
+	ReconciledAt  *time.Time       `json:"reconciled_at"`
+	// LastDrift is the difference between the totals and the disk found by
+	// the last reconciliation.
+	LastDrift int64 `json:"last_drift_bytes"`
+}
+
+func orgKey(orgID *uint) uint {
+	if orgID == nil {
+		return 0
+	}
+	return *orgID
+}
+
+// Add changes the total of the folder of mediaType and the organization by
+// delta bytes.
+func (g *Gauge) Add(mediaType string, orgID *uint, delta int64) {
+	if delta == 0 {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.bytes[key{models.MediaFolder(mediaType), orgKey(orgID)}] += delta
+}
+
+// Snapshot returns the current totals.
+func (g *Gauge) Snapshot() Usage {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	u := Usage{
+		Folders:       map[string]int64{},
+		Organizations: map[string]int64{},
+		ReconciledAt:  g.reconciledAt,
+		LastDrift:     g.drift,
+	}
+	for k, bytes := range g.bytes {
+		u.TotalBytes += bytes
+		u.Folders[k.folder] += bytes
+		org := NoOrganization
+		if k.org != 0 {
+			org = strconv.FormatUint(uint64(k.org), 10)
+		}
+		u.Organizations[org] += bytes
+	}
+	return u
+}
+
+// OrganizationBytes returns the size of the files of an organization, or of
+// the files without one for nil.
+func (g *Gauge) OrganizationBytes(orgID *uint) int64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var total int64
+	for k, bytes := range g.bytes {
+		if k.org == orgKey(orgID) {
+			total += bytes
+		}
+	}
+	return total
+}
+
+// Reconcile replaces the totals with the sizes of the files in uploadsDir,
+// attributing them to organizations using the media records in db.
+func (g *Gauge) Reconcile(db *gorm.DB, uploadsDir string) error {
+	// owners maps folder/file name to the owning organization
+	owners := map[string]uint{}
+	for _, folder := range []string{"images", "docs"} {
+		var rows []struct {
+			FileName       string
+			OrganizationID uint
+		}
+		err := db.Table(folder).Select("file_name, organization_id").Where("deleted_at IS NULL AND organization_id IS NOT NULL").Scan(&rows).Error
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			owners[folder+"/"+row.FileName] = row.OrganizationID
+		}
+	}
+
+	totals := map[key]int64{}
+	for _, folder := range []string{"images", "docs"} {
+		entries, err := os.ReadDir(filepath.Join(uploadsDir, folder))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		for _, entry := range entries {
+			if !entry.Type().IsRegular() {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			totals[key{folder, owners[folder+"/"+entry.Name()]}] += info.Size()
+		}
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var before, after int64
+	for _, bytes := range g.bytes {
+		before += bytes
+	}
+	for _, bytes := range totals {
+		after += bytes
+	}
+	now := time.Now()
+	g.bytes = totals
+	g.reconciledAt = &now
+	g.drift = after - before
+	return nil
+}
+
+// Add changes the totals, see Gauge.Add.
+func Add(mediaType string, orgID *uint, delta int64) {
+	gauge.Add(mediaType, orgID, delta)
+}
+
+// Snapshot returns the current totals.
+func Snapshot() Usage {
+	return gauge.Snapshot()
+}
+
+// OrganizationBytes returns the size of the files of an organization, see
+// Gauge.OrganizationBytes.
+func OrganizationBytes(orgID *uint) int64 {
+	return gauge.OrganizationBytes(orgID)
+}
+
+// Track runs change, e.g. saving, resizing or deleting the file, and adds the
+// resulting change in the size of the file to the totals.
+func Track(mediaType string, orgID *uint, fileName string, change func() error) error {
+	path := filepath.Join(util.ExPath, "uploads", models.MediaFolder(mediaType), fileName)
+	before := fileSize(path)
+	err := change()
+	Add(mediaType, orgID, fileSize(path)-before)
+	return err
+}
+
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// Start computes the totals and reconciles them with the disk every
+// USAGE_RECONCILE_INTERVAL seconds, an hour by default.
+func Start(db *gorm.DB) error {
+	uploadsDir := filepath.Join(util.ExPath, "uploads")
+	if err := gauge.Reconcile(db, uploadsDir); err != nil {
+		return err
+	}
+
+	interval := defaultReconcileInterval
+	if val := os.Getenv("USAGE_RECONCILE_INTERVAL"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil && parsed > 0 {
+			interval = time.Duration(parsed) * time.Second
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := gauge.Reconcile(db, uploadsDir); err != nil {
+				log.Printf("Failed to reconcile storage usage: %s", err.Error())
+				continue
+			}
+			if drift := gauge.Snapshot().LastDrift; drift != 0 {
+				log.Printf("Storage usage was off by %d bytes", drift)
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,62 @@
+package usage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGauge_Reconcile(t *testing.T) {
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	uploadsDir := filepath.Join(util.ExPath, "uploads")
+	for _, folder := range []string{"images", "docs"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(uploadsDir, folder), 0o755))
+	}
+
+	orgID := uint(7)
+	require.NoError(t, database.DB.Create(&models.Image{FileName: "owned.png", Checksum: []byte("a"), OrganizationID: &orgID}).Error)
+	require.NoError(t, os.WriteFile(filepath.Join(uploadsDir, "images", "owned.png"), make([]byte, 100), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(uploadsDir, "docs", "loose.txt"), make([]byte, 10), 0o644))
+
+	g := NewGauge()
+	g.Add(models.MediaTypeDoc, nil, 3)
+	require.NoError(t, g.Reconcile(database.DB, uploadsDir))
+
+	u := g.Snapshot()
+	require.Equal(t, int64(110), u.TotalBytes)
+	require.Equal(t, map[string]int64{"images": 100, "docs": 10}, u.Folders)
+	require.Equal(t, map[string]int64{"7": 100, NoOrganization: 10}, u.Organizations)
+	require.Equal(t, int64(107), u.LastDrift)
+	require.NotNil(t, u.ReconciledAt)
+	require.Equal(t, int64(100), g.OrganizationBytes(&orgID))
+	require.Equal(t, int64(10), g.OrganizationBytes(nil))
+}
+
+func TestTrack(t *testing.T) {
+	util.ExPath = t.TempDir()
+	gauge = NewGauge()
+	require.NoError(t, os.MkdirAll(filepath.Join(util.ExPath, "uploads", "docs"), 0o755))
+	path := filepath.Join(util.ExPath, "uploads", "docs", "a.txt")
+	orgID := uint(1)
+
+	require.NoError(t, Track(models.MediaTypeDoc, &orgID, "a.txt", func() error {
+		return os.WriteFile(path, make([]byte, 50), 0o644)
+	}))
+	require.Equal(t, int64(50), OrganizationBytes(&orgID))
+
+	require.NoError(t, Track(models.MediaTypeDoc, &orgID, "a.txt", func() error {
+		return os.WriteFile(path, make([]byte, 20), 0o644)
+	}))
+	require.Equal(t, int64(20), OrganizationBytes(&orgID))
+
+	require.NoError(t, Track(models.MediaTypeDoc, &orgID, "a.txt", func() error {
+		return os.Remove(path)
+	}))
+	require.Zero(t, Snapshot().TotalBytes)
+}
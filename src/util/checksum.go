@@ -0,0 +1,69 @@
+package util
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+)
+
+// checksumHeaderSize is the number of bytes covered by MD5 checksums
+const checksumHeaderSize = 512
+
+// ChecksumAlgorithm returns the algorithm checksums of new files are computed
+// with: CHECKSUM_ALGORITHM, or models.ChecksumMD5 when unset or invalid.
+func ChecksumAlgorithm() string {
+	algorithm := os.Getenv("CHECKSUM_ALGORITHM")
+	if algorithm == "" || ValidateChecksumAlgorithm(algorithm) != nil {
+		return models.ChecksumMD5
+	}
+	return algorithm
+}
+
+// ValidateChecksumAlgorithm returns an error for unknown algorithms. An
+// empty algorithm selects the default.
+func ValidateChecksumAlgorithm(algorithm string) error {
+	switch algorithm {
+	case "", models.ChecksumMD5, models.ChecksumSHA256:
+		return nil
+	default:
+		return fmt.Errorf("unknown checksum algorithm %q", algorithm)
+	}
+}
+
+// Checksum computes the checksum of the content read from r. MD5 checksums
+// cover the first 512 bytes, zero-padded, and only serve duplicate
+// detection; SHA-256 checksums cover the whole content.
+func Checksum(algorithm string, r io.Reader) ([]byte, error) {
+	switch algorithm {
+	case models.ChecksumMD5:
+		header := make([]byte, checksumHeaderSize)
+		if _, err := io.ReadFull(r, header); err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, err
+		}
+		sum := md5.Sum(header)
+		return sum[:], nil
+	case models.ChecksumSHA256:
+		hash := sha256.New()
+		if _, err := io.Copy(hash, r); err != nil {
+			return nil, err
+		}
+		return hash.Sum(nil), nil
+	default:
+		return nil, fmt.Errorf("unknown checksum algorithm %q", algorithm)
+	}
+}
+
+// FileChecksum computes the checksum of the file at path, see Checksum.
+func FileChecksum(algorithm, path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Checksum(algorithm, f)
+}
@@ -0,0 +1,95 @@
+package util
+
+import (
+	"path"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// maxDownloadName is the length in bytes download names are cut to.
+const maxDownloadName = 255
+
+// DownloadName cleans a name given for downloads of a file. It keeps the last
+// element of a path separated by slashes or backslashes, drops control
+// characters and quotes, and returns an empty string if nothing is left.
+func DownloadName(name string) string {
+	name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '"' || r == utf8.RuneError {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.Trim(name, " .")
+	if name == "/" {
+		return ""
+	}
+	for len(name) > maxDownloadName {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	return name
+}
+
+// DefaultDownloadName returns the name downloads of the file fileName get
+// unless the request names them: its download name if set, or else the name
+// it was uploaded with.
+func DefaultDownloadName(fileName, downloadName, originalName string) string {
+	if downloadName != "" {
+		return downloadName
+	}
+	if name := DownloadName(originalName); name != "" {
+		return name
+	}
+	return fileName
+}
+
+// ContentDisposition formats a Content-Disposition header presenting a file
+// as name. Names that are not plain ASCII are given both as an ASCII filename
+// for old clients and as the RFC 5987 encoded filename*.
+func ContentDisposition(disposition, name string) string {
+	fallback := asciiName(name)
+	header := disposition + `; filename="` + fallback + `"`
+	if fallback != name {
+		header += "; filename*=UTF-8''" + encodeRFC5987(name)
+	}
+	return header
+}
+
+// asciiName strips accents from name and replaces the remaining characters
+// that are not printable ASCII with underscores.
+func asciiName(name string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(name) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			continue
+		case r < 0x20 || r > 0x7e || r == '"' || r == '\\':
+			b.WriteByte('_')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// encodeRFC5987 percent-encodes every byte of s except the attr-chars of RFC
+// 5987.
+func encodeRFC5987(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("!#$&+-.^_`|~", c) >= 0 {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hex[c>>4])
+		b.WriteByte(hex[c&0xf])
+	}
+	return b.String()
+}
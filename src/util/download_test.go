@@ -0,0 +1,23 @@
+package util
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadName(t *testing.T) {
+	require.Equal(t, "report.pdf", DownloadName(`..\..\report.pdf`))
+	require.Equal(t, "report.pdf", DownloadName("/etc/\"report\x00.pdf\""))
+	require.Empty(t, DownloadName("../"))
+	require.Empty(t, DownloadName(" . "))
+	require.Len(t, DownloadName(strings.Repeat("é", 200)), 254)
+}
+
+func TestContentDisposition(t *testing.T) {
+	require.Equal(t, `attachment; filename="report.pdf"`, ContentDisposition("attachment", "report.pdf"))
+	require.Equal(t, `inline; filename="Cafe _.png"; filename*=UTF-8''Caf%C3%A9%20%E2%98%95.png`, ContentDisposition("inline", "Café ☕.png"))
+	require.Equal(t, "report.pdf", DefaultDownloadName("3f2a.pdf", "", "report.pdf"))
+	require.Equal(t, "3f2a.pdf", DefaultDownloadName("3f2a.pdf", "", ""))
+}
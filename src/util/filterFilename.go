@@ -25,6 +25,7 @@ func countVal(str string, val string) int {
 // FilterFilename removes illegal characters from a filename string.
 // It ensures there is at most one period in the filename,
 // replaces any '/' and '\' characters,
+// rejects names reserved by the server (see ErrReservedName)
 // and returns the filtered string.
 func FilterFilename(filename string) (string, error) {
 	if countVal(filename, ".") > 1 {
@@ -36,5 +37,9 @@ func FilterFilename(filename string) (string, error) {
 	filteredStr = strings.Replace(filename, "/", "", -1)
 	filteredStr = strings.Replace(filteredStr, `\`, "", -1)
 
+	if err := checkReserved(filename, filteredStr); err != nil {
+		return filename, err
+	}
+
 	return filteredStr, nil
 }
@@ -12,6 +12,12 @@ func TestFilterFilename(t *testing.T) {
 		{"file/with/slashes.txt", "filewithslashes.txt", false},
 		{"file\\with\\backslashes.txt", "filewithbackslashes.txt", false},
 		{"file/with/more/than/one.period.txt", "file/with/more/than/one.period.txt", true},
+		{"thumb.png", "thumb.png", false},
+		{"All", "All", true},
+		{".trash", ".trash", true},
+		{"thumb/photo.png", "thumb/photo.png", true},
+		{`API\photo.png`, `API\photo.png`, true},
+		{"/.trash/photo.png", "/.trash/photo.png", true},
 	}
 
 	for _, tc := range testCases {
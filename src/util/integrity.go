@@ -0,0 +1,51 @@
+package util
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+type integrityEntry struct {
+	modTime time.Time
+	size    int64
+	hash    string
+}
+
+// integrityCache holds the hashes of files that have not changed since they
+// were hashed, keyed by path.
+var integrityCache sync.Map
+
+// Integrity returns the subresource integrity value of the file at path, e.g.
+// "sha384-oqVuAfXRKap7fdgcCY5uykM6+R9GqQ8K/uxy9rx7HNQlGYl1kPzQho1wx4JwY8wC".
+// Hashes are cached until the file's size or modification time changes.
+func Integrity(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if cached, ok := integrityCache.Load(path); ok {
+		entry := cached.(integrityEntry)
+		if entry.modTime.Equal(info.ModTime()) && entry.size == info.Size() {
+			return entry.hash, nil
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha512.New384()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	integrity := "sha384-" + base64.StdEncoding.EncodeToString(hash.Sum(nil))
+
+	integrityCache.Store(path, integrityEntry{modTime: info.ModTime(), size: info.Size(), hash: integrity})
+	return integrity, nil
+}
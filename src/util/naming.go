@@ -0,0 +1,92 @@
+package util
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/google/uuid"
+	"golang.org/x/text/unicode/norm"
+)
+
+// File naming strategies of uploads, see NamingStrategy.
+const (
+	// NamingOriginal keeps the name the file was uploaded with.
+	NamingOriginal = "original"
+	// NamingUUID names files with a random UUID.
+	NamingUUID = "uuid"
+	// NamingContentHash names files with the hex encoded checksum of their
+	// content.
+	NamingContentHash = "content-hash"
+	// NamingSlug names files with a lowercase ASCII version of their name.
+	NamingSlug = "slug"
+)
+
+// NamingStrategy returns the strategy uploaded files are named with:
+// FILE_NAMING_STRATEGY, or NamingOriginal when unset or invalid.
+func NamingStrategy() string {
+	strategy := os.Getenv("FILE_NAMING_STRATEGY")
+	if strategy == "" || ValidateNamingStrategy(strategy) != nil {
+		return NamingOriginal
+	}
+	return strategy
+}
+
+// ValidateNamingStrategy returns an error for unknown strategies. An empty
+// strategy selects the default.
+func ValidateNamingStrategy(strategy string) error {
+	switch strategy {
+	case "", NamingOriginal, NamingUUID, NamingContentHash, NamingSlug:
+		return nil
+	default:
+		return fmt.Errorf("unknown file naming strategy %q", strategy)
+	}
+}
+
+// StoredName returns the name a file uploaded as name with the given
+// checksum is stored under with strategy. Generated names keep the extension
+// of name in lowercase.
+func StoredName(strategy, name string, checksum []byte) string {
+	ext := filepath.Ext(name)
+	switch strategy {
+	case NamingUUID:
+		return uuid.NewString() + strings.ToLower(ext)
+	case NamingContentHash:
+		return hex.EncodeToString(checksum) + strings.ToLower(ext)
+	case NamingSlug:
+		return Slugify(strings.TrimSuffix(name, ext)) + strings.ToLower(ext)
+	default:
+		return name
+	}
+}
+
+// Slugify lowercases s, strips accents from letters and replaces every run
+// of other characters than ASCII letters and digits with a hyphen, e.g.
+// "Café Menü (2)" becomes "cafe-menu-2". It returns "file" if nothing is
+// left.
+func Slugify(s string) string {
+	var slug strings.Builder
+	hyphen := false
+	for _, r := range norm.NFD.String(s) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// Accents split from their letter by the decomposition
+			continue
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			if hyphen && slug.Len() > 0 {
+				slug.WriteByte('-')
+			}
+			hyphen = false
+			slug.WriteRune(unicode.ToLower(r))
+		default:
+			hyphen = true
+		}
+	}
+	if slug.Len() == 0 {
+		return "file"
+	}
+	return slug.String()
+}
@@ -0,0 +1,28 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoredName(t *testing.T) {
+	checksum := []byte{0xca, 0xfe}
+
+	require.Equal(t, "Café Menü.PNG", StoredName(NamingOriginal, "Café Menü.PNG", checksum))
+	require.Equal(t, "cafe.png", StoredName(NamingContentHash, "Café Menü.PNG", checksum))
+	require.Equal(t, "cafe-menu.png", StoredName(NamingSlug, "Café Menü.PNG", checksum))
+	require.Regexp(t, `^[0-9a-f-]{36}\.png$`, StoredName(NamingUUID, "Café Menü.PNG", checksum))
+
+	require.Equal(t, "my-photo-v2", Slugify("  My.Photo (v2) "))
+	require.Equal(t, "file", Slugify("日本"))
+}
+
+func TestNamingStrategy(t *testing.T) {
+	t.Setenv("FILE_NAMING_STRATEGY", NamingSlug)
+	require.Equal(t, NamingSlug, NamingStrategy())
+
+	t.Setenv("FILE_NAMING_STRATEGY", "random")
+	require.Equal(t, NamingOriginal, NamingStrategy())
+	require.Error(t, ValidateNamingStrategy("random"))
+}
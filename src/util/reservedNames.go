@@ -0,0 +1,45 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrReservedName is returned by FilterFilename for names that would collide
+// with the routes of the API or the folders and prefixes used for derived
+// files.
+var ErrReservedName = errors.New("filename is reserved")
+
+// reservedNames are compared case-insensitively against the whole filename
+// and against the first folder of a filename containing slashes.
+var reservedNames = map[string]bool{
+	"all":      true,
+	"api":      true,
+	"admin":    true,
+	"cache":    true,
+	"download": true,
+	"s":        true,
+	"thumb":    true,
+	"thumbs":   true,
+	"trash":    true,
+	"upload":   true,
+	"variants": true,
+}
+
+// checkReserved returns ErrReservedName if filename, before or after removing
+// slashes, is a reserved name, starts with a reserved folder or is hidden.
+func checkReserved(filename, filtered string) error {
+	if strings.HasPrefix(filtered, ".") {
+		return fmt.Errorf("%w: %q cannot start with a period", ErrReservedName, filtered)
+	}
+	if reservedNames[strings.ToLower(filtered)] {
+		return fmt.Errorf("%w: %q is used by the server", ErrReservedName, filtered)
+	}
+
+	first, _, nested := strings.Cut(strings.ReplaceAll(filename, `\`, "/"), "/")
+	if nested && (reservedNames[strings.ToLower(first)] || strings.HasPrefix(first, ".")) {
+		return fmt.Errorf("%w: %q cannot start with the folder %q", ErrReservedName, filename, first+"/")
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package util
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ZipEntry is a file added to an archive by WriteZip.
+type ZipEntry struct {
+	// Name is the file name inside the archive.
+	Name string
+	Path string
+}
+
+// WriteZip streams the files into a zip archive written to w without
+// buffering it. Names that occur more than once get a numeric suffix.
+func WriteZip(w io.Writer, entries []ZipEntry) error {
+	zw := zip.NewWriter(w)
+	used := map[string]bool{}
+
+	for _, entry := range entries {
+		name := uniqueName(entry.Name, used)
+		if err := addZipFile(zw, entry.Path, name); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+func addZipFile(zw *zip.Writer, path, name string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = zip.Deflate
+
+	dst, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, f)
+	return err
+}
+
+// uniqueName returns name, or name with a " (n)" suffix before the extension
+// if it was used before.
+func uniqueName(name string, used map[string]bool) string {
+	candidate := name
+	ext := filepath.Ext(name)
+	for i := 1; used[strings.ToLower(candidate)]; i++ {
+		candidate = fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), i, ext)
+	}
+	used[strings.ToLower(candidate)] = true
+	return candidate
+}
@@ -0,0 +1,96 @@
+package validations
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/kevinanielsen/go-fast-cdn/src/imaging"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+)
+
+// init sets up the validator gin binds requests with: errors name fields as
+// they appear in requests, and binding tags can use the rules below.
+func init() {
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		Register(v)
+	}
+}
+
+// Register adds the rules of the binding structs to v:
+//
+//   - filename: a file name util.FilterFilename accepts
+//   - gravity: empty or a crop gravity, see imaging.ValidGravity
+//   - origin: "*" or a scheme://host[:port] origin
+//   - token: an HTTP token, e.g. a method or header name, ignoring
+//     surrounding spaces
+func Register(v *validator.Validate) {
+	v.RegisterTagNameFunc(requestName)
+	v.RegisterValidation("filename", func(fl validator.FieldLevel) bool {
+		_, err := util.FilterFilename(fl.Field().String())
+		return err == nil
+	})
+	v.RegisterValidation("gravity", func(fl validator.FieldLevel) bool {
+		return imaging.ValidGravity(fl.Field().String())
+	})
+	v.RegisterValidation("origin", func(fl validator.FieldLevel) bool {
+		return validOrigin(fl.Field().String())
+	})
+	v.RegisterValidation("token", func(fl validator.FieldLevel) bool {
+		return validToken(strings.TrimSpace(fl.Field().String()))
+	})
+}
+
+func validOrigin(origin string) bool {
+	if origin == "*" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Scheme != "" && u.Host != "" && u.Path == "" && u.RawQuery == "" && u.User == nil
+}
+
+func validToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r > unicode.MaxASCII || !(unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("!#$%&'*+-.^_`|~", r)) {
+			return false
+		}
+	}
+	return true
+}
+
+// names maps the names of struct fields to their names in requests, to
+// describe rules referring to other fields, e.g. nefield.
+var names sync.Map
+
+// requestName returns the name of a field in JSON bodies or forms.
+func requestName(field reflect.StructField) string {
+	name := field.Name
+	for _, key := range []string{"json", "form"} {
+		tagged, _, _ := strings.Cut(field.Tag.Get(key), ",")
+		if tagged == "-" {
+			return ""
+		}
+		if tagged != "" {
+			name = tagged
+			break
+		}
+	}
+	names.Store(field.Name, name)
+	return name
+}
+
+// RequestName returns the name in requests of a field of a validated struct,
+// e.g. "user_id" for UserID.
+func RequestName(fieldName string) string {
+	if name, ok := names.Load(fieldName); ok {
+		return name.(string)
+	}
+	return strings.ToLower(fieldName)
+}
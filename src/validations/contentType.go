@@ -0,0 +1,109 @@
+package validations
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+)
+
+// allowedMimeTypes lists the content types, as detected from the first 512
+// bytes of a file, accepted for each media type.
+var allowedMimeTypes = map[string]map[string]bool{
+	models.MediaTypeImage: {
+		"image/jpeg": true,
+		"image/jpg":  true,
+		"image/png":  true,
+		"image/gif":  true,
+		"image/webp": true,
+		"image/bmp":  true,
+	},
+	models.MediaTypeDoc: {
+		"text/plain":                true,
+		"text/plain; charset=utf-8": true,
+		"application/msword":        true,
+		"application/vnd.openxmlformats-officedocument.wordprocessingml.document":   true,
+		"application/vnd.openxmlformats-officedocument.presentationml.presentation": true,
+		"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         true,
+		"application/pdf":       true,
+		"application/rtf":       true,
+		"application/x-freearc": true,
+		"application/zip":       true,
+	},
+}
+
+// ValidateContentType detects the content type of the file fileName from
+// header, its first 512 bytes, and returns an error if it is not accepted
+// for mediaType. Besides the allowed types, files are accepted whose
+// extension is registered for mediaType, see LoadMimeTypeRules.
+func ValidateContentType(mediaType, fileName string, header []byte) error {
+	fileType := http.DetectContentType(header)
+	if allowedMimeTypes[mediaType][fileType] {
+		return nil
+	}
+	if rule, ok := LookupMimeTypeRule(fileName); ok && rule.MediaType == mediaType && ruleMatches(rule, fileType) {
+		return nil
+	}
+	return fmt.Errorf("Invalid file type: %s", fileType)
+}
+
+// extensionMimeTypes lists the content types of extensions whose files
+// cannot be told apart by their first bytes, e.g. office documents, which are
+// zip or OLE containers, and text formats.
+var extensionMimeTypes = map[string]string{
+	".doc":  "application/msword",
+	".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".xls":  "application/vnd.ms-excel",
+	".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".ppt":  "application/vnd.ms-powerpoint",
+	".pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	".odt":  "application/vnd.oasis.opendocument.text",
+	".ods":  "application/vnd.oasis.opendocument.spreadsheet",
+	".odp":  "application/vnd.oasis.opendocument.presentation",
+	".csv":  "text/csv",
+	".md":   "text/markdown",
+	".json": "application/json",
+	".svg":  "image/svg+xml",
+}
+
+// DetectMimeType returns the content type of the file fileName starting with
+// header, its first 512 bytes. The type is sniffed from the content and only
+// refined by the extension where the content is ambiguous, preferring the
+// type registered for the extension. Text types always carry a charset when
+// the content is valid UTF-8.
+func DetectMimeType(fileName string, header []byte) string {
+	sniffed := http.DetectContentType(header)
+	mediaType, params, err := mime.ParseMediaType(sniffed)
+	if err != nil {
+		return sniffed
+	}
+
+	if rule, ok := LookupMimeTypeRule(fileName); ok && ruleMatches(rule, sniffed) {
+		mediaType = rule.MimeType
+	} else if byExtension, ok := extensionMimeTypes[strings.ToLower(filepath.Ext(fileName))]; ok {
+		switch {
+		case mediaType == "application/octet-stream", mediaType == "application/zip":
+			mediaType = byExtension
+		case mediaType == "text/plain" && strings.HasPrefix(byExtension, "text/"):
+			mediaType = byExtension
+		}
+	}
+
+	if strings.HasPrefix(mediaType, "text/") && params["charset"] == "" && validUTF8Prefix(header) {
+		params["charset"] = "utf-8"
+	}
+	return mime.FormatMediaType(mediaType, params)
+}
+
+// validUTF8Prefix reports whether b is valid UTF-8, ignoring a rune cut off
+// at its end.
+func validUTF8Prefix(b []byte) bool {
+	for i := 0; i < utf8.UTFMax && len(b) > 0 && !utf8.Valid(b); i++ {
+		b = b[:len(b)-1]
+	}
+	return utf8.Valid(b)
+}
@@ -0,0 +1,111 @@
+package validations
+
+import (
+	"context"
+	"errors"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+)
+
+// mimeTypeRules holds the extensions registered by admins, keyed by
+// extension. It is nil until LoadMimeTypeRules is called.
+var mimeTypeRules atomic.Pointer[map[string]models.MimeTypeRule]
+
+// LoadMimeTypeRules reads the extensions registered in repo, which apply to
+// uploads and downloads from then on. It is called again after every change
+// of the rules.
+func LoadMimeTypeRules(ctx context.Context, repo models.MimeTypeRuleRepository) error {
+	list, err := repo.GetAllMimeTypeRules(ctx)
+	if err != nil {
+		return err
+	}
+	rules := make(map[string]models.MimeTypeRule, len(list))
+	for _, rule := range list {
+		rules[rule.Extension] = rule
+	}
+	mimeTypeRules.Store(&rules)
+	return nil
+}
+
+// LookupMimeTypeRule returns the rule registered for the extension of
+// fileName.
+func LookupMimeTypeRule(fileName string) (models.MimeTypeRule, bool) {
+	rules := mimeTypeRules.Load()
+	if rules == nil {
+		return models.MimeTypeRule{}, false
+	}
+	rule, ok := (*rules)[strings.ToLower(filepath.Ext(fileName))]
+	return rule, ok
+}
+
+// ambiguousMimeTypes are sniffed from content the sniffer does not know,
+// e.g. 3D models, and from XML or text formats. Files with a registered
+// extension are accepted with these types or the registered one.
+var ambiguousMimeTypes = map[string]bool{
+	"application/octet-stream": true,
+	"application/zip":          true,
+	"text/plain":               true,
+	"text/xml":                 true,
+}
+
+// ruleMatches reports whether the sniffed content type fits rule.
+func ruleMatches(rule models.MimeTypeRule, sniffed string) bool {
+	mediaType, _, err := mime.ParseMediaType(sniffed)
+	if err != nil {
+		return false
+	}
+	return mediaType == rule.MimeType || ambiguousMimeTypes[mediaType]
+}
+
+// sanitizers remove active content from files of a content type.
+var sanitizers = map[string]func([]byte) ([]byte, error){
+	"image/svg+xml": SanitizeSVG,
+}
+
+// CanSanitize reports whether files of mimeType can be sanitized.
+func CanSanitize(mimeType string) bool {
+	return sanitizers[mimeType] != nil
+}
+
+// RequiresSanitizing reports whether the rule of the extension of fileName
+// requires sanitizing uploads.
+func RequiresSanitizing(fileName string) bool {
+	rule, ok := LookupMimeTypeRule(fileName)
+	return ok && rule.Sanitize
+}
+
+// Sanitize returns data, the content of the file fileName, without active
+// content if the rule of its extension requires it.
+func Sanitize(fileName string, data []byte) ([]byte, error) {
+	rule, ok := LookupMimeTypeRule(fileName)
+	if !ok || !rule.Sanitize {
+		return data, nil
+	}
+	sanitize := sanitizers[rule.MimeType]
+	if sanitize == nil {
+		return nil, errors.New("files of type " + rule.MimeType + " cannot be sanitized")
+	}
+	return sanitize(data)
+}
+
+// SanitizeFile sanitizes the file at path in place if the rule of the
+// extension of fileName requires it.
+func SanitizeFile(fileName, path string) error {
+	if !RequiresSanitizing(fileName) {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	sanitized, err := Sanitize(fileName, data)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, sanitized, 0o644)
+}
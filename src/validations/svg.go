@@ -0,0 +1,114 @@
+package validations
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+)
+
+// svgRemovedElements are removed from SVG images along with their content,
+// as they run scripts or embed other documents.
+var svgRemovedElements = map[string]bool{
+	"script":        true,
+	"foreignobject": true,
+	"iframe":        true,
+	"embed":         true,
+	"object":        true,
+	"handler":       true,
+	"listener":      true,
+}
+
+// SanitizeSVG returns the SVG image data without scripts, event handler
+// attributes, javascript: links, comments, processing instructions and
+// doctypes, which could declare entities. It fails if data is not an SVG
+// image.
+func SanitizeSVG(data []byte) ([]byte, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	var out bytes.Buffer
+	root := true
+	skip := 0
+	for {
+		token, err := dec.RawToken()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if skip > 0 || svgRemovedElements[strings.ToLower(t.Name.Local)] {
+				skip++
+				continue
+			}
+			if root && t.Name.Local != "svg" {
+				return nil, errors.New("not an SVG image")
+			}
+			root = false
+			out.WriteString("<" + qualifiedName(t.Name))
+			for _, attr := range t.Attr {
+				if !svgAttrAllowed(attr) {
+					continue
+				}
+				out.WriteString(" " + qualifiedName(attr.Name) + `="`)
+				xml.EscapeText(&out, []byte(attr.Value))
+				out.WriteString(`"`)
+			}
+			out.WriteString(">")
+		case xml.EndElement:
+			if skip > 0 {
+				skip--
+				continue
+			}
+			out.WriteString("</" + qualifiedName(t.Name) + ">")
+		case xml.CharData:
+			if skip == 0 {
+				xml.EscapeText(&out, t)
+			}
+		case xml.ProcInst:
+			if t.Target == "xml" && root {
+				out.WriteString("<?xml " + string(t.Inst) + "?>")
+			}
+		}
+	}
+	if root {
+		return nil, errors.New("not an SVG image")
+	}
+	return out.Bytes(), nil
+}
+
+func qualifiedName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
+
+// svgAttrAllowed reports whether attr is free of scripts: it is not an
+// event handler, does not link to a javascript: or non-image data: URL and
+// does not animate such attributes.
+func svgAttrAllowed(attr xml.Attr) bool {
+	name := strings.ToLower(attr.Name.Local)
+	if strings.HasPrefix(name, "on") {
+		return false
+	}
+	// Browsers ignore whitespace and control characters in URL schemes
+	value := strings.Map(func(r rune) rune {
+		if r <= ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(attr.Value))
+	if strings.Contains(value, "javascript:") || strings.Contains(value, "vbscript:") {
+		return false
+	}
+	switch name {
+	case "href":
+		return !strings.HasPrefix(value, "data:") || strings.HasPrefix(value, "data:image/") && !strings.HasPrefix(value, "data:image/svg")
+	case "attributename":
+		return !strings.HasPrefix(value, "on") && !strings.HasSuffix(value, "href")
+	}
+	return true
+}
@@ -0,0 +1,397 @@
+// Package watermark composites the watermark image uploaded by admins onto
+// image downloads. Watermarked images are cached on disk and regenerated
+// when the image, the watermark or its settings change.
+package watermark
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/anthonynsimon/bild/imgio"
+	"github.com/anthonynsimon/bild/transform"
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/imaging"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/problem"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"gorm.io/gorm"
+)
+
+const imageName = "watermark.png"
+
+// ErrNoImage is returned when deleting the watermark image while none is
+// uploaded.
+var ErrNoImage = errors.New("no watermark image uploaded")
+
+// Default watermarks the images served outside of the image downloads, such
+// as transforms, share links, archives and WebDAV. It is set by the router.
+var Default *Watermarker
+
+// Watermarker applies the watermark settings stored in the config table.
+// Like the CORS policy, the settings are cached and replaced by Update.
+type Watermarker struct {
+	repo   *database.ConfigRepo
+	images models.ImageRepository
+	// dir holds the watermark image.
+	dir      string
+	cacheDir string
+
+	settings atomic.Pointer[models.WatermarkSettings]
+
+	markMu sync.RWMutex
+	mark   image.Image
+	// markVersion is when the watermark image was uploaded.
+	markVersion int64
+
+	// mu serializes the generation of watermarked images so a burst of
+	// requests for an uncached file is only processed once.
+	mu sync.Mutex
+}
+
+// New loads the watermark settings from repo and the watermark image from
+// the data folder. images provides the organizations of images.
+func New(repo *database.ConfigRepo, images models.ImageRepository) *Watermarker {
+	w := &Watermarker{
+		repo:     repo,
+		images:   images,
+		dir:      filepath.Join(util.ExPath, "watermark"),
+		cacheDir: filepath.Join(util.ExPath, "cache", "watermarks"),
+	}
+	settings := repo.GetWatermarkSettings()
+	w.settings.Store(&settings)
+
+	markPath := filepath.Join(w.dir, imageName)
+	if info, err := os.Stat(markPath); err == nil {
+		if mark, err := imgio.Open(markPath); err == nil {
+			w.mark, w.markVersion = mark, info.ModTime().UnixNano()
+		} else {
+			log.Printf("Failed to load the watermark image: %s", err.Error())
+		}
+	}
+	return w
+}
+
+// Settings returns the settings currently in effect.
+func (w *Watermarker) Settings() models.WatermarkSettings {
+	return *w.settings.Load()
+}
+
+// Update stores settings and applies them to subsequent downloads.
+func (w *Watermarker) Update(settings models.WatermarkSettings) error {
+	settings.UpdatedAt = time.Now()
+	if err := w.repo.SetWatermarkSettings(settings); err != nil {
+		return err
+	}
+	w.settings.Store(&settings)
+	w.clearCache()
+	return nil
+}
+
+// clearCache removes the watermarked images made with previous settings or
+// watermark images.
+func (w *Watermarker) clearCache() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := os.RemoveAll(w.cacheDir); err != nil {
+		log.Printf("Failed to clear the watermark cache: %s", err.Error())
+	}
+}
+
+// HasImage reports whether a watermark image was uploaded.
+func (w *Watermarker) HasImage() bool {
+	w.markMu.RLock()
+	defer w.markMu.RUnlock()
+	return w.mark != nil
+}
+
+// SetImage replaces the watermark image with the image read from r, stored
+// as PNG to keep its transparency.
+func (w *Watermarker) SetImage(r io.Reader) error {
+	mark, _, err := image.Decode(r)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, mark); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(w.dir, 0o755); err != nil {
+		return err
+	}
+	markPath := filepath.Join(w.dir, imageName)
+	if err := os.WriteFile(markPath+".tmp", buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(markPath+".tmp", markPath); err != nil {
+		return err
+	}
+
+	w.markMu.Lock()
+	w.mark, w.markVersion = mark, time.Now().UnixNano()
+	w.markMu.Unlock()
+	w.clearCache()
+	return nil
+}
+
+// DeleteImage removes the watermark image, which turns watermarking off
+// until a new one is uploaded.
+func (w *Watermarker) DeleteImage() error {
+	if err := w.deleteImage(); err != nil {
+		return err
+	}
+	w.clearCache()
+	return nil
+}
+
+func (w *Watermarker) deleteImage() error {
+	w.markMu.Lock()
+	defer w.markMu.Unlock()
+	if w.mark == nil {
+		return ErrNoImage
+	}
+	if err := os.Remove(filepath.Join(w.dir, imageName)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	w.mark, w.markVersion = nil, 0
+	return nil
+}
+
+// ErrCannotWatermark is returned by Path when the settings force the
+// watermark on an image in a format it cannot be encoded in.
+var ErrCannotWatermark = errors.New("the image must be watermarked but its format is not supported")
+
+// Path returns the file to serve for srcPath, the image fileName or a file
+// derived from it such as a transform: srcPath itself, or a watermarked copy
+// when the settings are enabled and requested is set or the settings force
+// the watermark on the image, see forced. Images requested with a watermark
+// in a format that cannot be encoded are served as they are. A nil
+// Watermarker never watermarks.
+func (w *Watermarker) Path(ctx context.Context, fileName, srcPath string, requested bool) (string, error) {
+	if w == nil {
+		return srcPath, nil
+	}
+	settings := w.settings.Load()
+	w.markMu.RLock()
+	mark, markVersion := w.mark, w.markVersion
+	w.markMu.RUnlock()
+	if !settings.Enabled || mark == nil {
+		return srcPath, nil
+	}
+	forced := w.forced(ctx, settings, fileName)
+	if !forced && !requested {
+		return srcPath, nil
+	}
+
+	srcInfo, err := os.Stat(srcPath)
+	if err != nil {
+		return "", err
+	}
+	encoder, err := imaging.Encoder(imaging.Format(srcPath, imaging.Options{}), imaging.DefaultQuality)
+	if err != nil {
+		if forced {
+			return "", ErrCannotWatermark
+		}
+		return srcPath, nil
+	}
+
+	sum := sha256.Sum256([]byte(srcPath))
+	cachePath := filepath.Join(w.cacheDir, fmt.Sprintf("%d-%d-%d-%x%s",
+		settings.UpdatedAt.UnixNano(), markVersion, srcInfo.ModTime().UnixNano(), sum[:8], filepath.Ext(srcPath)))
+	if err := w.ensureWatermarked(srcPath, cachePath, mark, *settings, encoder); err != nil {
+		return "", err
+	}
+	return cachePath, nil
+}
+
+// File returns the file to serve for srcPath like Path, honoring
+// ?watermark=true, or answers with a problem and returns false.
+func (w *Watermarker) File(c *gin.Context, fileName, srcPath string) (string, bool) {
+	served, err := w.Path(c.Request.Context(), fileName, srcPath, c.Query("watermark") == "true")
+	if errors.Is(err, ErrCannotWatermark) {
+		problem.Write(c, http.StatusForbidden, "This image may only be served with a watermark")
+		return "", false
+	} else if err != nil {
+		log.Printf("Failed to watermark %s: %s\n", fileName, err.Error())
+		problem.Write(c, http.StatusInternalServerError, "Failed to watermark image")
+		return "", false
+	}
+	return served, true
+}
+
+// Middleware serves image downloads watermarked, see Path.
+func (w *Watermarker) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			c.Next()
+			return
+		}
+
+		fileName, err := util.FilterFilename(path.Base(c.Request.URL.Path))
+		if err != nil {
+			c.Next()
+			return
+		}
+		srcPath := filepath.Join(util.ExPath, "uploads", "images", fileName)
+		if info, err := os.Stat(srcPath); err != nil || info.IsDir() {
+			c.Next()
+			return
+		}
+		served, ok := w.File(c, fileName, srcPath)
+		if !ok {
+			return
+		}
+		if served == srcPath {
+			c.Next()
+			return
+		}
+
+		c.File(served)
+		c.Abort()
+	}
+}
+
+// Renditions serves the renditions of images, such as their WebP versions,
+// watermarked like the images, see Path.
+func (w *Watermarker) Renditions(renditions models.RenditionRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if w == nil || (c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead) {
+			c.Next()
+			return
+		}
+		fileName, err := util.FilterFilename(path.Base(c.Request.URL.Path))
+		if err != nil {
+			c.Next()
+			return
+		}
+		rendition, err := renditions.GetRenditionByFileName(c.Request.Context(), fileName)
+		if err == nil && rendition.SourceType != models.MediaTypeImage {
+			c.Next()
+			return
+		}
+		var image models.Image
+		if err == nil {
+			image, err = w.images.GetImageByID(c.Request.Context(), rendition.SourceID)
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.Next()
+			return
+		} else if err != nil {
+			log.Printf("Failed to get the source of rendition %s: %s\n", fileName, err.Error())
+			problem.Write(c, http.StatusInternalServerError, "Failed to watermark image")
+			return
+		}
+
+		srcPath := filepath.Join(util.ExPath, "uploads", "renditions", fileName)
+		if info, err := os.Stat(srcPath); err != nil || info.IsDir() {
+			c.Next()
+			return
+		}
+		served, ok := w.File(c, image.FileName, srcPath)
+		if !ok {
+			return
+		}
+		if served == srcPath {
+			c.Next()
+			return
+		}
+		c.File(served)
+		c.Abort()
+	}
+}
+
+// forced reports whether the settings force the watermark on the image
+// fileName: for every image, the images folder or the organization of the
+// image.
+func (w *Watermarker) forced(ctx context.Context, settings *models.WatermarkSettings, fileName string) bool {
+	if settings.Always || slices.Contains(settings.Folders, models.MediaFolder(models.MediaTypeImage)) {
+		return true
+	}
+	if len(settings.Organizations) == 0 {
+		return false
+	}
+	image, err := w.images.GetImageByFileName(ctx, fileName)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false
+	} else if err != nil {
+		// Rather watermark too much than leak an image that must be marked
+		log.Printf("Failed to get image %s: %s\n", fileName, err.Error())
+		return true
+	}
+	return image.OrganizationID != nil && slices.Contains(settings.Organizations, *image.OrganizationID)
+}
+
+func (w *Watermarker) ensureWatermarked(srcPath, cachePath string, mark image.Image, settings models.WatermarkSettings, encoder imgio.Encoder) error {
+	if _, err := os.Stat(cachePath); err == nil {
+		return nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, err := os.Stat(cachePath); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(w.cacheDir, 0o755); err != nil {
+		return err
+	}
+
+	img, err := imgio.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	tmpPath := cachePath + ".tmp"
+	if err := imgio.Save(tmpPath, Apply(img, mark, settings), encoder); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, cachePath)
+}
+
+// Apply returns img with mark composited on it according to settings.
+func Apply(img, mark image.Image, settings models.WatermarkSettings) image.Image {
+	bounds := img.Bounds()
+	out := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(out, out.Bounds(), img, bounds.Min, draw.Src)
+
+	markBounds := mark.Bounds()
+	width := max(1, int(math.Round(float64(bounds.Dx())*settings.Scale)))
+	height := max(1, markBounds.Dy()*width/markBounds.Dx())
+	scaled := transform.Resize(mark, width, height, transform.Linear)
+
+	margin := settings.Margin
+	x, y := bounds.Dx()-width-margin, bounds.Dy()-height-margin
+	switch settings.Position {
+	case models.WatermarkTopLeft:
+		x, y = margin, margin
+	case models.WatermarkTopRight:
+		y = margin
+	case models.WatermarkBottomLeft:
+		x = margin
+	case models.WatermarkCenter:
+		x, y = (bounds.Dx()-width)/2, (bounds.Dy()-height)/2
+	}
+
+	alpha := uint8(math.Round(min(max(settings.Opacity, 0), 1) * 255))
+	draw.DrawMask(out, image.Rect(x, y, x+width, y+height), scaled, image.Point{}, image.NewUniform(color.Alpha{A: alpha}), image.Point{}, draw.Over)
+	return out
+}
@@ -0,0 +1,182 @@
+package watermark
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kevinanielsen/go-fast-cdn/src/database"
+	"github.com/kevinanielsen/go-fast-cdn/src/models"
+	"github.com/kevinanielsen/go-fast-cdn/src/util"
+	"github.com/stretchr/testify/require"
+)
+
+func solid(width, height int, c color.Color) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestApply(t *testing.T) {
+	img := solid(100, 100, color.Black)
+	mark := solid(10, 5, color.White)
+
+	out := Apply(img, mark, models.WatermarkSettings{Position: models.WatermarkTopLeft, Opacity: 1, Scale: 0.2, Margin: 5})
+	require.Equal(t, img.Bounds(), out.Bounds())
+	require.Equal(t, color.NRGBA{255, 255, 255, 255}, color.NRGBAModel.Convert(out.At(10, 8)))
+	require.Equal(t, color.NRGBA{0, 0, 0, 255}, color.NRGBAModel.Convert(out.At(90, 90)))
+
+	out = Apply(img, mark, models.WatermarkSettings{Position: models.WatermarkBottomRight, Opacity: 0.5, Scale: 0.2, Margin: 0})
+	r, _, _, _ := out.At(95, 95).RGBA()
+	require.InDelta(t, 0x8080, r, 0x200)
+}
+
+func TestWatermarker_Middleware(t *testing.T) {
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	imagesDir := filepath.Join(util.ExPath, "uploads", "images")
+	require.NoError(t, os.MkdirAll(imagesDir, 0o755))
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, solid(100, 100, color.Black)))
+	require.NoError(t, os.WriteFile(filepath.Join(imagesDir, "cat.png"), buf.Bytes(), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(imagesDir, "dog.png"), buf.Bytes(), 0o644))
+	org := models.Organization{Name: "Acme"}
+	require.NoError(t, database.DB.Create(&org).Error)
+	require.NoError(t, database.DB.Create(&models.Image{FileName: "dog.png", Checksum: []byte("dog"), OrganizationID: &org.ID}).Error)
+
+	w := New(database.NewConfigRepo(database.DB), database.NewImageRepo(database.DB))
+	r := gin.New()
+	r.Group("/images", w.Middleware()).Static("/", imagesDir)
+	download := func(target string) image.Image {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		img, err := png.Decode(rec.Body)
+		require.NoError(t, err)
+		return img
+	}
+	marked := func(img image.Image) bool {
+		r, _, _, _ := img.At(75, 75).RGBA()
+		return r > 0
+	}
+
+	settings := models.DefaultWatermarkSettings()
+	settings.Enabled = true
+	settings.Opacity = 1
+	require.NoError(t, w.Update(settings))
+
+	// Without a watermark image downloads are untouched
+	require.False(t, marked(download("/images/cat.png?watermark=true")))
+
+	buf.Reset()
+	require.NoError(t, png.Encode(&buf, solid(20, 20, color.White)))
+	require.NoError(t, w.SetImage(&buf))
+	require.True(t, w.HasImage())
+	require.False(t, marked(download("/images/cat.png")))
+	require.True(t, marked(download("/images/cat.png?watermark=true")))
+	require.True(t, marked(download("/images/cat.png?watermark=true")))
+
+	settings.Organizations = []uint{org.ID}
+	require.NoError(t, w.Update(settings))
+	require.True(t, marked(download("/images/dog.png")))
+	require.False(t, marked(download("/images/cat.png")))
+
+	// The settings and image survive a restart
+	reloaded := New(database.NewConfigRepo(database.DB), database.NewImageRepo(database.DB))
+	require.True(t, reloaded.HasImage())
+	require.Equal(t, []uint{org.ID}, reloaded.Settings().Organizations)
+
+	require.NoError(t, w.DeleteImage())
+	require.ErrorIs(t, w.DeleteImage(), ErrNoImage)
+	require.False(t, marked(download("/images/dog.png")))
+}
+
+func TestWatermarker_Path(t *testing.T) {
+	// Arrange
+	util.ExPath = t.TempDir()
+	database.ConnectToDB()
+	ctx := context.Background()
+	imagesDir := filepath.Join(util.ExPath, "uploads", "images")
+	renditionsDir := filepath.Join(util.ExPath, "uploads", "renditions")
+	require.NoError(t, os.MkdirAll(imagesDir, 0o755))
+	require.NoError(t, os.MkdirAll(renditionsDir, 0o755))
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, solid(100, 100, color.Black)))
+	require.NoError(t, os.WriteFile(filepath.Join(imagesDir, "cat.png"), buf.Bytes(), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(renditionsDir, "cat-800.png"), buf.Bytes(), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(imagesDir, "cat.webp"), []byte("RIFF"), 0o644))
+	cat := models.Image{FileName: "cat.png", Checksum: []byte("cat")}
+	require.NoError(t, database.DB.Create(&cat).Error)
+	renditionRepo := database.NewRenditionRepo(database.DB)
+	require.NoError(t, renditionRepo.SaveRendition(ctx, &models.Rendition{SourceType: models.MediaTypeImage, SourceID: cat.ID, Kind: "resize", Variant: "800", FileName: "cat-800.png"}))
+
+	w := New(database.NewConfigRepo(database.DB), database.NewImageRepo(database.DB))
+	buf.Reset()
+	require.NoError(t, png.Encode(&buf, solid(20, 20, color.White)))
+	require.NoError(t, w.SetImage(&buf))
+	settings := models.DefaultWatermarkSettings()
+	settings.Enabled = true
+	settings.Opacity = 1
+	require.NoError(t, w.Update(settings))
+	marked := func(path string) bool {
+		f, err := os.Open(path)
+		require.NoError(t, err)
+		defer f.Close()
+		img, err := png.Decode(f)
+		require.NoError(t, err)
+		r, _, _, _ := img.At(75, 75).RGBA()
+		return r > 0
+	}
+	rendition := filepath.Join(renditionsDir, "cat-800.png")
+	webp := filepath.Join(imagesDir, "cat.webp")
+
+	// Act & Assert: only requested watermarks are applied
+	path, err := w.Path(ctx, "cat.png", rendition, false)
+	require.NoError(t, err)
+	require.Equal(t, rendition, path)
+	path, err = w.Path(ctx, "cat.webp", webp, true)
+	require.NoError(t, err)
+	require.Equal(t, webp, path, "formats that cannot be encoded are served as they are")
+	var none *Watermarker
+	path, err = none.Path(ctx, "cat.png", rendition, true)
+	require.NoError(t, err)
+	require.Equal(t, rendition, path)
+
+	// The folder policy forces the watermark on files derived from images
+	settings.Folders = []string{"images"}
+	require.NoError(t, w.Update(settings))
+	path, err = w.Path(ctx, "cat.png", rendition, false)
+	require.NoError(t, err)
+	require.NotEqual(t, rendition, path)
+	require.True(t, marked(path))
+	_, err = w.Path(ctx, "cat.webp", webp, false)
+	require.ErrorIs(t, err, ErrCannotWatermark)
+
+	r := gin.New()
+	r.Group("/renditions", w.Renditions(renditionRepo)).Static("/", renditionsDir)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/renditions/cat-800.png", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	img, err := png.Decode(rec.Body)
+	require.NoError(t, err)
+	red, _, _, _ := img.At(75, 75).RGBA()
+	require.NotZero(t, red)
+
+	r = gin.New()
+	r.Group("/images", w.Middleware()).Static("/", imagesDir)
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/images/cat.webp", nil))
+	require.Equal(t, http.StatusForbidden, rec.Code)
+}
@@ -1,87 +1,19 @@
+//go:build ui
+
 package ui
 
 import (
 	"embed"
-	"fmt"
 	"io/fs"
-	"net/http"
-	"strings"
-
-	"github.com/gin-gonic/contrib/static"
-	"github.com/gin-gonic/gin"
 )
 
 //go:embed build
-var staticFS embed.FS
-
-// AddRoutes configures the router with middleware to serve the embedded
-// React frontend. It serves the frontend as static files from the
-// embedded build folder. It also configures a fallback filesystem to
-// always serve index.html for unknown routes.
-func AddRoutes(router gin.IRouter) {
-	embeddedBuildFolder := newStaticFileSystem()
-	fallbackFileSystem := newFallbackFileSystem(embeddedBuildFolder)
-	router.Use(static.Serve("/", embeddedBuildFolder))
-	router.Use(static.Serve("/", fallbackFileSystem))
-}
-
-// ----------------------------------------------------------------------
-// staticFileSystem serves files out of the embedded build folder
-
-type staticFileSystem struct {
-	http.FileSystem
-}
+var buildFS embed.FS
 
-var _ static.ServeFileSystem = (*staticFileSystem)(nil)
-
-func newStaticFileSystem() *staticFileSystem {
-	sub, err := fs.Sub(staticFS, "build")
+func init() {
+	sub, err := fs.Sub(buildFS, "build")
 	if err != nil {
 		panic(err)
 	}
-
-	return &staticFileSystem{
-		FileSystem: http.FS(sub),
-	}
-}
-
-func (s *staticFileSystem) Exists(prefix string, path string) bool {
-	buildpath := fmt.Sprintf("build%s", path)
-
-	// support for folders
-	if strings.HasSuffix(path, "/") {
-		_, err := staticFS.ReadDir(strings.TrimSuffix(buildpath, "/"))
-		return err == nil
-	}
-
-	// support for files
-	f, err := staticFS.Open(buildpath)
-	if f != nil {
-		_ = f.Close()
-	}
-	return err == nil
-}
-
-// fallbackFileSystem wraps a staticFileSystem and always serves /index.html
-type fallbackFileSystem struct {
-	staticFileSystem *staticFileSystem
-}
-
-var (
-	_ static.ServeFileSystem = (*fallbackFileSystem)(nil)
-	_ http.FileSystem        = (*fallbackFileSystem)(nil)
-)
-
-func newFallbackFileSystem(staticFileSystem *staticFileSystem) *fallbackFileSystem {
-	return &fallbackFileSystem{
-		staticFileSystem: staticFileSystem,
-	}
-}
-
-func (f *fallbackFileSystem) Open(path string) (http.File, error) {
-	return f.staticFileSystem.Open("/index.html")
-}
-
-func (f *fallbackFileSystem) Exists(prefix string, path string) bool {
-	return true
+	assets = sub
 }
@@ -0,0 +1,137 @@
+// Package ui serves the React admin UI. The UI is only embedded in binaries
+// built with the ui build tag, after building it into ui/build with
+// `pnpm --dir ./ui build`; other binaries serve the API alone.
+package ui
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/contrib/static"
+	"github.com/gin-gonic/gin"
+)
+
+// Version is the version of the embedded UI, set when building with
+// -ldflags "-X github.com/kevinanielsen/go-fast-cdn/ui.Version=v1.2.0".
+var Version = "dev"
+
+// assets holds the built UI, or nil in binaries built without the ui build
+// tag.
+var assets fs.FS
+
+// Info describes the UI served by the binary.
+type Info struct {
+	// Embedded reports whether the binary was built with the UI.
+	Embedded bool `json:"embedded"`
+	// Enabled reports whether the UI is served, which UI_ENABLED=false turns
+	// off for API-only deployments.
+	Enabled bool   `json:"enabled"`
+	Version string `json:"version,omitempty"`
+	// Build is a hash of the index.html of the UI, which changes with every
+	// build, so an open UI can tell it was replaced by an upgrade.
+	Build string `json:"build,omitempty"`
+}
+
+// Current describes the UI of the binary.
+func Current() Info {
+	info := Info{Embedded: assets != nil, Enabled: Enabled()}
+	if !info.Embedded {
+		return info
+	}
+	info.Version = Version
+	if index, err := fs.ReadFile(assets, "index.html"); err == nil {
+		sum := sha256.Sum256(index)
+		info.Build = hex.EncodeToString(sum[:6])
+	}
+	return info
+}
+
+// Enabled reports whether the UI is embedded and UI_ENABLED is not false.
+func Enabled() bool {
+	if assets == nil {
+		return false
+	}
+	val := os.Getenv("UI_ENABLED")
+	if val == "" {
+		return true
+	}
+	enabled, _ := strconv.ParseBool(val)
+	return enabled
+}
+
+// AddRoutes configures the router with middleware to serve the embedded
+// React frontend, unless it is not Enabled. It serves the frontend as
+// static files from the embedded build folder. It also configures a
+// fallback filesystem to always serve index.html for unknown routes.
+func AddRoutes(router gin.IRouter) {
+	if !Enabled() {
+		return
+	}
+	embeddedBuildFolder := newStaticFileSystem(assets)
+	fallbackFileSystem := newFallbackFileSystem(embeddedBuildFolder)
+	router.Use(static.Serve("/", embeddedBuildFolder))
+	router.Use(static.Serve("/", fallbackFileSystem))
+}
+
+// ----------------------------------------------------------------------
+// staticFileSystem serves files out of the embedded build folder
+
+type staticFileSystem struct {
+	http.FileSystem
+	files fs.FS
+}
+
+var _ static.ServeFileSystem = (*staticFileSystem)(nil)
+
+func newStaticFileSystem(files fs.FS) *staticFileSystem {
+	return &staticFileSystem{
+		FileSystem: http.FS(files),
+		files:      files,
+	}
+}
+
+func (s *staticFileSystem) Exists(prefix string, path string) bool {
+	name := strings.Trim(path, "/")
+	if name == "" {
+		name = "."
+	}
+
+	// support for folders
+	if strings.HasSuffix(path, "/") {
+		_, err := fs.ReadDir(s.files, name)
+		return err == nil
+	}
+
+	// support for files
+	_, err := fs.Stat(s.files, name)
+	return err == nil
+}
+
+// fallbackFileSystem wraps a staticFileSystem and always serves /index.html
+type fallbackFileSystem struct {
+	staticFileSystem *staticFileSystem
+}
+
+var (
+	_ static.ServeFileSystem = (*fallbackFileSystem)(nil)
+	_ http.FileSystem        = (*fallbackFileSystem)(nil)
+)
+
+func newFallbackFileSystem(staticFileSystem *staticFileSystem) *fallbackFileSystem {
+	return &fallbackFileSystem{
+		staticFileSystem: staticFileSystem,
+	}
+}
+
+func (f *fallbackFileSystem) Open(path string) (http.File, error) {
+	return f.staticFileSystem.Open("/index.html")
+}
+
+func (f *fallbackFileSystem) Exists(prefix string, path string) bool {
+	return true
+}
@@ -0,0 +1,42 @@
+package ui
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUI(t *testing.T) {
+	// Arrange
+	embedded := assets
+	t.Cleanup(func() { assets = embedded })
+	serve := func(path string) int {
+		router := gin.New()
+		AddRoutes(router)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code
+	}
+
+	// Act & Assert
+	assets = nil
+	require.Equal(t, Info{}, Current())
+	require.Equal(t, http.StatusNotFound, serve("/"))
+
+	assets = fstest.MapFS{"index.html": {Data: []byte("<html></html>")}}
+	info := Current()
+	require.True(t, info.Embedded)
+	require.True(t, info.Enabled)
+	require.Equal(t, Version, info.Version)
+	require.Len(t, info.Build, 12)
+	require.Equal(t, http.StatusOK, serve("/"))
+	require.Equal(t, http.StatusOK, serve("/dashboard/files"), "unknown routes serve index.html")
+
+	t.Setenv("UI_ENABLED", "false")
+	require.False(t, Current().Enabled)
+	require.Equal(t, http.StatusNotFound, serve("/"))
+}